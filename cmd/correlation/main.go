@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"isxcli/internal/analytics"
+)
+
+func main() {
+	dir := flag.String("dir", "reports", "reports directory holding isx_combined_data.csv and indexes.csv")
+	tickers := flag.String("tickers", "", "comma-separated tickers to correlate (default: all)")
+	index := flag.String("index", "ISX60", "index of indexes.csv to include in the matrix (\"\" for none)")
+	window := flag.Int("window", 60, "trading days of daily returns the correlations cover (0 = all)")
+	end := flag.String("end", "", "last date of the window, YYYY-MM-DD (default: the latest date)")
+	out := flag.String("out", "", "output path without extension (default: correlation_matrix in -dir)")
+	flag.Parse()
+
+	var endDate time.Time
+	if *end != "" {
+		var err error
+		if endDate, err = time.Parse("2006-01-02", *end); err != nil {
+			fmt.Printf("Invalid -end: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var names []string
+	for _, t := range strings.Split(*tickers, ",") {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			names = append(names, t)
+		}
+	}
+
+	series, err := analytics.LoadSeries(filepath.Join(*dir, "isx_combined_data.csv"))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	selected, err := analytics.SelectSeries(series, names)
+	if err != nil {
+		fmt.Printf("Invalid -tickers: %v\n", err)
+		os.Exit(1)
+	}
+	if *index != "" {
+		indices, err := analytics.LoadIndexSeries(filepath.Join(*dir, "indexes.csv"))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		s, ok := indices[*index]
+		if !ok {
+			fmt.Printf("Invalid -index: %s is not in indexes.csv\n", *index)
+			os.Exit(1)
+		}
+		selected = append(selected, s)
+	}
+
+	m := analytics.Correlation(selected, *window, endDate)
+	base := *out
+	if base == "" {
+		base = filepath.Join(*dir, "correlation_matrix")
+	}
+	if err := analytics.SaveCorrelation(m, base); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if m.Window == 0 {
+		fmt.Println("No daily returns in the window")
+	} else {
+		fmt.Printf("Correlated %d series over %d days from %s to %s\n", len(m.Tickers), m.Window,
+			m.From.Format("2006-01-02"), m.To.Format("2006-01-02"))
+	}
+	fmt.Printf("Output written to: %s.csv and %s.json\n", base, base)
+}
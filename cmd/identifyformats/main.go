@@ -6,30 +6,26 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
-	"sort"
-	"strings"
 	"time"
 
-	"github.com/xuri/excelize/v2"
+	"isxcli/internal/formats"
+	"isxcli/internal/parser"
+	"isxcli/internal/reportfile"
 )
 
-type Sample struct {
-	Quarter string `json:"quarter"`
-	File    string `json:"file"`
-	Sheet   string `json:"sheet"`
-	Row     int    `json:"row"`
-	Text    string `json:"text"`
-}
-
-var fileRe = regexp.MustCompile(`^(\d{4}) (\d{2}) (\d{2}) ISX Daily Report\.xlsx$`)
-
 func main() {
 	dir := flag.String("dir", "downloads", "directory containing xlsx reports")
 	out := flag.String("out", "index_formats.json", "output JSON file")
+	namePattern := flag.String("name-template", reportfile.DefaultPatternFromEnv(), "report filename template using {YYYY} {MM} {DD}")
 	flag.Parse()
 
-	entries, err := os.ReadDir(*dir)
+	nameTemplate, err := reportfile.Parse(*namePattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -name-template: %v\n", err)
+		os.Exit(1)
+	}
+
+	reports, err := nameTemplate.Find(*dir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "read dir failed: %v\n", err)
 		os.Exit(1)
@@ -40,40 +36,40 @@ func main() {
 		date time.Time
 	}
 	var infos []info
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		m := fileRe.FindStringSubmatch(e.Name())
-		if m == nil {
-			continue
-		}
-		t, _ := time.Parse("2006 01 02", strings.Join(m[1:4], " "))
-		infos = append(infos, info{path: filepath.Join(*dir, e.Name()), date: t})
+	for _, r := range reports {
+		infos = append(infos, info{path: r.Path, date: r.Date})
 	}
 
-	sort.Slice(infos, func(i, j int) bool { return infos[i].date.Before(infos[j].date) })
-
 	// keep first file every 3 months (quarter)
 	seenQuarter := make(map[string]bool)
-	var samples []Sample
+	var samples []formats.Sample
 
 	for _, fi := range infos {
-		q := quarterKey(fi.date)
+		q := formats.QuarterKey(fi.date)
 		if seenQuarter[q] {
 			continue
 		}
 		seenQuarter[q] = true
 
-		sheet, rowIdx, text := findIndexLine(fi.path)
-		samples = append(samples, Sample{
+		opts := parser.DefaultOptions
+		opts.Date = fi.date
+		fp, err := formats.Identify(fi.path, opts)
+		text := fp.IndexLine
+		if fp.IndexRow == 0 {
+			text = "not found"
+		}
+		if err != nil && fp.SHA256 == "" {
+			text = "open error"
+		}
+		samples = append(samples, formats.Sample{
 			Quarter: q,
 			File:    filepath.Base(fi.path),
-			Sheet:   sheet,
-			Row:     rowIdx + 1, // 1-based
+			Sheet:   fp.IndexSheet,
+			Row:     fp.IndexRow,
 			Text:    text,
+			Format:  fp,
 		})
-		fmt.Printf("%s -> %s (sheet %s row %d)\n", q, filepath.Base(fi.path), sheet, rowIdx+1)
+		fmt.Printf("%s -> %s (sheet %s row %d, format %s %s)\n", q, filepath.Base(fi.path), fp.IndexSheet, fp.IndexRow, fp.Signature, fp.Layout)
 	}
 
 	// write json
@@ -91,36 +87,3 @@ func main() {
 	}
 	fmt.Printf("Saved %d format samples to %s\n", len(samples), *out)
 }
-
-func quarterKey(t time.Time) string {
-	q := (int(t.Month())-1)/3 + 1
-	return fmt.Sprintf("%04d-Q%d", t.Year(), q)
-}
-
-func findIndexLine(path string) (sheet string, rowIdx int, text string) {
-	f, err := excelize.OpenFile(path)
-	if err != nil {
-		return "", -1, "open error"
-	}
-	defer f.Close()
-
-	sheetList := f.GetSheetList()
-	// regex to detect line with both indices
-	re60 := regexp.MustCompile(`(?i)ISX[^\n]{0,40}60`)
-	re15 := regexp.MustCompile(`(?i)ISX[^\n]{0,40}15`)
-
-	for _, sh := range sheetList {
-		rows, _ := f.GetRows(sh)
-		for i, row := range rows {
-			joined := strings.Join(row, " ")
-			joined = strings.TrimSpace(joined)
-			if joined == "" {
-				continue
-			}
-			if re60.MatchString(joined) && re15.MatchString(joined) {
-				return sh, i, joined
-			}
-		}
-	}
-	return "", -1, "not found"
-}
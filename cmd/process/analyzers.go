@@ -0,0 +1,10 @@
+package main
+
+// Custom analyzers register themselves with analytics.Register from the init function of their
+// package, and run after the built-in analytics once that package is imported here for its side
+// effects:
+//
+//	import _ "isxcli/analyzers/mymetric"
+//
+// Their outputs are written to the output directory, listed in analyzers.json and served by the
+// web server at /api/analytics/custom.
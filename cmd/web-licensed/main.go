@@ -1,26 +1,41 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"isxcli/internal/analytics"
+	"isxcli/internal/api"
+	"isxcli/internal/csvgz"
+	"isxcli/internal/indices"
 	"isxcli/internal/license"
+	"isxcli/internal/pipeline"
+	"isxcli/internal/processor"
+	"isxcli/internal/reportfile"
+	"isxcli/internal/scraper"
 	"isxcli/internal/updater"
+	"isxcli/internal/webserver"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -38,17 +53,6 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-type CommandRequest struct {
-	Command string            `json:"command"`
-	Args    map[string]string `json:"args"`
-}
-
-type CommandResponse struct {
-	Success bool   `json:"success"`
-	Output  string `json:"output"`
-	Error   string `json:"error,omitempty"`
-}
-
 type WebSocketMessage struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
@@ -62,6 +66,20 @@ type TickerSummary struct {
 	LastDate    string    `json:"last_date"`
 	TradingDays int       `json:"trading_days"`
 	Last10Days  []float64 `json:"last_10_days"`
+
+	// Closing range of the 52 weeks up to LastDate, and how far the last close is below its high
+	High52W        float64 `json:"high_52w"`
+	Low52W         float64 `json:"low_52w"`
+	PercentOffHigh float64 `json:"percent_off_high"`
+
+	// Beta and relative strength against ISX60, null without the index
+	Beta             *float64 `json:"beta"`
+	RelativeStrength *float64 `json:"relative_strength"`
+
+	// Dates, closes and percent changes of the last trading days, for sparklines
+	History *analytics.History `json:"history,omitempty"`
+
+	Liquidity []analytics.Liquidity `json:"liquidity,omitempty"`
 }
 
 type LicenseRequest struct {
@@ -84,13 +102,14 @@ type LicenseTransferRequest struct {
 }
 
 type SystemStatsResponse struct {
-	Performance map[string]interface{} `json:"performance"`
-	Cache       map[string]interface{} `json:"cache"`
-	Security    map[string]interface{} `json:"security"`
-	Timestamp   time.Time              `json:"timestamp"`
-	MachineID   string                 `json:"machine_id"`
-	Version     string                 `json:"version"`
-	Uptime      time.Duration          `json:"uptime"`
+	Performance map[string]interface{}   `json:"performance"`
+	Cache       map[string]interface{}   `json:"cache"`
+	Security    map[string]interface{}   `json:"security"`
+	Pipeline    pipeline.MetricsSnapshot `json:"pipeline"`
+	Timestamp   time.Time                `json:"timestamp"`
+	MachineID   string                   `json:"machine_id"`
+	Version     string                   `json:"version"`
+	Uptime      time.Duration            `json:"uptime"`
 }
 
 var (
@@ -102,6 +121,11 @@ var (
 	wsConnections     []*websocket.Conn
 	wsConnectionsLock sync.Mutex
 	startTime         = time.Now()
+	scheduler         *pipeline.Scheduler
+	pipelineConfig    = &pipeline.Config{}
+	resourceLimiter   *pipeline.Limiter // shared by every pipeline run
+	pipelineMetrics   = pipeline.NewMetrics()
+	nameTemplate      = reportfile.Default // the report filename template of ISX_REPORT_TEMPLATE
 )
 
 // getClientIP extracts client IP from request
@@ -239,6 +263,26 @@ func openBrowser(url string) error {
 }
 
 func main() {
+	server := webserver.FromEnv()
+	server.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := server.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	if nameTemplate, err = reportfile.FromEnv(); err != nil {
+		log.Fatalf("Invalid report filename template: %v", err)
+	}
+
+	// Stop on Ctrl+C or SIGTERM once the requests and pipeline runs in progress finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop() // a second interrupt quits at once
+		log.Println("Shutting down once the pipeline runs in progress finish; interrupt again to quit now")
+	}()
+
 	// Get executable directory for all relative paths
 	exePath, err := os.Executable()
 	if err != nil {
@@ -280,45 +324,64 @@ func main() {
 		updateChecker.Start()
 	}
 
+	// Record the pipeline runs in data/pipeline_runs.jsonl
+	runHistory = pipeline.NewHistory(filepath.Join(executableDir, "data", "pipeline_runs.jsonl"))
+	runLock = pipeline.NewRunLock(filepath.Join(executableDir, "data", "pipeline.lock"))
+	runLineage = pipeline.NewLineage(filepath.Join(executableDir, "data", "lineage.json"))
+	downloadsChanges = pipeline.NewChangeDetector("downloads", filepath.Join(executableDir, "data", "downloads_state.json"))
+
 	r := mux.NewRouter()
 
 	// Add security middleware to all routes
 	r.Use(securityMiddleware)
 
-	// Add license middleware to protected API routes
-	api := r.PathPrefix("/api").Subrouter()
-	api.Use(licenseMiddleware)
-
 	// Serve static files (relative to executable)
 	staticDir := filepath.Join(executableDir, "web", "static")
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir))))
 
-	// Public license endpoints (no license middleware needed)
-	r.HandleFunc("/api/license/status", handleLicenseStatus).Methods("GET")
-	r.HandleFunc("/api/license/activate", handleLicenseActivate).Methods("POST")
-	r.HandleFunc("/api/license/transfer", handleLicenseTransfer).Methods("POST")
-	r.HandleFunc("/api/license/renewal-status", handleRenewalStatus).Methods("GET")
-	r.HandleFunc("/api/license/test-connectivity", handleTestConnectivity).Methods("GET")
-	r.HandleFunc("/api/license/heartbeat", handleLicenseHeartbeat).Methods("POST")
-
-	// Administrative endpoints (requires special handling)
-	r.HandleFunc("/api/admin/system-stats", handleSystemStats).Methods("GET")
-	r.HandleFunc("/api/admin/performance", handlePerformanceStats).Methods("GET")
-	r.HandleFunc("/api/admin/cache-stats", handleCacheStats).Methods("GET")
-	r.HandleFunc("/api/admin/security-stats", handleSecurityStats).Methods("GET")
-	r.HandleFunc("/api/admin/logs", handleGetLogs).Methods("GET")
+	// Public license and administrative endpoints (no license middleware needed)
+	public := []api.Route{
+		api.Raw("GET", "/api/license/status", "The status of the license", handleLicenseStatus).Returns(LicenseStatus{}),
+		api.Raw("POST", "/api/license/activate", "Activate a license key", handleLicenseActivate).Accepts(LicenseRequest{}),
+		api.Raw("POST", "/api/license/transfer", "Transfer the license to this machine", handleLicenseTransfer).Accepts(LicenseTransferRequest{}),
+		api.Raw("GET", "/api/license/renewal-status", "Whether the license needs renewing", handleRenewalStatus),
+		api.Raw("GET", "/api/license/test-connectivity", "Test the connection to the license server", handleTestConnectivity),
+		api.Raw("POST", "/api/license/heartbeat", "Check the license is still valid", handleLicenseHeartbeat),
+		api.Raw("GET", "/api/admin/system-stats", "The performance, cache, security and pipeline statistics", handleSystemStats).Returns(SystemStatsResponse{}),
+		api.Raw("GET", "/api/admin/performance", "The performance statistics and pipeline metrics", handlePerformanceStats),
+		api.Raw("GET", "/api/admin/cache-stats", "The cache statistics", handleCacheStats),
+		api.Raw("GET", "/api/admin/security-stats", "The security statistics", handleSecurityStats),
+		api.Raw("GET", "/api/admin/logs", "The latest lines of the log", handleGetLogs),
+	}
+	r.HandleFunc("/metrics", handleMetrics).Methods("GET")
 
 	// Protected API endpoints (require valid license)
-	api.HandleFunc("/scrape", handleScrape).Methods("POST")
-	api.HandleFunc("/process", handleProcess).Methods("POST")
-	api.HandleFunc("/indexcsv", handleIndexCSV).Methods("POST")
-	api.HandleFunc("/tickers", handleListTickers).Methods("GET")
-	api.HandleFunc("/ticker/{ticker}", handleGetTicker).Methods("GET")
-	api.HandleFunc("/files", handleListFiles).Methods("GET")
-	api.HandleFunc("/download/{filename}", handleDownloadFile).Methods("GET")
-	api.HandleFunc("/status", handleStatus).Methods("GET")
-	api.HandleFunc("/update/check", handleCheckUpdates).Methods("GET")
-	api.HandleFunc("/update/install", handleInstallUpdate).Methods("POST")
+	protected := []api.Route{
+		api.HandleBody("POST", "/api/scrape", "Download the daily reports, then process them", handleScrape),
+		api.HandleBody("POST", "/api/process", "Process the downloaded reports", handleProcess),
+		api.HandleBody("POST", "/api/indexcsv", "Extract the index values of the reports", handleIndexCSV),
+		api.HandleBody("POST", "/api/plan", "Preview the stages a command would run without running them", handlePlan),
+		api.Handle("GET", "/api/pipelines", "The pipelines of pipelines.yaml", handlePipelines),
+		api.Handle("POST", "/api/pipelines/{name}/run", "Run a pipeline of pipelines.yaml", handleRunPipeline),
+		api.Raw("GET", "/api/tickers", "The summaries of the tickers", handleListTickers),
+		api.Raw("GET", "/api/files", "The files of downloads and reports, and the runs producing them", handleListFiles,
+			api.Param{Name: "dir", Description: "the files of one directory only"}),
+		api.Download("/api/download/{filename}", "Download a report file", "application/octet-stream", handleDownloadFile),
+		api.Raw("GET", "/api/status", "The status of the server", handleStatus),
+		api.Handle("GET", "/api/schedules", "The scheduled pipelines with their next and last runs", handleSchedules),
+		api.Raw("GET", "/api/update/check", "Check for a newer version", handleCheckUpdates),
+		api.Raw("POST", "/api/update/install", "Install the newer version", handleInstallUpdate),
+	}
+	protected = append(protected, api.Runs{History: runHistory}.Routes()...)
+	protected = append(protected, api.Reports{Dir: "reports"}.Routes()...)
+
+	spec := api.SpecRoute(api.Info{
+		Title:       "ISX Web Interface API",
+		Version:     "2.0.0",
+		Description: "Scrape, process and analyze the daily reports of the Iraq Stock Exchange",
+	}, append(public, protected...))
+	api.Register(r, append(public, spec))
+	api.Register(r, protected, licenseMiddleware)
 
 	// WebSocket endpoint (protected)
 	r.HandleFunc("/ws", licenseMiddleware(http.HandlerFunc(handleWebSocket)).ServeHTTP)
@@ -329,33 +392,41 @@ func main() {
 	// Start WebSocket message broadcaster
 	go handleMessages()
 
+	// Load the pipelines of pipelines.yaml and start those scheduled there and in
+	// data/schedules.json
+	loadPipelineConfig(filepath.Join(executableDir, "pipelines.yaml"))
+	schedulerDone := startScheduler(ctx, filepath.Join(executableDir, "data", "schedules.json"))
+
 	// Generate ticker summary on startup only if data exists
 	combinedDataPath := filepath.Join(executableDir, "reports", "isx_combined_data.csv")
-	if _, err := os.Stat(combinedDataPath); err == nil {
-		if err := generateTickerSummary(); err != nil {
+	if csvgz.Exists(combinedDataPath) {
+		if err := generateTickerSummary(ctx); err != nil {
 			log.Printf("Warning: Failed to generate ticker summary on startup: %v", err)
 		}
 	}
 
-	serverURL := "http://localhost:8080"
+	serverURL := server.URL()
 	fmt.Printf("🔐 ISX Web Interface (Enhanced Licensed v2.0.0) starting on %s\n", serverURL)
 
-	// Start server in background
+	// Wait a moment for server to start, then open browser
 	go func() {
-		log.Fatal(http.ListenAndServe(":8080", r))
+		time.Sleep(2 * time.Second)
+		if err := openBrowser(serverURL); err != nil {
+			log.Printf("Warning: Could not open browser automatically: %v", err)
+			fmt.Printf("Please open your browser and navigate to: %s\n", serverURL)
+		} else {
+			fmt.Println("✓ Browser opened automatically")
+		}
 	}()
 
-	// Wait a moment for server to start, then open browser
-	time.Sleep(2 * time.Second)
-	if err := openBrowser(serverURL); err != nil {
-		log.Printf("Warning: Could not open browser automatically: %v", err)
-		fmt.Printf("Please open your browser and navigate to: %s\n", serverURL)
-	} else {
-		fmt.Println("✓ Browser opened automatically")
+	// Serve until shut down, then wait for the scheduled runs in progress too, keeping the
+	// WebSocket clients informed until the last one finishes
+	if err := server.Serve(ctx, r); err != nil {
+		log.Fatal(err)
 	}
-
-	// Keep the application running
-	select {}
+	<-schedulerDone
+	closeWebSockets()
+	log.Println("Server stopped")
 }
 
 func checkLicenseOnStartup() {
@@ -418,7 +489,7 @@ func checkLicenseOnStartup() {
 func licenseMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if licenseManager == nil {
-			http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+			api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 			return
 		}
 
@@ -428,46 +499,38 @@ func licenseMiddleware(next http.Handler) http.Handler {
 			// Get detailed validation state for better error messages
 			validationState, _ := licenseManager.GetValidationState()
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-
-			response := map[string]interface{}{
-				"error":    "License required",
-				"code":     "LICENSE_REQUIRED",
-				"redirect": "/license.html",
-			}
+			code := api.CodeLicenseRequired
+			message := "No valid license found. Please contact Iraqi Investor to get a license."
+			contactInfo := "Please contact Iraqi Investor for assistance"
+			actions := []string{"contact_support", "activate_new_license"}
 
 			// Add specific guidance based on error type
 			if validationState != nil {
-				response["error_type"] = validationState.ErrorType
-
 				switch validationState.ErrorType {
 				case "machine_mismatch":
-					response["code"] = "LICENSE_MACHINE_MISMATCH"
-					response["message"] = "This license is not valid for this machine. Please contact Iraqi Investor to get a new license for this machine."
-					response["contact_info"] = "Please contact Iraqi Investor for assistance"
-					response["actions"] = []string{"contact_support", "activate_new_license"}
+					code = api.CodeLicenseMismatch
+					message = "This license is not valid for this machine. Please contact Iraqi Investor to get a new license for this machine."
 				case "expired":
-					response["code"] = "LICENSE_EXPIRED"
-					response["message"] = "Your license has expired. Please contact Iraqi Investor to renew your license."
-					response["contact_info"] = "Please contact Iraqi Investor for renewal"
-					response["actions"] = []string{"contact_support", "activate_new_license"}
+					code = api.CodeLicenseExpired
+					message = "Your license has expired. Please contact Iraqi Investor to renew your license."
+					contactInfo = "Please contact Iraqi Investor for renewal"
 				case "network_error":
-					response["code"] = "LICENSE_NETWORK_ERROR"
-					response["message"] = "Cannot verify license due to network issues. Please check your internet connection and try again."
-					response["actions"] = []string{"retry", "check_network"}
-				default:
-					response["message"] = "No valid license found. Please contact Iraqi Investor to get a license."
-					response["contact_info"] = "Please contact Iraqi Investor for assistance"
-					response["actions"] = []string{"contact_support", "activate_new_license"}
+					code = api.CodeLicenseNetwork
+					message = "Cannot verify license due to network issues. Please check your internet connection and try again."
+					contactInfo = ""
+					actions = []string{"retry", "check_network"}
 				}
-			} else {
-				response["message"] = "No valid license found. Please contact Iraqi Investor to get a license."
-				response["contact_info"] = "Please contact Iraqi Investor for assistance"
-				response["actions"] = []string{"contact_support", "activate_new_license"}
 			}
 
-			json.NewEncoder(w).Encode(response)
+			e := api.NewError(http.StatusUnauthorized, message).WithCode(code).WithDetail("redirect", "/license.html")
+			if validationState != nil {
+				e.WithDetail("error_type", validationState.ErrorType)
+			}
+			if contactInfo != "" {
+				e.WithDetail("contact_info", contactInfo)
+			}
+			e.WithDetail("actions", actions)
+			api.WriteError(w, e)
 			return
 		}
 
@@ -564,12 +627,12 @@ func handleLicenseStatus(w http.ResponseWriter, r *http.Request) {
 func handleLicenseActivate(w http.ResponseWriter, r *http.Request) {
 	var req LicenseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		api.WriteError(w, api.Errorf(http.StatusBadRequest, "invalid request body: %v", err).WithCode(api.CodeInvalidBody))
 		return
 	}
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -578,8 +641,6 @@ func handleLicenseActivate(w http.ResponseWriter, r *http.Request) {
 
 	if err := licenseManager.ActivateLicense(req.LicenseKey); err != nil {
 		log.Printf("License activation failed: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
 
 		// Provide more detailed error messages
 		var userMessage string
@@ -601,10 +662,9 @@ func handleLicenseActivate(w http.ResponseWriter, r *http.Request) {
 			userMessage = fmt.Sprintf("License activation failed: %s", errorStr)
 		}
 
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": userMessage,
-			"debug": errorStr, // Include technical details for debugging
-		})
+		api.WriteError(w, api.NewError(http.StatusBadRequest, userMessage).
+			WithCode(api.CodeActivationFailed).
+			WithDetail("debug", errorStr)) // Include technical details for debugging
 		return
 	}
 
@@ -649,13 +709,13 @@ func min(a, b int) int {
 func handleCheckUpdates(w http.ResponseWriter, r *http.Request) {
 	updaterInstance, err := updater.NewUpdater(VERSION, REPO_URL)
 	if err != nil {
-		http.Error(w, "Failed to initialize updater", http.StatusInternalServerError)
+		api.WriteError(w, api.NewError(http.StatusInternalServerError, "Failed to initialize updater"))
 		return
 	}
 
 	updateInfo, err := updaterInstance.CheckForUpdates()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		api.WriteError(w, err)
 		return
 	}
 
@@ -680,18 +740,18 @@ func handleCheckUpdates(w http.ResponseWriter, r *http.Request) {
 func handleInstallUpdate(w http.ResponseWriter, r *http.Request) {
 	updaterInstance, err := updater.NewUpdater(VERSION, REPO_URL)
 	if err != nil {
-		http.Error(w, "Failed to initialize updater", http.StatusInternalServerError)
+		api.WriteError(w, api.NewError(http.StatusInternalServerError, "Failed to initialize updater"))
 		return
 	}
 
 	updateInfo, err := updaterInstance.CheckForUpdates()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		api.WriteError(w, err)
 		return
 	}
 
 	if updateInfo == nil {
-		http.Error(w, "No updates available", http.StatusBadRequest)
+		api.WriteError(w, api.NewError(http.StatusBadRequest, "No updates available"))
 		return
 	}
 
@@ -791,6 +851,18 @@ func handleMessages() {
 	}
 }
 
+// closeWebSockets tells the WebSocket clients the server is going away and disconnects them
+func closeWebSockets() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for client := range clients {
+		client.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		client.Close()
+		delete(clients, client)
+	}
+}
+
 func broadcastMessage(msgType, message, command string) {
 	broadcast <- WebSocketMessage{
 		Type:    msgType,
@@ -799,12 +871,8 @@ func broadcastMessage(msgType, message, command string) {
 	}
 }
 
-func handleScrape(w http.ResponseWriter, r *http.Request) {
-	var req CommandRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+func handleScrape(r *http.Request, req api.CommandRequest) (api.CommandResponse, error) {
+	req.Command = "scrape"
 
 	// Check if downloads directory has files for the requested date range
 	downloadsDir := filepath.Join(executableDir, "downloads")
@@ -814,16 +882,13 @@ func handleScrape(w http.ResponseWriter, r *http.Request) {
 	fromDate := req.Args["from"]
 	toDate := req.Args["to"]
 
-	if entries, err := os.ReadDir(downloadsDir); err == nil {
-		excelCount := 0
+	if reports, err := nameTemplate.Find(downloadsDir); err == nil {
+		excelCount := len(reports)
 		existingFiles := make(map[string]bool)
 
-		// Build a map of existing Excel files
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".xlsx") {
-				existingFiles[entry.Name()] = true
-				excelCount++
-			}
+		// Build a map of report dates already downloaded
+		for _, report := range reports {
+			existingFiles[report.Date.Format("2006-01-02")] = true
 		}
 
 		if excelCount > 0 {
@@ -848,189 +913,407 @@ func handleScrape(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var response CommandResponse
+	opts := processOptions(req.Args)
 
-	// Download fresh data if needed
-	if needsDownload {
-		broadcastMessage("info", "No Excel files found. Downloading fresh data from ISX website...", "scrape")
-
-		// Use the web scraper to download Excel files
-		scraperArgs := []string{"-mode=initial", "-out=downloads"}
-
-		// Use EXACTLY the dates selected by user in HTML form (no validation overrides)
-		fromDate := req.Args["from"]
-		toDate := req.Args["to"]
+	// Use EXACTLY the dates selected by user in HTML form (no validation overrides)
+	scrapeOpts, err := scrapeOptions(map[string]string{"from": fromDate, "to": toDate})
+	if err != nil {
+		return api.CommandResponse{}, api.Errorf(http.StatusBadRequest, "%v", err)
+	}
+	m := newPipeline(scrapeOpts, opts)
+	m.Changes = downloadsChanges
 
-		// Always use the dates selected by user - no modifications or validation
+	// Download fresh data if needed, then extract the indices and process the Excel files unless
+	// the downloads are unchanged since they were last processed, then analyse the result and
+	// regenerate the ticker summary alongside
+	stages := afterScrape
+	if needsDownload {
 		if fromDate != "" {
-			scraperArgs = append(scraperArgs, "-from="+fromDate)
 			broadcastMessage("info", fmt.Sprintf("Using FROM date from form: %s", fromDate), "scrape")
 		}
 		if toDate != "" {
-			scraperArgs = append(scraperArgs, "-to="+toDate)
 			broadcastMessage("info", fmt.Sprintf("Using TO date from form: %s", toDate), "scrape")
 		}
+		stages = append([]string{pipeline.StageScrape}, afterScrape...)
+	}
+	response := runPipeline(context.Background(), req, m, stages...)
 
-		scraperPath := filepath.Join(executableDir, "bin", "isx-web-scraper.exe")
-		broadcastMessage("info", fmt.Sprintf("Starting scrape command: %s %s", scraperPath, strings.Join(scraperArgs, " ")), "scrape")
+	if response.Success {
+		broadcastMessage("success", "✅ Complete data pipeline finished! All data updated.", "scrape")
 
-		scraperResponse := executeCommandWithTimeout(scraperPath, scraperArgs, "scrape", 5*time.Minute)
+		// Notify frontend to refresh all components
+		broadcastMessage("refresh", "data_updated", "scrape")
+	} else if !response.Busy {
+		broadcastMessage("warning", "Data pipeline failed", "scrape")
+	}
 
-		if !scraperResponse.Success {
-			broadcastMessage("error", "Failed to download fresh data from ISX website", "scrape")
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(scraperResponse)
-			return
-		}
+	return response.Result()
+}
+
+func handleProcess(r *http.Request, req api.CommandRequest) (api.CommandResponse, error) {
+	req.Command = "process"
 
-		broadcastMessage("success", "✅ Fresh data downloaded successfully from ISX website", "scrape")
+	// Process, then extract the indices, analyse the result and regenerate the ticker summary
+	m, stages, err := commandPipeline("process", req.Args)
+	if err != nil {
+		return api.CommandResponse{}, api.Errorf(http.StatusBadRequest, "%v", err)
 	}
+	response := runPipeline(context.Background(), req, m, stages...)
 
-	// Now process the Excel files
-	broadcastMessage("info", "Processing Excel files from downloads directory...", "scrape")
+	if response.Success {
+		broadcastMessage("success", "✅ Complete processing pipeline finished! All data updated.", "process")
 
-	// Build command arguments for the processing tool
-	args := []string{}
+		// Notify frontend to refresh all components
+		broadcastMessage("refresh", "data_updated", "process")
+	}
 
-	// Set input directory (default: downloads)
-	if inDir := req.Args["in"]; inDir != "" {
-		args = append(args, "-in="+inDir)
-	} else {
-		args = append(args, "-in=downloads")
+	return response.Result()
+}
+
+// handlePlan previews a command request: the stages it would run, in order, and the files each
+// would download or parse, without running them
+func handlePlan(r *http.Request, req api.CommandRequest) (*pipeline.Plan, error) {
+	m, stages, err := commandPipeline(req.Command, req.Args)
+	if err != nil {
+		return nil, api.Errorf(http.StatusBadRequest, "%v", err)
 	}
+	addNotification(m)
+	return m.Plan(r.Context(), stages...)
+}
 
-	// Set output directory (default: reports)
-	if outDir := req.Args["out"]; outDir != "" {
-		args = append(args, "-out="+outDir)
-	} else {
-		args = append(args, "-out=reports")
+// commandPipeline returns the pipeline of a scrape, process or indexcsv request and the stages
+// the command runs, all of them when nil
+func commandPipeline(command string, args map[string]string) (*pipeline.Manager, []string, error) {
+	switch command {
+	case "scrape":
+		scrapeOpts, err := scrapeOptions(args)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newPipeline(scrapeOpts, processOptions(args)), nil, nil
+	case "process":
+		return newPipeline(scraper.Options{}, processOptions(args)), afterScrape, nil
+	case "indexcsv":
+		return pipeline.NewManager(&pipeline.IndicesStage{Options: indexOptions(args)}), nil, nil
+	}
+	if name, ok := strings.CutPrefix(command, "pipeline:"); ok {
+		p, ok := pipelineConfig.Pipeline(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown pipeline %q", name)
+		}
+		m, err := p.Build(stageFactories)
+		if err == nil && p.SkipUnchanged {
+			// Pipelines may process the downloads into other directories, so each has its own state
+			m.Changes = pipeline.NewChangeDetector("downloads", filepath.Join(executableDir, "data", "downloads_state_"+name+".json"))
+		}
+		return m, nil, err
 	}
+	return nil, nil, fmt.Errorf("unknown command %q", command)
+}
 
+// processOptions returns the processor options of a scrape or process request
+func processOptions(args map[string]string) processor.Options {
+	opts := processor.DefaultOptions()
+	opts.Progress = true
+	// Set input directory (default: downloads)
+	if inDir := args["in"]; inDir != "" {
+		opts.InDir = inDir
+	}
+	// Set output directory (default: reports)
+	if outDir := args["out"]; outDir != "" {
+		opts.OutDir = outDir
+	}
 	// Enable full rework if requested
-	if mode := req.Args["mode"]; mode == "full" {
-		args = append(args, "-full")
+	if mode := args["mode"]; mode == "full" {
+		opts.Full = true
 	}
+	return opts
+}
 
-	processPath := filepath.Join(executableDir, "process.exe")
-	response = executeCommand(processPath, args, "scrape")
-
-	// If scraping was successful, automatically process the data
-	if response.Success {
-		broadcastMessage("info", "Scraping completed successfully. Starting automatic data processing...", "scrape")
-
-		// Run processing automatically
-		processArgs := []string{"-in=downloads"}
-		processPath := filepath.Join(executableDir, "process.exe")
-		processResponse := executeCommandWithStreaming(processPath, processArgs, "process")
+// newPipeline returns the scrape and process pipeline: the reports scraped into the downloads,
+// their indices extracted and processed into the CSV files of process.OutDir, then the analysis
+// and the ticker summary, which only need the processed files, run in parallel
+//
+// Given downloadsChanges as its Changes, a run finding the downloads unchanged since they were last
+// processed skips the index extraction and processing. The analysis and ticker summary are
+// skipped when processing is or parses no report.
+func newPipeline(scrape scraper.Options, process processor.Options) *pipeline.Manager {
+	analysis := pipeline.NewAnalysisStage(process.OutDir)
+	analysis.Condition = pipeline.IfNewDates
+	m := pipeline.NewManager(
+		&pipeline.ScrapingStage{Options: scrape, Retry: pipeline.DefaultScrapeRetry},
+		&pipeline.IndicesStage{Options: pipelineIndexOptions()},
+		&pipeline.ProcessingStage{Options: process},
+		analysis,
+		tickerSummaryStage{},
+	)
+	m.Mode = pipeline.ExecutionModeParallel
+	m.StageTimeouts = stageTimeouts
+	return m
+}
 
-		if processResponse.Success {
-			broadcastMessage("info", "Data processing completed. Extracting market indices...", "scrape")
+// stageTimeouts stop the attempts of the stages of newPipeline that stall, e.g. a scrape on a
+// hung Chrome session, which is then retried
+var stageTimeouts = map[string]time.Duration{
+	pipeline.StageScrape: 5 * time.Minute,
+}
 
-			// Run index extraction automatically
-			indexArgs := []string{"-dir=downloads", "-out=reports/indexes.csv"}
-			indexcsvPath := filepath.Join(executableDir, "indexcsv.exe")
-			indexResponse := executeCommand(indexcsvPath, indexArgs, "indexcsv")
+// afterScrape are the stages of newPipeline run on the downloaded reports
+var afterScrape = []string{pipeline.StageIndices, pipeline.StageProcess, pipeline.StageAnalysis, stageTickerSummary}
 
-			if indexResponse.Success {
-				broadcastMessage("info", "Index extraction completed. Generating ticker summary...", "scrape")
+// startScheduler runs the pipelines of the schedules in path as their cron expressions fire,
+// broadcasting the status of a schedule as a "schedule" message when each run starts and ends.
+// Once ctx is done no run starts; the returned channel is closed when those in progress finished.
+func startScheduler(ctx context.Context, path string) <-chan struct{} {
+	done := make(chan struct{})
+	schedules, err := pipeline.LoadSchedules(path)
+	if err == nil {
+		schedules = append(schedules, pipelineConfig.Schedules...)
+		scheduler, err = pipeline.NewScheduler(runSchedule, schedules...)
+	}
+	if err != nil {
+		log.Printf("Warning: Scheduled pipelines disabled: %v", err)
+		close(done)
+		return done
+	}
+	scheduler.OnEvent = func(status pipeline.ScheduleStatus) {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return
+		}
+		broadcastMessage("schedule", string(data), "schedule")
+	}
+	go func() {
+		defer close(done)
+		scheduler.Run(ctx)
+	}()
+	return done
+}
 
-				// Generate fresh ticker summary after processing
-				if err := generateTickerSummary(); err != nil {
-					broadcastMessage("warning", fmt.Sprintf("Warning: Failed to generate ticker summary: %v", err), "scrape")
-				} else {
-					broadcastMessage("success", "✅ Complete data pipeline finished! All data updated.", "scrape")
+// runSchedule executes the stages of a schedule, all of them when it names none, of its pipeline
+// of pipelines.yaml or else of newPipeline with the scraper configured by its arguments like a
+// scrape request
+func runSchedule(ctx context.Context, s pipeline.Schedule) error {
+	var m *pipeline.Manager
+	if s.Pipeline != "" {
+		var err error
+		if m, _, err = commandPipeline("pipeline:"+s.Pipeline, s.Args); err != nil {
+			return err
+		}
+	} else {
+		scrapeOpts, err := scrapeOptions(s.Args)
+		if err != nil {
+			return err
+		}
+		opts := processor.DefaultOptions()
+		opts.Progress = true
+		if outDir := s.Args["out"]; outDir != "" {
+			opts.OutDir = outDir
+		}
+		m = newPipeline(scrapeOpts, opts)
+		m.Changes = downloadsChanges
+	}
+	if s.Timeout > 0 {
+		m.Timeout = time.Duration(s.Timeout)
+	}
+	dir := s.Args["out"]
+	if dir == "" {
+		dir = "reports"
+	}
+	addEmail(m, dir)
+	// A run in progress as the server shuts down is finished rather than cancelled
+	response := runPipeline(context.WithoutCancel(ctx), api.CommandRequest{Command: "schedule:" + s.Name, Args: s.Args}, m, s.Stages...)
+	if !response.Success {
+		return errors.New(response.Error)
+	}
+	broadcastMessage("refresh", "data_updated", "schedule")
+	return nil
+}
 
-					// Notify frontend to refresh all components
-					broadcastMessage("refresh", "data_updated", "scrape")
-				}
-			} else {
-				broadcastMessage("warning", "Index extraction failed after processing", "scrape")
+// loadPipelineConfig reads the pipelines, schedules and resource limits of path, checking every
+// pipeline builds; the server runs its built-in pipeline without limits only when the file is
+// missing or invalid
+func loadPipelineConfig(path string) {
+	config, err := pipeline.LoadConfig(path)
+	if err == nil {
+		for _, p := range config.Pipelines {
+			if _, err = p.Build(stageFactories); err != nil {
+				break
 			}
-		} else {
-			broadcastMessage("warning", "Data processing failed after scraping", "scrape")
 		}
 	}
+	var limiter *pipeline.Limiter
+	if err == nil {
+		limiter, err = pipeline.NewLimiter(config.Limits)
+	}
+	if err != nil {
+		log.Printf("Warning: Configured pipelines disabled: %v", err)
+		return
+	}
+	pipelineConfig = config
+	resourceLimiter = limiter
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// stageFactories build the stages of pipelines.yaml from their params, which configure them like
+// the arguments of the scrape, process and indexcsv requests. Command stages are built by the
+// pipeline package.
+var stageFactories = map[string]pipeline.StageFactory{
+	pipeline.StageScrape: func(c pipeline.StageConfig) (pipeline.Stage, error) {
+		opts, err := scrapeOptions(c.Params)
+		if err != nil {
+			return nil, err
+		}
+		return &pipeline.ScrapingStage{Options: opts, Retry: pipeline.DefaultScrapeRetry}, nil
+	},
+	pipeline.StageIndices: func(c pipeline.StageConfig) (pipeline.Stage, error) {
+		return &pipeline.IndicesStage{Options: indexOptions(c.Params)}, nil
+	},
+	pipeline.StageProcess: func(c pipeline.StageConfig) (pipeline.Stage, error) {
+		return &pipeline.ProcessingStage{Options: processOptions(c.Params)}, nil
+	},
+	pipeline.StageAnalysis: func(c pipeline.StageConfig) (pipeline.Stage, error) {
+		dir := c.Params["dir"]
+		if dir == "" {
+			dir = "reports"
+		}
+		return pipeline.NewAnalysisStage(dir), nil
+	},
+	stageTickerSummary: func(pipeline.StageConfig) (pipeline.Stage, error) {
+		return tickerSummaryStage{}, nil
+	},
 }
 
-func handleProcess(w http.ResponseWriter, r *http.Request) {
-	var req CommandRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// handlePipelines lists the pipelines of pipelines.yaml
+func handlePipelines(r *http.Request) ([]pipeline.PipelineConfig, error) {
+	pipelines := pipelineConfig.Pipelines
+	if pipelines == nil {
+		pipelines = []pipeline.PipelineConfig{}
 	}
+	return pipelines, nil
+}
 
-	args := []string{}
-	if inDir := req.Args["in"]; inDir != "" {
-		args = append(args, "-in="+inDir)
+// handleRunPipeline runs a pipeline of pipelines.yaml
+func handleRunPipeline(r *http.Request) (api.CommandResponse, error) {
+	req := api.CommandRequest{Command: "pipeline:" + mux.Vars(r)["name"]}
+	m, _, err := commandPipeline(req.Command, nil)
+	if err != nil {
+		return api.CommandResponse{}, api.Errorf(http.StatusNotFound, "%v", err)
 	}
-	if mode := req.Args["mode"]; mode == "full" {
-		args = append(args, "-full")
+	response := runPipeline(context.Background(), req, m)
+	if response.Success {
+		broadcastMessage("refresh", "data_updated", req.Command)
 	}
+	return response.Result()
+}
 
-	processPath := filepath.Join(executableDir, "process.exe")
-	response := executeCommandWithStreaming(processPath, args, "process")
+// handleSchedules lists the scheduled pipelines with their next and last runs
+func handleSchedules(r *http.Request) ([]pipeline.ScheduleStatus, error) {
+	if scheduler == nil {
+		return []pipeline.ScheduleStatus{}, nil
+	}
+	return scheduler.Status(), nil
+}
 
-	// If processing was successful, run complete pipeline
-	if response.Success {
-		broadcastMessage("info", "Processing completed successfully. Extracting market indices...", "process")
+// stageTickerSummary is the name of tickerSummaryStage
+const stageTickerSummary = "ticker-summary"
 
-		// Run index extraction automatically
-		indexArgs := []string{"-dir=downloads", "-out=reports/indexes.csv"}
-		indexcsvPath := filepath.Join(executableDir, "indexcsv.exe")
-		indexResponse := executeCommand(indexcsvPath, indexArgs, "indexcsv")
+// tickerSummaryStage regenerates the ticker summary the dashboard lists from the processed data
+type tickerSummaryStage struct{}
 
-		if indexResponse.Success {
-			broadcastMessage("info", "Index extraction completed. Generating ticker summary...", "process")
+func (tickerSummaryStage) Name() string { return stageTickerSummary }
 
-			// Generate fresh ticker summary after processing
-			if err := generateTickerSummary(); err != nil {
-				broadcastMessage("warning", fmt.Sprintf("Warning: Failed to generate ticker summary: %v", err), "process")
-			} else {
-				broadcastMessage("success", "✅ Complete processing pipeline finished! All data updated.", "process")
+// Inputs returns the combined CSV, so the summary runs after the stage producing it
+func (tickerSummaryStage) Inputs() []pipeline.Artifact {
+	return []pipeline.Artifact{pipeline.ArtifactCombinedCSV}
+}
 
-				// Notify frontend to refresh all components
-				broadcastMessage("refresh", "data_updated", "process")
-			}
-		} else {
-			broadcastMessage("warning", "Index extraction failed after processing", "process")
-		}
-	}
+func (tickerSummaryStage) ShouldRun(done pipeline.Outcomes) (bool, string) {
+	return pipeline.IfNewDates(done)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+func (tickerSummaryStage) Run(ctx context.Context, out io.Writer) error {
+	// A run cancelled at shutdown stops here rather than rewriting the summary
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := generateTickerSummary(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Ticker summary written to reports/ticker_summary.csv and ticker_summary.json")
+	return nil
 }
 
-func handleIndexCSV(w http.ResponseWriter, r *http.Request) {
-	var req CommandRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// scrapeOptions returns the scraper options of a scrape request, with the defaults of the
+// isxcli command for the arguments it leaves out
+func scrapeOptions(args map[string]string) (scraper.Options, error) {
+	opts := scraper.Options{
+		Mode:         scraper.ModeInitial,
+		OutDir:       "downloads",
+		Headless:     true,
+		Resume:       true,
+		CheckChanged: true,
+		NameTemplate: nameTemplate,
+	}
+	if mode := args["mode"]; mode != "" {
+		opts.Mode = mode
+	}
+	from := args["from"]
+	if from == "" {
+		from = "2025-01-01"
 	}
+	var err error
+	if opts.From, err = time.Parse("2006-01-02", from); err != nil {
+		return opts, fmt.Errorf("invalid from date: %w", err)
+	}
+	if to := args["to"]; to != "" {
+		if opts.To, err = time.Parse("2006-01-02", to); err != nil {
+			return opts, fmt.Errorf("invalid to date: %w", err)
+		}
+	}
+	if headless := args["headless"]; headless != "" {
+		if opts.Headless, err = strconv.ParseBool(headless); err != nil {
+			return opts, fmt.Errorf("invalid headless: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// pipelineIndexOptions returns the index extraction options of the scrape and process pipeline:
+// the downloads extracted into reports/indexes.csv, along with the indexes.json the dashboard
+// chart reads
+func pipelineIndexOptions() indices.Options {
+	opts := indices.DefaultOptions()
+	opts.Out = filepath.Join("reports", "indexes.csv")
+	opts.Format = "json"
+	return opts
+}
 
-	args := []string{}
+// indexOptions returns the index extraction options of an indexcsv request
+func indexOptions(args map[string]string) indices.Options {
+	opts := pipelineIndexOptions()
 
 	// Set input directory (default: downloads)
-	if dir := req.Args["dir"]; dir != "" {
-		args = append(args, "-dir="+dir)
-	} else {
-		args = append(args, "-dir=downloads")
+	if dir := args["dir"]; dir != "" {
+		opts.Dir = dir
 	}
 
 	// Set output file (default: reports/indexes.csv)
-	if out := req.Args["out"]; out != "" {
-		args = append(args, "-out="+out)
-	} else {
-		args = append(args, "-out=reports/indexes.csv")
+	if out := args["out"]; out != "" {
+		opts.Out = out
 	}
+	return opts
+}
 
-	indexcsvPath := filepath.Join(executableDir, "indexcsv.exe")
-	response := executeCommand(indexcsvPath, args, "indexcsv")
+func handleIndexCSV(r *http.Request, req api.CommandRequest) (api.CommandResponse, error) {
+	req.Command = "indexcsv"
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	m, _, err := commandPipeline("indexcsv", req.Args)
+	if err != nil {
+		return api.CommandResponse{}, api.Errorf(http.StatusBadRequest, "%v", err)
+	}
+	response := runPipeline(context.Background(), req, m)
+
+	return response.Result()
 }
 
 func handleListTickers(w http.ResponseWriter, r *http.Request) {
@@ -1041,12 +1324,8 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 	// Check if summary file exists
 	if _, err := os.Stat(summaryFile); os.IsNotExist(err) {
 		// Generate summary if it doesn't exist
-		if err := generateTickerSummary(); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":   "Failed to generate ticker summary",
-				"tickers": []TickerSummary{},
-			})
+		if err := generateTickerSummary(r.Context()); err != nil {
+			api.WriteError(w, api.Errorf(http.StatusInternalServerError, "Failed to generate ticker summary: %v", err))
 			return
 		}
 	}
@@ -1054,61 +1333,19 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 	// Read the summary file
 	data, err := os.ReadFile(summaryFile)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":   "Failed to read ticker summary",
-			"tickers": []TickerSummary{},
-		})
+		api.WriteError(w, api.Errorf(http.StatusInternalServerError, "Failed to read ticker summary: %v", err))
 		return
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(data, &result); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":   "Failed to parse ticker summary",
-			"tickers": []TickerSummary{},
-		})
+		api.WriteError(w, api.Errorf(http.StatusInternalServerError, "Failed to parse ticker summary: %v", err))
 		return
 	}
 
 	json.NewEncoder(w).Encode(result)
 }
 
-func handleGetTicker(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	ticker := vars["ticker"]
-
-	// Try both possible CSV file names
-	csvFiles := []string{
-		filepath.Join("reports", ticker+".csv"),
-		filepath.Join("reports", ticker+"_trading_history.csv"),
-	}
-
-	var csvData []byte
-	var err error
-
-	for _, csvFile := range csvFiles {
-		csvData, err = os.ReadFile(csvFile)
-		if err == nil {
-			break
-		}
-	}
-
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":  "Ticker not found",
-			"ticker": ticker,
-		})
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/csv")
-	w.Write(csvData)
-}
-
 func handleListFiles(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -1141,7 +1378,14 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 		var dailyReports []string
 		var otherFiles []string
 
+		seen := make(map[string]bool)
 		for _, file := range reportsFiles {
+			// Compressed CSVs are listed and downloaded under their plain name
+			file = csvgz.Name(file)
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
 			fileName := strings.ToLower(file)
 			if strings.HasSuffix(fileName, ".csv") || strings.HasSuffix(fileName, ".json") {
 				if strings.Contains(fileName, "_trading_history.csv") {
@@ -1163,11 +1407,18 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 		sort.Sort(sort.Reverse(sort.StringSlice(dailyReports))) // Daily reports: newest first
 		sort.Strings(otherFiles)                                // Other files: alphabetical
 
+		// The run that produced each report, stale when reports were downloaded since
+		lineage, err := runLineage.Files("downloads")
+		if err != nil {
+			log.Printf("Warning: Could not read the lineage of the reports: %v", err)
+		}
+
 		response := map[string]interface{}{
 			"downloads":     excelFiles,
 			"ticker_files":  tickerFiles,
 			"daily_reports": dailyReports,
 			"other_files":   otherFiles,
+			"lineage":       lineage,
 		}
 
 		json.NewEncoder(w).Encode(response)
@@ -1177,11 +1428,7 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 	// If dir is specified, return files from that directory
 	files, err := listDirectory(dir)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": err.Error(),
-			"files": []string{},
-		})
+		api.WriteError(w, err)
 		return
 	}
 
@@ -1191,11 +1438,7 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	filename := mux.Vars(r)["filename"]
 	if filename == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "Missing filename",
-		})
+		api.WriteError(w, api.NewError(http.StatusBadRequest, "Missing filename"))
 		return
 	}
 
@@ -1223,23 +1466,14 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if foundPath == "" {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"error":    "File not found in downloads or reports directories",
-					"filename": filename,
-				})
+				api.WriteError(w, api.NewError(http.StatusNotFound, "File not found in downloads or reports directories").
+					WithDetail("filename", filename))
 				return
 			}
 
 			file, err := os.Open(foundPath)
 			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"error":    err.Error(),
-					"filename": filename,
-				})
+				api.WriteError(w, api.NewError(http.StatusNotFound, err.Error()).WithDetail("filename", filename))
 				return
 			}
 			defer file.Close()
@@ -1247,26 +1481,27 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
 			w.Header().Set("Content-Type", "application/octet-stream")
 
-			_, err = io.Copy(w, file)
-			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"error": err.Error(),
-				})
+			if _, err := io.Copy(w, file); err != nil {
+				// The file is partly sent, too late for an error response
+				log.Printf("Error serving %s: %v", filename, err)
 			}
 			return
 		}
 	}
 
+	// CSV outputs may be stored compressed and are sent decompressed to clients that need it
+	if strings.HasSuffix(strings.ToLower(filename), ".csv") && csvgz.Exists(filepath.Join(dir, filename)) {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := csvgz.Serve(w, r, filepath.Join(dir, filename)); err != nil {
+			log.Printf("Error serving %s: %v", filename, err)
+		}
+		return
+	}
+
 	file, err := os.Open(filepath.Join(dir, filename))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":    err.Error(),
-			"filename": filename,
-		})
+		api.WriteError(w, api.NewError(http.StatusNotFound, err.Error()).WithDetail("filename", filename))
 		return
 	}
 	defer file.Close()
@@ -1274,14 +1509,9 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
 	w.Header().Set("Content-Type", "application/octet-stream")
 
-	_, err = io.Copy(w, file)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+	if _, err := io.Copy(w, file); err != nil {
+		// The file is partly sent, too late for an error response
+		log.Printf("Error serving %s: %v", filename, err)
 	}
 }
 
@@ -1289,166 +1519,196 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	// Implementation remains the same
 }
 
-func executeCommand(command string, args []string, commandType string) CommandResponse {
-	broadcastMessage("info", fmt.Sprintf("Starting %s command: %s %s", commandType, command, strings.Join(args, " ")), commandType)
-
-	cmd := exec.Command(command, args...)
-	output, err := cmd.CombinedOutput()
-
-	response := CommandResponse{
-		Success: err == nil,
-		Output:  string(output),
+func checkMissingDateRangeFiles(existingFiles map[string]bool, fromDate, toDate string) []string {
+	// Parse the date range
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		log.Printf("Error parsing from date %s: %v", fromDate, err)
+		return []string{}
 	}
 
+	to, err := time.Parse("2006-01-02", toDate)
 	if err != nil {
-		response.Error = err.Error()
-		broadcastMessage("error", fmt.Sprintf("Command failed: %s", err.Error()), commandType)
-	} else {
-		broadcastMessage("success", fmt.Sprintf("Command completed successfully"), commandType)
+		log.Printf("Error parsing to date %s: %v", toDate, err)
+		return []string{}
 	}
 
-	broadcastMessage("output", string(output), commandType)
+	var missingFiles []string
 
-	return response
+	// Check each date in the range (excluding weekends)
+	for current := from; !current.After(to); current = current.AddDate(0, 0, 1) {
+		// Skip weekends (Saturday = 6, Sunday = 0)
+		if current.Weekday() == time.Saturday || current.Weekday() == time.Sunday {
+			continue
+		}
+
+		// Check if a report for this date exists
+		if !existingFiles[current.Format("2006-01-02")] {
+			missingFiles = append(missingFiles, nameTemplate.Name(current))
+		}
+	}
+
+	return missingFiles
 }
 
-func executeCommandWithStreaming(command string, args []string, commandType string) CommandResponse {
-	broadcastMessage("info", fmt.Sprintf("Starting %s command: %s %s", commandType, command, strings.Join(args, " ")), commandType)
+// runHistory records every pipeline run for /api/pipeline/runs
+var runHistory *pipeline.History
 
-	cmd := exec.Command(command, args...)
+// runLock keeps pipeline runs from overlapping and writing the same files at once
+var runLock *pipeline.RunLock
 
-	// Create pipes for stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		response := CommandResponse{
-			Success: false,
-			Error:   err.Error(),
-		}
-		broadcastMessage("error", fmt.Sprintf("Failed to create stdout pipe: %s", err.Error()), commandType)
-		return response
-	}
+// runLineage records the run producing each file of reports for /api/files
+var runLineage *pipeline.Lineage
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		response := CommandResponse{
-			Success: false,
-			Error:   err.Error(),
-		}
-		broadcastMessage("error", fmt.Sprintf("Failed to create stderr pipe: %s", err.Error()), commandType)
-		return response
-	}
+// downloadsChanges skips processing the downloads on scrapes and scheduled runs finding them
+// unchanged since they were last processed into the same output directory
+var downloadsChanges *pipeline.ChangeDetector
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		response := CommandResponse{
-			Success: false,
-			Error:   err.Error(),
-		}
-		broadcastMessage("error", fmt.Sprintf("Failed to start command: %s", err.Error()), commandType)
-		return response
+// stageCommands are the WebSocket command types of the pipeline stages: the commands they replace
+var stageCommands = map[string]string{
+	pipeline.StageScrape:   "scrape",
+	pipeline.StageProcess:  "process",
+	pipeline.StageIndices:  "indexcsv",
+	pipeline.StageAnalysis: "correlation",
+	pipeline.StageNotify:   "notify",
+	pipeline.StageEmail:    "email",
+	stageTickerSummary:     "ticker-summary",
+}
+
+// stageCommand returns the WebSocket command type of a stage, its name for the command stages of
+// pipelines.yaml
+func stageCommand(stage string) string {
+	if command, ok := stageCommands[stage]; ok {
+		return command
 	}
+	return stage
+}
 
-	// Create a goroutine to read and broadcast stdout
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			broadcastMessage("output", line, commandType)
+// runPipeline executes the stages of m, all of them unless named, streaming the log of each over
+// the WebSocket as the output of its command, and records the run of req in runHistory
+func runPipeline(ctx context.Context, req api.CommandRequest, m *pipeline.Manager, stages ...string) api.CommandResponse {
+	addNotification(m)
+	m.Limiter = resourceLimiter
+	m.Metrics = pipelineMetrics
+	// Scheduled runs queue behind the run in progress, requests of the web interface are refused
+	m.Lock = runLock
+	m.WaitForLock = strings.HasPrefix(req.Command, "schedule:")
+	// The manager serializes these calls, also when stages run in parallel
+	writers := make(map[string]*broadcastWriter)
+	m.Output = func(stage string) io.Writer {
+		writers[stage] = &broadcastWriter{commandType: stageCommand(stage)}
+		return writers[stage]
+	}
+	// The overall progress of the run, its stages weighted, drives the pipeline progress bar
+	m.OnProgress = func(p pipeline.Progress) {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return
 		}
-	}()
-
-	// Create a goroutine to read and broadcast stderr
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			broadcastMessage("error", line, commandType)
+		broadcastMessage("pipeline_progress", string(data), req.Command)
+	}
+	m.OnEvent = func(ev pipeline.Event) {
+		commandType := stageCommand(ev.Stage)
+		switch ev.Status {
+		case pipeline.StatusStarted:
+			broadcastMessage("info", fmt.Sprintf("Starting %s command", commandType), commandType)
+		case pipeline.StatusRetrying:
+			writers[ev.Stage].Flush()
+			broadcastMessage("warning", fmt.Sprintf("Attempt %d failed: %s; retrying in %s", ev.Attempt, ev.Err, ev.Delay), commandType)
+		case pipeline.StatusCompleted:
+			writers[ev.Stage].Flush()
+			broadcastMessage("success", "Command completed successfully", commandType)
+		case pipeline.StatusFailed:
+			writers[ev.Stage].Flush()
+			broadcastMessage("error", fmt.Sprintf("Command failed: %s", ev.Err), commandType)
+		case pipeline.StatusTimedOut:
+			writers[ev.Stage].Flush()
+			broadcastMessage("error", fmt.Sprintf("Command timed out: %s", ev.Err), commandType)
+		case pipeline.StatusSkipped:
+			broadcastMessage("info", fmt.Sprintf("Skipped: %s", ev.Reason), commandType)
 		}
-	}()
-
-	// Wait for the command to complete
-	err = cmd.Wait()
+	}
+	err := m.Execute(ctx, stages...)
+	if errors.Is(err, pipeline.ErrLocked) {
+		broadcastMessage("error", fmt.Sprintf("Command refused: %v", err), req.Command)
+		return api.CommandResponse{Error: err.Error(), Busy: true}
+	}
+	run := pipeline.Run{Command: req.Command, Params: req.Args, Summary: m.Summary()}
+	if id, herr := runHistory.Add(run); herr != nil {
+		log.Printf("Warning: Could not record pipeline run: %v", herr)
+	} else {
+		run.ID = id
+		if lerr := runLineage.Record(run, "reports", m.Outputs()); lerr != nil {
+			log.Printf("Warning: Could not record the lineage of the reports: %v", lerr)
+		}
+	}
 
-	response := CommandResponse{
+	response := api.CommandResponse{
 		Success: err == nil,
 		Output:  "Command output streamed via WebSocket",
 	}
-
 	if err != nil {
 		response.Error = err.Error()
-		broadcastMessage("error", fmt.Sprintf("Command failed: %s", err.Error()), commandType)
-	} else {
-		broadcastMessage("success", fmt.Sprintf("Command completed successfully"), commandType)
 	}
-
 	return response
 }
 
-func executeCommandWithTimeout(command string, args []string, commandType string, timeout time.Duration) CommandResponse {
-	broadcastMessage("info", fmt.Sprintf("Starting %s command with %v timeout: %s %s", commandType, timeout, command, strings.Join(args, " ")), commandType)
-
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, command, args...)
-	output, err := cmd.CombinedOutput()
-
-	response := CommandResponse{
-		Success: err == nil,
-		Output:  string(output),
-	}
-
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			response.Error = fmt.Sprintf("Command timed out after %v", timeout)
-			broadcastMessage("error", fmt.Sprintf("Command timed out after %v", timeout), commandType)
-		} else {
-			response.Error = err.Error()
-			broadcastMessage("error", fmt.Sprintf("Command failed: %s", err.Error()), commandType)
-		}
-	} else {
-		broadcastMessage("success", fmt.Sprintf("Command completed successfully"), commandType)
+// addNotification adds the notification of the webhooks of ISX_WEBHOOKS to m, once
+func addNotification(m *pipeline.Manager) {
+	if urls := pipeline.WebhooksFromEnv(); len(urls) > 0 && !slices.Contains(m.Stages(), pipeline.StageNotify) {
+		m.Register(&pipeline.NotificationStage{URLs: urls})
 	}
-
-	broadcastMessage("output", string(output), commandType)
-
-	return response
 }
 
-func checkMissingDateRangeFiles(existingFiles map[string]bool, fromDate, toDate string) []string {
-	// Parse the date range
-	from, err := time.Parse("2006-01-02", fromDate)
+// addEmail adds the email of the run summary to the recipients of ISX_SMTP_TO to m, once, the
+// movers ranked from the combined CSV of dir unless m produces one
+func addEmail(m *pipeline.Manager, dir string) {
+	config, ok, err := pipeline.SMTPFromEnv()
 	if err != nil {
-		log.Printf("Error parsing from date %s: %v", fromDate, err)
-		return []string{}
+		log.Printf("Warning: Email notifications disabled: %v", err)
+		return
 	}
-
-	to, err := time.Parse("2006-01-02", toDate)
-	if err != nil {
-		log.Printf("Error parsing to date %s: %v", toDate, err)
-		return []string{}
+	if ok && !slices.Contains(m.Stages(), pipeline.StageEmail) {
+		m.Register(&pipeline.EmailStage{SMTP: config, Dir: dir})
 	}
+}
 
-	var missingFiles []string
+// broadcastWriter broadcasts every line written to it with broadcastOutputLine
+type broadcastWriter struct {
+	commandType string
+	partial     []byte // the line being written
+}
 
-	// Check each date in the range (excluding weekends)
-	for current := from; !current.After(to); current = current.AddDate(0, 0, 1) {
-		// Skip weekends (Saturday = 6, Sunday = 0)
-		if current.Weekday() == time.Saturday || current.Weekday() == time.Sunday {
-			continue
+func (w *broadcastWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
 		}
+		broadcastOutputLine(strings.TrimRight(string(w.partial[:i]), "\r"), w.commandType)
+		w.partial = w.partial[i+1:]
+	}
+}
 
-		// Generate expected filename for this date
-		expectedFileName := fmt.Sprintf("%s ISX Daily Report.xlsx", current.Format("2006 01 02"))
-
-		// Check if file exists
-		if !existingFiles[expectedFileName] {
-			missingFiles = append(missingFiles, expectedFileName)
-		}
+// Flush broadcasts the last line when it has no newline
+func (w *broadcastWriter) Flush() {
+	if len(w.partial) > 0 {
+		broadcastOutputLine(string(w.partial), w.commandType)
+		w.partial = nil
 	}
+}
 
-	return missingFiles
+// broadcastOutputLine forwards one line of command output. Structured progress lines of the
+// processor are sent as "progress" and "status" messages carrying their JSON payload.
+func broadcastOutputLine(line, commandType string) {
+	if payload, ok := strings.CutPrefix(line, "[WEBSOCKET_PROGRESS] "); ok {
+		broadcastMessage("progress", payload, commandType)
+	} else if payload, ok := strings.CutPrefix(line, "[WEBSOCKET_STATUS] "); ok {
+		broadcastMessage("status", payload, commandType)
+	} else {
+		broadcastMessage("output", line, commandType)
+	}
 }
 
 func listDirectory(dir string) ([]string, error) {
@@ -1475,9 +1735,9 @@ func getActualLastTradingDate(ticker string) (string, float64) {
 	}
 
 	for _, filePath := range possibleFiles {
-		if _, err := os.Stat(filePath); err == nil {
+		if csvgz.Exists(filePath) {
 			// File exists, read it
-			file, err := os.Open(filePath)
+			file, err := csvgz.Open(filePath)
 			if err != nil {
 				continue
 			}
@@ -1519,9 +1779,9 @@ func getActualLast10TradingDays(ticker string) []float64 {
 	}
 
 	for _, filePath := range possibleFiles {
-		if _, err := os.Stat(filePath); err == nil {
+		if csvgz.Exists(filePath) {
 			// File exists, read it
-			file, err := os.Open(filePath)
+			file, err := csvgz.Open(filePath)
 			if err != nil {
 				continue
 			}
@@ -1565,18 +1825,112 @@ func getActualLast10TradingDays(ticker string) []float64 {
 	return []float64{}
 }
 
-func generateTickerSummary() error {
+// yearRange returns the 52-week closing range of a ticker's rows, sorted by date, and how far
+// its last close is below the high
+func yearRange(data []map[string]string) (high, low, percentOffHigh float64) {
+	var bars []analytics.Bar
+	for _, row := range data {
+		date, err := time.Parse("2006-01-02", row["date"])
+		if err != nil {
+			continue
+		}
+		price, _ := strconv.ParseFloat(row["close_price"], 64)
+		bars = append(bars, analytics.Bar{Date: date, Close: price})
+	}
+	return analytics.YearRange(bars)
+}
+
+// historyDays returns the trading days of the summaries' recent history: ISX_HISTORY_DAYS, or
+// analytics.DefaultHistoryDays when unset or invalid
+func historyDays() int {
+	if days, err := strconv.Atoi(os.Getenv("ISX_HISTORY_DAYS")); err == nil && days > 0 {
+		return days
+	}
+	return analytics.DefaultHistoryDays
+}
+
+// optionalValue returns v, or nil when NaN
+func optionalValue(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// formatOptional formats v as a CSV cell, empty when nil
+func formatOptional(v *float64, decimals int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', decimals, 64)
+}
+
+// tickerSeries returns the rows of every ticker, sorted by date, as series
+func tickerSeries(tickerData map[string][]map[string]string) map[string]*analytics.TickerSeries {
+	series := make(map[string]*analytics.TickerSeries)
+	for ticker, data := range tickerData {
+		s := &analytics.TickerSeries{Ticker: ticker}
+		for _, row := range data {
+			date, err := time.Parse("2006-01-02", row["date"])
+			if err != nil {
+				continue
+			}
+			bar := analytics.Bar{Date: date, Traded: row["traded"] != "false"}
+			bar.Close, _ = strconv.ParseFloat(row["close_price"], 64)
+			bar.Volume, _ = strconv.ParseInt(row["volume"], 10, 64)
+			bar.Value, _ = strconv.ParseFloat(row["value"], 64)
+			bar.Shares, _ = strconv.ParseFloat(row["shares"], 64)
+			s.Bars = append(s.Bars, bar)
+		}
+		sort.Slice(s.Bars, func(i, j int) bool { return s.Bars[i].Date.Before(s.Bars[j].Date) })
+		series[ticker] = s
+	}
+	return series
+}
+
+// liquidity returns the liquidity metrics of every ticker over the market sessions of all of them
+func liquidity(series map[string]*analytics.TickerSeries) map[string][]analytics.Liquidity {
+	calendar := analytics.MarketCalendar(series)
+	byTicker := make(map[string][]analytics.Liquidity)
+	for ticker, s := range series {
+		for _, window := range analytics.DefaultLiquidityWindows {
+			byTicker[ticker] = append(byTicker[ticker], analytics.ComputeLiquidity(s.Bars, calendar, window))
+		}
+	}
+	return byTicker
+}
+
+// relativeToIndex returns the beta and relative strength of every ticker against ISX60 after its
+// last trade, none when indexes.csv can't be read
+func relativeToIndex(series map[string]*analytics.TickerSeries) map[string]analytics.BetaPoint {
+	byTicker := make(map[string]analytics.BetaPoint)
+	indices, err := analytics.LoadIndexSeries(filepath.Join(executableDir, "reports", "indexes.csv"))
+	if err != nil || indices[analytics.BetaIndex] == nil {
+		return byTicker
+	}
+	for ticker, s := range series {
+		points := analytics.RelativeToIndex(s.Bars, indices[analytics.BetaIndex].Bars, analytics.DefaultBetaWindow)
+		if len(points) > 0 {
+			byTicker[ticker] = points[len(points)-1]
+		}
+	}
+	return byTicker
+}
+
+// generateTickerSummary writes ticker_summary.csv and ticker_summary.json from the combined CSV,
+// giving up without writing them once ctx is cancelled
+func generateTickerSummary(ctx context.Context) error {
 	combinedFile := filepath.Join(executableDir, "reports", "isx_combined_data.csv")
 	summaryCSVFile := filepath.Join(executableDir, "reports", "ticker_summary.csv")
 	summaryJSONFile := filepath.Join(executableDir, "reports", "ticker_summary.json")
 
 	// Check if combined file exists
-	if _, err := os.Stat(combinedFile); os.IsNotExist(err) {
+	if !csvgz.Exists(combinedFile) {
 		return fmt.Errorf("combined CSV file not found: %s", combinedFile)
 	}
 
 	// Read combined CSV
-	file, err := os.Open(combinedFile)
+	file, err := csvgz.Open(combinedFile)
 	if err != nil {
 		return fmt.Errorf("failed to open combined file: %v", err)
 	}
@@ -1598,6 +1952,8 @@ func generateTickerSummary() error {
 	companyCol := -1
 	dateCol := -1
 	closeCol := -1
+	// Optional columns of the liquidity metrics
+	extraCols := make(map[string]int)
 
 	for i, col := range header {
 		switch strings.ToLower(col) {
@@ -1609,6 +1965,12 @@ func generateTickerSummary() error {
 			dateCol = i
 		case "close_price", "closeprice", "close":
 			closeCol = i
+		case "volume", "value":
+			extraCols[strings.ToLower(col)] = i
+		case "shares_outstanding", "sharesoutstanding":
+			extraCols["shares"] = i
+		case "trading_status", "tradingstatus":
+			extraCols["traded"] = i
 		}
 	}
 
@@ -1636,14 +1998,26 @@ func generateTickerSummary() error {
 			"date":         strings.TrimSpace(record[dateCol]),
 			"close_price":  strings.TrimSpace(record[closeCol]),
 		}
+		for key, col := range extraCols {
+			if col < len(record) {
+				rowData[key] = strings.TrimSpace(record[col])
+			}
+		}
 
 		tickerData[ticker] = append(tickerData[ticker], rowData)
 	}
 
+	series := tickerSeries(tickerData)
+	liquidityByTicker := liquidity(series)
+	relativeByTicker := relativeToIndex(series)
+
 	// Create ticker summaries with actual last trading dates from individual files
 	var summaries []TickerSummary
 
 	for ticker, data := range tickerData {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if len(data) == 0 {
 			continue
 		}
@@ -1681,13 +2055,24 @@ func generateTickerSummary() error {
 			}
 		}
 
+		high52W, low52W, percentOffHigh := yearRange(data)
 		summary := TickerSummary{
-			Ticker:      ticker,
-			CompanyName: lastRecord["company_name"],
-			LastPrice:   lastPrice,
-			LastDate:    lastRecord["date"],
-			TradingDays: len(data),
-			Last10Days:  last10Days,
+			Ticker:         ticker,
+			CompanyName:    lastRecord["company_name"],
+			LastPrice:      lastPrice,
+			LastDate:       lastRecord["date"],
+			TradingDays:    len(data),
+			Last10Days:     last10Days,
+			High52W:        high52W,
+			Low52W:         low52W,
+			PercentOffHigh: percentOffHigh,
+			Liquidity:      liquidityByTicker[ticker],
+		}
+		history := analytics.RecentHistory(series[ticker].Bars, historyDays())
+		summary.History = &history
+		if relative, ok := relativeByTicker[ticker]; ok {
+			summary.Beta = optionalValue(relative.Beta)
+			summary.RelativeStrength = optionalValue(relative.RelativeStrength)
 		}
 
 		summaries = append(summaries, summary)
@@ -1709,7 +2094,12 @@ func generateTickerSummary() error {
 	defer writer.Flush()
 
 	// Write header
-	writer.Write([]string{"Ticker", "CompanyName", "LastPrice", "LastDate", "TradingDays", "Last10Days"})
+	columns := []string{"Ticker", "CompanyName", "LastPrice", "LastDate", "TradingDays", "Last10Days", "High52W", "Low52W", "PercentOffHigh", "Beta", "RelativeStrength"}
+	columns = append(columns, analytics.HistoryColumns()...)
+	for _, window := range analytics.DefaultLiquidityWindows {
+		columns = append(columns, analytics.LiquidityNames(window)...)
+	}
+	writer.Write(columns)
 
 	// Write data
 	for _, summary := range summaries {
@@ -1721,14 +2111,28 @@ func generateTickerSummary() error {
 			last10DaysStr += fmt.Sprintf("%.3f", price)
 		}
 
-		writer.Write([]string{
+		row := []string{
 			summary.Ticker,
 			summary.CompanyName,
 			fmt.Sprintf("%.3f", summary.LastPrice),
 			summary.LastDate,
 			fmt.Sprintf("%d", summary.TradingDays),
 			last10DaysStr,
-		})
+			fmt.Sprintf("%.3f", summary.High52W),
+			fmt.Sprintf("%.3f", summary.Low52W),
+			fmt.Sprintf("%.2f", summary.PercentOffHigh),
+			formatOptional(summary.Beta, 4),
+			formatOptional(summary.RelativeStrength, 2),
+		}
+		if summary.History != nil {
+			row = append(row, summary.History.Cells()...)
+		} else {
+			row = append(row, make([]string, len(analytics.HistoryColumns()))...)
+		}
+		for _, l := range summary.Liquidity {
+			row = append(row, l.Cells()...)
+		}
+		writer.Write(row)
 	}
 
 	// Also write JSON file for API consumption
@@ -1758,11 +2162,7 @@ func handleTestConnectivity(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "License system unavailable",
-		})
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -1770,11 +2170,7 @@ func handleTestConnectivity(w http.ResponseWriter, r *http.Request) {
 
 	if err := licenseManager.TestNetworkConnectivity(); err != nil {
 		log.Printf("Connectivity test failed: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		api.WriteError(w, api.NewError(http.StatusBadGateway, err.Error()).WithCode(api.CodeLicenseNetwork))
 		return
 	}
 
@@ -1788,12 +2184,12 @@ func handleTestConnectivity(w http.ResponseWriter, r *http.Request) {
 func handleLicenseTransfer(w http.ResponseWriter, r *http.Request) {
 	var req LicenseTransferRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		api.WriteError(w, api.Errorf(http.StatusBadRequest, "invalid request body: %v", err).WithCode(api.CodeInvalidBody))
 		return
 	}
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -1802,8 +2198,6 @@ func handleLicenseTransfer(w http.ResponseWriter, r *http.Request) {
 
 	if err := licenseManager.TransferLicense(req.LicenseKey, req.ForceTransfer); err != nil {
 		log.Printf("License transfer failed: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
 
 		// Provide detailed error messages
 		var userMessage string
@@ -1819,10 +2213,9 @@ func handleLicenseTransfer(w http.ResponseWriter, r *http.Request) {
 			userMessage = fmt.Sprintf("License transfer failed: %s", errorStr)
 		}
 
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": userMessage,
-			"debug": errorStr,
-		})
+		api.WriteError(w, api.NewError(http.StatusBadRequest, userMessage).
+			WithCode(api.CodeTransferFailed).
+			WithDetail("debug", errorStr))
 		return
 	}
 
@@ -1837,21 +2230,15 @@ func handleRenewalStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":         "License system unavailable",
-			"needs_renewal": true,
-			"status":        "System Error",
-		})
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").
+			WithCode(api.CodeLicenseUnavailable).
+			WithDetail("needs_renewal", true))
 		return
 	}
 
 	renewalInfo, err := licenseManager.CheckRenewalStatus()
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":         err.Error(),
-			"needs_renewal": true,
-			"status":        "Error",
-		})
+		api.WriteError(w, api.NewError(http.StatusInternalServerError, err.Error()).WithDetail("needs_renewal", true))
 		return
 	}
 
@@ -1863,7 +2250,7 @@ func handleSystemStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -1875,6 +2262,7 @@ func handleSystemStats(w http.ResponseWriter, r *http.Request) {
 		MachineID: "current_machine",
 		Version:   "2.0.0",
 		Uptime:    time.Since(startTime),
+		Pipeline:  pipelineMetrics.Snapshot(),
 	}
 
 	// Safely convert performance stats
@@ -1919,22 +2307,31 @@ func handlePerformanceStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
 	stats := licenseManager.GetPerformanceMetrics()
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"performance_metrics": stats,
+		"pipeline_metrics":    pipelineMetrics.Snapshot(),
 		"timestamp":           time.Now(),
 	})
 }
 
+// handleMetrics serves the pipeline metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := pipelineMetrics.WritePrometheus(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
+
 func handleCacheStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -1949,7 +2346,7 @@ func handleSecurityStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -1994,7 +2391,7 @@ func handleGetLogs(w http.ResponseWriter, r *http.Request) {
 
 	data, err := os.ReadFile(logFile)
 	if err != nil {
-		http.Error(w, "Failed to read log file", http.StatusInternalServerError)
+		api.WriteError(w, api.NewError(http.StatusInternalServerError, "Failed to read log file"))
 		return
 	}
 
@@ -2021,22 +2418,14 @@ func handleLicenseHeartbeat(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "License system unavailable",
-		})
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
 	// Send license heartbeat by updating last connected time
 	if err := licenseManager.UpdateLastConnected(); err != nil {
 		log.Printf("License heartbeat failed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		api.WriteError(w, err)
 		return
 	}
 
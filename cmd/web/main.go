@@ -1,22 +1,38 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"isxcli/internal/analytics"
+	"isxcli/internal/api"
+	"isxcli/internal/csvgz"
+	"isxcli/internal/indices"
 	"isxcli/internal/license"
+	"isxcli/internal/pipeline"
+	"isxcli/internal/processor"
+	"isxcli/internal/reportfile"
+	"isxcli/internal/scraper"
+	"isxcli/internal/webserver"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -28,17 +44,6 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-type CommandRequest struct {
-	Command string            `json:"command"`
-	Args    map[string]string `json:"args"`
-}
-
-type CommandResponse struct {
-	Success bool   `json:"success"`
-	Output  string `json:"output"`
-	Error   string `json:"error,omitempty"`
-}
-
 type WebSocketMessage struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
@@ -52,6 +57,20 @@ type TickerSummary struct {
 	LastDate    string    `json:"last_date"`
 	TradingDays int       `json:"trading_days"`
 	Last10Days  []float64 `json:"last_10_days"`
+
+	// Closing range of the 52 weeks up to LastDate, and how far the last close is below its high
+	High52W        float64 `json:"high_52w"`
+	Low52W         float64 `json:"low_52w"`
+	PercentOffHigh float64 `json:"percent_off_high"`
+
+	// Beta and relative strength against ISX60, null without the index
+	Beta             *float64 `json:"beta"`
+	RelativeStrength *float64 `json:"relative_strength"`
+
+	// Dates, closes and percent changes of the last trading days, for sparklines
+	History *analytics.History `json:"history,omitempty"`
+
+	Liquidity []analytics.Liquidity `json:"liquidity,omitempty"`
 }
 
 type LicenseRequest struct {
@@ -70,11 +89,31 @@ var (
 	broadcast      = make(chan WebSocketMessage)
 	mutex          = &sync.Mutex{}
 	licenseManager *license.Manager
+	nameTemplate   = reportfile.Default // the report filename template of ISX_REPORT_TEMPLATE
 )
 
 func main() {
-	// Initialize license manager
+	server := webserver.FromEnv()
+	server.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := server.Validate(); err != nil {
+		log.Fatal(err)
+	}
 	var err error
+	if nameTemplate, err = reportfile.FromEnv(); err != nil {
+		log.Fatalf("Invalid report filename template: %v", err)
+	}
+
+	// Stop on Ctrl+C or SIGTERM once the requests and pipeline runs in progress finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop() // a second interrupt quits at once
+		log.Println("Shutting down once the pipeline runs in progress finish; interrupt again to quit now")
+	}()
+
+	// Initialize license manager
 	licenseManager, err = license.NewManager("license.dat")
 	if err != nil {
 		log.Printf("Warning: Failed to initialize license manager: %v", err)
@@ -86,21 +125,33 @@ func main() {
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./web/static/"))))
 
 	// License endpoints (no middleware needed)
-	r.HandleFunc("/api/license/status", handleLicenseStatus).Methods("GET")
-	r.HandleFunc("/api/license/activate", handleLicenseActivate).Methods("POST")
-	r.HandleFunc("/api/license/heartbeat", handleLicenseHeartbeat).Methods("POST")
+	public := []api.Route{
+		api.Raw("GET", "/api/license/status", "The status of the license", handleLicenseStatus).Returns(LicenseStatus{}),
+		api.Raw("POST", "/api/license/activate", "Activate a license key", handleLicenseActivate).Accepts(LicenseRequest{}),
+		api.Raw("POST", "/api/license/heartbeat", "Check the license is still valid", handleLicenseHeartbeat),
+	}
 
 	// Protected API endpoints - require valid license
-	api := r.PathPrefix("/api").Subrouter()
-	api.Use(licenseMiddleware)
-	api.HandleFunc("/scrape", handleScrape).Methods("POST")
-	api.HandleFunc("/process", handleProcess).Methods("POST")
-	api.HandleFunc("/indexcsv", handleIndexCSV).Methods("POST")
-	api.HandleFunc("/tickers", handleListTickers).Methods("GET")
-	api.HandleFunc("/ticker/{ticker}", handleGetTicker).Methods("GET")
-	api.HandleFunc("/files", handleListFiles).Methods("GET")
-	api.HandleFunc("/download/{filename}", handleDownloadFile).Methods("GET")
-	api.HandleFunc("/status", handleStatus).Methods("GET")
+	protected := []api.Route{
+		api.HandleBody("POST", "/api/scrape", "Download the daily reports", handleScrape),
+		api.HandleBody("POST", "/api/process", "Process the downloaded reports", handleProcess),
+		api.HandleBody("POST", "/api/indexcsv", "Extract the index values of the reports", handleIndexCSV),
+		api.HandleBody("POST", "/api/plan", "Preview the stages a command would run without running them", handlePlan),
+		api.Raw("GET", "/api/tickers", "The summaries of the tickers", handleListTickers),
+		api.Raw("GET", "/api/files", "The files of downloads and reports", handleListFiles),
+		api.Download("/api/download/{filename}", "Download a report file", "application/octet-stream", handleDownloadFile),
+		api.Raw("GET", "/api/status", "The status of the server", handleStatus),
+	}
+	protected = append(protected, api.Runs{History: runHistory}.Routes()...)
+	protected = append(protected, api.Reports{Dir: "reports"}.Routes()...)
+
+	spec := api.SpecRoute(api.Info{
+		Title:       "ISX Web Interface API",
+		Version:     "1.0.0",
+		Description: "Scrape, process and analyze the daily reports of the Iraq Stock Exchange",
+	}, append(public, protected...))
+	api.Register(r, append(public, spec))
+	api.Register(r, protected, licenseMiddleware)
 
 	// WebSocket endpoint (license check handled in handleWebSocket)
 	r.HandleFunc("/ws", handleWebSocket)
@@ -112,20 +163,24 @@ func main() {
 	go handleMessages()
 
 	// Generate ticker summary on startup only if data exists
-	if _, err := os.Stat("reports/isx_combined_data.csv"); err == nil {
+	if csvgz.Exists("reports/isx_combined_data.csv") {
 		if err := generateTickerSummary(); err != nil {
 			log.Printf("Warning: Failed to generate ticker summary on startup: %v", err)
 		}
 	}
 
-	fmt.Println("🔐 ISX Web Interface (Licensed) starting on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	fmt.Printf("🔐 ISX Web Interface (Licensed) starting on %s\n", server.URL())
+	if err := server.Serve(ctx, r); err != nil {
+		log.Fatal(err)
+	}
+	closeWebSockets()
+	log.Println("Server stopped")
 }
 
 func licenseMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if licenseManager == nil {
-			http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+			api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 			return
 		}
 
@@ -134,41 +189,35 @@ func licenseMiddleware(next http.Handler) http.Handler {
 			// Get detailed validation state for better error messages
 			validationState, _ := licenseManager.GetValidationState()
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-
-			response := map[string]interface{}{
-				"error":    "License required",
-				"code":     "LICENSE_REQUIRED",
-				"redirect": "/license.html",
-			}
+			code := api.CodeLicenseRequired
+			message := "No valid license found. Please contact Iraqi Investor to get a license."
+			contactInfo := "Please contact Iraqi Investor for assistance"
 
 			// Add specific guidance based on error type
 			if validationState != nil {
-				response["error_type"] = validationState.ErrorType
-
 				switch validationState.ErrorType {
 				case "machine_mismatch":
-					response["code"] = "LICENSE_MACHINE_MISMATCH"
-					response["message"] = "This license is not valid for this machine. Please contact Iraqi Investor to get a new license for this machine."
-					response["contact_info"] = "Please contact Iraqi Investor for assistance"
+					code = api.CodeLicenseMismatch
+					message = "This license is not valid for this machine. Please contact Iraqi Investor to get a new license for this machine."
 				case "expired":
-					response["code"] = "LICENSE_EXPIRED"
-					response["message"] = "Your license has expired. Please contact Iraqi Investor to renew your license."
-					response["contact_info"] = "Please contact Iraqi Investor for renewal"
+					code = api.CodeLicenseExpired
+					message = "Your license has expired. Please contact Iraqi Investor to renew your license."
+					contactInfo = "Please contact Iraqi Investor for renewal"
 				case "network_error":
-					response["code"] = "LICENSE_NETWORK_ERROR"
-					response["message"] = "Cannot verify license due to network issues. Please check your internet connection and try again."
-				default:
-					response["message"] = "No valid license found. Please contact Iraqi Investor to get a license."
-					response["contact_info"] = "Please contact Iraqi Investor for assistance"
+					code = api.CodeLicenseNetwork
+					message = "Cannot verify license due to network issues. Please check your internet connection and try again."
+					contactInfo = ""
 				}
-			} else {
-				response["message"] = "No valid license found. Please contact Iraqi Investor to get a license."
-				response["contact_info"] = "Please contact Iraqi Investor for assistance"
 			}
 
-			json.NewEncoder(w).Encode(response)
+			e := api.NewError(http.StatusUnauthorized, message).WithCode(code).WithDetail("redirect", "/license.html")
+			if validationState != nil {
+				e.WithDetail("error_type", validationState.ErrorType)
+			}
+			if contactInfo != "" {
+				e.WithDetail("contact_info", contactInfo)
+			}
+			api.WriteError(w, e)
 			return
 		}
 
@@ -239,21 +288,17 @@ func handleLicenseStatus(w http.ResponseWriter, r *http.Request) {
 func handleLicenseActivate(w http.ResponseWriter, r *http.Request) {
 	var req LicenseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		api.WriteError(w, api.Errorf(http.StatusBadRequest, "invalid request body: %v", err).WithCode(api.CodeInvalidBody))
 		return
 	}
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
 	if err := licenseManager.ActivateLicense(req.LicenseKey); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": err.Error(),
-		})
+		api.WriteError(w, api.NewError(http.StatusBadRequest, err.Error()).WithCode(api.CodeActivationFailed))
 		return
 	}
 
@@ -287,18 +332,18 @@ func handleLicenseHeartbeat(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if licenseManager == nil {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
 	// First check if license is valid
 	valid, err := licenseManager.ValidateLicense()
 	if !valid {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":   "License invalid or expired",
-			"message": err.Error(),
-		})
+		e := api.NewError(http.StatusUnauthorized, "License invalid or expired")
+		if err != nil {
+			e.WithDetail("reason", err.Error())
+		}
+		api.WriteError(w, e)
 		return
 	}
 
@@ -351,11 +396,11 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Check license before allowing WebSocket connection
 	if licenseManager != nil {
 		if valid, _ := licenseManager.ValidateLicense(); !valid {
-			http.Error(w, "License required", http.StatusUnauthorized)
+			api.WriteError(w, api.NewError(http.StatusUnauthorized, "License required"))
 			return
 		}
 	} else {
-		http.Error(w, "License system unavailable", http.StatusServiceUnavailable)
+		api.WriteError(w, api.NewError(http.StatusServiceUnavailable, "License system unavailable").WithCode(api.CodeLicenseUnavailable))
 		return
 	}
 
@@ -413,6 +458,18 @@ func handleMessages() {
 	}
 }
 
+// closeWebSockets tells the WebSocket clients the server is going away and disconnects them
+func closeWebSockets() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for client := range clients {
+		client.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		client.Close()
+		delete(clients, client)
+	}
+}
+
 func broadcastMessage(msgType, message, command string) {
 	broadcast <- WebSocketMessage{
 		Type:    msgType,
@@ -421,77 +478,120 @@ func broadcastMessage(msgType, message, command string) {
 	}
 }
 
-func handleScrape(w http.ResponseWriter, r *http.Request) {
-	var req CommandRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// Build command arguments
-	args := []string{}
-	if mode := req.Args["mode"]; mode != "" {
-		args = append(args, "--mode="+mode)
-	}
-	if from := req.Args["from"]; from != "" {
-		args = append(args, "--from="+from)
-	}
-	if to := req.Args["to"]; to != "" {
-		args = append(args, "--to="+to)
-	}
-	if headless := req.Args["headless"]; headless != "" {
-		args = append(args, "--headless="+headless)
-	}
+func handleScrape(r *http.Request, req api.CommandRequest) (api.CommandResponse, error) {
+	return runCommand("scrape", req)
+}
 
-	response := executeCommand("./isxcli.exe", args, "scrape")
+func handleProcess(r *http.Request, req api.CommandRequest) (api.CommandResponse, error) {
+	return runCommand("process", req)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+func handleIndexCSV(r *http.Request, req api.CommandRequest) (api.CommandResponse, error) {
+	return runCommand("indexcsv", req)
 }
 
-func handleProcess(w http.ResponseWriter, r *http.Request) {
-	var req CommandRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// runCommand runs the pipeline of a command request
+func runCommand(command string, req api.CommandRequest) (api.CommandResponse, error) {
+	m, err := commandPipeline(command, req.Args)
+	if err != nil {
+		return api.CommandResponse{}, api.Errorf(http.StatusBadRequest, "%v", err)
 	}
+	req.Command = command
+	return runPipeline(context.Background(), req, m).Result()
+}
 
-	args := []string{}
-	if inDir := req.Args["in"]; inDir != "" {
-		args = append(args, "-in="+inDir)
-	}
-	if mode := req.Args["mode"]; mode == "full" {
-		args = append(args, "-full")
+// handlePlan previews a command request: the stages it would run, in order, and the files each
+// would download or parse, without running them
+func handlePlan(r *http.Request, req api.CommandRequest) (*pipeline.Plan, error) {
+	m, err := commandPipeline(req.Command, req.Args)
+	if err != nil {
+		return nil, api.Errorf(http.StatusBadRequest, "%v", err)
 	}
-
-	response := executeCommandWithStreaming("./cmd/process/process.exe", args, "process")
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	addNotification(m)
+	return m.Plan(r.Context())
 }
 
-func handleIndexCSV(w http.ResponseWriter, r *http.Request) {
-	var req CommandRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// commandPipeline returns the pipeline running a scrape, process or indexcsv command with the
+// arguments of its request
+func commandPipeline(command string, args map[string]string) (*pipeline.Manager, error) {
+	switch command {
+	case "scrape":
+		opts, err := scrapeOptions(args)
+		if err != nil {
+			return nil, err
+		}
+		return pipeline.NewManager(&pipeline.ScrapingStage{Options: opts, Retry: pipeline.DefaultScrapeRetry}), nil
+	case "process":
+		return pipeline.NewManager(&pipeline.ProcessingStage{Options: processOptions(args)}), nil
+	case "indexcsv":
+		return pipeline.NewManager(&pipeline.IndicesStage{Options: indexOptions(args)}), nil
 	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
 
-	args := []string{}
-	if mode := req.Args["mode"]; mode != "" {
-		args = append(args, "-mode="+mode)
+// scrapeOptions returns the scraper options of a scrape request, with the defaults of the
+// isxcli command for the arguments it leaves out
+func scrapeOptions(args map[string]string) (scraper.Options, error) {
+	opts := scraper.Options{
+		Mode:         scraper.ModeInitial,
+		OutDir:       "downloads",
+		Headless:     true,
+		Resume:       true,
+		CheckChanged: true,
+		NameTemplate: nameTemplate,
+	}
+	if mode := args["mode"]; mode != "" {
+		opts.Mode = mode
+	}
+	from := args["from"]
+	if from == "" {
+		from = "2025-01-01"
+	}
+	var err error
+	if opts.From, err = time.Parse("2006-01-02", from); err != nil {
+		return opts, fmt.Errorf("invalid from date: %w", err)
 	}
-	if dir := req.Args["dir"]; dir != "" {
-		args = append(args, "-dir="+dir)
+	if to := args["to"]; to != "" {
+		if opts.To, err = time.Parse("2006-01-02", to); err != nil {
+			return opts, fmt.Errorf("invalid to date: %w", err)
+		}
 	}
-	if out := req.Args["out"]; out != "" {
-		args = append(args, "-out="+out)
+	if headless := args["headless"]; headless != "" {
+		if opts.Headless, err = strconv.ParseBool(headless); err != nil {
+			return opts, fmt.Errorf("invalid headless: %w", err)
+		}
 	}
+	return opts, nil
+}
 
-	response := executeCommandWithStreaming("./cmd/indexcsv/indexcsv.exe", args, "indexcsv")
+// processOptions returns the processor options of a process request
+func processOptions(args map[string]string) processor.Options {
+	opts := processor.DefaultOptions()
+	opts.Progress = true
+	if inDir := args["in"]; inDir != "" {
+		opts.InDir = inDir
+	}
+	if mode := args["mode"]; mode == "full" {
+		opts.Full = true
+	}
+	return opts
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// indexOptions returns the index extraction options of an indexcsv request
+func indexOptions(args map[string]string) indices.Options {
+	opts := indices.DefaultOptions()
+	if mode := args["mode"]; mode != "" {
+		opts.Mode = mode
+	}
+	if dir := args["dir"]; dir != "" {
+		opts.Dir = dir
+	}
+	if out := args["out"]; out != "" {
+		opts.Out = out
+	}
+	// The dashboard chart reads indexes.json rather than parsing the CSV
+	opts.Format = "json"
+	return opts
 }
 
 func handleListTickers(w http.ResponseWriter, r *http.Request) {
@@ -500,9 +600,9 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 	// Check if ticker summary exists
 	if _, err := os.Stat(summaryFile); os.IsNotExist(err) {
 		// Only try to generate summary if source data exists
-		if _, err := os.Stat("reports/isx_combined_data.csv"); err == nil {
+		if csvgz.Exists("reports/isx_combined_data.csv") {
 			if genErr := generateTickerSummary(); genErr != nil {
-				http.Error(w, fmt.Sprintf("Ticker summary not available: %v", genErr), http.StatusInternalServerError)
+				api.WriteError(w, api.Errorf(http.StatusInternalServerError, "Ticker summary not available: %v", genErr))
 				return
 			}
 		} else {
@@ -521,7 +621,7 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 	// Read ticker summary CSV
 	file, err := os.Open(summaryFile)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open ticker summary: %v", err), http.StatusInternalServerError)
+		api.WriteError(w, api.Errorf(http.StatusInternalServerError, "Failed to open ticker summary: %v", err))
 		return
 	}
 	defer file.Close()
@@ -529,7 +629,7 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 	reader := csv.NewReader(file)
 	records, err := reader.ReadAll()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to read ticker summary: %v", err), http.StatusInternalServerError)
+		api.WriteError(w, api.Errorf(http.StatusInternalServerError, "Failed to read ticker summary: %v", err))
 		return
 	}
 
@@ -543,6 +643,32 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The 52-week, beta and liquidity columns are found by name: the processor writes CompanyNameAr before them
+	extraCol := make(map[string]int)
+	for i, name := range records[0] {
+		extraCol[name] = i
+	}
+	extra := func(record []string, name string) float64 {
+		i, ok := extraCol[name]
+		if !ok || i >= len(record) {
+			return 0
+		}
+		v, _ := strconv.ParseFloat(record[i], 64)
+		return v
+	}
+
+	optional := func(record []string, name string) *float64 {
+		i, ok := extraCol[name]
+		if !ok || i >= len(record) {
+			return nil
+		}
+		v, err := strconv.ParseFloat(record[i], 64)
+		if err != nil {
+			return nil
+		}
+		return &v
+	}
+
 	// Parse ticker summaries
 	var summaries []TickerSummary
 	for i := 1; i < len(records); i++ {
@@ -564,13 +690,21 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		history := analytics.ParseHistory(records[0], record)
 		summary := TickerSummary{
-			Ticker:      record[0],
-			CompanyName: record[1],
-			LastPrice:   lastPrice,
-			LastDate:    record[3],
-			TradingDays: tradingDays,
-			Last10Days:  last10Days,
+			Ticker:           record[0],
+			CompanyName:      record[1],
+			LastPrice:        lastPrice,
+			LastDate:         record[3],
+			TradingDays:      tradingDays,
+			Last10Days:       last10Days,
+			High52W:          extra(record, "High52W"),
+			Low52W:           extra(record, "Low52W"),
+			PercentOffHigh:   extra(record, "PercentOffHigh"),
+			Beta:             optional(record, "Beta"),
+			RelativeStrength: optional(record, "RelativeStrength"),
+			History:          &history,
+			Liquidity:        analytics.ParseLiquidity(records[0], record),
 		}
 
 		summaries = append(summaries, summary)
@@ -585,34 +719,8 @@ func handleListTickers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func handleGetTicker(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	ticker := vars["ticker"]
-
-	if ticker == "" {
-		http.Error(w, "Ticker parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	// Construct file path - try both formats
-	filePath := filepath.Join("reports", ticker+".csv")
-
-	// Check if direct file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		// Try with _trading_history suffix
-		filePath = filepath.Join("reports", ticker+"_trading_history.csv")
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			http.Error(w, fmt.Sprintf("Ticker file not found: %s", ticker), http.StatusNotFound)
-			return
-		}
-	}
-
-	// Serve the CSV file
-	http.ServeFile(w, r, filePath)
-}
-
 func handleListFiles(w http.ResponseWriter, r *http.Request) {
-	files := make(map[string][]string)
+	files := make(map[string]interface{})
 
 	// List downloads
 	if downloadFiles, err := listDirectory("downloads"); err == nil {
@@ -622,14 +730,25 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 	// List generated files
 	if csvFiles, err := listDirectory("."); err == nil {
 		var filtered []string
+		seen := make(map[string]bool)
 		for _, file := range csvFiles {
-			if strings.HasSuffix(file, ".csv") || strings.HasSuffix(file, ".json") {
+			// Compressed CSVs are listed and downloaded under their plain name
+			file = csvgz.Name(file)
+			if (strings.HasSuffix(file, ".csv") || strings.HasSuffix(file, ".json")) && !seen[file] {
+				seen[file] = true
 				filtered = append(filtered, file)
 			}
 		}
 		files["generated"] = filtered
 	}
 
+	// The run that produced each report, stale when reports were downloaded since
+	if lineage, err := runLineage.Files("downloads"); err == nil {
+		files["lineage"] = lineage
+	} else {
+		log.Printf("Warning: Could not read the lineage of the reports: %v", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(files)
 }
@@ -640,7 +759,7 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 
 	// Security check - prevent directory traversal
 	if strings.Contains(filename, "..") || strings.Contains(filename, "/") || strings.Contains(filename, "\\") {
-		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		api.WriteError(w, api.NewError(http.StatusBadRequest, "Invalid filename"))
 		return
 	}
 
@@ -648,14 +767,20 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	var filePath string
 	if _, err := os.Stat(filepath.Join("downloads", filename)); err == nil {
 		filePath = filepath.Join("downloads", filename)
-	} else if _, err := os.Stat(filename); err == nil {
+	} else if csvgz.Exists(filename) {
 		filePath = filename
 	} else {
-		http.Error(w, "File not found", http.StatusNotFound)
+		api.WriteError(w, api.NewError(http.StatusNotFound, "File not found"))
 		return
 	}
 
 	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	if strings.HasSuffix(filename, ".csv") {
+		if err := csvgz.Serve(w, r, filePath); err != nil {
+			api.WriteError(w, err)
+		}
+		return
+	}
 	http.ServeFile(w, r, filePath)
 }
 
@@ -670,99 +795,132 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-func executeCommand(command string, args []string, commandType string) CommandResponse {
-	broadcastMessage("info", fmt.Sprintf("Starting %s command: %s %s", commandType, command, strings.Join(args, " ")), commandType)
-
-	cmd := exec.Command(command, args...)
-	output, err := cmd.CombinedOutput()
-
-	response := CommandResponse{
-		Success: err == nil,
-		Output:  string(output),
-	}
+// runHistory records every pipeline run for /api/pipeline/runs
+var runHistory = pipeline.NewHistory(filepath.Join("data", "pipeline_runs.jsonl"))
 
-	if err != nil {
-		response.Error = err.Error()
-		broadcastMessage("error", fmt.Sprintf("Command failed: %s", err.Error()), commandType)
-	} else {
-		broadcastMessage("success", fmt.Sprintf("Command completed successfully"), commandType)
-	}
+// runLock keeps pipeline runs from overlapping and writing the same files at once
+var runLock = pipeline.NewRunLock(filepath.Join("data", "pipeline.lock"))
 
-	broadcastMessage("output", string(output), commandType)
+// runLineage records the run producing each file of reports for /api/files
+var runLineage = pipeline.NewLineage(filepath.Join("data", "lineage.json"))
 
-	return response
+// stageCommands are the WebSocket command types of the pipeline stages: the commands they replace
+var stageCommands = map[string]string{
+	pipeline.StageScrape:   "scrape",
+	pipeline.StageProcess:  "process",
+	pipeline.StageIndices:  "indexcsv",
+	pipeline.StageAnalysis: "correlation",
+	pipeline.StageNotify:   "notify",
 }
 
-func executeCommandWithStreaming(command string, args []string, commandType string) CommandResponse {
-	broadcastMessage("info", fmt.Sprintf("Starting %s command: %s %s", commandType, command, strings.Join(args, " ")), commandType)
-
-	cmd := exec.Command(command, args...)
-
-	// Create pipes for stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		response := CommandResponse{
-			Success: false,
-			Error:   err.Error(),
+// runPipeline executes the stages of m, all of them unless named, streaming the log of each over
+// the WebSocket as the output of its command, and records the run of req in runHistory
+func runPipeline(ctx context.Context, req api.CommandRequest, m *pipeline.Manager, stages ...string) api.CommandResponse {
+	m.Lock = runLock
+	addNotification(m)
+	// The manager serializes these calls, also when stages run in parallel
+	writers := make(map[string]*broadcastWriter)
+	m.Output = func(stage string) io.Writer {
+		writers[stage] = &broadcastWriter{commandType: stageCommands[stage]}
+		return writers[stage]
+	}
+	// The overall progress of the run, its stages weighted, drives the pipeline progress bar
+	m.OnProgress = func(p pipeline.Progress) {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return
+		}
+		broadcastMessage("pipeline_progress", string(data), req.Command)
+	}
+	m.OnEvent = func(ev pipeline.Event) {
+		commandType := stageCommands[ev.Stage]
+		switch ev.Status {
+		case pipeline.StatusStarted:
+			broadcastMessage("info", fmt.Sprintf("Starting %s command", commandType), commandType)
+		case pipeline.StatusRetrying:
+			writers[ev.Stage].Flush()
+			broadcastMessage("warning", fmt.Sprintf("Attempt %d failed: %s; retrying in %s", ev.Attempt, ev.Err, ev.Delay), commandType)
+		case pipeline.StatusCompleted:
+			writers[ev.Stage].Flush()
+			broadcastMessage("success", "Command completed successfully", commandType)
+		case pipeline.StatusFailed:
+			writers[ev.Stage].Flush()
+			broadcastMessage("error", fmt.Sprintf("Command failed: %s", ev.Err), commandType)
+		case pipeline.StatusTimedOut:
+			writers[ev.Stage].Flush()
+			broadcastMessage("error", fmt.Sprintf("Command timed out: %s", ev.Err), commandType)
+		case pipeline.StatusSkipped:
+			broadcastMessage("info", fmt.Sprintf("Skipped: %s", ev.Reason), commandType)
+		}
+	}
+	err := m.Execute(ctx, stages...)
+	if errors.Is(err, pipeline.ErrLocked) {
+		broadcastMessage("error", fmt.Sprintf("Command refused: %v", err), req.Command)
+		return api.CommandResponse{Error: err.Error(), Busy: true}
+	}
+	run := pipeline.Run{Command: req.Command, Params: req.Args, Summary: m.Summary()}
+	if id, herr := runHistory.Add(run); herr != nil {
+		log.Printf("Warning: Could not record pipeline run: %v", herr)
+	} else {
+		run.ID = id
+		if lerr := runLineage.Record(run, "reports", m.Outputs()); lerr != nil {
+			log.Printf("Warning: Could not record the lineage of the reports: %v", lerr)
 		}
-		broadcastMessage("error", fmt.Sprintf("Failed to create stdout pipe: %s", err.Error()), commandType)
-		return response
 	}
 
-	stderr, err := cmd.StderrPipe()
+	response := api.CommandResponse{
+		Success: err == nil,
+		Output:  "Command output streamed via WebSocket",
+	}
 	if err != nil {
-		response := CommandResponse{
-			Success: false,
-			Error:   err.Error(),
-		}
-		broadcastMessage("error", fmt.Sprintf("Failed to create stderr pipe: %s", err.Error()), commandType)
-		return response
+		response.Error = err.Error()
 	}
+	return response
+}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		response := CommandResponse{
-			Success: false,
-			Error:   err.Error(),
-		}
-		broadcastMessage("error", fmt.Sprintf("Failed to start command: %s", err.Error()), commandType)
-		return response
+// addNotification adds the notification of the webhooks of ISX_WEBHOOKS to m, once
+func addNotification(m *pipeline.Manager) {
+	if urls := pipeline.WebhooksFromEnv(); len(urls) > 0 && !slices.Contains(m.Stages(), pipeline.StageNotify) {
+		m.Register(&pipeline.NotificationStage{URLs: urls})
 	}
+}
 
-	// Create a goroutine to read and broadcast stdout
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			broadcastMessage("output", line, commandType)
-		}
-	}()
+// broadcastWriter broadcasts every line written to it with broadcastOutputLine
+type broadcastWriter struct {
+	commandType string
+	partial     []byte // the line being written
+}
 
-	// Create a goroutine to read and broadcast stderr
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			broadcastMessage("error", line, commandType)
+func (w *broadcastWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
 		}
-	}()
-
-	// Wait for the command to complete
-	err = cmd.Wait()
+		broadcastOutputLine(strings.TrimRight(string(w.partial[:i]), "\r"), w.commandType)
+		w.partial = w.partial[i+1:]
+	}
+}
 
-	response := CommandResponse{
-		Success: err == nil,
-		Output:  "Command output streamed via WebSocket",
+// Flush broadcasts the last line when it has no newline
+func (w *broadcastWriter) Flush() {
+	if len(w.partial) > 0 {
+		broadcastOutputLine(string(w.partial), w.commandType)
+		w.partial = nil
 	}
+}
 
-	if err != nil {
-		response.Error = err.Error()
-		broadcastMessage("error", fmt.Sprintf("Command failed: %s", err.Error()), commandType)
+// broadcastOutputLine forwards one line of command output. Structured progress lines of the
+// processor are sent as "progress" and "status" messages carrying their JSON payload.
+func broadcastOutputLine(line, commandType string) {
+	if payload, ok := strings.CutPrefix(line, "[WEBSOCKET_PROGRESS] "); ok {
+		broadcastMessage("progress", payload, commandType)
+	} else if payload, ok := strings.CutPrefix(line, "[WEBSOCKET_STATUS] "); ok {
+		broadcastMessage("status", payload, commandType)
 	} else {
-		broadcastMessage("success", fmt.Sprintf("Command completed successfully"), commandType)
+		broadcastMessage("output", line, commandType)
 	}
-
-	return response
 }
 
 func listDirectory(dir string) ([]string, error) {
@@ -790,9 +948,9 @@ func getActualLastTradingDate(ticker string) (string, float64) {
 	}
 
 	for _, filePath := range possibleFiles {
-		if _, err := os.Stat(filePath); err == nil {
+		if csvgz.Exists(filePath) {
 			// File exists, read it
-			file, err := os.Open(filePath)
+			file, err := csvgz.Open(filePath)
 			if err != nil {
 				continue
 			}
@@ -835,9 +993,9 @@ func getActualLast10TradingDays(ticker string) []float64 {
 	}
 
 	for _, filePath := range possibleFiles {
-		if _, err := os.Stat(filePath); err == nil {
+		if csvgz.Exists(filePath) {
 			// File exists, read it
-			file, err := os.Open(filePath)
+			file, err := csvgz.Open(filePath)
 			if err != nil {
 				continue
 			}
@@ -881,18 +1039,110 @@ func getActualLast10TradingDays(ticker string) []float64 {
 	return []float64{}
 }
 
+// yearRange returns the 52-week closing range of a ticker's rows, sorted by date, and how far
+// its last close is below the high
+func yearRange(data []map[string]string) (high, low, percentOffHigh float64) {
+	var bars []analytics.Bar
+	for _, row := range data {
+		date, err := time.Parse("2006-01-02", row["date"])
+		if err != nil {
+			continue
+		}
+		price, _ := strconv.ParseFloat(row["close_price"], 64)
+		bars = append(bars, analytics.Bar{Date: date, Close: price})
+	}
+	return analytics.YearRange(bars)
+}
+
+// historyDays returns the trading days of the summaries' recent history: ISX_HISTORY_DAYS, or
+// analytics.DefaultHistoryDays when unset or invalid
+func historyDays() int {
+	if days, err := strconv.Atoi(os.Getenv("ISX_HISTORY_DAYS")); err == nil && days > 0 {
+		return days
+	}
+	return analytics.DefaultHistoryDays
+}
+
+// optionalValue returns v, or nil when NaN
+func optionalValue(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// formatOptional formats v as a CSV cell, empty when nil
+func formatOptional(v *float64, decimals int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', decimals, 64)
+}
+
+// tickerSeries returns the rows of every ticker, sorted by date, as series
+func tickerSeries(tickerData map[string][]map[string]string) map[string]*analytics.TickerSeries {
+	series := make(map[string]*analytics.TickerSeries)
+	for ticker, data := range tickerData {
+		s := &analytics.TickerSeries{Ticker: ticker}
+		for _, row := range data {
+			date, err := time.Parse("2006-01-02", row["date"])
+			if err != nil {
+				continue
+			}
+			bar := analytics.Bar{Date: date, Traded: row["traded"] != "false"}
+			bar.Close, _ = strconv.ParseFloat(row["close_price"], 64)
+			bar.Volume, _ = strconv.ParseInt(row["volume"], 10, 64)
+			bar.Value, _ = strconv.ParseFloat(row["value"], 64)
+			bar.Shares, _ = strconv.ParseFloat(row["shares"], 64)
+			s.Bars = append(s.Bars, bar)
+		}
+		sort.Slice(s.Bars, func(i, j int) bool { return s.Bars[i].Date.Before(s.Bars[j].Date) })
+		series[ticker] = s
+	}
+	return series
+}
+
+// liquidity returns the liquidity metrics of every ticker over the market sessions of all of them
+func liquidity(series map[string]*analytics.TickerSeries) map[string][]analytics.Liquidity {
+	calendar := analytics.MarketCalendar(series)
+	byTicker := make(map[string][]analytics.Liquidity)
+	for ticker, s := range series {
+		for _, window := range analytics.DefaultLiquidityWindows {
+			byTicker[ticker] = append(byTicker[ticker], analytics.ComputeLiquidity(s.Bars, calendar, window))
+		}
+	}
+	return byTicker
+}
+
+// relativeToIndex returns the beta and relative strength of every ticker against ISX60 after its
+// last trade, none when indexes.csv can't be read
+func relativeToIndex(series map[string]*analytics.TickerSeries) map[string]analytics.BetaPoint {
+	byTicker := make(map[string]analytics.BetaPoint)
+	indices, err := analytics.LoadIndexSeries(filepath.Join("reports", "indexes.csv"))
+	if err != nil || indices[analytics.BetaIndex] == nil {
+		return byTicker
+	}
+	for ticker, s := range series {
+		points := analytics.RelativeToIndex(s.Bars, indices[analytics.BetaIndex].Bars, analytics.DefaultBetaWindow)
+		if len(points) > 0 {
+			byTicker[ticker] = points[len(points)-1]
+		}
+	}
+	return byTicker
+}
+
 // generateTickerSummary creates a ticker summary CSV from the combined CSV file
 func generateTickerSummary() error {
 	combinedFile := "reports/isx_combined_data.csv"
 	summaryFile := "reports/ticker_summary.csv"
 
 	// Check if combined file exists
-	if _, err := os.Stat(combinedFile); os.IsNotExist(err) {
+	if !csvgz.Exists(combinedFile) {
 		return fmt.Errorf("combined CSV file not found: %s", combinedFile)
 	}
 
 	// Read combined CSV
-	file, err := os.Open(combinedFile)
+	file, err := csvgz.Open(combinedFile)
 	if err != nil {
 		return fmt.Errorf("failed to open combined file: %v", err)
 	}
@@ -914,6 +1164,8 @@ func generateTickerSummary() error {
 	companyCol := -1
 	dateCol := -1
 	closeCol := -1
+	// Optional columns of the liquidity metrics
+	extraCols := make(map[string]int)
 
 	for i, col := range header {
 		switch strings.ToLower(col) {
@@ -925,6 +1177,12 @@ func generateTickerSummary() error {
 			dateCol = i
 		case "close_price", "closeprice", "close":
 			closeCol = i
+		case "volume", "value":
+			extraCols[strings.ToLower(col)] = i
+		case "shares_outstanding", "sharesoutstanding":
+			extraCols["shares"] = i
+		case "trading_status", "tradingstatus":
+			extraCols["traded"] = i
 		}
 	}
 
@@ -952,10 +1210,19 @@ func generateTickerSummary() error {
 			"date":         strings.TrimSpace(record[dateCol]),
 			"close_price":  strings.TrimSpace(record[closeCol]),
 		}
+		for key, col := range extraCols {
+			if col < len(record) {
+				rowData[key] = strings.TrimSpace(record[col])
+			}
+		}
 
 		tickerData[ticker] = append(tickerData[ticker], rowData)
 	}
 
+	series := tickerSeries(tickerData)
+	liquidityByTicker := liquidity(series)
+	relativeByTicker := relativeToIndex(series)
+
 	// Create ticker summaries with actual last trading dates from individual files
 	var summaries []TickerSummary
 
@@ -997,13 +1264,24 @@ func generateTickerSummary() error {
 			}
 		}
 
+		high52W, low52W, percentOffHigh := yearRange(data)
 		summary := TickerSummary{
-			Ticker:      ticker,
-			CompanyName: lastRecord["company_name"],
-			LastPrice:   lastPrice,
-			LastDate:    lastRecord["date"],
-			TradingDays: len(data),
-			Last10Days:  last10Days,
+			Ticker:         ticker,
+			CompanyName:    lastRecord["company_name"],
+			LastPrice:      lastPrice,
+			LastDate:       lastRecord["date"],
+			TradingDays:    len(data),
+			Last10Days:     last10Days,
+			High52W:        high52W,
+			Low52W:         low52W,
+			PercentOffHigh: percentOffHigh,
+			Liquidity:      liquidityByTicker[ticker],
+		}
+		history := analytics.RecentHistory(series[ticker].Bars, historyDays())
+		summary.History = &history
+		if relative, ok := relativeByTicker[ticker]; ok {
+			summary.Beta = optionalValue(relative.Beta)
+			summary.RelativeStrength = optionalValue(relative.RelativeStrength)
 		}
 
 		summaries = append(summaries, summary)
@@ -1025,7 +1303,12 @@ func generateTickerSummary() error {
 	defer writer.Flush()
 
 	// Write header
-	writer.Write([]string{"Ticker", "CompanyName", "LastPrice", "LastDate", "TradingDays", "Last10Days"})
+	columns := []string{"Ticker", "CompanyName", "LastPrice", "LastDate", "TradingDays", "Last10Days", "High52W", "Low52W", "PercentOffHigh", "Beta", "RelativeStrength"}
+	columns = append(columns, analytics.HistoryColumns()...)
+	for _, window := range analytics.DefaultLiquidityWindows {
+		columns = append(columns, analytics.LiquidityNames(window)...)
+	}
+	writer.Write(columns)
 
 	// Write data
 	for _, summary := range summaries {
@@ -1037,14 +1320,28 @@ func generateTickerSummary() error {
 			last10DaysStr += fmt.Sprintf("%.3f", price)
 		}
 
-		writer.Write([]string{
+		row := []string{
 			summary.Ticker,
 			summary.CompanyName,
 			fmt.Sprintf("%.3f", summary.LastPrice),
 			summary.LastDate,
 			fmt.Sprintf("%d", summary.TradingDays),
 			last10DaysStr,
-		})
+			fmt.Sprintf("%.3f", summary.High52W),
+			fmt.Sprintf("%.3f", summary.Low52W),
+			fmt.Sprintf("%.2f", summary.PercentOffHigh),
+			formatOptional(summary.Beta, 4),
+			formatOptional(summary.RelativeStrength, 2),
+		}
+		if summary.History != nil {
+			row = append(row, summary.History.Cells()...)
+		} else {
+			row = append(row, make([]string, len(analytics.HistoryColumns()))...)
+		}
+		for _, l := range summary.Liquidity {
+			row = append(row, l.Cells()...)
+		}
+		writer.Write(row)
 	}
 
 	log.Printf("Generated ticker summary with %d tickers", len(summaries))
@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Analyzer is a custom metric computed from the combined data after processing. Its outputs are
+// written next to the built-in files and listed in analyzers.json, which the web API serves, so
+// new metrics need no change to the processor or the web server.
+type Analyzer interface {
+	// Name identifies the analyzer in file names and the API: lowercase letters, digits and
+	// underscores
+	Name() string
+	// Compute derives the analyzer's tables from the priced series of every ticker
+	Compute(series map[string]*TickerSeries) ([]Output, error)
+}
+
+// Output is one table of an Analyzer, written to <analyzer>_<name>.csv
+type Output struct {
+	Name string     // lowercase letters, digits and underscores
+	Rows [][]string // header first
+}
+
+// AnalyzerResult lists the files an analyzer wrote in analyzers.json
+type AnalyzerResult struct {
+	Analyzer string         `json:"analyzer"`
+	Outputs  []OutputResult `json:"outputs"`
+}
+
+// OutputResult is one written Output
+type OutputResult struct {
+	Name string `json:"name"`
+	File string `json:"file"` // base name in the analyzers directory
+	Rows int    `json:"rows"` // data rows, without the header
+}
+
+// AnalyzersManifest is the file in the analyzers directory listing what the last run wrote
+const AnalyzersManifest = "analyzers.json"
+
+var analyzerName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Analyzer)
+)
+
+// Register adds an analyzer to those NewSummaryGenerator runs, usually from the init function of
+// the package defining it. It panics when the name is invalid or already registered.
+func Register(a Analyzer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name := a.Name()
+	if !analyzerName.MatchString(name) {
+		panic(fmt.Sprintf("analytics: invalid analyzer name %q", name))
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("analytics: analyzer %q registered twice", name))
+	}
+	registry[name] = a
+}
+
+// Analyzers returns the registered analyzers sorted by name
+func Analyzers() []Analyzer {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	analyzers := make([]Analyzer, 0, len(registry))
+	for _, a := range registry {
+		analyzers = append(analyzers, a)
+	}
+	sort.Slice(analyzers, func(i, j int) bool { return analyzers[i].Name() < analyzers[j].Name() })
+	return analyzers
+}
+
+// runAnalyzers computes every analyzer over series, writing their outputs and the manifest to dir
+func runAnalyzers(analyzers []Analyzer, series map[string]*TickerSeries, dir string) error {
+	results := []AnalyzerResult{}
+	for _, a := range analyzers {
+		outputs, err := a.Compute(series)
+		if err != nil {
+			return fmt.Errorf("analyzer %s: %w", a.Name(), err)
+		}
+		result := AnalyzerResult{Analyzer: a.Name(), Outputs: []OutputResult{}}
+		for _, out := range outputs {
+			if !analyzerName.MatchString(out.Name) {
+				return fmt.Errorf("analyzer %s: invalid output name %q", a.Name(), out.Name)
+			}
+			file := a.Name() + "_" + out.Name + ".csv"
+			if err := writeCSV(filepath.Join(dir, file), out.Rows); err != nil {
+				return fmt.Errorf("analyzer %s: %w", a.Name(), err)
+			}
+			result.Outputs = append(result.Outputs, OutputResult{Name: out.Name, File: file, Rows: max(len(out.Rows)-1, 0)})
+		}
+		results = append(results, result)
+	}
+	return writeFile(filepath.Join(dir, AnalyzersManifest), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	})
+}
+
+// LoadAnalyzerResults reads the analyzers.json of dir
+func LoadAnalyzerResults(dir string) ([]AnalyzerResult, error) {
+	data, err := os.ReadFile(filepath.Join(dir, AnalyzersManifest))
+	if err != nil {
+		return nil, err
+	}
+	var results []AnalyzerResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("read %s: %w", AnalyzersManifest, err)
+	}
+	return results, nil
+}
+
+// LoadOutput reads the output of an analyzer listed in the analyzers.json of dir as one map per
+// row keyed by the header. It returns os.ErrNotExist when the manifest doesn't list it.
+func LoadOutput(dir, analyzer, output string) ([]map[string]string, error) {
+	results, err := LoadAnalyzerResults(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.Analyzer != analyzer {
+			continue
+		}
+		for _, out := range result.Outputs {
+			if out.Name == output {
+				return loadTable(filepath.Join(dir, out.File))
+			}
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// loadTable reads a CSV file as one map per row keyed by the header
+func loadTable(path string) ([]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	table := []map[string]string{}
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		record := make(map[string]string, len(rows[0]))
+		for j, name := range rows[0] {
+			if j < len(row) {
+				record[name] = row[j]
+			}
+		}
+		table = append(table, record)
+	}
+	return table, nil
+}
@@ -0,0 +1,73 @@
+package analytics
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tradeCount is an analyzer counting the traded bars of every ticker
+type tradeCount struct{}
+
+func (tradeCount) Name() string { return "trade_count" }
+
+func (tradeCount) Compute(series map[string]*TickerSeries) ([]Output, error) {
+	rows := [][]string{{"Ticker", "Trades"}}
+	for _, ticker := range []string{"BBOB", "IBSD"} {
+		trades := 0
+		for _, b := range series[ticker].Bars {
+			if b.Traded {
+				trades++
+			}
+		}
+		rows = append(rows, []string{ticker, strconv.Itoa(trades)})
+	}
+	return []Output{{Name: "by_ticker", Rows: rows}}, nil
+}
+
+// TestAnalyzers registers an analyzer, runs it and reads its output back through the manifest
+func TestAnalyzers(t *testing.T) {
+	Register(tradeCount{})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "trade_count")
+		registryMu.Unlock()
+	}()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("registering a name twice doesn't panic")
+			}
+		}()
+		Register(tradeCount{})
+	}()
+
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	series := map[string]*TickerSeries{
+		"BBOB": {Ticker: "BBOB", Bars: []Bar{{Date: day, Close: 1, Traded: true}, {Date: day.AddDate(0, 0, 1), Close: 1}}},
+		"IBSD": {Ticker: "IBSD", Bars: []Bar{{Date: day, Close: 2, Traded: true}}},
+	}
+	dir := t.TempDir()
+	if err := runAnalyzers(Analyzers(), series, dir); err != nil {
+		t.Fatal(err)
+	}
+	results, err := LoadAnalyzerResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Outputs[0].File != "trade_count_by_ticker.csv" || results[0].Outputs[0].Rows != 2 {
+		t.Errorf("manifest: %+v", results)
+	}
+	table, err := LoadOutput(dir, "trade_count", "by_ticker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 2 || table[0]["Ticker"] != "BBOB" || table[0]["Trades"] != "1" {
+		t.Errorf("output: %v", table)
+	}
+	if _, err := LoadOutput(dir, "trade_count", "missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing output: %v", err)
+	}
+}
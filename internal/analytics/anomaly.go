@@ -0,0 +1,168 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Anomaly checks
+const (
+	AnomalyReturnZScore = "return_zscore"     // a return far outside the ticker's recent ones
+	AnomalyOHLC         = "ohlc_inconsistent" // open, high, low and close contradict each other
+	AnomalyStalePrice   = "stale_price"       // a volume traded at a price copied from earlier
+)
+
+// AnomalyOptions tune the return z-score check
+type AnomalyOptions struct {
+	Window     int     // previous returns the mean and standard deviation cover
+	MinReturns int     // returns needed in the window before a z-score is computed
+	ZScore     float64 // absolute z-score flagged; 0 disables the check
+}
+
+// DefaultAnomalyOptions flag returns four standard deviations from the mean of the last 60
+var DefaultAnomalyOptions = AnomalyOptions{Window: 60, MinReturns: 20, ZScore: 4}
+
+// Anomaly is one improbable bar of a ticker, likely an error in the source report
+type Anomaly struct {
+	Date   time.Time
+	Ticker string
+	Check  string
+	Value  float64 // the z-score of a return check, NaN otherwise
+	Detail string
+}
+
+// MarshalJSON encodes the anomaly with snake_case names, the date as YYYY-MM-DD and a NaN value
+// as null
+func (a Anomaly) MarshalJSON() ([]byte, error) {
+	var value *float64
+	if !math.IsNaN(a.Value) {
+		value = &a.Value
+	}
+	return json.Marshal(struct {
+		Date   string   `json:"date"`
+		Ticker string   `json:"ticker"`
+		Check  string   `json:"check"`
+		Value  *float64 `json:"value"`
+		Detail string   `json:"detail"`
+	}{formatDate(a.Date), a.Ticker, a.Check, value, a.Detail})
+}
+
+// anomalyHeader is the header of anomalies.csv
+var anomalyHeader = []string{"Date", "Ticker", "Check", "Value", "Detail"}
+
+// DetectAnomalies returns the anomalies of a series in date order. Returns run between traded
+// bars; forward-filled bars only count when they carry a volume.
+func DetectAnomalies(s *TickerSeries, opts AnomalyOptions) []Anomaly {
+	var anomalies []Anomaly
+	flag := func(b Bar, check string, value float64, format string, args ...interface{}) {
+		anomalies = append(anomalies, Anomaly{Date: b.Date, Ticker: s.Ticker, Check: check, Value: value, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	var returns []float64
+	var prev *Bar
+	for i := range s.Bars {
+		b := s.Bars[i]
+		if !b.Traded {
+			if b.Volume > 0 {
+				flag(b, AnomalyStalePrice, math.NaN(), "volume %d on a day without trades", b.Volume)
+			}
+			continue
+		}
+
+		// Zero prices are ones the report left empty
+		if b.High > 0 && b.Low > 0 {
+			if b.High < b.Low {
+				flag(b, AnomalyOHLC, math.NaN(), "high %.3f < low %.3f", b.High, b.Low)
+			} else if b.Close > 0 && (b.Close < b.Low || b.Close > b.High) {
+				flag(b, AnomalyOHLC, math.NaN(), "close %.3f outside [%.3f, %.3f]", b.Close, b.Low, b.High)
+			} else if b.Open > 0 && (b.Open < b.Low || b.Open > b.High) {
+				flag(b, AnomalyOHLC, math.NaN(), "open %.3f outside [%.3f, %.3f]", b.Open, b.Low, b.High)
+			}
+		}
+
+		if prev != nil && b.Volume > 0 && b.Open == prev.Open && b.High == prev.High && b.Low == prev.Low &&
+			b.Close == prev.Close && b.Volume == prev.Volume && b.Value == prev.Value {
+			flag(b, AnomalyStalePrice, math.NaN(), "prices, volume and value repeat the trade of %s", prev.Date.Format("2006-01-02"))
+		}
+
+		if prev != nil && prev.Close > 0 && b.Close > 0 {
+			r := (b.Close/prev.Close - 1) * 100
+			window := returns[max(len(returns)-opts.Window, 0):]
+			if opts.ZScore > 0 && len(window) >= max(opts.MinReturns, 2) {
+				mean, sd := meanStdDev(window)
+				if sd > 0 {
+					if z := (r - mean) / sd; math.Abs(z) >= opts.ZScore {
+						flag(b, AnomalyReturnZScore, z, "return %+.2f%% since %s against a mean of %+.2f%% and deviation of %.2f%%",
+							r, prev.Date.Format("2006-01-02"), mean, sd)
+					}
+				}
+			}
+			returns = append(returns, r)
+		}
+		prev = &s.Bars[i]
+	}
+	return anomalies
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (mean, sd float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sd += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(values)))
+}
+
+// anomalyRows formats anomalies.csv sorted by date then ticker
+func anomalyRows(anomalies []Anomaly) [][]string {
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		if !anomalies[i].Date.Equal(anomalies[j].Date) {
+			return anomalies[i].Date.Before(anomalies[j].Date)
+		}
+		return anomalies[i].Ticker < anomalies[j].Ticker
+	})
+	rows := [][]string{anomalyHeader}
+	for _, a := range anomalies {
+		rows = append(rows, []string{a.Date.Format("2006-01-02"), a.Ticker, a.Check, FormatValue(a.Value, 2), a.Detail})
+	}
+	return rows
+}
+
+// LoadAnomalies reads anomalies.csv back. Empty values are NaN.
+func LoadAnomalies(path string) ([]Anomaly, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var anomalies []Anomaly
+	for i, row := range rows {
+		if i == 0 || len(row) < len(anomalyHeader) {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			continue
+		}
+		a := Anomaly{Date: date, Ticker: row[1], Check: row[2], Value: math.NaN(), Detail: row[4]}
+		if row[3] != "" {
+			a.Value, _ = strconv.ParseFloat(row[3], 64)
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, nil
+}
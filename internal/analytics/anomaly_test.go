@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDetectAnomalies flags a return jump, an inconsistent bar and repeated trades, and reads
+// anomalies.csv back
+func TestDetectAnomalies(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	var bars []Bar
+	for i := 0; i < 30; i++ {
+		// Closes alternate by about 1%
+		c := 10 + 0.1*float64(i%2)
+		bars = append(bars, Bar{Date: day.AddDate(0, 0, i), Open: c, High: c, Low: c, Close: c, Volume: int64(100 + i), Traded: true})
+	}
+	jump := bars[29]
+	jump.Date, jump.Close, jump.High, jump.Volume = day.AddDate(0, 0, 30), 20, 20, 500
+	bad := Bar{Date: day.AddDate(0, 0, 31), Open: 20, High: 19, Low: 21, Close: 20, Volume: 10, Value: 200, Traded: true}
+	repeat := bad
+	repeat.Date = day.AddDate(0, 0, 32)
+	filled := Bar{Date: day.AddDate(0, 0, 33), Close: 20, Volume: 5}
+	bars = append(bars, jump, bad, repeat, filled)
+
+	anomalies := DetectAnomalies(&TickerSeries{Ticker: "BBOB", Bars: bars}, DefaultAnomalyOptions)
+	checks := make(map[string][]Anomaly)
+	for _, a := range anomalies {
+		checks[a.Check] = append(checks[a.Check], a)
+	}
+	if z := checks[AnomalyReturnZScore]; len(z) != 1 || !z[0].Date.Equal(jump.Date) || z[0].Value < 4 {
+		t.Errorf("z-score: %+v", z)
+	}
+	if ohlc := checks[AnomalyOHLC]; len(ohlc) != 2 || !ohlc[0].Date.Equal(bad.Date) {
+		t.Errorf("OHLC: %+v", ohlc)
+	}
+	if stale := checks[AnomalyStalePrice]; len(stale) != 2 || !stale[0].Date.Equal(repeat.Date) || !stale[1].Date.Equal(filled.Date) {
+		t.Errorf("stale prices: %+v", stale)
+	}
+
+	path := filepath.Join(t.TempDir(), "anomalies.csv")
+	if err := writeCSV(path, anomalyRows(anomalies)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadAnomalies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(anomalies) || !math.IsNaN(loaded[1].Value) || loaded[0].Check != AnomalyReturnZScore {
+		t.Errorf("loaded: %+v", loaded)
+	}
+}
@@ -0,0 +1,139 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultBetaWindow is the number of trades the rolling beta and relative strength cover
+const DefaultBetaWindow = 60
+
+// BetaIndex is the index of indexes.csv tickers are measured against
+const BetaIndex = "ISX60"
+
+// BetaNames are the columns of the beta metrics, in the order of BetaPoint.Values
+var BetaNames = []string{"Beta", "RelativeStrength"}
+
+// BetaPoint holds the beta and relative strength of a ticker against an index after one trade.
+// Both are NaN until enough returns are paired with the index.
+type BetaPoint struct {
+	Date time.Time
+	Beta float64
+	// RelativeStrength is the ticker's compounded return over the window against the index's
+	// over the same days: 100 kept pace, above 100 outperformed
+	RelativeStrength float64
+}
+
+// Values returns the metrics in the order of BetaNames
+func (p BetaPoint) Values() []float64 {
+	return []float64{p.Beta, p.RelativeStrength}
+}
+
+// RelativeToIndex returns the rolling beta and relative strength of every trade of bars against
+// index over the last window trades, both in date order. Each return of the ticker, against its
+// previous trade, is paired with the index's return over the same days, so thinly traded tickers
+// are compared like for like; trades after the last index value are left unpaired.
+func RelativeToIndex(bars, index []Bar, window int) []BetaPoint {
+	state := relativeState{index: newIndexLevels(index), window: window}
+	var points []BetaPoint
+	for _, b := range bars {
+		if state.add(b) {
+			points = append(points, state.point(b.Date))
+		}
+	}
+	return points
+}
+
+// indexLevels are the closes of an index in date order
+type indexLevels struct {
+	dates  []time.Time
+	levels []float64
+}
+
+// newIndexLevels returns the levels of the index bars with a close
+func newIndexLevels(index []Bar) *indexLevels {
+	l := &indexLevels{}
+	for _, b := range index {
+		if b.Close > 0 {
+			l.dates, l.levels = append(l.dates, b.Date), append(l.levels, b.Close)
+		}
+	}
+	return l
+}
+
+// on returns the last level on or before t, 0 before the first or after the last
+func (l *indexLevels) on(t time.Time) float64 {
+	i := sort.Search(len(l.dates), func(i int) bool { return l.dates[i].After(t) }) - 1
+	if i < 0 || len(l.dates) == 0 || t.After(l.dates[len(l.dates)-1]) {
+		return 0
+	}
+	return l.levels[i]
+}
+
+// relativeState pairs the trades of a ticker with an index a bar at a time, holding the paired
+// returns of the last window trades
+type relativeState struct {
+	index                       *indexLevels
+	window                      int
+	prev                        Bar // last trade
+	tickerReturns, indexReturns []float64
+}
+
+// add takes the next bar in date order and reports whether it is a trade
+func (st *relativeState) add(b Bar) bool {
+	if !b.Traded || b.Close <= 0 {
+		return false
+	}
+	if st.prev.Close > 0 {
+		from, to := st.index.on(st.prev.Date), st.index.on(b.Date)
+		if from > 0 && to > 0 {
+			st.tickerReturns = append(st.tickerReturns, b.Close/st.prev.Close-1)
+			st.indexReturns = append(st.indexReturns, to/from-1)
+			if n := len(st.tickerReturns) - max(st.window, 0); n > 0 {
+				st.tickerReturns, st.indexReturns = st.tickerReturns[n:], st.indexReturns[n:]
+			}
+		}
+	}
+	st.prev = b
+	return true
+}
+
+// point returns the beta and relative strength of the returns held, dated date
+func (st *relativeState) point(date time.Time) BetaPoint {
+	p := BetaPoint{Date: date, Beta: math.NaN(), RelativeStrength: math.NaN()}
+	if x, y := st.tickerReturns, st.indexReturns; st.window > 0 && len(x) >= minSharedReturns {
+		p.Beta = beta(x, y)
+		p.RelativeStrength = compound(x) / compound(y) * 100
+	}
+	return p
+}
+
+// beta returns the covariance of x with y over the variance of y, NaN when y does not vary
+func beta(x, y []float64) float64 {
+	n := float64(len(x))
+	var sumX, sumY float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varY float64
+	for i := range x {
+		cov += (x[i] - meanX) * (y[i] - meanY)
+		varY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	if varY == 0 {
+		return math.NaN()
+	}
+	return cov / varY
+}
+
+// compound returns the growth of 1 over the returns
+func compound(returns []float64) float64 {
+	growth := 1.0
+	for _, r := range returns {
+		growth *= 1 + r
+	}
+	return growth
+}
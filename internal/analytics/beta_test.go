@@ -0,0 +1,39 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestRelativeToIndex pairs every return of a ticker with the index over the same days, skipping
+// forward-filled bars and trades after the last index value
+func TestRelativeToIndex(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	var index []Bar
+	for i, level := range []float64{100, 110, 99, 108.9, 98.01} {
+		index = append(index, Bar{Date: day.AddDate(0, 0, i), Close: level})
+	}
+	bar := func(offset int, close float64, traded bool) Bar {
+		return Bar{Date: day.AddDate(0, 0, offset), Close: close, Traded: traded}
+	}
+	// Moves twice as far as the index, also when it skips a day: its return from day 2 to 4 pairs
+	// with the index's over the same days
+	bars := []Bar{bar(0, 10, true), bar(1, 12, true), bar(2, 9.6, true), bar(3, 9.6, false), bar(4, 9.408, true), bar(5, 10, true)}
+
+	points := RelativeToIndex(bars, index, 3)
+	if len(points) != 5 {
+		t.Fatalf("points: %+v", points)
+	}
+	if !math.IsNaN(points[1].Beta) || !math.IsNaN(points[2].Beta) {
+		t.Errorf("beta before three returns: %+v", points[:3])
+	}
+	// Returns of +20%, -20% and -2% against +10%, -10% and -1%
+	if p := points[3]; !near(p.Beta, 2) || !near(p.RelativeStrength, (1.2*0.8*0.98)/(1.1*0.9*0.99)*100) {
+		t.Errorf("after day 4: %+v", p)
+	}
+	// The last trade is after the index ends and keeps the previous window
+	if p := points[4]; p.Beta != points[3].Beta || p.RelativeStrength != points[3].RelativeStrength {
+		t.Errorf("unpaired trade: %+v", p)
+	}
+}
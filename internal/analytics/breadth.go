@@ -0,0 +1,141 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BreadthDay counts how the traded tickers moved in one session
+type BreadthDay struct {
+	Date      string `json:"date"`      // YYYY-MM-DD
+	Advancers int    `json:"advancers"` // closed above their previous traded close
+	Decliners int    `json:"decliners"`
+	Unchanged int    `json:"unchanged"`
+	NewHighs  int    `json:"new_highs"` // closed above every close of the previous 52 weeks
+	NewLows   int    `json:"new_lows"`
+	ADLine    int    `json:"ad_line"` // advancers minus decliners, accumulated since the first session
+}
+
+// breadthHeader is the header of market_breadth.csv
+var breadthHeader = []string{"Date", "Advancers", "Decliners", "Unchanged", "NewHighs", "NewLows", "ADLine"}
+
+// MarketBreadth returns the breadth of every session of series in date order. Only traded bars
+// count, each against the ticker's previous traded close; a ticker's first trade moves nothing.
+func MarketBreadth(series map[string]*TickerSeries) []BreadthDay {
+	byDate := make(map[time.Time]*BreadthDay)
+	for _, s := range series {
+		var traded []Bar
+		for _, b := range s.Bars {
+			if b.Traded && b.Close > 0 {
+				traded = append(traded, b)
+			}
+		}
+
+		// maxQ and minQ hold the indices of the closes of the trailing 52 weeks whose close could
+		// still be the high or low, in date order
+		var maxQ, minQ []int
+		for i, b := range traded {
+			from := b.Date.AddDate(0, 0, -52*7)
+			for len(maxQ) > 0 && !traded[maxQ[0]].Date.After(from) {
+				maxQ = maxQ[1:]
+			}
+			for len(minQ) > 0 && !traded[minQ[0]].Date.After(from) {
+				minQ = minQ[1:]
+			}
+
+			day, ok := byDate[b.Date]
+			if !ok {
+				day = &BreadthDay{Date: b.Date.Format("2006-01-02")}
+				byDate[b.Date] = day
+			}
+			if i > 0 {
+				switch prev := traded[i-1].Close; {
+				case b.Close > prev:
+					day.Advancers++
+				case b.Close < prev:
+					day.Decliners++
+				default:
+					day.Unchanged++
+				}
+			}
+			if len(maxQ) > 0 && b.Close > traded[maxQ[0]].Close {
+				day.NewHighs++
+			}
+			if len(minQ) > 0 && b.Close < traded[minQ[0]].Close {
+				day.NewLows++
+			}
+
+			for len(maxQ) > 0 && traded[maxQ[len(maxQ)-1]].Close <= b.Close {
+				maxQ = maxQ[:len(maxQ)-1]
+			}
+			maxQ = append(maxQ, i)
+			for len(minQ) > 0 && traded[minQ[len(minQ)-1]].Close >= b.Close {
+				minQ = minQ[:len(minQ)-1]
+			}
+			minQ = append(minQ, i)
+		}
+	}
+
+	days := make([]BreadthDay, 0, len(byDate))
+	for _, day := range byDate {
+		days = append(days, *day)
+	}
+	// The dates sort as strings
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	line := 0
+	for i := range days {
+		line += days[i].Advancers - days[i].Decliners
+		days[i].ADLine = line
+	}
+	return days
+}
+
+// breadthRows formats market_breadth.csv
+func breadthRows(days []BreadthDay) [][]string {
+	rows := [][]string{breadthHeader}
+	for _, d := range days {
+		rows = append(rows, []string{
+			d.Date,
+			strconv.Itoa(d.Advancers),
+			strconv.Itoa(d.Decliners),
+			strconv.Itoa(d.Unchanged),
+			strconv.Itoa(d.NewHighs),
+			strconv.Itoa(d.NewLows),
+			strconv.Itoa(d.ADLine),
+		})
+	}
+	return rows
+}
+
+// LoadBreadth reads market_breadth.csv back
+func LoadBreadth(path string) ([]BreadthDay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	days := []BreadthDay{}
+	for i, row := range rows {
+		if i == 0 || len(row) < len(breadthHeader) {
+			continue
+		}
+		d := BreadthDay{Date: row[0]}
+		d.Advancers, _ = strconv.Atoi(row[1])
+		d.Decliners, _ = strconv.Atoi(row[2])
+		d.Unchanged, _ = strconv.Atoi(row[3])
+		d.NewHighs, _ = strconv.Atoi(row[4])
+		d.NewLows, _ = strconv.Atoi(row[5])
+		d.ADLine, _ = strconv.Atoi(row[6])
+		days = append(days, d)
+	}
+	return days, nil
+}
@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMarketBreadth compares each trade with the ticker's previous trade and its 52-week range,
+// accumulates the advance-decline line and round-trips market_breadth.csv
+func TestMarketBreadth(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	bar := func(offset int, close float64, traded bool) Bar {
+		return Bar{Date: day.AddDate(0, 0, offset), Close: close, Traded: traded}
+	}
+	series := map[string]*TickerSeries{
+		"BBOB": {Ticker: "BBOB", Bars: []Bar{bar(0, 10, true), bar(1, 11, true), bar(2, 11, false), bar(3, 9, true)}},
+		"IBSD": {Ticker: "IBSD", Bars: []Bar{bar(0, 5, true), bar(1, 4, true), bar(3, 4, true)}},
+		// The close of over a year ago is out of the window, so the next trade is no new low
+		"TASC": {Ticker: "TASC", Bars: []Bar{bar(-400, 20, true), bar(1, 8, true), bar(3, 9, true)}},
+	}
+
+	days := MarketBreadth(series)
+	if len(days) != 4 {
+		t.Fatalf("days: %+v", days)
+	}
+	want := []BreadthDay{
+		{Date: "2024-01-26"},
+		{Date: "2025-03-01"},
+		{Date: "2025-03-02", Advancers: 1, Decliners: 2, NewHighs: 1, NewLows: 1, ADLine: -1},
+		{Date: "2025-03-04", Advancers: 1, Decliners: 1, Unchanged: 1, NewHighs: 1, NewLows: 1, ADLine: -1},
+	}
+	for i := range want {
+		if days[i] != want[i] {
+			t.Errorf("day %d: got %+v, want %+v", i, days[i], want[i])
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "market_breadth.csv")
+	if err := writeCSV(path, breadthRows(days)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBreadth(path)
+	if err != nil || len(loaded) != 4 || loaded[3] != days[3] {
+		t.Errorf("loaded: %+v %v", loaded, err)
+	}
+}
@@ -0,0 +1,184 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CalendarStats summarises the sessions of one year or month
+type CalendarStats struct {
+	Period        string  // YYYY for a year, YYYY-MM for a month
+	TradingDays   int     // sessions with at least one trade
+	Volume        int64   // shares traded
+	Value         float64 // value traded
+	AvgDailyValue float64 // value traded per session
+	// The sessions with the highest and lowest average return of the tickers traded, each against
+	// its previous traded close; empty with NaN returns when no session had one
+	BestDay     string
+	BestReturn  float64 // percent
+	WorstDay    string
+	WorstReturn float64
+}
+
+// MarshalJSON encodes the statistics with snake_case names and NaN returns as null
+func (c CalendarStats) MarshalJSON() ([]byte, error) {
+	number := func(v float64) *float64 {
+		if math.IsNaN(v) {
+			return nil
+		}
+		return &v
+	}
+	return json.Marshal(struct {
+		Period        string   `json:"period"`
+		TradingDays   int      `json:"trading_days"`
+		Volume        int64    `json:"volume"`
+		Value         float64  `json:"value"`
+		AvgDailyValue float64  `json:"avg_daily_value"`
+		BestDay       string   `json:"best_day"`
+		BestReturn    *float64 `json:"best_return"`
+		WorstDay      string   `json:"worst_day"`
+		WorstReturn   *float64 `json:"worst_return"`
+	}{
+		c.Period, c.TradingDays, c.Volume, c.Value, c.AvgDailyValue,
+		c.BestDay, number(c.BestReturn), c.WorstDay, number(c.WorstReturn),
+	})
+}
+
+// calendarHeader is the header of calendar_stats.csv
+var calendarHeader = []string{
+	"Period", "TradingDays", "Volume", "Value", "AvgDailyValue",
+	"BestDay", "BestReturn", "WorstDay", "WorstReturn",
+}
+
+// CalendarStatistics returns the statistics of every year and month of series, sorted by period
+// so each year comes before its months. Only traded bars count.
+func CalendarStatistics(series map[string]*TickerSeries) []CalendarStats {
+	type session struct {
+		volume      int64
+		value       float64
+		returns     float64
+		withReturns int
+	}
+	sessions := make(map[time.Time]*session)
+	for _, s := range series {
+		var prev float64
+		for _, b := range s.Bars {
+			if !b.Traded {
+				continue
+			}
+			day, ok := sessions[b.Date]
+			if !ok {
+				day = &session{}
+				sessions[b.Date] = day
+			}
+			day.volume += b.Volume
+			day.value += b.Value
+			if prev > 0 && b.Close > 0 {
+				day.returns += (b.Close/prev - 1) * 100
+				day.withReturns++
+			}
+			if b.Close > 0 {
+				prev = b.Close
+			}
+		}
+	}
+
+	dates := make([]time.Time, 0, len(sessions))
+	for date := range sessions {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	byPeriod := make(map[string]*CalendarStats)
+	for _, date := range dates {
+		day := sessions[date]
+		for _, period := range []string{date.Format("2006"), date.Format("2006-01")} {
+			stats, ok := byPeriod[period]
+			if !ok {
+				stats = &CalendarStats{Period: period, BestReturn: math.NaN(), WorstReturn: math.NaN()}
+				byPeriod[period] = stats
+			}
+			stats.TradingDays++
+			stats.Volume += day.volume
+			stats.Value += day.value
+			if day.withReturns == 0 {
+				continue
+			}
+			r := day.returns / float64(day.withReturns)
+			if math.IsNaN(stats.BestReturn) || r > stats.BestReturn {
+				stats.BestDay, stats.BestReturn = date.Format("2006-01-02"), r
+			}
+			if math.IsNaN(stats.WorstReturn) || r < stats.WorstReturn {
+				stats.WorstDay, stats.WorstReturn = date.Format("2006-01-02"), r
+			}
+		}
+	}
+
+	stats := make([]CalendarStats, 0, len(byPeriod))
+	for _, c := range byPeriod {
+		c.AvgDailyValue = c.Value / float64(c.TradingDays)
+		stats = append(stats, *c)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Period < stats[j].Period })
+	return stats
+}
+
+// calendarRows formats calendar_stats.csv
+func calendarRows(stats []CalendarStats) [][]string {
+	rows := [][]string{calendarHeader}
+	for _, c := range stats {
+		rows = append(rows, []string{
+			c.Period,
+			strconv.Itoa(c.TradingDays),
+			strconv.FormatInt(c.Volume, 10),
+			fmt.Sprintf("%.2f", c.Value),
+			fmt.Sprintf("%.2f", c.AvgDailyValue),
+			c.BestDay,
+			FormatValue(c.BestReturn, 4),
+			c.WorstDay,
+			FormatValue(c.WorstReturn, 4),
+		})
+	}
+	return rows
+}
+
+// LoadCalendarStats reads calendar_stats.csv back. Empty returns are NaN.
+func LoadCalendarStats(path string) ([]CalendarStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	float := func(cell string) float64 {
+		if cell == "" {
+			return math.NaN()
+		}
+		v, _ := strconv.ParseFloat(cell, 64)
+		return v
+	}
+	var stats []CalendarStats
+	for i, row := range rows {
+		if i == 0 || len(row) < len(calendarHeader) {
+			continue
+		}
+		c := CalendarStats{Period: row[0], BestDay: row[5], WorstDay: row[7]}
+		c.TradingDays, _ = strconv.Atoi(row[1])
+		c.Volume, _ = strconv.ParseInt(row[2], 10, 64)
+		c.Value, _ = strconv.ParseFloat(row[3], 64)
+		c.AvgDailyValue, _ = strconv.ParseFloat(row[4], 64)
+		c.BestReturn, c.WorstReturn = float(row[6]), float(row[8])
+		stats = append(stats, c)
+	}
+	return stats, nil
+}
@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCalendarStatistics sums the sessions of each year and month and finds their best and worst
+// days, and reads calendar_stats.csv back
+func TestCalendarStatistics(t *testing.T) {
+	date := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC) }
+	series := map[string]*TickerSeries{
+		"BBOB": {Ticker: "BBOB", Bars: []Bar{
+			{Date: date(1, 2), Close: 10, Volume: 100, Value: 1000, Traded: true},
+			{Date: date(1, 3), Close: 11, Volume: 100, Value: 1100, Traded: true},
+			{Date: date(1, 4), Close: 11}, // forward-filled
+			{Date: date(2, 1), Close: 9.9, Volume: 200, Value: 1980, Traded: true},
+		}},
+		"IBSD": {Ticker: "IBSD", Bars: []Bar{
+			{Date: date(1, 3), Close: 2, Volume: 50, Value: 100, Traded: true},
+			{Date: date(1, 4), Close: 2.1, Volume: 50, Value: 105, Traded: true},
+		}},
+	}
+
+	stats := CalendarStatistics(series)
+	if len(stats) != 3 || stats[0].Period != "2024" || stats[1].Period != "2024-01" || stats[2].Period != "2024-02" {
+		t.Fatalf("periods: %+v", stats)
+	}
+	year, jan := stats[0], stats[1]
+	if year.TradingDays != 4 || year.Volume != 500 || !near(year.Value, 4285) || !near(year.AvgDailyValue, 4285.0/4) {
+		t.Errorf("year: %+v", year)
+	}
+	// Jan 3 rose 10% on BBOB, IBSD's first trade counting for nothing; Jan 4 rose 10% on IBSD;
+	// Feb 1 fell 10% on BBOB
+	if jan.BestDay != "2024-01-03" || !near(jan.BestReturn, 10) || jan.WorstDay != "2024-01-04" || !near(jan.WorstReturn, 5) {
+		t.Errorf("january: %+v", jan)
+	}
+	if year.WorstDay != "2024-02-01" || !near(year.WorstReturn, -10) {
+		t.Errorf("worst day of the year: %+v", year)
+	}
+
+	path := filepath.Join(t.TempDir(), "calendar_stats.csv")
+	if err := writeCSV(path, calendarRows(stats)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCalendarStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 3 || loaded[2].TradingDays != 1 || !near(loaded[2].BestReturn, -10) || math.IsNaN(loaded[1].WorstReturn) {
+		t.Errorf("loaded: %+v", loaded)
+	}
+}
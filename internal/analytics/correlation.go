@@ -0,0 +1,189 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// minSharedReturns is the number of paired returns below which two series have no correlation
+// and a ticker no beta
+const minSharedReturns = 3
+
+// CorrelationMatrix holds the correlations of the daily returns of a set of series over the window
+// of dates from From to To
+type CorrelationMatrix struct {
+	From    time.Time
+	To      time.Time
+	Window  int      // dates in the window
+	Tickers []string // rows and columns of Values
+	Values  [][]float64
+	Returns [][]int // daily returns each pair shares in the window
+}
+
+// MarshalJSON encodes the matrix for heatmaps, with the dates as YYYY-MM-DD and NaN as null
+func (m CorrelationMatrix) MarshalJSON() ([]byte, error) {
+	values := make([][]*float64, len(m.Values))
+	for i, row := range m.Values {
+		values[i] = make([]*float64, len(row))
+		for j, v := range row {
+			if !math.IsNaN(v) {
+				v := math.Round(v*10000) / 10000
+				values[i][j] = &v
+			}
+		}
+	}
+	return json.Marshal(struct {
+		From    string       `json:"from"`
+		To      string       `json:"to"`
+		Window  int          `json:"window"`
+		Tickers []string     `json:"tickers"`
+		Matrix  [][]*float64 `json:"matrix"`
+		Returns [][]int      `json:"returns"`
+	}{formatDate(m.From), formatDate(m.To), m.Window, m.Tickers, values, m.Returns})
+}
+
+// Rows formats the matrix as CSV: a Ticker column followed by one column per ticker
+func (m CorrelationMatrix) Rows() [][]string {
+	rows := [][]string{append([]string{"Ticker"}, m.Tickers...)}
+	for i, ticker := range m.Tickers {
+		row := []string{ticker}
+		for _, v := range m.Values[i] {
+			row = append(row, FormatValue(v, 4))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Correlation returns the Pearson correlations of the daily returns of series over the last
+// window dates any of them traded on up to end, or up to their last date when end is zero. Moving
+// end gives the rolling correlation.
+func Correlation(series []*TickerSeries, window int, end time.Time) CorrelationMatrix {
+	returns := make([]map[time.Time]float64, len(series))
+	dates := make(map[time.Time]bool)
+	for i, s := range series {
+		returns[i] = DailyReturns(s.Bars)
+		for date := range returns[i] {
+			if end.IsZero() || !date.After(end) {
+				dates[date] = true
+			}
+		}
+	}
+	calendar := make([]time.Time, 0, len(dates))
+	for date := range dates {
+		calendar = append(calendar, date)
+	}
+	sort.Slice(calendar, func(i, j int) bool { return calendar[i].Before(calendar[j]) })
+	if window > 0 && len(calendar) > window {
+		calendar = calendar[len(calendar)-window:]
+	}
+
+	m := CorrelationMatrix{
+		Window:  len(calendar),
+		Tickers: make([]string, len(series)),
+		Values:  make([][]float64, len(series)),
+		Returns: make([][]int, len(series)),
+	}
+	if len(calendar) > 0 {
+		m.From, m.To = calendar[0], calendar[len(calendar)-1]
+	}
+	for i, s := range series {
+		m.Tickers[i] = s.Ticker
+		m.Values[i] = make([]float64, len(series))
+		m.Returns[i] = make([]int, len(series))
+	}
+	for i := range series {
+		for j := i; j < len(series); j++ {
+			var x, y []float64
+			for _, date := range calendar {
+				a, okA := returns[i][date]
+				b, okB := returns[j][date]
+				if okA && okB {
+					x, y = append(x, a), append(y, b)
+				}
+			}
+			r := math.NaN()
+			if len(x) >= minSharedReturns {
+				r = pearson(x, y)
+			}
+			m.Values[i][j], m.Values[j][i] = r, r
+			m.Returns[i][j], m.Returns[j][i] = len(x), len(x)
+		}
+	}
+	return m
+}
+
+// DailyReturns returns the return of every traded bar against the previous traded close, keyed by
+// date. Forward-filled bars carry no return.
+func DailyReturns(bars []Bar) map[time.Time]float64 {
+	returns := make(map[time.Time]float64)
+	prev := 0.0
+	for _, b := range bars {
+		if !b.Traded || b.Close <= 0 {
+			continue
+		}
+		if prev > 0 {
+			returns[b.Date] = b.Close/prev - 1
+		}
+		prev = b.Close
+	}
+	return returns
+}
+
+// pearson returns the correlation coefficient of x and y, NaN when either does not vary
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	var sumX, sumY float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varX*varY)
+}
+
+// SaveCorrelation writes the matrix to base+".csv" and base+".json"
+func SaveCorrelation(m CorrelationMatrix, base string) error {
+	if err := writeCSV(base+".csv", m.Rows()); err != nil {
+		return err
+	}
+	return writeFile(base+".json", func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+// SelectSeries returns the series of tickers in the given order, or every series sorted by ticker
+// when tickers is empty
+func SelectSeries(series map[string]*TickerSeries, tickers []string) ([]*TickerSeries, error) {
+	if len(tickers) == 0 {
+		for ticker := range series {
+			tickers = append(tickers, ticker)
+		}
+		sort.Strings(tickers)
+	}
+	selected := make([]*TickerSeries, 0, len(tickers))
+	for _, ticker := range tickers {
+		s, ok := series[ticker]
+		if !ok {
+			return nil, fmt.Errorf("unknown ticker %q", ticker)
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCorrelation correlates daily returns over the window, skipping forward-filled bars, against
+// an index read from indexes.csv
+func TestCorrelation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "indexes.csv")
+	csv := "Date,ISX60,ISX15,ISX60_Change,ISX60_ChangePercent\n2025-03-01,100,,,\n2025-03-02,110,50,10.00,10.00\n" +
+		"2025-03-03,99,,-11.00,-10.00\n2025-03-04,108.9,,9.90,10.00\n"
+	if err := os.WriteFile(path, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	indices, err := LoadIndexSeries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indices) != 2 || len(indices["ISX60"].Bars) != 4 || len(indices["ISX15"].Bars) != 1 {
+		t.Fatalf("indices: %+v", indices)
+	}
+
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	bar := func(offset int, close float64, traded bool) Bar {
+		return Bar{Date: day.AddDate(0, 0, offset), Close: close, Traded: traded}
+	}
+	series := map[string]*TickerSeries{
+		// Moves with the index, twice as far
+		"BBOB": {Ticker: "BBOB", Bars: []Bar{bar(0, 10, true), bar(1, 12, true), bar(2, 9.6, true), bar(3, 11.52, true)}},
+		// Moves against it
+		"IBSD": {Ticker: "IBSD", Bars: []Bar{bar(0, 10, true), bar(1, 9, true), bar(2, 9.9, true), bar(3, 8.91, true)}},
+		// Never trades after the first day
+		"TASC": {Ticker: "TASC", Bars: []Bar{bar(0, 5, true), bar(1, 5, false), bar(2, 5, false), bar(3, 5, false)}},
+	}
+	selected, err := SelectSeries(series, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected = append(selected, indices["ISX60"])
+
+	m := Correlation(selected, 3, time.Time{})
+	if m.Window != 3 || !m.To.Equal(day.AddDate(0, 0, 3)) {
+		t.Fatalf("window: %d to %s", m.Window, m.To)
+	}
+	if !near(m.Values[0][3], 1) || !near(m.Values[1][3], -1) || !near(m.Values[0][0], 1) {
+		t.Errorf("correlations: %v", m.Values)
+	}
+	if !math.IsNaN(m.Values[2][3]) || m.Returns[2][3] != 0 {
+		t.Errorf("untraded ticker: %v %v", m.Values[2], m.Returns[2])
+	}
+
+	// Ending the window early leaves too few returns
+	if early := Correlation(selected, 3, day.AddDate(0, 0, 2)); !math.IsNaN(early.Values[0][3]) || early.Returns[0][3] != 2 {
+		t.Errorf("early window: %v %v", early.Values, early.Returns)
+	}
+	if _, err := SelectSeries(series, []string{"NONE"}); err == nil {
+		t.Error("unknown ticker selected")
+	}
+}
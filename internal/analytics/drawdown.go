@@ -0,0 +1,187 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Drawdown describes the declines of a series from its running peak close
+type Drawdown struct {
+	Ticker string
+	Index  bool // an index of indexes.csv rather than a ticker
+
+	MaxDrawdown float64   // percent the worst trough is below the peak before it, 0 without a decline
+	Peak        time.Time // peak and trough of the maximum drawdown
+	Trough      time.Time
+	Recovery    time.Time // first close back at the peak; zero while not recovered
+	Days        int       // calendar days from the peak to the recovery, or to the last close
+
+	CurrentDrawdown float64   // percent the last close is below the highest close
+	CurrentPeak     time.Time // date of the highest close
+	CurrentDays     int       // calendar days from the highest close to the last
+	LastDate        time.Time
+}
+
+// ComputeDrawdown returns the drawdowns of bars, which are in date order. Bars without a close
+// are ignored.
+func ComputeDrawdown(ticker string, bars []Bar) Drawdown {
+	var state drawdownState
+	for _, b := range bars {
+		state.add(b)
+	}
+	return state.drawdown(ticker)
+}
+
+// drawdownState follows the drawdowns of a series a bar at a time, holding only the bars that
+// mark them
+type drawdownState struct {
+	priced      bool
+	peak, last  Bar // highest and last close
+	maxDrawdown float64
+	maxPeak     Bar // peak and trough of the maximum drawdown
+	trough      Bar
+	recovery    time.Time
+}
+
+// add takes the next bar in date order. Bars without a close are ignored.
+func (st *drawdownState) add(b Bar) {
+	if b.Close <= 0 {
+		return
+	}
+	st.last = b
+	if !st.priced || b.Close >= st.peak.Close {
+		st.priced, st.peak = true, b
+	} else if dd := (1 - b.Close/st.peak.Close) * 100; dd > st.maxDrawdown {
+		// A deeper decline starts over the wait for a recovery
+		st.maxDrawdown, st.maxPeak, st.trough, st.recovery = dd, st.peak, b, time.Time{}
+		return
+	}
+	if st.maxDrawdown > 0 && st.recovery.IsZero() && b.Close >= st.maxPeak.Close {
+		st.recovery = b.Date
+	}
+}
+
+// drawdown returns the drawdowns of the bars added so far
+func (st *drawdownState) drawdown(ticker string) Drawdown {
+	d := Drawdown{Ticker: ticker}
+	if !st.priced {
+		return d
+	}
+	d.LastDate = st.last.Date
+	d.CurrentPeak = st.peak.Date
+	d.CurrentDays = daysBetween(st.peak.Date, st.last.Date)
+	d.CurrentDrawdown = (1 - st.last.Close/st.peak.Close) * 100
+	if st.maxDrawdown == 0 {
+		return d
+	}
+
+	d.MaxDrawdown = st.maxDrawdown
+	d.Peak, d.Trough, d.Recovery = st.maxPeak.Date, st.trough.Date, st.recovery
+	d.Days = daysBetween(d.Peak, st.last.Date)
+	if !d.Recovery.IsZero() {
+		d.Days = daysBetween(d.Peak, d.Recovery)
+	}
+	return d
+}
+
+// daysBetween returns the calendar days from one date to a later one
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// MarshalJSON encodes the drawdown with snake_case names and dates as YYYY-MM-DD, empty when unset
+func (d Drawdown) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Ticker          string  `json:"ticker"`
+		Index           bool    `json:"index"`
+		MaxDrawdown     float64 `json:"max_drawdown"`
+		Peak            string  `json:"peak_date"`
+		Trough          string  `json:"trough_date"`
+		Recovery        string  `json:"recovery_date"`
+		Days            int     `json:"drawdown_days"`
+		CurrentDrawdown float64 `json:"current_drawdown"`
+		CurrentPeak     string  `json:"current_peak_date"`
+		CurrentDays     int     `json:"current_drawdown_days"`
+		LastDate        string  `json:"last_date"`
+	}{
+		d.Ticker, d.Index, d.MaxDrawdown, formatDate(d.Peak), formatDate(d.Trough), formatDate(d.Recovery),
+		d.Days, d.CurrentDrawdown, formatDate(d.CurrentPeak), d.CurrentDays, formatDate(d.LastDate),
+	})
+}
+
+// formatDate formats t as YYYY-MM-DD, or "" when zero
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// drawdownHeader is the header of drawdown_summary.csv
+var drawdownHeader = []string{
+	"Ticker", "Type", "MaxDrawdown", "PeakDate", "TroughDate", "RecoveryDate", "DrawdownDays",
+	"CurrentDrawdown", "CurrentPeakDate", "CurrentDrawdownDays", "LastDate",
+}
+
+// drawdownRows formats drawdown_summary.csv
+func drawdownRows(drawdowns []Drawdown) [][]string {
+	rows := [][]string{drawdownHeader}
+	for _, d := range drawdowns {
+		kind := "stock"
+		if d.Index {
+			kind = "index"
+		}
+		rows = append(rows, []string{
+			d.Ticker,
+			kind,
+			fmt.Sprintf("%.2f", d.MaxDrawdown),
+			formatDate(d.Peak),
+			formatDate(d.Trough),
+			formatDate(d.Recovery),
+			strconv.Itoa(d.Days),
+			fmt.Sprintf("%.2f", d.CurrentDrawdown),
+			formatDate(d.CurrentPeak),
+			strconv.Itoa(d.CurrentDays),
+			formatDate(d.LastDate),
+		})
+	}
+	return rows
+}
+
+// LoadDrawdowns reads drawdown_summary.csv back
+func LoadDrawdowns(path string) ([]Drawdown, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	date := func(cell string) time.Time {
+		t, _ := time.Parse("2006-01-02", cell)
+		return t
+	}
+	drawdowns := []Drawdown{}
+	for i, row := range rows {
+		if i == 0 || len(row) < len(drawdownHeader) {
+			continue
+		}
+		d := Drawdown{Ticker: row[0], Index: row[1] == "index"}
+		d.MaxDrawdown, _ = strconv.ParseFloat(row[2], 64)
+		d.Peak, d.Trough, d.Recovery = date(row[3]), date(row[4]), date(row[5])
+		d.Days, _ = strconv.Atoi(row[6])
+		d.CurrentDrawdown, _ = strconv.ParseFloat(row[7], 64)
+		d.CurrentPeak = date(row[8])
+		d.CurrentDays, _ = strconv.Atoi(row[9])
+		d.LastDate = date(row[10])
+		drawdowns = append(drawdowns, d)
+	}
+	return drawdowns, nil
+}
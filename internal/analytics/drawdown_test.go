@@ -0,0 +1,48 @@
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestComputeDrawdown finds the deepest decline and its recovery, the current decline, and writes
+// the indices of indexes.csv after the tickers
+func TestComputeDrawdown(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	var bars []Bar
+	for i, c := range []float64{10, 12, 9, 6, 0, 11, 12.5, 11, 10} {
+		bars = append(bars, Bar{Date: day.AddDate(0, 0, i), Close: c})
+	}
+
+	d := ComputeDrawdown("BBOB", bars)
+	if !near(d.MaxDrawdown, 50) || !d.Peak.Equal(bars[1].Date) || !d.Trough.Equal(bars[3].Date) ||
+		!d.Recovery.Equal(bars[6].Date) || d.Days != 5 {
+		t.Errorf("max drawdown: %+v", d)
+	}
+	if !near(d.CurrentDrawdown, 20) || !d.CurrentPeak.Equal(bars[6].Date) || d.CurrentDays != 2 {
+		t.Errorf("current drawdown: %+v", d)
+	}
+	if d := ComputeDrawdown("UP", bars[:2]); d.MaxDrawdown != 0 || !d.Peak.IsZero() || d.CurrentDrawdown != 0 {
+		t.Errorf("rising series: %+v", d)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "indexes.csv"), []byte("Date,ISX60\n2025-03-01,100\n2025-03-02,90\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := &SummaryGenerator{IndexesPath: filepath.Join(dir, "indexes.csv")}
+	path := filepath.Join(dir, "drawdown_summary.csv")
+	if err := writeCSV(path, drawdownRows(append([]Drawdown{d}, indexDrawdowns(g.loadIndices())...))); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDrawdowns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0].Index || !loaded[0].Recovery.Equal(d.Recovery) ||
+		!loaded[1].Index || loaded[1].Ticker != "ISX60" || !near(loaded[1].MaxDrawdown, 10) || !loaded[1].Recovery.IsZero() {
+		t.Errorf("loaded: %+v", loaded)
+	}
+}
@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultHistoryDays is the number of trading days in the recent history of the ticker summary
+const DefaultHistoryDays = 10
+
+// historyColumns are the ticker summary columns of the recent history, in the order of
+// History.Cells
+var historyColumns = []string{"RecentDates", "RecentCloses", "RecentChanges"}
+
+// History holds the closes of a ticker's last trading days as the parallel arrays sparklines take
+type History struct {
+	Dates   []string  `json:"dates"` // YYYY-MM-DD
+	Closes  []float64 `json:"closes"`
+	Changes []float64 `json:"changes"` // percent against the previous trade to 4 decimals, 0 for the first one
+}
+
+// RecentHistory returns the last days traded bars of bars, which are in date order
+func RecentHistory(bars []Bar, days int) History {
+	h := History{Dates: []string{}, Closes: []float64{}, Changes: []float64{}}
+	var traded []Bar
+	for _, b := range bars {
+		if b.Traded && b.Close > 0 {
+			traded = append(traded, b)
+		}
+	}
+	start := len(traded) - days
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(traded); i++ {
+		change := 0.0
+		if i > 0 {
+			change = math.Round((traded[i].Close/traded[i-1].Close-1)*1000000) / 10000
+		}
+		h.Dates = append(h.Dates, traded[i].Date.Format("2006-01-02"))
+		h.Closes = append(h.Closes, traded[i].Close)
+		h.Changes = append(h.Changes, change)
+	}
+	return h
+}
+
+// Cells formats the history as comma-separated CSV cells in the order of historyColumns
+func (h History) Cells() []string {
+	closes, changes := make([]string, len(h.Closes)), make([]string, len(h.Changes))
+	for i, c := range h.Closes {
+		closes[i] = fmt.Sprintf("%.3f", c)
+	}
+	for i, c := range h.Changes {
+		changes[i] = fmt.Sprintf("%.2f", c)
+	}
+	return []string{strings.Join(h.Dates, ","), strings.Join(closes, ","), strings.Join(changes, ",")}
+}
+
+// HistoryColumns returns the ticker summary columns of the recent history
+func HistoryColumns() []string {
+	return append([]string(nil), historyColumns...)
+}
+
+// ParseHistory reads the recent history back from a ticker summary row, finding its columns by
+// the header's names
+func ParseHistory(header, record []string) History {
+	h := History{Dates: []string{}, Closes: []float64{}, Changes: []float64{}}
+	for i, name := range header {
+		if i >= len(record) || record[i] == "" {
+			continue
+		}
+		cells := strings.Split(record[i], ",")
+		switch name {
+		case "RecentDates":
+			h.Dates = cells
+		case "RecentCloses", "RecentChanges":
+			values := make([]float64, len(cells))
+			for j, cell := range cells {
+				values[j], _ = strconv.ParseFloat(strings.TrimSpace(cell), 64)
+			}
+			if name == "RecentCloses" {
+				h.Closes = values
+			} else {
+				h.Changes = values
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,33 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRecentHistory keeps the last trades with their change against the trade before, and reads
+// the summary cells back
+func TestRecentHistory(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	bars := []Bar{
+		{Date: day, Close: 10, Traded: true},
+		{Date: day.AddDate(0, 0, 1), Close: 12, Traded: true},
+		{Date: day.AddDate(0, 0, 2), Close: 12, Traded: false},
+		{Date: day.AddDate(0, 0, 3), Close: 9, Traded: true},
+	}
+
+	h := RecentHistory(bars, 2)
+	want := History{Dates: []string{"2025-03-02", "2025-03-04"}, Closes: []float64{12, 9}, Changes: []float64{20, -25}}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("history: got %+v, want %+v", h, want)
+	}
+	if all := RecentHistory(bars, 30); len(all.Dates) != 3 || all.Changes[0] != 0 {
+		t.Errorf("full history: %+v", all)
+	}
+
+	header := append([]string{"Ticker"}, HistoryColumns()...)
+	if parsed := ParseHistory(header, append([]string{"BBOB"}, h.Cells()...)); !reflect.DeepEqual(parsed, want) {
+		t.Errorf("parsed: %+v", parsed)
+	}
+}
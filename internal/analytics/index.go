@@ -0,0 +1,87 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffixes of the indexes.csv columns holding the daily change of an index since its previous
+// published value, in points and in percent
+const (
+	IndexChangeSuffix        = "_Change"
+	IndexChangePercentSuffix = "_ChangePercent"
+)
+
+// Suffixes of the indexes.csv columns holding the session open, high and low of an index whose
+// report publishes them
+const (
+	IndexOpenSuffix = "_Open"
+	IndexHighSuffix = "_High"
+	IndexLowSuffix  = "_Low"
+)
+
+// IsIndexLevel reports whether a column of indexes.csv holds index values rather than changes or
+// session ranges
+func IsIndexLevel(column string) bool {
+	for _, suffix := range []string{IndexChangeSuffix, IndexChangePercentSuffix, IndexOpenSuffix, IndexHighSuffix, IndexLowSuffix} {
+		if strings.HasSuffix(column, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadIndexSeries reads indexes.csv, written by indexcsv: a Date column followed by one column
+// per index and their change columns. Every index becomes a series named after its column, with its values as closes.
+func LoadIndexSeries(path string) (map[string]*TickerSeries, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	header := rows[0]
+	series := make(map[string]*TickerSeries)
+	for _, row := range rows[1:] {
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(row[0]))
+		if err != nil {
+			continue
+		}
+		for j := 1; j < len(row) && j < len(header); j++ {
+			name := strings.TrimSpace(header[j])
+			if !IsIndexLevel(name) {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(row[j]), 64)
+			if err != nil || value <= 0 {
+				continue // index not published that day
+			}
+			s, ok := series[name]
+			if !ok {
+				s = &TickerSeries{Ticker: name, CompanyName: name}
+				series[name] = s
+			}
+			s.Bars = append(s.Bars, Bar{Date: date, Open: value, High: value, Low: value, Close: value, Traded: true})
+		}
+	}
+
+	for _, s := range series {
+		sort.SliceStable(s.Bars, func(i, j int) bool { return s.Bars[i].Date.Before(s.Bars[j].Date) })
+	}
+	return series, nil
+}
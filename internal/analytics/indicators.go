@@ -0,0 +1,447 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// IndicatorNames are the columns the indicator engine adds, in the order of Indicators.Values
+var IndicatorNames = []string{
+	"SMA10", "SMA20", "SMA50", "SMA200",
+	"EMA12", "EMA26",
+	"RSI14",
+	"MACD", "MACDSignal", "MACDHistogram",
+	"VWAP", "VWAP5", "VWAP20",
+}
+
+// Indicators are the technical indicators of one close. Values that need more history than is
+// available are NaN.
+type Indicators struct {
+	SMA10, SMA20, SMA50, SMA200 float64
+	EMA12, EMA26                float64
+	RSI14                       float64
+	MACD                        float64 // EMA12 - EMA26
+	MACDSignal                  float64 // 9-day EMA of MACD
+	MACDHistogram               float64 // MACD - MACDSignal
+	VWAP                        float64 // value / volume of the day, NaN without trades
+	VWAP5, VWAP20               float64 // rolling value / volume over the last 5 and 20 days
+}
+
+// Values returns the indicators in the order of IndicatorNames
+func (in Indicators) Values() []float64 {
+	return []float64{
+		in.SMA10, in.SMA20, in.SMA50, in.SMA200,
+		in.EMA12, in.EMA26,
+		in.RSI14,
+		in.MACD, in.MACDSignal, in.MACDHistogram,
+		in.VWAP, in.VWAP5, in.VWAP20,
+	}
+}
+
+// MarshalJSON encodes the indicators with snake_case names and NaN values as null
+func (in Indicators) MarshalJSON() ([]byte, error) {
+	values := in.Values()
+	number := make([]*float64, len(values))
+	for i := range values {
+		if !math.IsNaN(values[i]) {
+			number[i] = &values[i]
+		}
+	}
+	return json.Marshal(struct {
+		SMA10         *float64 `json:"sma10"`
+		SMA20         *float64 `json:"sma20"`
+		SMA50         *float64 `json:"sma50"`
+		SMA200        *float64 `json:"sma200"`
+		EMA12         *float64 `json:"ema12"`
+		EMA26         *float64 `json:"ema26"`
+		RSI14         *float64 `json:"rsi14"`
+		MACD          *float64 `json:"macd"`
+		MACDSignal    *float64 `json:"macd_signal"`
+		MACDHistogram *float64 `json:"macd_histogram"`
+		VWAP          *float64 `json:"vwap"`
+		VWAP5         *float64 `json:"vwap5"`
+		VWAP20        *float64 `json:"vwap20"`
+	}{
+		number[0], number[1], number[2], number[3], number[4], number[5], number[6],
+		number[7], number[8], number[9], number[10], number[11], number[12],
+	})
+}
+
+// Cells formats the indicators as CSV cells in the order of IndicatorNames, empty where NaN
+func (in Indicators) Cells() []string {
+	values := in.Values()
+	cells := make([]string, len(values))
+	for i, v := range values {
+		decimals := 3
+		if IndicatorNames[i] == "RSI14" {
+			decimals = 2
+		}
+		cells[i] = FormatValue(v, decimals)
+	}
+	return cells
+}
+
+// FormatValue formats v with the given decimals, or as an empty cell when it is NaN
+func FormatValue(v float64, decimals int) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// ComputeIndicators returns the indicators of every day of a series in date order from its
+// closes, volumes and traded values. volumes and values may be nil, leaving the VWAPs NaN.
+func ComputeIndicators(closes, volumes, values []float64) []Indicators {
+	sma10, sma20, sma50, sma200 := SMA(closes, 10), SMA(closes, 20), SMA(closes, 50), SMA(closes, 200)
+	ema12, ema26 := EMA(closes, 12), EMA(closes, 26)
+	rsi := RSI(closes, 14)
+	macd, signal, hist := MACD(closes, 12, 26, 9)
+	vwap, vwap5, vwap20 := VWAP(volumes, values, 1), VWAP(volumes, values, 5), VWAP(volumes, values, 20)
+	if len(volumes) != len(closes) || len(values) != len(closes) {
+		vwap, vwap5, vwap20 = nanSeries(len(closes)), nanSeries(len(closes)), nanSeries(len(closes))
+	}
+
+	out := make([]Indicators, len(closes))
+	for i := range closes {
+		out[i] = Indicators{
+			SMA10: sma10[i], SMA20: sma20[i], SMA50: sma50[i], SMA200: sma200[i],
+			EMA12: ema12[i], EMA26: ema26[i],
+			RSI14:         rsi[i],
+			MACD:          macd[i],
+			MACDSignal:    signal[i],
+			MACDHistogram: hist[i],
+			VWAP:          vwap[i], VWAP5: vwap5[i], VWAP20: vwap20[i],
+		}
+	}
+	return out
+}
+
+// VWAP returns the volume-weighted average price over window days: the traded value of the
+// window over its volume. It is NaN until window days are seen or when none of them traded.
+func VWAP(volumes, values []float64, window int) []float64 {
+	n := min(len(volumes), len(values))
+	out := nanSeries(n)
+	if window <= 0 {
+		return out
+	}
+	for i := window - 1; i < n; i++ {
+		// Summed afresh per window, as running sums of large values drift
+		volume, value := 0.0, 0.0
+		for j := i - window + 1; j <= i; j++ {
+			volume += volumes[j]
+			value += values[j]
+		}
+		if volume > 0 {
+			out[i] = value / volume
+		}
+	}
+	return out
+}
+
+// nanSeries returns n NaN values
+func nanSeries(n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = math.NaN()
+	}
+	return s
+}
+
+// SMA returns the simple moving average over window values, NaN until window values are seen
+func SMA(values []float64, window int) []float64 {
+	out := nanSeries(len(values))
+	if window <= 0 {
+		return out
+	}
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= window {
+			sum -= values[i-window]
+		}
+		if i >= window-1 {
+			out[i] = sum / float64(window)
+		}
+	}
+	return out
+}
+
+// EMA returns the exponential moving average with smoothing 2/(window+1), seeded with the simple
+// average of the first window values. NaN values before the series starts are skipped, so EMA
+// can be applied to the output of another indicator.
+func EMA(values []float64, window int) []float64 {
+	out := nanSeries(len(values))
+	if window <= 0 {
+		return out
+	}
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if len(values)-start < window {
+		return out
+	}
+	sum := 0.0
+	for _, v := range values[start : start+window] {
+		sum += v
+	}
+	ema := sum / float64(window)
+	out[start+window-1] = ema
+	alpha := 2 / float64(window+1)
+	for i := start + window; i < len(values); i++ {
+		ema += alpha * (values[i] - ema)
+		out[i] = ema
+	}
+	return out
+}
+
+// RSI returns Wilder's relative strength index over window changes, NaN until window changes are
+// seen. A series without losses has an RSI of 100.
+func RSI(values []float64, window int) []float64 {
+	out := nanSeries(len(values))
+	if window <= 0 || len(values) <= window {
+		return out
+	}
+	var gain, loss float64
+	for i := 1; i <= window; i++ {
+		change := values[i] - values[i-1]
+		if change > 0 {
+			gain += change
+		} else {
+			loss -= change
+		}
+	}
+	gain /= float64(window)
+	loss /= float64(window)
+	out[window] = rsiValue(gain, loss)
+	for i := window + 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		up, down := 0.0, 0.0
+		if change > 0 {
+			up = change
+		} else {
+			down = -change
+		}
+		gain = (gain*float64(window-1) + up) / float64(window)
+		loss = (loss*float64(window-1) + down) / float64(window)
+		out[i] = rsiValue(gain, loss)
+	}
+	return out
+}
+
+func rsiValue(gain, loss float64) float64 {
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// MACD returns the MACD line (fast EMA - slow EMA), its signal line (EMA of the MACD line) and
+// their difference
+func MACD(values []float64, fast, slow, signal int) (macd, signalLine, histogram []float64) {
+	fastEMA, slowEMA := EMA(values, fast), EMA(values, slow)
+	macd = nanSeries(len(values))
+	for i := range values {
+		if !math.IsNaN(fastEMA[i]) && !math.IsNaN(slowEMA[i]) {
+			macd[i] = fastEMA[i] - slowEMA[i]
+		}
+	}
+	signalLine = EMA(macd, signal)
+	histogram = nanSeries(len(values))
+	for i := range values {
+		if !math.IsNaN(macd[i]) && !math.IsNaN(signalLine[i]) {
+			histogram[i] = macd[i] - signalLine[i]
+		}
+	}
+	return macd, signalLine, histogram
+}
+
+// indicatorState computes the indicators of the last close of a series a bar at a time, holding
+// only the closes, volumes and values its longest window needs. Its sums and smoothing take the
+// steps of ComputeIndicators, so the values are the same.
+type indicatorState struct {
+	sma10, sma20, sma50, sma200 smaState
+	ema12, ema26, signal        emaState
+	rsi                         rsiState
+	volumes, values             []float64 // of the last 20 days, for the VWAPs
+}
+
+// newIndicatorState returns the state of a series without bars
+func newIndicatorState() indicatorState {
+	return indicatorState{
+		sma10: smaState{window: 10}, sma20: smaState{window: 20}, sma50: smaState{window: 50}, sma200: smaState{window: 200},
+		ema12: emaState{window: 12}, ema26: emaState{window: 26}, signal: emaState{window: 9},
+		rsi: rsiState{window: 14},
+	}
+}
+
+// add takes the next bar in date order
+func (st *indicatorState) add(b Bar) {
+	for _, sma := range []*smaState{&st.sma10, &st.sma20, &st.sma50, &st.sma200} {
+		sma.add(b.Close)
+	}
+	st.ema12.add(b.Close)
+	st.ema26.add(b.Close)
+	st.signal.add(st.macd())
+	st.rsi.add(b.Close)
+	st.volumes = keepLast(append(st.volumes, float64(b.Volume)), 20)
+	st.values = keepLast(append(st.values, b.Value), 20)
+}
+
+// macd returns EMA12 - EMA26 of the last close, NaN until both are known
+func (st *indicatorState) macd() float64 {
+	fast, slow := st.ema12.value(), st.ema26.value()
+	if math.IsNaN(fast) || math.IsNaN(slow) {
+		return math.NaN()
+	}
+	return fast - slow
+}
+
+// vwap returns the VWAP of the last window days, summed afresh like VWAP
+func (st *indicatorState) vwap(window int) float64 {
+	n := len(st.volumes)
+	if window <= 0 || n < window {
+		return math.NaN()
+	}
+	volume, value := 0.0, 0.0
+	for j := n - window; j < n; j++ {
+		volume += st.volumes[j]
+		value += st.values[j]
+	}
+	if volume > 0 {
+		return value / volume
+	}
+	return math.NaN()
+}
+
+// indicators returns the indicators of the last close
+func (st *indicatorState) indicators() Indicators {
+	macd, signal := st.macd(), st.signal.value()
+	histogram := math.NaN()
+	if !math.IsNaN(macd) && !math.IsNaN(signal) {
+		histogram = macd - signal
+	}
+	return Indicators{
+		SMA10: st.sma10.value(), SMA20: st.sma20.value(), SMA50: st.sma50.value(), SMA200: st.sma200.value(),
+		EMA12: st.ema12.value(), EMA26: st.ema26.value(),
+		RSI14:         st.rsi.value(),
+		MACD:          macd,
+		MACDSignal:    signal,
+		MACDHistogram: histogram,
+		VWAP:          st.vwap(1), VWAP5: st.vwap(5), VWAP20: st.vwap(20),
+	}
+}
+
+// smaState is SMA a value at a time, keeping the last window values in a ring
+type smaState struct {
+	window int
+	recent []float64
+	n      int
+	sum    float64
+}
+
+func (st *smaState) add(v float64) {
+	if st.window <= 0 {
+		return
+	}
+	if st.recent == nil {
+		st.recent = make([]float64, st.window)
+	}
+	i := st.n % st.window
+	st.sum += v
+	if st.n >= st.window {
+		st.sum -= st.recent[i]
+	}
+	st.recent[i] = v
+	st.n++
+}
+
+func (st *smaState) value() float64 {
+	if st.window <= 0 || st.n < st.window {
+		return math.NaN()
+	}
+	return st.sum / float64(st.window)
+}
+
+// emaState is EMA a value at a time, skipping NaN values before the series starts
+type emaState struct {
+	window   int
+	n        int
+	sum, ema float64
+}
+
+func (st *emaState) add(v float64) {
+	if st.window <= 0 || (st.n == 0 && math.IsNaN(v)) {
+		return
+	}
+	st.n++
+	switch {
+	case st.n < st.window:
+		st.sum += v
+	case st.n == st.window:
+		st.sum += v
+		st.ema = st.sum / float64(st.window)
+	default:
+		alpha := 2 / float64(st.window+1)
+		st.ema += alpha * (v - st.ema)
+	}
+}
+
+func (st *emaState) value() float64 {
+	if st.window <= 0 || st.n < st.window {
+		return math.NaN()
+	}
+	return st.ema
+}
+
+// rsiState is RSI a value at a time
+type rsiState struct {
+	window     int
+	n          int
+	prev       float64
+	gain, loss float64
+}
+
+func (st *rsiState) add(v float64) {
+	if st.n > 0 && st.window > 0 {
+		change := v - st.prev
+		up, down := 0.0, 0.0
+		if change > 0 {
+			up = change
+		} else {
+			down = -change
+		}
+		switch {
+		case st.n < st.window:
+			st.gain += up
+			st.loss += down
+		case st.n == st.window:
+			st.gain = (st.gain + up) / float64(st.window)
+			st.loss = (st.loss + down) / float64(st.window)
+		default:
+			st.gain = (st.gain*float64(st.window-1) + up) / float64(st.window)
+			st.loss = (st.loss*float64(st.window-1) + down) / float64(st.window)
+		}
+	}
+	st.prev = v
+	st.n++
+}
+
+func (st *rsiState) value() float64 {
+	if st.window <= 0 || st.n <= st.window {
+		return math.NaN()
+	}
+	return rsiValue(st.gain, st.loss)
+}
+
+// keepLast returns the last n elements of s
+func keepLast[T any](s []T, n int) []T {
+	if n = max(n, 0); len(s) > n {
+		return s[len(s)-n:]
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestIndicators checks the moving averages, RSI and MACD against values worked out by hand,
+// and that indicators without enough history are NaN.
+func TestIndicators(t *testing.T) {
+	closes := []float64{1, 2, 3, 4, 5}
+
+	sma := SMA(closes, 3)
+	if !math.IsNaN(sma[1]) || !near(sma[2], 2) || !near(sma[4], 4) {
+		t.Errorf("SMA: %v", sma)
+	}
+
+	// Seeded with the average of 1, 2, 3, then smoothed with 2/(3+1)
+	ema := EMA(closes, 3)
+	if !math.IsNaN(ema[1]) || !near(ema[2], 2) || !near(ema[3], 3) || !near(ema[4], 4) {
+		t.Errorf("EMA: %v", ema)
+	}
+
+	rsi := RSI([]float64{10, 11, 10, 12}, 2)
+	// A gain and a loss of 1 average to 0.5 each; the rise of 2 smooths them to 1.25 and 0.25
+	if !math.IsNaN(rsi[1]) || !near(rsi[2], 50) || !near(rsi[3], 100-100/(1+1.25/0.25)) {
+		t.Errorf("RSI: %v", rsi)
+	}
+	if up := RSI(closes, 2); !near(up[4], 100) {
+		t.Errorf("RSI of a rising series: %v", up)
+	}
+
+	// A flat series has no momentum
+	flat := make([]float64, 40)
+	for i := range flat {
+		flat[i] = 7
+	}
+	macd, signal, hist := MACD(flat, 12, 26, 9)
+	if !math.IsNaN(macd[24]) || !near(macd[25], 0) || !math.IsNaN(signal[32]) || !near(signal[33], 0) || !near(hist[39], 0) {
+		t.Errorf("MACD of a flat series: %v %v %v", macd[25], signal[33], hist[39])
+	}
+
+	in := ComputeIndicators(flat, nil, nil)[39]
+	cells := in.Cells()
+	if len(cells) != len(IndicatorNames) || cells[0] != "7.000" || cells[3] != "" || cells[6] != "50.00" {
+		t.Errorf("cells: %v", cells)
+	}
+}
+
+// TestVWAP checks the daily and rolling volume-weighted prices, including days without trades
+func TestVWAP(t *testing.T) {
+	volumes := []float64{100, 0, 300, 200}
+	values := []float64{1000, 0, 3600, 2000}
+	daily := VWAP(volumes, values, 1)
+	if !near(daily[0], 10) || !math.IsNaN(daily[1]) || !near(daily[2], 12) || !near(daily[3], 10) {
+		t.Errorf("daily VWAP: %v", daily)
+	}
+	rolling := VWAP(volumes, values, 3)
+	if !math.IsNaN(rolling[1]) || !near(rolling[2], 4600.0/400) || !near(rolling[3], 5600.0/500) {
+		t.Errorf("3-day VWAP: %v", rolling)
+	}
+
+	closes := []float64{10, 10, 12, 10}
+	in := ComputeIndicators(closes, volumes, values)[3]
+	if !near(in.VWAP, 10) || !math.IsNaN(in.VWAP5) {
+		t.Errorf("indicators: VWAP %v, VWAP5 %v", in.VWAP, in.VWAP5)
+	}
+}
+
+// TestYearRange checks that the 52-week range only covers the year up to the last bar
+func TestYearRange(t *testing.T) {
+	day := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	bars := []Bar{
+		{Date: day.AddDate(-1, 0, -1), Close: 50}, // more than 52 weeks before
+		{Date: day.AddDate(0, -6, 0), Close: 20},
+		{Date: day.AddDate(0, -1, 0)}, // filled without a price
+		{Date: day.AddDate(0, 0, -1), Close: 5},
+		{Date: day, Close: 15},
+	}
+	high, low, off := YearRange(bars)
+	if high != 20 || low != 5 || !near(off, 25) {
+		t.Errorf("YearRange: high %v, low %v, off %v", high, low, off)
+	}
+}
@@ -0,0 +1,167 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLiquidityWindows are the windows of the liquidity metrics in the ticker summary, about a
+// month and a quarter of sessions
+var DefaultLiquidityWindows = []int{20, 60}
+
+// Liquidity measures how much a ticker traded over the last Window sessions of the market
+type Liquidity struct {
+	Window          int
+	Sessions        int     // market sessions in the window since the ticker's first bar
+	TradingDays     int     // sessions the ticker traded with a volume
+	AvgDailyValue   float64 // traded value per session, sessions without trades counting as 0
+	ZeroVolumeRatio float64 // share of the sessions without a traded volume
+	Turnover        float64 // volume traded in percent of the shares outstanding, NaN when unknown
+}
+
+// MarshalJSON encodes the metrics with snake_case names and an unknown turnover as null
+func (l Liquidity) MarshalJSON() ([]byte, error) {
+	var turnover *float64
+	if !math.IsNaN(l.Turnover) {
+		turnover = &l.Turnover
+	}
+	return json.Marshal(struct {
+		Window          int      `json:"window"`
+		Sessions        int      `json:"sessions"`
+		TradingDays     int      `json:"trading_days"`
+		AvgDailyValue   float64  `json:"avg_daily_value"`
+		ZeroVolumeRatio float64  `json:"zero_volume_ratio"`
+		Turnover        *float64 `json:"turnover"`
+	}{l.Window, l.Sessions, l.TradingDays, l.AvgDailyValue, l.ZeroVolumeRatio, turnover})
+}
+
+// liquidityMetrics name the summary columns of a window, suffixed with "<window>D"
+var liquidityMetrics = []string{"AvgDailyValue", "ZeroVolumeRatio", "Turnover", "TradingDays", "Sessions"}
+
+// LiquidityNames returns the summary columns of the liquidity metrics of window, in the order of
+// Liquidity.Cells
+func LiquidityNames(window int) []string {
+	names := make([]string, len(liquidityMetrics))
+	for i, metric := range liquidityMetrics {
+		names[i] = fmt.Sprintf("%s%dD", metric, window)
+	}
+	return names
+}
+
+// Cells formats the metrics as CSV cells in the order of LiquidityNames
+func (l Liquidity) Cells() []string {
+	return []string{
+		fmt.Sprintf("%.2f", l.AvgDailyValue),
+		fmt.Sprintf("%.4f", l.ZeroVolumeRatio),
+		FormatValue(l.Turnover, 4),
+		strconv.Itoa(l.TradingDays),
+		strconv.Itoa(l.Sessions),
+	}
+}
+
+// MarketCalendar returns the dates any of series has a bar on, in order
+func MarketCalendar(series map[string]*TickerSeries) []time.Time {
+	dates := make(map[time.Time]bool)
+	for _, s := range series {
+		for _, b := range s.Bars {
+			dates[b.Date] = true
+		}
+	}
+	calendar := make([]time.Time, 0, len(dates))
+	for date := range dates {
+		calendar = append(calendar, date)
+	}
+	sort.Slice(calendar, func(i, j int) bool { return calendar[i].Before(calendar[j]) })
+	return calendar
+}
+
+// ComputeLiquidity returns the liquidity of bars, in date order, over the last window sessions of
+// calendar. Sessions before the first bar don't count, so recent listings aren't penalised; a
+// session without a bar counts as one without trades.
+func ComputeLiquidity(bars []Bar, calendar []time.Time, window int) Liquidity {
+	if len(bars) == 0 {
+		return Liquidity{Window: window, Turnover: math.NaN()}
+	}
+	return recentLiquidity(bars, bars[0].Date, calendar, window)
+}
+
+// recentLiquidity is ComputeLiquidity of a ticker first priced on first, from its bars of the
+// window's sessions or more; calendar needs no more than the window's sessions either
+func recentLiquidity(bars []Bar, first time.Time, calendar []time.Time, window int) Liquidity {
+	l := Liquidity{Window: window, Turnover: math.NaN()}
+	if len(bars) == 0 || window <= 0 {
+		return l
+	}
+	start := len(calendar) - window
+	if start < 0 {
+		start = 0
+	}
+	for start < len(calendar) && calendar[start].Before(first) {
+		start++
+	}
+	l.Sessions = len(calendar) - start
+	if l.Sessions == 0 {
+		return l
+	}
+
+	var volume int64
+	var value, shares float64
+	for i := len(bars) - 1; i >= 0 && !bars[i].Date.Before(calendar[start]); i-- {
+		b := bars[i]
+		if shares == 0 {
+			shares = b.Shares
+		}
+		if b.Traded && b.Volume > 0 {
+			l.TradingDays++
+			volume += b.Volume
+			value += b.Value
+		}
+	}
+	l.AvgDailyValue = value / float64(l.Sessions)
+	l.ZeroVolumeRatio = float64(l.Sessions-l.TradingDays) / float64(l.Sessions)
+	if shares > 0 {
+		l.Turnover = float64(volume) / shares * 100
+	}
+	return l
+}
+
+// ParseLiquidity reads the liquidity metrics back from a ticker summary row, finding the windows
+// by the header's column names
+func ParseLiquidity(header, record []string) []Liquidity {
+	var out []Liquidity
+	for i, name := range header {
+		w, ok := strings.CutPrefix(name, "AvgDailyValue")
+		if !ok || !strings.HasSuffix(w, "D") {
+			continue
+		}
+		window, err := strconv.Atoi(strings.TrimSuffix(w, "D"))
+		if err != nil {
+			continue
+		}
+		l := Liquidity{Window: window, Turnover: math.NaN()}
+		cell := func(metric string) string {
+			for j, name := range header {
+				if name == fmt.Sprintf("%s%dD", metric, window) && j < len(record) {
+					return record[j]
+				}
+			}
+			return ""
+		}
+		if i < len(record) {
+			l.AvgDailyValue, _ = strconv.ParseFloat(record[i], 64)
+		}
+		l.ZeroVolumeRatio, _ = strconv.ParseFloat(cell("ZeroVolumeRatio"), 64)
+		if v, err := strconv.ParseFloat(cell("Turnover"), 64); err == nil {
+			l.Turnover = v
+		}
+		l.TradingDays, _ = strconv.Atoi(cell("TradingDays"))
+		l.Sessions, _ = strconv.Atoi(cell("Sessions"))
+		out = append(out, l)
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestComputeLiquidity measures a window of market sessions, counting sessions without a bar or a
+// volume as untraded but not those before the first bar, and reads the summary cells back
+func TestComputeLiquidity(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	var calendar []time.Time
+	for i := 0; i < 6; i++ {
+		calendar = append(calendar, day.AddDate(0, 0, i))
+	}
+	bar := func(offset int, volume int64, traded bool) Bar {
+		return Bar{Date: day.AddDate(0, 0, offset), Close: 1, Volume: volume, Value: float64(volume) * 2, Shares: 1000, Traded: traded}
+	}
+	// Listed on the third session, no bar on the fifth, forward-filled on the last
+	bars := []Bar{bar(2, 100, true), bar(3, 50, true), bar(5, 0, false)}
+
+	l := ComputeLiquidity(bars, calendar, 5)
+	if l.Sessions != 4 || l.TradingDays != 2 || !near(l.AvgDailyValue, 75) || !near(l.ZeroVolumeRatio, 0.5) || !near(l.Turnover, 15) {
+		t.Errorf("liquidity: %+v", l)
+	}
+	if l := ComputeLiquidity(bars, calendar, 2); l.Sessions != 2 || l.TradingDays != 0 || l.ZeroVolumeRatio != 1 {
+		t.Errorf("short window: %+v", l)
+	}
+
+	unknown := ComputeLiquidity([]Bar{{Date: day, Volume: 10, Traded: true}}, calendar[:1], 20)
+	header := append([]string{"Ticker"}, append(LiquidityNames(5), LiquidityNames(20)...)...)
+	record := append([]string{"BBOB"}, append(l.Cells(), unknown.Cells()...)...)
+	parsed := ParseLiquidity(header, record)
+	if len(parsed) != 2 || parsed[0] != l || parsed[1].Window != 20 || parsed[1].Sessions != 1 || !math.IsNaN(parsed[1].Turnover) {
+		t.Errorf("parsed: %+v", parsed)
+	}
+}
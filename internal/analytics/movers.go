@@ -0,0 +1,156 @@
+package analytics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Mover is one ticker's session in the top movers report
+type Mover struct {
+	Ticker        string  `json:"ticker"`
+	CompanyName   string  `json:"company_name"`
+	Close         float64 `json:"close"`
+	ChangePercent float64 `json:"change_percent"` // against the previous close
+	Volume        int64   `json:"volume"`
+	Value         float64 `json:"value"`
+}
+
+// MoversReport lists the top movers of one session
+type MoversReport struct {
+	Date     string  `json:"date"` // YYYY-MM-DD
+	Gainers  []Mover `json:"gainers"`
+	Losers   []Mover `json:"losers"`
+	ByVolume []Mover `json:"most_active_by_volume"`
+	ByValue  []Mover `json:"most_active_by_value"`
+}
+
+// TopMovers ranks the tickers traded in the last session of series, keeping count in each list.
+// Ties are broken by ticker.
+func TopMovers(series map[string]*TickerSeries, count int) MoversReport {
+	var last time.Time
+	for _, s := range series {
+		for i := len(s.Bars) - 1; i >= 0; i-- {
+			if s.Bars[i].Traded {
+				if s.Bars[i].Date.After(last) {
+					last = s.Bars[i].Date
+				}
+				break
+			}
+		}
+	}
+	report := MoversReport{Gainers: []Mover{}, Losers: []Mover{}, ByVolume: []Mover{}, ByValue: []Mover{}}
+	if last.IsZero() {
+		return report
+	}
+	report.Date = last.Format("2006-01-02")
+
+	var movers []Mover
+	for ticker, s := range series {
+		for i := len(s.Bars) - 1; i >= 0; i-- {
+			bar := s.Bars[i]
+			if bar.Date.Before(last) {
+				break
+			}
+			if !bar.Date.Equal(last) || !bar.Traded {
+				continue
+			}
+			m := Mover{Ticker: ticker, CompanyName: s.CompanyName, Close: bar.Close, Volume: bar.Volume, Value: bar.Value}
+			if i > 0 && s.Bars[i-1].Close > 0 {
+				m.ChangePercent = (bar.Close/s.Bars[i-1].Close - 1) * 100
+			}
+			movers = append(movers, m)
+		}
+	}
+
+	top := func(keep func(Mover) bool, before func(a, b Mover) bool) []Mover {
+		list := []Mover{}
+		for _, m := range movers {
+			if keep(m) {
+				list = append(list, m)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if before(list[i], list[j]) {
+				return true
+			}
+			if before(list[j], list[i]) {
+				return false
+			}
+			return list[i].Ticker < list[j].Ticker
+		})
+		if len(list) > count {
+			list = list[:count]
+		}
+		return list
+	}
+	report.Gainers = top(func(m Mover) bool { return m.ChangePercent > 0 },
+		func(a, b Mover) bool { return a.ChangePercent > b.ChangePercent })
+	report.Losers = top(func(m Mover) bool { return m.ChangePercent < 0 },
+		func(a, b Mover) bool { return a.ChangePercent < b.ChangePercent })
+	report.ByVolume = top(func(m Mover) bool { return m.Volume > 0 },
+		func(a, b Mover) bool { return a.Volume > b.Volume })
+	report.ByValue = top(func(m Mover) bool { return m.Value > 0 },
+		func(a, b Mover) bool { return a.Value > b.Value })
+	return report
+}
+
+// moversRows formats top_movers_<date>.csv, one row per ranked ticker of each list
+func moversRows(report MoversReport) [][]string {
+	rows := [][]string{{"Category", "Rank", "Ticker", "CompanyName", "Close", "ChangePercent", "Volume", "Value"}}
+	lists := []struct {
+		category string
+		movers   []Mover
+	}{
+		{"gainer", report.Gainers},
+		{"loser", report.Losers},
+		{"volume", report.ByVolume},
+		{"value", report.ByValue},
+	}
+	for _, list := range lists {
+		for i, m := range list.movers {
+			rows = append(rows, []string{
+				list.category,
+				fmt.Sprintf("%d", i+1),
+				m.Ticker,
+				m.CompanyName,
+				fmt.Sprintf("%.3f", m.Close),
+				fmt.Sprintf("%.2f", m.ChangePercent),
+				fmt.Sprintf("%d", m.Volume),
+				fmt.Sprintf("%.2f", m.Value),
+			})
+		}
+	}
+	return rows
+}
+
+// MoversFile returns the top_movers_<date>.json of dir, or the latest one when date is empty
+func MoversFile(dir, date string) (string, error) {
+	return datedFile(dir, "top_movers_", date)
+}
+
+// datedFile returns the <prefix><date>.json of dir, or the latest one when date is empty
+func datedFile(dir, prefix, date string) (string, error) {
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return "", fmt.Errorf("invalid date %q (want YYYY-MM-DD)", date)
+		}
+		path := filepath.Join(dir, prefix+date+".json")
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, prefix+"*.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", os.ErrNotExist
+	}
+	// The dates in the names sort chronologically
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestTopMovers ranks the tickers traded in the last session, skipping forward-filled ones, and
+// finds the report file written for it
+func TestTopMovers(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	bar := func(offset int, close float64, volume int64, traded bool) Bar {
+		return Bar{Date: day.AddDate(0, 0, offset), Close: close, Volume: volume, Value: close * float64(volume), Traded: traded}
+	}
+	series := map[string]*TickerSeries{
+		"BBOB": {Ticker: "BBOB", Bars: []Bar{bar(-1, 10, 100, true), bar(0, 11, 100, true)}},
+		"IBSD": {Ticker: "IBSD", Bars: []Bar{bar(-1, 4, 100, true), bar(0, 3, 1000, true)}},
+		"TASC": {Ticker: "TASC", Bars: []Bar{bar(-1, 5, 100, true), bar(0, 5, 0, false)}},
+	}
+
+	report := TopMovers(series, 1)
+	if report.Date != "2025-03-02" {
+		t.Fatalf("date: %s", report.Date)
+	}
+	if len(report.Gainers) != 1 || report.Gainers[0].Ticker != "BBOB" || !near(report.Gainers[0].ChangePercent, 10) {
+		t.Errorf("gainers: %+v", report.Gainers)
+	}
+	if len(report.Losers) != 1 || report.Losers[0].Ticker != "IBSD" || !near(report.Losers[0].ChangePercent, -25) {
+		t.Errorf("losers: %+v", report.Losers)
+	}
+	if report.ByVolume[0].Ticker != "IBSD" || report.ByValue[0].Ticker != "IBSD" {
+		t.Errorf("most active: %+v %+v", report.ByVolume, report.ByValue)
+	}
+
+	dir := t.TempDir()
+	g := &SummaryGenerator{MoversDir: dir}
+	if err := g.writeMovers(report); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "top_movers_2025-03-01.json"), []byte("{}"), 0644)
+	if path, err := MoversFile(dir, ""); err != nil || filepath.Base(path) != "top_movers_2025-03-02.json" {
+		t.Errorf("latest report: %s %v", path, err)
+	}
+	if _, err := MoversFile(dir, "2025-02-30"); err == nil {
+		t.Error("invalid date accepted")
+	}
+}
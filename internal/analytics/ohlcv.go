@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Candle resolutions
+const (
+	ResolutionDaily   = "daily"
+	ResolutionWeekly  = "weekly"  // weeks starting on Sunday, the first trading day of the ISX week
+	ResolutionMonthly = "monthly" // calendar months
+)
+
+// Candles returns the daily candles of the traded bars, in date order, as the
+// [timestamp, open, high, low, close, volume] arrays charting libraries take, with the timestamp
+// in milliseconds since the epoch. Bars without intraday prices range from their close.
+func Candles(bars []Bar) [][]float64 {
+	candles := [][]float64{}
+	for _, b := range bars {
+		if !b.Traded || b.Close <= 0 {
+			continue
+		}
+		open, high, low := b.Open, b.High, b.Low
+		if open == 0 {
+			open = b.Close
+		}
+		if high == 0 {
+			high = b.Close
+		}
+		if low == 0 {
+			low = b.Close
+		}
+		candles = append(candles, []float64{float64(b.Date.UnixMilli()), open, high, low, b.Close, float64(b.Volume)})
+	}
+	return candles
+}
+
+// ResampleCandles aggregates daily candles, in time order, to resolution: each period opens at its
+// first open, closes at its last close and is stamped with its first day
+func ResampleCandles(candles [][]float64, resolution string) ([][]float64, error) {
+	period, err := resolutionPeriod(resolution)
+	if err != nil {
+		return nil, err
+	}
+	if period == nil {
+		return candles, nil
+	}
+
+	resampled := [][]float64{}
+	var last []float64
+	for _, c := range candles {
+		start := float64(period(time.UnixMilli(int64(c[0])).UTC()).UnixMilli())
+		if last == nil || last[0] != start {
+			last = []float64{start, c[1], c[2], c[3], c[4], c[5]}
+			resampled = append(resampled, last)
+			continue
+		}
+		last[2], last[3] = math.Max(last[2], c[2]), math.Min(last[3], c[3])
+		last[4] = c[4]
+		last[5] += c[5]
+	}
+	return resampled, nil
+}
+
+// resolutionPeriod returns the func returning the first day of the period of a day at
+// resolution, nil for daily
+func resolutionPeriod(resolution string) (func(time.Time) time.Time, error) {
+	switch resolution {
+	case "", ResolutionDaily:
+		return nil, nil
+	case ResolutionWeekly:
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, -int(t.Weekday())) }, nil
+	case ResolutionMonthly:
+		return func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC) }, nil
+	}
+	return nil, fmt.Errorf("unknown resolution %q (want daily, weekly or monthly)", resolution)
+}
+
+// CandlesFile returns the path of the daily candles of ticker in dir
+func CandlesFile(dir, ticker string) string {
+	return filepath.Join(dir, ticker+"_ohlcv.json")
+}
+
+// LoadCandles reads the candles of a <TICKER>_ohlcv.json
+func LoadCandles(path string) ([][]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var candles [][]float64
+	if err := json.Unmarshal(data, &candles); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return candles, nil
+}
+
+// writeCandles writes candles as a JSON array of arrays
+func writeCandles(path string, candles [][]float64) error {
+	return writeFile(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(candles)
+	})
+}
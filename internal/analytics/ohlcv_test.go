@@ -0,0 +1,59 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCandles skips forward-filled bars, fills missing intraday prices from the close and
+// aggregates weeks starting on Sunday
+func TestCandles(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC) // a Sunday
+	bars := []Bar{
+		{Date: day, Open: 10, High: 12, Low: 9, Close: 11, Volume: 100, Traded: true},
+		{Date: day.AddDate(0, 0, 1), Close: 13, Volume: 50, Traded: true},
+		{Date: day.AddDate(0, 0, 2), Close: 13, Traded: false},
+		{Date: day.AddDate(0, 0, 7), Open: 12, High: 12, Low: 8, Close: 8.5, Volume: 10, Traded: true},
+	}
+
+	candles := Candles(bars)
+	if len(candles) != 3 || candles[0][0] != float64(day.UnixMilli()) || candles[1][1] != 13 || candles[1][3] != 13 {
+		t.Fatalf("candles: %v", candles)
+	}
+
+	path := CandlesFile(t.TempDir(), "BBOB")
+	if err := writeCandles(path, candles); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCandles(path)
+	if err != nil || len(loaded) != 3 || filepath.Base(path) != "BBOB_ohlcv.json" {
+		t.Fatalf("loaded: %v %v", loaded, err)
+	}
+
+	weekly, err := ResampleCandles(loaded, ResolutionWeekly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{
+		{float64(day.UnixMilli()), 10, 13, 9, 13, 150},
+		{float64(day.AddDate(0, 0, 7).UnixMilli()), 12, 12, 8, 8.5, 10},
+	}
+	if len(weekly) != len(want) {
+		t.Fatalf("weekly: %v", weekly)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if weekly[i][j] != want[i][j] {
+				t.Errorf("weekly[%d]: got %v, want %v", i, weekly[i], want[i])
+				break
+			}
+		}
+	}
+	if monthly, _ := ResampleCandles(loaded, ResolutionMonthly); len(monthly) != 1 || monthly[0][5] != 160 {
+		t.Errorf("monthly: %v", monthly)
+	}
+	if _, err := ResampleCandles(loaded, "hourly"); err == nil {
+		t.Error("unknown resolution accepted")
+	}
+}
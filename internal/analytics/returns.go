@@ -0,0 +1,192 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ReturnNames are the columns of a set of returns, in the order of ReturnSet.Values
+var ReturnNames = []string{"Daily", "Weekly", "Monthly", "YTD", "SinceInception"}
+
+// ReturnSet holds the trailing returns of one close in percent, NaN where there is no earlier
+// close to measure from
+type ReturnSet struct {
+	Daily          float64 // against the previous bar
+	Weekly         float64 // against the last close at least 7 days earlier
+	Monthly        float64 // against the last close at least a calendar month earlier
+	YTD            float64 // against the last close of the previous year, or the first of this one
+	SinceInception float64 // against the first close
+}
+
+// Values returns the returns in the order of ReturnNames
+func (r ReturnSet) Values() []float64 {
+	return []float64{r.Daily, r.Weekly, r.Monthly, r.YTD, r.SinceInception}
+}
+
+// MarshalJSON encodes the returns with snake_case names and NaN as null
+func (r ReturnSet) MarshalJSON() ([]byte, error) {
+	number := func(v float64) *float64 {
+		if math.IsNaN(v) {
+			return nil
+		}
+		v = math.Round(v*10000) / 10000
+		return &v
+	}
+	return json.Marshal(struct {
+		Daily          *float64 `json:"daily"`
+		Weekly         *float64 `json:"weekly"`
+		Monthly        *float64 `json:"monthly"`
+		YTD            *float64 `json:"ytd"`
+		SinceInception *float64 `json:"since_inception"`
+	}{number(r.Daily), number(r.Weekly), number(r.Monthly), number(r.YTD), number(r.SinceInception)})
+}
+
+// ReturnPoint holds the returns of one bar from the close and, when the bars have one, the
+// adjusted close
+type ReturnPoint struct {
+	Date     time.Time `json:"-"`
+	Close    float64   `json:"close"`
+	Returns  ReturnSet `json:"returns"`
+	AdjClose float64   `json:"adj_close,omitempty"` // 0 without an adjusted close
+	Adjusted ReturnSet `json:"adjusted"`            // NaN without adjusted closes
+}
+
+// MarshalJSON encodes the point with the date as YYYY-MM-DD
+func (p ReturnPoint) MarshalJSON() ([]byte, error) {
+	type point ReturnPoint
+	return json.Marshal(struct {
+		Date string `json:"date"`
+		point
+	}{p.Date.Format("2006-01-02"), point(p)})
+}
+
+// Returns returns the return series of bars, which are in date order
+func Returns(bars []Bar) []ReturnPoint {
+	dates := make([]time.Time, len(bars))
+	closes, adjusted := make([]float64, len(bars)), make([]float64, len(bars))
+	for i, b := range bars {
+		dates[i], closes[i], adjusted[i] = b.Date, b.Close, b.AdjClose
+	}
+	plain, adj := trailingReturns(dates, closes), trailingReturns(dates, adjusted)
+
+	points := make([]ReturnPoint, len(bars))
+	for i, b := range bars {
+		points[i] = ReturnPoint{Date: b.Date, Close: b.Close, Returns: plain[i], AdjClose: b.AdjClose, Adjusted: adj[i]}
+	}
+	return points
+}
+
+// trailingReturns returns the returns of every price against the earlier prices of dates. A
+// return is NaN when either price is missing.
+func trailingReturns(dates []time.Time, prices []float64) []ReturnSet {
+	// before returns the index of the last date on or before t, or -1
+	before := func(t time.Time) int {
+		return sort.Search(len(dates), func(i int) bool { return dates[i].After(t) }) - 1
+	}
+	change := func(i, base int) float64 {
+		if base < 0 || base >= i || prices[base] <= 0 || prices[i] <= 0 {
+			return math.NaN()
+		}
+		return (prices[i]/prices[base] - 1) * 100
+	}
+
+	sets := make([]ReturnSet, len(prices))
+	for i, date := range dates {
+		yearStart := before(time.Date(date.Year(), 1, 1, 0, 0, 0, 0, date.Location()).AddDate(0, 0, -1))
+		if yearStart < 0 {
+			yearStart = 0 // listed this year
+		}
+		sets[i] = ReturnSet{
+			Daily:          change(i, i-1),
+			Weekly:         change(i, before(date.AddDate(0, 0, -7))),
+			Monthly:        change(i, before(date.AddDate(0, -1, 0))),
+			YTD:            change(i, yearStart),
+			SinceInception: change(i, 0),
+		}
+	}
+	return sets
+}
+
+// returnsHeader is the header of <TICKER>_returns.csv
+var returnsHeader = func() []string {
+	header := []string{"Date", "ClosePrice"}
+	header = append(header, ReturnNames...)
+	header = append(header, "AdjClosePrice")
+	for _, name := range ReturnNames {
+		header = append(header, "Adj"+name)
+	}
+	return header
+}()
+
+// ReturnsFile returns the path of the return series of ticker in dir
+func ReturnsFile(dir, ticker string) string {
+	return filepath.Join(dir, ticker+"_returns.csv")
+}
+
+// returnRows formats <TICKER>_returns.csv
+func returnRows(points []ReturnPoint) [][]string {
+	rows := [][]string{returnsHeader}
+	for _, p := range points {
+		row := []string{p.Date.Format("2006-01-02"), fmt.Sprintf("%.3f", p.Close)}
+		for _, v := range p.Returns.Values() {
+			row = append(row, FormatValue(v, 4))
+		}
+		adjClose := ""
+		if p.AdjClose > 0 {
+			adjClose = fmt.Sprintf("%.3f", p.AdjClose)
+		}
+		row = append(row, adjClose)
+		for _, v := range p.Adjusted.Values() {
+			row = append(row, FormatValue(v, 4))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// LoadReturns reads a <TICKER>_returns.csv back. Empty returns are NaN.
+func LoadReturns(path string) ([]ReturnPoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	float := func(cell string) float64 {
+		if cell == "" {
+			return math.NaN()
+		}
+		v, _ := strconv.ParseFloat(cell, 64)
+		return v
+	}
+	set := func(cells []string) ReturnSet {
+		return ReturnSet{float(cells[0]), float(cells[1]), float(cells[2]), float(cells[3]), float(cells[4])}
+	}
+	n := len(ReturnNames)
+	points := []ReturnPoint{}
+	for i, row := range rows {
+		if i == 0 || len(row) < len(returnsHeader) {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			continue
+		}
+		p := ReturnPoint{Date: date, Returns: set(row[2 : 2+n]), Adjusted: set(row[3+n : 3+2*n])}
+		p.Close, _ = strconv.ParseFloat(row[1], 64)
+		p.AdjClose, _ = strconv.ParseFloat(row[2+n], 64)
+		points = append(points, p)
+	}
+	return points, nil
+}
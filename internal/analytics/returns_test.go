@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReturns measures each trailing return from the right earlier close, leaves the adjusted
+// returns empty without adjusted closes and round-trips <TICKER>_returns.csv
+func TestReturns(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	bars := []Bar{
+		{Date: date(2024, 12, 30), Close: 10, AdjClose: 5},
+		{Date: date(2025, 1, 2), Close: 11, AdjClose: 5.5},
+		{Date: date(2025, 1, 6), Close: 12},
+		{Date: date(2025, 2, 3), Close: 15},
+	}
+
+	points := Returns(bars)
+	last := points[3].Returns
+	// Weekly measures from Jan 6, the last close a week before Feb 3; monthly from Jan 2
+	if !near(last.Daily, 25) || !near(last.Weekly, 25) || !near(last.Monthly, 100*(15.0/11-1)) ||
+		!near(last.YTD, 50) || !near(last.SinceInception, 50) {
+		t.Errorf("returns: %+v", last)
+	}
+	if first := points[0].Returns; !math.IsNaN(first.Daily) || !math.IsNaN(first.SinceInception) {
+		t.Errorf("first returns: %+v", first)
+	}
+	if !near(points[1].Adjusted.Daily, 10) || !math.IsNaN(points[2].Adjusted.Daily) {
+		t.Errorf("adjusted: %+v %+v", points[1].Adjusted, points[2].Adjusted)
+	}
+
+	path := ReturnsFile(t.TempDir(), "BBOB")
+	if filepath.Base(path) != "BBOB_returns.csv" {
+		t.Errorf("returns file: %s", path)
+	}
+	if err := writeCSV(path, returnRows(points)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReturns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 4 || !loaded[3].Date.Equal(bars[3].Date) || math.Abs(loaded[3].Returns.Monthly-last.Monthly) > 1e-4 {
+		t.Errorf("loaded: %+v", loaded)
+	}
+	data, err := json.Marshal(loaded[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"date":"2024-12-30"`) || !strings.Contains(string(data), `"daily":null`) {
+		t.Errorf("json: %s", data)
+	}
+}
@@ -0,0 +1,241 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unclassifiedSector groups tickers the reports and company master list give no sector
+const unclassifiedSector = "Unclassified"
+
+// sectorIndexBase is the level the sector indices start from
+const sectorIndexBase = 1000
+
+// SectorDay aggregates the tickers of a sector on one date. Returns are NaN on a sector's first
+// date, and the cap-weighted one also when no market caps are known.
+type SectorDay struct {
+	Date                time.Time
+	Sector              string
+	Tickers             int     // tickers with a price on the date
+	Traded              int     // of which actually traded
+	CapWeightedReturn   float64 // percent, weighted by the previous market cap
+	EqualWeightedReturn float64 // percent
+	CapWeightedIndex    float64 // starts at 1000, compounding the returns
+	EqualWeightedIndex  float64
+	Volume              int64
+	Value               float64
+	MarketCap           float64
+}
+
+// MarshalJSON encodes the day with snake_case names, the date as YYYY-MM-DD and NaN returns
+// as null
+func (d SectorDay) MarshalJSON() ([]byte, error) {
+	number := func(v float64) *float64 {
+		if math.IsNaN(v) {
+			return nil
+		}
+		return &v
+	}
+	return json.Marshal(struct {
+		Date                string   `json:"date"`
+		Sector              string   `json:"sector"`
+		Tickers             int      `json:"tickers"`
+		Traded              int      `json:"traded"`
+		CapWeightedReturn   *float64 `json:"cap_weighted_return"`
+		EqualWeightedReturn *float64 `json:"equal_weighted_return"`
+		CapWeightedIndex    *float64 `json:"cap_weighted_index"`
+		EqualWeightedIndex  *float64 `json:"equal_weighted_index"`
+		Volume              int64    `json:"volume"`
+		Value               float64  `json:"value"`
+		MarketCap           float64  `json:"market_cap"`
+	}{
+		d.Date.Format("2006-01-02"), d.Sector, d.Tickers, d.Traded,
+		number(d.CapWeightedReturn), number(d.EqualWeightedReturn),
+		number(d.CapWeightedIndex), number(d.EqualWeightedIndex),
+		d.Volume, d.Value, d.MarketCap,
+	})
+}
+
+// sectorHeader is the header of sector_summary.csv
+var sectorHeader = []string{
+	"Date", "Sector", "Tickers", "Traded", "CapWeightedReturn", "EqualWeightedReturn",
+	"CapWeightedIndex", "EqualWeightedIndex", "Volume", "Value", "MarketCap",
+}
+
+// SectorSummary aggregates the tickers of series by sector and date, sorted by date then sector.
+// A ticker's daily return is its close against its previous bar.
+func SectorSummary(series map[string]*TickerSeries) []SectorDay {
+	type key struct {
+		date   time.Time
+		sector string
+	}
+	type sums struct {
+		day                SectorDay
+		capReturn, prevCap float64
+		equalReturn        float64
+		withReturn         int
+	}
+	bySector := make(map[key]*sums)
+	for _, s := range series {
+		sector := s.Sector
+		if sector == "" {
+			sector = unclassifiedSector
+		}
+		for i, bar := range s.Bars {
+			k := key{bar.Date, sector}
+			agg, ok := bySector[k]
+			if !ok {
+				agg = &sums{day: SectorDay{Date: bar.Date, Sector: sector}}
+				bySector[k] = agg
+			}
+			agg.day.Tickers++
+			if bar.Traded {
+				agg.day.Traded++
+			}
+			agg.day.Volume += bar.Volume
+			agg.day.Value += bar.Value
+			agg.day.MarketCap += bar.MarketCap
+
+			if i == 0 || s.Bars[i-1].Close <= 0 {
+				continue
+			}
+			prev := s.Bars[i-1]
+			r := bar.Close/prev.Close - 1
+			agg.equalReturn += r
+			agg.withReturn++
+			if prev.MarketCap > 0 {
+				agg.capReturn += r * prev.MarketCap
+				agg.prevCap += prev.MarketCap
+			}
+		}
+	}
+
+	days := make([]SectorDay, 0, len(bySector))
+	for _, agg := range bySector {
+		day := agg.day
+		day.EqualWeightedReturn, day.CapWeightedReturn = math.NaN(), math.NaN()
+		if agg.withReturn > 0 {
+			day.EqualWeightedReturn = agg.equalReturn / float64(agg.withReturn) * 100
+		}
+		if agg.prevCap > 0 {
+			day.CapWeightedReturn = agg.capReturn / agg.prevCap * 100
+		}
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if !days[i].Date.Equal(days[j].Date) {
+			return days[i].Date.Before(days[j].Date)
+		}
+		return days[i].Sector < days[j].Sector
+	})
+
+	// Compound the returns into index levels per sector
+	capLevel, equalLevel := make(map[string]float64), make(map[string]float64)
+	for i := range days {
+		d := &days[i]
+		if _, ok := capLevel[d.Sector]; !ok {
+			capLevel[d.Sector], equalLevel[d.Sector] = sectorIndexBase, sectorIndexBase
+		}
+		if !math.IsNaN(d.CapWeightedReturn) {
+			capLevel[d.Sector] *= 1 + d.CapWeightedReturn/100
+		}
+		if !math.IsNaN(d.EqualWeightedReturn) {
+			equalLevel[d.Sector] *= 1 + d.EqualWeightedReturn/100
+		}
+		d.CapWeightedIndex, d.EqualWeightedIndex = capLevel[d.Sector], equalLevel[d.Sector]
+	}
+	return days
+}
+
+// sectorRows formats sector_summary.csv
+func sectorRows(days []SectorDay) [][]string {
+	rows := [][]string{sectorHeader}
+	for _, d := range days {
+		rows = append(rows, []string{
+			d.Date.Format("2006-01-02"),
+			d.Sector,
+			strconv.Itoa(d.Tickers),
+			strconv.Itoa(d.Traded),
+			FormatValue(d.CapWeightedReturn, 4),
+			FormatValue(d.EqualWeightedReturn, 4),
+			FormatValue(d.CapWeightedIndex, 3),
+			FormatValue(d.EqualWeightedIndex, 3),
+			strconv.FormatInt(d.Volume, 10),
+			fmt.Sprintf("%.2f", d.Value),
+			fmt.Sprintf("%.2f", d.MarketCap),
+		})
+	}
+	return rows
+}
+
+// LoadSectorSummary reads sector_summary.csv back. Empty returns are NaN.
+func LoadSectorSummary(path string) ([]SectorDay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	float := func(cell string) float64 {
+		if cell == "" {
+			return math.NaN()
+		}
+		v, _ := strconv.ParseFloat(cell, 64)
+		return v
+	}
+	var days []SectorDay
+	for i, row := range rows {
+		if i == 0 || len(row) < len(sectorHeader) {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			continue
+		}
+		d := SectorDay{Date: date, Sector: row[1]}
+		d.Tickers, _ = strconv.Atoi(row[2])
+		d.Traded, _ = strconv.Atoi(row[3])
+		d.CapWeightedReturn, d.EqualWeightedReturn = float(row[4]), float(row[5])
+		d.CapWeightedIndex, d.EqualWeightedIndex = float(row[6]), float(row[7])
+		d.Volume, _ = strconv.ParseInt(row[8], 10, 64)
+		d.Value, _ = strconv.ParseFloat(row[9], 64)
+		d.MarketCap, _ = strconv.ParseFloat(row[10], 64)
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// FilterSectors returns the days of sector, or every sector on the latest date when sector is
+// empty. days must be sorted by date.
+func FilterSectors(days []SectorDay, sector string) []SectorDay {
+	out := []SectorDay{}
+	if sector == "" {
+		if len(days) == 0 {
+			return out
+		}
+		latest := days[len(days)-1].Date
+		for _, d := range days {
+			if d.Date.Equal(latest) {
+				out = append(out, d)
+			}
+		}
+		return out
+	}
+	for _, d := range days {
+		if strings.EqualFold(d.Sector, sector) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
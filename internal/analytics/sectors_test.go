@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSectorSummary weights the returns of a sector by the previous market cap and equally,
+// compounds them into indices and reads them back from sector_summary.csv
+func TestSectorSummary(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	bar := func(offset int, close, marketCap float64) Bar {
+		return Bar{Date: day.AddDate(0, 0, offset), Close: close, Volume: 10, MarketCap: marketCap, Traded: true}
+	}
+	series := map[string]*TickerSeries{
+		"BBOB": {Ticker: "BBOB", Sector: "Banks", Bars: []Bar{bar(0, 10, 300), bar(1, 11, 330)}},
+		"BGUC": {Ticker: "BGUC", Sector: "Banks", Bars: []Bar{bar(0, 4, 100), bar(1, 3, 75)}},
+		"TASC": {Ticker: "TASC", Bars: []Bar{bar(0, 5, 0), bar(1, 5, 0)}},
+	}
+
+	days := SectorSummary(series)
+	if len(days) != 4 {
+		t.Fatalf("days: %+v", days)
+	}
+	first, banks := days[0], days[2]
+	if first.Sector != "Banks" || !math.IsNaN(first.EqualWeightedReturn) || first.CapWeightedIndex != sectorIndexBase {
+		t.Errorf("first day: %+v", first)
+	}
+	// BBOB +10% on a cap of 300, BGUC -25% on 100
+	if banks.Tickers != 2 || banks.Volume != 20 || banks.MarketCap != 405 ||
+		!near(banks.CapWeightedReturn, 1.25) || !near(banks.EqualWeightedReturn, -7.5) ||
+		!near(banks.CapWeightedIndex, 1012.5) || !near(banks.EqualWeightedIndex, 925) {
+		t.Errorf("banks: %+v", banks)
+	}
+	if other := days[3]; other.Sector != unclassifiedSector || !math.IsNaN(other.CapWeightedReturn) || other.EqualWeightedReturn != 0 {
+		t.Errorf("unclassified: %+v", other)
+	}
+
+	path := filepath.Join(t.TempDir(), "sector_summary.csv")
+	if err := writeCSV(path, sectorRows(days)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSectorSummary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := FilterSectors(loaded, "")
+	if len(latest) != 2 || !near(latest[0].CapWeightedIndex, 1012.5) || !math.IsNaN(latest[1].CapWeightedReturn) {
+		t.Errorf("latest: %+v", latest)
+	}
+	if banks := FilterSectors(loaded, "banks"); len(banks) != 2 {
+		t.Errorf("banks series: %+v", banks)
+	}
+}
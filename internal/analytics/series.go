@@ -0,0 +1,239 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"isxcli/internal/csvgz"
+)
+
+// Bar is one priced day of a ticker
+type Bar struct {
+	Date      time.Time
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	AdjClose  float64 // close adjusted for corporate actions; 0 when not in the file
+	Volume    int64
+	Value     float64
+	MarketCap float64
+	Shares    float64 // shares outstanding
+	Traded    bool    // false for forward-filled days
+}
+
+// TickerSeries is the priced history of one ticker in date order
+type TickerSeries struct {
+	Ticker        string
+	CompanyName   string // name on the last bar
+	CompanyNameAr string
+	Sector        string // sector on the last bar
+	Bars          []Bar
+}
+
+// Closes returns the closes of the bars
+func (s *TickerSeries) Closes() []float64 {
+	closes := make([]float64, len(s.Bars))
+	for i, b := range s.Bars {
+		closes[i] = b.Close
+	}
+	return closes
+}
+
+// Volumes returns the volumes of the bars
+func (s *TickerSeries) Volumes() []float64 {
+	volumes := make([]float64, len(s.Bars))
+	for i, b := range s.Bars {
+		volumes[i] = float64(b.Volume)
+	}
+	return volumes
+}
+
+// Values returns the traded values of the bars
+func (s *TickerSeries) Values() []float64 {
+	values := make([]float64, len(s.Bars))
+	for i, b := range s.Bars {
+		values[i] = b.Value
+	}
+	return values
+}
+
+// seriesColumns are the header names the combined CSV columns are recognised by, lowercased, as
+// written with or without a snake_case column profile
+var seriesColumns = map[string][]string{
+	"ticker":          {"ticker", "company_symbol", "symbol"},
+	"company_name":    {"company_name", "companyname", "company", "name"},
+	"company_name_ar": {"company_name_ar", "companynamear"},
+	"date":            {"date"},
+	"open":            {"open_price", "openprice", "open"},
+	"high":            {"high_price", "highprice", "high"},
+	"low":             {"low_price", "lowprice", "low"},
+	"close":           {"close_price", "closeprice", "close"},
+	"adj_close":       {"adj_close_price", "adjcloseprice"},
+	"volume":          {"volume"},
+	"value":           {"value"},
+	"traded":          {"trading_status", "tradingstatus"},
+	"sector":          {"sector"},
+	"market_cap":      {"market_cap", "marketcap"},
+	"shares":          {"shares_outstanding", "sharesoutstanding"},
+}
+
+// LoadSeries reads the priced rows of a combined CSV, compressed or not, into a series per
+// ticker. Rows filled without prices are left out. The file is read a row at a time, so its text
+// is never held whole, but every priced bar is: memory grows with the length of the history, at
+// about 100 bytes per ticker and trading day.
+func LoadSeries(combinedPath string) (map[string]*TickerSeries, error) {
+	series := make(map[string]*TickerSeries)
+	if err := scanSeries(combinedPath, func(row seriesRow) { addRow(series, row) }); err != nil {
+		return nil, err
+	}
+	sortSeries(series)
+	return series, nil
+}
+
+// seriesRow is a priced row of the combined CSV. Its strings share the memory of the row read.
+type seriesRow struct {
+	Ticker        string
+	CompanyName   string
+	CompanyNameAr string
+	Sector        string
+	Bar           Bar
+}
+
+// addRow appends the bar of row to the series of its ticker, which keeps the names and sector of
+// the last row
+func addRow(series map[string]*TickerSeries, row seriesRow) {
+	// Cells share the memory of their whole row, so the strings kept are copied
+	s, ok := series[row.Ticker]
+	if !ok {
+		ticker := strings.Clone(row.Ticker)
+		s = &TickerSeries{Ticker: ticker}
+		series[ticker] = s
+	}
+	if row.CompanyName != s.CompanyName {
+		s.CompanyName = strings.Clone(row.CompanyName)
+	}
+	if row.CompanyNameAr != s.CompanyNameAr {
+		s.CompanyNameAr = strings.Clone(row.CompanyNameAr)
+	}
+	if row.Sector != "" && row.Sector != s.Sector {
+		s.Sector = strings.Clone(row.Sector)
+	}
+	s.Bars = append(s.Bars, row.Bar)
+}
+
+// sortSeries puts the bars of every series in date order, keeping the file order of a date
+func sortSeries(series map[string]*TickerSeries) {
+	for _, s := range series {
+		sort.SliceStable(s.Bars, func(i, j int) bool { return s.Bars[i].Date.Before(s.Bars[j].Date) })
+	}
+}
+
+// scanSeries reads the priced rows of a combined CSV, compressed or not, a row at a time, calling
+// fn with each in file order. Rows filled without prices are left out.
+func scanSeries(combinedPath string, fn func(seriesRow)) error {
+	// Check if combined file exists
+	if !csvgz.Exists(combinedPath) {
+		return fmt.Errorf("combined CSV file not found: %s", combinedPath)
+	}
+
+	// Read combined CSV
+	file, err := csvgz.Open(combinedPath)
+	if err != nil {
+		return fmt.Errorf("failed to open combined file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("combined CSV has no data rows")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read combined CSV: %w", err)
+	}
+
+	// Parse header to find column indices
+	col := make(map[string]int)
+	for i, name := range header {
+		for key, names := range seriesColumns {
+			for _, n := range names {
+				if _, ok := col[key]; !ok && strings.ToLower(strings.TrimSpace(name)) == n {
+					col[key] = i
+				}
+			}
+		}
+	}
+	for _, key := range []string{"ticker", "company_name", "date", "close"} {
+		if _, ok := col[key]; !ok {
+			return fmt.Errorf("required columns not found in combined CSV. Found: %v", header)
+		}
+	}
+
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read combined CSV: %w", err)
+		}
+		rows++
+
+		cell := func(key string) string {
+			if i, ok := col[key]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		float := func(key string) float64 {
+			v, _ := strconv.ParseFloat(cell(key), 64)
+			return v
+		}
+
+		ticker := cell("ticker")
+		if ticker == "" || cell("close") == "" {
+			continue // rows filled without prices say nothing about the price
+		}
+		date, err := time.Parse("2006-01-02", cell("date"))
+		if err != nil {
+			continue
+		}
+
+		bar := Bar{
+			Date:      date,
+			Open:      float("open"),
+			High:      float("high"),
+			Low:       float("low"),
+			Close:     float("close"),
+			AdjClose:  float("adj_close"),
+			Value:     float("value"),
+			MarketCap: float("market_cap"),
+			Shares:    float("shares"),
+		}
+		bar.Volume, _ = strconv.ParseInt(cell("volume"), 10, 64)
+		bar.Traded, err = strconv.ParseBool(cell("traded"))
+		if err != nil {
+			bar.Traded = true // files without the column only held trades
+		}
+		fn(seriesRow{
+			Ticker:        ticker,
+			CompanyName:   cell("company_name"),
+			CompanyNameAr: cell("company_name_ar"),
+			Sector:        cell("sector"),
+			Bar:           bar,
+		})
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("combined CSV has no data rows")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Signal types of the signals report
+const (
+	SignalGoldenCross = "golden_cross"   // SMA50 crossed above SMA200
+	SignalDeathCross  = "death_cross"    // SMA50 crossed below SMA200
+	SignalOverbought  = "rsi_overbought" // RSI14 at or above RSIOverbought
+	SignalOversold    = "rsi_oversold"   // RSI14 at or below RSIOversold
+	SignalNewHigh     = "new_52w_high"   // traded above every close of the previous 52 weeks
+)
+
+// RSI levels of the overbought and oversold signals
+const (
+	RSIOverbought = 70
+	RSIOversold   = 30
+)
+
+// Signal is one ticker flagged in the signals report
+type Signal struct {
+	Ticker      string  `json:"ticker"`
+	CompanyName string  `json:"company_name"`
+	Type        string  `json:"type"`
+	Close       float64 `json:"close"`
+	// Value is the SMA50 of a cross, the RSI14 of an RSI signal and the close of a new high;
+	// Reference what it is compared with: the SMA200, the RSI level or the previous high
+	Value     float64 `json:"value"`
+	Reference float64 `json:"reference"`
+}
+
+// SignalsReport lists the signals of one session, sorted by type then ticker
+type SignalsReport struct {
+	Date    string   `json:"date"` // YYYY-MM-DD
+	Signals []Signal `json:"signals"`
+}
+
+// DetectSignals returns the signals of a ticker on its last bar from the indicators of its bars
+func DetectSignals(s *TickerSeries, indicators []Indicators) []Signal {
+	n := len(s.Bars)
+	if n == 0 || len(indicators) != n {
+		return nil
+	}
+	last, in := s.Bars[n-1], indicators[n-1]
+	signal := func(kind string, value, reference float64) Signal {
+		return Signal{Ticker: s.Ticker, CompanyName: s.CompanyName, Type: kind, Close: last.Close, Value: value, Reference: reference}
+	}
+
+	var signals []Signal
+	if n > 1 {
+		prev := indicators[n-2]
+		if !math.IsNaN(prev.SMA50) && !math.IsNaN(prev.SMA200) && !math.IsNaN(in.SMA50) && !math.IsNaN(in.SMA200) {
+			if prev.SMA50 <= prev.SMA200 && in.SMA50 > in.SMA200 {
+				signals = append(signals, signal(SignalGoldenCross, in.SMA50, in.SMA200))
+			}
+			if prev.SMA50 >= prev.SMA200 && in.SMA50 < in.SMA200 {
+				signals = append(signals, signal(SignalDeathCross, in.SMA50, in.SMA200))
+			}
+		}
+	}
+	switch {
+	case in.RSI14 >= RSIOverbought:
+		signals = append(signals, signal(SignalOverbought, in.RSI14, RSIOverbought))
+	case in.RSI14 <= RSIOversold:
+		signals = append(signals, signal(SignalOversold, in.RSI14, RSIOversold))
+	}
+	if high, ok := previousYearHigh(s.Bars); ok && last.Traded && last.Close > high {
+		signals = append(signals, signal(SignalNewHigh, last.Close, high))
+	}
+	return signals
+}
+
+// previousYearHigh returns the highest close of the 52 weeks before the last of bars, false when
+// none of them has a close
+func previousYearHigh(bars []Bar) (float64, bool) {
+	last := bars[len(bars)-1]
+	from := last.Date.AddDate(0, 0, -52*7)
+	high, ok := 0.0, false
+	for i := len(bars) - 2; i >= 0 && bars[i].Date.After(from); i-- {
+		if c := bars[i].Close; c > 0 && (!ok || c > high) {
+			high, ok = c, true
+		}
+	}
+	return high, ok
+}
+
+// NewSignalsReport returns the report of the session on date with the signals detected on it
+func NewSignalsReport(date time.Time, signals []Signal) SignalsReport {
+	report := SignalsReport{Signals: []Signal{}}
+	if date.IsZero() {
+		return report
+	}
+	report.Date = date.Format("2006-01-02")
+	report.Signals = append(report.Signals, signals...)
+	sort.SliceStable(report.Signals, func(i, j int) bool {
+		a, b := report.Signals[i], report.Signals[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Ticker < b.Ticker
+	})
+	return report
+}
+
+// LastSession returns the date of the latest bar of series
+func LastSession(series map[string]*TickerSeries) time.Time {
+	var last time.Time
+	for _, s := range series {
+		if n := len(s.Bars); n > 0 && s.Bars[n-1].Date.After(last) {
+			last = s.Bars[n-1].Date
+		}
+	}
+	return last
+}
+
+// signalsRows formats signals_<date>.csv
+func signalsRows(report SignalsReport) [][]string {
+	rows := [][]string{{"Date", "Type", "Ticker", "CompanyName", "Close", "Value", "Reference"}}
+	for _, s := range report.Signals {
+		rows = append(rows, []string{
+			report.Date,
+			s.Type,
+			s.Ticker,
+			s.CompanyName,
+			fmt.Sprintf("%.3f", s.Close),
+			fmt.Sprintf("%.3f", s.Value),
+			fmt.Sprintf("%.3f", s.Reference),
+		})
+	}
+	return rows
+}
+
+// SignalsFile returns the signals_<date>.json of dir, or the latest one when date is empty
+func SignalsFile(dir, date string) (string, error) {
+	return datedFile(dir, "signals_", date)
+}
+
+// writeSignals writes the CSV and JSON signals report of its session to dir
+func writeSignals(dir string, report SignalsReport) error {
+	if report.Date == "" {
+		return nil
+	}
+	base := filepath.Join(dir, "signals_"+report.Date)
+	if err := writeCSV(base+".csv", signalsRows(report)); err != nil {
+		return err
+	}
+	return writeFile(base+".json", func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	})
+}
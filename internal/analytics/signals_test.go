@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDetectSignals flags a golden cross, an overbought RSI and a new 52-week high on the last bar,
+// which must have traded for a new high
+func TestDetectSignals(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	var bars []Bar
+	for i := 0; i < 260; i++ {
+		// A long decline then a sharp rally lifts the SMA50 over the SMA200 on the last bar
+		c := 300 - float64(i)
+		if i >= 190 {
+			c = 110 + float64(i-190)*40
+		}
+		bars = append(bars, Bar{Date: day.AddDate(0, 0, i), Close: c, Traded: true})
+	}
+	s := &TickerSeries{Ticker: "BBOB", Bars: bars}
+	closes := s.Closes()
+
+	// Find the bar the cross happens on and stop the series there
+	in := ComputeIndicators(closes, nil, nil)
+	cross := -1
+	for i := 1; i < len(in); i++ {
+		if in[i-1].SMA50 <= in[i-1].SMA200 && in[i].SMA50 > in[i].SMA200 {
+			cross = i
+			break
+		}
+	}
+	if cross < 0 {
+		t.Fatal("no cross in the test series")
+	}
+	s.Bars = bars[:cross+1]
+	signals := DetectSignals(s, in[:cross+1])
+
+	types := make(map[string]Signal)
+	for _, sig := range signals {
+		types[sig.Type] = sig
+	}
+	if _, ok := types[SignalGoldenCross]; !ok {
+		t.Errorf("no golden cross: %+v", signals)
+	}
+	if sig, ok := types[SignalOverbought]; !ok || sig.Reference != RSIOverbought {
+		t.Errorf("no overbought RSI: %+v", signals)
+	}
+	if sig, ok := types[SignalNewHigh]; !ok || sig.Reference != sig.Close-40 {
+		t.Errorf("no new high above the previous close: %+v", signals)
+	}
+
+	// A forward-filled last bar makes no new high
+	high := []Bar{{Date: day, Close: 5, Traded: true}, {Date: day.AddDate(0, 0, 1), Close: 6, Traded: true}}
+	nan := []Indicators{{RSI14: math.NaN()}, {RSI14: math.NaN()}}
+	if got := DetectSignals(&TickerSeries{Ticker: "IBSD", Bars: high}, nan); len(got) != 1 || got[0].Type != SignalNewHigh || got[0].Reference != 5 {
+		t.Errorf("new high: %+v", got)
+	}
+	high[1].Traded = false
+	if got := DetectSignals(&TickerSeries{Ticker: "IBSD", Bars: high}, nan); len(got) != 0 {
+		t.Errorf("forward-filled new high: %+v", got)
+	}
+
+	dir := t.TempDir()
+	report := NewSignalsReport(day, signals)
+	if err := writeSignals(dir, report); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "signals_2025-03-02.csv")); err != nil {
+		t.Error(err)
+	}
+	if path, err := SignalsFile(dir, ""); err != nil || filepath.Base(path) != "signals_2025-03-02.json" {
+		t.Errorf("latest report: %s %v", path, err)
+	}
+}
@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"path/filepath"
+)
+
+// DefaultStatsCandles is the number of recent daily candles in a ticker's stat file
+const DefaultStatsCandles = 30
+
+// TickerStats is the <TICKER>.json stat file of one ticker: its summary, latest indicators and
+// recent candles, small enough for the web frontend to fetch instead of the trading history
+type TickerStats struct {
+	Ticker           string      `json:"ticker"`
+	CompanyName      string      `json:"company_name"`
+	CompanyNameAr    string      `json:"company_name_ar,omitempty"`
+	Sector           string      `json:"sector,omitempty"`
+	LastPrice        float64     `json:"last_price"`
+	LastDate         string      `json:"last_date"`
+	TradingDays      int         `json:"trading_days"`
+	High52W          float64     `json:"high_52w"`
+	Low52W           float64     `json:"low_52w"`
+	PercentOffHigh   float64     `json:"percent_off_high"`
+	Beta             *float64    `json:"beta"`
+	RelativeStrength *float64    `json:"relative_strength"`
+	Indicators       Indicators  `json:"indicators"`
+	Liquidity        []Liquidity `json:"liquidity"`
+	History          History     `json:"history"`
+	// Candles are the recent daily [timestamp, open, high, low, close, volume] arrays, as
+	// served by /api/ticker/{ticker}/ohlcv
+	Candles [][]float64 `json:"candles"`
+}
+
+// NewTickerStats returns the stat file of a summarised ticker with its last candles
+func NewTickerStats(summary TickerSummary, sector string, bars []Bar, candles int) TickerStats {
+	optional := func(v float64) *float64 {
+		if math.IsNaN(v) {
+			return nil
+		}
+		return &v
+	}
+	recent := Candles(bars)
+	if start := len(recent) - candles; start > 0 {
+		recent = recent[start:]
+	}
+	liquidity := summary.Liquidity
+	if liquidity == nil {
+		liquidity = []Liquidity{}
+	}
+	return TickerStats{
+		Ticker:           summary.Ticker,
+		CompanyName:      summary.CompanyName,
+		CompanyNameAr:    summary.CompanyNameAr,
+		Sector:           sector,
+		LastPrice:        summary.LastPrice,
+		LastDate:         summary.LastDate,
+		TradingDays:      summary.TradingDays,
+		High52W:          summary.High52W,
+		Low52W:           summary.Low52W,
+		PercentOffHigh:   summary.PercentOffHigh,
+		Beta:             optional(summary.Beta),
+		RelativeStrength: optional(summary.RelativeStrength),
+		Indicators:       summary.Indicators,
+		Liquidity:        liquidity,
+		History:          summary.History,
+		Candles:          recent,
+	}
+}
+
+// StatsFile returns the path of the stat file of ticker in dir
+func StatsFile(dir, ticker string) string {
+	return filepath.Join(dir, ticker+".json")
+}
+
+// writeStats writes a stat file
+func writeStats(path string, stats TickerStats) error {
+	return writeFile(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(stats)
+	})
+}
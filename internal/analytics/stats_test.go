@@ -0,0 +1,46 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// TestTickerStats keeps the last candles of the traded bars and encodes unknown values as null
+func TestTickerStats(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	bars := []Bar{
+		{Date: day, Close: 1, Volume: 10, Traded: true},
+		{Date: day.AddDate(0, 0, 1), Close: 1.1, Volume: 20, Traded: true},
+		{Date: day.AddDate(0, 0, 2), Close: 1.1}, // forward-filled
+		{Date: day.AddDate(0, 0, 3), Close: 1.2, Volume: 30, Traded: true},
+	}
+	summary := TickerSummary{
+		Ticker: "BBOB", LastPrice: 1.2, LastDate: "2025-03-05", TradingDays: 4,
+		Beta: math.NaN(), RelativeStrength: 101.5,
+		Indicators: ComputeIndicators([]float64{1, 1.1, 1.1, 1.2}, nil, nil)[3],
+		History:    RecentHistory(bars, 2),
+	}
+
+	stats := NewTickerStats(summary, "Banks", bars, 2)
+	if len(stats.Candles) != 2 || stats.Candles[0][4] != 1.1 || stats.Candles[1][5] != 30 {
+		t.Errorf("candles: %v", stats.Candles)
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	indicators := decoded["indicators"].(map[string]interface{})
+	if decoded["beta"] != nil || decoded["relative_strength"] != 101.5 || decoded["sector"] != "Banks" {
+		t.Errorf("stats: %s", data)
+	}
+	if indicators["sma10"] != nil || indicators["vwap"] != nil {
+		t.Errorf("indicators: %v", indicators)
+	}
+}
@@ -0,0 +1,442 @@
+// Package analytics derives summaries, technical indicators and volatility metrics from the
+// combined CSV written by the processor.
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TickerSummary is the ticker_summary.csv row of one ticker
+type TickerSummary struct {
+	Ticker        string
+	CompanyName   string
+	CompanyNameAr string
+	LastPrice     float64
+	LastDate      string
+	TradingDays   int
+	Last10Days    []float64
+	History       History    // the last SummaryGenerator.HistoryDays trades
+	Indicators    Indicators // indicators of the last close
+
+	// Closing range of the 52 weeks up to LastDate, and how far LastPrice is below its high
+	High52W        float64
+	Low52W         float64
+	PercentOffHigh float64
+
+	// Beta and relative strength against ISX60 after the last trade, NaN without the index
+	Beta             float64
+	RelativeStrength float64
+
+	Liquidity []Liquidity // one per window of SummaryGenerator.LiquidityWindows
+}
+
+// SummaryGenerator writes the ticker summary with liquidity metrics, latest indicators, return,
+// volatility, beta and candle series, per-ticker stat files, drawdowns, sector aggregates, market
+// breadth, calendar statistics, top movers, technical signals, price anomalies, an Excel workbook
+// and the outputs of the custom analyzers of a combined CSV
+type SummaryGenerator struct {
+	CombinedPath   string // isx_combined_data.csv, compressed or not
+	SummaryPath    string // ticker_summary.csv
+	IndicatorsPath string // ticker_indicators.csv; "" writes none
+	VolatilityPath string // ticker_volatility.csv, the volatility series of every ticker; "" writes none
+	Volatility     VolatilityOptions
+	HistoryDays    int // trading days in the recent history of the summary
+	// LiquidityWindows are the windows of the liquidity metrics of the summary, in market sessions
+	LiquidityWindows []int
+	SectorsPath      string // sector_summary.csv; "" writes none
+	ReturnsDir       string // directory <TICKER>_returns.csv files are written to; "" writes none
+	OHLCVDir         string // directory the <TICKER>_ohlcv.json daily candles are written to; "" writes none
+	StatsDir         string // directory the <TICKER>.json stat files are written to; "" writes none
+	StatsCandles     int    // recent daily candles in each stat file
+	DrawdownPath     string // drawdown_summary.csv, the drawdowns of every ticker and index; "" writes none
+	IndexesPath      string // indexes.csv, whose indices join the drawdowns and the beta, when it exists
+	BetaPath         string // ticker_beta.csv, the beta series against BetaIndex of every ticker; "" writes none
+	BetaWindow       int    // trades the rolling beta and relative strength cover
+	BreadthPath      string // market_breadth.csv; "" writes none
+	CalendarPath     string // calendar_stats.csv, the statistics of every year and month; "" writes none
+	MoversDir        string // directory top_movers_<date>.csv and .json are written to; "" writes none
+	MoversCount      int    // tickers in each top movers list
+	SignalsDir       string // directory signals_<date>.csv and .json are written to; "" writes none
+	AnomaliesPath    string // anomalies.csv, the improbable bars of every ticker; "" writes none
+	Anomalies        AnomalyOptions
+	WorkbookPath     string // isx_analytics.xlsx, the summary, top movers and indices for Excel; "" writes none
+	Analyzers        []Analyzer
+	AnalyzersDir     string // directory the analyzer outputs and analyzers.json are written to; "" writes none
+}
+
+// NewSummaryGenerator returns a generator reading and writing the usual files of a reports directory
+func NewSummaryGenerator(dir string) *SummaryGenerator {
+	return &SummaryGenerator{
+		CombinedPath:     filepath.Join(dir, "isx_combined_data.csv"),
+		SummaryPath:      filepath.Join(dir, "ticker_summary.csv"),
+		IndicatorsPath:   filepath.Join(dir, "ticker_indicators.csv"),
+		VolatilityPath:   filepath.Join(dir, "ticker_volatility.csv"),
+		Volatility:       DefaultVolatilityOptions,
+		HistoryDays:      DefaultHistoryDays,
+		LiquidityWindows: DefaultLiquidityWindows,
+		SectorsPath:      filepath.Join(dir, "sector_summary.csv"),
+		ReturnsDir:       dir,
+		OHLCVDir:         dir,
+		StatsDir:         dir,
+		StatsCandles:     DefaultStatsCandles,
+		DrawdownPath:     filepath.Join(dir, "drawdown_summary.csv"),
+		IndexesPath:      filepath.Join(dir, "indexes.csv"),
+		BetaPath:         filepath.Join(dir, "ticker_beta.csv"),
+		BetaWindow:       DefaultBetaWindow,
+		BreadthPath:      filepath.Join(dir, "market_breadth.csv"),
+		CalendarPath:     filepath.Join(dir, "calendar_stats.csv"),
+		MoversDir:        dir,
+		MoversCount:      10,
+		SignalsDir:       dir,
+		AnomaliesPath:    filepath.Join(dir, "anomalies.csv"),
+		Anomalies:        DefaultAnomalyOptions,
+		WorkbookPath:     filepath.Join(dir, "isx_analytics.xlsx"),
+		Analyzers:        Analyzers(),
+		AnalyzersDir:     dir,
+	}
+}
+
+// Generate reads the combined CSV and writes the summary files, returning the summaries sorted by
+// ticker. Rows filled without prices are left out. The summary, indicators and drawdowns are built
+// as the rows are read, holding only the recent bars of each ticker; the whole history of every
+// ticker is loaded only when an output that needs it is enabled.
+func (g *SummaryGenerator) Generate() ([]TickerSummary, error) {
+	indices := g.loadIndices()
+	state := g.newSummaryState(indices)
+	var series map[string]*TickerSeries
+	if g.needsHistories() {
+		series = make(map[string]*TickerSeries)
+	}
+	err := scanSeries(g.CombinedPath, func(row seriesRow) {
+		state.add(row)
+		if series != nil {
+			addRow(series, row)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if series != nil {
+		sortSeries(series)
+	}
+	if state.unordered {
+		// Rows out of date order can only be summarised from the sorted histories
+		if series == nil {
+			if series, err = LoadSeries(g.CombinedPath); err != nil {
+				return nil, err
+			}
+		}
+		state = g.newSummaryState(indices)
+		state.addSeries(series)
+	}
+	summaries, drawdowns := state.summaries()
+
+	// The rest of the per-ticker outputs need the histories
+	var signals []Signal
+	var anomalies []Anomaly
+	var session time.Time
+	if series != nil {
+		session = LastSession(series)
+	}
+	for i := 0; series != nil && i < len(summaries); i++ {
+		ticker := summaries[i].Ticker
+		s := series[ticker]
+		if g.SignalsDir != "" && s.Bars[len(s.Bars)-1].Date.Equal(session) {
+			signals = append(signals, DetectSignals(s, ComputeIndicators(s.Closes(), s.Volumes(), s.Values()))...)
+		}
+		if g.AnomaliesPath != "" {
+			anomalies = append(anomalies, DetectAnomalies(s, g.Anomalies)...)
+		}
+		if g.ReturnsDir != "" {
+			if err := writeCSV(ReturnsFile(g.ReturnsDir, ticker), returnRows(Returns(s.Bars))); err != nil {
+				return nil, fmt.Errorf("failed to write returns of %s: %w", ticker, err)
+			}
+		}
+		if g.OHLCVDir != "" {
+			if err := writeCandles(CandlesFile(g.OHLCVDir, ticker), Candles(s.Bars)); err != nil {
+				return nil, fmt.Errorf("failed to write candles of %s: %w", ticker, err)
+			}
+		}
+		if g.StatsDir != "" {
+			stats := NewTickerStats(summaries[i], s.Sector, s.Bars, g.StatsCandles)
+			if err := writeStats(StatsFile(g.StatsDir, ticker), stats); err != nil {
+				return nil, fmt.Errorf("failed to write stats of %s: %w", ticker, err)
+			}
+		}
+	}
+
+	if err := writeCSV(g.SummaryPath, summaryRows(summaries, g.LiquidityWindows)); err != nil {
+		return nil, fmt.Errorf("failed to write summary file: %w", err)
+	}
+	if g.IndicatorsPath != "" {
+		if err := writeCSV(g.IndicatorsPath, indicatorRows(summaries)); err != nil {
+			return nil, fmt.Errorf("failed to write indicators file: %w", err)
+		}
+	}
+	// The series files hold a row per bar, so their rows are written as they are computed
+	if g.VolatilityPath != "" {
+		err := streamCSV(g.VolatilityPath, append([]string{"Date", "Ticker"}, VolatilityNames...), func(write func([]string) error) error {
+			for _, summary := range summaries {
+				for _, p := range Volatility(series[summary.Ticker].Bars, g.Volatility) {
+					if err := write(append([]string{p.Date.Format("2006-01-02"), summary.Ticker}, p.Cells()...)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write volatility file: %w", err)
+		}
+	}
+	if g.BetaPath != "" {
+		err := streamCSV(g.BetaPath, append([]string{"Date", "Ticker"}, BetaNames...), func(write func([]string) error) error {
+			index, ok := indices[BetaIndex]
+			if !ok {
+				return nil
+			}
+			for _, summary := range summaries {
+				for _, p := range RelativeToIndex(series[summary.Ticker].Bars, index.Bars, g.BetaWindow) {
+					row := []string{p.Date.Format("2006-01-02"), summary.Ticker, FormatValue(p.Beta, 4), FormatValue(p.RelativeStrength, 2)}
+					if err := write(row); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write beta file: %w", err)
+		}
+	}
+	if g.DrawdownPath != "" {
+		if err := writeCSV(g.DrawdownPath, drawdownRows(append(drawdowns, indexDrawdowns(indices)...))); err != nil {
+			return nil, fmt.Errorf("failed to write drawdown summary: %w", err)
+		}
+	}
+	if g.SectorsPath != "" {
+		if err := writeCSV(g.SectorsPath, sectorRows(SectorSummary(series))); err != nil {
+			return nil, fmt.Errorf("failed to write sector summary: %w", err)
+		}
+	}
+	if g.BreadthPath != "" {
+		if err := writeCSV(g.BreadthPath, breadthRows(MarketBreadth(series))); err != nil {
+			return nil, fmt.Errorf("failed to write market breadth: %w", err)
+		}
+	}
+	if g.CalendarPath != "" {
+		if err := writeCSV(g.CalendarPath, calendarRows(CalendarStatistics(series))); err != nil {
+			return nil, fmt.Errorf("failed to write calendar statistics: %w", err)
+		}
+	}
+	var movers MoversReport
+	if g.MoversDir != "" || g.WorkbookPath != "" {
+		movers = TopMovers(series, g.MoversCount)
+	}
+	if g.MoversDir != "" {
+		if err := g.writeMovers(movers); err != nil {
+			return nil, fmt.Errorf("failed to write top movers: %w", err)
+		}
+	}
+	if g.AnomaliesPath != "" {
+		if err := writeCSV(g.AnomaliesPath, anomalyRows(anomalies)); err != nil {
+			return nil, fmt.Errorf("failed to write anomalies: %w", err)
+		}
+	}
+	if g.SignalsDir != "" {
+		if err := writeSignals(g.SignalsDir, NewSignalsReport(session, signals)); err != nil {
+			return nil, fmt.Errorf("failed to write signals report: %w", err)
+		}
+	}
+	if g.WorkbookPath != "" {
+		if err := writeWorkbook(g.WorkbookPath, summaries, g.LiquidityWindows, movers, indices); err != nil {
+			return nil, fmt.Errorf("failed to write analytics workbook: %w", err)
+		}
+	}
+	if g.AnalyzersDir != "" {
+		if err := runAnalyzers(g.Analyzers, series, g.AnalyzersDir); err != nil {
+			return nil, fmt.Errorf("failed to run analyzers: %w", err)
+		}
+	}
+	return summaries, nil
+}
+
+// needsHistories reports whether an enabled output needs the whole history of every ticker
+func (g *SummaryGenerator) needsHistories() bool {
+	return g.VolatilityPath != "" || g.BetaPath != "" || g.SectorsPath != "" || g.BreadthPath != "" ||
+		g.CalendarPath != "" || g.MoversDir != "" || g.SignalsDir != "" || g.AnomaliesPath != "" ||
+		g.ReturnsDir != "" || g.OHLCVDir != "" || g.StatsDir != "" || g.WorkbookPath != "" || g.AnalyzersDir != ""
+}
+
+// loadIndices returns the index series of IndexesPath, none when it can't be read
+func (g *SummaryGenerator) loadIndices() map[string]*TickerSeries {
+	if g.IndexesPath == "" {
+		return nil
+	}
+	indices, err := LoadIndexSeries(g.IndexesPath)
+	if err != nil {
+		return nil // indexcsv hasn't run
+	}
+	return indices
+}
+
+// indexDrawdowns returns the drawdowns of indices sorted by name
+func indexDrawdowns(indices map[string]*TickerSeries) []Drawdown {
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	drawdowns := make([]Drawdown, len(names))
+	for i, name := range names {
+		drawdowns[i] = ComputeDrawdown(name, indices[name].Bars)
+		drawdowns[i].Index = true
+	}
+	return drawdowns
+}
+
+// writeMovers writes the CSV and JSON top movers report of its session
+func (g *SummaryGenerator) writeMovers(report MoversReport) error {
+	if report.Date == "" {
+		return nil
+	}
+	base := filepath.Join(g.MoversDir, "top_movers_"+report.Date)
+	if err := writeCSV(base+".csv", moversRows(report)); err != nil {
+		return err
+	}
+	return writeFile(base+".json", func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	})
+}
+
+// YearRange returns the highest and lowest close of the 52 weeks up to the last of bars, which are
+// in date order, and how far in percent the last close is below that high. Bars without a close
+// are ignored.
+func YearRange(bars []Bar) (high, low, percentOffHigh float64) {
+	if len(bars) == 0 {
+		return 0, 0, 0
+	}
+	last := bars[len(bars)-1]
+	from := last.Date.AddDate(0, 0, -52*7)
+	for i := len(bars) - 1; i >= 0 && bars[i].Date.After(from); i-- {
+		c := bars[i].Close
+		if c <= 0 {
+			continue
+		}
+		if high == 0 || c > high {
+			high = c
+		}
+		if low == 0 || c < low {
+			low = c
+		}
+	}
+	if high > 0 && last.Close > 0 {
+		percentOffHigh = (high - last.Close) / high * 100
+	}
+	return high, low, percentOffHigh
+}
+
+// summaryRows formats ticker_summary.csv, with the liquidity metrics of windows last
+func summaryRows(summaries []TickerSummary, windows []int) [][]string {
+	header := []string{"Ticker", "CompanyName", "LastPrice", "LastDate", "TradingDays", "Last10Days", "CompanyNameAr", "High52W", "Low52W", "PercentOffHigh", "Beta", "RelativeStrength"}
+	header = append(header, historyColumns...)
+	for _, window := range windows {
+		header = append(header, LiquidityNames(window)...)
+	}
+	rows := [][]string{header}
+	for _, summary := range summaries {
+		last10Days := make([]string, len(summary.Last10Days))
+		for i, price := range summary.Last10Days {
+			last10Days[i] = fmt.Sprintf("%.3f", price)
+		}
+
+		row := []string{
+			summary.Ticker,
+			summary.CompanyName,
+			fmt.Sprintf("%.3f", summary.LastPrice),
+			summary.LastDate,
+			fmt.Sprintf("%d", summary.TradingDays),
+			strings.Join(last10Days, ","),
+			summary.CompanyNameAr,
+			fmt.Sprintf("%.3f", summary.High52W),
+			fmt.Sprintf("%.3f", summary.Low52W),
+			fmt.Sprintf("%.2f", summary.PercentOffHigh),
+			FormatValue(summary.Beta, 4),
+			FormatValue(summary.RelativeStrength, 2),
+		}
+		row = append(row, summary.History.Cells()...)
+		for _, l := range summary.Liquidity {
+			row = append(row, l.Cells()...)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// indicatorRows formats ticker_indicators.csv, the indicators of the last close of every ticker
+func indicatorRows(summaries []TickerSummary) [][]string {
+	rows := [][]string{append([]string{"Ticker", "Date", "ClosePrice"}, IndicatorNames...)}
+	for _, summary := range summaries {
+		row := []string{summary.Ticker, summary.LastDate, fmt.Sprintf("%.3f", summary.LastPrice)}
+		rows = append(rows, append(row, summary.Indicators.Cells()...))
+	}
+	return rows
+}
+
+// writeCSV writes rows to a temporary file renamed over path, so readers never see a partial file
+func writeCSV(path string, rows [][]string) error {
+	return writeFile(path, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	})
+}
+
+// streamCSV writes the header and the rows rows passes to write to a temporary file renamed over
+// path, without holding the rows in memory
+func streamCSV(path string, header []string, rows func(write func([]string) error) error) error {
+	return writeFile(path, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		if err := rows(writer.Write); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+}
+
+// writeFile writes a file through write to a temporary file renamed over path
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
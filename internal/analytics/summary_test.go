@@ -0,0 +1,182 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCombined writes a combined CSV of three tickers over 420 weekdays to dir: AAA trades most
+// days and is forward-filled on the rest, BBB lists late, skips sessions and is renamed, and CCC
+// stops trading early. It returns the rows, header first, and writes ISX60 to indexes.csv.
+func writeCombined(t *testing.T, dir string) []string {
+	t.Helper()
+	rng := rand.New(rand.NewSource(7))
+	rows := []string{"Date,Symbol,CompanyName,CompanyNameAr,OpenPrice,HighPrice,LowPrice,ClosePrice,Volume,Value,TradingStatus,SharesOutstanding,Sector"}
+	index := []string{"Date,ISX60"}
+	closes := map[string]float64{"AAA": 10, "BBB": 2, "CCC": 5}
+	level := 600.0
+	day := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	for session := 0; session < 420; day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			continue
+		}
+		session++
+		date := day.Format("2006-01-02")
+		level *= 1 + (rng.Float64()-0.5)/50
+		index = append(index, fmt.Sprintf("%s,%.2f", date, level))
+		for _, ticker := range []string{"AAA", "BBB", "CCC"} {
+			name := ticker + " Co"
+			switch {
+			case ticker == "BBB" && session < 150, ticker == "CCC" && session > 300:
+				continue
+			case ticker == "BBB" && session%7 == 0:
+				continue // no row at all
+			case ticker == "BBB" && session > 350:
+				name = "BBB Holdings"
+			}
+			if ticker == "CCC" && session%11 == 0 {
+				// Filled without a price
+				rows = append(rows, fmt.Sprintf("%s,%s,%s,,,,,,0,0,false,,", date, ticker, name))
+				continue
+			}
+			traded := rng.Intn(5) > 0
+			volume := int64(0)
+			if traded {
+				closes[ticker] *= 1 + (rng.Float64()-0.5)/10
+				volume = int64(rng.Intn(100000))
+			}
+			c := closes[ticker]
+			rows = append(rows, fmt.Sprintf("%s,%s,%s,%s AR,%.3f,%.3f,%.3f,%.3f,%d,%.2f,%t,%d,Banks",
+				date, ticker, name, ticker, c, c*1.01, c*0.99, c, volume, c*float64(volume), traded, 1000000))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "isx_combined_data.csv"), []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "indexes.csv"), []byte(strings.Join(index, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// historySummaries builds the summaries and drawdowns from the whole series, as Generate did
+// before it kept only the recent bars
+func historySummaries(g *SummaryGenerator, series map[string]*TickerSeries) ([]TickerSummary, []Drawdown) {
+	calendar := MarketCalendar(series)
+	indices := g.loadIndices()
+	var summaries []TickerSummary
+	var drawdowns []Drawdown
+	for _, ticker := range []string{"AAA", "BBB", "CCC"} {
+		s := series[ticker]
+		closes := s.Closes()
+		indicators := ComputeIndicators(closes, s.Volumes(), s.Values())
+		high, low, offHigh := YearRange(s.Bars)
+		liquidity := make([]Liquidity, len(g.LiquidityWindows))
+		for i, window := range g.LiquidityWindows {
+			liquidity[i] = ComputeLiquidity(s.Bars, calendar, window)
+		}
+		relative := BetaPoint{Beta: math.NaN(), RelativeStrength: math.NaN()}
+		if points := RelativeToIndex(s.Bars, indices[BetaIndex].Bars, g.BetaWindow); len(points) > 0 {
+			relative = points[len(points)-1]
+		}
+		last := s.Bars[len(s.Bars)-1]
+		summaries = append(summaries, TickerSummary{
+			Ticker:           ticker,
+			CompanyName:      s.CompanyName,
+			CompanyNameAr:    s.CompanyNameAr,
+			LastPrice:        last.Close,
+			LastDate:         last.Date.Format("2006-01-02"),
+			TradingDays:      len(s.Bars),
+			Last10Days:       closes[max(len(closes)-10, 0):],
+			History:          RecentHistory(s.Bars, g.HistoryDays),
+			Indicators:       indicators[len(indicators)-1],
+			High52W:          high,
+			Low52W:           low,
+			PercentOffHigh:   offHigh,
+			Beta:             relative.Beta,
+			RelativeStrength: relative.RelativeStrength,
+			Liquidity:        liquidity,
+		})
+		drawdowns = append(drawdowns, ComputeDrawdown(ticker, s.Bars))
+	}
+	return summaries, drawdowns
+}
+
+// TestGenerateSummary checks the summary, indicators and drawdowns kept as the rows stream in
+// against those of the whole series, with and without the outputs that load the histories and
+// with rows out of date order
+func TestGenerateSummary(t *testing.T) {
+	dir := t.TempDir()
+	rows := writeCombined(t, dir)
+	g := NewSummaryGenerator(dir)
+	series, err := LoadSeries(g.CombinedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries, drawdowns := historySummaries(g, series)
+	want := map[string][][]string{
+		"ticker_summary.csv":    summaryRows(summaries, g.LiquidityWindows),
+		"ticker_indicators.csv": indicatorRows(summaries),
+		"drawdown_summary.csv":  drawdownRows(append(drawdowns, indexDrawdowns(g.loadIndices())...)),
+	}
+	if cell := want["ticker_indicators.csv"][1][len(IndicatorNames)+2]; cell == "" {
+		t.Fatal("fixture too short for SMA200")
+	}
+
+	check := func(name string, g *SummaryGenerator) {
+		t.Helper()
+		got, err := g.Generate()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != 3 || got[1].CompanyName != "BBB Holdings" || got[2].LastDate >= got[0].LastDate {
+			t.Errorf("%s: summaries %+v", name, got)
+		}
+		for file, rows := range want {
+			f, err := os.Open(filepath.Join(filepath.Dir(g.SummaryPath), file))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			written, err := csv.NewReader(f).ReadAll()
+			f.Close()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", name, file, err)
+			}
+			if !reflect.DeepEqual(written, rows) {
+				t.Errorf("%s: %s differs:\n%v\nwant:\n%v", name, file, written, rows)
+			}
+		}
+	}
+
+	// Only the summary files: no histories are loaded
+	streamed := &SummaryGenerator{
+		CombinedPath:     g.CombinedPath,
+		SummaryPath:      g.SummaryPath,
+		IndicatorsPath:   g.IndicatorsPath,
+		DrawdownPath:     g.DrawdownPath,
+		IndexesPath:      g.IndexesPath,
+		HistoryDays:      g.HistoryDays,
+		LiquidityWindows: g.LiquidityWindows,
+		BetaWindow:       g.BetaWindow,
+	}
+	if streamed.needsHistories() {
+		t.Fatal("summary files alone load the histories")
+	}
+	check("streamed", streamed)
+	check("all outputs", g)
+
+	// Rows out of date order fall back to the sorted histories
+	unordered := append(append([]string{rows[0]}, rows[2:]...), rows[1])
+	if err := os.WriteFile(g.CombinedPath, []byte(strings.Join(unordered, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check("unordered", streamed)
+}
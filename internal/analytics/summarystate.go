@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summaryState builds the ticker summaries and drawdowns from the priced rows of the combined CSV
+// in date order. Each ticker keeps only the recent bars its summary looks at, so memory grows with
+// the number of tickers rather than the length of the history.
+type summaryState struct {
+	historyDays int
+	windows     []int        // liquidity windows, in market sessions
+	sessions    []time.Time  // the last market sessions, as many as the longest liquidity window
+	index       *indexLevels // BetaIndex, nil without it
+	betaWindow  int
+	last        time.Time // date of the latest row
+	unordered   bool      // a row came dated before the latest, leaving the state wrong
+	tickers     map[string]*tickerState
+}
+
+// tickerState is the bounded state of one ticker in a summaryState
+type tickerState struct {
+	ticker        string
+	companyName   string // name on the last row
+	companyNameAr string
+	bars          int       // priced bars
+	first         time.Time // date of the first priced bar
+	last10        []float64 // closes of the last 10 bars
+	trades        []Bar     // the last historyDays trades and the one before
+	year          []Bar     // bars of the 52 weeks up to the last
+	recent        []Bar     // bars of the market sessions held for the liquidity windows
+	indicators    indicatorState
+	drawdown      drawdownState
+	relative      relativeState
+}
+
+// newSummaryState returns the state of the summaries of g, measuring beta against the BetaIndex
+// of indices
+func (g *SummaryGenerator) newSummaryState(indices map[string]*TickerSeries) *summaryState {
+	st := &summaryState{
+		historyDays: g.HistoryDays,
+		windows:     g.LiquidityWindows,
+		betaWindow:  g.BetaWindow,
+		tickers:     make(map[string]*tickerState),
+	}
+	if index, ok := indices[BetaIndex]; ok {
+		st.index = newIndexLevels(index.Bars)
+	}
+	return st
+}
+
+// add takes the next row of the combined CSV. A row dated before the latest marks the state
+// unordered and is dropped.
+func (st *summaryState) add(row seriesRow) {
+	b := row.Bar
+	if b.Date.Before(st.last) {
+		st.unordered = true
+	}
+	if st.unordered {
+		return
+	}
+	if b.Date.After(st.last) {
+		longest := 0
+		for _, window := range st.windows {
+			longest = max(longest, window)
+		}
+		st.sessions = keepLast(append(st.sessions, b.Date), longest)
+		st.last = b.Date
+	}
+
+	// Cells share the memory of their whole row, so the strings kept are copied
+	t, ok := st.tickers[row.Ticker]
+	if !ok {
+		t = &tickerState{ticker: strings.Clone(row.Ticker), first: b.Date, indicators: newIndicatorState()}
+		t.relative = relativeState{index: st.index, window: st.betaWindow}
+		st.tickers[t.ticker] = t
+	}
+	if row.CompanyName != t.companyName {
+		t.companyName = strings.Clone(row.CompanyName)
+	}
+	if row.CompanyNameAr != t.companyNameAr {
+		t.companyNameAr = strings.Clone(row.CompanyNameAr)
+	}
+
+	t.bars++
+	t.last10 = keepLast(append(t.last10, b.Close), 10)
+	if b.Traded && b.Close > 0 {
+		t.trades = keepLast(append(t.trades, b), st.historyDays+1)
+	}
+	t.year = append(t.year, b)
+	from := b.Date.AddDate(0, 0, -52*7)
+	for !t.year[0].Date.After(from) {
+		t.year = t.year[1:]
+	}
+	if len(st.sessions) > 0 {
+		t.recent = append(t.recent, b)
+		for t.recent[0].Date.Before(st.sessions[0]) {
+			t.recent = t.recent[1:]
+		}
+	}
+	t.indicators.add(b)
+	t.drawdown.add(b)
+	if st.index != nil {
+		t.relative.add(b)
+	}
+}
+
+// addSeries adds the bars of series, whose names are kept, in date order across the tickers
+func (st *summaryState) addSeries(series map[string]*TickerSeries) {
+	type ref struct {
+		s   *TickerSeries
+		bar int
+	}
+	var refs []ref
+	for _, s := range series {
+		for i := range s.Bars {
+			refs = append(refs, ref{s, i})
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].s.Bars[refs[i].bar].Date.Before(refs[j].s.Bars[refs[j].bar].Date) })
+	for _, r := range refs {
+		st.add(seriesRow{Ticker: r.s.Ticker, CompanyName: r.s.CompanyName, CompanyNameAr: r.s.CompanyNameAr, Bar: r.s.Bars[r.bar]})
+	}
+}
+
+// summaries returns the summaries and drawdowns of the tickers, sorted by ticker
+func (st *summaryState) summaries() ([]TickerSummary, []Drawdown) {
+	tickers := make([]string, 0, len(st.tickers))
+	for ticker := range st.tickers {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	summaries := make([]TickerSummary, 0, len(tickers))
+	drawdowns := make([]Drawdown, 0, len(tickers))
+	for _, ticker := range tickers {
+		t := st.tickers[ticker]
+		last := t.year[len(t.year)-1]
+		high, low, offHigh := YearRange(t.year)
+		liquidity := make([]Liquidity, len(st.windows))
+		for i, window := range st.windows {
+			liquidity[i] = recentLiquidity(t.recent, t.first, st.sessions, window)
+		}
+		relative := BetaPoint{Beta: math.NaN(), RelativeStrength: math.NaN()}
+		if st.index != nil {
+			relative = t.relative.point(last.Date)
+		}
+		summaries = append(summaries, TickerSummary{
+			Ticker:           ticker,
+			CompanyName:      t.companyName,
+			CompanyNameAr:    t.companyNameAr,
+			LastPrice:        last.Close,
+			LastDate:         last.Date.Format("2006-01-02"),
+			TradingDays:      t.bars,
+			Last10Days:       t.last10,
+			History:          RecentHistory(t.trades, st.historyDays),
+			Indicators:       t.indicators.indicators(),
+			High52W:          high,
+			Low52W:           low,
+			PercentOffHigh:   offHigh,
+			Beta:             relative.Beta,
+			RelativeStrength: relative.RelativeStrength,
+			Liquidity:        liquidity,
+		})
+		drawdowns = append(drawdowns, t.drawdown.drawdown(ticker))
+	}
+	return summaries, drawdowns
+}
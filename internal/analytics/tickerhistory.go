@@ -0,0 +1,200 @@
+package analytics
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryFields are the fields of the records of a ticker history. period_end and trading_days
+// are only set on resampled records.
+var HistoryFields = []string{"date", "period_end", "open", "high", "low", "close", "adj_close", "volume", "value", "traded", "trading_days"}
+
+// HistoryQuery selects the records of a ticker history, as served by /api/ticker/{ticker}
+type HistoryQuery struct {
+	From     string   // first day, YYYY-MM-DD; "" for the first of the history
+	To       string   // last day, YYYY-MM-DD; "" for the last of the history
+	Limit    int      // the latest Limit records of the range, 0 for all of them
+	Fields   []string // of HistoryFields, all when empty
+	Resample string   // ResolutionWeekly or ResolutionMonthly aggregate the traded days of the range
+}
+
+// HistoryPage is the result of a HistoryQuery
+type HistoryPage struct {
+	Ticker  string                   `json:"ticker"`
+	Records []map[string]interface{} `json:"records"`
+	Total   int                      `json:"total"` // records in the range, before the limit
+	// Next is the "to" of the query returning the records before these, "" when there are none
+	Next string `json:"next,omitempty"`
+}
+
+// ParseHistoryQuery reads a HistoryQuery from the ?from, ?to, ?limit, ?fields (comma-separated)
+// and ?resample parameters of a URL
+func ParseHistoryQuery(values url.Values) (HistoryQuery, error) {
+	q := HistoryQuery{
+		From:     values.Get("from"),
+		To:       values.Get("to"),
+		Fields:   splitFields(values.Get("fields")),
+		Resample: values.Get("resample"),
+	}
+	for _, date := range []string{q.From, q.To} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return q, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", date)
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %q", limit)
+		}
+		q.Limit = n
+	}
+	for _, f := range q.Fields {
+		if !slices.Contains(HistoryFields, f) {
+			return q, fmt.Errorf("unknown field %q (want %s)", f, strings.Join(HistoryFields, ", "))
+		}
+	}
+	if _, err := resolutionPeriod(q.Resample); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// LoadTickerHistory reads the history of ticker from its CSV, compressed or not
+func LoadTickerHistory(path, ticker string) (*TickerSeries, error) {
+	series, err := LoadSeries(path)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := series[ticker]
+	if !ok {
+		return nil, fmt.Errorf("no rows of %s in %s", ticker, path)
+	}
+	return s, nil
+}
+
+// QueryHistory returns the records of s that q selects, in date order. Missing intraday prices
+// are filled from the close, as for the candles.
+func QueryHistory(s *TickerSeries, q HistoryQuery) HistoryPage {
+	var bars []Bar
+	for _, b := range s.Bars {
+		date := b.Date.Format("2006-01-02") // the dates sort as strings
+		if (q.From == "" || date >= q.From) && (q.To == "" || date <= q.To) {
+			bars = append(bars, b)
+		}
+	}
+
+	var records []historyRecord
+	if period, _ := resolutionPeriod(q.Resample); period != nil {
+		records = resampleHistory(bars, period)
+	} else {
+		for _, b := range bars {
+			records = append(records, historyRecord{Bar: filledBar(b)})
+		}
+	}
+
+	page := HistoryPage{Ticker: s.Ticker, Records: []map[string]interface{}{}, Total: len(records)}
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+		page.Next = records[0].Date.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = HistoryFields
+	}
+	for _, r := range records {
+		page.Records = append(page.Records, r.fields(fields))
+	}
+	return page
+}
+
+// historyRecord is a day of a ticker history or, when End is set, a resampled period stamped with
+// its first day
+type historyRecord struct {
+	Bar
+	End  time.Time // last trading day of the period
+	Days int       // trading days of the period
+}
+
+// fields returns the values of the named fields of r, leaving out those it doesn't have
+func (r historyRecord) fields(names []string) map[string]interface{} {
+	values := map[string]interface{}{
+		"date":   r.Date.Format("2006-01-02"),
+		"open":   r.Open,
+		"high":   r.High,
+		"low":    r.Low,
+		"close":  r.Close,
+		"volume": r.Volume,
+		"value":  r.Value,
+		"traded": r.Traded,
+	}
+	if r.AdjClose != 0 {
+		values["adj_close"] = r.AdjClose
+	}
+	if !r.End.IsZero() {
+		values["period_end"] = r.End.Format("2006-01-02")
+		values["trading_days"] = r.Days
+	}
+	record := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if v, ok := values[name]; ok {
+			record[name] = v
+		}
+	}
+	return record
+}
+
+// resampleHistory aggregates the traded bars, in date order, to the periods starting at
+// period(date): each opens at its first open, closes at its last close, ranges over its extremes
+// and sums the volume and value of its days
+func resampleHistory(bars []Bar, period func(time.Time) time.Time) []historyRecord {
+	var records []historyRecord
+	for _, b := range bars {
+		if !b.Traded || b.Close <= 0 {
+			continue
+		}
+		b = filledBar(b)
+		day, start := b.Date, period(b.Date)
+		if n := len(records); n > 0 && records[n-1].Date.Equal(start) {
+			r := &records[n-1]
+			r.High, r.Low = max(r.High, b.High), min(r.Low, b.Low)
+			r.Close, r.AdjClose = b.Close, b.AdjClose
+			r.Volume += b.Volume
+			r.Value += b.Value
+			r.End = day
+			r.Days++
+			continue
+		}
+		b.Date = start
+		records = append(records, historyRecord{Bar: b, End: day, Days: 1})
+	}
+	return records
+}
+
+// filledBar returns b with its missing intraday prices set to its close
+func filledBar(b Bar) Bar {
+	if b.Open == 0 {
+		b.Open = b.Close
+	}
+	if b.High == 0 {
+		b.High = b.Close
+	}
+	if b.Low == 0 {
+		b.Low = b.Close
+	}
+	return b
+}
+
+// splitFields returns the trimmed, non-empty names of a comma-separated list
+func splitFields(s string) []string {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
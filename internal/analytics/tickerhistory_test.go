@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestQueryHistory limits, pages, resamples and selects the fields of a ticker history
+func TestQueryHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "BBOB.csv")
+	csv := `Date,CompanyName,Symbol,OpenPrice,HighPrice,LowPrice,ClosePrice,Volume,Value,TradingStatus
+2025-03-02,Bank of Baghdad,BBOB,10,12,9,11,100,1100,true
+2025-03-03,Bank of Baghdad,BBOB,,,,13,50,650,true
+2025-03-04,Bank of Baghdad,BBOB,,,,13,0,0,false
+2025-03-09,Bank of Baghdad,BBOB,12,12,8,8.5,10,85,true
+`
+	if err := os.WriteFile(path, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadTickerHistory(path, "BBOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTickerHistory(path, "TASC"); err == nil {
+		t.Error("loaded the history of a ticker not in the file")
+	}
+
+	q, err := ParseHistoryQuery(url.Values{"limit": {"2"}, "fields": {"date, close"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := QueryHistory(s, q)
+	if page.Ticker != "BBOB" || page.Total != 4 || page.Next != "2025-03-03" || len(page.Records) != 2 {
+		t.Fatalf("page: %+v", page)
+	}
+	if r := page.Records[0]; len(r) != 2 || r["date"] != "2025-03-04" || r["close"] != 13.0 {
+		t.Errorf("record: %v", r)
+	}
+	page = QueryHistory(s, HistoryQuery{To: page.Next, Fields: []string{"date", "open", "low"}})
+	if page.Total != 2 || page.Next != "" || page.Records[1]["open"] != 13.0 || page.Records[1]["low"] != 13.0 {
+		t.Errorf("previous page: %+v", page)
+	}
+
+	q, err = ParseHistoryQuery(url.Values{"resample": {"weekly"}, "from": {"2025-03-02"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page = QueryHistory(s, q)
+	if len(page.Records) != 2 {
+		t.Fatalf("weekly: %+v", page)
+	}
+	week := page.Records[0]
+	want := map[string]interface{}{
+		"date": "2025-03-02", "period_end": "2025-03-03", "open": 10.0, "high": 13.0, "low": 9.0,
+		"close": 13.0, "volume": int64(150), "value": 1750.0, "traded": true, "trading_days": 2,
+	}
+	for k, v := range want {
+		if week[k] != v {
+			t.Errorf("weekly %s: got %v, want %v", k, week[k], v)
+		}
+	}
+	for _, values := range []url.Values{
+		{"from": {"2025/03/02"}},
+		{"limit": {"-1"}},
+		{"fields": {"date,price"}},
+		{"resample": {"hourly"}},
+	} {
+		if _, err := ParseHistoryQuery(values); err == nil {
+			t.Errorf("%v accepted", values)
+		}
+	}
+}
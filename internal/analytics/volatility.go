@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"math"
+	"time"
+)
+
+// VolatilityOptions are the windows of the volatility metrics, in trading days
+type VolatilityOptions struct {
+	StdDevWindow    int     // daily returns the rolling standard deviation covers
+	BollingerWindow int     // closes the Bollinger middle band averages
+	BollingerWidth  float64 // standard deviations between the middle and outer bands
+	ATRWindow       int     // true ranges the average true range smooths
+}
+
+// DefaultVolatilityOptions are the customary 20-day bands two deviations wide and 14-day ATR
+var DefaultVolatilityOptions = VolatilityOptions{
+	StdDevWindow:    20,
+	BollingerWindow: 20,
+	BollingerWidth:  2,
+	ATRWindow:       14,
+}
+
+// VolatilityNames are the columns of the volatility metrics, in the order of
+// VolatilityPoint.Values
+var VolatilityNames = []string{"StdDev", "BollingerMiddle", "BollingerUpper", "BollingerLower", "ATR"}
+
+// VolatilityPoint holds the volatility metrics of one bar. Values that need more history than is
+// available are NaN.
+type VolatilityPoint struct {
+	Date            time.Time
+	StdDev          float64 // standard deviation of daily returns, in percent
+	BollingerMiddle float64 // simple moving average of the close
+	BollingerUpper  float64
+	BollingerLower  float64
+	ATR             float64 // average true range
+}
+
+// Values returns the metrics in the order of VolatilityNames
+func (p VolatilityPoint) Values() []float64 {
+	return []float64{p.StdDev, p.BollingerMiddle, p.BollingerUpper, p.BollingerLower, p.ATR}
+}
+
+// Cells formats the metrics as CSV cells in the order of VolatilityNames, empty where NaN
+func (p VolatilityPoint) Cells() []string {
+	values := p.Values()
+	cells := make([]string, len(values))
+	for i, v := range values {
+		cells[i] = FormatValue(v, 3)
+	}
+	return cells
+}
+
+// Volatility returns the volatility metrics of every bar of a series in date order
+func Volatility(bars []Bar, opts VolatilityOptions) []VolatilityPoint {
+	closes := make([]float64, len(bars))
+	for i, b := range bars {
+		closes[i] = b.Close
+	}
+
+	returns := nanSeries(len(bars))
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] != 0 {
+			returns[i] = (closes[i]/closes[i-1] - 1) * 100
+		}
+	}
+	stdDev := StdDev(returns, opts.StdDevWindow)
+	middle, upper, lower := Bollinger(closes, opts.BollingerWindow, opts.BollingerWidth)
+	atr := ATR(bars, opts.ATRWindow)
+
+	points := make([]VolatilityPoint, len(bars))
+	for i, b := range bars {
+		points[i] = VolatilityPoint{
+			Date:            b.Date,
+			StdDev:          stdDev[i],
+			BollingerMiddle: middle[i],
+			BollingerUpper:  upper[i],
+			BollingerLower:  lower[i],
+			ATR:             atr[i],
+		}
+	}
+	return points
+}
+
+// StdDev returns the rolling population standard deviation over window values, NaN until window
+// values are seen or when the window holds a NaN
+func StdDev(values []float64, window int) []float64 {
+	out := nanSeries(len(values))
+	if window <= 0 {
+		return out
+	}
+	for i := window - 1; i < len(values); i++ {
+		sum, sumSq := 0.0, 0.0
+		for _, v := range values[i-window+1 : i+1] {
+			sum += v
+			sumSq += v * v
+		}
+		if math.IsNaN(sum) {
+			continue
+		}
+		n := float64(window)
+		mean := sum / n
+		out[i] = math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+	}
+	return out
+}
+
+// Bollinger returns the Bollinger bands of closes: the simple moving average over window closes
+// and the bands width standard deviations above and below it
+func Bollinger(closes []float64, window int, width float64) (middle, upper, lower []float64) {
+	middle = SMA(closes, window)
+	sd := StdDev(closes, window)
+	upper, lower = nanSeries(len(closes)), nanSeries(len(closes))
+	for i := range closes {
+		if !math.IsNaN(middle[i]) && !math.IsNaN(sd[i]) {
+			upper[i] = middle[i] + width*sd[i]
+			lower[i] = middle[i] - width*sd[i]
+		}
+	}
+	return middle, upper, lower
+}
+
+// ATR returns Wilder's average true range over window bars, seeded with the average of the first
+// window true ranges. Bars without a high or low range from their close.
+func ATR(bars []Bar, window int) []float64 {
+	out := nanSeries(len(bars))
+	if window <= 0 || len(bars) <= window {
+		return out
+	}
+	trueRange := func(i int) float64 {
+		high, low := bars[i].High, bars[i].Low
+		if high == 0 || low == 0 {
+			high, low = bars[i].Close, bars[i].Close
+		}
+		prev := bars[i-1].Close
+		return math.Max(high-low, math.Max(math.Abs(high-prev), math.Abs(low-prev)))
+	}
+	atr := 0.0
+	for i := 1; i <= window; i++ {
+		atr += trueRange(i)
+	}
+	atr /= float64(window)
+	out[window] = atr
+	for i := window + 1; i < len(bars); i++ {
+		atr = (atr*float64(window-1) + trueRange(i)) / float64(window)
+		out[i] = atr
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestVolatility checks the standard deviation, Bollinger bands and ATR of a short series
+func TestVolatility(t *testing.T) {
+	sd := StdDev([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 8)
+	if !math.IsNaN(sd[6]) || !near(sd[7], 2) {
+		t.Errorf("StdDev: %v", sd)
+	}
+
+	middle, upper, lower := Bollinger([]float64{1, 3, 1, 3}, 2, 2)
+	if !math.IsNaN(middle[0]) || !near(middle[1], 2) || !near(upper[1], 4) || !near(lower[1], 0) {
+		t.Errorf("Bollinger: %v %v %v", middle, upper, lower)
+	}
+
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := []Bar{
+		{Date: day, High: 11, Low: 9, Close: 10},
+		{Date: day.AddDate(0, 0, 1), High: 12, Low: 10, Close: 11}, // range 2
+		{Date: day.AddDate(0, 0, 2), High: 15, Low: 13, Close: 14}, // gap up from 11: 4
+		{Date: day.AddDate(0, 0, 3), Close: 14},                    // no range: 0
+	}
+	atr := ATR(bars, 2)
+	if !math.IsNaN(atr[1]) || !near(atr[2], 3) || !near(atr[3], 1.5) {
+		t.Errorf("ATR: %v", atr)
+	}
+
+	points := Volatility(bars, VolatilityOptions{StdDevWindow: 2, BollingerWindow: 2, BollingerWidth: 2, ATRWindow: 2})
+	if len(points) != len(bars) || !points[3].Date.Equal(bars[3].Date) || !near(points[3].ATR, 1.5) || math.IsNaN(points[2].StdDev) {
+		t.Errorf("Volatility: %+v", points)
+	}
+	if cells := points[0].Cells(); len(cells) != len(VolatilityNames) || cells[0] != "" {
+		t.Errorf("cells: %v", cells)
+	}
+}
@@ -0,0 +1,227 @@
+package analytics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sheets of the analytics workbook
+const (
+	summarySheet = "Summary"
+	moversSheet  = "Top Movers"
+	indicesSheet = "Indices"
+)
+
+// workbookStyles are the styles shared by the sheets of the workbook
+type workbookStyles struct {
+	header     int
+	gain, loss int // conditional styles
+}
+
+// writeWorkbook writes the summaries, the top movers report and the index closes to an .xlsx file
+// with a sheet each, numbers as numbers, gains and losses highlighted and a chart of the indices
+func writeWorkbook(path string, summaries []TickerSummary, windows []int, movers MoversReport, indices map[string]*TickerSeries) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	var styles workbookStyles
+	var err error
+	styles.header, err = f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"1F4E78"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Horizontal: "center"},
+	})
+	if err != nil {
+		return err
+	}
+	styles.gain, err = f.NewConditionalStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "006100"},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"C6EFCE"}, Pattern: 1},
+	})
+	if err != nil {
+		return err
+	}
+	styles.loss, err = f.NewConditionalStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "9C0006"},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"FFC7CE"}, Pattern: 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := f.SetSheetName("Sheet1", summarySheet); err != nil {
+		return err
+	}
+	summary := summaryRows(summaries, windows)
+	if err := writeSheet(f, summarySheet, summary, styles.header); err != nil {
+		return err
+	}
+	// Tickers beating the index are green, those lagging it red; the distance from the 52-week
+	// high is drawn as a bar
+	if err := highlight(f, summarySheet, summary, "RelativeStrength", "100", styles); err != nil {
+		return err
+	}
+	if col := slices.Index(summary[0], "PercentOffHigh"); col >= 0 && len(summary) > 1 {
+		if err := f.SetConditionalFormat(summarySheet, columnRange(col, len(summary)), []excelize.ConditionalFormatOptions{
+			{Type: "data_bar", Criteria: "=", MinType: "min", MaxType: "max", BarColor: "F4B183"},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.NewSheet(moversSheet); err != nil {
+		return err
+	}
+	moverRows := moversRows(movers)
+	if err := writeSheet(f, moversSheet, moverRows, styles.header); err != nil {
+		return err
+	}
+	if err := highlight(f, moversSheet, moverRows, "ChangePercent", "0", styles); err != nil {
+		return err
+	}
+
+	if _, err := f.NewSheet(indicesSheet); err != nil {
+		return err
+	}
+	indexRows := indexCloseRows(indices)
+	if err := writeSheet(f, indicesSheet, indexRows, styles.header); err != nil {
+		return err
+	}
+	if err := addIndexChart(f, indexRows); err != nil {
+		return err
+	}
+
+	return writeFile(path, func(w io.Writer) error {
+		return f.Write(w)
+	})
+}
+
+// writeSheet writes rows to a sheet with a frozen, filterable header row, numeric cells as numbers
+func writeSheet(f *excelize.File, sheet string, rows [][]string, headerStyle int) error {
+	for i, row := range rows {
+		values := make([]interface{}, len(row))
+		for j, cell := range row {
+			values[j] = cellValue(cell)
+			if i == 0 {
+				values[j] = cell
+			}
+		}
+		start, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(sheet, start, &values); err != nil {
+			return err
+		}
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil
+	}
+	last, err := excelize.ColumnNumberToName(len(rows[0]))
+	if err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheet, "A1", last+"1", headerStyle); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(sheet, "A", last, 14); err != nil {
+		return err
+	}
+	if err := f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+	return f.AutoFilter(sheet, fmt.Sprintf("A1:%s%d", last, len(rows)), nil)
+}
+
+// cellValue returns cell as a number when it is one, so Excel can sort and chart it. Names
+// ParseFloat reads as infinities or NaN stay text.
+func cellValue(cell string) interface{} {
+	if v, err := strconv.ParseFloat(cell, 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+		return v
+	}
+	return cell
+}
+
+// highlight colours the cells of a column above threshold as gains and those below as losses
+func highlight(f *excelize.File, sheet string, rows [][]string, column, threshold string, styles workbookStyles) error {
+	col := slices.Index(rows[0], column)
+	if col < 0 || len(rows) < 2 {
+		return nil
+	}
+	return f.SetConditionalFormat(sheet, columnRange(col, len(rows)), []excelize.ConditionalFormatOptions{
+		{Type: "cell", Criteria: ">", Format: &styles.gain, Value: threshold},
+		{Type: "cell", Criteria: "<", Format: &styles.loss, Value: threshold},
+	})
+}
+
+// columnRange returns the range of the data rows of the zero-based column col
+func columnRange(col, rows int) string {
+	name, _ := excelize.ColumnNumberToName(col + 1)
+	return fmt.Sprintf("%s2:%s%d", name, name, rows)
+}
+
+// indexCloseRows returns the closes of every index by date, one column per index sorted by name
+func indexCloseRows(indices map[string]*TickerSeries) [][]string {
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	closes := make(map[time.Time][]string)
+	for i, name := range names {
+		for _, b := range indices[name].Bars {
+			if closes[b.Date] == nil {
+				closes[b.Date] = make([]string, len(names))
+			}
+			closes[b.Date][i] = fmt.Sprintf("%.2f", b.Close)
+		}
+	}
+	dates := make([]time.Time, 0, len(closes))
+	for date := range closes {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	rows := [][]string{append([]string{"Date"}, names...)}
+	for _, date := range dates {
+		rows = append(rows, append([]string{date.Format("2006-01-02")}, closes[date]...))
+	}
+	return rows
+}
+
+// addIndexChart adds a line chart of the index closes next to them
+func addIndexChart(f *excelize.File, rows [][]string) error {
+	if len(rows) < 2 || len(rows[0]) < 2 {
+		return nil
+	}
+	last := len(rows)
+	chart := &excelize.Chart{
+		Type:   excelize.Line,
+		Title:  []excelize.RichTextRun{{Text: "ISX Indices"}},
+		Legend: excelize.ChartLegend{Position: "bottom"},
+		Format: excelize.GraphicOptions{OffsetX: 10, OffsetY: 10},
+		Dimension: excelize.ChartDimension{
+			Width:  960,
+			Height: 480,
+		},
+	}
+	for i := range rows[0][1:] {
+		col, _ := excelize.ColumnNumberToName(i + 2)
+		chart.Series = append(chart.Series, excelize.ChartSeries{
+			Name:       fmt.Sprintf("'%s'!$%s$1", indicesSheet, col),
+			Categories: fmt.Sprintf("'%s'!$A$2:$A$%d", indicesSheet, last),
+			Values:     fmt.Sprintf("'%s'!$%s$2:$%s$%d", indicesSheet, col, col, last),
+			Marker:     excelize.ChartMarker{Symbol: "none"},
+		})
+	}
+	anchor, _ := excelize.CoordinatesToCellName(len(rows[0])+2, 2)
+	return f.AddChart(indicesSheet, anchor, chart)
+}
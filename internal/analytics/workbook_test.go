@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// TestWriteWorkbook writes the workbook and reads its sheets back, numbers as numbers
+func TestWriteWorkbook(t *testing.T) {
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	summaries := []TickerSummary{{
+		Ticker: "BBOB", CompanyName: "Bank of Baghdad", LastPrice: 1.25, LastDate: "2025-03-02", TradingDays: 2,
+		Beta: math.NaN(), RelativeStrength: 104.5, Indicators: ComputeIndicators([]float64{1.25}, nil, nil)[0],
+	}}
+	movers := MoversReport{Date: "2025-03-02", Gainers: []Mover{{Ticker: "BBOB", Close: 1.25, ChangePercent: 4.2}}}
+	indices := map[string]*TickerSeries{
+		"ISX60": {Ticker: "ISX60", Bars: []Bar{{Date: day, Close: 900}, {Date: day.AddDate(0, 0, 1), Close: 910}}},
+		"ISX15": {Ticker: "ISX15", Bars: []Bar{{Date: day.AddDate(0, 0, 1), Close: 1000}}},
+	}
+
+	path := filepath.Join(t.TempDir(), "isx_analytics.xlsx")
+	if err := writeWorkbook(path, summaries, []int{20}, movers, indices); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if sheets := f.GetSheetList(); len(sheets) != 3 || sheets[0] != summarySheet {
+		t.Errorf("sheets: %v", sheets)
+	}
+	if v, _ := f.GetCellValue(summarySheet, "A2"); v != "BBOB" {
+		t.Errorf("summary ticker: %q", v)
+	}
+	// Numbers are stored without a cell type, text as shared strings
+	if typ, _ := f.GetCellType(summarySheet, "C2"); typ != excelize.CellTypeUnset && typ != excelize.CellTypeNumber {
+		t.Errorf("last price is not a number: %v", typ)
+	}
+	rows, err := f.GetRows(indicesSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][1] != "ISX15" || rows[1][1] != "" || rows[2][1] != "1000" || rows[2][2] != "910" {
+		t.Errorf("indices: %v", rows)
+	}
+	if v, _ := f.GetCellValue(moversSheet, "F2"); v != "4.2" {
+		t.Errorf("change percent: %q", v)
+	}
+}
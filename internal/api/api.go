@@ -0,0 +1,111 @@
+// Package api defines the REST API of the web interfaces: typed handlers of request and response
+// structs, answering errors with the same Error envelope, described by an OpenAPI specification
+// generated from the routes
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/mux"
+)
+
+// Param is a query parameter of a route; the path parameters are those of its path
+type Param struct {
+	Name        string
+	Type        string // a JSON schema type, "string" when ""
+	Description string
+}
+
+// Route is an endpoint of the API
+type Route struct {
+	Method  string
+	Path    string // as the router takes it, with {name} path parameters
+	Summary string
+	Query   []Param
+	// Request and Response are the types of the JSON bodies; a nil Response is any JSON
+	Request  reflect.Type
+	Response reflect.Type
+	File     string // the content type of a route downloading a file rather than answering JSON
+	Handler  http.Handler
+}
+
+// Handle returns the route of h, answering with its result as JSON or its error as an Error
+func Handle[Resp any](method, path, summary string, h func(*http.Request) (Resp, error), query ...Param) Route {
+	return Route{
+		Method:   method,
+		Path:     path,
+		Summary:  summary,
+		Query:    query,
+		Response: typeOf[Resp](),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resp, err := h(r)
+			write(w, resp, err)
+		}),
+	}
+}
+
+// HandleBody is Handle for a handler of the JSON request body, answering 400 Bad Request when the
+// body doesn't decode
+func HandleBody[Req, Resp any](method, path, summary string, h func(*http.Request, Req) (Resp, error), query ...Param) Route {
+	route := Handle(method, path, summary, func(r *http.Request) (Resp, error) {
+		var req Req
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var zero Resp
+			return zero, Errorf(http.StatusBadRequest, "invalid request body: %v", err).WithCode(CodeInvalidBody)
+		}
+		return h(r, req)
+	}, query...)
+	route.Request = typeOf[Req]()
+	return route
+}
+
+// Raw returns the route of a handler writing its own JSON response, documented as any JSON unless
+// its types are given with Accepts and Returns
+func Raw(method, path, summary string, h http.HandlerFunc, query ...Param) Route {
+	return Route{Method: method, Path: path, Summary: summary, Query: query, Handler: h}
+}
+
+// Download returns the route of a handler serving a file of contentType
+func Download(path, summary, contentType string, h http.HandlerFunc, query ...Param) Route {
+	return Route{Method: http.MethodGet, Path: path, Summary: summary, Query: query, File: contentType, Handler: h}
+}
+
+// Accepts documents the request body of the route as the JSON of v's type
+func (rt Route) Accepts(v interface{}) Route {
+	rt.Request = reflect.TypeOf(v)
+	return rt
+}
+
+// Returns documents the response of the route as the JSON of v's type, e.g. for a handler
+// answering with a file it reads
+func (rt Route) Returns(v interface{}) Route {
+	rt.Response = reflect.TypeOf(v)
+	return rt
+}
+
+// Register adds the routes to r, wrapping their handlers in middleware, the first outermost
+func Register(r *mux.Router, routes []Route, middleware ...func(http.Handler) http.Handler) {
+	for _, route := range routes {
+		h := route.Handler
+		for i := len(middleware) - 1; i >= 0; i-- {
+			h = middleware[i](h)
+		}
+		r.Handle(route.Path, h).Methods(route.Method)
+	}
+}
+
+// write answers with v as JSON, or with err as an Error envelope
+func write(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, v)
+}
+
+// typeOf returns the type T, an interface type included
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// serve answers req with the routes registered on a router
+func serve(routes []Route, req *http.Request, middleware ...func(http.Handler) http.Handler) *httptest.ResponseRecorder {
+	r := mux.NewRouter()
+	Register(r, routes, middleware...)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// TestHandle answers the results of typed handlers as JSON and their errors as Error envelopes
+func TestHandle(t *testing.T) {
+	routes := []Route{
+		Handle(http.MethodGet, "/api/echo/{word}", "Echo a word", func(r *http.Request) (map[string]string, error) {
+			word := mux.Vars(r)["word"]
+			if word == "fail" {
+				return nil, errors.New("failed")
+			}
+			if word == "missing" {
+				return nil, Errorf(http.StatusNotFound, "%s not found", word)
+			}
+			return map[string]string{"word": word}, nil
+		}),
+		HandleBody(http.MethodPost, "/api/run", "Run a command", func(r *http.Request, req CommandRequest) (CommandResponse, error) {
+			if req.Command == "busy" {
+				return CommandResponse{Error: "Another pipeline run is in progress", Busy: true}.Result()
+			}
+			return CommandResponse{Success: true}.Result()
+		}),
+	}
+
+	for _, c := range []struct {
+		req    *http.Request
+		status int
+		body   string
+	}{
+		{httptest.NewRequest(http.MethodGet, "/api/echo/hello", nil), http.StatusOK, `{"word":"hello"}`},
+		{httptest.NewRequest(http.MethodGet, "/api/echo/missing", nil), http.StatusNotFound, `{"code":"not_found","message":"missing not found"}`},
+		{httptest.NewRequest(http.MethodGet, "/api/echo/fail", nil), http.StatusInternalServerError, `{"code":"internal","message":"failed"}`},
+		{httptest.NewRequest(http.MethodPost, "/api/run", strings.NewReader(`{"command":"scrape"}`)), http.StatusOK, `{"success":true,"output":""}`},
+		{httptest.NewRequest(http.MethodPost, "/api/run", strings.NewReader(`{"command":"busy"}`)), http.StatusConflict, `{"code":"pipeline_busy","message":"Another pipeline run is in progress"}`},
+		{httptest.NewRequest(http.MethodPost, "/api/run", strings.NewReader(`{`)), http.StatusBadRequest, `{"code":"invalid_body","message":"invalid request body: unexpected EOF"}`},
+	} {
+		w := serve(routes, c.req)
+		if w.Code != c.status || strings.TrimSpace(w.Body.String()) != c.body || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s: %d %s", c.req.Method, c.req.URL, w.Code, w.Body)
+		}
+	}
+
+	// Middleware wraps every route
+	denied := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, NewError(http.StatusUnauthorized, "License required").WithDetail("redirect", "/license"))
+		})
+	}
+	w := serve(routes, httptest.NewRequest(http.MethodGet, "/api/echo/hello", nil), denied)
+	var e Error
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != http.StatusUnauthorized || e.Code != CodeLicenseRequired || e.Message != "License required" || e.Details["redirect"] != "/license" {
+		t.Errorf("middleware: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import "net/http"
+
+// CommandRequest runs, or previews, a pipeline command with its arguments, e.g. a scrape with
+// {"mode": "accumulative"}
+type CommandRequest struct {
+	Command string            `json:"command"`
+	Args    map[string]string `json:"args"`
+}
+
+// CommandResponse is the outcome of a pipeline command
+type CommandResponse struct {
+	Success bool   `json:"success"`
+	Output  string `json:"output"`
+	Error   string `json:"error,omitempty"`
+	Busy    bool   `json:"-"` // refused since another pipeline run is in progress
+}
+
+// Result returns the response, or a 409 Conflict pipeline_busy Error when the command was
+// refused since another pipeline run is in progress
+func (c CommandResponse) Result() (CommandResponse, error) {
+	if c.Busy {
+		return c, NewError(http.StatusConflict, c.Error).WithCode(CodePipelineBusy)
+	}
+	return c, nil
+}
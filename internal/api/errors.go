@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes, telling the errors of the same status apart without parsing their messages
+const (
+	CodeBadRequest  = "bad_request"
+	CodeInvalidBody = "invalid_body" // the request body isn't the JSON expected
+	CodeNotFound    = "not_found"
+	CodeConflict    = "conflict"
+	CodeUnavailable = "unavailable"
+	CodeInternal    = "internal"
+	CodeError       = "error" // of a status without a code of its own
+
+	CodePipelineBusy = "pipeline_busy" // another pipeline run is in progress
+
+	CodeLicenseRequired    = "license_required"
+	CodeLicenseExpired     = "license_expired"
+	CodeLicenseMismatch    = "license_machine_mismatch"
+	CodeLicenseNetwork     = "license_network_error"
+	CodeActivationFailed   = "license_activation_failed"
+	CodeTransferFailed     = "license_transfer_failed"
+	CodeLicenseUnavailable = "license_unavailable" // the license system failed to start
+)
+
+// Error is the body of every error response. The HTTP status is that of the response.
+type Error struct {
+	Status  int                    `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// NewError returns the error answered with status and message, coded by its status
+func NewError(status int, message string) *Error {
+	return &Error{Status: status, Code: statusCode(status), Message: message}
+}
+
+// Errorf is NewError with a formatted message
+func Errorf(status int, format string, args ...interface{}) *Error {
+	return NewError(status, fmt.Sprintf(format, args...))
+}
+
+// WithCode sets the code of e, returning it
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetail adds a detail to e, returning it
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// statusCode returns the code of the errors of status without a more specific one
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeLicenseRequired
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeError
+}
+
+// WriteError answers with err as an Error envelope: err itself when it is one, 500 Internal
+// Server Error otherwise
+func WriteError(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = NewError(http.StatusInternalServerError, err.Error())
+	}
+	WriteJSON(w, e.Status, e)
+}
+
+// WriteJSON answers with status and v as JSON
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Info describes the API in its specification
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// SpecPath is the path the specification is served at
+const SpecPath = "/api/openapi.json"
+
+// SpecRoute returns the route serving the OpenAPI specification of routes and of itself
+func SpecRoute(info Info, routes []Route) Route {
+	route := Raw(http.MethodGet, SpecPath, "The OpenAPI specification of the API", nil)
+	spec, err := json.MarshalIndent(Spec(info, append(routes[:len(routes):len(routes)], route)), "", "  ")
+	route.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	return route
+}
+
+// pathParam matches the {name} parameters of a route path
+var pathParam = regexp.MustCompile(`{(\w+)}`)
+
+// Spec returns the OpenAPI 3 specification of routes. The schemas of the bodies are generated
+// from their types; a type marshalling itself is described by the JSON of its zero value.
+func Spec(info Info, routes []Route) map[string]interface{} {
+	s := &schemas{defs: map[string]interface{}{}, names: map[reflect.Type]string{}}
+	errorSchema := s.of(reflect.TypeOf(Error{}))
+
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		var params []interface{}
+		for _, m := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range route.Query {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			params = append(params, map[string]interface{}{
+				"name": p.Name, "in": "query", "description": p.Description, "schema": map[string]interface{}{"type": typ},
+			})
+		}
+
+		ok := map[string]interface{}{"description": "OK"}
+		if route.File != "" {
+			ok["content"] = map[string]interface{}{
+				route.File: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+			}
+		} else {
+			body := map[string]interface{}{}
+			if route.Response != nil {
+				body = s.of(route.Response)
+			}
+			ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": body}}
+		}
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+			"tags":        []string{tag(route.Path)},
+			"responses": map[string]interface{}{
+				"200": ok,
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorSchema}},
+				},
+			},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if route.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": s.of(route.Request)}},
+			}
+		}
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]interface{}{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": s.defs},
+	}
+}
+
+// tag groups a route by the first segment of its path after /api, e.g. "ticker"
+func tag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/api"), "/")
+	if len(segments) < 2 || segments[1] == "" {
+		return "api"
+	}
+	return segments[1]
+}
+
+// operationID names a route by its method and path, e.g. getTickerTickerReturns
+func operationID(route Route) string {
+	id := strings.ToLower(route.Method)
+	for _, f := range strings.FieldsFunc(strings.TrimPrefix(route.Path, "/api"), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		id += strings.ToUpper(f[:1]) + f[1:]
+	}
+	return id
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemas generates the schemas of types, defining the named structs as components
+type schemas struct {
+	defs  map[string]interface{}
+	names map[reflect.Type]string
+}
+
+// of returns the schema of t, a reference for a named struct
+func (s *schemas) of(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Kind() == reflect.Pointer {
+		return s.of(t.Elem())
+	}
+	if t.Name() != "" && t.Kind() == reflect.Struct {
+		return s.ref(t)
+	}
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return s.marshaled(t) // e.g. a json.RawMessage
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		return s.object(t)
+	}
+	return map[string]interface{}{} // any JSON, e.g. of an interface{}
+}
+
+// ref defines the component of a named type, once, returning the reference to it. Types of
+// different packages sharing a name are told apart by their package.
+func (s *schemas) ref(t reflect.Type) map[string]interface{} {
+	name, ok := s.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := s.defs[name]; taken {
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		s.names[t] = name
+		s.defs[name] = map[string]interface{}{} // recursive types refer to it while it's generated
+		if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+			s.defs[name] = s.marshaled(t)
+		} else {
+			s.defs[name] = s.object(t)
+		}
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// object returns the schema of the JSON object of a struct: its exported fields under their json
+// names, those of embedded structs included, the fields without omitempty required
+func (s *schemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				add(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if strings.Contains(opts, "string") {
+				properties[name] = map[string]interface{}{"type": "string"}
+			} else {
+				properties[name] = s.of(f.Type)
+			}
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// marshaled returns the schema of the JSON a type marshalling itself writes for its zero value
+func (s *schemas) marshaled(t reflect.Type) map[string]interface{} {
+	data, err := json.Marshal(reflect.Zero(t).Interface())
+	var v interface{}
+	if err != nil || json.Unmarshal(data, &v) != nil {
+		return map[string]interface{}{}
+	}
+	return inferred(v)
+}
+
+// inferred returns the schema of a decoded JSON value
+func inferred(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case float64:
+		return map[string]interface{}{"type": "number"}
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case []interface{}:
+		items := map[string]interface{}{}
+		if len(v) > 0 {
+			items = inferred(v[0])
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	case map[string]interface{}:
+		properties := map[string]interface{}{}
+		for k, e := range v {
+			properties[k] = inferred(e)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{} // null
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"isxcli/internal/pipeline"
+)
+
+// TestSpec describes the routes, their parameters and bodies, with every schema referenced defined
+func TestSpec(t *testing.T) {
+	routes := append(Reports{Dir: t.TempDir()}.Routes(), Runs{History: pipeline.NewHistory("")}.Routes()...)
+	routes = append(routes, HandleBody(http.MethodPost, "/api/scrape", "Scrape", func(r *http.Request, req CommandRequest) (CommandResponse, error) {
+		return CommandResponse{}, nil
+	}))
+	spec := SpecRoute(Info{Title: "ISX", Version: "1.0.0"}, routes)
+
+	w := httptest.NewRecorder()
+	spec.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, SpecPath, nil))
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string   `json:"operationId"`
+			Tags        []string `json:"tags"`
+			Parameters  []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			RequestBody json.RawMessage            `json:"requestBody"`
+			Responses   map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths) != len(routes)+1 || doc.Paths[SpecPath]["get"].OperationID != "getOpenapiJson" {
+		t.Fatalf("paths: %v", doc.Paths)
+	}
+
+	ticker := doc.Paths["/api/ticker/{ticker}"]["get"]
+	if ticker.OperationID != "getTickerTicker" || ticker.Tags[0] != "ticker" || len(ticker.Parameters) != 6 ||
+		ticker.Parameters[0].In != "path" || ticker.Parameters[5].Name != "resample" {
+		t.Errorf("ticker: %+v", ticker)
+	}
+	if string(doc.Paths["/api/analytics/workbook"]["get"].Responses["200"]) == "" ||
+		!strings.Contains(string(doc.Paths["/api/analytics/workbook"]["get"].Responses["200"]), "spreadsheetml") {
+		t.Errorf("workbook: %s", doc.Paths["/api/analytics/workbook"]["get"].Responses["200"])
+	}
+	if !strings.Contains(string(doc.Paths["/api/scrape"]["post"].RequestBody), "#/components/schemas/CommandRequest") {
+		t.Errorf("scrape body: %s", doc.Paths["/api/scrape"]["post"].RequestBody)
+	}
+
+	response := doc.Components.Schemas["CommandResponse"]
+	if len(response.Properties) != 3 || strings.Join(response.Required, ",") != "success,output" {
+		t.Errorf("CommandResponse: %+v", response)
+	}
+	if e := doc.Components.Schemas["Error"]; len(e.Properties) != 3 || strings.Join(e.Required, ",") != "code,message" {
+		t.Errorf("Error: %+v", e)
+	}
+	// Types marshalling themselves are described by their JSON
+	if _, ok := doc.Components.Schemas["Drawdown"].Properties["max_drawdown"]; !ok {
+		t.Errorf("Drawdown: %+v", doc.Components.Schemas["Drawdown"])
+	}
+
+	for _, ref := range strings.Split(w.Body.String(), `"$ref": "#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s not defined", name)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"isxcli/internal/analytics"
+	"isxcli/internal/csvgz"
+
+	"github.com/gorilla/mux"
+)
+
+// Reports serves the ticker histories and analytics the processor writes to Dir
+type Reports struct {
+	Dir string
+}
+
+// Returns is the return series of a ticker
+type Returns struct {
+	Ticker  string                  `json:"ticker"`
+	Returns []analytics.ReturnPoint `json:"returns"`
+	Count   int                     `json:"count"`
+}
+
+// Sectors are the sector aggregates
+type Sectors struct {
+	Sectors []analytics.SectorDay `json:"sectors"`
+	Count   int                   `json:"count"`
+}
+
+// Breadth is the market breadth of the sessions
+type Breadth struct {
+	Breadth []analytics.BreadthDay `json:"breadth"`
+	Count   int                    `json:"count"`
+}
+
+// Calendar are the trading statistics of years and months
+type Calendar struct {
+	Periods []analytics.CalendarStats `json:"periods"`
+	Count   int                       `json:"count"`
+}
+
+// Drawdowns are the drawdowns of the tickers and indices
+type Drawdowns struct {
+	Drawdowns []analytics.Drawdown `json:"drawdowns"`
+	Count     int                  `json:"count"`
+}
+
+// Anomalies are the price anomalies found in the data
+type Anomalies struct {
+	Anomalies []analytics.Anomaly `json:"anomalies"`
+	Count     int                 `json:"count"`
+}
+
+// Analyzers are the custom analyzers of the last processing run and their outputs
+type Analyzers struct {
+	Analyzers []analytics.AnalyzerResult `json:"analyzers"`
+	Count     int                        `json:"count"`
+}
+
+// AnalyzerOutput is an output of a custom analyzer as rows keyed by column
+type AnalyzerOutput struct {
+	Analyzer string              `json:"analyzer"`
+	Output   string              `json:"output"`
+	Rows     []map[string]string `json:"rows"`
+	Count    int                 `json:"count"`
+}
+
+// Routes returns the routes of the reports
+func (s Reports) Routes() []Route {
+	date := Param{Name: "date", Description: "the session, YYYY-MM-DD; the latest when unset"}
+	return []Route{
+		Handle(http.MethodGet, "/api/ticker/{ticker}", "The history of a ticker", s.ticker,
+			Param{Name: "from", Description: "first day, YYYY-MM-DD"},
+			Param{Name: "to", Description: "last day, YYYY-MM-DD"},
+			Param{Name: "limit", Type: "integer", Description: "the latest records of the range"},
+			Param{Name: "fields", Description: "comma-separated fields of the records: " + strings.Join(analytics.HistoryFields, ", ")},
+			Param{Name: "resample", Description: "weekly or monthly aggregates the trading days"}),
+		Handle(http.MethodGet, "/api/ticker/{ticker}/returns", "The return series of a ticker", s.returns,
+			Param{Name: "from", Description: "first day, YYYY-MM-DD"},
+			Param{Name: "to", Description: "last day, YYYY-MM-DD"}),
+		Handle(http.MethodGet, "/api/ticker/{ticker}/ohlcv", "The candles of a ticker as [timestamp, open, high, low, close, volume] arrays", s.ohlcv,
+			Param{Name: "resolution", Description: "daily, weekly or monthly"}),
+		Handle(http.MethodGet, "/api/ticker/{ticker}/stats", "The summary, latest indicators and recent candles of a ticker", s.stats).
+			Returns(analytics.TickerStats{}),
+		Handle(http.MethodGet, "/api/movers", "The top movers of a session", s.movers, date).
+			Returns(analytics.MoversReport{}),
+		Handle(http.MethodGet, "/api/signals", "The technical signals of a session", s.signals, date,
+			Param{Name: "type", Description: "only the signals of a type, e.g. golden_cross"}),
+		Handle(http.MethodGet, "/api/sectors", "The sector aggregates: every sector on the latest date, or the series of one", s.sectors,
+			Param{Name: "sector", Description: "the series of a sector"}),
+		Handle(http.MethodGet, "/api/breadth", "The market breadth of the sessions", s.breadth,
+			Param{Name: "days", Type: "integer", Description: "the last sessions only"}),
+		Handle(http.MethodGet, "/api/calendar", "The trading statistics of the years and months", s.calendar,
+			Param{Name: "period", Description: "year or month only"},
+			Param{Name: "year", Description: "the periods of a year, YYYY"}),
+		Handle(http.MethodGet, "/api/analytics/correlation", "The correlation matrix of the daily returns", s.correlation,
+			Param{Name: "tickers", Description: "comma-separated tickers; all when unset"},
+			Param{Name: "index", Description: "the index included, ISX60 by default, none for no index"},
+			Param{Name: "window", Type: "integer", Description: "trading days, 60 by default"},
+			Param{Name: "end", Description: "last day, YYYY-MM-DD"}),
+		Handle(http.MethodGet, "/api/analytics/drawdown", "The drawdowns of the tickers and indices", s.drawdown,
+			Param{Name: "ticker", Description: "only the drawdown of a ticker or index, e.g. ISX60"}),
+		Handle(http.MethodGet, "/api/analytics/anomalies", "The price anomalies found in the data", s.anomalies,
+			Param{Name: "ticker", Description: "only the anomalies of a ticker"},
+			Param{Name: "check", Description: "return_zscore, ohlc_inconsistent or stale_price"}),
+		Handle(http.MethodGet, "/api/analytics/custom", "The custom analyzers of the last processing run and their outputs", s.analyzers),
+		Handle(http.MethodGet, "/api/analytics/custom/{analyzer}/{output}", "An output of a custom analyzer", s.analyzerOutput),
+		Download("/api/analytics/workbook", "The Excel analytics workbook",
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", s.workbook),
+	}
+}
+
+// loadError is the error of a report failing to load: 404 Not Found with missing when it doesn't
+// exist, 500 Internal Server Error with failed otherwise
+func loadError(err error, missing, failed string) *Error {
+	if os.IsNotExist(err) {
+		return NewError(http.StatusNotFound, missing)
+	}
+	return NewError(http.StatusInternalServerError, failed)
+}
+
+// ticker serves the history of a ticker from its CSV, see analytics.ParseHistoryQuery
+func (s Reports) ticker(r *http.Request) (analytics.HistoryPage, error) {
+	ticker := mux.Vars(r)["ticker"]
+	query, err := analytics.ParseHistoryQuery(r.URL.Query())
+	if err != nil {
+		return analytics.HistoryPage{}, Errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	// Try both possible CSV file names, either may be stored compressed
+	found := ""
+	for _, name := range []string{ticker + ".csv", ticker + "_trading_history.csv"} {
+		if path := filepath.Join(s.Dir, name); csvgz.Exists(path) {
+			found = path
+			break
+		}
+	}
+	if found == "" {
+		return analytics.HistoryPage{}, Errorf(http.StatusNotFound, "Ticker %s not found", ticker)
+	}
+
+	series, err := analytics.LoadTickerHistory(found, ticker)
+	if err != nil {
+		log.Printf("Error reading ticker %s: %v", ticker, err)
+		return analytics.HistoryPage{}, Errorf(http.StatusInternalServerError, "Failed to read ticker history")
+	}
+	return analytics.QueryHistory(series, query), nil
+}
+
+// returns serves the return series of a ticker, written by the processor to <TICKER>_returns.csv
+func (s Reports) returns(r *http.Request) (Returns, error) {
+	ticker := mux.Vars(r)["ticker"]
+	points, err := analytics.LoadReturns(analytics.ReturnsFile(s.Dir, ticker))
+	if err != nil {
+		return Returns{}, loadError(err, "No returns available for ticker, process the data first", "Failed to read returns")
+	}
+
+	// The dates sort as strings
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	kept := []analytics.ReturnPoint{}
+	for _, p := range points {
+		date := p.Date.Format("2006-01-02")
+		if (from == "" || date >= from) && (to == "" || date <= to) {
+			kept = append(kept, p)
+		}
+	}
+	return Returns{Ticker: ticker, Returns: kept, Count: len(kept)}, nil
+}
+
+// ohlcv serves the candles of a ticker, daily or resampled
+func (s Reports) ohlcv(r *http.Request) ([][]float64, error) {
+	candles, err := analytics.LoadCandles(analytics.CandlesFile(s.Dir, mux.Vars(r)["ticker"]))
+	if err != nil {
+		return nil, loadError(err, "No candles available for ticker, process the data first", "Failed to read candles")
+	}
+	candles, err = analytics.ResampleCandles(candles, r.URL.Query().Get("resolution"))
+	if err != nil {
+		return nil, Errorf(http.StatusBadRequest, "%v", err)
+	}
+	return candles, nil
+}
+
+// stats serves the <TICKER>.json stat file of a ticker as it is
+func (s Reports) stats(r *http.Request) (json.RawMessage, error) {
+	data, err := os.ReadFile(analytics.StatsFile(s.Dir, mux.Vars(r)["ticker"]))
+	if err != nil {
+		return nil, loadError(err, "No stats available for ticker, process the data first", "Failed to read ticker stats")
+	}
+	return data, nil
+}
+
+// movers serves the top movers report of a session as it is
+func (s Reports) movers(r *http.Request) (json.RawMessage, error) {
+	path, err := analytics.MoversFile(s.Dir, r.URL.Query().Get("date"))
+	if err != nil {
+		return nil, datedError(err, "no top movers report available, process the data first")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, Errorf(http.StatusInternalServerError, "Failed to read top movers report")
+	}
+	return data, nil
+}
+
+// signals serves the technical signals report of a session, optionally those of one type only
+func (s Reports) signals(r *http.Request) (analytics.SignalsReport, error) {
+	var report analytics.SignalsReport
+	path, err := analytics.SignalsFile(s.Dir, r.URL.Query().Get("date"))
+	if err != nil {
+		return report, datedError(err, "no signals report available, process the data first")
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &report)
+	}
+	if err != nil {
+		return report, Errorf(http.StatusInternalServerError, "Failed to read signals report")
+	}
+	if kind := r.URL.Query().Get("type"); kind != "" {
+		kept := []analytics.Signal{}
+		for _, s := range report.Signals {
+			if s.Type == kind {
+				kept = append(kept, s)
+			}
+		}
+		report.Signals = kept
+	}
+	return report, nil
+}
+
+// datedError is the error of a dated report failing to be found: 404 Not Found with missing when
+// there is none, 400 Bad Request for an invalid date
+func datedError(err error, missing string) *Error {
+	if os.IsNotExist(err) {
+		return NewError(http.StatusNotFound, missing)
+	}
+	return Errorf(http.StatusBadRequest, "%v", err)
+}
+
+// sectors serves the series of a sector, or every sector on the latest date
+func (s Reports) sectors(r *http.Request) (Sectors, error) {
+	days, err := analytics.LoadSectorSummary(filepath.Join(s.Dir, "sector_summary.csv"))
+	if err != nil {
+		return Sectors{}, loadError(err, "No sector summary available, process the data first", "Failed to read sector summary")
+	}
+	sectors := analytics.FilterSectors(days, r.URL.Query().Get("sector"))
+	return Sectors{Sectors: sectors, Count: len(sectors)}, nil
+}
+
+// breadth serves the market breadth of every session, or of the last ?days= sessions
+func (s Reports) breadth(r *http.Request) (Breadth, error) {
+	days, err := analytics.LoadBreadth(filepath.Join(s.Dir, "market_breadth.csv"))
+	if err != nil {
+		return Breadth{}, loadError(err, "No market breadth available, process the data first", "Failed to read market breadth")
+	}
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return Breadth{}, Errorf(http.StatusBadRequest, "Invalid days")
+		}
+		if n < len(days) {
+			days = days[len(days)-n:]
+		}
+	}
+	return Breadth{Breadth: days, Count: len(days)}, nil
+}
+
+// calendar serves the trading statistics of every year and month, or of the years or months only,
+// optionally limited to a year
+func (s Reports) calendar(r *http.Request) (Calendar, error) {
+	period, year := r.URL.Query().Get("period"), r.URL.Query().Get("year")
+	if period != "" && period != "year" && period != "month" {
+		return Calendar{}, Errorf(http.StatusBadRequest, "Invalid period (want year or month)")
+	}
+	if _, err := strconv.Atoi(year); year != "" && (err != nil || len(year) != 4) {
+		return Calendar{}, Errorf(http.StatusBadRequest, "Invalid year")
+	}
+	stats, err := analytics.LoadCalendarStats(filepath.Join(s.Dir, "calendar_stats.csv"))
+	if err != nil {
+		return Calendar{}, loadError(err, "No calendar statistics available, process the data first", "Failed to read calendar statistics")
+	}
+
+	kept := []analytics.CalendarStats{}
+	for _, c := range stats {
+		// Years are YYYY and months YYYY-MM
+		if (period == "year" && len(c.Period) != 4) || (period == "month" && len(c.Period) == 4) {
+			continue
+		}
+		if year != "" && !strings.HasPrefix(c.Period, year) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return Calendar{Periods: kept, Count: len(kept)}, nil
+}
+
+// correlation serves the correlation matrix of the daily returns of the tickers and an index over
+// a window of trading days up to an end date
+func (s Reports) correlation(r *http.Request) (analytics.CorrelationMatrix, error) {
+	var matrix analytics.CorrelationMatrix
+	query := r.URL.Query()
+	window := 60
+	if v := query.Get("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return matrix, Errorf(http.StatusBadRequest, "Invalid window")
+		}
+		window = n
+	}
+	var end time.Time
+	if v := query.Get("end"); v != "" {
+		var err error
+		if end, err = time.Parse("2006-01-02", v); err != nil {
+			return matrix, Errorf(http.StatusBadRequest, "Invalid end date (want YYYY-MM-DD)")
+		}
+	}
+	var tickers []string
+	for _, t := range strings.Split(query.Get("tickers"), ",") {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			tickers = append(tickers, t)
+		}
+	}
+
+	series, err := analytics.LoadSeries(filepath.Join(s.Dir, "isx_combined_data.csv"))
+	if err != nil {
+		return matrix, Errorf(http.StatusNotFound, "No data available, process the data first")
+	}
+	selected, err := analytics.SelectSeries(series, tickers)
+	if err != nil {
+		return matrix, Errorf(http.StatusBadRequest, "%v", err)
+	}
+	if index := query.Get("index"); index != "none" {
+		if index == "" {
+			index = "ISX60"
+		}
+		// The index is optional unless asked for by name
+		indices, err := analytics.LoadIndexSeries(filepath.Join(s.Dir, "indexes.csv"))
+		if s, ok := indices[index]; err == nil && ok {
+			selected = append(selected, s)
+		} else if query.Get("index") != "" {
+			return matrix, Errorf(http.StatusNotFound, "Index %s not found in indexes.csv", index)
+		}
+	}
+	return analytics.Correlation(selected, window, end), nil
+}
+
+// drawdown serves the drawdowns of every ticker and index, or of one
+func (s Reports) drawdown(r *http.Request) (Drawdowns, error) {
+	drawdowns, err := analytics.LoadDrawdowns(filepath.Join(s.Dir, "drawdown_summary.csv"))
+	if err != nil {
+		return Drawdowns{}, loadError(err, "No drawdown summary available, process the data first", "Failed to read drawdown summary")
+	}
+	if ticker := r.URL.Query().Get("ticker"); ticker != "" {
+		for _, d := range drawdowns {
+			if strings.EqualFold(d.Ticker, ticker) {
+				return Drawdowns{Drawdowns: []analytics.Drawdown{d}, Count: 1}, nil
+			}
+		}
+		return Drawdowns{}, Errorf(http.StatusNotFound, "Ticker %s not found", ticker)
+	}
+	return Drawdowns{Drawdowns: drawdowns, Count: len(drawdowns)}, nil
+}
+
+// anomalies serves the price anomalies found in the data, optionally those of a ticker and check
+func (s Reports) anomalies(r *http.Request) (Anomalies, error) {
+	anomalies, err := analytics.LoadAnomalies(filepath.Join(s.Dir, "anomalies.csv"))
+	if err != nil {
+		return Anomalies{}, loadError(err, "No anomalies available, process the data first", "Failed to read anomalies")
+	}
+
+	ticker, check := r.URL.Query().Get("ticker"), r.URL.Query().Get("check")
+	kept := []analytics.Anomaly{}
+	for _, a := range anomalies {
+		if (ticker == "" || strings.EqualFold(a.Ticker, ticker)) && (check == "" || a.Check == check) {
+			kept = append(kept, a)
+		}
+	}
+	return Anomalies{Anomalies: kept, Count: len(kept)}, nil
+}
+
+// analyzers lists the custom analyzers of the last processing run and their outputs
+func (s Reports) analyzers(r *http.Request) (Analyzers, error) {
+	results, err := analytics.LoadAnalyzerResults(s.Dir)
+	if err != nil {
+		return Analyzers{}, loadError(err, "No analyzer outputs available, process the data first", "Failed to read the analyzer outputs")
+	}
+	return Analyzers{Analyzers: results, Count: len(results)}, nil
+}
+
+// analyzerOutput serves one output of a custom analyzer
+func (s Reports) analyzerOutput(r *http.Request) (AnalyzerOutput, error) {
+	vars := mux.Vars(r)
+	rows, err := analytics.LoadOutput(s.Dir, vars["analyzer"], vars["output"])
+	if err != nil {
+		return AnalyzerOutput{}, loadError(err, fmt.Sprintf("Analyzer output %s/%s not found", vars["analyzer"], vars["output"]), "Failed to read the analyzer output")
+	}
+	return AnalyzerOutput{Analyzer: vars["analyzer"], Output: vars["output"], Rows: rows, Count: len(rows)}, nil
+}
+
+// workbook downloads the Excel analytics workbook written by the processor
+func (s Reports) workbook(w http.ResponseWriter, r *http.Request) {
+	path := filepath.Join(s.Dir, "isx_analytics.xlsx")
+	if _, err := os.Stat(path); err != nil {
+		WriteError(w, NewError(http.StatusNotFound, "No analytics workbook available, process the data first"))
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=isx_analytics.xlsx")
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"isxcli/internal/analytics"
+)
+
+// TestReports serves a ticker history from the reports directory and answers the reports not
+// written yet with 404 Not Found
+func TestReports(t *testing.T) {
+	dir := t.TempDir()
+	csv := "Date,CompanyName,Symbol,ClosePrice,Volume,TradingStatus\n" +
+		"2025-03-02,Bank of Baghdad,BBOB,11,100,true\n" +
+		"2025-03-03,Bank of Baghdad,BBOB,13,50,true\n"
+	if err := os.WriteFile(filepath.Join(dir, "BBOB_trading_history.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	routes := Reports{Dir: dir}.Routes()
+
+	w := serve(routes, httptest.NewRequest(http.MethodGet, "/api/ticker/BBOB?limit=1&fields=date,close", nil))
+	var page analytics.HistoryPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("%d %s", w.Code, w.Body)
+	}
+	if page.Total != 2 || page.Next != "2025-03-02" || len(page.Records) != 1 || page.Records[0]["close"] != 13.0 {
+		t.Errorf("page: %+v", page)
+	}
+
+	for url, status := range map[string]int{
+		"/api/ticker/TASC":            http.StatusNotFound,
+		"/api/ticker/BBOB?limit=x":    http.StatusBadRequest,
+		"/api/breadth":                http.StatusNotFound,
+		"/api/movers?date=2025/03/02": http.StatusBadRequest,
+		"/api/analytics/workbook":     http.StatusNotFound,
+	} {
+		w := serve(routes, httptest.NewRequest(http.MethodGet, url, nil))
+		var e Error
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != status || e.Code != statusCode(status) || e.Message == "" {
+			t.Errorf("%s: %d %s", url, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"isxcli/internal/pipeline"
+
+	"github.com/gorilla/mux"
+)
+
+// Runs serves the pipeline runs recorded in History
+type Runs struct {
+	History *pipeline.History
+}
+
+// Routes returns the routes of the runs
+func (s Runs) Routes() []Route {
+	return []Route{
+		Handle(http.MethodGet, "/api/pipeline/runs", "The recorded pipeline runs, the latest first", s.list,
+			Param{Name: "limit", Type: "integer", Description: "the latest runs, 50 by default"}),
+		Handle(http.MethodGet, "/api/pipeline/runs/{id}", "A recorded pipeline run with the timings, record counts and errors of its stages", s.get),
+	}
+}
+
+// list lists the recorded runs, the latest first, up to ?limit
+func (s Runs) list(r *http.Request) ([]pipeline.Run, error) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, Errorf(http.StatusBadRequest, "invalid limit %q", v)
+		}
+		limit = n
+	}
+	runs, err := s.History.List(limit)
+	if err != nil {
+		return nil, err
+	}
+	if runs == nil {
+		runs = []pipeline.Run{}
+	}
+	return runs, nil
+}
+
+// get returns a recorded run
+func (s Runs) get(r *http.Request) (pipeline.Run, error) {
+	run, err := s.History.Get(mux.Vars(r)["id"])
+	if errors.Is(err, pipeline.ErrRunNotFound) {
+		return run, Errorf(http.StatusNotFound, "%v", err)
+	}
+	return run, err
+}
@@ -0,0 +1,123 @@
+// Package csvgz finds, reads and serves CSV outputs that may be stored gzip-compressed. The
+// processor writes name.csv.gz instead of name.csv when asked to compress; readers keep asking for
+// name.csv and get whichever form exists.
+package csvgz
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Ext is appended to the name of a compressed CSV file
+const Ext = ".gz"
+
+// Counterpart returns the other form of path: path.gz for path, and path for path.gz
+func Counterpart(path string) string {
+	if strings.HasSuffix(path, Ext) {
+		return strings.TrimSuffix(path, Ext)
+	}
+	return path + Ext
+}
+
+// Name returns the name a file is listed and downloaded under: compressed files go by the name of
+// the CSV they hold
+func Name(file string) string {
+	if strings.HasSuffix(strings.ToLower(file), ".csv"+Ext) {
+		return file[:len(file)-len(Ext)]
+	}
+	return file
+}
+
+// Resolve returns path, or its counterpart when only that exists. When both exist the newer one
+// wins, since it was written by the latest run. The error is the one of path when neither does.
+func Resolve(path string) (string, error) {
+	info, err := os.Stat(path)
+	other, otherErr := os.Stat(Counterpart(path))
+	switch {
+	case err != nil && otherErr != nil:
+		return "", err
+	case err != nil:
+		return Counterpart(path), nil
+	case otherErr == nil && other.ModTime().After(info.ModTime()):
+		return Counterpart(path), nil
+	}
+	return path, nil
+}
+
+// Exists reports whether path or its counterpart exists
+func Exists(path string) bool {
+	_, err := Resolve(path)
+	return err == nil
+}
+
+// Open opens path or its counterpart, decompressing a .gz file transparently
+func Open(path string) (io.ReadCloser, error) {
+	resolved, err := Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(resolved, Ext) {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &reader{Reader: gz, file: file}, nil
+}
+
+// reader closes the gzip stream and the file under it
+type reader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *reader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// Serve writes the CSV at path or its counterpart. A compressed file is sent as is with
+// Content-Encoding: gzip to clients accepting it, and decompressed for the others. A Content-Type
+// set by the caller is kept.
+func Serve(w http.ResponseWriter, r *http.Request, path string) error {
+	resolved, err := Resolve(path)
+	if err != nil {
+		return err
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	if !strings.HasSuffix(resolved, Ext) {
+		http.ServeFile(w, r, resolved)
+		return nil
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		file, err := os.Open(resolved)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		_, err = io.Copy(w, file)
+		return err
+	}
+
+	rc, err := Open(resolved)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(w, rc)
+	return err
+}
@@ -0,0 +1,64 @@
+package csvgz
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenAndServe verifies that a CSV stored compressed, in two appended gzip members, is read
+// and served under its plain name.
+func TestOpenAndServe(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.csv")
+
+	file, err := os.Create(path + Ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"Date,Symbol\n", "2025-06-24,BBOB\n"} {
+		gz := gzip.NewWriter(file)
+		gz.Write([]byte(part))
+		gz.Close()
+	}
+	file.Close()
+	want := "Date,Symbol\n2025-06-24,BBOB\n"
+
+	if !Exists(path) {
+		t.Fatal("compressed file not found under its plain name")
+	}
+	rc, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != want {
+		t.Errorf("Open: want %q, got %q (%v)", want, data, err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := Serve(rec, httptest.NewRequest("GET", "/data.csv", nil), path); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != want {
+		t.Errorf("Serve without gzip: want %q, got %q", want, rec.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/data.csv", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec = httptest.NewRecorder()
+	if err := Serve(rec, req, path); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("Serve with gzip: expected the file to be sent compressed")
+	}
+
+	if got := Name("data.csv.gz"); got != "data.csv" {
+		t.Errorf("Name: want data.csv, got %q", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Package formats fingerprints ISX daily reports so the layout the trading table was published in
+// is known before parsing, and reports published in the same format can be grouped together.
+package formats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"isxcli/internal/parser"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Fingerprint describes the format of one report file
+type Fingerprint struct {
+	SHA256    string   `json:"sha256"` // content hash of the file the fingerprint was taken from
+	Signature string   `json:"signature"`
+	Sheets    []string `json:"sheets"`
+	Sheet     string   `json:"sheet"`  // trading sheet
+	Layout    string   `json:"layout"` // registry layout of the trading table
+	Merged    bool     `json:"merged,omitempty"`
+	HeaderRow int      `json:"header_row"` // zero-based, -1 for headerless reports
+	Header    []string `json:"header,omitempty"`
+
+	// Where the ISX60/ISX15 index line was found, if anywhere
+	IndexSheet string `json:"index_sheet,omitempty"`
+	IndexRow   int    `json:"index_row,omitempty"` // one-based
+	IndexLine  string `json:"index_line,omitempty"`
+}
+
+// Identify fingerprints a report file
+func Identify(path string, opts parser.Options) (Fingerprint, error) {
+	hash, err := parser.FileHash(path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return Fingerprint{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	fp, err := IdentifyWorkbook(f, path, opts)
+	fp.SHA256 = hash
+	return fp, err
+}
+
+// IdentifyWorkbook fingerprints an open workbook. name is the report's file name. The fingerprint
+// carries the sheet list and index line even when no trading table could be found.
+func IdentifyWorkbook(f *excelize.File, name string, opts parser.Options) (Fingerprint, error) {
+	fp := Fingerprint{Sheets: f.GetSheetList(), HeaderRow: -1}
+	fp.IndexSheet, fp.IndexRow, fp.IndexLine, _ = FindIndexLine(f, opts)
+
+	d, err := parser.DetectLayout(f, name, opts)
+	if err != nil {
+		fp.Signature = signature(fp)
+		return fp, err
+	}
+	fp.Sheet, fp.Layout, fp.Merged, fp.HeaderRow = d.Sheet, d.Layout, d.Merged, d.HeaderRow
+	for _, h := range d.Header {
+		fp.Header = append(fp.Header, normalize(h))
+	}
+	fp.Signature = signature(fp)
+	return fp, nil
+}
+
+// Options returns opts with the trading sheet and layout of the fingerprint filled in, so parsing
+// uses them instead of detecting them again. Layouts the registry no longer has are left out.
+func (fp Fingerprint) Options(opts parser.Options) parser.Options {
+	if fp.Layout == "" {
+		return opts
+	}
+	registry := opts.Registry
+	if registry == nil {
+		registry = parser.DefaultRegistry
+	}
+	if _, ok := registry.Layout(fp.Layout); !ok {
+		return opts
+	}
+	opts.Layout = fp.Layout
+	opts.Sheet = fp.Sheet
+	return opts
+}
+
+// Sample is the fingerprint of the first report of a quarter, as identifyformats writes them to
+// index_formats.json
+type Sample struct {
+	Quarter string `json:"quarter"` // see QuarterKey
+	File    string `json:"file"`
+	Sheet   string `json:"sheet"` // where the index line was found
+	Row     int    `json:"row"`
+	Text    string `json:"text"`
+
+	Format Fingerprint `json:"format"`
+}
+
+// QuarterKey returns the quarter of t as YYYY-Qn
+func QuarterKey(t time.Time) string {
+	q := (int(t.Month())-1)/3 + 1
+	return fmt.Sprintf("%04d-Q%d", t.Year(), q)
+}
+
+// LoadSamples reads the samples of an index_formats.json, sorted by quarter
+func LoadSamples(path string) ([]Sample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var samples []Sample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Quarter < samples[j].Quarter })
+	return samples, nil
+}
+
+// SampleFor returns the sample of the format in use on date: the sample of its quarter, or of the
+// latest quarter before it. samples must be sorted by quarter.
+func SampleFor(samples []Sample, date time.Time) (Sample, bool) {
+	quarter := QuarterKey(date)
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Quarter > quarter })
+	if i == 0 {
+		return Sample{}, false
+	}
+	return samples[i-1], true
+}
+
+// Current reports whether the fingerprint was taken from a file with this content hash
+func (fp *Fingerprint) Current(hash string) bool {
+	return fp != nil && fp.SHA256 == hash
+}
+
+// signature identifies the format independently of the report's content: its sheets, trading
+// layout and header. Reports with the same signature are parsed the same way.
+func signature(fp Fingerprint) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s|%s|%v|%d\n%s\n%s",
+		strings.Join(fp.Sheets, "|"), fp.Sheet, fp.Layout, fp.Merged, fp.HeaderRow,
+		strings.Join(fp.Header, "|"), fp.IndexSheet)
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// normalize lowercases a header cell and collapses its whitespace
+func normalize(cell string) string {
+	return strings.ToLower(strings.Join(strings.Fields(cell), " "))
+}
+
+var (
+	isx60Re    = regexp.MustCompile(`(?i)ISX[^\n]{0,40}60`)
+	isx15Re    = regexp.MustCompile(`(?i)ISX[^\n]{0,40}15`)
+	indexKeyRe = regexp.MustCompile(`(?i)index\s*(60|price|15)`)
+)
+
+// FindIndexLine returns the sheet, one-based row and text of the line giving the index values:
+// the first line naming both ISX60 and ISX15, or failing that the first line mentioning an index
+func FindIndexLine(f *excelize.File, opts parser.Options) (sheet string, row int, line string, ok bool) {
+	var fallbackSheet, fallbackLine string
+	fallbackRow := 0
+	for _, name := range f.GetSheetList() {
+		parser.EachRow(f, name, opts, func(i int, cells []string) error {
+			text := strings.TrimSpace(strings.Join(cells, " "))
+			if text == "" {
+				return nil
+			}
+			if isx60Re.MatchString(text) && isx15Re.MatchString(text) {
+				sheet, row, line, ok = name, i+1, text, true
+				return parser.StopRows
+			}
+			if fallbackRow == 0 && indexKeyRe.MatchString(text) {
+				fallbackSheet, fallbackRow, fallbackLine = name, i+1, text
+			}
+			return nil
+		})
+		if ok {
+			return sheet, row, line, true
+		}
+	}
+	if fallbackRow > 0 {
+		return fallbackSheet, fallbackRow, fallbackLine, true
+	}
+	return "", 0, "", false
+}
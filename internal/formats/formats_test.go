@@ -0,0 +1,55 @@
+package formats
+
+import (
+	"path/filepath"
+	"testing"
+
+	"isxcli/internal/parser"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// TestIdentify ensures a report's layout, trading sheet and index line are fingerprinted, and that
+// the fingerprint selects the layout when parsing.
+func TestIdentify(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"ISX Index 60: 580.12   ISX 15: 612.40"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{"Company Name", "Symbol", "Price", "", "Traded", ""})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{"", "", "Opening", "Closing", "Volume", "Value"})
+	f.SetSheetRow("Sheet1", "A4", &[]interface{}{"Baghdad Soft Drinks", "IBSD", "3.10", "3.25", "50,000", "162500"})
+
+	path := filepath.Join(t.TempDir(), "2012 03 04 ISX Daily Report.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	fp, err := Identify(path, parser.DefaultOptions)
+	if err != nil {
+		t.Fatalf("Identify returned error: %v", err)
+	}
+	if fp.Layout != parser.LayoutModern || !fp.Merged || fp.Sheet != "Sheet1" || fp.HeaderRow != 2 {
+		t.Errorf("unexpected fingerprint: %+v", fp)
+	}
+	if fp.IndexSheet != "Sheet1" || fp.IndexRow != 1 {
+		t.Errorf("index line: want Sheet1 row 1, got %s row %d", fp.IndexSheet, fp.IndexRow)
+	}
+	hash, _ := parser.FileHash(path)
+	if !fp.Current(hash) || len(fp.Signature) != 12 {
+		t.Errorf("hash %s, signature %q", fp.SHA256, fp.Signature)
+	}
+
+	opts := fp.Options(parser.DefaultOptions)
+	if opts.Layout != parser.LayoutModern || opts.Sheet != "Sheet1" {
+		t.Errorf("options: %+v", opts)
+	}
+	rep, err := parser.ParseFileWithOptions(path, opts)
+	if err != nil || len(rep.Records) != 1 {
+		t.Fatalf("parse with fingerprint options: %v", err)
+	}
+
+	// A layout the registry doesn't know is left to detection
+	fp.Layout = "retired"
+	if opts := fp.Options(parser.DefaultOptions); opts.Layout != "" {
+		t.Errorf("unknown layout selected: %+v", opts)
+	}
+}
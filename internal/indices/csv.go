@@ -0,0 +1,227 @@
+package indices
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"isxcli/internal/analytics"
+)
+
+// PublishedColumn is the indexes.csv column of the ISX60 percent change stated by the report
+const PublishedColumn = "ISX60_Published" + analytics.IndexChangePercentSuffix
+
+// rangeSuffixes are the suffixes of the open, high and low columns of a RangeLevels entry
+var rangeSuffixes = []string{analytics.IndexOpenSuffix, analytics.IndexHighSuffix, analytics.IndexLowSuffix}
+
+// Header returns the indexes.csv header: the date, a column per index level, the change and
+// percent change of every level, the published ISX60 change and the open, high and low of the
+// RangeLevels, so the leading Date, ISX60, ISX15 columns stay put
+func Header() []string {
+	levels := Levels()
+	header := append([]string{"Date"}, levels...)
+	for _, level := range levels {
+		header = append(header, level+analytics.IndexChangeSuffix, level+analytics.IndexChangePercentSuffix)
+	}
+	header = append(header, PublishedColumn)
+	for _, level := range RangeLevels {
+		for _, suffix := range rangeSuffixes {
+			header = append(header, level+suffix)
+		}
+	}
+	return header
+}
+
+// LoadCSV reads the points of an indexes.csv in file order, matching columns by name so files
+// written with fewer columns, e.g. before the sector indices were extracted, still load. Rows
+// without a valid date are skipped. Changes are left to FillChanges.
+func LoadCSV(path string) ([]IndexPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	levels := make(map[string]bool)
+	for _, level := range Levels() {
+		levels[level] = true
+	}
+	// The open, high and low columns of each range level, read as the values of an index range
+	// pattern
+	rangeColumns := make(map[string][2]string)
+	for _, level := range RangeLevels {
+		for _, suffix := range rangeSuffixes {
+			rangeColumns[level+suffix] = [2]string{level, strings.ToLower(strings.TrimPrefix(suffix, "_"))}
+		}
+	}
+	header := records[0]
+	var points []IndexPoint
+	for _, record := range records[1:] {
+		if len(record) == 0 {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			continue
+		}
+		point := IndexPoint{Date: date}
+		ranges := make(map[string]map[string]string)
+		for i := 1; i < len(record) && i < len(header); i++ {
+			if c, ok := rangeColumns[header[i]]; ok {
+				if ranges[c[0]] == nil {
+					ranges[c[0]] = make(map[string]string)
+				}
+				ranges[c[0]][c[1]] = record[i]
+				continue
+			}
+			if header[i] == PublishedColumn {
+				if v, err := parseFloat(record[i]); err == nil {
+					point.Published = map[string]float64{"ISX60": v}
+				}
+				continue
+			}
+			if !levels[header[i]] {
+				continue
+			}
+			if v, err := parseFloat(record[i]); err == nil && v > 0 {
+				point.setLevel(header[i], v)
+			}
+		}
+		for level, m := range ranges {
+			point.setRange(level, m)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// Dedupe returns points sorted by date with one point per date, the last one of points, and the
+// number of points dropped
+func Dedupe(points []IndexPoint) ([]IndexPoint, int) {
+	latest := make(map[time.Time]IndexPoint, len(points))
+	for _, p := range points {
+		latest[p.Date] = p
+	}
+	kept := make([]IndexPoint, 0, len(latest))
+	for _, p := range latest {
+		kept = append(kept, p)
+	}
+	sortPoints(kept)
+	return kept, len(points) - len(kept)
+}
+
+// sortPoints sorts points by date
+func sortPoints(points []IndexPoint) {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Date.Before(points[j].Date) })
+}
+
+// WriteCSV writes points, with their changes filled, to an indexes.csv at path, replacing it
+func WriteCSV(path string, points []IndexPoint) error {
+	levels := Levels()
+	rows := [][]string{Header()}
+	for _, p := range points {
+		row := make([]string, 1, len(rows[0]))
+		row[0] = p.Date.Format("2006-01-02")
+		for _, level := range levels {
+			if v := p.Level(level); v > 0 {
+				row = append(row, formatFloat(v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		for _, level := range levels {
+			if c, ok := p.Changes[level]; ok {
+				row = append(row, formatFloat(c.Change), formatFloat(c.Percent))
+			} else {
+				row = append(row, "", "")
+			}
+		}
+		if v, ok := p.Published["ISX60"]; ok {
+			row = append(row, formatFloat(v))
+		} else {
+			row = append(row, "")
+		}
+		for _, level := range RangeLevels {
+			r, ok := p.Ranges[level]
+			switch {
+			case !ok:
+				row = append(row, "", "", "")
+			case r.Open > 0:
+				row = append(row, formatFloat(r.Open), formatFloat(r.High), formatFloat(r.Low))
+			default:
+				row = append(row, "", formatFloat(r.High), formatFloat(r.Low))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := csv.NewWriter(f).WriteAll(rows); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// jsonPoint is one date of indexes.json
+type jsonPoint struct {
+	Date    string             `json:"date"`
+	ISX60   *float64           `json:"isx60"`
+	ISX15   *float64           `json:"isx15"`
+	Sectors map[string]float64 `json:"sectors,omitempty"`
+	Changes map[string]Change  `json:"changes"`
+	// Percent changes the report states, by index
+	Published map[string]float64 `json:"published,omitempty"`
+	// Session open, high and low, by index; the close is the level
+	Ranges map[string]Range `json:"ranges,omitempty"`
+}
+
+// WriteJSON writes points, with their changes filled, as the indexes.json array of
+// {date, isx60, isx15, sectors, changes, published, ranges} the dashboard chart reads
+func WriteJSON(path string, points []IndexPoint) error {
+	records := make([]jsonPoint, 0, len(points))
+	for _, p := range points {
+		rec := jsonPoint{Date: p.Date.Format("2006-01-02"), Changes: p.Changes, Published: p.Published, Ranges: p.Ranges}
+		if p.ISX60 > 0 {
+			rec.ISX60 = &p.ISX60
+		}
+		if p.ISX15 > 0 {
+			rec.ISX15 = &p.ISX15
+		}
+		if len(p.Sectors) > 0 {
+			rec.Sectors = p.Sectors
+		}
+		if rec.Changes == nil {
+			rec.Changes = map[string]Change{}
+		}
+		records = append(records, rec)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(records); err != nil {
+		return err
+	}
+	return f.Close()
+}
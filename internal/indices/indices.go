@@ -0,0 +1,343 @@
+// Package indices extracts the ISX60, ISX15 and sector index levels of the daily reports and
+// keeps them in indexes.csv, so indexcsv and the web servers share one implementation.
+package indices
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"isxcli/internal/formats"
+	"isxcli/internal/parser"
+	"isxcli/internal/reportfile"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// IndexPoint holds the index levels published by the report of one date. A zero ISX60 or ISX15
+// was not published; Sectors is keyed by parser.SectorIndexNames entry.
+type IndexPoint struct {
+	Date    time.Time
+	ISX60   float64
+	ISX15   float64
+	Sectors map[string]float64
+	// Changes are keyed by level name, see Levels; a level without an earlier value has none.
+	// Filled by FillChanges.
+	Changes map[string]Change
+	// Published holds the percent changes the report itself states, by level name
+	Published map[string]float64
+	// Ranges holds the session open, high and low of the RangeLevels the report publishes them of
+	Ranges map[string]Range
+}
+
+// Range is the session range of an index; its close is the level. A zero Open was not published.
+type Range struct {
+	Open float64 `json:"open,omitempty"`
+	High float64 `json:"high"`
+	Low  float64 `json:"low"`
+}
+
+// RangeLevels are the levels whose session range reports can publish, in indexes.csv order
+var RangeLevels = []string{"ISX60", "ISX15"}
+
+// Change is the change of an index since its previous published value
+type Change struct {
+	Change  float64 `json:"change"`
+	Percent float64 `json:"percent"`
+}
+
+// Levels returns the names of the index levels in their indexes.csv order
+func Levels() []string {
+	return append([]string{"ISX60", "ISX15"}, parser.SectorIndexNames...)
+}
+
+// Level returns the named level of p, 0 when it was not published
+func (p IndexPoint) Level(name string) float64 {
+	switch name {
+	case "ISX60":
+		return p.ISX60
+	case "ISX15":
+		return p.ISX15
+	}
+	return p.Sectors[name]
+}
+
+// setLevel sets the named level of p
+func (p *IndexPoint) setLevel(name string, v float64) {
+	switch name {
+	case "ISX60":
+		p.ISX60 = v
+	case "ISX15":
+		p.ISX15 = v
+	default:
+		if p.Sectors == nil {
+			p.Sectors = make(map[string]float64)
+		}
+		p.Sectors[name] = v
+	}
+}
+
+// setRange sets the session range of the named level from the values of an index range pattern,
+// ignoring a range without a valid high and low
+func (p *IndexPoint) setRange(name string, m map[string]string) {
+	high, errHigh := parseFloat(m["high"])
+	low, errLow := parseFloat(m["low"])
+	if errHigh != nil || errLow != nil || !slices.Contains(RangeLevels, name) {
+		return
+	}
+	r := Range{High: high, Low: low}
+	r.Open, _ = parseFloat(m["open"])
+	if p.Ranges == nil {
+		p.Ranges = make(map[string]Range)
+	}
+	p.Ranges[name] = r
+}
+
+// FillChanges sets the changes of points, sorted by date, each from the previous point
+// publishing the same level. Levels count with the two decimals indexes.csv keeps.
+func FillChanges(points []IndexPoint) {
+	prev := make(map[string]float64)
+	for i := range points {
+		points[i].Changes = make(map[string]Change)
+		for _, level := range Levels() {
+			v := round2(points[i].Level(level))
+			if v <= 0 {
+				continue
+			}
+			if p := prev[level]; p > 0 {
+				points[i].Changes[level] = Change{Change: round2(v - p), Percent: round2((v/p - 1) * 100)}
+			}
+			prev[level] = v
+		}
+	}
+}
+
+// round2 rounds v to the two decimals indexes.csv keeps
+func round2(v float64) float64 {
+	r, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'f', 2, 64), 64)
+	return r
+}
+
+// Extract returns the index levels of every report of dir named by the default filename
+// template, in date order. Reports without indices are skipped.
+func Extract(dir string) ([]IndexPoint, error) {
+	opts := DefaultOptions()
+	template, err := reportfile.Parse(opts.NameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	files, err := template.Find(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dir, err)
+	}
+	book, err := loadFormatBook(dir, opts.Formats)
+	if err != nil {
+		return nil, err
+	}
+	var points []IndexPoint
+	for _, r := range extractFiles(files, parser.Options{Streaming: opts.Streaming}, opts.Workers, book, nil) {
+		if r.err == nil {
+			points = append(points, r.point)
+		}
+	}
+	return points, nil
+}
+
+// extractResult is the outcome of extracting the indices of one report
+type extractResult struct {
+	point  IndexPoint
+	format *formats.Fingerprint // the fingerprint that guided the extraction, if any
+	err    error
+}
+
+// extractFiles extracts the indices of files with up to workers goroutines, guided by the format
+// fingerprints of book, calling onProgress, when set, as each file is read. Results are returned
+// in the order of files.
+func extractFiles(files []reportfile.File, opts parser.Options, workers int, book *formatBook, onProgress func(read, total int)) []extractResult {
+	results := make([]extractResult, len(files))
+	workers = max(min(workers, len(files)), 1)
+
+	var read int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				format := book.lookup(files[i])
+				point, err := extractFile(files[i].Path, files[i].Date, opts, format)
+				results[i] = extractResult{point: point, format: format, err: err}
+				if onProgress != nil {
+					onProgress(int(atomic.AddInt64(&read, 1)), len(files))
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+var (
+	// joinRe collapses the whitespace of the lines the index patterns are matched against
+	joinRe = regexp.MustCompile(`\s+`)
+	// The first number after an ISX60 or ISX15 label, read from the line a format fingerprint
+	// locates when no registry pattern matches it, e.g. "ISX Index 60: 580.12 ISX 15: 612.40"
+	looseISX60Re = regexp.MustCompile(`(?i)ISX\D{0,40}?60\D*?([0-9][0-9,]*(?:\.[0-9]+)?)`)
+	looseISX15Re = regexp.MustCompile(`(?i)ISX\D{0,40}?15\D*?([0-9][0-9,]*(?:\.[0-9]+)?)`)
+)
+
+// ExtractFile returns the index levels of the report at path, published on date
+func ExtractFile(path string, date time.Time, opts parser.Options) (IndexPoint, error) {
+	return extractFile(path, date, opts, nil)
+}
+
+// extractFile returns the index levels of the report at path. A format fingerprint of the report
+// or of its vintage, when given, names the sheet and row of the index line: that sheet is read
+// first, and the line itself is read leniently when no registry pattern matches it.
+func extractFile(path string, date time.Time, opts parser.Options, format *formats.Fingerprint) (IndexPoint, error) {
+	point := IndexPoint{Date: date}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return point, err
+	}
+	defer f.Close()
+
+	registry := opts.Registry
+	if registry == nil {
+		registry = parser.DefaultRegistry
+	}
+	patterns := registry.IndexPatternsFor(date)
+	sectorPatterns := registry.SectorIndexPatternsFor(date)
+	rangePatterns := registry.IndexRangePatternsFor(date)
+
+	// Build list of sheets to inspect: prefer the sheets named by the index patterns ("Indices",
+	// or "Index" in older reports) if one exists, otherwise all
+	var sheets []string
+	for _, sh := range f.GetSheetList() {
+		for _, p := range patterns {
+			for _, name := range p.Sheets {
+				if strings.EqualFold(sh, name) {
+					sheets = []string{sh}
+				}
+			}
+		}
+		if sheets != nil {
+			break
+		}
+	}
+	// Sector and range lines are only looked for on an index sheet, where no company row can pass
+	// for one
+	named := sheets != nil
+	indexSheet := ""
+	if named {
+		indexSheet = sheets[0]
+	} else {
+		sheets = f.GetSheetList()
+	}
+
+	// The sheet of the fingerprint comes first, unless an index sheet is there to read before
+	hintSheet, hintRow := "", 0
+	if format != nil && format.IndexSheet != "" && slices.Contains(f.GetSheetList(), format.IndexSheet) {
+		hintSheet, hintRow = format.IndexSheet, format.IndexRow
+		others := slices.DeleteFunc(sheets, func(sh string) bool { return sh == hintSheet })
+		if named {
+			sheets = append(others, hintSheet)
+		} else {
+			sheets = append([]string{hintSheet}, others...)
+		}
+	}
+
+	for _, sheet := range sheets {
+		found := false
+		var hinted string
+		parser.EachRow(f, sheet, opts, func(i int, row []string) error {
+			line := strings.TrimSpace(joinRe.ReplaceAllString(strings.Join(row, " "), " "))
+			if line == "" {
+				return nil
+			}
+			if sheet == hintSheet && i+1 == hintRow {
+				hinted = line
+			}
+			if sheet == indexSheet {
+				for _, p := range rangePatterns {
+					if m := p.Match(line); m != nil {
+						point.setRange("ISX"+m["index"], m)
+						break
+					}
+				}
+				for _, p := range sectorPatterns {
+					if m := p.Match(line); m != nil {
+						sector, ok := parser.SectorIndexName(m["sector"])
+						if v, err := parseFloat(m["value"]); ok && err == nil {
+							point.setLevel(sector, v)
+						}
+						return nil
+					}
+				}
+			}
+			if found {
+				return nil
+			}
+			// Patterns are ordered from the most to the least complete, e.g. both ISX60 and
+			// ISX15 on one line before ISX60 alone and the very old "ISX Price Index"
+			for _, p := range patterns {
+				m := p.Match(line)
+				if m == nil {
+					continue
+				}
+				if v, ok := m["isx60"]; ok {
+					point.ISX60, _ = parseFloat(v)
+				}
+				if v, ok := m["isx15"]; ok {
+					point.ISX15, _ = parseFloat(v)
+				}
+				if v, err := parseFloat(m["isx60_change"]); err == nil {
+					point.Published = map[string]float64{"ISX60": v}
+				}
+				found = true
+				if !named {
+					return parser.StopRows
+				}
+				return nil
+			}
+			return nil
+		})
+		if !found && hinted != "" {
+			if m := looseISX60Re.FindStringSubmatch(hinted); m != nil {
+				point.ISX60, _ = parseFloat(m[1])
+				found = point.ISX60 > 0
+			}
+			if m := looseISX15Re.FindStringSubmatch(hinted); found && m != nil {
+				point.ISX15, _ = parseFloat(m[1])
+			}
+		}
+		if found {
+			return point, nil
+		}
+	}
+	return point, fmt.Errorf("indices not found in %s", filepath.Base(path))
+}
+
+func parseFloat(s string) (float64, error) {
+	s = strings.ReplaceAll(s, ",", "")
+	return strconv.ParseFloat(s, 64)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// defaultWorkers is the number of reports read concurrently by default
+var defaultWorkers = runtime.GOMAXPROCS(0)
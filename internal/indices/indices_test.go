@@ -0,0 +1,241 @@
+package indices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeReport writes a daily report whose Indices sheet holds the given levels
+func writeReport(t *testing.T, dir string, date time.Time, isx60, isx15, banking float64) {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", "Indices"); err != nil {
+		t.Fatal(err)
+	}
+	f.SetSheetRow("Indices", "A1", &[]interface{}{"ISX Index 60", fmt.Sprintf("%.2f", isx60), "ISX Index 15", fmt.Sprintf("%.2f", isx15)})
+	f.SetSheetRow("Indices", "A2", &[]interface{}{"Banking Sector Index", fmt.Sprintf("%.2f", banking)})
+	if err := f.SaveAs(filepath.Join(dir, date.Format("2006 01 02")+" ISX Daily Report.xlsx")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestUpdate extracts reports into a new file, fills a gap with ModeRepair and checks the
+// changes and indexes.json
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		writeReport(t, dir, day.AddDate(0, 0, i), 100+float64(i)*10, 50, 40+float64(i))
+	}
+
+	points, err := Extract(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 4 || points[3].ISX60 != 130 || points[3].Sectors["Banking"] != 43 {
+		t.Fatalf("extracted: %+v", points)
+	}
+
+	out := filepath.Join(t.TempDir(), "indexes.csv")
+	opts := DefaultOptions()
+	opts.Dir, opts.Out, opts.Format, opts.Workers, opts.Output = dir, out, "json", 2, io.Discard
+	if _, err := Update(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop a date and duplicate another, as an interrupted accumulative run could
+	loaded, err := LoadCSV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := append([]IndexPoint{loaded[3], loaded[0]}, loaded[1], loaded[3])
+	if err := WriteCSV(out, damaged); err != nil {
+		t.Fatal(err)
+	}
+	opts.Mode = ModeRepair
+	stats, err := Update(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 1 || stats.FilesFound != 1 || stats.Points != 4 {
+		t.Errorf("repair stats: %+v", stats)
+	}
+
+	data, err := os.ReadFile(JSONPath(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []struct {
+		Date    string            `json:"date"`
+		ISX60   *float64          `json:"isx60"`
+		Changes map[string]Change `json:"changes"`
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[2].Date != "2025-03-04" || *records[2].ISX60 != 120 {
+		t.Fatalf("indexes.json: %s", data)
+	}
+	if c := records[2].Changes["ISX60"]; c.Change != 10 || c.Percent != 9.09 {
+		t.Errorf("ISX60 change: %+v", c)
+	}
+	if _, ok := records[2].Changes["ISX15"]; !ok || len(records[0].Changes) != 0 {
+		t.Errorf("changes: %+v", records)
+	}
+
+	opts.Mode = "unknown"
+	var optErr *OptionError
+	if _, err := Update(opts); !errors.As(err, &optErr) || optErr.Option != "Mode" {
+		t.Errorf("unknown mode: %v", err)
+	}
+}
+
+// TestLoadCSVOldHeader reads a file written before the sector and change columns
+func TestLoadCSVOldHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "indexes.csv")
+	if err := os.WriteFile(path, []byte("Date,ISX60,ISX15\n2025-03-01,100.00,\nbad,1,1\n2025-03-02,110.00,50.00\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	points, err := LoadCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].ISX15 != 0 || points[1].ISX15 != 50 {
+		t.Fatalf("points: %+v", points)
+	}
+	FillChanges(points)
+	if c, ok := points[1].Changes["ISX60"]; !ok || c.Change != 10 || c.Percent != 10 {
+		t.Errorf("changes: %+v", points[1].Changes)
+	}
+}
+
+// TestExtractWithFingerprint reads an old report whose index line no registry pattern matches at
+// the line the identifyformats sample of its quarter locates
+func TestExtractWithFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"ISX Index 60: 580.12   ISX 15: 612.40"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{"Company Name", "Symbol", "Closing"})
+	path := filepath.Join(dir, "2012 03 04 ISX Daily Report.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	opts := DefaultOptions()
+	opts.Dir, opts.Out, opts.Output = dir, filepath.Join(t.TempDir(), "indexes.csv"), io.Discard
+	opts.Formats = filepath.Join(dir, "index_formats.json")
+	if stats, err := Update(opts); err != nil || len(stats.FailedFiles) != 1 {
+		t.Fatalf("without fingerprint: %+v %v", stats, err)
+	}
+
+	samples := `[{"quarter": "2011-Q4", "format": {"index_sheet": "Indices", "index_row": 3}},
+		{"quarter": "2012-Q1", "format": {"index_sheet": "Sheet1", "index_row": 1}}]`
+	if err := os.WriteFile(opts.Formats, []byte(samples), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := Update(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FilesProcessed != 1 || stats.Fingerprinted != 1 {
+		t.Fatalf("with fingerprint: %+v", stats)
+	}
+	points, err := LoadCSV(opts.Out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].ISX60 != 580.12 || points[0].ISX15 != 612.40 {
+		t.Errorf("points: %+v", points)
+	}
+}
+
+// TestCheckChanges flags a date whose published ISX60 change disagrees with the extracted levels
+// and keeps the other rows of the data quality report
+func TestCheckChanges(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	lines := []string{"ISX Index 60 100.00 ISX Index 15 50.00", "ISX Index 60 110.00 (10.00%) ISX Index 15 50.00", "ISX Index 60 121.00 5.00% ISX Index 15 50.00"}
+	for i, line := range lines {
+		f := excelize.NewFile()
+		f.SetSheetRow("Sheet1", "A1", &[]interface{}{line})
+		if err := f.SaveAs(filepath.Join(dir, day.AddDate(0, 0, i).Format("2006 01 02")+" ISX Daily Report.xlsx")); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	out := filepath.Join(t.TempDir(), "indexes.csv")
+	report := QualityReportPath(out)
+	other := "Date,Symbol,Severity,Check,Detail\n2025-03-02,BBOB,error,high_below_low,high 1 < low 2\n"
+	if err := os.WriteFile(report, []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Dir, opts.Out, opts.Output = dir, out, io.Discard
+	for run := 0; run < 2; run++ {
+		stats, err := Update(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Mismatches != 1 {
+			t.Fatalf("run %d mismatches: %d", run, stats.Mismatches)
+		}
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := other + "2025-03-04,ISX60,warning,index_change_mismatch,\"change +10.00% from the extracted levels, +5.00% published in the report\"\n"
+	if string(data) != want {
+		t.Errorf("quality report:\n%s", data)
+	}
+
+	points, err := LoadCSV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || points[0].Published != nil || points[1].Published["ISX60"] != 10 {
+		t.Errorf("published changes: %+v", points)
+	}
+}
+
+// TestExtractRanges reads the open, high and low lines of the Indices sheet and keeps them through
+// indexes.csv
+func TestExtractRanges(t *testing.T) {
+	dir := t.TempDir()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Indices")
+	f.SetSheetRow("Indices", "A1", &[]interface{}{"ISX Index 60", "582.00", "ISX Index 15", "612.40"})
+	f.SetSheetRow("Indices", "A2", &[]interface{}{"ISX Index 60", "Open", "580.10", "High", "585.20", "Low", "578.00"})
+	f.SetSheetRow("Indices", "A3", &[]interface{}{"ISX Index 15", "High", "615.00", "Low", "610.25"})
+	if err := f.SaveAs(filepath.Join(dir, "2025 03 02 ISX Daily Report.xlsx")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	opts := DefaultOptions()
+	opts.Dir, opts.Out, opts.Output = dir, filepath.Join(t.TempDir(), "indexes.csv"), io.Discard
+	if _, err := Update(opts); err != nil {
+		t.Fatal(err)
+	}
+	points, err := LoadCSV(opts.Out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Range{"ISX60": {Open: 580.10, High: 585.20, Low: 578}, "ISX15": {High: 615, Low: 610.25}}
+	if len(points) != 1 || points[0].ISX60 != 582 || !reflect.DeepEqual(points[0].Ranges, want) {
+		t.Errorf("points: %+v", points)
+	}
+}
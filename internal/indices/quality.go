@@ -0,0 +1,90 @@
+package indices
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// MismatchCheck is the data quality report check of an index change differing from the published one
+const MismatchCheck = "index_change_mismatch"
+
+// DefaultTolerance is the difference, in percentage points, between a computed and a published
+// change that is flagged; the two-decimal rounding of both stays well below it
+const DefaultTolerance = 0.1
+
+// Mismatch is a date whose index change, computed from the extracted levels, differs from the
+// change the report publishes: a sign of a misread level or a missing date
+type Mismatch struct {
+	Date      time.Time
+	Index     string
+	Computed  float64 // percent
+	Published float64 // percent
+}
+
+// Detail describes the mismatch for the data quality report
+func (m Mismatch) Detail() string {
+	return fmt.Sprintf("change %+.2f%% from the extracted levels, %+.2f%% published in the report", m.Computed, m.Published)
+}
+
+// CheckChanges returns the points, with their changes filled, whose computed change differs from
+// the published one by more than tolerance percentage points. Points without either are skipped.
+func CheckChanges(points []IndexPoint, tolerance float64) []Mismatch {
+	var mismatches []Mismatch
+	for _, p := range points {
+		for index, published := range p.Published {
+			c, ok := p.Changes[index]
+			if ok && math.Abs(c.Percent-published) > tolerance {
+				mismatches = append(mismatches, Mismatch{Date: p.Date, Index: index, Computed: c.Percent, Published: published})
+			}
+		}
+	}
+	return mismatches
+}
+
+// qualityHeader is the header of the data quality report written by process
+var qualityHeader = []string{"Date", "Symbol", "Severity", "Check", "Detail"}
+
+// UpdateQualityReport replaces the MismatchCheck rows of the data quality report at path with
+// mismatches, keeping the rows of the other checks. A missing report is created when there are
+// mismatches to write.
+func UpdateQualityReport(path string, mismatches []Mismatch) error {
+	rows := [][]string{qualityHeader}
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		existing, err := r.ReadAll()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		for i, row := range existing {
+			if i > 0 && !(len(row) > 3 && row[3] == MismatchCheck) {
+				rows = append(rows, row)
+			}
+		}
+	case os.IsNotExist(err):
+		if len(mismatches) == 0 {
+			return nil
+		}
+	default:
+		return err
+	}
+
+	for _, m := range mismatches {
+		rows = append(rows, []string{m.Date.Format("2006-01-02"), m.Index, "warning", MismatchCheck, m.Detail()})
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := csv.NewWriter(out).WriteAll(rows); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,287 @@
+package indices
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"isxcli/internal/parser"
+	"isxcli/internal/reportfile"
+)
+
+// Modes of Update
+const (
+	ModeInitial      = "initial"      // extract every report into a new file
+	ModeAccumulative = "accumulative" // extract the reports after the last date of the file
+	ModeRepair       = "repair"       // sort and dedupe the file, then extract the dates missing from it
+)
+
+// Options configures Update. Start from DefaultOptions.
+type Options struct {
+	Dir          string // directory of the downloaded .xlsx reports
+	Out          string // indexes.csv path
+	Mode         string // ModeInitial, ModeAccumulative or ModeRepair
+	Format       string // "csv", or "json" to also write the points to a .json file next to Out
+	NameTemplate string // report filename template using {YYYY} {MM} {DD}
+	Streaming    bool   // read workbooks row by row to keep memory low
+	Workers      int    // number of Excel files to read concurrently
+	Layouts      string // layout registry JSON file; "" uses the bundled layouts
+	// Formats is the index_formats.json of identifyformats whose fingerprints tell where the index
+	// line of each report vintage is; a missing file is ignored, as are the samples of reports the
+	// downloads manifest holds a current fingerprint of
+	Formats string
+	// Tolerance is the difference, in percentage points, between the ISX60 change computed from
+	// the levels and the one the report publishes above which the date is flagged in the
+	// data_quality_report.csv next to Out; 0 skips the check
+	Tolerance float64
+	Output    io.Writer // receives the extraction log; nil means os.Stdout
+	// OnProgress, when set, is called as each report is read with the reports read so far and
+	// the reports to read; calls come from the extraction workers
+	OnProgress func(read, total int)
+}
+
+// DefaultOptions returns the options indexcsv runs with when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		Dir:          "downloads",
+		Out:          "indexes.csv",
+		Mode:         ModeInitial,
+		Format:       "csv",
+		NameTemplate: reportfile.DefaultPatternFromEnv(),
+		Streaming:    parser.DefaultOptions.Streaming,
+		Workers:      defaultWorkers,
+		Formats:      "index_formats.json",
+		Tolerance:    DefaultTolerance,
+	}
+}
+
+// Stats summarises an Update run
+type Stats struct {
+	FilesFound     int      // reports to extract
+	FilesProcessed int      // reports whose indices were extracted
+	FailedFiles    []string // reports without indices
+	Fingerprinted  int      // reports read at the index line of their format fingerprint
+	Removed        int      // duplicate rows dropped by ModeRepair
+	Points         int      // dates in the written file
+	Mismatches     int      // dates whose change differs from the published one
+}
+
+// OptionError reports an option Update can't run with
+type OptionError struct {
+	Option string // Options field name
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Option, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// JSONPath returns the indexes.json written next to the indexes.csv at out
+func JSONPath(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".json"
+}
+
+// QualityReportPath returns the data_quality_report.csv of process next to the indexes.csv at out
+func QualityReportPath(out string) string {
+	return filepath.Join(filepath.Dir(out), "data_quality_report.csv")
+}
+
+// Plan returns the reports of opts.Dir an Update run would extract, without extracting or writing
+// anything
+func Plan(opts Options) ([]reportfile.File, error) {
+	nameTemplate, err := reportfile.Parse(opts.NameTemplate)
+	if err != nil {
+		return nil, &OptionError{"NameTemplate", err}
+	}
+	known := make(map[time.Time]bool)
+	var lastDate time.Time
+	switch opts.Mode {
+	case ModeRepair:
+		existing, err := LoadCSV(opts.Out)
+		if err != nil {
+			return nil, fmt.Errorf("cannot repair %s: %w", opts.Out, err)
+		}
+		points, _ := Dedupe(existing)
+		for _, p := range points {
+			known[p.Date] = true
+		}
+	case ModeAccumulative:
+		if existing, err := LoadCSV(opts.Out); err == nil && len(existing) > 0 {
+			lastDate = existing[len(existing)-1].Date
+		}
+	case ModeInitial:
+	default:
+		return nil, &OptionError{"Mode", fmt.Errorf("%q (want %s, %s or %s)", opts.Mode, ModeInitial, ModeAccumulative, ModeRepair)}
+	}
+	reports, err := nameTemplate.Find(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir failed: %w", err)
+	}
+	return pendingReports(reports, known, lastDate), nil
+}
+
+// pendingReports returns the reports whose dates aren't known, and after lastDate when set
+func pendingReports(reports []reportfile.File, known map[time.Time]bool, lastDate time.Time) []reportfile.File {
+	var files []reportfile.File
+	for _, r := range reports {
+		if known[r.Date] || !lastDate.IsZero() && !r.Date.After(lastDate) {
+			continue // already processed
+		}
+		files = append(files, r)
+	}
+	return files
+}
+
+// Update extracts the indices of the reports of opts.Dir into the indexes.csv at opts.Out. The
+// whole file is rewritten every run, so the change columns of rows written by older versions are
+// backfilled too. Reports without indices are logged and counted in Stats rather than returned.
+func Update(opts Options) (Stats, error) {
+	var stats Stats
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	logf := func(format string, args ...interface{}) {
+		fmt.Fprintf(out, format, args...)
+	}
+
+	parseOpts := parser.Options{Streaming: opts.Streaming}
+	if opts.Layouts != "" {
+		reg, err := parser.LoadRegistry(opts.Layouts)
+		if err != nil {
+			return stats, &OptionError{"Layouts", err}
+		}
+		parseOpts.Registry = reg
+	}
+	if opts.Tolerance < 0 {
+		return stats, &OptionError{"Tolerance", fmt.Errorf("%v (want 0 or more)", opts.Tolerance)}
+	}
+	if opts.Format != "csv" && opts.Format != "json" {
+		return stats, &OptionError{"Format", fmt.Errorf("%q (want csv or json)", opts.Format)}
+	}
+	nameTemplate, err := reportfile.Parse(opts.NameTemplate)
+	if err != nil {
+		return stats, &OptionError{"NameTemplate", err}
+	}
+	book, err := loadFormatBook(opts.Dir, opts.Formats)
+	if err != nil {
+		return stats, &OptionError{"Formats", err}
+	}
+
+	// The processing creating the reports directory may run at the same time
+	if err := os.MkdirAll(filepath.Dir(opts.Out), 0755); err != nil {
+		return stats, fmt.Errorf("create output directory: %w", err)
+	}
+
+	mode := opts.Mode
+	logf("Starting index extraction in %s mode...\n", mode)
+
+	var points []IndexPoint
+	var lastDate time.Time
+	known := make(map[time.Time]bool)
+	switch mode {
+	case ModeRepair:
+		existing, err := LoadCSV(opts.Out)
+		if err != nil {
+			return stats, fmt.Errorf("cannot repair %s: %w", opts.Out, err)
+		}
+		points, stats.Removed = Dedupe(existing)
+		for _, p := range points {
+			known[p.Date] = true
+		}
+		logf("[repair] Kept %d dates, removed %d duplicate or undated rows\n", len(points), stats.Removed)
+	case ModeAccumulative:
+		existing, err := LoadCSV(opts.Out)
+		if err == nil && len(existing) > 0 {
+			points = existing
+			lastDate = points[len(points)-1].Date
+			logf("[accumulative] Existing CSV last date: %s\n", lastDate.Format("2006-01-02"))
+		} else {
+			logf("[accumulative] No existing CSV found, switching to initial mode\n")
+			mode = ModeInitial
+		}
+	case ModeInitial:
+	default:
+		return stats, &OptionError{"Mode", fmt.Errorf("%q (want %s, %s or %s)", mode, ModeInitial, ModeAccumulative, ModeRepair)}
+	}
+	if mode == ModeInitial {
+		logf("[initial] Writing new CSV file: %s\n", opts.Out)
+	}
+
+	reports, err := nameTemplate.Find(opts.Dir)
+	if err != nil {
+		return stats, fmt.Errorf("read dir failed: %w", err)
+	}
+	files := pendingReports(reports, known, lastDate)
+	stats.FilesFound = len(files)
+
+	logf("Found %d Excel files to process\n", len(files))
+	if workers := max(min(opts.Workers, len(files)), 1); workers > 1 {
+		logf("Reading %d files with %d workers\n", len(files), workers)
+	}
+	for i, result := range extractFiles(files, parseOpts, opts.Workers, book, opts.OnProgress) {
+		name := filepath.Base(files[i].Path)
+		logf("Processing file %d/%d: %s\n", i+1, len(files), name)
+		if result.err != nil {
+			logf("Error processing %s: %v\n", name, result.err)
+			stats.FailedFiles = append(stats.FailedFiles, name)
+			continue
+		}
+		p := result.point
+		points = append(points, p)
+		stats.FilesProcessed++
+		if result.format != nil {
+			stats.Fingerprinted++
+		}
+
+		if p.ISX15 > 0 {
+			logf("✓ Added %s (ISX60=%.2f, ISX15=%.2f, %d sector indices)\n", p.Date.Format("2006-01-02"), p.ISX60, p.ISX15, len(p.Sectors))
+		} else {
+			logf("✓ Added %s (ISX60=%.2f, ISX15=N/A, %d sector indices)\n", p.Date.Format("2006-01-02"), p.ISX60, len(p.Sectors))
+		}
+	}
+
+	// Repaired gaps land between existing dates
+	sortPoints(points)
+	FillChanges(points)
+	stats.Points = len(points)
+	if err := WriteCSV(opts.Out, points); err != nil {
+		return stats, fmt.Errorf("write csv: %w", err)
+	}
+	if opts.Format == "json" {
+		if err := WriteJSON(JSONPath(opts.Out), points); err != nil {
+			return stats, fmt.Errorf("write json: %w", err)
+		}
+		logf("JSON written to: %s\n", JSONPath(opts.Out))
+	}
+	if opts.Tolerance > 0 {
+		mismatches := CheckChanges(points, opts.Tolerance)
+		stats.Mismatches = len(mismatches)
+		report := QualityReportPath(opts.Out)
+		if err := UpdateQualityReport(report, mismatches); err != nil {
+			return stats, fmt.Errorf("write quality report: %w", err)
+		}
+		if len(mismatches) > 0 {
+			logf("⚠ %d index changes differ from the published change by more than %.2f points, see %s\n", len(mismatches), opts.Tolerance, report)
+		}
+	}
+	if len(files) == 0 {
+		logf("No new files to process.\n")
+		return stats, nil
+	}
+
+	logf("Index extraction completed successfully!\n")
+	logf("Processed %d files\n", stats.FilesProcessed)
+	if stats.Fingerprinted > 0 {
+		logf("%d files read with the index line of their format fingerprint\n", stats.Fingerprinted)
+	}
+	logf("Output written to: %s\n", opts.Out)
+	return stats, nil
+}
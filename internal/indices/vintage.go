@@ -0,0 +1,53 @@
+package indices
+
+import (
+	"os"
+	"path/filepath"
+
+	"isxcli/internal/formats"
+	"isxcli/internal/parser"
+	"isxcli/internal/reportfile"
+)
+
+// formatBook finds the format fingerprint of a report: the one recorded for the file in the
+// downloads manifest while it still matches the file, or else the identifyformats sample of its
+// vintage
+type formatBook struct {
+	manifest *reportfile.Manifest
+	samples  []formats.Sample
+}
+
+// loadFormatBook reads the manifest of dir and the samples at samplesPath. Either may be missing;
+// samplesPath "" reads none.
+func loadFormatBook(dir, samplesPath string) (*formatBook, error) {
+	book := &formatBook{}
+	if manifest, err := reportfile.LoadManifest(dir); err == nil {
+		book.manifest = manifest
+	}
+	if samplesPath != "" {
+		samples, err := formats.LoadSamples(samplesPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		book.samples = samples
+	}
+	return book, nil
+}
+
+// lookup returns the fingerprint of file, nil when none is known
+func (b *formatBook) lookup(file reportfile.File) *formats.Fingerprint {
+	if b == nil {
+		return nil
+	}
+	if b.manifest != nil {
+		if fp := b.manifest.Fingerprint(filepath.Base(file.Path)); fp != nil && fp.IndexSheet != "" {
+			if hash, err := parser.FileHash(file.Path); err == nil && fp.Current(hash) {
+				return fp
+			}
+		}
+	}
+	if sample, ok := formats.SampleFor(b.samples, file.Date); ok && sample.Format.IndexSheet != "" {
+		return &sample.Format
+	}
+	return nil
+}
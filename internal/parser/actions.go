@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Corporate action types
+const (
+	ActionDividend        = "dividend"
+	ActionSplit           = "split"
+	ActionCapitalIncrease = "capital_increase"
+)
+
+// CorporateAction is a dividend, split or capital increase announced in a report's notes
+type CorporateAction struct {
+	Date          time.Time // date of the report announcing it
+	CompanySymbol string
+	Type          string
+	// Value is the cash dividend per share in IQD. ISX dividends are quoted as a percentage of
+	// the 1 IQD nominal value, so 15% is 0.15 IQD.
+	Value float64
+	// Ratio is the number of shares held after the action per share held before it, e.g. 2 for a
+	// 2-for-1 split or 1.25 for a 25% bonus capital increase
+	Ratio float64
+	Note  string // the text the action was detected in
+}
+
+var (
+	actionTickerRe   = regexp.MustCompile(`\(([A-Z]{3,5})\)`)
+	actionPercentRe  = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)\s*%`)
+	actionSplitRe    = regexp.MustCompile(`([0-9]+)\s*(?:for|:|-)\s*([0-9]+)`)
+	actionDividendRe = regexp.MustCompile(`(?i)dividend`)
+	actionSplitWord  = regexp.MustCompile(`(?i)\bsplit\b`)
+	actionCapitalRe  = regexp.MustCompile(`(?i)capital increase|increas\w* (?:of |in )?(?:its |the )?(?:paid[- ]up )?capital|bonus shares|rights issue`)
+)
+
+// notTickers are capitalised words that look like tickers in notes
+var notTickers = map[string]bool{"IQD": true, "ISX": true, "ISC": true, "AGM": true}
+
+// noteTicker returns the company a note is about: a cell holding a ticker, or a ticker in
+// parentheses in the text
+func noteTicker(row []string, text string) string {
+	for _, cell := range row {
+		if cell = strings.TrimSpace(cell); tickerRe.MatchString(cell) && !notTickers[cell] {
+			return cell
+		}
+	}
+	if m := actionTickerRe.FindStringSubmatch(text); m != nil && !notTickers[m[1]] {
+		return m[1]
+	}
+	return ""
+}
+
+// parseCorporateActions scans the notes and company sheets of a report for corporate actions.
+// The trading table itself is skipped since its rows are trades, not notes.
+func parseCorporateActions(f *excelize.File, date time.Time, tradingSheet string, tradingRows map[int]bool, opts Options) []CorporateAction {
+	var actions []CorporateAction
+	seen := make(map[string]bool)
+	for _, name := range f.GetSheetList() {
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if name == tradingSheet && tradingRows[i] {
+				return nil
+			}
+			action, ok := detectCorporateAction(row)
+			if !ok {
+				return nil
+			}
+			action.Date = date
+			key := action.CompanySymbol + "|" + action.Type
+			if !seen[key] {
+				seen[key] = true
+				actions = append(actions, action)
+			}
+			return nil
+		})
+	}
+	return actions
+}
+
+// detectCorporateAction looks for a corporate action in one row of notes. The company must be
+// identified by a ticker cell or a ticker in parentheses.
+func detectCorporateAction(row []string) (CorporateAction, bool) {
+	text := strings.TrimSpace(strings.Join(strings.Fields(strings.Join(row, " ")), " "))
+	if text == "" {
+		return CorporateAction{}, false
+	}
+
+	var action CorporateAction
+	switch {
+	case actionSplitWord.MatchString(text):
+		m := actionSplitRe.FindStringSubmatch(text)
+		if m == nil {
+			return CorporateAction{}, false
+		}
+		newShares, _ := strconv.ParseFloat(m[1], 64)
+		oldShares, _ := strconv.ParseFloat(m[2], 64)
+		if newShares <= 0 || oldShares <= 0 {
+			return CorporateAction{}, false
+		}
+		action = CorporateAction{Type: ActionSplit, Ratio: newShares / oldShares}
+	case actionCapitalRe.MatchString(text):
+		m := actionPercentRe.FindStringSubmatch(text)
+		if m == nil {
+			return CorporateAction{}, false
+		}
+		pct, _ := strconv.ParseFloat(m[1], 64)
+		action = CorporateAction{Type: ActionCapitalIncrease, Ratio: 1 + pct/100}
+	case actionDividendRe.MatchString(text):
+		m := actionPercentRe.FindStringSubmatch(text)
+		if m == nil {
+			return CorporateAction{}, false
+		}
+		pct, _ := strconv.ParseFloat(m[1], 64)
+		action = CorporateAction{Type: ActionDividend, Value: pct / 100}
+	default:
+		return CorporateAction{}, false
+	}
+
+	action.CompanySymbol = noteTicker(row, text)
+	if action.CompanySymbol == "" {
+		return CorporateAction{}, false
+	}
+	action.Note = text
+	return action, true
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// BondRecord is one bond or treasury bill quoted in a daily report
+type BondRecord struct {
+	Date     time.Time
+	Name     string
+	Symbol   string
+	Coupon   float64 // coupon rate in percent
+	Maturity string  // maturity date as printed in the report
+	Price    float64
+	Yield    float64 // yield in percent
+	Volume   int64
+	Value    float64
+}
+
+// isBondSheet reports whether a sheet name suggests bonds or treasury bills
+func isBondSheet(name string) bool {
+	n := strings.ToLower(name)
+	return strings.Contains(n, "bond") || strings.Contains(n, "treasury") ||
+		strings.Contains(n, "t-bill") || strings.Contains(n, "tbill") || strings.Contains(n, "sukuk")
+}
+
+// isBondHeader reports whether the lowercased text of a row looks like a bond table header
+func isBondHeader(rowText string) bool {
+	return (strings.Contains(rowText, "maturity") || strings.Contains(rowText, "coupon") || strings.Contains(rowText, "yield")) &&
+		(strings.Contains(rowText, "price") || strings.Contains(rowText, "value"))
+}
+
+// mapBondColumns maps the columns of a bond table header
+func mapBondColumns(row []string) map[string]int {
+	columnMap := make(map[string]int)
+	for j, header := range row {
+		h := strings.ToLower(strings.TrimSpace(header))
+		switch {
+		case h == "code" || h == "symbol" || h == "isin":
+			columnMap["code"] = j
+		case strings.Contains(h, "maturity"):
+			columnMap["maturity"] = j
+		case strings.Contains(h, "coupon") || strings.Contains(h, "interest"):
+			columnMap["coupon"] = j
+		case strings.Contains(h, "yield"):
+			columnMap["yield"] = j
+		case strings.Contains(h, "name") || strings.Contains(h, "bond") || strings.Contains(h, "issue") || strings.Contains(h, "description"):
+			columnMap["name"] = j
+		case strings.Contains(h, "price") && !strings.Contains(h, "prev"):
+			columnMap["price"] = j
+		case strings.Contains(h, "volume") || strings.Contains(h, "quantity"):
+			columnMap["volume"] = j
+		case strings.Contains(h, "value"):
+			columnMap["value"] = j
+		}
+	}
+	return columnMap
+}
+
+// parseBonds reads the bonds and treasury bill tables. Sheets are picked by name; reports without
+// such sheets yield no bonds.
+func parseBonds(f *excelize.File, date time.Time, opts Options) []BondRecord {
+	var bonds []BondRecord
+	for _, name := range f.GetSheetList() {
+		if !isBondSheet(name) {
+			continue
+		}
+		var columnMap map[string]int
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if columnMap == nil {
+				if i >= 10 {
+					return StopRows
+				}
+				if isBondHeader(strings.ToLower(strings.Join(row, " "))) {
+					columnMap = mapBondColumns(row)
+				}
+				return nil
+			}
+
+			if bond, ok := parseBondRow(row, columnMap, date); ok {
+				bonds = append(bonds, bond)
+			}
+			return nil
+		})
+	}
+	return bonds
+}
+
+// parseBondRow extracts a bond from a data row. Rows without a name or code, and total rows, are
+// skipped.
+func parseBondRow(row []string, columnMap map[string]int, date time.Time) (BondRecord, bool) {
+	cell := func(col string) string {
+		if idx, ok := columnMap[col]; ok && idx < len(row) {
+			return strings.TrimSpace(row[idx])
+		}
+		return ""
+	}
+	number := func(col string) float64 {
+		val, _ := strconv.ParseFloat(strings.TrimSuffix(strings.ReplaceAll(cell(col), ",", ""), "%"), 64)
+		return val
+	}
+
+	bond := BondRecord{
+		Date:     date,
+		Name:     cell("name"),
+		Symbol:   cell("code"),
+		Coupon:   number("coupon"),
+		Maturity: cell("maturity"),
+		Price:    number("price"),
+		Yield:    number("yield"),
+		Volume:   int64(number("volume")),
+		Value:    number("value"),
+	}
+	if bond.Name == "" && bond.Symbol == "" {
+		return BondRecord{}, false
+	}
+	if strings.Contains(strings.ToLower(bond.Name), "total") {
+		return BondRecord{}, false
+	}
+	if bond.Price == 0 && bond.Yield == 0 && bond.Value == 0 {
+		return BondRecord{}, false
+	}
+	return bond, true
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheVersion is bumped whenever the parser extracts something new, so older cache entries are
+// parsed again
+const cacheVersion = 2
+
+// Cache stores parsed reports keyed by the SHA256 of the workbook, so unchanged files don't have
+// to be parsed again
+type Cache struct {
+	Dir string
+}
+
+type cacheEntry struct {
+	Version  int          `json:"version"`
+	SHA256   string       `json:"sha256"`
+	ParsedAt time.Time    `json:"parsed_at"`
+	Report   *DailyReport `json:"report"`
+}
+
+// NewCache returns a cache kept in dir
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// FileHash returns the hex SHA256 of a file
+func FileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Cache) path(name string) string {
+	return filepath.Join(c.Dir, strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))+".json")
+}
+
+// Get returns the cached report of a file when its content hash still matches
+func (c *Cache) Get(name, hash string) (*DailyReport, bool) {
+	data, err := os.ReadFile(c.path(name))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if entry.Version != cacheVersion || entry.SHA256 != hash || entry.Report == nil {
+		return nil, false
+	}
+	return entry.Report, true
+}
+
+// Put stores the parsed report of a file under its content hash
+func (c *Cache) Put(name, hash string, report *DailyReport) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cacheEntry{
+		Version:  cacheVersion,
+		SHA256:   hash,
+		ParsedAt: time.Now(),
+		Report:   report,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run can't leave a truncated entry
+	tmp := c.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path(name))
+}
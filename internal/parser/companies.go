@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// CompanyInfo is the classification of a listed company
+type CompanyInfo struct {
+	NameAr   string
+	Sector   string
+	Industry string
+}
+
+// CompanyMaster maps ticker symbols to their classification
+type CompanyMaster map[string]CompanyInfo
+
+// LoadCompanyMaster reads a company master list CSV with Symbol, Sector, Industry and optionally
+// NameAr columns (any order, extra columns ignored). A missing file yields an empty list.
+func LoadCompanyMaster(path string) (CompanyMaster, error) {
+	master := make(CompanyMaster)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return master, nil
+	}
+	if err != nil {
+		return master, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return master, fmt.Errorf("failed to read company master list: %w", err)
+	}
+	if len(rows) == 0 {
+		return master, nil
+	}
+
+	cols := make(map[string]int)
+	for i, name := range rows[0] {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	symbolCol, ok := cols["symbol"]
+	if !ok {
+		return master, fmt.Errorf("company master list %s has no Symbol column", path)
+	}
+	get := func(row []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	for _, row := range rows[1:] {
+		if symbolCol >= len(row) || strings.TrimSpace(row[symbolCol]) == "" {
+			continue
+		}
+		master[strings.ToUpper(strings.TrimSpace(row[symbolCol]))] = CompanyInfo{
+			NameAr:   get(row, "namear"),
+			Sector:   get(row, "sector"),
+			Industry: get(row, "industry"),
+		}
+	}
+	return master, nil
+}
+
+// Apply fills in Industry, and Sector and the Arabic name when the report didn't provide them,
+// from the master list
+func (m CompanyMaster) Apply(records []TradeRecord) {
+	for i := range records {
+		info, ok := m[records[i].CompanySymbol]
+		if !ok {
+			continue
+		}
+		if records[i].Sector == "" {
+			records[i].Sector = info.Sector
+		}
+		if records[i].Industry == "" {
+			records[i].Industry = info.Industry
+		}
+		if records[i].CompanyNameAr == "" {
+			records[i].CompanyNameAr = info.NameAr
+		}
+	}
+}
+
+// containsArabic reports whether s has any Arabic letters
+func containsArabic(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Arabic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// sectorName returns the sector named by a sector heading row such as "Banking Sector"
+func sectorName(row []string) (string, bool) {
+	if len(row) == 0 || !strings.Contains(row[0], "Sector") {
+		return "", false
+	}
+	name := strings.TrimSpace(strings.Replace(row[0], "Sector", "", 1))
+	name = strings.Trim(name, " :-")
+	return name, name != ""
+}
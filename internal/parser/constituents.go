@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Constituent is a company included in a market index on the report date
+type Constituent struct {
+	Date          time.Time
+	Index         string // ISX60 or ISX15
+	CompanySymbol string
+	CompanyName   string
+	Weight        float64 // weight in percent, zero when the report doesn't give it
+}
+
+var indexNameRe = regexp.MustCompile(`(?i)isx\s*(?:index\s*)?(60|15)\b`)
+
+// constituentWords mark a label as introducing a constituents list rather than an index value
+var constituentWords = []string{"constituent", "component", "member", "companies", "weight"}
+
+// constituentsIndex returns the index a sheet name or label row introduces, or "" when it
+// doesn't introduce a constituents list
+func constituentsIndex(text string) string {
+	m := indexNameRe.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	lower := strings.ToLower(text)
+	for _, word := range constituentWords {
+		if strings.Contains(lower, word) {
+			return "ISX" + m[1]
+		}
+	}
+	return ""
+}
+
+// parseConstituents reads the ISX60/ISX15 constituent lists. A list starts at a label such as
+// "ISX60 Index Constituents" (or a sheet named like that), followed by a header with a code column.
+func parseConstituents(f *excelize.File, date time.Time, opts Options) []Constituent {
+	var constituents []Constituent
+	seen := make(map[string]bool)
+
+	for _, name := range f.GetSheetList() {
+		current := constituentsIndex(name)
+		var columnMap map[string]int
+		EachRow(f, name, opts, func(i int, row []string) error {
+			text := strings.Join(strings.Fields(strings.Join(row, " ")), " ")
+			if text == "" {
+				return nil
+			}
+
+			hasTicker := false
+			for _, cell := range row {
+				if tickerRe.MatchString(strings.TrimSpace(cell)) {
+					hasTicker = true
+					break
+				}
+			}
+			if !hasTicker {
+				if index := constituentsIndex(text); index != "" {
+					current = index
+					columnMap = nil
+					return nil
+				}
+			}
+			if current == "" {
+				return nil
+			}
+
+			if columnMap == nil {
+				lower := strings.ToLower(text)
+				if !hasTicker && (strings.Contains(lower, "code") || strings.Contains(lower, "symbol")) {
+					columnMap = mapConstituentColumns(row)
+				}
+				return nil
+			}
+
+			idx, ok := columnMap["code"]
+			if !ok || idx >= len(row) || !tickerRe.MatchString(strings.TrimSpace(row[idx])) {
+				return nil
+			}
+			c := Constituent{
+				Date:          date,
+				Index:         current,
+				CompanySymbol: strings.TrimSpace(row[idx]),
+			}
+			if j, ok := columnMap["company"]; ok && j < len(row) {
+				c.CompanyName = strings.TrimSpace(row[j])
+			}
+			if j, ok := columnMap["weight"]; ok && j < len(row) {
+				c.Weight, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(row[j]), "%"), 64)
+			}
+			if key := c.Index + "|" + c.CompanySymbol; !seen[key] {
+				seen[key] = true
+				constituents = append(constituents, c)
+			}
+			return nil
+		})
+	}
+	return constituents
+}
+
+// mapConstituentColumns maps the columns of a constituents list header
+func mapConstituentColumns(row []string) map[string]int {
+	columnMap := make(map[string]int)
+	for j, header := range row {
+		h := strings.ToLower(strings.TrimSpace(header))
+		switch {
+		case h == "code" || h == "symbol" || h == "ticker":
+			columnMap["code"] = j
+		case strings.Contains(h, "weight"):
+			columnMap["weight"] = j
+		case strings.Contains(h, "company") || strings.Contains(h, "name"):
+			columnMap["company"] = j
+		}
+	}
+	return columnMap
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Detection is the trading sheet and layout of a report, found without extracting the records
+type Detection struct {
+	Sheet     string
+	Layout    string   // registry layout name
+	Merged    bool     // the header spans two rows
+	HeaderRow int      // zero-based row of the header, -1 for headerless fixed-column reports
+	Header    []string // header cells, merged when the header spans two rows
+}
+
+// DetectLayout finds the trading sheet and the registry layout of an open workbook the same way
+// parsing does. name is the report's file name, dating it unless opts.Date does.
+func DetectLayout(f *excelize.File, name string, opts Options) (Detection, error) {
+	headerLayouts, fixedLayouts := splitLayouts(opts, reportDate(name, opts))
+
+	sheet, ok := findTradingSheet(f, headerLayouts, fixedLayouts, opts)
+	if !ok {
+		return Detection{}, fmt.Errorf("could not find trading data sheet in file")
+	}
+
+	d := Detection{Sheet: sheet, HeaderRow: -1}
+	fixedRows := false
+	var prevRow []string
+	err := EachRow(f, sheet, opts, func(i int, row []string) error {
+		if i >= 50 {
+			return StopRows
+		}
+		defer func() { prevRow = row }()
+
+		if len(fixedLayouts) > 0 && fixedLayouts[0].looksLikeRow(row) {
+			fixedRows = true
+			return nil
+		}
+		for _, l := range headerLayouts {
+			if l.HeaderRow != nil && *l.HeaderRow == i {
+				d.Layout, d.HeaderRow, d.Header = l.Name, i, row
+				return StopRows
+			}
+		}
+		if l, merged, ok := findHeader(headerLayouts, prevRow, row); ok {
+			d.Layout, d.Merged, d.HeaderRow, d.Header = l.Name, merged, i, row
+			if merged {
+				d.Header = mergeHeaderRows(prevRow, row)
+			}
+			return StopRows
+		}
+		return nil
+	})
+	if err != nil {
+		return Detection{}, err
+	}
+
+	if d.HeaderRow == -1 {
+		if !fixedRows {
+			return Detection{}, fmt.Errorf("could not find header row in trading data")
+		}
+		d.Layout = fixedLayouts[0].Name
+	}
+	return d, nil
+}
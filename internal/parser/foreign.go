@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ForeignTrade is the non-Iraqi investor activity in one company for the day
+type ForeignTrade struct {
+	CompanyName   string
+	CompanySymbol string
+	BuyVolume     int64
+	BuyValue      float64
+	SellVolume    int64
+	SellValue     float64
+}
+
+// isForeignHeader reports whether the lowercased text of a row looks like the header of the
+// non-Iraqi trading table
+func isForeignHeader(rowText string) bool {
+	return (strings.Contains(rowText, "code") || strings.Contains(rowText, "symbol")) &&
+		strings.Contains(rowText, "buy") && strings.Contains(rowText, "sell")
+}
+
+// mapForeignColumns maps the columns of the non-Iraqi trading table header
+func mapForeignColumns(row []string) map[string]int {
+	columnMap := make(map[string]int)
+	for j, header := range row {
+		h := strings.ToLower(strings.TrimSpace(header))
+		quantity := strings.Contains(h, "volume") || strings.Contains(h, "shares")
+		switch {
+		case strings.Contains(h, "company") || strings.Contains(h, "name"):
+			columnMap["company"] = j
+		case h == "code" || h == "symbol" || h == "ticker":
+			columnMap["code"] = j
+		case strings.Contains(h, "buy") && quantity:
+			columnMap["buy_volume"] = j
+		case strings.Contains(h, "buy") && strings.Contains(h, "value"):
+			columnMap["buy_value"] = j
+		case strings.Contains(h, "sell") && quantity:
+			columnMap["sell_volume"] = j
+		case strings.Contains(h, "sell") && strings.Contains(h, "value"):
+			columnMap["sell_value"] = j
+		}
+	}
+	return columnMap
+}
+
+// parseForeignTrading looks for the non-Iraqi buy/sell table in every sheet except the trading
+// sheet. Reports without one yield no trades.
+func parseForeignTrading(f *excelize.File, tradingSheet string, opts Options) []ForeignTrade {
+	var trades []ForeignTrade
+	for _, name := range f.GetSheetList() {
+		if name == tradingSheet {
+			continue
+		}
+		var columnMap map[string]int
+		var prevRow []string
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if columnMap == nil {
+				defer func() { prevRow = row }()
+				if i >= 10 {
+					return StopRows
+				}
+				// The buy and sell groups are usually merged cells above volume and value
+				header := row
+				if !isForeignHeader(strings.ToLower(strings.Join(header, " "))) {
+					header = mergeHeaderRows(prevRow, row)
+					if prevRow == nil || !isForeignHeader(strings.ToLower(strings.Join(header, " "))) {
+						return nil
+					}
+				}
+				// A group row on its own ("Buy", "Sell") maps no amounts; the row below completes it
+				columnMap = mapForeignColumns(header)
+				_, hasCode := columnMap["code"]
+				_, hasBuy := columnMap["buy_value"]
+				if !hasCode || !hasBuy {
+					columnMap = nil
+				}
+				return nil
+			}
+
+			if trade, ok := parseForeignRow(row, columnMap); ok {
+				trades = append(trades, trade)
+			}
+			return nil
+		})
+		if len(trades) > 0 {
+			break
+		}
+	}
+	return trades
+}
+
+// parseForeignRow extracts a foreign trade from a data row of the non-Iraqi trading table
+func parseForeignRow(row []string, columnMap map[string]int) (ForeignTrade, bool) {
+	cell := func(col string) string {
+		if idx, ok := columnMap[col]; ok && idx < len(row) {
+			return strings.TrimSpace(row[idx])
+		}
+		return ""
+	}
+	number := func(col string) float64 {
+		val, _ := strconv.ParseFloat(strings.ReplaceAll(cell(col), ",", ""), 64)
+		return val
+	}
+
+	code := cell("code")
+	if !tickerRe.MatchString(code) {
+		return ForeignTrade{}, false
+	}
+	return ForeignTrade{
+		CompanyName:   cell("company"),
+		CompanySymbol: code,
+		BuyVolume:     int64(number("buy_volume")),
+		BuyValue:      number("buy_value"),
+		SellVolume:    int64(number("sell_volume")),
+		SellValue:     number("sell_value"),
+	}, true
+}
+
+// applyForeignTrading copies foreign activity onto the matching trade records
+func applyForeignTrading(records []TradeRecord, trades []ForeignTrade) {
+	bySymbol := make(map[string]ForeignTrade, len(trades))
+	for _, trade := range trades {
+		bySymbol[trade.CompanySymbol] = trade
+	}
+	for i := range records {
+		if trade, ok := bySymbol[records[i].CompanySymbol]; ok {
+			records[i].ForeignBuyVolume = trade.BuyVolume
+			records[i].ForeignBuyValue = trade.BuyValue
+			records[i].ForeignSellVolume = trade.SellVolume
+			records[i].ForeignSellValue = trade.SellValue
+		}
+	}
+}
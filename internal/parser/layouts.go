@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Names of the bundled layouts. Layouts from a custom registry report their own name, and
+// LayoutMergedHeader when their header was split over two rows.
+const (
+	// LayoutModern has a single header row naming every column
+	LayoutModern = "modern"
+	// LayoutMergedHeader is the pre-2015 layout whose header is split over two rows with
+	// merged group cells such as "Price" above "Opening", "Highest", "Lowest"
+	LayoutMergedHeader = "legacy-merged-header"
+	// LayoutFixedColumns is the oldest layout without a usable header row; columns are
+	// identified by position
+	LayoutFixedColumns = "legacy-fixed"
+)
+
+// tickerRe matches ISX ticker codes such as "BBOB"
+var tickerRe = regexp.MustCompile(`^[A-Z]{3,5}$`)
+
+// mergeHeaderRows combines a two-row header into one. Merged group cells in the top row only
+// carry text in their first cell, so that text is repeated over the columns below it.
+func mergeHeaderRows(top, bottom []string) []string {
+	n := len(top)
+	if len(bottom) > n {
+		n = len(bottom)
+	}
+	cell := func(row []string, i int) string {
+		if i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	merged := make([]string, n)
+	group := ""
+	for i := 0; i < n; i++ {
+		t, b := cell(top, i), cell(bottom, i)
+		if t != "" {
+			group = t
+		} else if b != "" {
+			t = group
+		} else {
+			group = ""
+		}
+		merged[i] = strings.TrimSpace(t + " " + b)
+	}
+	return merged
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Listing statuses of a company
+const (
+	ListingActive    = "active"
+	ListingSuspended = "suspended"
+	ListingDelisted  = "delisted"
+)
+
+// ListingChange is a suspension, delisting or resumption announced in a report's notes
+type ListingChange struct {
+	Date          time.Time
+	CompanySymbol string
+	Status        string
+	Note          string
+}
+
+// listingStatusFromText returns the listing status a status cell or note describes, or "" when
+// it describes none
+func listingStatusFromText(text string) string {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(lower, "delist"):
+		return ListingDelisted
+	case strings.Contains(lower, "suspen"):
+		return ListingSuspended
+	case strings.Contains(lower, "resum") || strings.Contains(lower, "lifted"):
+		return ListingActive
+	}
+	return ""
+}
+
+// parseListingChanges scans the notes of a report, outside the trading table rows, for companies
+// being suspended, delisted or resuming trading
+func parseListingChanges(f *excelize.File, date time.Time, tradingSheet string, tradingRows map[int]bool, opts Options) []ListingChange {
+	var changes []ListingChange
+	seen := make(map[string]bool)
+	for _, name := range f.GetSheetList() {
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if name == tradingSheet && tradingRows[i] {
+				return nil
+			}
+			text := strings.TrimSpace(strings.Join(strings.Fields(strings.Join(row, " ")), " "))
+			status := listingStatusFromText(text)
+			if status == "" {
+				return nil
+			}
+			symbol := noteTicker(row, text)
+			if symbol == "" || seen[symbol] {
+				return nil
+			}
+			seen[symbol] = true
+			changes = append(changes, ListingChange{Date: date, CompanySymbol: symbol, Status: status, Note: text})
+			return nil
+		})
+	}
+	return changes
+}
+
+// applyListingChanges sets the listing status of each record: announced changes win, then the
+// report's status column, and traded companies are otherwise active
+func applyListingChanges(records []TradeRecord, changes []ListingChange) {
+	bySymbol := make(map[string]string, len(changes))
+	for _, c := range changes {
+		bySymbol[c.CompanySymbol] = c.Status
+	}
+	for i := range records {
+		if status, ok := bySymbol[records[i].CompanySymbol]; ok {
+			records[i].ListingStatus = status
+		} else if records[i].ListingStatus == "" {
+			records[i].ListingStatus = ListingActive
+		}
+	}
+}
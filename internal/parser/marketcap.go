@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// CompanyShares is the listed share count and market capitalisation of one company
+type CompanyShares struct {
+	CompanySymbol     string
+	SharesOutstanding int64
+	MarketCap         float64
+}
+
+// isSharesHeader reports whether the lowercased text of a row looks like the header of the listed
+// companies table
+func isSharesHeader(rowText string) bool {
+	return (strings.Contains(rowText, "code") || strings.Contains(rowText, "symbol")) &&
+		(strings.Contains(rowText, "market cap") || strings.Contains(rowText, "listed shares") ||
+			strings.Contains(rowText, "shares outstanding") || strings.Contains(rowText, "paid capital"))
+}
+
+// mapSharesColumns maps the columns of the listed companies table header
+func mapSharesColumns(row []string) map[string]int {
+	columnMap := make(map[string]int)
+	for j, header := range row {
+		h := strings.ToLower(strings.TrimSpace(header))
+		switch {
+		case h == "code" || h == "symbol" || h == "ticker":
+			columnMap["code"] = j
+		case strings.Contains(h, "market cap"):
+			columnMap["market_cap"] = j
+		case strings.Contains(h, "listed shares") || strings.Contains(h, "shares outstanding") ||
+			strings.Contains(h, "paid capital") || strings.Contains(h, "no. of shares listed"):
+			columnMap["shares_outstanding"] = j
+		}
+	}
+	return columnMap
+}
+
+// parseCompanyShares reads listed shares and market capitalisation from the company pages of the
+// report, any sheet other than the trading sheet with a matching header.
+func parseCompanyShares(f *excelize.File, tradingSheet string, opts Options) []CompanyShares {
+	var shares []CompanyShares
+	for _, name := range f.GetSheetList() {
+		if name == tradingSheet {
+			continue
+		}
+		var columnMap map[string]int
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if columnMap == nil {
+				if i >= 10 {
+					return StopRows
+				}
+				if isSharesHeader(strings.ToLower(strings.Join(row, " "))) {
+					columnMap = mapSharesColumns(row)
+					if _, ok := columnMap["code"]; !ok {
+						columnMap = nil
+					}
+				}
+				return nil
+			}
+
+			cell := func(col string) string {
+				if idx, ok := columnMap[col]; ok && idx < len(row) {
+					return strings.ReplaceAll(strings.TrimSpace(row[idx]), ",", "")
+				}
+				return ""
+			}
+			code := cell("code")
+			if !tickerRe.MatchString(code) {
+				return nil
+			}
+			count, _ := strconv.ParseFloat(cell("shares_outstanding"), 64)
+			marketCap, _ := strconv.ParseFloat(cell("market_cap"), 64)
+			shares = append(shares, CompanyShares{
+				CompanySymbol:     code,
+				SharesOutstanding: int64(count),
+				MarketCap:         marketCap,
+			})
+			return nil
+		})
+		if len(shares) > 0 {
+			break
+		}
+	}
+	return shares
+}
+
+// applyCompanyShares copies listed shares and market capitalisation onto the trade records. Market
+// cap is derived from the closing price when the report only lists the share count.
+func applyCompanyShares(records []TradeRecord, shares []CompanyShares) {
+	bySymbol := make(map[string]CompanyShares, len(shares))
+	for _, s := range shares {
+		bySymbol[s.CompanySymbol] = s
+	}
+	for i := range records {
+		if s, ok := bySymbol[records[i].CompanySymbol]; ok {
+			if records[i].SharesOutstanding == 0 {
+				records[i].SharesOutstanding = s.SharesOutstanding
+			}
+			if records[i].MarketCap == 0 {
+				records[i].MarketCap = s.MarketCap
+			}
+		}
+		if records[i].MarketCap == 0 && records[i].SharesOutstanding > 0 {
+			records[i].MarketCap = float64(records[i].SharesOutstanding) * records[i].ClosePrice
+		}
+	}
+}
@@ -2,6 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -12,6 +15,7 @@ import (
 // TradeRecord represents a single company's trading data for one day.
 type TradeRecord struct {
 	CompanyName      string
+	CompanyNameAr    string // Arabic company name, when the report carries one
 	CompanySymbol    string
 	Date             time.Time
 	OpenPrice        float64
@@ -26,313 +30,524 @@ type TradeRecord struct {
 	NumTrades        int64
 	Volume           int64
 	Value            float64
-	TradingStatus    bool // true if actively traded, false if forward-filled
+	TradingStatus    bool   // true if actively traded, false if forward-filled
+	Sector           string // sector heading the company is listed under in the report
+	Industry         string // industry from the company master list
+
+	// Non-Iraqi investor activity, zero when the report has no foreign trading table
+	ForeignBuyVolume  int64
+	ForeignBuyValue   float64
+	ForeignSellVolume int64
+	ForeignSellValue  float64
+
+	SharesOutstanding int64   // listed shares
+	MarketCap         float64 // market capitalisation in IQD
+
+	ListingStatus string // one of the Listing constants; empty in data processed before it was tracked
+
+	// Prices adjusted for later splits, capital increases and dividends. Reports don't carry
+	// them; the processor derives them from the corporate actions.
+	AdjOpenPrice  float64
+	AdjHighPrice  float64
+	AdjLowPrice   float64
+	AdjClosePrice float64
+
+	// Close, value and market cap in US dollars at the exchange rate of the day, zero when no rate
+	// is known. The processor derives them from an exchange-rate file.
+	USDClosePrice float64
+	USDValue      float64
+	USDMarketCap  float64
 }
 
 // DailyReport represents all trades in a single day's file.
 type DailyReport struct {
 	Records []TradeRecord
+	Layout  string // layout the records were extracted with, one of the Layout constants
+	Foreign []ForeignTrade
+	Bonds   []BondRecord
+	Shares  []CompanyShares
+	Actions []CorporateAction
+	Summary MarketSummary
+
+	Constituents []Constituent
+	Listing      []ListingChange
+
+	Validation Validation
 }
 
 // ParseFile reads an ISX daily report Excel file and extracts the trading data.
 func ParseFile(filePath string) (*DailyReport, error) {
+	return ParseFileWithOptions(filePath, DefaultOptions)
+}
+
+// ParseFileWithOptions is ParseFile with explicit read options.
+func ParseFileWithOptions(filePath string, opts Options) (*DailyReport, error) {
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer f.Close()
 
-	// Find the correct sheet name by looking for one that contains trading data
-	var rows [][]string
-	var sheetFound bool
-	var sheetName string
-
-	// Try different possible sheet names
-	possibleNames := []string{"Bullient  ", "Bullient", "Bulletin", "Bulletin  ", "trading", "Trading"}
-
-	for _, name := range possibleNames {
-		if testRows, testErr := f.GetRows(name); testErr == nil {
-			rows = testRows
-			sheetFound = true
-			sheetName = name
-			break
-		}
+	return parseWorkbook(f, filePath, opts)
+}
+
+// Parse extracts the trading data from a report read from r, such as an uploaded file held in
+// memory. The report date isn't known, so records are left undated.
+func Parse(r io.Reader) (*DailyReport, error) {
+	return ParseReaderWithOptions(r, "", DefaultOptions)
+}
+
+// ParseReaderWithOptions is Parse with explicit read options. name is the report's file name,
+// used to date the records and label the validation report; it may be empty.
+func ParseReaderWithOptions(r io.Reader, name string, opts Options) (*DailyReport, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
 	}
+	defer f.Close()
 
-	// If none of the common names work, try to find a sheet with trading data
-	if !sheetFound {
-		for _, name := range f.GetSheetList() {
-			if testRows, testErr := f.GetRows(name); testErr == nil && len(testRows) > 3 {
-				// Check if this sheet contains trading data by looking for typical headers
-				for _, row := range testRows[:4] {
-					rowText := strings.ToLower(strings.Join(row, " "))
-					if strings.Contains(rowText, "company name") && strings.Contains(rowText, "code") &&
-						(strings.Contains(rowText, "price") || strings.Contains(rowText, "volume")) {
-						rows = testRows
-						sheetFound = true
-						sheetName = name
-						break
-					}
-				}
-				if sheetFound {
-					break
-				}
-			}
-		}
+	return parseWorkbook(f, name, opts)
+}
+
+// ParseFS reads a report from a file system, such as embedded test fixtures.
+func ParseFS(fsys fs.FS, path string) (*DailyReport, error) {
+	return ParseFSWithOptions(fsys, path, DefaultOptions)
+}
+
+// ParseFSWithOptions is ParseFS with explicit read options, e.g. the date of a fixture not
+// named by the default scheme.
+func ParseFSWithOptions(fsys fs.FS, path string, opts Options) (*DailyReport, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer file.Close()
 
+	return ParseReaderWithOptions(file, path, opts)
+}
+
+// parseWorkbook extracts the trading data from an open workbook. name is the report's file name.
+func parseWorkbook(f *excelize.File, name string, opts Options) (*DailyReport, error) {
+	date := reportDate(name, opts)
+	headerLayouts, fixedLayouts := splitLayouts(opts, date)
+
+	// Find the correct sheet name by looking for one that contains trading data
+	sheetName, sheetFound := findTradingSheet(f, headerLayouts, fixedLayouts, opts)
 	if !sheetFound {
 		return nil, fmt.Errorf("could not find trading data sheet in file")
 	}
 
-	fmt.Printf("Found trading data in sheet: %s\n", sheetName)
-	fmt.Printf("Total rows in sheet: %d\n", len(rows))
+	opts.logf("Found trading data in sheet: %s\n", sheetName)
 
-	// Print first 20 rows to understand the structure
-	fmt.Println("=== First 20 rows ===")
-	for i := 0; i < len(rows) && i < 20; i++ {
-		fmt.Printf("Row %d: %v\n", i, rows[i])
+	report := &DailyReport{}
+	if name != "" {
+		report.Validation.File = filepath.Base(name)
+	}
+	report.Validation.Sheet = sheetName
+
+	// Find the header row and map column positions dynamically, then process the data rows
+	// after it. Rows are handled one at a time so the sheet never has to be held in memory.
+	headerRow := -1
+	var columnMap map[string]int
+	totalRows := 0
+	var prevRow []string
+	currentSector := ""
+	tradeRows := make(map[int]bool) // rows holding trades, skipped when looking for notes
+
+	// Rows matching a fixed-column layout are collected until a header shows up, so reports
+	// without any header can still be parsed in the same pass
+	var fixedRecords []TradeRecord
+	var fixedLayout *SheetLayout
+	if len(fixedLayouts) > 0 {
+		fixedLayout = &fixedLayouts[0]
 	}
 
-	// Find the last row with actual data
-	lastDataRow := -1
-	for i := len(rows) - 1; i >= 0; i-- {
-		if len(rows[i]) > 5 {
-			// Check if this row has meaningful data (not just empty cells)
-			hasData := false
-			for _, cell := range rows[i] {
-				if strings.TrimSpace(cell) != "" {
-					hasData = true
+	err := EachRow(f, sheetName, opts, func(i int, row []string) error {
+		totalRows = i + 1
+
+		if headerRow == -1 {
+			defer func() { prevRow = row }() // kept for two-row legacy headers
+
+			if fixedLayout != nil && fixedLayout.looksLikeRow(row) {
+				if record, _, ok := parseRowSafely(i, row, fixedLayout.columnIndexes(), date); ok {
+					fixedRecords = append(fixedRecords, record)
+					tradeRows[i] = true
+				}
+				return nil
+			}
+
+			// Layouts with a fixed header row take it as is; the others look for a row (or
+			// two-row merged header) naming every required column
+			var layout SheetLayout
+			var header []string
+			found := false
+			for _, l := range headerLayouts {
+				if l.HeaderRow != nil && *l.HeaderRow == i {
+					layout, header, found = l, row, true
+					report.Layout = l.Name
 					break
 				}
 			}
-			if hasData {
-				lastDataRow = i
-				break
+			if !found {
+				var merged bool
+				layout, merged, found = findHeader(headerLayouts, prevRow, row)
+				if !found {
+					return nil
+				}
+				header = row
+				report.Layout = layout.Name
+				if merged {
+					header = mergeHeaderRows(prevRow, row)
+					report.Layout = LayoutMergedHeader
+				}
+			}
+
+			headerRow = i
+			opts.logf("Header row %d (%s layout)\n", i, report.Layout)
+			columnMap = layout.mapHeader(header)
+			report.Validation.checkHeader(layout, header, columnMap)
+
+			// Verify we found all required columns
+			if col, missing := layout.missingColumn(columnMap); missing {
+				return fmt.Errorf("could not find required column: %s", col)
 			}
+			return nil
 		}
-	}
 
-	fmt.Printf("Last row with data: %d\n", lastDataRow)
-	if lastDataRow > 0 {
-		fmt.Printf("Last data row content: %v\n", rows[lastDataRow])
+		if name, ok := sectorName(row); ok {
+			currentSector = name
+		}
+		report.Validation.RowsTotal++
+		if record, skip, ok := parseRowSafely(i, row, columnMap, date); !ok {
+			report.Validation.skipRow(i, row, skip)
+		} else {
+			if skip.Reason != "" {
+				report.Validation.Suspicious = append(report.Validation.Suspicious,
+					fmt.Sprintf("%s: unreadable numbers in row %d (%s)", record.CompanySymbol, i+1, skip.Detail))
+			}
+			record.Sector = currentSector
+			report.Records = append(report.Records, record)
+			tradeRows[i] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	report := &DailyReport{}
-	date, _ := time.Parse("2006 01 02", strings.TrimSuffix(strings.TrimPrefix(filePath, "downloads/"), " ISX Daily Report.xlsx"))
+	opts.logf("Total rows in sheet: %d\n", totalRows)
 
-	// Find the header row and map column positions dynamically
-	headerRow := -1
-	columnMap := make(map[string]int)
-
-	for i, row := range rows {
-		if len(row) < 5 {
-			continue
-		}
+	if headerRow == -1 && len(fixedRecords) > 0 {
+		opts.logf("No header row found, using %s layout\n", LayoutFixedColumns)
+		report.Records = fixedRecords
+		report.Layout = fixedLayout.Name
+		report.Validation.RowsTotal = len(fixedRecords)
+	} else if headerRow == -1 {
+		return nil, fmt.Errorf("could not find header row in trading data")
+	}
 
-		// Look for header row containing key column names
-		rowText := strings.ToLower(strings.Join(row, " "))
+	opts.logf("Total records processed: %d\n", len(report.Records))
 
-		// Debug: Show what we're looking for in each row
-		fmt.Printf("Row %d text: %s\n", i, rowText)
+	report.Validation.Layout = report.Layout
+	report.Validation.RowsParsed = len(report.Records)
+	for _, record := range report.Records {
+		report.Validation.checkRecord(record)
+	}
 
-		// More flexible header detection - look for key trading columns
-		if (strings.Contains(rowText, "company") || strings.Contains(rowText, "name")) &&
-			strings.Contains(rowText, "code") &&
-			(strings.Contains(rowText, "closing") || strings.Contains(rowText, "price")) &&
-			strings.Contains(rowText, "volume") {
-			headerRow = i
-			fmt.Printf("*** FOUND HEADER ROW AT %d ***\n", i)
-
-			// Map column positions based on header names
-			for j, header := range row {
-				headerLower := strings.ToLower(strings.TrimSpace(header))
-				fmt.Printf("  Column %d: '%s'\n", j, headerLower)
-
-				// Map different variations of column names
-				switch {
-				case strings.Contains(headerLower, "company") || (strings.Contains(headerLower, "name") && !strings.Contains(headerLower, "code")):
-					columnMap["company"] = j
-					fmt.Printf("    -> Mapped to COMPANY\n")
-				case headerLower == "code":
-					columnMap["code"] = j
-					fmt.Printf("    -> Mapped to CODE\n")
-				case strings.Contains(headerLower, "opening") && strings.Contains(headerLower, "price"):
-					columnMap["open"] = j
-					fmt.Printf("    -> Mapped to OPEN\n")
-				case strings.Contains(headerLower, "highest") && strings.Contains(headerLower, "price"):
-					columnMap["high"] = j
-					fmt.Printf("    -> Mapped to HIGH\n")
-				case strings.Contains(headerLower, "lowest") && strings.Contains(headerLower, "price"):
-					columnMap["low"] = j
-					fmt.Printf("    -> Mapped to LOW\n")
-				case strings.Contains(headerLower, "average") && strings.Contains(headerLower, "price") && !strings.Contains(headerLower, "prev"):
-					columnMap["avg"] = j
-					fmt.Printf("    -> Mapped to AVERAGE\n")
-				case strings.Contains(headerLower, "prev") && strings.Contains(headerLower, "average"):
-					columnMap["prev_avg"] = j
-					fmt.Printf("    -> Mapped to PREV_AVERAGE\n")
-				case strings.Contains(headerLower, "closing") && strings.Contains(headerLower, "price"):
-					columnMap["close"] = j
-					fmt.Printf("    -> Mapped to CLOSE\n")
-				case strings.Contains(headerLower, "prev") && strings.Contains(headerLower, "closing"):
-					columnMap["prev_close"] = j
-					fmt.Printf("    -> Mapped to PREV_CLOSE\n")
-				case strings.Contains(headerLower, "change") && strings.Contains(headerLower, "%"):
-					columnMap["change_pct"] = j
-					fmt.Printf("    -> Mapped to CHANGE_PCT\n")
-				case strings.Contains(headerLower, "no") && strings.Contains(headerLower, "trades"):
-					columnMap["num_trades"] = j
-					fmt.Printf("    -> Mapped to NUM_TRADES\n")
-				case headerLower == "traded volume":
-					columnMap["volume"] = j
-					fmt.Printf("    -> Mapped to VOLUME\n")
-				case headerLower == "traded value":
-					columnMap["value"] = j
-					fmt.Printf("    -> Mapped to VALUE\n")
-				}
-			}
-			fmt.Printf("Final column mapping: %+v\n", columnMap)
-			break
-		}
+	report.Foreign = parseForeignTrading(f, sheetName, opts)
+	if len(report.Foreign) > 0 {
+		opts.logf("Foreign trading records: %d\n", len(report.Foreign))
+		applyForeignTrading(report.Records, report.Foreign)
 	}
 
-	if headerRow == -1 {
-		return nil, fmt.Errorf("could not find header row in trading data")
+	report.Shares = parseCompanyShares(f, sheetName, opts)
+	applyCompanyShares(report.Records, report.Shares)
+
+	report.Actions = parseCorporateActions(f, date, sheetName, tradeRows, opts)
+	if len(report.Actions) > 0 {
+		opts.logf("Corporate actions: %d\n", len(report.Actions))
 	}
 
-	// Verify we found all required columns
-	requiredCols := []string{"code", "close", "volume", "value"}
-	for _, col := range requiredCols {
-		if _, exists := columnMap[col]; !exists {
-			return nil, fmt.Errorf("could not find required column: %s", col)
-		}
+	report.Summary = parseMarketSummary(f, date, sheetName, tradeRows, report.Records, opts)
+
+	report.Listing = parseListingChanges(f, date, sheetName, tradeRows, opts)
+	applyListingChanges(report.Records, report.Listing)
+
+	report.Constituents = parseConstituents(f, date, opts)
+	if len(report.Constituents) > 0 {
+		opts.logf("Index constituents: %d\n", len(report.Constituents))
 	}
 
-	// Process data rows starting after the header, up to the last data row
-	dataEndRow := len(rows)
-	if lastDataRow > 0 {
-		dataEndRow = lastDataRow + 1
+	report.Bonds = parseBonds(f, date, opts)
+	if len(report.Bonds) > 0 {
+		opts.logf("Bond records: %d\n", len(report.Bonds))
 	}
 
-	fmt.Printf("Processing data rows from %d to %d\n", headerRow+1, dataEndRow-1)
+	return report, nil
+}
 
-	for i := headerRow + 1; i < dataEndRow; i++ {
-		row := rows[i]
+// defaultNameSuffix follows the date of a report named by the default "2025 06 24 ISX Daily
+// Report.xlsx" scheme
+const defaultNameSuffix = " ISX Daily Report.xlsx"
 
-		fmt.Printf("Processing row %d: %v\n", i, row)
+// reportDate returns the date of the report named name: opts.Date when set, else the date of
+// its default-scheme name. Reports with neither, like those read from memory without a name, are
+// undated, whichever entry point reads them.
+func reportDate(name string, opts Options) time.Time {
+	if !opts.Date.IsZero() {
+		return opts.Date
+	}
+	base := filepath.Base(name)
+	if !strings.HasSuffix(base, defaultNameSuffix) {
+		return time.Time{}
+	}
+	date, _ := time.Parse("2006 01 02", strings.TrimSuffix(base, defaultNameSuffix))
+	return date
+}
 
-		// Skip if not enough columns
-		if len(row) <= columnMap["value"] {
-			fmt.Printf("  -> Skipped: Not enough columns (need %d, got %d)\n", columnMap["value"]+1, len(row))
-			continue
+// splitLayouts returns the layouts applying to a report date, header layouts apart from
+// fixed-column ones. A layout named in opts (chosen from the report's format fingerprint) is the
+// only one tried.
+func splitLayouts(opts Options, date time.Time) (headerLayouts, fixedLayouts []SheetLayout) {
+	layouts := opts.registry().LayoutsFor(date)
+	if opts.Layout != "" {
+		if l, ok := opts.registry().Layout(opts.Layout); ok {
+			layouts = []SheetLayout{l}
 		}
+	}
+	for _, l := range layouts {
+		if l.fixed() {
+			fixedLayouts = append(fixedLayouts, l)
+		} else {
+			headerLayouts = append(headerLayouts, l)
+		}
+	}
+	return headerLayouts, fixedLayouts
+}
 
-		// Skip empty rows - check if all relevant columns are empty
-		isEmpty := true
-		for _, colIndex := range columnMap {
-			if colIndex < len(row) && strings.TrimSpace(row[colIndex]) != "" {
-				isEmpty = false
-				break
+// findTradingSheet returns the sheet holding the trading table
+func findTradingSheet(f *excelize.File, headerLayouts, fixedLayouts []SheetLayout, opts Options) (string, bool) {
+	if opts.Sheet != "" && hasSheet(f, opts.Sheet) {
+		return opts.Sheet, true
+	}
+
+	// Try the sheet names of the header layouts
+	for _, l := range headerLayouts {
+		for _, name := range l.Sheets {
+			if hasSheet(f, name) {
+				return name, true
 			}
 		}
-		if isEmpty {
-			fmt.Printf("  -> Skipped: Empty row\n")
-			continue
+	}
+
+	// If none of the common names work, try to find a sheet with trading data
+	for _, name := range f.GetSheetList() {
+		// Check if this sheet contains trading data by looking for a header in the first rows
+		found := false
+		var prevRow []string
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if i >= 6 {
+				return StopRows
+			}
+			if _, _, ok := findHeader(headerLayouts, prevRow, row); ok {
+				found = true
+				return StopRows
+			}
+			prevRow = row
+			return nil
+		})
+		if found {
+			return name, true
 		}
+	}
 
-		// Skip sector headers (merged cells or rows containing "Sector")
-		if strings.Contains(row[0], "Sector") || strings.Contains(row[0], "Total") {
-			fmt.Printf("  -> Skipped: Sector/Total row\n")
-			continue
+	// Older reports use generic sheet names and may have no header at all
+	for _, l := range fixedLayouts {
+		for _, name := range l.Sheets {
+			if hasSheet(f, name) {
+				return name, true
+			}
 		}
+	}
+	if len(fixedLayouts) > 0 {
+		for _, name := range f.GetSheetList() {
+			found := false
+			EachRow(f, name, opts, func(i int, row []string) error {
+				if i >= 30 {
+					return StopRows
+				}
+				if fixedLayouts[0].looksLikeRow(row) {
+					found = true
+					return StopRows
+				}
+				return nil
+			})
+			if found {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
 
-		// Skip if code column is empty (likely a merged/header row)
-		if columnMap["code"] < len(row) && strings.TrimSpace(row[columnMap["code"]]) == "" {
-			fmt.Printf("  -> Skipped: Empty code column\n")
+// findHeader returns the first layout whose header matches row, or the two-row header formed
+// with prev for layouts that allow merged headers
+func findHeader(layouts []SheetLayout, prev, row []string) (SheetLayout, bool, bool) {
+	for _, l := range layouts {
+		if l.HeaderRow != nil {
 			continue
 		}
+		if l.isHeader(row) {
+			return l, false, true
+		}
+		if l.MergedHeader && prev != nil && l.isHeader(mergeHeaderRows(prev, row)) {
+			return l, true, true
+		}
+	}
+	return SheetLayout{}, false, false
+}
 
-		// Extract data using dynamic column mapping
-		companyCode := strings.TrimSpace(row[columnMap["code"]])
-		if companyCode == "" {
-			fmt.Printf("  -> Skipped: Empty company code after trim\n")
-			continue
+// parseRowSafely is parseDataRow that turns a panic on a malformed row into a skip, so one bad
+// row doesn't abort the whole file
+func parseRowSafely(i int, row []string, columnMap map[string]int, date time.Time) (record TradeRecord, skip rowSkip, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			record, skip, ok = TradeRecord{}, rowSkip{Reason: "parse error", Detail: fmt.Sprint(r)}, false
 		}
+	}()
+	return parseDataRow(i, row, columnMap, date)
+}
 
-		fmt.Printf("  -> Processing: Code=%s\n", companyCode)
+// rowSkip explains why a data row produced no trade record
+type rowSkip struct {
+	Reason string // short reason, used to group skips
+	Detail string
+}
 
-		// Helper function to safely parse float
-		parseFloat := func(colName string) float64 {
-			if idx, exists := columnMap[colName]; exists && idx < len(row) {
-				val, _ := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(row[idx]), ",", ""), 64)
-				return val
-			}
-			return 0.0
+// parseDataRow extracts a trade record from a data row using the column mapping. It returns
+// false and the reason for rows that carry no trade (empty, sector headers, totals) or that
+// can't be read.
+func parseDataRow(i int, row []string, columnMap map[string]int, date time.Time) (TradeRecord, rowSkip, bool) {
+	// Skip blank rows, which streaming readers return short or empty
+	if strings.TrimSpace(strings.Join(row, "")) == "" {
+		return TradeRecord{}, rowSkip{Reason: "empty row"}, false
+	}
+
+	// Skip sector headers (merged cells or rows containing "Sector")
+	if strings.Contains(row[0], "Sector") || strings.Contains(row[0], "Total") {
+		return TradeRecord{}, rowSkip{Reason: "sector/total row"}, false
+	}
+
+	// Skip if not enough columns
+	if len(row) <= columnMap["value"] {
+		return TradeRecord{}, rowSkip{Reason: "not enough columns", Detail: fmt.Sprintf("need %d, got %d", columnMap["value"]+1, len(row))}, false
+	}
+
+	// Skip empty rows - check if all relevant columns are empty
+	isEmpty := true
+	for _, colIndex := range columnMap {
+		if colIndex < len(row) && strings.TrimSpace(row[colIndex]) != "" {
+			isEmpty = false
+			break
 		}
+	}
+	if isEmpty {
+		return TradeRecord{}, rowSkip{Reason: "empty row"}, false
+	}
 
-		// Helper function to safely parse int
-		parseInt := func(colName string) int64 {
-			if idx, exists := columnMap[colName]; exists && idx < len(row) {
-				val, _ := strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(row[idx]), ",", ""), 10, 64)
-				return val
-			}
+	// Skip if code column is empty (likely a merged/header row)
+	if columnMap["code"] < len(row) && strings.TrimSpace(row[columnMap["code"]]) == "" {
+		return TradeRecord{}, rowSkip{Reason: "empty code"}, false
+	}
+
+	// Extract data using dynamic column mapping
+	companyCode := strings.TrimSpace(row[columnMap["code"]])
+	if companyCode == "" {
+		return TradeRecord{}, rowSkip{Reason: "empty code"}, false
+	}
+
+	// Cells that aren't numbers are collected rather than silently read as zero. Blank cells and
+	// the dash used for "no value" are zero.
+	var badCells []string
+	number := func(colName string) float64 {
+		idx, exists := columnMap[colName]
+		if !exists || idx >= len(row) {
 			return 0
 		}
-
-		// Helper function to safely get string
-		getString := func(colName string) string {
-			if idx, exists := columnMap[colName]; exists && idx < len(row) {
-				return strings.TrimSpace(row[idx])
-			}
-			return ""
+		text := strings.ReplaceAll(strings.TrimSpace(row[idx]), ",", "")
+		if text == "" || text == "-" {
+			return 0
 		}
-
-		// Extract all available fields
-		companyName := getString("company")
-		openPrice := parseFloat("open")
-		highPrice := parseFloat("high")
-		lowPrice := parseFloat("low")
-		avgPrice := parseFloat("avg")
-		prevAvgPrice := parseFloat("prev_avg")
-		closePrice := parseFloat("close")
-		prevClosePrice := parseFloat("prev_close")
-		changePercent := parseFloat("change_pct")
-		numTrades := parseInt("num_trades")
-		volume := parseInt("volume")
-		value := parseFloat("value")
-
-		// Calculate change if not available
-		change := closePrice - prevClosePrice
-
-		record := TradeRecord{
-			CompanyName:      companyName,
-			CompanySymbol:    companyCode,
-			Date:             date,
-			OpenPrice:        openPrice,
-			HighPrice:        highPrice,
-			LowPrice:         lowPrice,
-			AveragePrice:     avgPrice,
-			PrevAveragePrice: prevAvgPrice,
-			ClosePrice:       closePrice,
-			PrevClosePrice:   prevClosePrice,
-			Change:           change,
-			ChangePercent:    changePercent,
-			NumTrades:        numTrades,
-			Volume:           volume,
-			Value:            value,
-			TradingStatus:    true, // Actual trading data
+		val, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			badCells = append(badCells, fmt.Sprintf("%s=%q", colName, row[idx]))
+			return 0
 		}
-		report.Records = append(report.Records, record)
+		return val
+	}
 
-		// Debug: Show first few records
-		if len(report.Records) <= 5 {
-			fmt.Printf("Record %d: %s (%s) - Open: %.3f, High: %.3f, Low: %.3f, Close: %.3f, Volume: %d, Value: %.2f\n",
-				len(report.Records), companyCode, companyName, openPrice, highPrice, lowPrice, closePrice, volume, value)
+	// Helper function to safely parse float
+	parseFloat := func(colName string) float64 {
+		return number(colName)
+	}
+
+	// Helper function to safely parse int; counts printed with decimals are accepted
+	parseInt := func(colName string) int64 {
+		return int64(number(colName))
+	}
+
+	// Helper function to safely get string
+	getString := func(colName string) string {
+		if idx, exists := columnMap[colName]; exists && idx < len(row) {
+			return strings.TrimSpace(row[idx])
 		}
+		return ""
 	}
 
-	fmt.Printf("Total records processed: %d\n", len(report.Records))
+	// Extract all available fields
+	closePrice := parseFloat("close")
+	prevClosePrice := parseFloat("prev_close")
 
-	return report, nil
+	// Arabic-only reports put the Arabic name in the company column
+	companyName := getString("company")
+	companyNameAr := getString("company_ar")
+	if companyNameAr == "" && containsArabic(companyName) {
+		companyNameAr = companyName
+	}
+
+	record := TradeRecord{
+		CompanyName:       companyName,
+		CompanyNameAr:     companyNameAr,
+		CompanySymbol:     companyCode,
+		Date:              date,
+		OpenPrice:         parseFloat("open"),
+		HighPrice:         parseFloat("high"),
+		LowPrice:          parseFloat("low"),
+		AveragePrice:      parseFloat("avg"),
+		PrevAveragePrice:  parseFloat("prev_avg"),
+		ClosePrice:        closePrice,
+		PrevClosePrice:    prevClosePrice,
+		Change:            closePrice - prevClosePrice, // Calculate change if not available
+		ChangePercent:     parseFloat("change_pct"),
+		NumTrades:         parseInt("num_trades"),
+		Volume:            parseInt("volume"),
+		Value:             parseFloat("value"),
+		TradingStatus:     true, // Actual trading data
+		SharesOutstanding: parseInt("shares_outstanding"),
+		MarketCap:         parseFloat("market_cap"),
+		ListingStatus:     listingStatusFromText(getString("status")),
+	}
+
+	// A row whose price or size can't be read would be a wrong trade, not just a missing field
+	for _, bad := range badCells {
+		for _, key := range []string{"close=", "volume=", "value="} {
+			if strings.HasPrefix(bad, key) {
+				return TradeRecord{}, rowSkip{Reason: "bad number", Detail: strings.Join(badCells, ", ")}, false
+			}
+		}
+	}
+	if len(badCells) > 0 {
+		return record, rowSkip{Reason: "bad number", Detail: strings.Join(badCells, ", ")}, true
+	}
+	return record, rowSkip{}, true
 }
@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"bytes"
+	"embed"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -70,3 +75,604 @@ func TestParseFile(t *testing.T) {
 		t.Log("Date field could not be parsed – acceptable for this test")
 	}
 }
+
+// TestParseFileStreaming ensures the streaming reader yields the same records as GetRows.
+func TestParseFileStreaming(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"ISX Daily Bulletin"})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"Company Name", "Code", "Opening Price", "Closing Price", "Prev Closing", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A4", &[]interface{}{"Banking Sector"})
+	f.SetSheetRow(sheetName, "A5", &[]interface{}{"Bank of Baghdad", "BBOB", "1.10", "1.20", "1.00", "2,000", "2400"})
+	// row 6 left empty on purpose
+	f.SetSheetRow(sheetName, "A7", &[]interface{}{"Asia Cell", "TASC", "8.00", "8.50", "8.40", "100", "850"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 02 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	var log bytes.Buffer
+	streamed, err := ParseFileWithOptions(filePath, Options{Streaming: true, Output: &log})
+	if err != nil {
+		t.Fatalf("streaming parse: %v", err)
+	}
+	if !strings.Contains(log.String(), "Total records processed: 2\n") {
+		t.Errorf("expected the parsing log in Options.Output, got %q", log.String())
+	}
+	loaded, err := ParseFileWithOptions(filePath, Options{Streaming: false})
+	if err != nil {
+		t.Fatalf("GetRows parse: %v", err)
+	}
+	if len(streamed.Records) != 2 || len(loaded.Records) != 2 {
+		t.Fatalf("expected 2 records from both modes, got %d and %d", len(streamed.Records), len(loaded.Records))
+	}
+	for i := range streamed.Records {
+		if streamed.Records[i] != loaded.Records[i] {
+			t.Errorf("record %d differs: streaming %+v, GetRows %+v", i, streamed.Records[i], loaded.Records[i])
+		}
+	}
+	if r := streamed.Records[1]; r.CompanySymbol != "TASC" || r.ClosePrice != 8.5 || r.Volume != 100 {
+		t.Errorf("unexpected second record: %+v", r)
+	}
+	if v := streamed.Validation; v.RowsParsed != 2 || v.RowsSkipped != 2 || v.UnexpectedSkips() != 0 {
+		t.Errorf("unexpected validation: %+v", v)
+	}
+	for _, r := range streamed.Records {
+		if r.Sector != "Banking" {
+			t.Errorf("%s: expected sector Banking from the heading row, got %q", r.CompanySymbol, r.Sector)
+		}
+	}
+}
+
+// TestParseFileMergedHeader covers legacy reports whose header is split over two rows.
+func TestParseFileMergedHeader(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Sheet1"
+
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Company Name", "Symbol", "Price", "", "Traded", ""})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"", "", "Opening", "Closing", "Volume", "Value"})
+	f.SetSheetRow(sheetName, "A4", &[]interface{}{"Baghdad Soft Drinks", "IBSD", "3.10", "3.25", "50,000", "162500"})
+
+	filePath := filepath.Join(t.TempDir(), "2012 03 04 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if rep.Layout != LayoutMergedHeader {
+		t.Errorf("layout: want %s, got %s", LayoutMergedHeader, rep.Layout)
+	}
+	if len(rep.Records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(rep.Records))
+	}
+	if r := rep.Records[0]; r.CompanySymbol != "IBSD" || r.OpenPrice != 3.1 || r.ClosePrice != 3.25 || r.Volume != 50000 || r.Value != 162500 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
+
+// TestParseFileForeignTrading ensures the non-Iraqi buy/sell sheet is attached to the records.
+func TestParseFileForeignTrading(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Opening Price", "Closing Price", "Prev Closing", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.10", "1.20", "1.00", "2,000", "2400"})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"Asia Cell", "TASC", "8.00", "8.50", "8.40", "100", "850"})
+
+	foreignSheet := "Non Iraqi"
+	f.NewSheet(foreignSheet)
+	f.SetSheetRow(foreignSheet, "A1", &[]interface{}{"Company Name", "Code", "Buy", "", "Sell", ""})
+	f.SetSheetRow(foreignSheet, "A2", &[]interface{}{"", "", "Volume", "Value", "Volume", "Value"})
+	f.SetSheetRow(foreignSheet, "A3", &[]interface{}{"Asia Cell", "TASC", "40", "340", "10", "85"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 03 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(rep.Foreign) != 1 {
+		t.Fatalf("expected 1 foreign trade, got %d", len(rep.Foreign))
+	}
+	for _, r := range rep.Records {
+		switch r.CompanySymbol {
+		case "TASC":
+			if r.ForeignBuyVolume != 40 || r.ForeignBuyValue != 340 || r.ForeignSellVolume != 10 || r.ForeignSellValue != 85 {
+				t.Errorf("unexpected foreign activity for TASC: %+v", r)
+			}
+		case "BBOB":
+			if r.ForeignBuyVolume != 0 || r.ForeignSellVolume != 0 {
+				t.Errorf("BBOB should have no foreign activity: %+v", r)
+			}
+		}
+	}
+}
+
+// TestParseFileBonds ensures bond sheets are parsed into their own records.
+func TestParseFileBonds(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Opening Price", "Closing Price", "Prev Closing", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.10", "1.20", "1.00", "2,000", "2400"})
+
+	bondSheet := "Bonds"
+	f.NewSheet(bondSheet)
+	f.SetSheetRow(bondSheet, "A1", &[]interface{}{"Treasury Bonds"})
+	f.SetSheetRow(bondSheet, "A2", &[]interface{}{"Bond Name", "Coupon Rate", "Maturity Date", "Closing Price", "Yield", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(bondSheet, "A3", &[]interface{}{"Govt Bond 2027", "7%", "2027-06-30", "98.50", "7.4", "1,000", "98500"})
+	f.SetSheetRow(bondSheet, "A4", &[]interface{}{"Total", "", "", "", "", "1,000", "98500"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 04 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(rep.Bonds) != 1 {
+		t.Fatalf("expected 1 bond, got %d: %+v", len(rep.Bonds), rep.Bonds)
+	}
+	b := rep.Bonds[0]
+	if b.Name != "Govt Bond 2027" || b.Coupon != 7 || b.Maturity != "2027-06-30" || b.Price != 98.5 || b.Yield != 7.4 || b.Volume != 1000 {
+		t.Errorf("unexpected bond: %+v", b)
+	}
+}
+
+// TestRegistryLayoutsFor ensures layouts are selected by report date and bad registries are rejected.
+func TestRegistryLayoutsFor(t *testing.T) {
+	reg, err := ParseRegistry([]byte(`{
+		"version": 1,
+		"layouts": [
+			{"name": "old", "to": "2014-12-31", "columns": [{"key": "code", "index": 1}]},
+			{"name": "new", "from": "2015-01-01", "columns": [{"key": "code", "headers": [{"equals": "code"}]}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseRegistry: %v", err)
+	}
+
+	names := func(date time.Time) []string {
+		var out []string
+		for _, l := range reg.LayoutsFor(date) {
+			out = append(out, l.Name)
+		}
+		return out
+	}
+	if got := names(time.Date(2012, 5, 1, 0, 0, 0, 0, time.UTC)); len(got) != 1 || got[0] != "old" {
+		t.Errorf("2012 layouts = %v, want [old]", got)
+	}
+	if got := names(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)); len(got) != 1 || got[0] != "new" {
+		t.Errorf("2020 layouts = %v, want [new]", got)
+	}
+	if got := names(time.Time{}); len(got) != 2 {
+		t.Errorf("unknown date should match every layout, got %v", got)
+	}
+
+	if _, err := ParseRegistry([]byte(`{"version": 99, "layouts": []}`)); err == nil {
+		t.Error("expected an error for an unsupported registry version")
+	}
+	if _, err := ParseRegistry([]byte(`{"version": 1, "indices": [{"name": "x", "pattern": "ISX (\\d+)", "values": []}]}`)); err == nil {
+		t.Error("expected an error for a pattern whose groups don't match its values")
+	}
+}
+
+// TestSectorIndexPatterns matches the sector index lines of an Indices sheet and maps their names
+func TestSectorIndexPatterns(t *testing.T) {
+	date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		sector string
+		value  string
+	}{
+		"Banking Sector Index 45.23 0.5%": {"Banking", "45.23"},
+		"Banks 1,204.5":                   {"Banking", "1,204.5"},
+		"Hotels & Tourism Index 310.2":    {"Hotels & Tourism", "310.2"},
+		"Telecom 88":                      {"Telecommunication", "88"},
+	}
+	for line, want := range cases {
+		var m map[string]string
+		for _, p := range DefaultRegistry.SectorIndexPatternsFor(date) {
+			if m = p.Match(line); m != nil {
+				break
+			}
+		}
+		if m == nil {
+			t.Errorf("%q: no sector pattern matched", line)
+			continue
+		}
+		sector, ok := SectorIndexName(m["sector"])
+		if !ok || sector != want.sector || m["value"] != want.value {
+			t.Errorf("%q: got %q (%v) = %q, want %q = %q", line, sector, ok, m["value"], want.sector, want.value)
+		}
+	}
+	if _, ok := SectorIndexName("Bank of Baghdad"); ok {
+		t.Error("a company name was taken for a sector")
+	}
+	if _, err := ParseRegistry([]byte(`{"version": 1, "sector_indices": [{"name": "x", "pattern": "(\\w+) ([0-9.]+)", "values": ["sector", "level"]}]}`)); err == nil {
+		t.Error("expected an error for a sector pattern without a value")
+	}
+}
+
+// TestIndexRangePatterns checks the open, high and low index lines and that the index line itself
+// isn't taken for one
+func TestIndexRangePatterns(t *testing.T) {
+	date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string][4]string{
+		"ISX Index 60 Open 580.10 High 585.20 Low 578.00 Close 582.00": {"60", "580.10", "585.20", "578.00"},
+		"ISX 15 high 1,204.5 low 1,190":                                {"15", "", "1,204.5", "1,190"},
+		"ISX Index 60 582.00 ISX Index 15 612.40":                      {},
+	}
+	for line, want := range cases {
+		var got [4]string
+		for _, p := range DefaultRegistry.IndexRangePatternsFor(date) {
+			if m := p.Match(line); m != nil {
+				got = [4]string{m["index"], m["open"], m["high"], m["low"]}
+				break
+			}
+		}
+		if got != want {
+			t.Errorf("%q: got %q, want %q", line, got, want)
+		}
+	}
+	if _, err := ParseRegistry([]byte(`{"version": 1, "index_ranges": [{"name": "x", "pattern": "ISX (60) ([0-9.]+)", "values": ["index", "high"]}]}`)); err == nil {
+		t.Error("expected an error for a range pattern without a low")
+	}
+}
+
+// TestParseFileArabicNames ensures the Arabic company name column is kept alongside the English one.
+func TestParseFileArabicNames(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "اسم الشركة", "Code", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "مصرف بغداد", "BBOB", "1.20", "2,000", "2400"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 05 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(rep.Records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(rep.Records))
+	}
+	if r := rep.Records[0]; r.CompanyName != "Bank of Baghdad" || r.CompanyNameAr != "مصرف بغداد" {
+		t.Errorf("unexpected names: %q / %q", r.CompanyName, r.CompanyNameAr)
+	}
+}
+
+// TestParseFileMarketCap ensures listed shares from the company pages give each record a market cap.
+func TestParseFileMarketCap(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.20", "2,000", "2400"})
+
+	companies := "Companies"
+	f.NewSheet(companies)
+	f.SetSheetRow(companies, "A1", &[]interface{}{"Company Name", "Code", "Listed Shares"})
+	f.SetSheetRow(companies, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "250,000,000,000"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 06 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(rep.Records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(rep.Records))
+	}
+	if r := rep.Records[0]; r.SharesOutstanding != 250000000000 || r.MarketCap != 300000000000 {
+		t.Errorf("unexpected shares/market cap: %d / %.0f", r.SharesOutstanding, r.MarketCap)
+	}
+}
+
+// TestDetectCorporateAction covers the note wordings the report uses for corporate actions.
+func TestDetectCorporateAction(t *testing.T) {
+	tests := []struct {
+		row   []string
+		want  CorporateAction
+		found bool
+	}{
+		{[]string{"Bank of Baghdad (BBOB) will distribute a cash dividend of 15% for 2024"}, CorporateAction{CompanySymbol: "BBOB", Type: ActionDividend, Value: 0.15}, true},
+		{[]string{"TASC", "Stock split 2 for 1 effective next session"}, CorporateAction{CompanySymbol: "TASC", Type: ActionSplit, Ratio: 2}, true},
+		{[]string{"Baghdad Soft Drinks (IBSD) capital increase of 25% through bonus shares"}, CorporateAction{CompanySymbol: "IBSD", Type: ActionCapitalIncrease, Ratio: 1.25}, true},
+		{[]string{"Dividends will be announced in IQD later"}, CorporateAction{}, false},
+		{[]string{"Bank of Baghdad", "BBOB", "1.20", "2,000"}, CorporateAction{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := detectCorporateAction(tt.row)
+		if ok != tt.found {
+			t.Errorf("%v: found = %v, want %v", tt.row, ok, tt.found)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.CompanySymbol != tt.want.CompanySymbol || got.Type != tt.want.Type || got.Value != tt.want.Value || got.Ratio != tt.want.Ratio {
+			t.Errorf("%v: got %+v, want %+v", tt.row, got, tt.want)
+		}
+	}
+}
+
+// TestParseFileSkippedRows ensures unreadable rows are logged with their location instead of
+// being read as zero.
+func TestParseFileSkippedRows(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Opening Price", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.10", "1.20", "2,000", "2400"})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"Asia Cell", "TASC", "8.00", "#REF!", "100", "850"})
+	f.SetSheetRow(sheetName, "A4", &[]interface{}{"Baghdad Soft Drinks", "IBSD", "n/a", "3.25", "1,000.00", "3250"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 07 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(rep.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(rep.Records))
+	}
+	if r := rep.Records[1]; r.CompanySymbol != "IBSD" || r.Volume != 1000 || r.OpenPrice != 0 {
+		t.Errorf("unexpected IBSD record: %+v", r)
+	}
+
+	v := rep.Validation
+	if len(v.SkippedRows) != 1 {
+		t.Fatalf("expected 1 skipped row, got %+v", v.SkippedRows)
+	}
+	if s := v.SkippedRows[0]; s.Row != 3 || s.Sheet != sheetName || s.Reason != "bad number" || s.Cells[1] != "TASC" {
+		t.Errorf("unexpected skipped row: %+v", s)
+	}
+	if len(v.Suspicious) != 1 {
+		t.Errorf("expected the unreadable IBSD open price to be flagged, got %v", v.Suspicious)
+	}
+}
+
+// TestParseReaderAndFS ensures reports can be parsed from memory and from a file system.
+func TestParseReaderAndFS(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.20", "2,000", "2400"})
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("failed to write workbook: %v", err)
+	}
+	data := buf.Bytes()
+
+	rep, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if len(rep.Records) != 1 || !rep.Records[0].Date.IsZero() {
+		t.Errorf("unexpected records from Parse: %+v", rep.Records)
+	}
+
+	fsys := fstest.MapFS{"reports/2025 01 08 ISX Daily Report.xlsx": {Data: data}}
+	rep, err = ParseFS(fsys, "reports/2025 01 08 ISX Daily Report.xlsx")
+	if err != nil {
+		t.Fatalf("ParseFS returned error: %v", err)
+	}
+	want := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	if len(rep.Records) != 1 || !rep.Records[0].Date.Equal(want) {
+		t.Errorf("unexpected records from ParseFS: %+v", rep.Records)
+	}
+	if rep.Validation.File != "2025 01 08 ISX Daily Report.xlsx" {
+		t.Errorf("validation file = %q", rep.Validation.File)
+	}
+}
+
+// TestParseFileMarketSummary ensures stated session totals win and missing ones are derived.
+func TestParseFileMarketSummary(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Closing Price", "No. of Trades", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.20", "12", "2,000", "2400"})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"Asia Cell", "TASC", "8.50", "0", "0", "0"})
+	f.SetSheetRow(sheetName, "A5", &[]interface{}{"Listed Companies", "", "104"})
+	f.SetSheetRow(sheetName, "A6", &[]interface{}{"Traded Value", "", "1,250,000"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 09 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	s := rep.Summary
+	if s.ListedCompanies != 104 || s.Value != 1250000 {
+		t.Errorf("stated totals not used: %+v", s)
+	}
+	if s.Volume != 2000 || s.Trades != 12 || s.TradedCompanies != 1 {
+		t.Errorf("missing totals not derived from records: %+v", s)
+	}
+}
+
+// TestParseFileConstituents ensures constituent lists are read per index and index values ignored.
+func TestParseFileConstituents(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.20", "2,000", "2400"})
+
+	indices := "Indices"
+	f.NewSheet(indices)
+	f.SetSheetRow(indices, "A1", &[]interface{}{"ISX Index 60", "612.30"})
+	f.SetSheetRow(indices, "A3", &[]interface{}{"ISX60 Index Constituents"})
+	f.SetSheetRow(indices, "A4", &[]interface{}{"Company Name", "Code", "Weight %"})
+	f.SetSheetRow(indices, "A5", &[]interface{}{"Bank of Baghdad", "BBOB", "4.5"})
+	f.SetSheetRow(indices, "A6", &[]interface{}{"Asia Cell", "TASC", "12.25"})
+	f.SetSheetRow(indices, "A8", &[]interface{}{"ISX15 Index Constituents"})
+	f.SetSheetRow(indices, "A9", &[]interface{}{"Company Name", "Code"})
+	f.SetSheetRow(indices, "A10", &[]interface{}{"Asia Cell", "TASC"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 10 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	got := rep.Constituents
+	if len(got) != 3 {
+		t.Fatalf("expected 3 constituents, got %+v", got)
+	}
+	if got[1].Index != "ISX60" || got[1].CompanySymbol != "TASC" || got[1].Weight != 12.25 {
+		t.Errorf("unexpected ISX60 constituent: %+v", got[1])
+	}
+	if got[2].Index != "ISX15" || got[2].CompanySymbol != "TASC" {
+		t.Errorf("unexpected ISX15 constituent: %+v", got[2])
+	}
+}
+
+// TestCache ensures cached reports are only returned for the same content hash.
+func TestCache(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	name := "downloads/2025 01 11 ISX Daily Report.xlsx"
+	report := &DailyReport{Records: []TradeRecord{{CompanySymbol: "BBOB", ClosePrice: 1.2}}, Layout: LayoutModern}
+
+	if _, ok := cache.Get(name, "abc"); ok {
+		t.Fatal("empty cache returned a report")
+	}
+	if err := cache.Put(name, "abc", report); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, ok := cache.Get(name, "abc")
+	if !ok || len(got.Records) != 1 || got.Records[0].CompanySymbol != "BBOB" || got.Layout != LayoutModern {
+		t.Errorf("unexpected cached report: %+v", got)
+	}
+	if _, ok := cache.Get(name, "def"); ok {
+		t.Error("changed content hash must miss the cache")
+	}
+}
+
+// TestParseFileListingStatus ensures suspension notes set the listing status of the company.
+func TestParseFileListingStatus(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.20", "0", "0"})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"Asia Cell", "TASC", "8.50", "100", "850"})
+	f.SetSheetRow(sheetName, "A5", &[]interface{}{"Trading in Bank of Baghdad (BBOB) suspended until the AGM is held"})
+	f.SetSheetRow(sheetName, "A6", &[]interface{}{"Al-Mansour Hotel (HMAN) delisted by ISC decision"})
+
+	filePath := filepath.Join(t.TempDir(), "2025 01 12 ISX Daily Report.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	status := make(map[string]string)
+	for _, r := range rep.Records {
+		status[r.CompanySymbol] = r.ListingStatus
+	}
+	if status["BBOB"] != ListingSuspended || status["TASC"] != ListingActive {
+		t.Errorf("unexpected statuses: %v", status)
+	}
+	if len(rep.Listing) != 2 || rep.Listing[1].CompanySymbol != "HMAN" || rep.Listing[1].Status != ListingDelisted {
+		t.Errorf("unexpected listing changes: %+v", rep.Listing)
+	}
+}
+
+// TestParseFileDate ensures a report named by a custom template is dated by Options.Date, and one
+// dated neither way is refused rather than matched against every layout.
+func TestParseFileDate(t *testing.T) {
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"Company Name", "Code", "Closing Price", "Traded Volume", "Traded Value"})
+	f.SetSheetRow(sheetName, "A2", &[]interface{}{"Bank of Baghdad", "BBOB", "1.20", "2,000", "2400"})
+	filePath := filepath.Join(t.TempDir(), "2025-01-13_isx.xlsx")
+	if err := f.SaveAs(filePath); err != nil {
+		t.Fatalf("failed to save temp workbook: %v", err)
+	}
+
+	// Without a date the records are left undated, as Parse leaves those of a report in memory
+	rep, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %v", err)
+	}
+	if len(rep.Records) != 1 || !rep.Records[0].Date.IsZero() {
+		t.Errorf("unexpected records without a date: %+v", rep.Records)
+	}
+	if _, err := DetectLayout(f, filePath, DefaultOptions); err != nil {
+		t.Errorf("DetectLayout returned error for a report without a date: %v", err)
+	}
+
+	date := time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)
+	opts := DefaultOptions
+	opts.Date = date
+	rep, err = ParseFileWithOptions(filePath, opts)
+	if err != nil {
+		t.Fatalf("ParseFileWithOptions returned error: %v", err)
+	}
+	if len(rep.Records) != 1 || !rep.Records[0].Date.Equal(date) {
+		t.Errorf("unexpected records: %+v", rep.Records)
+	}
+}
+
+//go:embed testdata/fixture.xlsx
+var fixtures embed.FS
+
+// TestParseFSEmbedded parses an embedded fixture not named by the default scheme, undated and
+// with the date given in the options.
+func TestParseFSEmbedded(t *testing.T) {
+	rep, err := ParseFS(fixtures, "testdata/fixture.xlsx")
+	if err != nil {
+		t.Fatalf("ParseFS returned error: %v", err)
+	}
+	if len(rep.Records) != 2 || !rep.Records[0].Date.IsZero() {
+		t.Fatalf("unexpected records: %+v", rep.Records)
+	}
+	if r := rep.Records[1]; r.CompanySymbol != "TASC" || r.ClosePrice != 8.5 || r.Volume != 100 {
+		t.Errorf("unexpected second record: %+v", r)
+	}
+
+	date := time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)
+	opts := DefaultOptions
+	opts.Date = date
+	rep, err = ParseFSWithOptions(fixtures, "testdata/fixture.xlsx", opts)
+	if err != nil {
+		t.Fatalf("ParseFSWithOptions returned error: %v", err)
+	}
+	for _, r := range rep.Records {
+		if !r.Date.Equal(date) {
+			t.Errorf("%s: want date %s, got %s", r.CompanySymbol, date, r.Date)
+		}
+	}
+}
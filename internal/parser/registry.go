@@ -0,0 +1,384 @@
+package parser
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RegistryVersion is the layout registry format understood by this parser
+const RegistryVersion = 1
+
+//go:embed layouts.json
+var defaultRegistryJSON []byte
+
+// DefaultRegistry holds the layouts bundled with the parser. New ISX format changes are handled by
+// adding an entry to layouts.json, or to a registry file passed with Options.Registry.
+var DefaultRegistry = MustParseRegistry(defaultRegistryJSON)
+
+// HeaderRule matches a lowercased header cell. Equals requires the exact text; otherwise the cell
+// must contain every All substring and none of the None substrings.
+type HeaderRule struct {
+	Equals string   `json:"equals,omitempty"`
+	All    []string `json:"all,omitempty"`
+	None   []string `json:"none,omitempty"`
+}
+
+func (r HeaderRule) matches(header string) bool {
+	if r.Equals != "" {
+		return header == r.Equals
+	}
+	if len(r.All) == 0 {
+		return false
+	}
+	for _, s := range r.All {
+		if !strings.Contains(header, s) {
+			return false
+		}
+	}
+	for _, s := range r.None {
+		if strings.Contains(header, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// ColumnSpec locates one field of a trade record, either by fixed position or by header rules.
+// Optional columns are only present in some reports and aren't reported missing.
+type ColumnSpec struct {
+	Key      string       `json:"key"`
+	Index    *int         `json:"index,omitempty"`
+	Headers  []HeaderRule `json:"headers,omitempty"`
+	Optional bool         `json:"optional,omitempty"`
+}
+
+// SheetLayout describes the trading sheet of reports published between From and To (YYYY-MM-DD,
+// either may be empty for an open range)
+type SheetLayout struct {
+	Name         string       `json:"name"`
+	From         string       `json:"from,omitempty"`
+	To           string       `json:"to,omitempty"`
+	Sheets       []string     `json:"sheets,omitempty"`
+	HeaderRow    *int         `json:"header_row,omitempty"`    // zero-based header row, detected when absent
+	MergedHeader bool         `json:"merged_header,omitempty"` // header may be split over two rows
+	Required     []string     `json:"required,omitempty"`
+	Columns      []ColumnSpec `json:"columns"`
+}
+
+// IndexPattern extracts market index values from a line of text. Each regex group is stored under
+// the matching name in Values.
+type IndexPattern struct {
+	Name    string   `json:"name"`
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to,omitempty"`
+	Sheets  []string `json:"sheets,omitempty"`
+	Pattern string   `json:"pattern"`
+	Values  []string `json:"values"`
+
+	re *regexp.Regexp
+}
+
+// Registry is a versioned set of report layouts
+type Registry struct {
+	Version int           `json:"version"`
+	Layouts []SheetLayout `json:"layouts"`
+	// Indices match the ISX60/ISX15 index line, giving the "isx60" and "isx15" values and,
+	// when the report states it, the percent change of ISX60 as "isx60_change"
+	Indices []IndexPattern `json:"indices"`
+	// SectorIndices match the lines of the per-sector indices, each naming its sector in the
+	// "sector" value and its level in the "value" one
+	SectorIndices []IndexPattern `json:"sector_indices,omitempty"`
+	// IndexRanges match the lines giving the session open, high and low of ISX60 or ISX15, naming
+	// the index in the "index" value ("60" or "15") and its range in the "open", "high" and "low"
+	// ones; open is optional
+	IndexRanges []IndexPattern `json:"index_ranges,omitempty"`
+}
+
+// ParseRegistry parses and validates a JSON layout registry
+func ParseRegistry(data []byte) (*Registry, error) {
+	var reg Registry
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return nil, fmt.Errorf("invalid layout registry: %w", err)
+	}
+	if reg.Version != RegistryVersion {
+		return nil, fmt.Errorf("unsupported layout registry version %d (want %d)", reg.Version, RegistryVersion)
+	}
+
+	for _, l := range reg.Layouts {
+		if l.Name == "" || len(l.Columns) == 0 {
+			return nil, fmt.Errorf("layout %q needs a name and columns", l.Name)
+		}
+		if err := checkRange(l.From, l.To); err != nil {
+			return nil, fmt.Errorf("layout %s: %w", l.Name, err)
+		}
+		for _, c := range l.Columns {
+			if c.Index == nil && len(c.Headers) == 0 {
+				return nil, fmt.Errorf("layout %s: column %q has neither index nor headers", l.Name, c.Key)
+			}
+		}
+	}
+	for i := range reg.Indices {
+		if err := reg.Indices[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range reg.SectorIndices {
+		p := &reg.SectorIndices[i]
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(p.Values, "sector") || !slices.Contains(p.Values, "value") {
+			return nil, fmt.Errorf("sector index pattern %s needs sector and value values", p.Name)
+		}
+	}
+	for i := range reg.IndexRanges {
+		p := &reg.IndexRanges[i]
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+		for _, v := range []string{"index", "high", "low"} {
+			if !slices.Contains(p.Values, v) {
+				return nil, fmt.Errorf("index range pattern %s needs index, high and low values", p.Name)
+			}
+		}
+	}
+	return &reg, nil
+}
+
+// compile checks the pattern's date range and compiles its regex
+func (p *IndexPattern) compile() error {
+	if err := checkRange(p.From, p.To); err != nil {
+		return fmt.Errorf("index pattern %s: %w", p.Name, err)
+	}
+	re, err := regexp.Compile(p.Pattern)
+	if err != nil {
+		return fmt.Errorf("index pattern %s: %w", p.Name, err)
+	}
+	if re.NumSubexp() != len(p.Values) {
+		return fmt.Errorf("index pattern %s has %d groups but %d values", p.Name, re.NumSubexp(), len(p.Values))
+	}
+	p.re = re
+	return nil
+}
+
+// MustParseRegistry is like ParseRegistry but panics on error
+func MustParseRegistry(data []byte) *Registry {
+	reg, err := ParseRegistry(data)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
+
+// LoadRegistry reads a layout registry file
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRegistry(data)
+}
+
+func checkRange(from, to string) error {
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("invalid date %q, want YYYY-MM-DD", d)
+		}
+	}
+	return nil
+}
+
+// inRange reports whether date falls between from and to. An unknown (zero) date matches every range.
+func inRange(date time.Time, from, to string) bool {
+	if date.IsZero() {
+		return true
+	}
+	day := date.Format("2006-01-02")
+	return (from == "" || day >= from) && (to == "" || day <= to)
+}
+
+// LayoutsFor returns the layouts that apply to a report date, in registry order
+func (r *Registry) LayoutsFor(date time.Time) []SheetLayout {
+	var layouts []SheetLayout
+	for _, l := range r.Layouts {
+		if inRange(date, l.From, l.To) {
+			layouts = append(layouts, l)
+		}
+	}
+	return layouts
+}
+
+// Layout returns the layout with the given name, whatever dates it applies to
+func (r *Registry) Layout(name string) (SheetLayout, bool) {
+	for _, l := range r.Layouts {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return SheetLayout{}, false
+}
+
+// IndexPatternsFor returns the index patterns that apply to a report date, in registry order
+func (r *Registry) IndexPatternsFor(date time.Time) []IndexPattern {
+	var patterns []IndexPattern
+	for _, p := range r.Indices {
+		if inRange(date, p.From, p.To) {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// SectorIndexPatternsFor returns the sector index patterns that apply to a report date, in
+// registry order
+func (r *Registry) SectorIndexPatternsFor(date time.Time) []IndexPattern {
+	var patterns []IndexPattern
+	for _, p := range r.SectorIndices {
+		if inRange(date, p.From, p.To) {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// IndexRangePatternsFor returns the index range patterns that apply to a report date, in
+// registry order
+func (r *Registry) IndexRangePatternsFor(date time.Time) []IndexPattern {
+	var patterns []IndexPattern
+	for _, p := range r.IndexRanges {
+		if inRange(date, p.From, p.To) {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// SectorIndexNames are the sectors of the sector indices, in the order indexcsv writes them
+var SectorIndexNames = []string{
+	"Banking", "Insurance", "Investment", "Services", "Industry",
+	"Hotels & Tourism", "Agriculture", "Telecommunication", "Money Transfer",
+}
+
+// sectorIndexAliases maps the lowercased ways reports name a sector to its SectorIndexNames entry
+var sectorIndexAliases = map[string]string{
+	"bank": "Banking", "banks": "Banking", "banking": "Banking",
+	"insurance":  "Insurance",
+	"investment": "Investment",
+	"services":   "Services", "service": "Services",
+	"industry": "Industry", "industrial": "Industry", "industries": "Industry",
+	"hotels & tourism": "Hotels & Tourism", "hotels and tourism": "Hotels & Tourism",
+	"hotel": "Hotels & Tourism", "hotels": "Hotels & Tourism", "tourism": "Hotels & Tourism",
+	"agriculture": "Agriculture", "agricultural": "Agriculture",
+	"telecommunication": "Telecommunication", "telecommunications": "Telecommunication", "telecom": "Telecommunication",
+	"money transfer": "Money Transfer",
+}
+
+// SectorIndexName returns the SectorIndexNames entry of a sector as a sector index line names
+// it, e.g. "Banks" or "Industrial Sector"
+func SectorIndexName(name string) (string, bool) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	name = strings.TrimSuffix(strings.TrimSuffix(name, " index"), " sector")
+	sector, ok := sectorIndexAliases[name]
+	return sector, ok
+}
+
+// Match returns the values extracted from line, or nil when the pattern doesn't match
+func (p IndexPattern) Match(line string) map[string]string {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	values := make(map[string]string, len(p.Values))
+	for i, name := range p.Values {
+		values[name] = m[i+1]
+	}
+	return values
+}
+
+// fixed reports whether every column of the layout is located by position
+func (l SheetLayout) fixed() bool {
+	for _, c := range l.Columns {
+		if c.Index == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// columnIndexes returns the positions of a fixed layout
+func (l SheetLayout) columnIndexes() map[string]int {
+	columnMap := make(map[string]int)
+	for _, c := range l.Columns {
+		if c.Index != nil {
+			columnMap[c.Key] = *c.Index
+		}
+	}
+	return columnMap
+}
+
+// mapHeader maps header cells to column keys. Each cell goes to the first column whose rules match.
+func (l SheetLayout) mapHeader(row []string) map[string]int {
+	columnMap := make(map[string]int)
+	for j, header := range row {
+		headerLower := strings.ToLower(strings.TrimSpace(header))
+		if headerLower == "" {
+			continue
+		}
+	columns:
+		for _, c := range l.Columns {
+			for _, rule := range c.Headers {
+				if rule.matches(headerLower) {
+					columnMap[c.Key] = j
+					break columns
+				}
+			}
+		}
+	}
+	return columnMap
+}
+
+// missingColumn returns the first required column absent from columnMap
+func (l SheetLayout) missingColumn(columnMap map[string]int) (string, bool) {
+	for _, col := range l.Required {
+		if _, ok := columnMap[col]; !ok {
+			return col, true
+		}
+	}
+	return "", false
+}
+
+// isHeader reports whether row holds every required column of the layout
+func (l SheetLayout) isHeader(row []string) bool {
+	columnMap := l.mapHeader(row)
+	_, missing := l.missingColumn(columnMap)
+	return len(columnMap) > 0 && !missing
+}
+
+// looksLikeRow reports whether a row matches a fixed layout: the code column holds a ticker and
+// the close column a number
+func (l SheetLayout) looksLikeRow(row []string) bool {
+	columnMap := l.columnIndexes()
+	for _, idx := range columnMap {
+		if idx >= len(row) {
+			return false
+		}
+	}
+	if code, ok := columnMap["code"]; !ok || !tickerRe.MatchString(strings.TrimSpace(row[code])) {
+		return false
+	}
+	if close, ok := columnMap["close"]; ok {
+		_, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(row[close]), ",", ""), 64)
+		return err == nil
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Options controls how workbooks are read
+type Options struct {
+	// Streaming reads sheets row by row through excelize's streaming reader instead of loading
+	// whole sheets with GetRows, keeping memory flat when parsing years of reports.
+	Streaming bool
+	// Registry holds the report layouts to recognise; nil uses DefaultRegistry
+	Registry *Registry
+	// Layout and Sheet name the registry layout and the trading sheet of the report when they are
+	// already known, e.g. from its format fingerprint, so they don't have to be detected again.
+	// Either is ignored when the registry or the workbook doesn't have it.
+	Layout string
+	Sheet  string
+	// Date is the date of the report, selecting the layouts applying to it and dating its records.
+	// When zero it is read from a file name following the default naming scheme; other reports are
+	// left undated.
+	Date time.Time
+	// Output receives the summary logged for every parsed report; nil means os.Stdout
+	Output io.Writer
+}
+
+func (o Options) registry() *Registry {
+	if o.Registry == nil {
+		return DefaultRegistry
+	}
+	return o.Registry
+}
+
+// logf writes a line of the parsing log to o.Output
+func (o Options) logf(format string, args ...interface{}) {
+	out := o.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, format, args...)
+}
+
+// DefaultOptions are used by ParseFile
+var DefaultOptions = Options{Streaming: true}
+
+// StopRows is returned from an EachRow callback to stop reading without an error
+var StopRows = errors.New("stop reading rows")
+
+// EachRow calls fn for every row of sheet in order, with the zero-based row index. In streaming
+// mode only one row is held in memory at a time. Returning StopRows from fn ends the iteration
+// early without an error.
+func EachRow(f *excelize.File, sheet string, opts Options, fn func(i int, row []string) error) error {
+	if !opts.Streaming {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if err := fn(i, row); err != nil {
+				if errors.Is(err, StopRows) {
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		row, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if err := fn(i, row); err != nil {
+			if errors.Is(err, StopRows) {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.Error()
+}
+
+// hasSheet reports whether the workbook contains a sheet with exactly this name
+func hasSheet(f *excelize.File, name string) bool {
+	idx, err := f.GetSheetIndex(name)
+	return err == nil && idx >= 0
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// MarketSummary holds the session totals of one trading day
+type MarketSummary struct {
+	Date            time.Time
+	Volume          int64
+	Value           float64
+	Trades          int64
+	ListedCompanies int
+	TradedCompanies int
+}
+
+// summaryLabels maps session total labels, lowercased, to MarketSummary fields. More specific
+// labels come first.
+var summaryLabels = []struct {
+	label string
+	field string
+}{
+	{"no. of traded companies", "traded"},
+	{"traded companies", "traded"},
+	{"companies traded", "traded"},
+	{"no. of listed companies", "listed"},
+	{"listed companies", "listed"},
+	{"no. of trades", "trades"},
+	{"number of trades", "trades"},
+	{"executed trades", "trades"},
+	{"traded shares", "volume"},
+	{"traded volume", "volume"},
+	{"total volume", "volume"},
+	{"traded value", "value"},
+	{"total value", "value"},
+}
+
+// parseMarketSummary reads the session totals from label/value cells anywhere in the report,
+// outside the trading table rows. Totals the report doesn't state are derived from the records.
+func parseMarketSummary(f *excelize.File, date time.Time, tradingSheet string, tradingRows map[int]bool, records []TradeRecord, opts Options) MarketSummary {
+	summary := MarketSummary{Date: date}
+	found := make(map[string]bool)
+
+	for _, name := range f.GetSheetList() {
+		EachRow(f, name, opts, func(i int, row []string) error {
+			if name == tradingSheet && tradingRows[i] {
+				return nil
+			}
+			for j, cell := range row {
+				field := summaryField(cell)
+				if field == "" || found[field] {
+					continue
+				}
+				value, ok := nextNumber(row[j+1:])
+				if !ok {
+					continue
+				}
+				found[field] = true
+				switch field {
+				case "traded":
+					summary.TradedCompanies = int(value)
+				case "listed":
+					summary.ListedCompanies = int(value)
+				case "trades":
+					summary.Trades = int64(value)
+				case "volume":
+					summary.Volume = int64(value)
+				case "value":
+					summary.Value = value
+				}
+			}
+			return nil
+		})
+	}
+
+	// Fill in whatever the report didn't state from the trading table
+	var volume, trades int64
+	var value float64
+	traded := 0
+	for _, r := range records {
+		volume += r.Volume
+		value += r.Value
+		trades += r.NumTrades
+		if r.Volume > 0 {
+			traded++
+		}
+	}
+	if !found["volume"] {
+		summary.Volume = volume
+	}
+	if !found["value"] {
+		summary.Value = value
+	}
+	if !found["trades"] {
+		summary.Trades = trades
+	}
+	if !found["traded"] {
+		summary.TradedCompanies = traded
+	}
+	if !found["listed"] {
+		summary.ListedCompanies = len(records)
+	}
+	return summary
+}
+
+// summaryField returns the MarketSummary field a label cell names, or "" when it names none
+func summaryField(cell string) string {
+	text := strings.ToLower(strings.Join(strings.Fields(cell), " "))
+	if text == "" {
+		return ""
+	}
+	for _, l := range summaryLabels {
+		if strings.Contains(text, l.label) {
+			return l.field
+		}
+	}
+	return ""
+}
+
+// nextNumber returns the first numeric cell, skipping blanks between a label and its value
+func nextNumber(cells []string) (float64, bool) {
+	for _, cell := range cells {
+		text := strings.ReplaceAll(strings.TrimSpace(cell), ",", "")
+		if text == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		return value, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Validation summarises how well a report parsed, so rows lost to layout changes don't go unnoticed
+type Validation struct {
+	File         string         `json:"file"`
+	Sheet        string         `json:"sheet"`
+	Layout       string         `json:"layout"`
+	RowsTotal    int            `json:"rows_total"` // rows after the header
+	RowsParsed   int            `json:"rows_parsed"`
+	RowsSkipped  int            `json:"rows_skipped"`
+	SkipReasons  map[string]int `json:"skip_reasons,omitempty"`
+	SkippedRows  []SkippedRow   `json:"skipped_rows,omitempty"` // unexpected skips only
+	HeaderIssues []string       `json:"header_issues,omitempty"`
+	Suspicious   []string       `json:"suspicious,omitempty"`
+}
+
+// SkippedRow is a data row that couldn't be turned into a trade record
+type SkippedRow struct {
+	File   string   `json:"file"`
+	Sheet  string   `json:"sheet"`
+	Row    int      `json:"row"` // 1-based, as shown in Excel
+	Reason string   `json:"reason"`
+	Detail string   `json:"detail,omitempty"`
+	Cells  []string `json:"cells"`
+}
+
+// Skip reasons that are expected in every report and don't indicate lost data
+var expectedSkips = map[string]bool{
+	"empty row":        true,
+	"sector/total row": true,
+}
+
+// skip records a row that didn't produce a trade record
+func (v *Validation) skip(reason string) {
+	if v.SkipReasons == nil {
+		v.SkipReasons = make(map[string]int)
+	}
+	v.RowsSkipped++
+	v.SkipReasons[reason]++
+}
+
+// skipRow records a skipped data row, keeping the row itself when the skip isn't expected
+func (v *Validation) skipRow(i int, row []string, skip rowSkip) {
+	v.skip(skip.Reason)
+	if expectedSkips[skip.Reason] {
+		return
+	}
+	v.SkippedRows = append(v.SkippedRows, SkippedRow{
+		File:   v.File,
+		Sheet:  v.Sheet,
+		Row:    i + 1,
+		Reason: skip.Reason,
+		Detail: skip.Detail,
+		Cells:  append([]string(nil), row...),
+	})
+}
+
+// UnexpectedSkips is the number of skipped rows other than blank, sector and total rows
+func (v *Validation) UnexpectedSkips() int {
+	n := 0
+	for reason, count := range v.SkipReasons {
+		if !expectedSkips[reason] {
+			n += count
+		}
+	}
+	return n
+}
+
+// HasIssues reports whether anything in the report deserves a look
+func (v *Validation) HasIssues() bool {
+	return v.UnexpectedSkips() > 0 || len(v.HeaderIssues) > 0 || len(v.Suspicious) > 0
+}
+
+// checkHeader notes layout columns missing from the header and header cells no column claimed
+func (v *Validation) checkHeader(layout SheetLayout, header []string, columnMap map[string]int) {
+	mapped := make(map[int]bool)
+	for _, idx := range columnMap {
+		mapped[idx] = true
+	}
+	for _, c := range layout.Columns {
+		if _, ok := columnMap[c.Key]; !ok && !c.Optional {
+			v.HeaderIssues = append(v.HeaderIssues, fmt.Sprintf("column %s not found", c.Key))
+		}
+	}
+	for j, cell := range header {
+		if cell = strings.TrimSpace(cell); cell != "" && !mapped[j] {
+			v.HeaderIssues = append(v.HeaderIssues, fmt.Sprintf("unrecognised header %q in column %d", cell, j))
+		}
+	}
+}
+
+// checkRecord notes values that are unlikely to be real
+func (v *Validation) checkRecord(r TradeRecord) {
+	add := func(format string, args ...interface{}) {
+		v.Suspicious = append(v.Suspicious, r.CompanySymbol+": "+fmt.Sprintf(format, args...))
+	}
+	prices := map[string]float64{
+		"open":  r.OpenPrice,
+		"high":  r.HighPrice,
+		"low":   r.LowPrice,
+		"close": r.ClosePrice,
+	}
+	names := make([]string, 0, len(prices))
+	for name := range prices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prices[name] < 0 {
+			add("negative %s price %.3f", name, prices[name])
+		}
+	}
+	if r.ClosePrice == 0 && r.Volume > 0 {
+		add("zero close price with volume %d", r.Volume)
+	}
+	if r.HighPrice > 0 && r.LowPrice > 0 && r.HighPrice < r.LowPrice {
+		add("high %.3f below low %.3f", r.HighPrice, r.LowPrice)
+	}
+	if r.Volume < 0 || r.Value < 0 || r.NumTrades < 0 {
+		add("negative volume, value or trades (%d, %.2f, %d)", r.Volume, r.Value, r.NumTrades)
+	}
+	if r.Volume > 0 && r.Value == 0 {
+		add("volume %d traded with zero value", r.Volume)
+	}
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+)
+
+// Artifact names a file or directory a stage writes for the stages after it, e.g. the combined CSV
+type Artifact string
+
+// Artifacts of the stages of this package
+const (
+	ArtifactReports     Artifact = "reports"            // directory of the downloaded .xlsx reports
+	ArtifactIndexesCSV  Artifact = "indexes_csv"        // indexes.csv of the index extraction
+	ArtifactCombinedCSV Artifact = "combined_csv"       // isx_combined_data.csv of the processing
+	ArtifactCorrelation Artifact = "correlation_matrix" // correlation_matrix.csv of the analysis
+)
+
+// Producer is implemented by stages writing artifacts. A Manager has one producer per artifact.
+type Producer interface {
+	// Outputs returns the paths of the artifacts the stage writes
+	Outputs() map[Artifact]string
+}
+
+// Consumer is implemented by stages reading artifacts. The Manager runs a Consumer after the
+// stages producing its inputs, like the stages it depends on, and hands it their paths through
+// Input. An input no registered stage produces is left for the stage to find.
+type Consumer interface {
+	Inputs() []Artifact
+}
+
+// artifactsKey is the context key of the paths of the artifacts of a run
+type artifactsKey struct{}
+
+// Input returns the path of artifact a as produced by a stage of the Manager running the stage
+// with ctx, false when none produces it
+func Input(ctx context.Context, a Artifact) (string, bool) {
+	path, ok := ctx.Value(artifactsKey{}).(map[Artifact]string)[a]
+	return path, ok
+}
+
+// outputs returns the artifacts s produces
+func outputs(s Stage) map[Artifact]string {
+	if p, ok := s.(Producer); ok {
+		return p.Outputs()
+	}
+	return nil
+}
+
+// inputs returns the artifacts s consumes
+func inputs(s Stage) []Artifact {
+	if c, ok := s.(Consumer); ok {
+		return c.Inputs()
+	}
+	return nil
+}
+
+// producer returns the name of the registered stage producing a, "" when none does
+func (m *Manager) producer(a Artifact) string {
+	for _, s := range m.stages {
+		if _, ok := outputs(s)[a]; ok {
+			return s.Name()
+		}
+	}
+	return ""
+}
+
+// artifacts returns the paths of the artifacts of the registered stages
+func (m *Manager) artifacts() map[Artifact]string {
+	paths := make(map[Artifact]string)
+	for _, s := range m.stages {
+		for a, path := range outputs(s) {
+			paths[a] = path
+		}
+	}
+	return paths
+}
+
+// Outputs returns the stage producing each artifact path of the registered stages, e.g. for a
+// Lineage
+func (m *Manager) Outputs() map[string]string {
+	stages := make(map[string]string)
+	for _, s := range m.stages {
+		for _, path := range outputs(s) {
+			stages[path] = s.Name()
+		}
+	}
+	return stages
+}
+
+// dependencies returns the stages s depends on: those it names and the producers of its inputs
+func (m *Manager) dependencies(s Stage) []string {
+	var deps []string
+	if d, ok := s.(Dependent); ok {
+		deps = slices.Clone(d.DependsOn())
+	}
+	for _, a := range inputs(s) {
+		if p := m.producer(a); p != "" && p != s.Name() && !slices.Contains(deps, p) {
+			deps = append(deps, p)
+		}
+	}
+	return deps
+}
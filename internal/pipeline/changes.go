@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReasonUnchanged is the reason a ChangeDetector skips a stage
+const ReasonUnchanged = "downloads unchanged since the last run"
+
+// ChangeDetector fingerprints the downloaded reports so a Manager skips each stage consuming
+// ArtifactReports while they are unchanged since the last run that completed that stage. The
+// fingerprint is recorded per stage and per the outputs of the stage, so extracting the indices
+// doesn't count as processing, nor processing into another directory as processing into this
+// one. The stages after those, e.g. IfNewDates ones, are skipped in turn.
+type ChangeDetector struct {
+	Dir   string // the downloads directory
+	State string // the file recording the fingerprints of the stages last completed
+
+	mu sync.Mutex // serializes the updates of State by the managers sharing the detector
+}
+
+// changeState is the content of ChangeDetector.State
+type changeState struct {
+	Stages map[string]changeEntry `json:"stages"` // by changeKey
+}
+
+// changeEntry is the fingerprint of the downloads a stage last completed with
+type changeEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Recorded    time.Time `json:"recorded"`
+}
+
+// NewChangeDetector returns the detector of the reports of dir, recording its state at state
+func NewChangeDetector(dir, state string) *ChangeDetector {
+	return &ChangeDetector{Dir: dir, State: state}
+}
+
+// Fingerprint hashes the names, sizes and modification times of the files of Dir, so a new or
+// republished report changes it without the reports being read
+func (d *ChangeDetector) Fingerprint() (string, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var lines []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%s\x00%d\x00%d\n", e.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	slices.Sort(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Changed reports whether the fingerprint of Dir differs from the one recorded for the stage of
+// key; it is changed when none is recorded
+func (d *ChangeDetector) Changed(key string) (bool, error) {
+	fingerprint, err := d.Fingerprint()
+	if err != nil {
+		return true, err
+	}
+	d.mu.Lock()
+	state, err := d.load()
+	d.mu.Unlock()
+	if err != nil {
+		return true, err
+	}
+	entry, ok := state.Stages[key]
+	return !ok || entry.Fingerprint != fingerprint, nil
+}
+
+// Commit records the current fingerprint of Dir for the stages of keys, once a run completed them
+func (d *ChangeDetector) Commit(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	fingerprint, err := d.Fingerprint()
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// An unreadable state is replaced, the stages it recorded running again
+	state, _ := d.load()
+	if state.Stages == nil {
+		state.Stages = make(map[string]changeEntry)
+	}
+	for _, key := range keys {
+		state.Stages[key] = changeEntry{Fingerprint: fingerprint, Recorded: time.Now()}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.State), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(d.State, data, 0644)
+}
+
+// load reads State; a missing one records no stage
+func (d *ChangeDetector) load() (changeState, error) {
+	var state changeState
+	data, err := os.ReadFile(d.State)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return changeState{}, fmt.Errorf("read %s: %w", d.State, err)
+	}
+	return state, nil
+}
+
+// changeKey identifies the fingerprint of the downloads s consumes: its name and the paths of
+// its outputs
+func changeKey(s Stage) string {
+	var paths []string
+	for _, path := range outputs(s) {
+		paths = append(paths, filepath.Clean(path))
+	}
+	slices.Sort(paths)
+	return strings.Join(append([]string{s.Name()}, paths...), " ")
+}
+
+// consumedReports returns the changeKey of every stage consuming ArtifactReports completed in
+// summary
+func (m *Manager) consumedReports(summary Summary) []string {
+	var keys []string
+	for _, st := range summary.Stages {
+		if st.Status != StatusCompleted {
+			continue
+		}
+		for _, s := range m.stages {
+			if s.Name() == st.Name && slices.Contains(inputs(s), ArtifactReports) {
+				keys = append(keys, changeKey(s))
+			}
+		}
+	}
+	return keys
+}
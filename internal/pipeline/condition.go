@@ -0,0 +1,62 @@
+package pipeline
+
+// Outcomes are the stages that completed or were skipped earlier in a run, for Conditional stages
+// to inspect
+type Outcomes struct {
+	completed map[string]Stage
+	skipped   map[string]bool
+}
+
+// Completed returns the stage named name if it completed in the run, e.g. a *ScrapingStage whose
+// Result holds the reports downloaded
+func (o Outcomes) Completed(name string) (Stage, bool) {
+	s, ok := o.completed[name]
+	return s, ok
+}
+
+// Skipped reports whether the stage named name was skipped in the run
+func (o Outcomes) Skipped(name string) bool { return o.skipped[name] }
+
+// Conditional is implemented by stages that only run when a condition on the run so far holds.
+// The Manager evaluates it once the stages the stage depends on finished; a skipped stage counts
+// as finished for the stages depending on it. Finalizers always run.
+type Conditional interface {
+	// ShouldRun reports whether the stage runs, and why not in reason
+	ShouldRun(done Outcomes) (run bool, reason string)
+}
+
+// Condition decides whether a stage runs from the stages completed before it; see Conditional
+type Condition func(done Outcomes) (run bool, reason string)
+
+// eval returns the outcome of c, running when c is nil
+func (c Condition) eval(done Outcomes) (bool, string) {
+	if c == nil {
+		return true, ""
+	}
+	return c(done)
+}
+
+// IfDownloaded runs a stage unless the scrape of the run completed without downloading a new or
+// republished report. A run without a scrape always runs the stage.
+func IfDownloaded(done Outcomes) (bool, string) {
+	s, _ := done.Completed(StageScrape)
+	scrape, ok := s.(*ScrapingStage)
+	if !ok || scrape.Result == nil || scrape.Result.Downloaded > 0 || len(scrape.Result.Changed) > 0 {
+		return true, ""
+	}
+	return false, "no new reports downloaded"
+}
+
+// IfNewDates runs a stage unless the processing of the run was skipped or completed without
+// parsing a report. A run without processing always runs the stage.
+func IfNewDates(done Outcomes) (bool, string) {
+	if done.Skipped(StageProcess) {
+		return false, "processing was skipped"
+	}
+	s, _ := done.Completed(StageProcess)
+	process, ok := s.(*ProcessingStage)
+	if !ok || len(process.Stats.Dates) > 0 {
+		return true, ""
+	}
+	return false, "no new dates processed"
+}
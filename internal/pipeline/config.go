@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StageCommand is the kind of CommandStage in a StageConfig
+const StageCommand = "command"
+
+// Config is a pipelines.yaml: the pipelines the server runs besides its built-in one and the
+// schedules running them
+type Config struct {
+	Pipelines []PipelineConfig `yaml:"pipelines"`
+	// Schedules run a pipeline of Pipelines named by their Pipeline field, or the built-in one
+	Schedules []Schedule `yaml:"schedules"`
+	// Limits cap the resources used at once by all the pipelines of the server, see Limiter
+	Limits map[Resource]int `yaml:"limits"`
+}
+
+// PipelineConfig defines a pipeline: its stages, registered in the order listed, and how they run
+type PipelineConfig struct {
+	Name    string        `yaml:"name" json:"name"`
+	Mode    ExecutionMode `yaml:"mode" json:"mode,omitempty"`       // "" is ExecutionModeSequential
+	Timeout Duration      `yaml:"timeout" json:"timeout,omitempty"` // the deadline of a run; 0 sets none
+	// SkipUnchanged skips the stages consuming the downloaded reports when they are unchanged since
+	// the last run that processed them, see ChangeDetector
+	SkipUnchanged bool          `yaml:"skip_unchanged" json:"skip_unchanged,omitempty"`
+	Stages        []StageConfig `yaml:"stages" json:"stages"`
+}
+
+// StageConfig is one stage of a PipelineConfig
+type StageConfig struct {
+	// Stage is the kind of stage, a key of the factories the pipeline is built with
+	Stage string `yaml:"stage" json:"stage"`
+	// Name is the name of a CommandStage; other stages keep their own
+	Name string `yaml:"name" json:"name,omitempty"`
+	// Params configure the stage like the arguments of a web request, e.g. {"mode": "full"}
+	Params map[string]string `yaml:"params" json:"params,omitempty"`
+	// After are the stages a CommandStage runs after; other stages keep their own dependencies
+	After []string `yaml:"after" json:"after,omitempty"`
+	// Run is the program and arguments of a CommandStage
+	Run []string `yaml:"run" json:"run,omitempty"`
+	// Inputs and Outputs are the artifacts a CommandStage reads and writes, see Consumer and
+	// Producer
+	Inputs  []Artifact          `yaml:"inputs" json:"inputs,omitempty"`
+	Outputs map[Artifact]string `yaml:"outputs" json:"outputs,omitempty"`
+	// Retry replaces the retries of the stage; nil keeps its own
+	Retry *RetrySettings `yaml:"retry" json:"retry,omitempty"`
+	// Timeout stops an attempt of the stage that runs longer; 0 sets none
+	Timeout Duration `yaml:"timeout" json:"timeout,omitempty"`
+	// If names a condition of Conditions skipping the stage when it doesn't hold
+	If string `yaml:"if" json:"if,omitempty"`
+}
+
+// RetrySettings are the RetryConfig of a StageConfig
+type RetrySettings struct {
+	Attempts int             `yaml:"attempts" json:"attempts"`
+	Backoff  BackoffStrategy `yaml:"backoff" json:"backoff,omitempty"`
+	Delay    Duration        `yaml:"delay" json:"delay,omitempty"`
+	MaxDelay Duration        `yaml:"max_delay" json:"max_delay,omitempty"`
+}
+
+// Conditions are the conditions a StageConfig names in If
+var Conditions = map[string]Condition{
+	"downloaded": IfDownloaded,
+	"new_dates":  IfNewDates,
+}
+
+// StageFactory returns the stage of a StageConfig, configured from its Params
+type StageFactory func(c StageConfig) (Stage, error)
+
+// LoadConfig reads a pipelines.yaml; a missing file holds no pipeline. Unknown keys are errors,
+// so a misspelt setting isn't silently ignored.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	for r := range c.Limits {
+		if r != ResourceChrome && r != ResourceExcel && r != ResourceDiskIO {
+			return nil, fmt.Errorf("read %s: unknown resource %q (want %s, %s or %s)", path, r, ResourceChrome, ResourceExcel, ResourceDiskIO)
+		}
+	}
+	names := make(map[string]bool)
+	for _, p := range c.Pipelines {
+		if p.Name == "" || names[p.Name] {
+			return nil, fmt.Errorf("read %s: pipeline %q needs a unique name", path, p.Name)
+		}
+		names[p.Name] = true
+	}
+	for _, s := range c.Schedules {
+		if s.Pipeline != "" && !names[s.Pipeline] {
+			return nil, fmt.Errorf("read %s: schedule %s runs unknown pipeline %q", path, s.Name, s.Pipeline)
+		}
+	}
+	return &c, nil
+}
+
+// Pipeline returns the pipeline named name
+func (c *Config) Pipeline(name string) (PipelineConfig, bool) {
+	for _, p := range c.Pipelines {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return PipelineConfig{}, false
+}
+
+// Build returns the manager of the pipeline, its stages made by the factories of their kinds.
+// StageCommand stages are built by the package unless factories has its own.
+func (p PipelineConfig) Build(factories map[string]StageFactory) (*Manager, error) {
+	if p.Mode != "" && p.Mode != ExecutionModeSequential && p.Mode != ExecutionModeParallel {
+		return nil, fmt.Errorf("pipeline %s: unknown execution mode %q", p.Name, p.Mode)
+	}
+	m := NewManager()
+	m.Mode = p.Mode
+	m.Timeout = time.Duration(p.Timeout)
+	m.StageTimeouts = make(map[string]time.Duration)
+	m.Retries = make(map[string]RetryConfig)
+	m.Conditions = make(map[string]Condition)
+	for i, c := range p.Stages {
+		s, err := buildStage(c, factories)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: stage %d: %w", p.Name, i+1, err)
+		}
+		if c.Stage != StageCommand && (len(c.After) > 0 || len(c.Run) > 0 || len(c.Inputs) > 0 || len(c.Outputs) > 0) {
+			return nil, fmt.Errorf("pipeline %s: stage %d: only command stages take after, run, inputs and outputs", p.Name, i+1)
+		}
+		name := s.Name()
+		if c.Name != "" && c.Name != name {
+			return nil, fmt.Errorf("pipeline %s: stage %d: a %s stage is named %s", p.Name, i+1, c.Stage, name)
+		}
+		if slices.Contains(m.Stages(), name) {
+			return nil, fmt.Errorf("pipeline %s: stage %s listed twice", p.Name, name)
+		}
+		for a := range outputs(s) {
+			if producer := m.producer(a); producer != "" {
+				return nil, fmt.Errorf("pipeline %s: artifact %s produced by both %s and %s", p.Name, a, producer, name)
+			}
+		}
+		m.Register(s)
+		if c.Timeout > 0 {
+			m.StageTimeouts[name] = time.Duration(c.Timeout)
+		}
+		if c.Retry != nil {
+			m.Retries[name] = RetryConfig{
+				MaxAttempts: c.Retry.Attempts,
+				Backoff:     c.Retry.Backoff,
+				Delay:       time.Duration(c.Retry.Delay),
+				MaxDelay:    time.Duration(c.Retry.MaxDelay),
+			}
+		}
+		if c.If != "" {
+			cond, ok := Conditions[c.If]
+			if !ok {
+				return nil, fmt.Errorf("pipeline %s: stage %s: unknown condition %q", p.Name, name, c.If)
+			}
+			m.Conditions[name] = cond
+		}
+	}
+	if _, _, err := m.selectStages(nil); err != nil {
+		return nil, fmt.Errorf("pipeline %s: %w", p.Name, err)
+	}
+	return m, nil
+}
+
+// buildStage returns the stage of c
+func buildStage(c StageConfig, factories map[string]StageFactory) (Stage, error) {
+	if f, ok := factories[c.Stage]; ok {
+		return f(c)
+	}
+	if c.Stage == StageCommand {
+		return NewCommandStage(c)
+	}
+	return nil, fmt.Errorf("unknown stage %q", c.Stage)
+}
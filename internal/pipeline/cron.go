@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed five-field cron expression: minute, hour, day of month, month and day of week.
+// Fields take *, numbers, ranges (1-5), steps (*/15, 8-18/2) and comma-separated lists of them;
+// months and days of the week also take their three-letter English names (JAN, SUN-THU). As in
+// cron, a day matches when either a restricted day of month or a restricted day of week does.
+type Cron struct {
+	expr                         string
+	minute, hour, dom, month, dw uint64 // bit n set when value n matches
+	domAny, dowAny               bool   // the day field is *
+}
+
+// cronFields are the ranges and names of the fields of a cron expression
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string // names of the values from min
+}{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	// 7 is Sunday too
+	{"day of week", 0, 7, []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// ParseCron parses a five-field cron expression, e.g. "0 18 * * SUN-THU" for 6 pm on the ISX
+// trading days
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q has %d fields (want minute hour day-of-month month day-of-week)", expr, len(fields))
+	}
+	c := &Cron{expr: expr}
+	sets := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dw}
+	for i, field := range fields {
+		set, err := parseCronField(field, i)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		*sets[i] = set
+	}
+	if c.dw&(1<<7) != 0 {
+		c.dw |= 1 // Sunday
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField returns the values field i of an expression matches, as a bit set
+func parseCronField(field string, i int) (uint64, error) {
+	f := cronFields[i]
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if r, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, s)
+			}
+			rng, step = r, n
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(from, i); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(to, i); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = f.max // 5/15 runs from 5 to the end of the range, as in cron
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// cronValue parses a number or name of field i
+func cronValue(s string, i int) (int, error) {
+	f := cronFields[i]
+	for j, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + j, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q (want %d-%d)", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression c was parsed from
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first minute after t the expression matches, in the location of t. It returns
+// the zero time when none does within five years, e.g. for February 30.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the date of t matches the day fields
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dw&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
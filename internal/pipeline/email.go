@@ -0,0 +1,231 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"isxcli/internal/analytics"
+)
+
+// StageEmail is the name of EmailStage
+const StageEmail = "email"
+
+// Environment variables of the SMTP server emailing run summaries, see SMTPFromEnv
+const (
+	SMTPHostEnvVar     = "ISX_SMTP_HOST"
+	SMTPPortEnvVar     = "ISX_SMTP_PORT" // 587 when unset
+	SMTPUsernameEnvVar = "ISX_SMTP_USERNAME"
+	SMTPPasswordEnvVar = "ISX_SMTP_PASSWORD"
+	SMTPFromEnvVar     = "ISX_SMTP_FROM" // the username when unset
+	SMTPToEnvVar       = "ISX_SMTP_TO"   // comma-separated recipients
+)
+
+// SMTPConfig is the SMTP server and recipients of EmailStage
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // "" sends without authentication
+	Password string
+	From     string
+	To       []string
+}
+
+// SMTPFromEnv returns the SMTP settings of the SMTP environment variables, false when the host
+// or recipients are unset, an error when the port or sender is invalid
+func SMTPFromEnv() (SMTPConfig, bool, error) {
+	c := SMTPConfig{
+		Host:     strings.TrimSpace(os.Getenv(SMTPHostEnvVar)),
+		Port:     587,
+		Username: os.Getenv(SMTPUsernameEnvVar),
+		Password: os.Getenv(SMTPPasswordEnvVar),
+		From:     strings.TrimSpace(os.Getenv(SMTPFromEnvVar)),
+	}
+	for _, to := range strings.Split(os.Getenv(SMTPToEnvVar), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			c.To = append(c.To, to)
+		}
+	}
+	if c.Host == "" || len(c.To) == 0 {
+		return SMTPConfig{}, false, nil
+	}
+	if port := os.Getenv(SMTPPortEnvVar); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 {
+			return SMTPConfig{}, false, fmt.Errorf("%s: invalid port %q", SMTPPortEnvVar, port)
+		}
+		c.Port = n
+	}
+	if c.From == "" {
+		c.From = c.Username
+	}
+	if c.From == "" {
+		return SMTPConfig{}, false, fmt.Errorf("%s or %s needed to send email", SMTPFromEnvVar, SMTPUsernameEnvVar)
+	}
+	return c, true, nil
+}
+
+// EmailStage emails the Summary of a run once the other stages finished: its status, the trading
+// dates it processed, the top movers of the last session and the errors of its stages
+type EmailStage struct {
+	SMTP SMTPConfig
+	// Dir is the reports directory whose isx_combined_data.csv ranks the movers when the run
+	// produces none
+	Dir    string
+	Movers int         // tickers of each movers list; 0 lists 5
+	Retry  RetryConfig // the zero value never retries
+	// Send sends the message; nil is smtp.SendMail
+	Send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+	summary Summary
+}
+
+// Name returns StageEmail
+func (s *EmailStage) Name() string { return StageEmail }
+
+// RetryConfig returns s.Retry
+func (s *EmailStage) RetryConfig() RetryConfig { return s.Retry }
+
+// Finalize sets the summary emailed by Run
+func (s *EmailStage) Finalize(summary Summary) { s.summary = summary }
+
+// Plan returns the recipients to email
+func (s *EmailStage) Plan(ctx context.Context) (Estimate, error) {
+	return Estimate{Description: fmt.Sprintf("email the summary of the run to %d recipients", len(s.SMTP.To))}, nil
+}
+
+// Run emails the summary to the recipients
+func (s *EmailStage) Run(ctx context.Context, out io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	msg := s.message(ctx, time.Now())
+	send := s.Send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	var auth smtp.Auth
+	if s.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", s.SMTP.Username, s.SMTP.Password, s.SMTP.Host)
+	}
+	addr := net.JoinHostPort(s.SMTP.Host, strconv.Itoa(s.SMTP.Port))
+	if err := send(addr, auth, s.SMTP.From, s.SMTP.To, msg); err != nil {
+		return fmt.Errorf("email %s: %w", addr, err)
+	}
+	fmt.Fprintf(out, "Emailed the %s run to %d recipients\n", s.summary.Status, len(s.SMTP.To))
+	return nil
+}
+
+// message returns the email of the summary, sent at date
+func (s *EmailStage) message(ctx context.Context, date time.Time) []byte {
+	dates := processedDates(s.summary)
+	subject := fmt.Sprintf("ISX pipeline %s", s.summary.Status)
+	if len(dates) > 0 {
+		subject += fmt.Sprintf(": %d new trading dates", len(dates))
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Status: %s\n", s.summary.Status)
+	fmt.Fprintf(&body, "Started: %s\n", s.summary.Started.Format(time.RFC1123))
+	fmt.Fprintf(&body, "Duration: %s\n", time.Duration(s.summary.Duration*float64(time.Second)).Round(time.Second))
+	if len(dates) > 0 {
+		fmt.Fprintf(&body, "\nNew trading dates: %s\n", strings.Join(dates, ", "))
+		if movers, err := s.movers(ctx); err != nil {
+			fmt.Fprintf(&body, "\nTop movers unavailable: %v\n", err)
+		} else {
+			writeMovers(&body, movers)
+		}
+	} else {
+		body.WriteString("\nNo new trading dates.\n")
+	}
+
+	var errs []string
+	for _, st := range s.summary.Stages {
+		if st.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s: %s", st.Name, st.Error))
+		}
+	}
+	// The error of the run repeats those of its stages, unless it stopped before a stage failed
+	if len(errs) == 0 && s.summary.Error != "" {
+		errs = append(errs, s.summary.Error)
+	}
+	if len(errs) > 0 {
+		body.WriteString("\nErrors:\n")
+		for _, e := range errs {
+			fmt.Fprintf(&body, "  %s\n", e)
+		}
+	}
+	body.WriteString("\nStages:\n")
+	for _, st := range s.summary.Stages {
+		fmt.Fprintf(&body, "  %-16s %-10s %6.1fs", st.Name, st.Status, st.Duration)
+		if st.Reason != "" {
+			fmt.Fprintf(&body, "  (%s)", st.Reason)
+		}
+		body.WriteString("\n")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.SMTP.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+	return msg.Bytes()
+}
+
+// movers ranks the top movers of the last session of the combined CSV of the run
+func (s *EmailStage) movers(ctx context.Context) (analytics.MoversReport, error) {
+	series, err := analytics.LoadSeries(inputPath(ctx, ArtifactCombinedCSV, filepath.Join(s.Dir, "isx_combined_data.csv")))
+	if err != nil {
+		return analytics.MoversReport{}, err
+	}
+	count := s.Movers
+	if count <= 0 {
+		count = 5
+	}
+	return analytics.TopMovers(series, count), nil
+}
+
+// writeMovers lists the gainers and losers of report
+func writeMovers(w io.Writer, report analytics.MoversReport) {
+	if report.Date == "" {
+		return
+	}
+	lists := []struct {
+		title  string
+		movers []analytics.Mover
+	}{
+		{"Top gainers", report.Gainers},
+		{"Top losers", report.Losers},
+	}
+	for _, list := range lists {
+		fmt.Fprintf(w, "\n%s of %s:\n", list.title, report.Date)
+		if len(list.movers) == 0 {
+			fmt.Fprintln(w, "  none")
+		}
+		for _, m := range list.movers {
+			fmt.Fprintf(w, "  %-8s %+7.2f%%  close %.3f\n", m.Ticker, m.ChangePercent, m.Close)
+		}
+	}
+}
+
+// processedDates returns the trading dates the processing stage of summary parsed
+func processedDates(summary Summary) []string {
+	for _, st := range summary.Stages {
+		if st.Name == StageProcess && st.Status == StatusCompleted {
+			dates, _ := st.Details["dates"].([]string)
+			return dates
+		}
+	}
+	return nil
+}
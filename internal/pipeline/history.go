@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// ErrRunNotFound is returned by History.Get for an unknown run
+var ErrRunNotFound = errors.New("pipeline run not found")
+
+// Run is a recorded pipeline execution: what started it, with which parameters, and its Summary
+// with the timings, record counts and errors of its stages
+type Run struct {
+	ID      string            `json:"id"`
+	Command string            `json:"command"` // e.g. scrape, process or schedule:evening-update
+	Params  map[string]string `json:"params,omitempty"`
+	Summary
+}
+
+// History is the log of pipeline runs, kept as JSON lines in a file, one run per line
+type History struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewHistory returns the history stored at path, created with the first run added
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Add appends run, giving it an ID from its start time when it has none, and returns the ID
+func (h *History) Add(run Run) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if run.ID == "" {
+		run.ID = run.Started.UTC().Format("20060102T150405.000000")
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return "", err
+	}
+	return run.ID, f.Close()
+}
+
+// List returns up to limit runs, the latest first; limit 0 returns them all
+func (h *History) List(limit int) ([]Run, error) {
+	runs, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(runs)
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+// Get returns the run of id, or ErrRunNotFound
+func (h *History) Get(id string) (Run, error) {
+	runs, err := h.read()
+	if err != nil {
+		return Run{}, err
+	}
+	for _, run := range runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return Run{}, ErrRunNotFound
+}
+
+// read returns the runs of the file in the order they were added. A line that can't be read,
+// e.g. cut short by a crash, is skipped.
+func (h *History) read() ([]Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20) // runs list every date they processed
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", h.path, err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"isxcli/internal/csvgz"
+)
+
+// FileLineage is the pipeline run that last wrote an output file
+type FileLineage struct {
+	Run      string    `json:"run"`             // the ID of the run in the History
+	Command  string    `json:"command"`         // e.g. scrape or schedule:evening-update
+	Stage    string    `json:"stage,omitempty"` // the stage declaring the file as an artifact, if any
+	Produced time.Time `json:"produced"`        // when the file was last modified
+	// Stale is set by Lineage.Files when a source file changed after the file was produced
+	Stale bool `json:"stale"`
+}
+
+// Lineage is the manifest of the runs producing the files of an output directory, kept as JSON
+// in a file. Compressed CSVs are listed under their plain name, as the files API lists them.
+type Lineage struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLineage returns the manifest stored at path, created with the first run recorded
+func NewLineage(path string) *Lineage {
+	return &Lineage{path: path}
+}
+
+// Record attributes the files of dir modified while run ran to it; stages maps the artifact
+// paths of the run to the stages producing them, see Manager.Outputs. Files no longer in dir are
+// dropped from the manifest.
+func (l *Lineage) Record(run Run, dir string, stages map[string]string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	files, err := l.read()
+	if err != nil {
+		return err
+	}
+	produced := make(map[string]string) // relative name -> stage
+	for path, stage := range stages {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			produced[csvgz.Name(filepath.ToSlash(rel))] = stage
+		}
+	}
+	present := make(map[string]bool)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := csvgz.Name(filepath.ToSlash(rel))
+		present[name] = true
+		if mod := info.ModTime(); !mod.Before(run.Started) && !mod.After(run.Finished) {
+			files[name] = FileLineage{Run: run.ID, Command: run.Command, Stage: produced[name], Produced: mod}
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("record lineage of %s: %w", dir, err)
+	}
+	for name := range files {
+		if !present[name] {
+			delete(files, name)
+		}
+	}
+	return l.write(files)
+}
+
+// Files returns the lineage of the recorded files, marking those older than the newest file of
+// sources, e.g. the downloaded reports, as Stale
+func (l *Lineage) Files(sources string) (map[string]FileLineage, error) {
+	l.mu.Lock()
+	files, err := l.read()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var newest time.Time
+	entries, err := os.ReadDir(sources)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !e.IsDir() && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	for name, f := range files {
+		f.Stale = newest.After(f.Produced)
+		files[name] = f
+	}
+	return files, nil
+}
+
+// read returns the manifest, empty when the file doesn't exist
+func (l *Lineage) read() (map[string]FileLineage, error) {
+	files := make(map[string]FileLineage)
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("read %s: %w", l.path, err)
+	}
+	return files, nil
+}
+
+// write replaces the manifest with files, through a temporary file so a crash can't truncate it
+func (l *Lineage) write(files map[string]FileLineage) error {
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
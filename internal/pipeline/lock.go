@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLocked is matched by the *LockedError of a run refused since another holds the RunLock
+var ErrLocked = errors.New("another pipeline run is in progress")
+
+// LockedError is returned by Execute when another run holds the Lock of the Manager and it
+// doesn't wait for it
+type LockedError struct {
+	PID   int       // of the process running it, this one for a run of the same server
+	Since time.Time // when it started
+}
+
+func (e *LockedError) Error() string {
+	if e.Since.IsZero() {
+		return ErrLocked.Error()
+	}
+	return fmt.Sprintf("%v (pid %d, since %s)", ErrLocked, e.PID, e.Since.Format("15:04:05"))
+}
+
+// Is matches ErrLocked
+func (e *LockedError) Is(target error) bool { return target == ErrLocked }
+
+// The holder of a lock file rewrites it every lockHeartbeat; a lock file left older than
+// lockStale by a process that crashed is taken over. A waiting run checks it every lockPoll.
+var (
+	lockHeartbeat = 30 * time.Second
+	lockStale     = 2 * time.Minute
+	lockPoll      = time.Second
+)
+
+// RunLock keeps the runs of the managers sharing it from overlapping, e.g. a scheduled run and
+// one started from the web interface writing the same combined CSV. Through its lock file it also
+// excludes the runs of other processes using the same file.
+type RunLock struct {
+	path string
+	slot chan struct{} // holds a token while a run of this process holds the lock
+
+	mu    sync.Mutex
+	since time.Time // when the run of this process holding the lock started
+}
+
+// lockHolder is the content of a lock file
+type lockHolder struct {
+	PID   int       `json:"pid"`
+	Since time.Time `json:"since"`
+}
+
+// NewRunLock returns a lock of the runs of this process and, unless path is "", of the processes
+// locking the file at path
+func NewRunLock(path string) *RunLock {
+	return &RunLock{path: path, slot: make(chan struct{}, 1)}
+}
+
+// acquire takes the lock, waiting until it is free or ctx is done when wait is set and failing
+// with a *LockedError otherwise. The returned func releases it.
+func (l *RunLock) acquire(ctx context.Context, wait bool) (func(), error) {
+	select {
+	case l.slot <- struct{}{}:
+	default:
+		if !wait {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return nil, &LockedError{PID: os.Getpid(), Since: l.since}
+		}
+		select {
+		case l.slot <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	since := time.Now()
+	if l.path != "" {
+		if err := l.lockFile(ctx, wait, since); err != nil {
+			<-l.slot
+			return nil, err
+		}
+	}
+	l.mu.Lock()
+	l.since = since
+	l.mu.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if l.path == "" {
+			return
+		}
+		ticker := time.NewTicker(lockHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.writeFile(since)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if l.path != "" {
+			os.Remove(l.path)
+		}
+		<-l.slot
+	}, nil
+}
+
+// lockFile creates the lock file, taking over a stale one, when no other process holds it
+func (l *RunLock) lockFile(ctx context.Context, wait bool, since time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	for {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return l.writeFile(since)
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("lock %s: %w", l.path, err)
+		}
+		info, err := os.Stat(l.path)
+		if err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(l.path)
+			continue
+		}
+		if !wait {
+			var holder lockHolder
+			if data, err := os.ReadFile(l.path); err == nil {
+				json.Unmarshal(data, &holder)
+			}
+			return &LockedError{PID: holder.PID, Since: holder.Since}
+		}
+		select {
+		case <-time.After(lockPoll):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// writeFile writes the holder of the lock file, which also refreshes its modification time
+func (l *RunLock) writeFile(since time.Time) error {
+	data, err := json.Marshal(lockHolder{PID: os.Getpid(), Since: since})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, data, 0644)
+}
@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Counter is implemented by stages counting the work of their last run, from which Metrics
+// derives their throughput
+type Counter interface {
+	// Counts returns the files and records the last run handled
+	Counts() (files, records int)
+}
+
+// Metrics accumulates the outcomes of pipeline runs for long-term performance monitoring. One
+// Metrics may be shared by the managers of a server.
+type Metrics struct {
+	mu     sync.Mutex
+	since  time.Time
+	runs   map[string]int // by status
+	stages map[string]*StageMetrics
+}
+
+// StageMetrics are the totals of one stage over the runs a Metrics recorded
+type StageMetrics struct {
+	Runs     map[string]int `json:"runs"`    // by status: completed, failed, timed_out or skipped
+	Retries  int            `json:"retries"` // attempts after the first
+	Seconds  float64        `json:"duration_seconds"`
+	Last     float64        `json:"last_duration_seconds"` // of the last run that wasn't skipped
+	Max      float64        `json:"max_duration_seconds"`
+	Files    int            `json:"files"`
+	Records  int            `json:"records"`
+	Failures int            `json:"failures"` // failed and timed out runs
+	// FilesPerMinute and RecordsPerSecond are the throughput over the total duration
+	FilesPerMinute   float64 `json:"files_per_minute"`
+	RecordsPerSecond float64 `json:"records_per_second"`
+}
+
+// MetricsSnapshot is the state of a Metrics, as the admin API serves it
+type MetricsSnapshot struct {
+	Since  time.Time               `json:"since"`
+	Runs   map[string]int          `json:"runs"` // by status
+	Stages map[string]StageMetrics `json:"stages"`
+}
+
+// NewMetrics returns empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{since: time.Now(), runs: make(map[string]int), stages: make(map[string]*StageMetrics)}
+}
+
+// Record adds the run of summary
+func (m *Metrics) Record(summary Summary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[summary.Status]++
+	for _, st := range summary.Stages {
+		sm, ok := m.stages[st.Name]
+		if !ok {
+			sm = &StageMetrics{Runs: make(map[string]int)}
+			m.stages[st.Name] = sm
+		}
+		sm.Runs[st.Status]++
+		if st.Status == StatusSkipped {
+			continue
+		}
+		if st.Status != StatusCompleted {
+			sm.Failures++
+		}
+		sm.Retries += max(st.Attempts-1, 0)
+		sm.Seconds += st.Duration
+		sm.Last = st.Duration
+		sm.Max = max(sm.Max, st.Duration)
+		sm.Files += st.Files
+		sm.Records += st.Records
+	}
+}
+
+// Snapshot returns the totals recorded so far, with the throughput of each stage
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := MetricsSnapshot{Since: m.since, Runs: maps.Clone(m.runs), Stages: make(map[string]StageMetrics, len(m.stages))}
+	for name, sm := range m.stages {
+		st := *sm
+		st.Runs = maps.Clone(sm.Runs)
+		if st.Seconds > 0 {
+			st.FilesPerMinute = float64(st.Files) * 60 / st.Seconds
+			st.RecordsPerSecond = float64(st.Records) / st.Seconds
+		}
+		snap.Stages[name] = st
+	}
+	return snap
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format, for a /metrics
+// endpoint
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snap := m.Snapshot()
+	stages := slices.Sorted(maps.Keys(snap.Stages))
+	var err error
+	metric := func(name, kind, help string, samples func(sample func(labels string, v float64))) {
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		samples(func(labels string, v float64) {
+			if err == nil {
+				_, err = fmt.Fprintf(w, "%s{%s} %g\n", name, labels, v)
+			}
+		})
+	}
+	perStage := func(value func(StageMetrics) float64) func(func(string, float64)) {
+		return func(sample func(string, float64)) {
+			for _, name := range stages {
+				sample(fmt.Sprintf("stage=%q", name), value(snap.Stages[name]))
+			}
+		}
+	}
+
+	metric("isx_pipeline_runs_total", "counter", "Pipeline runs by status.", func(sample func(string, float64)) {
+		for _, status := range slices.Sorted(maps.Keys(snap.Runs)) {
+			sample(fmt.Sprintf("status=%q", status), float64(snap.Runs[status]))
+		}
+	})
+	metric("isx_pipeline_stage_runs_total", "counter", "Stage runs by status.", func(sample func(string, float64)) {
+		for _, name := range stages {
+			runs := snap.Stages[name].Runs
+			for _, status := range slices.Sorted(maps.Keys(runs)) {
+				sample(fmt.Sprintf("stage=%q,status=%q", name, status), float64(runs[status]))
+			}
+		}
+	})
+	metric("isx_pipeline_stage_failures_total", "counter", "Stage runs that failed or timed out.",
+		perStage(func(s StageMetrics) float64 { return float64(s.Failures) }))
+	metric("isx_pipeline_stage_retries_total", "counter", "Stage attempts after the first.",
+		perStage(func(s StageMetrics) float64 { return float64(s.Retries) }))
+	metric("isx_pipeline_stage_duration_seconds_total", "counter", "Time spent in the stage, retry delays included.",
+		perStage(func(s StageMetrics) float64 { return s.Seconds }))
+	metric("isx_pipeline_stage_last_duration_seconds", "gauge", "Duration of the last run of the stage.",
+		perStage(func(s StageMetrics) float64 { return s.Last }))
+	metric("isx_pipeline_stage_files_total", "counter", "Files the stage handled.",
+		perStage(func(s StageMetrics) float64 { return float64(s.Files) }))
+	metric("isx_pipeline_stage_records_total", "counter", "Records the stage handled.",
+		perStage(func(s StageMetrics) float64 { return float64(s.Records) }))
+	metric("isx_pipeline_stage_files_per_minute", "gauge", "Files handled per minute of the stage.",
+		perStage(func(s StageMetrics) float64 { return s.FilesPerMinute }))
+	metric("isx_pipeline_stage_records_per_second", "gauge", "Records handled per second of the stage.",
+		perStage(func(s StageMetrics) float64 { return s.RecordsPerSecond }))
+	return err
+}
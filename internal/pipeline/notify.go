@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// StageNotify is the name of NotificationStage
+const StageNotify = "notify"
+
+// WebhooksEnvVar names the environment variable holding the comma-separated webhook URLs
+// notified of every pipeline run
+const WebhooksEnvVar = "ISX_WEBHOOKS"
+
+// WebhooksFromEnv returns the webhook URLs of WebhooksEnvVar, none when it is unset
+func WebhooksFromEnv() []string {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv(WebhooksEnvVar), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// NotificationStage posts the Summary of a run as JSON to webhooks once the other stages finished,
+// whether they completed or failed, so external automation can act on new data or a failure
+type NotificationStage struct {
+	URLs   []string
+	Client *http.Client // nil posts with a 30-second timeout
+	Retry  RetryConfig  // the zero value never retries
+
+	summary Summary
+}
+
+// Name returns StageNotify
+func (s *NotificationStage) Name() string { return StageNotify }
+
+// RetryConfig returns s.Retry
+func (s *NotificationStage) RetryConfig() RetryConfig { return s.Retry }
+
+// Finalize sets the summary posted by Run
+func (s *NotificationStage) Finalize(summary Summary) { s.summary = summary }
+
+// Plan returns the webhooks to notify
+func (s *NotificationStage) Plan(ctx context.Context) (Estimate, error) {
+	return Estimate{Description: fmt.Sprintf("post the summary of the run to %d webhooks", len(s.URLs))}, nil
+}
+
+// Run posts the summary to every URL, failing when any of them doesn't accept it. Only the hosts
+// of the URLs are logged since webhook URLs often carry a token.
+func (s *NotificationStage) Run(ctx context.Context, out io.Writer) error {
+	body, err := json.Marshal(s.summary)
+	if err != nil {
+		return err
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	var errs []error
+	for _, u := range s.URLs {
+		host := u
+		if parsed, err := url.Parse(u); err == nil {
+			host = parsed.Host
+		}
+		if err := post(ctx, client, u, body); err != nil {
+			errs = append(errs, fmt.Errorf("notify %s: %w", host, err))
+			continue
+		}
+		fmt.Fprintf(out, "Notified %s of the %s run\n", host, s.summary.Status)
+	}
+	return errors.Join(errs...)
+}
+
+// post sends body as JSON to u, failing unless the response status is 2xx
+func post(ctx context.Context, client *http.Client, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		// The error of url.Parse quotes the URL
+		return errors.New("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return nil
+}
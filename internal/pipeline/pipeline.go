@@ -0,0 +1,497 @@
+// Package pipeline runs the steps that turn the ISX portal into the dashboard data — scraping,
+// processing, index extraction and analysis — in-process, as stages a Manager executes in order.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the stages of this package
+const (
+	StageScrape   = "scrape"
+	StageProcess  = "process"
+	StageIndices  = "indices"
+	StageAnalysis = "analysis"
+)
+
+// Stage is one step of the pipeline
+type Stage interface {
+	// Name identifies the stage to Manager.Execute
+	Name() string
+	// Run performs the step, writing its log to out
+	Run(ctx context.Context, out io.Writer) error
+}
+
+// Dependent is implemented by stages that need other stages to complete before they run.
+// Dependencies that aren't executed along with the stage are ignored.
+type Dependent interface {
+	DependsOn() []string
+}
+
+// ExecutionMode selects how Manager.Execute schedules the stages
+type ExecutionMode string
+
+// Execution modes
+const (
+	// ExecutionModeSequential runs one stage at a time, in dependency then registration order
+	ExecutionModeSequential ExecutionMode = "sequential"
+	// ExecutionModeParallel starts every stage as soon as its dependencies complete, so
+	// independent stages run concurrently
+	ExecutionModeParallel ExecutionMode = "parallel"
+)
+
+// Statuses of an Event
+const (
+	StatusStarted   = "started"
+	StatusRetrying  = "retrying"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusTimedOut  = "timed_out" // failed with a *TimeoutError
+	StatusSkipped   = "skipped"   // not run since its Conditional didn't hold
+)
+
+// Event reports a stage starting, failing an attempt it is retried after, finishing or being
+// skipped
+type Event struct {
+	Stage   string
+	Status  string        // StatusStarted, StatusRetrying, StatusCompleted, StatusFailed, StatusTimedOut or StatusSkipped
+	Err     error         // the error of a failed stage or attempt
+	Attempt int           // the attempt that failed, for StatusRetrying
+	Delay   time.Duration // the wait before the next attempt, for StatusRetrying
+	Reason  string        // why the stage didn't run, for StatusSkipped
+}
+
+// Manager executes registered stages after the stages they depend on
+type Manager struct {
+	stages []Stage
+	// Mode schedules the stages; "" is ExecutionModeSequential
+	Mode ExecutionMode
+	// Timeout, when set, is the deadline of an Execute call; the finalizers run after it
+	Timeout time.Duration
+	// StageTimeouts cancel an attempt of the named stage that runs longer, e.g. a scrape stuck on
+	// a hung Chrome session. Stages only stop when they honour their context.
+	StageTimeouts map[string]time.Duration
+	// Retries replace the RetryConfig of the named stages
+	Retries map[string]RetryConfig
+	// Limiter, when set, caps the resources of the Limited stages, e.g. a Limiter shared by the
+	// managers of a server so concurrent pipelines don't start more Chrome instances than it holds
+	Limiter *Limiter
+	// Metrics, when set, records the outcome of every Execute
+	Metrics *Metrics
+	// Lock, when set, keeps the runs of the managers sharing it from overlapping: Execute fails
+	// with a *LockedError while another holds it, or waits for it with WaitForLock
+	Lock        *RunLock
+	WaitForLock bool
+	// Changes, when set, skips each stage consuming ArtifactReports while the downloads are
+	// unchanged since the last run that completed it into the same outputs, e.g. on a scheduled
+	// run finding no new report
+	Changes *ChangeDetector
+	// Conditions skip the named stage when they don't hold, as its Conditional does; a stage
+	// runs only when both hold
+	Conditions map[string]Condition
+	// Output returns the writer receiving the log of the named stage; a nil func or writer means
+	// os.Stdout
+	Output func(stage string) io.Writer
+	// OnEvent, when set, receives an Event as every stage starts and finishes. Calls are never
+	// concurrent, even in ExecutionModeParallel.
+	OnEvent func(Event)
+	// OnProgress, when set, receives the Progress of a run as it starts, as its stages report
+	// theirs with ReportProgress and as each stage finishes. Calls are never concurrent.
+	OnProgress func(Progress)
+
+	mu   sync.Mutex // serializes Output, OnEvent and OnProgress calls
+	last Summary    // of the last Execute
+}
+
+// NewManager returns a manager of stages, registered in the order the stages independent of each
+// other run in ExecutionModeSequential
+func NewManager(stages ...Stage) *Manager {
+	m := &Manager{}
+	for _, s := range stages {
+		m.Register(s)
+	}
+	return m
+}
+
+// Register adds a stage, ordered after those already registered unless they depend on it. It
+// panics when a stage of the same name, or producing one of the same artifacts, is registered.
+func (m *Manager) Register(s Stage) {
+	if slices.Contains(m.Stages(), s.Name()) {
+		panic(fmt.Sprintf("pipeline: stage %q registered twice", s.Name()))
+	}
+	for a := range outputs(s) {
+		if p := m.producer(a); p != "" {
+			panic(fmt.Sprintf("pipeline: artifact %q produced by both %q and %q", a, p, s.Name()))
+		}
+	}
+	m.stages = append(m.stages, s)
+}
+
+// Stages returns the names of the registered stages in the order they run
+func (m *Manager) Stages() []string {
+	names := make([]string, len(m.stages))
+	for i, s := range m.stages {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Execute runs the named stages, or every stage when none is named, after the stages they depend
+// on. It stops at the first stage failing or when ctx is cancelled, returning a *StageError; in
+// ExecutionModeParallel the stages still running are cancelled through their context.
+//
+// A stage stopped by Timeout or its StageTimeouts fails with a *TimeoutError naming it.
+//
+// Finalizer stages run on every Execute, named or not, once the other stages finished. They run
+// even after a failure or cancellation, and their own failure is returned only when the other
+// stages completed.
+func (m *Manager) Execute(ctx context.Context, names ...string) error {
+	ordered, finalizers, err := m.selectStages(names)
+	if err != nil {
+		return err
+	}
+	if m.Mode != "" && m.Mode != ExecutionModeSequential && m.Mode != ExecutionModeParallel {
+		return fmt.Errorf("unknown execution mode %q", m.Mode)
+	}
+
+	if m.Lock != nil {
+		release, err := m.Lock.acquire(ctx, m.WaitForLock)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	ctx = context.WithValue(ctx, artifactsKey{}, m.artifacts())
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if m.Timeout > 0 {
+		runCtx, cancel = context.WithTimeoutCause(ctx, m.Timeout, &TimeoutError{Timeout: m.Timeout, Run: true})
+	}
+	rec := newRecorder()
+	if m.OnProgress != nil {
+		rec.progress = newTracker(ordered, m.emitProgress)
+		rec.progress.start()
+	}
+	if m.Mode == ExecutionModeParallel {
+		err = m.executeParallel(runCtx, ordered, rec)
+	} else {
+		for _, s := range ordered {
+			if err = m.run(runCtx, s, rec); err != nil {
+				break
+			}
+		}
+	}
+	cancel()
+
+	summary := rec.summary(err)
+	m.mu.Lock()
+	m.last = summary
+	m.mu.Unlock()
+	if m.Metrics != nil {
+		m.Metrics.Record(summary)
+	}
+	if len(finalizers) > 0 {
+		ctx := context.WithoutCancel(ctx)
+		for _, s := range finalizers {
+			s.(Finalizer).Finalize(summary)
+			if ferr := m.run(ctx, s, nil); err == nil {
+				err = ferr
+			}
+		}
+	}
+	// Only a completed run has processed the downloads it fingerprints
+	if m.Changes != nil && summary.Status == StatusCompleted {
+		if cerr := m.Changes.Commit(m.consumedReports(summary)...); err == nil && cerr != nil {
+			err = fmt.Errorf("record the downloads processed: %w", cerr)
+		}
+	}
+	return err
+}
+
+// Summary returns the Summary of the last Execute call, as its Finalizer stages received it
+func (m *Manager) Summary() Summary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// selectStages returns the stages Execute(names...) runs, in dependency order, and the Finalizer
+// stages run after them
+func (m *Manager) selectStages(names []string) (ordered, finalizers []Stage, err error) {
+	for _, name := range names {
+		if !slices.Contains(m.Stages(), name) {
+			return nil, nil, fmt.Errorf("unknown stage %q", name)
+		}
+	}
+	var selected []Stage
+	for _, s := range m.stages {
+		if _, ok := s.(Finalizer); ok {
+			finalizers = append(finalizers, s)
+		} else if len(names) == 0 || slices.Contains(names, s.Name()) {
+			selected = append(selected, s)
+		}
+	}
+	if ordered, err = sortStages(selected, m.dependencies); err != nil {
+		return nil, nil, err
+	}
+	return ordered, finalizers, nil
+}
+
+// executeParallel runs each of stages, sorted by sortStages, once the stages it depends on
+// completed
+func (m *Manager) executeParallel(ctx context.Context, stages []Stage, rec *recorder) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(map[string]chan struct{}, len(stages))
+	for _, s := range stages {
+		done[s.Name()] = make(chan struct{})
+	}
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failure  error
+		waitOnce sync.Once
+		waitErr  error // of a stage cancelled before it started, returned when none failed
+	)
+	for _, s := range stages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, dep := range m.dependencies(s) {
+				ch, ok := done[dep]
+				if !ok {
+					continue
+				}
+				select {
+				case <-ch:
+				case <-ctx.Done():
+					// A stage failed or the run was cancelled: the first failure is returned
+					waitOnce.Do(func() { waitErr = &StageError{s.Name(), ctx.Err()} })
+					return
+				}
+			}
+			if err := m.run(ctx, s, rec); err != nil {
+				failOnce.Do(func() { failure = err })
+				cancel()
+				return
+			}
+			close(done[s.Name()])
+		}()
+	}
+	wg.Wait()
+	if failure == nil {
+		return waitErr
+	}
+	return failure
+}
+
+// run runs one stage, retried as its RetryConfig allows, reporting it through OnEvent and, when
+// set, rec
+func (m *Manager) run(ctx context.Context, s Stage, rec *recorder) error {
+	retry, ok := m.Retries[s.Name()]
+	if !ok {
+		retry = retryConfig(s)
+	}
+	started := time.Now()
+	fail := func(attempt int, err error) error {
+		m.emit(Event{Stage: s.Name(), Status: failureStatus(err), Err: err})
+		rec.record(s, attempt, time.Since(started), err)
+		return &StageError{s.Name(), err}
+	}
+	if run, reason := m.shouldRun(s, rec); !run {
+		m.emit(Event{Stage: s.Name(), Status: StatusSkipped, Reason: reason})
+		rec.skip(s, reason)
+		rec.tracker().finish(s)
+		return nil
+	}
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return &StageError{s.Name(), err}
+		}
+		if attempt == 1 {
+			m.emit(Event{Stage: s.Name(), Status: StatusStarted})
+		}
+		err := m.attempt(rec.tracker().context(ctx, s), s)
+		if err == nil {
+			m.emit(Event{Stage: s.Name(), Status: StatusCompleted})
+			rec.record(s, attempt, time.Since(started), nil)
+			rec.tracker().finish(s)
+			return nil
+		}
+		if ctx.Err() != nil || !retry.retryable(err, attempt) {
+			return fail(attempt, err)
+		}
+
+		delay := retry.delay(attempt)
+		m.emit(Event{Stage: s.Name(), Status: StatusRetrying, Err: err, Attempt: attempt, Delay: delay})
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if timeout := timedOut(ctx, s); timeout != nil {
+				err = timeout
+			}
+			return fail(attempt, err)
+		}
+	}
+}
+
+// shouldRun evaluates the Changes of the downloads s consumes, the Conditions entry of s and its
+// Conditional against the stages rec recorded; the stages of a run without rec, its finalizers,
+// always run
+func (m *Manager) shouldRun(s Stage, rec *recorder) (bool, string) {
+	if rec == nil {
+		return true, ""
+	}
+	// An unreadable fingerprint runs the stage, like a changed one
+	if m.Changes != nil && slices.Contains(inputs(s), ArtifactReports) {
+		if changed, err := m.Changes.Changed(changeKey(s)); err == nil && !changed {
+			return false, ReasonUnchanged
+		}
+	}
+	done := rec.outcomes()
+	if run, reason := m.Conditions[s.Name()].eval(done); !run {
+		return false, reason
+	}
+	if c, ok := s.(Conditional); ok {
+		return c.ShouldRun(done)
+	}
+	return true, ""
+}
+
+// attempt runs s once within its StageTimeouts entry, holding the resources the Limiter grants
+// it. A stage stopped by its own timeout or the deadline of the run fails with a *TimeoutError.
+func (m *Manager) attempt(ctx context.Context, s Stage) error {
+	if l, ok := s.(Limited); ok && m.Limiter != nil {
+		grant, err := m.Limiter.acquire(ctx, l.Resources(), func() {
+			fmt.Fprintf(m.output(s.Name()), "Waiting for %s held by other stages\n", formatResources(l.Resources()))
+		})
+		if err != nil {
+			if timeout := timedOut(ctx, s); timeout != nil {
+				return timeout
+			}
+			return err
+		}
+		defer m.Limiter.release(grant)
+		ctx = context.WithValue(ctx, grantKey{}, grant)
+	}
+	if d := m.StageTimeouts[s.Name()]; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d, &TimeoutError{Stage: s.Name(), Timeout: d})
+		defer cancel()
+	}
+	err := s.Run(ctx, m.output(s.Name()))
+	if err == nil {
+		return nil
+	}
+	if timeout := timedOut(ctx, s); timeout != nil {
+		return timeout
+	}
+	return err
+}
+
+// timedOut returns the *TimeoutError of s when ctx expired on a timeout of the Manager
+func timedOut(ctx context.Context, s Stage) *TimeoutError {
+	var timeout *TimeoutError
+	if ctx.Err() == nil || !errors.As(context.Cause(ctx), &timeout) {
+		return nil
+	}
+	stalled := *timeout
+	stalled.Stage = s.Name()
+	return &stalled
+}
+
+// sortStages orders stages so each comes after the stages of the list dependsOn returns for it,
+// keeping their order otherwise. It fails when the dependencies form a cycle.
+func sortStages(stages []Stage, dependsOn func(Stage) []string) ([]Stage, error) {
+	index := make(map[string]int, len(stages))
+	for i, s := range stages {
+		index[s.Name()] = i
+	}
+	// Depth-first, visiting the dependencies of each stage in list order before the stage
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make([]int, len(stages))
+	sorted := make([]Stage, 0, len(stages))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("stage dependency cycle: %s", strings.Join(append(path, stages[i].Name()), " -> "))
+		}
+		state[i] = visiting
+		deps := dependsOn(stages[i])
+		ordered := make([]int, 0, len(deps))
+		for _, dep := range deps {
+			if j, ok := index[dep]; ok {
+				ordered = append(ordered, j)
+			}
+		}
+		slices.Sort(ordered)
+		for _, j := range ordered {
+			if err := visit(j, append(path, stages[i].Name())); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		sorted = append(sorted, stages[i])
+		return nil
+	}
+	for i := range stages {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func (m *Manager) emit(ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.OnEvent != nil {
+		m.OnEvent(ev)
+	}
+}
+
+func (m *Manager) emitProgress(p Progress) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.OnProgress(p)
+}
+
+func (m *Manager) output(stage string) io.Writer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Output != nil {
+		if w := m.Output(stage); w != nil {
+			return w
+		}
+	}
+	return os.Stdout
+}
+
+// StageError reports the stage an Execute call stopped at
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s stage: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,1104 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"isxcli/internal/indices"
+	"isxcli/internal/processor"
+	"isxcli/internal/scraper"
+)
+
+// fakeStage logs its name, calls run when set and fails with err
+type fakeStage struct {
+	name string
+	deps []string
+	run  func(ctx context.Context) error
+	err  error
+}
+
+func (s *fakeStage) Name() string { return s.name }
+
+func (s *fakeStage) DependsOn() []string { return s.deps }
+
+func (s *fakeStage) Run(ctx context.Context, out io.Writer) error {
+	fmt.Fprintln(out, s.name)
+	if s.run != nil {
+		if err := s.run(ctx); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+// TestExecute runs the selected stages in registration order and stops at a failing one
+func TestExecute(t *testing.T) {
+	failure := errors.New("no reports")
+	m := NewManager(&fakeStage{name: "a"}, &fakeStage{name: "b", err: failure}, &fakeStage{name: "c"})
+	var log strings.Builder
+	var events []string
+	m.Output = func(string) io.Writer { return &log }
+	m.OnEvent = func(ev Event) { events = append(events, ev.Stage+" "+ev.Status) }
+
+	if err := m.Execute(context.Background(), "c", "a"); err != nil || log.String() != "a\nc\n" {
+		t.Fatalf("selected stages: %q %v", log.String(), err)
+	}
+
+	log.Reset()
+	events = nil
+	err := m.Execute(context.Background())
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "b" || !errors.Is(err, failure) {
+		t.Errorf("error: %v", err)
+	}
+	if want := "a started,a completed,b started,b failed"; strings.Join(events, ",") != want || log.String() != "a\nb\n" {
+		t.Errorf("events %q, log %q", events, log.String())
+	}
+
+	if err := m.Execute(context.Background(), "d"); err == nil {
+		t.Error("expected an error for an unknown stage")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Execute(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: %v", err)
+	}
+}
+
+// TestExecuteOrder runs stages after their dependencies and rejects a cycle
+func TestExecuteOrder(t *testing.T) {
+	m := NewManager(
+		&fakeStage{name: "analysis", deps: []string{"process", "indices"}},
+		&fakeStage{name: "scrape"},
+		&fakeStage{name: "process", deps: []string{"scrape", "indices"}},
+		&fakeStage{name: "indices", deps: []string{"scrape"}},
+	)
+	var log strings.Builder
+	m.Output = func(string) io.Writer { return &log }
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if log.String() != "scrape\nindices\nprocess\nanalysis\n" {
+		t.Errorf("order: %q", log.String())
+	}
+
+	// Dependencies left out of the run are ignored
+	log.Reset()
+	if err := m.Execute(context.Background(), "analysis", "process"); err != nil || log.String() != "process\nanalysis\n" {
+		t.Errorf("selected: %q %v", log.String(), err)
+	}
+
+	cyclic := NewManager(&fakeStage{name: "a", deps: []string{"b"}}, &fakeStage{name: "b", deps: []string{"a"}})
+	if err := cyclic.Execute(context.Background()); err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("cycle: %v", err)
+	}
+}
+
+// TestExecuteParallel runs independent stages concurrently and cancels the others when one fails
+func TestExecuteParallel(t *testing.T) {
+	// b and c only return once both started
+	var started sync.WaitGroup
+	started.Add(2)
+	both := func(ctx context.Context) error {
+		started.Done()
+		wait := make(chan struct{})
+		go func() { started.Wait(); close(wait) }()
+		select {
+		case <-wait:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("ran alone")
+		}
+	}
+	var mu sync.Mutex
+	var order []string
+	m := NewManager(
+		&fakeStage{name: "a"},
+		&fakeStage{name: "b", deps: []string{"a"}, run: both},
+		&fakeStage{name: "c", deps: []string{"a"}, run: both},
+		&fakeStage{name: "d", deps: []string{"b", "c"}},
+	)
+	m.Mode = ExecutionModeParallel
+	m.Output = func(string) io.Writer { return io.Discard }
+	m.OnEvent = func(ev Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ev.Status == StatusCompleted {
+			order = append(order, ev.Stage)
+		}
+	}
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 4 || order[0] != "a" || order[3] != "d" {
+		t.Errorf("completed: %v", order)
+	}
+
+	// The failure of b cancels c, and d never runs
+	failure := errors.New("no reports")
+	var ran []string
+	m = NewManager(
+		&fakeStage{name: "b", err: failure},
+		&fakeStage{name: "c", run: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+		&fakeStage{name: "d", deps: []string{"b", "c"}},
+	)
+	m.Mode = ExecutionModeParallel
+	m.Output = func(string) io.Writer { return io.Discard }
+	m.OnEvent = func(ev Event) {
+		if ev.Status == StatusStarted {
+			ran = append(ran, ev.Stage)
+		}
+	}
+	err := m.Execute(context.Background())
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "b" || !errors.Is(err, failure) {
+		t.Errorf("error: %v", err)
+	}
+	if slices.Contains(ran, "d") {
+		t.Errorf("d ran after b failed: %v", ran)
+	}
+}
+
+// rendezvousWriter holds the first write of its stage until every stage sharing started has
+// written, recording an error when they don't within 5 seconds
+type rendezvousWriter struct {
+	once    sync.Once
+	started *sync.WaitGroup
+	err     error
+}
+
+func (w *rendezvousWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		w.started.Done()
+		wait := make(chan struct{})
+		go func() { w.started.Wait(); close(wait) }()
+		select {
+		case <-wait:
+		case <-time.After(5 * time.Second):
+			w.err = errors.New("ran alone")
+		}
+	})
+	return len(p), nil
+}
+
+// TestProcessingOverlapsIndices runs the index extraction and the processing side by side unless
+// the processing reads indexes.csv
+func TestProcessingOverlapsIndices(t *testing.T) {
+	dir := t.TempDir()
+	downloads, reports := filepath.Join(dir, "downloads"), filepath.Join(dir, "reports")
+	if err := os.MkdirAll(downloads, 0755); err != nil {
+		t.Fatal(err)
+	}
+	indexOpts := indices.DefaultOptions()
+	indexOpts.Dir, indexOpts.Out, indexOpts.Formats = downloads, filepath.Join(reports, "indexes.csv"), ""
+	processOpts := processor.DefaultOptions()
+	processOpts.InDir, processOpts.OutDir, processOpts.Companies = downloads, reports, ""
+	processOpts.IndexTolerance = 0
+
+	var started sync.WaitGroup
+	started.Add(2)
+	writers := map[string]*rendezvousWriter{
+		StageIndices: {started: &started},
+		StageProcess: {started: &started},
+	}
+	m := NewManager(&IndicesStage{Options: indexOpts}, &ProcessingStage{Options: processOpts})
+	m.Mode = ExecutionModeParallel
+	m.Output = func(stage string) io.Writer { return writers[stage] }
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for stage, w := range writers {
+		if w.err != nil {
+			t.Errorf("%s: %v", stage, w.err)
+		}
+	}
+
+	// The index check of the quality report reads indexes.csv, so it waits for the extraction
+	processOpts.IndexTolerance = indices.DefaultTolerance
+	checked := NewManager(&IndicesStage{Options: indexOpts}, &ProcessingStage{Options: processOpts})
+	if deps := checked.dependencies(&ProcessingStage{Options: processOpts}); !slices.Contains(deps, StageIndices) {
+		t.Errorf("processing with the index check depends on %v", deps)
+	}
+}
+
+// retryStage fails with each of errs in turn, then succeeds
+type retryStage struct {
+	fakeStage
+	retry RetryConfig
+	errs  []error
+}
+
+func (s *retryStage) RetryConfig() RetryConfig { return s.retry }
+
+func (s *retryStage) Run(ctx context.Context, out io.Writer) error {
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+// TestRetry retries transient failures with backoff, reporting each retry, and gives up on others
+func TestRetry(t *testing.T) {
+	outage := fmt.Errorf("navigate: page load error net::ERR_CONNECTION_RESET")
+	retry := RetryConfig{MaxAttempts: 3, Backoff: BackoffExponential, Delay: time.Millisecond}
+	stage := &retryStage{fakeStage: fakeStage{name: "scrape"}, retry: retry, errs: []error{outage, outage}}
+	m := NewManager(stage)
+	var events []Event
+	m.OnEvent = func(ev Event) { events = append(events, ev) }
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 || events[1].Status != StatusRetrying || events[2].Attempt != 2 || events[2].Delay != 2*time.Millisecond || events[3].Status != StatusCompleted {
+		t.Errorf("events: %+v", events)
+	}
+
+	// A third outage exhausts the attempts; a non-transient error isn't retried
+	for _, errs := range [][]error{{outage, outage, outage}, {errors.New("indices not found")}} {
+		events = nil
+		stage.errs = errs
+		if err := m.Execute(context.Background()); !errors.Is(err, errs[len(errs)-1]) {
+			t.Errorf("%v: %v", errs, err)
+		}
+		if len(events) != len(errs)+1 || events[len(events)-1].Status != StatusFailed {
+			t.Errorf("%v: events %+v", errs, events)
+		}
+	}
+}
+
+// TestRetryDelay checks the backoff strategies and the delay cap
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		config RetryConfig
+		want   []time.Duration
+	}{
+		{RetryConfig{Delay: time.Second}, []time.Duration{time.Second, time.Second, time.Second}},
+		{RetryConfig{Backoff: BackoffLinear, Delay: time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{RetryConfig{Backoff: BackoffExponential, Delay: time.Second, MaxDelay: 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+	}
+	for _, c := range cases {
+		for i, want := range c.want {
+			if got := c.config.delay(i + 1); got != want {
+				t.Errorf("%s retry %d: %v, want %v", c.config.Backoff, i+1, got, want)
+			}
+		}
+	}
+	if IsTransient(context.Canceled) || !IsTransient(fmt.Errorf("download: %w", context.DeadlineExceeded)) || IsTransient(errors.New("bad status: 404 Not Found")) {
+		t.Error("IsTransient misclassified an error")
+	}
+}
+
+// TestNotification posts the summary of a run to the webhooks, after a failure too
+func TestNotification(t *testing.T) {
+	var posted []Summary
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var s Summary
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request: %v", err)
+		}
+		posted = append(posted, s)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	failure := errors.New("no reports")
+	b := &fakeStage{name: "b"}
+	m := NewManager(&fakeStage{name: "a"}, b, &NotificationStage{URLs: []string{server.URL}})
+	m.Output = func(string) io.Writer { return io.Discard }
+	if err := m.Execute(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	b.err = failure
+	if err := m.Execute(context.Background()); !errors.Is(err, failure) {
+		t.Errorf("failed run: %v", err)
+	}
+	if len(posted) != 2 || posted[0].Status != StatusCompleted || len(posted[0].Stages) != 1 {
+		t.Fatalf("posted: %+v", posted)
+	}
+	if s := posted[1]; s.Status != StatusFailed || len(s.Stages) != 2 || s.Stages[1].Status != StatusFailed || s.Stages[1].Error != "no reports" {
+		t.Errorf("failed run: %+v", s)
+	}
+
+	// A webhook rejecting the summary fails a run that completed otherwise
+	b.err, status = nil, http.StatusInternalServerError
+	if err := m.Execute(context.Background()); err == nil || !strings.Contains(err.Error(), "bad status: 500") {
+		t.Errorf("rejected: %v", err)
+	}
+}
+
+// plannedStage estimates files files, or fails with err
+type plannedStage struct {
+	fakeStage
+	files int
+	err   error
+}
+
+func (s *plannedStage) Plan(ctx context.Context) (Estimate, error) {
+	return Estimate{Files: s.files, Description: fmt.Sprintf("%d files", s.files)}, s.err
+}
+
+// TestPlan orders the stages as Execute would, with their estimates, without running them
+func TestPlan(t *testing.T) {
+	var log strings.Builder
+	m := NewManager(
+		&NotificationStage{URLs: []string{"http://localhost/hook"}},
+		&plannedStage{fakeStage: fakeStage{name: "process", deps: []string{"scrape", "indices"}}, files: 3},
+		&plannedStage{fakeStage: fakeStage{name: "scrape"}, err: errors.New("no start date")},
+		&fakeStage{name: "analysis", deps: []string{"process"}},
+	)
+	m.Output = func(string) io.Writer { return &log }
+	plan, err := m.Plan(context.Background(), "process", "scrape", "analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range plan.Stages {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "scrape,process,analysis,notify" || plan.Mode != ExecutionModeSequential || log.Len() > 0 {
+		t.Fatalf("plan %v %s, log %q", names, plan.Mode, log.String())
+	}
+	if s := plan.Stages[0]; s.Error != "no start date" || s.Estimate != nil {
+		t.Errorf("scrape: %+v", s)
+	}
+	if s := plan.Stages[1]; s.Estimate == nil || s.Estimate.Files != 3 || !slices.Equal(s.DependsOn, []string{"scrape"}) {
+		t.Errorf("process: %+v", s)
+	}
+	if s := plan.Stages[2]; s.Estimate != nil || s.Finalizer {
+		t.Errorf("analysis: %+v", s)
+	}
+	if s := plan.Stages[3]; !s.Finalizer || s.Estimate == nil {
+		t.Errorf("notify: %+v", s)
+	}
+	if _, err := m.Plan(context.Background(), "combine"); err == nil {
+		t.Error("expected an error for an unknown stage")
+	}
+}
+
+// summaryStage keeps the summary it is finalized with
+type summaryStage struct {
+	fakeStage
+	summary Summary
+}
+
+func (s *summaryStage) Finalize(summary Summary) { s.summary = summary }
+
+// TestTimeout stops a stalled stage and a run past its deadline, naming the stage that stalled
+func TestTimeout(t *testing.T) {
+	hang := func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }
+	final := &summaryStage{fakeStage: fakeStage{name: "report"}}
+	m := NewManager(&fakeStage{name: "scrape", run: hang}, &fakeStage{name: "process", deps: []string{"scrape"}}, final)
+	m.Output = func(string) io.Writer { return io.Discard }
+	var events []Event
+	m.OnEvent = func(ev Event) { events = append(events, ev) }
+	m.StageTimeouts = map[string]time.Duration{"scrape": 10 * time.Millisecond}
+
+	err := m.Execute(context.Background())
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Stage != "scrape" || timeout.Run || err.Error() != "scrape stage: stalled: no result within 10ms" {
+		t.Errorf("stage timeout: %v", err)
+	}
+	if len(events) != 4 || events[1].Status != StatusTimedOut || final.summary.Status != StatusTimedOut || final.summary.Stages[0].Status != StatusTimedOut {
+		t.Errorf("events %+v, summary %+v", events, final.summary)
+	}
+
+	// The deadline of the run, in parallel mode, names the stage running rather than the one waiting
+	m.StageTimeouts = nil
+	m.Timeout = 10 * time.Millisecond
+	m.Mode = ExecutionModeParallel
+	err = m.Execute(context.Background())
+	if !errors.As(err, &timeout) || timeout.Stage != "scrape" || !timeout.Run || !IsTransient(err) {
+		t.Errorf("run timeout: %v", err)
+	}
+	if final.summary.Status != StatusTimedOut || final.summary.Error != "scrape stage: pipeline timed out after 10ms" {
+		t.Errorf("summary: %+v", final.summary)
+	}
+}
+
+// TestHistory records the summaries of runs and lists the latest first
+func TestHistory(t *testing.T) {
+	h := NewHistory(filepath.Join(t.TempDir(), "data", "pipeline_runs.jsonl"))
+	if runs, err := h.List(0); err != nil || len(runs) != 0 {
+		t.Fatalf("empty history: %v %v", runs, err)
+	}
+	m := NewManager(&fakeStage{name: "scrape"}, &fakeStage{name: "process", err: errors.New("no reports")})
+	m.Output = func(string) io.Writer { return io.Discard }
+	var ids []string
+	for _, command := range []string{"scrape", "process"} {
+		m.Execute(context.Background(), command)
+		id, err := h.Add(Run{Command: command, Params: map[string]string{"mode": "accumulative"}, Summary: m.Summary()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	f, _ := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"id": "cut short`)
+	f.Close()
+
+	runs, err := h.List(1)
+	if err != nil || len(runs) != 1 || runs[0].Command != "process" || runs[0].Status != StatusFailed || runs[0].Stages[0].Error != "no reports" {
+		t.Fatalf("list: %+v %v", runs, err)
+	}
+	run, err := h.Get(ids[0])
+	if err != nil || run.Status != StatusCompleted || run.Params["mode"] != "accumulative" || len(run.Stages) != 1 || run.Stages[0].Name != "scrape" {
+		t.Errorf("get: %+v %v", run, err)
+	}
+	if _, err := h.Get("19990101T000000.000000"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("unknown run: %v", err)
+	}
+}
+
+// conditionalStage is a fakeStage run only when cond holds
+type conditionalStage struct {
+	fakeStage
+	cond Condition
+}
+
+func (s *conditionalStage) ShouldRun(done Outcomes) (bool, string) { return s.cond.eval(done) }
+
+// TestConditions skips the stages whose condition doesn't hold, letting their dependents run, and
+// checks IfDownloaded and IfNewDates
+func TestConditions(t *testing.T) {
+	for _, mode := range []ExecutionMode{ExecutionModeSequential, ExecutionModeParallel} {
+		skipIndices := func(done Outcomes) (bool, string) {
+			_, ok := done.Completed("scrape")
+			return !ok, "scraped"
+		}
+		afterSkip := func(done Outcomes) (bool, string) { return done.Skipped("indices"), "" }
+		m := NewManager(
+			&fakeStage{name: "scrape"},
+			&conditionalStage{fakeStage{name: "indices", deps: []string{"scrape"}}, skipIndices},
+			&conditionalStage{fakeStage{name: "process", deps: []string{"indices"}}, afterSkip},
+			&conditionalStage{fakeStage{name: "analysis", deps: []string{"process"}}, nil},
+		)
+		m.Mode = mode
+		var log strings.Builder
+		var skipped []string
+		m.Output = func(string) io.Writer { return &log }
+		m.OnEvent = func(ev Event) {
+			if ev.Status == StatusSkipped {
+				skipped = append(skipped, ev.Stage+": "+ev.Reason)
+			}
+		}
+		if err := m.Execute(context.Background()); err != nil || log.String() != "scrape\nprocess\nanalysis\n" {
+			t.Fatalf("%s: %q %v", mode, log.String(), err)
+		}
+		if !slices.Equal(skipped, []string{"indices: scraped"}) {
+			t.Errorf("%s: skipped %q", mode, skipped)
+		}
+		if st := m.Summary().Stages[1]; st.Name != "indices" || st.Status != StatusSkipped || st.Reason != "scraped" {
+			t.Errorf("%s: summary %+v", mode, st)
+		}
+	}
+
+	scrape := &ScrapingStage{Result: &scraper.Result{Existing: 3}}
+	process := &ProcessingStage{}
+	done := Outcomes{completed: map[string]Stage{StageScrape: scrape, StageProcess: process}}
+	if run, reason := IfDownloaded(done); run || reason == "" {
+		t.Errorf("nothing downloaded: %v %q", run, reason)
+	}
+	if run, _ := IfNewDates(done); run {
+		t.Error("no dates processed ran")
+	}
+	scrape.Result.Changed = []string{"2025-01-05"}
+	process.Stats.Dates = []string{"2025-01-05"}
+	if run, _ := IfDownloaded(done); !run {
+		t.Error("changed report skipped")
+	}
+	if run, _ := IfNewDates(done); !run {
+		t.Error("new date skipped")
+	}
+	if run, _ := IfNewDates(Outcomes{skipped: map[string]bool{StageProcess: true}}); run {
+		t.Error("skipped processing ran")
+	}
+	if run, _ := IfDownloaded(Outcomes{}); !run {
+		t.Error("run without a scrape skipped")
+	}
+}
+
+// weightedStage is a fakeStage of a weight
+type weightedStage struct {
+	fakeStage
+	weight float64
+}
+
+func (s *weightedStage) Weight() float64 { return s.weight }
+
+// TestProgress aggregates the progress the stages report, weighted, into the percent of the run
+func TestProgress(t *testing.T) {
+	report := func(fractions ...float64) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			for _, f := range fractions {
+				ReportProgress(ctx, f)
+			}
+			return nil
+		}
+	}
+	m := NewManager(
+		&weightedStage{fakeStage{name: "scrape", run: report(0.5, 0.2, 0.501)}, 3},
+		&conditionalStage{fakeStage{name: "indices"}, func(Outcomes) (bool, string) { return false, "" }},
+		&fakeStage{name: "process", deps: []string{"scrape"}, run: report(0.5)},
+	)
+	m.Output = func(string) io.Writer { return io.Discard }
+	var got []string
+	m.OnProgress = func(p Progress) { got = append(got, fmt.Sprintf("%s %g %g", p.Stage, p.Fraction, p.Percent)) }
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// A decrease and a change within a whole percent aren't reported
+	want := []string{" 0 0", "scrape 0.5 30", "scrape 1 60", "indices 1 80", "process 0.5 90", "process 1 100"}
+	if !slices.Equal(got, want) {
+		t.Errorf("progress %q, want %q", got, want)
+	}
+	ReportProgress(context.Background(), 0.5) // outside a run
+}
+
+// TestConfig loads a pipelines.yaml and builds its pipeline with the stage factories, the
+// retries, timeouts and conditions of the file replacing those of the stages
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pipelines.yaml")
+	if c, err := LoadConfig(path); err != nil || len(c.Pipelines) != 0 {
+		t.Fatalf("missing file: %+v %v", c, err)
+	}
+	yaml := `
+pipelines:
+  - name: nightly
+    mode: parallel
+    timeout: 2h
+    stages:
+      - stage: fetch
+        params: {mode: accumulative}
+        retry: {attempts: 2, backoff: linear, delay: 1s}
+        timeout: 5m
+      - stage: export
+        name: export
+        after: [fetch]
+        if: downloaded
+        run: [echo, exported]
+schedules:
+  - name: evening
+    cron: "0 18 * * SUN-THU"
+    pipeline: nightly
+    timeout: 1h
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Schedules) != 1 || c.Schedules[0].Pipeline != "nightly" || time.Duration(c.Schedules[0].Timeout) != time.Hour {
+		t.Errorf("schedules: %+v", c.Schedules)
+	}
+	p, ok := c.Pipeline("nightly")
+	if !ok {
+		t.Fatal("pipeline nightly not found")
+	}
+
+	var params map[string]string
+	factories := map[string]StageFactory{
+		"fetch": func(c StageConfig) (Stage, error) {
+			params = c.Params
+			return &retryStage{fakeStage: fakeStage{name: "fetch"}, retry: RetryConfig{MaxAttempts: 5}}, nil
+		},
+	}
+	if _, err := p.Build(factories); err == nil || !strings.Contains(err.Error(), "unknown stage \"export\"") {
+		t.Errorf("unknown kind: %v", err)
+	}
+	p.Stages[1].Stage = StageCommand
+	m, err := p.Build(factories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params["mode"] != "accumulative" || m.Mode != ExecutionModeParallel || m.Timeout != 2*time.Hour || m.StageTimeouts["fetch"] != 5*time.Minute {
+		t.Errorf("manager: %+v, params %v", m, params)
+	}
+	if r := m.Retries["fetch"]; r.MaxAttempts != 2 || r.Backoff != BackoffLinear || r.Delay != time.Second {
+		t.Errorf("retry: %+v", r)
+	}
+	if m.Conditions["export"] == nil || !slices.Equal(m.Stages(), []string{"fetch", "export"}) {
+		t.Errorf("stages %v, conditions %v", m.Stages(), m.Conditions)
+	}
+
+	var log strings.Builder
+	m.Output = func(string) io.Writer { return &log }
+	if err := m.Execute(context.Background()); err != nil || log.String() != "exported\n" {
+		t.Errorf("run: %q %v", log.String(), err)
+	}
+
+	p.Stages[1].If = "sometimes"
+	if _, err := p.Build(factories); err == nil {
+		t.Error("expected an error for an unknown condition")
+	}
+	if err := os.WriteFile(path, []byte("pipelines:\n  - name: a\n    stagse: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected an error for a misspelt key")
+	}
+}
+
+// artifactStage is a fakeStage reading in and writing out
+type artifactStage struct {
+	fakeStage
+	in  []Artifact
+	out map[Artifact]string
+}
+
+func (s *artifactStage) Inputs() []Artifact { return s.in }
+
+func (s *artifactStage) Outputs() map[Artifact]string { return s.out }
+
+// TestArtifacts runs the consumers of artifacts after their producers, handing them the paths,
+// including to command stages through their environment
+func TestArtifacts(t *testing.T) {
+	var got string
+	upload := &artifactStage{fakeStage: fakeStage{name: "upload"}, in: []Artifact{ArtifactCombinedCSV, "missing"}}
+	upload.run = func(ctx context.Context) error {
+		if _, ok := Input(ctx, "missing"); ok {
+			return errors.New("input nobody produces")
+		}
+		got, _ = Input(ctx, ArtifactCombinedCSV)
+		return nil
+	}
+	m := NewManager(
+		upload,
+		&artifactStage{fakeStage: fakeStage{name: "process"}, out: map[Artifact]string{ArtifactCombinedCSV: "reports/isx_combined_data.csv"}},
+		&CommandStage{StageName: "echo", Command: []string{"sh", "-c", "echo $" + ArtifactEnv(ArtifactCombinedCSV)}, Needs: []Artifact{ArtifactCombinedCSV}},
+	)
+	var log strings.Builder
+	m.Output = func(string) io.Writer { return &log }
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "process\nupload\nreports/isx_combined_data.csv\n"; log.String() != want || got != "reports/isx_combined_data.csv" {
+		t.Errorf("log %q, input %q", log.String(), got)
+	}
+
+	plan, err := m.Plan(context.Background())
+	if err != nil || !slices.Equal(plan.Stages[1].DependsOn, []string{"process"}) || len(plan.Stages[0].Outputs) != 1 {
+		t.Errorf("plan: %+v %v", plan, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a second producer of the combined CSV")
+		}
+	}()
+	m.Register(&artifactStage{fakeStage: fakeStage{name: "reprocess"}, out: map[Artifact]string{ArtifactCombinedCSV: "x.csv"}})
+}
+
+// limitedStage is a fakeStage using resources
+type limitedStage struct {
+	fakeStage
+	resources map[Resource]int
+}
+
+func (s *limitedStage) Resources() map[Resource]int { return s.resources }
+
+// TestLimiter caps the resources the stages of managers sharing a Limiter hold at once
+func TestLimiter(t *testing.T) {
+	if _, err := NewLimiter(map[Resource]int{ResourceChrome: -1}); err == nil {
+		t.Error("expected an error for a negative limit")
+	}
+	if _, ok := Granted(context.Background(), ResourceExcel); ok {
+		t.Error("granted a resource without a Limiter")
+	}
+	limiter, err := NewLimiter(map[Resource]int{ResourceChrome: 1, ResourceExcel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	running, most := 0, 0
+	scrape := func(ctx context.Context) error {
+		if n, ok := Granted(ctx, ResourceChrome); !ok || n != 1 {
+			return fmt.Errorf("granted %d chrome", n)
+		}
+		if _, ok := Granted(ctx, ResourceDiskIO); ok {
+			return errors.New("granted an unlimited resource")
+		}
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	var wg sync.WaitGroup
+	var logs [3]strings.Builder
+	for i := range logs {
+		m := NewManager(&limitedStage{fakeStage{name: "scrape", run: scrape}, map[Resource]int{ResourceChrome: 1, ResourceDiskIO: 8}})
+		m.Limiter = limiter
+		m.Output = func(string) io.Writer { return &logs[i] }
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Execute(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	waited := 0
+	for i := range logs {
+		if strings.Contains(logs[i].String(), "Waiting for 1 chrome, 8 disk_io held by other stages") {
+			waited++
+		}
+	}
+	if most != 1 || waited == 0 {
+		t.Errorf("%d scrapes at once, %d waited", most, waited)
+	}
+
+	// A stage asking for more than the limit gets the limit; one waiting stops with its context
+	parse := &limitedStage{fakeStage{name: "process"}, map[Resource]int{ResourceExcel: 4}}
+	parse.run = func(ctx context.Context) error {
+		if n, _ := Granted(ctx, ResourceExcel); n != 2 {
+			return fmt.Errorf("granted %d excel", n)
+		}
+		return nil
+	}
+	m := NewManager(parse)
+	m.Limiter = limiter
+	m.Output = func(string) io.Writer { return io.Discard }
+	if err := m.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	grant, _ := limiter.acquire(context.Background(), map[Resource]int{ResourceExcel: 2}, nil)
+	m.Timeout = 20 * time.Millisecond
+	var timeout *TimeoutError
+	if err := m.Execute(context.Background()); !errors.As(err, &timeout) || timeout.Stage != "process" {
+		t.Errorf("waiting past the deadline: %v", err)
+	}
+	limiter.release(grant)
+}
+
+type countedStage struct {
+	fakeStage
+	files, records int
+}
+
+func (s *countedStage) Counts() (files, records int) { return s.files, s.records }
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	process := &countedStage{fakeStage: fakeStage{name: "process"}, files: 3, records: 600}
+	process.run = func(context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	analysis := &fakeStage{name: "analysis", deps: []string{"process"}, err: errors.New("broken")}
+	m := NewManager(process, analysis)
+	m.Output = func(string) io.Writer { return io.Discard }
+	m.Metrics = metrics
+	m.Execute(context.Background())
+	analysis.err = nil
+	m.Execute(context.Background())
+
+	snap := metrics.Snapshot()
+	if snap.Runs[StatusFailed] != 1 || snap.Runs[StatusCompleted] != 1 {
+		t.Errorf("runs %v", snap.Runs)
+	}
+	p := snap.Stages["process"]
+	if p.Runs[StatusCompleted] != 2 || p.Files != 6 || p.Records != 1200 || p.Failures != 0 {
+		t.Errorf("process %+v", p)
+	}
+	if p.Seconds < 0.04 || p.RecordsPerSecond <= 0 || p.RecordsPerSecond > 1200/0.04 {
+		t.Errorf("process took %gs at %g records/s", p.Seconds, p.RecordsPerSecond)
+	}
+	if a := snap.Stages["analysis"]; a.Failures != 1 || a.Runs[StatusFailed] != 1 || a.Files != 0 {
+		t.Errorf("analysis %+v", a)
+	}
+
+	var out strings.Builder
+	if err := metrics.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE isx_pipeline_runs_total counter",
+		`isx_pipeline_runs_total{status="failed"} 1`,
+		`isx_pipeline_stage_runs_total{stage="analysis",status="completed"} 1`,
+		`isx_pipeline_stage_failures_total{stage="analysis"} 1`,
+		`isx_pipeline_stage_records_total{stage="process"} 1200`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing %s in\n%s", line, out.String())
+		}
+	}
+}
+
+type processedStage struct {
+	fakeStage
+	dates []string
+}
+
+func (s *processedStage) Summarize() map[string]any { return map[string]any{"dates": s.dates} }
+
+func TestEmail(t *testing.T) {
+	t.Setenv(SMTPHostEnvVar, "")
+	if _, ok, err := SMTPFromEnv(); ok || err != nil {
+		t.Errorf("unset SMTP configured: %v, %v", ok, err)
+	}
+	t.Setenv(SMTPHostEnvVar, "smtp.example.com")
+	t.Setenv(SMTPToEnvVar, "a@example.com, b@example.com")
+	t.Setenv(SMTPPortEnvVar, "25")
+	t.Setenv(SMTPUsernameEnvVar, "isx@example.com")
+	smtpConfig, ok, err := SMTPFromEnv()
+	if !ok || err != nil || smtpConfig.Port != 25 || smtpConfig.From != "isx@example.com" || len(smtpConfig.To) != 2 {
+		t.Fatalf("SMTP %+v, %v, %v", smtpConfig, ok, err)
+	}
+	t.Setenv(SMTPPortEnvVar, "smtp")
+	if _, _, err := SMTPFromEnv(); err == nil {
+		t.Error("expected an error for an invalid port")
+	}
+
+	dir := t.TempDir()
+	csv := "Date,Ticker,CompanyName,ClosePrice,Volume,TradingStatus\n" +
+		"2025-03-01,BBOB,Bank of Baghdad,1.00,100,true\n2025-03-02,BBOB,Bank of Baghdad,1.10,100,true\n" +
+		"2025-03-01,TASC,Asia Cell,2.00,100,true\n2025-03-02,TASC,Asia Cell,1.80,100,true\n"
+	if err := os.WriteFile(filepath.Join(dir, "isx_combined_data.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var sent string
+	email := &EmailStage{SMTP: smtpConfig, Dir: dir}
+	email.Send = func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:25" || from != "isx@example.com" || len(to) != 2 {
+			return fmt.Errorf("sent to %s from %s", addr, from)
+		}
+		sent = string(msg)
+		return nil
+	}
+	process := &processedStage{fakeStage{name: StageProcess}, []string{"2025-03-02"}}
+	m := NewManager(process, &fakeStage{name: "analysis", err: errors.New("broken")}, email)
+	m.Output = func(string) io.Writer { return io.Discard }
+	if err := m.Execute(context.Background()); err == nil {
+		t.Fatal("expected the failure of analysis")
+	}
+	for _, want := range []string{
+		"Subject: ISX pipeline failed: 1 new trading dates\r\n",
+		"New trading dates: 2025-03-02\r\n",
+		"Top gainers of 2025-03-02:\r\n  BBOB      +10.00%  close 1.100\r\n",
+		"Top losers of 2025-03-02:\r\n  TASC      -10.00%  close 1.800\r\n",
+		"Errors:\r\n",
+		"analysis: broken\r\n",
+	} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("missing %q in\n%s", want, sent)
+		}
+	}
+}
+
+func TestLineage(t *testing.T) {
+	dir, downloads := t.TempDir(), t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	write := func(path string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, "isx_combined_data.csv.gz"), start.Add(time.Minute))
+	write(filepath.Join(dir, "BBOB_trading_history.csv"), start.Add(2*time.Minute))
+	write(filepath.Join(dir, "old.csv"), start.Add(-time.Hour))
+
+	lineage := NewLineage(filepath.Join(t.TempDir(), "data", "lineage.json"))
+	run := Run{ID: "run1", Command: "process", Summary: Summary{Started: start, Finished: start.Add(5 * time.Minute)}}
+	stages := map[string]string{filepath.Join(dir, "isx_combined_data.csv"): StageProcess}
+	if err := lineage.Record(run, dir, stages); err != nil {
+		t.Fatal(err)
+	}
+	files, err := lineage.Files(downloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["isx_combined_data.csv"].Stage != StageProcess || files["BBOB_trading_history.csv"].Run != "run1" {
+		t.Fatalf("lineage %+v", files)
+	}
+	if files["isx_combined_data.csv"].Stale {
+		t.Error("stale without downloads")
+	}
+
+	// A report downloaded after the run makes its files stale; a later run replaces their lineage
+	write(filepath.Join(downloads, "2025 03 02 ISX Daily Report.xlsx"), start.Add(10*time.Minute))
+	if files, _ = lineage.Files(downloads); !files["isx_combined_data.csv"].Stale {
+		t.Error("not stale after a download")
+	}
+	write(filepath.Join(dir, "BBOB_trading_history.csv"), start.Add(20*time.Minute))
+	os.Remove(filepath.Join(dir, "isx_combined_data.csv.gz"))
+	run = Run{ID: "run2", Command: "schedule:evening", Summary: Summary{Started: start.Add(15 * time.Minute), Finished: start.Add(25 * time.Minute)}}
+	if err := lineage.Record(run, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	files, _ = lineage.Files(downloads)
+	if _, ok := files["isx_combined_data.csv"]; ok {
+		t.Error("removed file kept")
+	}
+	if f := files["BBOB_trading_history.csv"]; f.Run != "run2" || f.Stale {
+		t.Errorf("ticker file %+v", f)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	downloads := t.TempDir()
+	detector := NewChangeDetector(downloads, filepath.Join(t.TempDir(), "data", "state.json"))
+	processed := 0
+	process := &artifactStage{fakeStage: fakeStage{name: StageProcess}, in: []Artifact{ArtifactReports}}
+	process.run = func(context.Context) error {
+		processed++
+		return nil
+	}
+	var skipped []string
+	m := NewManager(process, &conditionalStage{fakeStage{name: StageAnalysis, deps: []string{StageProcess}}, IfNewDates})
+	m.Changes = detector
+	m.Output = func(string) io.Writer { return io.Discard }
+	m.OnEvent = func(ev Event) {
+		if ev.Status == StatusSkipped {
+			skipped = append(skipped, ev.Stage+": "+ev.Reason)
+		}
+	}
+	execute := func() {
+		t.Helper()
+		skipped = nil
+		if err := m.Execute(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing recorded yet, then nothing changed
+	execute()
+	execute()
+	if processed != 1 || !slices.Equal(skipped, []string{"process: " + ReasonUnchanged, "analysis: processing was skipped"}) {
+		t.Fatalf("processed %d times, skipped %v", processed, skipped)
+	}
+
+	// A new report, and a republished one, are processed
+	report := filepath.Join(downloads, "2025 03 02 ISX Daily Report.xlsx")
+	if err := os.WriteFile(report, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	execute()
+	if err := os.WriteFile(report, []byte("v2 republished"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	execute()
+	if processed != 3 {
+		t.Errorf("processed %d times", processed)
+	}
+
+	// A failed run doesn't record the downloads, so the next one processes them again
+	os.WriteFile(filepath.Join(downloads, "2025 03 03 ISX Daily Report.xlsx"), nil, 0o644)
+	process.err = errors.New("broken")
+	if err := m.Execute(context.Background()); err == nil {
+		t.Fatal("expected the failure of process")
+	}
+	process.err = nil
+	execute()
+	if processed != 5 {
+		t.Errorf("processed %d times", processed)
+	}
+
+	// A run of another stage consuming the downloads doesn't record them as processed
+	os.WriteFile(filepath.Join(downloads, "2025 03 04 ISX Daily Report.xlsx"), nil, 0o644)
+	indices := &artifactStage{fakeStage: fakeStage{name: StageIndices}, in: []Artifact{ArtifactReports}}
+	only := NewManager(indices)
+	only.Changes = detector
+	only.Output = m.Output
+	if err := only.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	execute()
+	if processed != 6 {
+		t.Errorf("processed %d times after a run of the indices only", processed)
+	}
+
+	// Nor does processing into another directory
+	os.WriteFile(filepath.Join(downloads, "2025 03 05 ISX Daily Report.xlsx"), nil, 0o644)
+	elsewhere := &artifactStage{fakeStage: fakeStage{name: StageProcess}, in: []Artifact{ArtifactReports},
+		out: map[Artifact]string{ArtifactCombinedCSV: filepath.Join("other", "isx_combined_data.csv")}}
+	other := NewManager(elsewhere)
+	other.Changes = detector
+	other.Output = m.Output
+	if err := other.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	execute()
+	if processed != 7 {
+		t.Errorf("processed %d times after processing into another directory", processed)
+	}
+}
+
+func TestRunLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "pipeline.lock")
+	lock := NewRunLock(path)
+	started, finish := make(chan bool), make(chan bool)
+	slow := &fakeStage{name: "process", run: func(context.Context) error {
+		started <- true
+		<-finish
+		return nil
+	}}
+	first := NewManager(slow)
+	first.Lock = lock
+	first.Output = func(string) io.Writer { return io.Discard }
+	errc := make(chan error)
+	go func() { errc <- first.Execute(context.Background()) }()
+	<-started
+
+	// A run of the same process is refused, or waits
+	second := NewManager(&fakeStage{name: "analysis"})
+	second.Lock = lock
+	second.Output = func(string) io.Writer { return io.Discard }
+	var locked *LockedError
+	if err := second.Execute(context.Background()); !errors.As(err, &locked) || !errors.Is(err, ErrLocked) || locked.PID != os.Getpid() {
+		t.Fatalf("got %v, want a *LockedError", err)
+	}
+	// So is one of another process locking the same file
+	other := NewRunLock(path)
+	if _, err := other.acquire(context.Background(), false); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v from another lock of the file", err)
+	}
+	second.WaitForLock = true
+	go func() { errc <- second.Execute(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	finish <- true
+	for range 2 {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+
+	// The lock file of a process that crashed is taken over once stale
+	os.WriteFile(path, []byte(`{"pid":1}`), 0o644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+	release, err := other.acquire(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
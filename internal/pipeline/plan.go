@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+)
+
+// Estimate is the work a stage would do, as a Planner reports it
+type Estimate struct {
+	Files       int    `json:"files"` // files the stage would download or parse
+	Description string `json:"description"`
+}
+
+// Planner is implemented by stages that can estimate their work without doing it
+type Planner interface {
+	Plan(ctx context.Context) (Estimate, error)
+}
+
+// Plan is what an Execute call would do: the stages in the order they would run, with their
+// estimated work
+type Plan struct {
+	Mode   ExecutionMode `json:"mode"`
+	Stages []StagePlan   `json:"stages"`
+}
+
+// StagePlan is one stage of a Plan
+type StagePlan struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"depends_on,omitempty"` // the planned stages it runs after
+	Finalizer bool     `json:"finalizer,omitempty"`  // runs after the others, even on failure
+	// Inputs and Outputs are the artifacts the stage reads and writes, see Consumer and Producer
+	Inputs   []Artifact          `json:"inputs,omitempty"`
+	Outputs  map[Artifact]string `json:"outputs,omitempty"`
+	Estimate *Estimate           `json:"estimate,omitempty"` // nil for stages that aren't Planners
+	Error    string              `json:"error,omitempty"`    // why the stage couldn't estimate its work
+}
+
+// Plan resolves the stages Execute(ctx, names...) would run and asks the Planner stages for an
+// estimate of their work, without running any. A stage's estimate doesn't count the work of the
+// stages before it, e.g. processing only counts the reports already downloaded.
+func (m *Manager) Plan(ctx context.Context, names ...string) (*Plan, error) {
+	ordered, finalizers, err := m.selectStages(names)
+	if err != nil {
+		return nil, err
+	}
+	mode := m.Mode
+	if mode == "" {
+		mode = ExecutionModeSequential
+	}
+	plan := &Plan{Mode: mode}
+	for _, s := range slices.Concat(ordered, finalizers) {
+		sp := StagePlan{Name: s.Name()}
+		for _, dep := range m.dependencies(s) {
+			if slices.ContainsFunc(ordered, func(o Stage) bool { return o.Name() == dep }) {
+				sp.DependsOn = append(sp.DependsOn, dep)
+			}
+		}
+		_, sp.Finalizer = s.(Finalizer)
+		sp.Inputs, sp.Outputs = inputs(s), outputs(s)
+		if p, ok := s.(Planner); ok {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if est, err := p.Plan(ctx); err != nil {
+				sp.Error = err.Error()
+			} else {
+				sp.Estimate = &est
+			}
+		}
+		plan.Stages = append(plan.Stages, sp)
+	}
+	return plan, nil
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// Weighted is implemented by stages declaring their share of the work of a run in the overall
+// Progress; a stage that isn't Weighted weighs 1
+type Weighted interface {
+	Weight() float64
+}
+
+// Progress is the overall progress of a run, as Manager.OnProgress receives it
+type Progress struct {
+	Stage    string  `json:"stage"`    // the stage whose progress changed; "" as the run starts
+	Fraction float64 `json:"fraction"` // of the work of Stage done, 0 to 1
+	Percent  float64 `json:"percent"`  // of the work of the run done, the stages weighted by Weight
+}
+
+// progressKey is the context key of the *stageProgress ReportProgress reports to
+type progressKey struct{}
+
+// ReportProgress reports that fraction, from 0 to 1, of the work of the stage running with ctx is
+// done. It does nothing outside a Manager run, e.g. in a Finalizer.
+func ReportProgress(ctx context.Context, fraction float64) {
+	if p, ok := ctx.Value(progressKey{}).(*stageProgress); ok {
+		p.tracker.report(p.stage, fraction)
+	}
+}
+
+// stageProgress is the stage a context reports progress for
+type stageProgress struct {
+	tracker *tracker
+	stage   string
+}
+
+// tracker aggregates the progress of the stages of a run into the Percent of the run. Progress
+// never goes back, e.g. when a stage is retried, and is emitted as it crosses a whole percent or
+// a stage finishes.
+type tracker struct {
+	emit func(Progress)
+
+	mu        sync.Mutex
+	weights   map[string]float64
+	fractions map[string]float64
+	total     float64
+	reported  float64 // the last Percent emitted
+}
+
+// newTracker returns the tracker of a run of stages, emitting through emit
+func newTracker(stages []Stage, emit func(Progress)) *tracker {
+	t := &tracker{emit: emit, weights: make(map[string]float64), fractions: make(map[string]float64)}
+	for _, s := range stages {
+		w := 1.0
+		if ws, ok := s.(Weighted); ok {
+			w = max(ws.Weight(), 0)
+		}
+		t.weights[s.Name()] = w
+		t.total += w
+	}
+	return t
+}
+
+// start emits the 0% of the run
+func (t *tracker) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.emit(Progress{})
+}
+
+// context returns ctx reporting the progress of s to t
+func (t *tracker) context(ctx context.Context, s Stage) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, &stageProgress{t, s.Name()})
+}
+
+// finish marks s done, completed or skipped
+func (t *tracker) finish(s Stage) {
+	if t != nil {
+		t.report(s.Name(), 1)
+	}
+}
+
+// report records fraction of stage done, emitting the Progress of the run when it changed enough
+func (t *tracker) report(stage string, fraction float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fraction = min(max(fraction, 0), 1)
+	if fraction <= t.fractions[stage] {
+		return
+	}
+	t.fractions[stage] = fraction
+	var done float64
+	for name, f := range t.fractions {
+		done += t.weights[name] * f
+	}
+	percent := 100.0
+	if t.total > 0 {
+		percent = math.Round(done*1000/t.total) / 10
+	}
+	if math.Floor(percent) == math.Floor(t.reported) && fraction < 1 {
+		return
+	}
+	t.reported = percent
+	t.emit(Progress{Stage: stage, Fraction: fraction, Percent: percent})
+}
@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Resource is a resource of the machine the stages of concurrent pipelines share
+type Resource string
+
+// Resources the stages of this package use
+const (
+	ResourceChrome Resource = "chrome"  // headless Chrome instances, one per scrape
+	ResourceExcel  Resource = "excel"   // workbooks parsed concurrently
+	ResourceDiskIO Resource = "disk_io" // output files written concurrently
+)
+
+// Limited is implemented by stages using resources a Limiter caps. The Manager reserves them
+// before each attempt, waiting while other stages hold them, and releases them after; the stage
+// reads what it got with Granted.
+type Limited interface {
+	// Resources returns the units of each resource the stage would use, e.g. its parse workers
+	Resources() map[Resource]int
+}
+
+// Limiter caps the units of each resource in use at once across the managers sharing it, e.g.
+// the pipelines of a server, so a small machine doesn't run out of memory
+type Limiter struct {
+	limits map[Resource]int
+
+	mu       sync.Mutex
+	used     map[Resource]int
+	released chan struct{} // closed and replaced whenever units are released
+}
+
+// NewLimiter returns a limiter of the resources of limits; a resource it leaves out or sets to
+// 0 is unlimited
+func NewLimiter(limits map[Resource]int) (*Limiter, error) {
+	for r, n := range limits {
+		if n < 0 {
+			return nil, fmt.Errorf("limit of %s: %d (want 0 or more)", r, n)
+		}
+	}
+	return &Limiter{limits: limits, used: make(map[Resource]int), released: make(chan struct{})}, nil
+}
+
+// grantKey is the context key of the units reserved for a stage
+type grantKey struct{}
+
+// Granted returns the units of r reserved for the stage running with ctx, false when r isn't
+// limited and the stage may use what it asked for
+func Granted(ctx context.Context, r Resource) (int, bool) {
+	grant, _ := ctx.Value(grantKey{}).(map[Resource]int) // none without a Limiter
+	n, ok := grant[r]
+	return n, ok
+}
+
+// acquire reserves the units of want, each capped at its limit, all at once so stages holding
+// some while waiting for others can't deadlock. It waits until they are free or ctx is done,
+// calling onWait first when it has to wait. The grant is nil when no resource of want is limited.
+func (l *Limiter) acquire(ctx context.Context, want map[Resource]int, onWait func()) (map[Resource]int, error) {
+	grant := make(map[Resource]int)
+	for r, n := range want {
+		if limit := l.limits[r]; limit > 0 && n > 0 {
+			grant[r] = min(n, limit)
+		}
+	}
+	if len(grant) == 0 {
+		return nil, nil
+	}
+	waited := false
+	for {
+		l.mu.Lock()
+		free := true
+		for r, n := range grant {
+			if l.used[r]+n > l.limits[r] {
+				free = false
+			}
+		}
+		if free {
+			for r, n := range grant {
+				l.used[r] += n
+			}
+			l.mu.Unlock()
+			return grant, nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		if !waited && onWait != nil {
+			onWait()
+		}
+		waited = true
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release frees the units of grant
+func (l *Limiter) release(grant map[Resource]int) {
+	if len(grant) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for r, n := range grant {
+		l.used[r] -= n
+	}
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// formatResources lists the units of resources, e.g. "1 chrome, 4 excel"
+func formatResources(resources map[Resource]int) string {
+	var units []string
+	for _, r := range slices.Sorted(maps.Keys(resources)) {
+		units = append(units, fmt.Sprintf("%d %s", resources[r], r))
+	}
+	return strings.Join(units, ", ")
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BackoffStrategy is how the wait between the attempts of a stage grows
+type BackoffStrategy string
+
+// Backoff strategies
+const (
+	BackoffConstant    BackoffStrategy = "constant"    // Delay before every retry
+	BackoffLinear      BackoffStrategy = "linear"      // Delay, 2×Delay, 3×Delay...
+	BackoffExponential BackoffStrategy = "exponential" // Delay, 2×Delay, 4×Delay...
+)
+
+// RetryConfig sets how a stage is retried after failing. The zero value never retries.
+type RetryConfig struct {
+	MaxAttempts int             // attempts in all, the first included; 0 or 1 never retries
+	Backoff     BackoffStrategy // "" is BackoffConstant
+	Delay       time.Duration   // wait before the first retry
+	MaxDelay    time.Duration   // longest wait between attempts; 0 doesn't cap it
+	// Retryable reports whether a failure may pass on another attempt; nil uses IsTransient
+	Retryable func(error) bool
+}
+
+// DefaultScrapeRetry retries a scrape through the short outages of the ISX portal: three
+// attempts, 30 seconds then a minute apart
+var DefaultScrapeRetry = RetryConfig{
+	MaxAttempts: 3,
+	Backoff:     BackoffExponential,
+	Delay:       30 * time.Second,
+	MaxDelay:    5 * time.Minute,
+}
+
+// Retrier is implemented by stages that are retried after failing
+type Retrier interface {
+	RetryConfig() RetryConfig
+}
+
+// retryConfig returns the retry config of s, the zero value when it declares none
+func retryConfig(s Stage) RetryConfig {
+	if r, ok := s.(Retrier); ok {
+		return r.RetryConfig()
+	}
+	return RetryConfig{}
+}
+
+// retryable reports whether err, failing attempt, is retried
+func (c RetryConfig) retryable(err error, attempt int) bool {
+	if attempt >= c.MaxAttempts {
+		return false
+	}
+	if c.Retryable != nil {
+		return c.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// delay returns the wait after the failed attempt, 1 for the first
+func (c RetryConfig) delay(attempt int) time.Duration {
+	d := c.Delay
+	switch c.Backoff {
+	case BackoffLinear:
+		d *= time.Duration(attempt)
+	case BackoffExponential:
+		for i := 1; i < attempt && (c.MaxDelay == 0 || d < c.MaxDelay); i++ {
+			d *= 2
+		}
+	}
+	if c.MaxDelay > 0 && d > c.MaxDelay {
+		d = c.MaxDelay
+	}
+	return d
+}
+
+// IsTransient reports whether err looks like a passing network or portal outage rather than a
+// problem another attempt would hit again: a timeout, a refused or reset connection, or a page
+// load error of the browser. Cancellation is never transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ETIMEDOUT) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// chromedp reports navigation failures as text, e.g. "page load error net::ERR_CONNECTION_RESET"
+	msg := err.Error()
+	return strings.Contains(msg, "net::ERR_") || strings.Contains(msg, "bad status: 5")
+}
@@ -0,0 +1,227 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schedule is a pipeline run triggered on a cron expression
+type Schedule struct {
+	Name string `json:"name"`
+	Cron string `json:"cron"` // see ParseCron; evaluated in the local time of the server
+	// Pipeline names the pipeline of pipelines.yaml run; "" runs the server's built-in pipeline
+	Pipeline string `json:"pipeline,omitempty"`
+	// Stages are the stages executed, all of them when empty
+	Stages []string `json:"stages,omitempty"`
+	// Args configure the run like the arguments of a web request, e.g. {"mode": "accumulative"}
+	Args map[string]string `json:"args,omitempty"`
+	// Timeout is the deadline of a run, e.g. "2h"; 0 runs without one
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// Duration is a time.Duration written in JSON as a string such as "1h30m"
+type Duration time.Duration
+
+// MarshalJSON writes d as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a string parsed with time.ParseDuration
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2h\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalYAML reads a string parsed with time.ParseDuration
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2h\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ScheduleStatus is the state of a Schedule, as the API serves it
+type ScheduleStatus struct {
+	Schedule
+	NextRun   time.Time  `json:"next_run"`
+	LastRun   *time.Time `json:"last_run,omitempty"` // start of the last run
+	LastError string     `json:"last_error,omitempty"`
+	Running   bool       `json:"running"`
+}
+
+// LoadSchedules reads a JSON array of schedules; a missing file holds none. NewScheduler checks
+// their cron expressions.
+func LoadSchedules(path string) ([]Schedule, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return schedules, nil
+}
+
+// RunFunc builds and executes the pipeline of a schedule
+type RunFunc func(ctx context.Context, s Schedule) error
+
+// Scheduler executes the pipelines of its schedules when their cron expressions fire. A schedule
+// firing while its previous run is still going is skipped.
+type Scheduler struct {
+	run RunFunc
+	// OnEvent, when set, receives the status of a schedule as each of its runs starts and ends
+	OnEvent func(ScheduleStatus)
+
+	mu      sync.Mutex
+	entries []*scheduleEntry
+	now     func() time.Time
+}
+
+// scheduleEntry is a Schedule with its parsed expression and state
+type scheduleEntry struct {
+	cron   *Cron
+	status ScheduleStatus
+}
+
+// NewScheduler returns a scheduler of schedules executing them with run
+func NewScheduler(run RunFunc, schedules ...Schedule) (*Scheduler, error) {
+	s := &Scheduler{run: run, now: time.Now}
+	names := make(map[string]bool)
+	for _, sch := range schedules {
+		if sch.Name == "" || names[sch.Name] {
+			return nil, fmt.Errorf("schedule %q needs a unique name", sch.Name)
+		}
+		names[sch.Name] = true
+		cron, err := ParseCron(sch.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", sch.Name, err)
+		}
+		s.entries = append(s.entries, &scheduleEntry{cron: cron, status: ScheduleStatus{Schedule: sch, NextRun: cron.Next(s.now())}})
+	}
+	return s, nil
+}
+
+// Status returns the state of every schedule, in the order they were given
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]ScheduleStatus, len(s.entries))
+	for i, e := range s.entries {
+		statuses[i] = e.status
+	}
+	return statuses
+}
+
+// Run fires the schedules as their next runs come until ctx is cancelled, then waits for the
+// runs in progress, which see the cancellation through their context
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		next := s.nextRun()
+		if next.IsZero() {
+			<-ctx.Done()
+			return
+		}
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for _, e := range s.due() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.execute(ctx, e)
+			}()
+		}
+	}
+}
+
+// nextRun returns the earliest next run of the schedules, the zero time when none has one
+func (s *Scheduler) nextRun() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, e := range s.entries {
+		if t := e.status.NextRun; !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
+
+// due returns the schedules whose next run has come and that aren't running, marking them
+// running, and moves the next run of every schedule that came past now
+func (s *Scheduler) due() []*scheduleEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var due []*scheduleEntry
+	for _, e := range s.entries {
+		if e.status.NextRun.IsZero() || e.status.NextRun.After(now) {
+			continue
+		}
+		e.status.NextRun = e.cron.Next(now)
+		if !e.status.Running {
+			e.status.Running = true
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+// execute runs the pipeline of a schedule marked running, recording the outcome
+func (s *Scheduler) execute(ctx context.Context, e *scheduleEntry) {
+	s.mu.Lock()
+	started := s.now()
+	e.status.LastRun = &started
+	e.status.LastError = ""
+	status := e.status
+	s.mu.Unlock()
+	s.emit(status)
+
+	err := s.run(ctx, status.Schedule)
+
+	s.mu.Lock()
+	e.status.Running = false
+	if err != nil {
+		e.status.LastError = err.Error()
+	}
+	status = e.status
+	s.mu.Unlock()
+	s.emit(status)
+}
+
+func (s *Scheduler) emit(status ScheduleStatus) {
+	if s.OnEvent != nil {
+		s.OnEvent(status)
+	}
+}
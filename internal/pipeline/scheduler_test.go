@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCronNext checks the next runs of cron expressions
+func TestCronNext(t *testing.T) {
+	// Saturday 18 October 2025, 17:30
+	from := time.Date(2025, 10, 18, 17, 30, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 10, 18, 17, 31, 0, 0, time.UTC)},
+		{"0 18 * * SUN-THU", time.Date(2025, 10, 19, 18, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2025, 10, 18, 17, 40, 0, 0, time.UTC)},
+		{"5/30 9-17 * * *", time.Date(2025, 10, 18, 17, 35, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,20 * 7", time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)}, // Sunday 19th, before the 20th
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if got := cron.Next(from); !got.Equal(c.want) {
+			t.Errorf("%s: next %v, want %v", c.expr, got, c.want)
+		}
+	}
+	for _, expr := range []string{"", "0 18 * *", "60 * * * *", "0 18 * * FRI-MON", "*/0 * * * *", "0 18 * * 8", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+// TestScheduler fires due schedules, skips one still running and records the outcome
+func TestScheduler(t *testing.T) {
+	failure := errors.New("no reports")
+	release := make(chan struct{})
+	ran := make(chan string, 4)
+	run := func(ctx context.Context, s Schedule) error {
+		ran <- s.Name
+		if s.Name == "slow" {
+			<-release
+			return nil
+		}
+		return failure
+	}
+	s, err := NewScheduler(run, Schedule{Name: "slow", Cron: "* * * * *"}, Schedule{Name: "hourly", Cron: "0 * * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 10, 18, 17, 59, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	for _, e := range s.entries {
+		e.status.NextRun = e.cron.Next(now.Add(-time.Minute))
+	}
+	var events []ScheduleStatus
+	s.OnEvent = func(st ScheduleStatus) { events = append(events, st) }
+
+	// At 17:59 only slow is due; it keeps running through 18:00, when only hourly starts
+	due := s.due()
+	if len(due) != 1 || due[0].status.Name != "slow" {
+		t.Fatalf("due at 17:59: %d", len(due))
+	}
+	done := make(chan struct{})
+	go func() { s.execute(context.Background(), due[0]); close(done) }()
+	<-ran
+	now = now.Add(time.Minute)
+	due = s.due()
+	if len(due) != 1 || due[0].status.Name != "hourly" {
+		t.Fatalf("due at 18:00: %d", len(due))
+	}
+	close(release)
+	<-done
+	s.execute(context.Background(), due[0])
+
+	status := s.Status()
+	if status[0].Running || status[0].LastError != "" || !status[0].NextRun.Equal(now.Add(time.Minute)) {
+		t.Errorf("slow: %+v", status[0])
+	}
+	if status[1].LastError != failure.Error() || !status[1].LastRun.Equal(now) || !status[1].NextRun.Equal(now.Add(time.Hour)) {
+		t.Errorf("hourly: %+v", status[1])
+	}
+	if len(events) != 4 {
+		t.Errorf("events: %+v", events)
+	}
+
+	if _, err := NewScheduler(run, Schedule{Name: "a", Cron: "0 18 * *"}); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+	if _, err := NewScheduler(run, Schedule{Name: "a", Cron: "* * * * *"}, Schedule{Name: "a", Cron: "* * * * *"}); err == nil {
+		t.Error("expected an error for a duplicate name")
+	}
+
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	os.WriteFile(path, []byte(`[{"name": "evening", "cron": "0 18 * * SUN-THU", "timeout": "2h"}]`), 0o644)
+	if schedules, err := LoadSchedules(path); err != nil || len(schedules) != 1 || time.Duration(schedules[0].Timeout) != 2*time.Hour {
+		t.Errorf("load: %+v %v", schedules, err)
+	}
+	os.WriteFile(path, []byte(`[{"name": "evening", "cron": "0 18 * * SUN-THU", "timeout": "soon"}]`), 0o644)
+	if _, err := LoadSchedules(path); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+}
@@ -0,0 +1,431 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"isxcli/internal/analytics"
+	"isxcli/internal/indices"
+	"isxcli/internal/processor"
+	"isxcli/internal/scraper"
+)
+
+// ScrapingStage downloads the daily reports from the ISX portal
+type ScrapingStage struct {
+	Options scraper.Options // Output is set to the stage's writer
+	// Retry retries a failed scrape, which resumes from its state file; see DefaultScrapeRetry
+	Retry  RetryConfig
+	Result *scraper.Result // outcome of the last run
+}
+
+// Name returns StageScrape
+func (s *ScrapingStage) Name() string { return StageScrape }
+
+// RetryConfig returns s.Retry
+func (s *ScrapingStage) RetryConfig() RetryConfig { return s.Retry }
+
+// Resources returns the Chrome instance of the scrape
+func (s *ScrapingStage) Resources() map[Resource]int { return map[Resource]int{ResourceChrome: 1} }
+
+// Outputs returns the downloads directory
+func (s *ScrapingStage) Outputs() map[Artifact]string {
+	if s.Options.OutDir == "" {
+		return nil
+	}
+	return map[Artifact]string{ArtifactReports: s.Options.OutDir}
+}
+
+// Summarize returns the reports downloaded by the last run
+func (s *ScrapingStage) Summarize() map[string]any {
+	if s.Result == nil {
+		return nil
+	}
+	return map[string]any{"downloaded": s.Result.Downloaded, "existing": s.Result.Existing, "changed": s.Result.Changed}
+}
+
+// Counts returns the reports the last run downloaded, republished ones included
+func (s *ScrapingStage) Counts() (files, records int) {
+	if s.Result == nil {
+		return 0, 0
+	}
+	return s.Result.Downloaded + len(s.Result.Changed), 0
+}
+
+// Plan estimates the reports to download from the trading days not downloaded yet, without
+// reaching the portal
+func (s *ScrapingStage) Plan(ctx context.Context) (Estimate, error) {
+	if s.Options.Mode == scraper.ModeFullHistory {
+		return Estimate{Description: "full history: the reports to download are only known on the portal"}, nil
+	}
+	dates, err := scraper.New(s.Options).PlannedDates()
+	if err != nil {
+		return Estimate{}, err
+	}
+	if len(dates) == 0 {
+		return Estimate{Description: "no reports to download"}, nil
+	}
+	return Estimate{
+		Files: len(dates),
+		Description: fmt.Sprintf("up to %d reports to download, %s to %s", len(dates),
+			dates[0].Format("2006-01-02"), dates[len(dates)-1].Format("2006-01-02")),
+	}, nil
+}
+
+// Weight returns 4: the scrape, bound by the portal, takes the longest
+func (s *ScrapingStage) Weight() float64 { return 4 }
+
+// Run scrapes the portal until done or ctx is cancelled, reporting the reports downloaded out of
+// the trading days planned as its progress
+func (s *ScrapingStage) Run(ctx context.Context, out io.Writer) error {
+	opts := s.Options
+	opts.Output = out
+	if planned, err := s.Plan(ctx); err == nil && planned.Files > 0 {
+		downloaded := 0
+		onEvent := opts.OnEvent
+		opts.OnEvent = func(ev scraper.Event) {
+			if ev.Type == scraper.EventDownload && ev.Status == "completed" {
+				downloaded++
+				ReportProgress(ctx, float64(downloaded)/float64(planned.Files))
+			}
+			if onEvent != nil {
+				onEvent(ev)
+			}
+		}
+	}
+	result, err := scraper.New(opts).Run(ctx)
+	s.Result = result
+	return err
+}
+
+// ProcessingStage turns the downloaded reports into the CSV files of the reports directory
+type ProcessingStage struct {
+	Options processor.Options // Output is set to the stage's writer
+	Retry   RetryConfig       // the zero value never retries
+	// Condition, when set, skips the stage when it doesn't hold, e.g. IfDownloaded
+	Condition Condition
+	Stats     processor.Stats // outcome of the last run
+}
+
+// Name returns StageProcess
+func (s *ProcessingStage) Name() string { return StageProcess }
+
+// RetryConfig returns s.Retry
+func (s *ProcessingStage) RetryConfig() RetryConfig { return s.Retry }
+
+// Resources returns the parse workers and the output file writers of the processing
+func (s *ProcessingStage) Resources() map[Resource]int {
+	io := s.Options.IOWorkers
+	if io <= 0 {
+		io = runtime.GOMAXPROCS(0)
+	}
+	return map[Resource]int{ResourceExcel: max(s.Options.Workers, 1), ResourceDiskIO: io}
+}
+
+// ShouldRun evaluates s.Condition
+func (s *ProcessingStage) ShouldRun(done Outcomes) (bool, string) { return s.Condition.eval(done) }
+
+// DependsOn returns the scrape, whose reports are processed, and the index extraction when the
+// processing reads its indexes.csv; otherwise the two run side by side in ExecutionModeParallel
+func (s *ProcessingStage) DependsOn() []string {
+	if s.readsIndexes() {
+		return []string{StageScrape, StageIndices}
+	}
+	return []string{StageScrape}
+}
+
+// Inputs returns the downloaded reports, and indexes.csv when the processing reads it
+func (s *ProcessingStage) Inputs() []Artifact {
+	if s.readsIndexes() {
+		return []Artifact{ArtifactReports, ArtifactIndexesCSV}
+	}
+	return []Artifact{ArtifactReports}
+}
+
+// readsIndexes reports whether the processing reads indexes.csv: the index check of the quality
+// report and the SQLite export do. The ticker summary only joins the indices when the file is
+// already there, so it doesn't wait for them.
+func (s *ProcessingStage) readsIndexes() bool {
+	return s.Options.IndexTolerance > 0 || s.Options.DB != ""
+}
+
+// Outputs returns isx_combined_data.csv
+func (s *ProcessingStage) Outputs() map[Artifact]string {
+	return map[Artifact]string{ArtifactCombinedCSV: filepath.Join(s.Options.OutDir, "isx_combined_data.csv")}
+}
+
+// Summarize returns the dates processed by the last run and the records written
+func (s *ProcessingStage) Summarize() map[string]any {
+	return map[string]any{
+		"dates":        s.Stats.Dates,
+		"failed_files": s.Stats.FailedFiles,
+		"records":      s.Stats.Records,
+		"appended":     s.Stats.Appended, // records then counts the new dates only
+	}
+}
+
+// Counts returns the reports the last run parsed and the records it wrote
+func (s *ProcessingStage) Counts() (files, records int) {
+	return s.Stats.FilesProcessed, s.Stats.Records
+}
+
+// Plan lists the downloaded reports a run would parse
+func (s *ProcessingStage) Plan(ctx context.Context) (Estimate, error) {
+	files, err := processor.Plan(s.Options)
+	if err != nil {
+		return Estimate{}, err
+	}
+	return Estimate{Files: len(files), Description: fmt.Sprintf("%d downloaded reports to parse", len(files))}, nil
+}
+
+// Weight returns 3: processing parses every new report
+func (s *ProcessingStage) Weight() float64 { return 3 }
+
+// Run processes the reports with the workers the Limiter grants, reporting the reports parsed as the first 80% of its progress and
+// writing the outputs as the rest. Processing can't be interrupted, so ctx is only checked before.
+func (s *ProcessingStage) Run(ctx context.Context, out io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	opts := s.Options
+	opts.Output = out
+	opts.OnProgress = func(parsed, total int) {
+		ReportProgress(ctx, 0.8*float64(parsed)/float64(total))
+	}
+	if n, ok := Granted(ctx, ResourceExcel); ok {
+		opts.Workers = n
+	}
+	if n, ok := Granted(ctx, ResourceDiskIO); ok {
+		opts.IOWorkers = n
+	}
+	var err error
+	s.Stats, err = processor.ProcessDirectory(opts)
+	return err
+}
+
+// IndicesStage extracts the market indices of the downloaded reports into indexes.csv
+type IndicesStage struct {
+	Options indices.Options // Output is set to the stage's writer
+	Retry   RetryConfig     // the zero value never retries
+	// Condition, when set, skips the stage when it doesn't hold, e.g. IfDownloaded
+	Condition Condition
+	Stats     indices.Stats // outcome of the last run
+}
+
+// Name returns StageIndices
+func (s *IndicesStage) Name() string { return StageIndices }
+
+// RetryConfig returns s.Retry
+func (s *IndicesStage) RetryConfig() RetryConfig { return s.Retry }
+
+// Resources returns the read workers of the extraction
+func (s *IndicesStage) Resources() map[Resource]int {
+	return map[Resource]int{ResourceExcel: max(s.Options.Workers, 1)}
+}
+
+// ShouldRun evaluates s.Condition
+func (s *IndicesStage) ShouldRun(done Outcomes) (bool, string) { return s.Condition.eval(done) }
+
+// DependsOn returns the scrape, whose reports the indices are extracted from
+func (s *IndicesStage) DependsOn() []string { return []string{StageScrape} }
+
+// Inputs returns the downloaded reports
+func (s *IndicesStage) Inputs() []Artifact { return []Artifact{ArtifactReports} }
+
+// Outputs returns indexes.csv
+func (s *IndicesStage) Outputs() map[Artifact]string {
+	return map[Artifact]string{ArtifactIndexesCSV: s.Options.Out}
+}
+
+// Summarize returns the reports the last run extracted and the dates of indexes.csv
+func (s *IndicesStage) Summarize() map[string]any {
+	return map[string]any{
+		"files_processed": s.Stats.FilesProcessed,
+		"failed_files":    s.Stats.FailedFiles,
+		"points":          s.Stats.Points,
+		"mismatches":      s.Stats.Mismatches,
+	}
+}
+
+// Counts returns the reports the last run extracted the indices of, one record each
+func (s *IndicesStage) Counts() (files, records int) {
+	return s.Stats.FilesProcessed, s.Stats.FilesProcessed
+}
+
+// Plan lists the downloaded reports a run would extract the indices of
+func (s *IndicesStage) Plan(ctx context.Context) (Estimate, error) {
+	files, err := indices.Plan(s.Options)
+	if err != nil {
+		return Estimate{}, err
+	}
+	return Estimate{Files: len(files), Description: fmt.Sprintf("%d downloaded reports to extract the indices of", len(files))}, nil
+}
+
+// Run extracts the indices with the workers the Limiter grants, reporting the reports read as its
+// progress. Extraction can't be interrupted, so ctx is only checked before.
+func (s *IndicesStage) Run(ctx context.Context, out io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	opts := s.Options
+	opts.Output = out
+	opts.OnProgress = func(read, total int) {
+		ReportProgress(ctx, float64(read)/float64(total))
+	}
+	if n, ok := Granted(ctx, ResourceExcel); ok {
+		opts.Workers = n
+	}
+	var err error
+	s.Stats, err = indices.Update(opts)
+	return err
+}
+
+// AnalysisStage writes the correlation matrix of the processed data, as the correlation command
+// does, to correlation_matrix.csv and .json in Dir
+type AnalysisStage struct {
+	Dir    string // reports directory holding isx_combined_data.csv and indexes.csv
+	Window int    // trading days of daily returns the correlations cover; 0 covers all
+	Index  string // index of indexes.csv added to the matrix when present; "" adds none
+	// Condition, when set, skips the stage when it doesn't hold, e.g. IfNewDates
+	Condition Condition
+}
+
+// NewAnalysisStage returns the analysis of the reports of dir over the dashboard's default
+// 60-day window, with ISX60
+func NewAnalysisStage(dir string) *AnalysisStage {
+	return &AnalysisStage{Dir: dir, Window: 60, Index: "ISX60"}
+}
+
+// Name returns StageAnalysis
+func (s *AnalysisStage) Name() string { return StageAnalysis }
+
+// ShouldRun evaluates s.Condition
+func (s *AnalysisStage) ShouldRun(done Outcomes) (bool, string) { return s.Condition.eval(done) }
+
+// DependsOn returns the processing and index extraction, whose files are analysed
+func (s *AnalysisStage) DependsOn() []string { return []string{StageProcess, StageIndices} }
+
+// Inputs returns isx_combined_data.csv and indexes.csv
+func (s *AnalysisStage) Inputs() []Artifact {
+	return []Artifact{ArtifactCombinedCSV, ArtifactIndexesCSV}
+}
+
+// Outputs returns correlation_matrix.csv
+func (s *AnalysisStage) Outputs() map[Artifact]string {
+	return map[Artifact]string{ArtifactCorrelation: filepath.Join(s.Dir, "correlation_matrix.csv")}
+}
+
+// Run computes and saves the correlation matrix of the combined CSV and indexes.csv the run
+// produces, those of Dir when it produces none
+func (s *AnalysisStage) Run(ctx context.Context, out io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	series, err := analytics.LoadSeries(inputPath(ctx, ArtifactCombinedCSV, filepath.Join(s.Dir, "isx_combined_data.csv")))
+	if err != nil {
+		return err
+	}
+	selected, err := analytics.SelectSeries(series, nil)
+	if err != nil {
+		return err
+	}
+	// Index extraction may not have run, so the index is optional
+	if s.Index != "" {
+		indexSeries, err := analytics.LoadIndexSeries(inputPath(ctx, ArtifactIndexesCSV, filepath.Join(s.Dir, "indexes.csv")))
+		if ix, ok := indexSeries[s.Index]; err == nil && ok {
+			selected = append(selected, ix)
+		} else {
+			fmt.Fprintf(out, "%s not in indexes.csv, correlating the tickers only\n", s.Index)
+		}
+	}
+
+	m := analytics.Correlation(selected, s.Window, time.Time{})
+	base := filepath.Join(s.Dir, "correlation_matrix")
+	if err := analytics.SaveCorrelation(m, base); err != nil {
+		return err
+	}
+	if m.Window == 0 {
+		fmt.Fprintln(out, "No daily returns in the window")
+	} else {
+		fmt.Fprintf(out, "Correlated %d series over %d days from %s to %s\n", len(m.Tickers), m.Window,
+			m.From.Format("2006-01-02"), m.To.Format("2006-01-02"))
+	}
+	fmt.Fprintf(out, "Output written to: %s.csv and %s.json\n", base, base)
+	return nil
+}
+
+// inputPath returns the path of artifact a produced in the run of ctx, else fallback
+func inputPath(ctx context.Context, a Artifact, fallback string) string {
+	if path, ok := Input(ctx, a); ok {
+		return path
+	}
+	return fallback
+}
+
+// CommandStage runs an external program, e.g. an upload script, its output going to the stage's
+// log. The paths of its inputs are passed in the environment variables ArtifactEnv names.
+type CommandStage struct {
+	StageName string
+	Command   []string            // the program and its arguments
+	After     []string            // the stages it runs after
+	Dir       string              // working directory; "" is the server's
+	Needs     []Artifact          // the artifacts it reads
+	Produces  map[Artifact]string // the artifacts it writes, by path
+}
+
+// ArtifactEnv returns the environment variable passing the path of a to a CommandStage, e.g.
+// ISX_ARTIFACT_COMBINED_CSV
+func ArtifactEnv(a Artifact) string {
+	return "ISX_ARTIFACT_" + strings.ToUpper(strings.ReplaceAll(string(a), "-", "_"))
+}
+
+// NewCommandStage returns the CommandStage of c, running c.Run after c.After in the directory of
+// its "dir" param
+func NewCommandStage(c StageConfig) (*CommandStage, error) {
+	if c.Name == "" {
+		return nil, errors.New("a command stage needs a name")
+	}
+	if len(c.Run) == 0 {
+		return nil, fmt.Errorf("command stage %s has nothing to run", c.Name)
+	}
+	return &CommandStage{StageName: c.Name, Command: c.Run, After: c.After, Dir: c.Params["dir"], Needs: c.Inputs, Produces: c.Outputs}, nil
+}
+
+// Name returns s.StageName
+func (s *CommandStage) Name() string { return s.StageName }
+
+// DependsOn returns s.After
+func (s *CommandStage) DependsOn() []string { return s.After }
+
+// Inputs returns s.Needs
+func (s *CommandStage) Inputs() []Artifact { return s.Needs }
+
+// Outputs returns s.Produces
+func (s *CommandStage) Outputs() map[Artifact]string { return s.Produces }
+
+// Run runs the command until it exits or ctx is cancelled, failing when it exits non-zero
+func (s *CommandStage) Run(ctx context.Context, out io.Writer) error {
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Dir = s.Dir
+	for _, a := range s.Needs {
+		if path, ok := Input(ctx, a); ok {
+			cmd.Env = append(cmd.Env, ArtifactEnv(a)+"="+path)
+		}
+	}
+	if cmd.Env != nil {
+		cmd.Env = append(os.Environ(), cmd.Env...)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", s.Command[0], err)
+	}
+	return nil
+}
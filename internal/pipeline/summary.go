@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Summary describes a run of Manager.Execute, as Finalizer stages receive it
+type Summary struct {
+	Status   string         `json:"status"` // StatusCompleted, StatusFailed or StatusTimedOut
+	Error    string         `json:"error,omitempty"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Duration float64        `json:"duration_seconds"`
+	Stages   []StageSummary `json:"stages"` // the stages that ran or were skipped, in the order they finished
+}
+
+// StageSummary is the outcome of one stage of a run
+type StageSummary struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"` // StatusCompleted, StatusFailed, StatusTimedOut or StatusSkipped
+	Error    string  `json:"error,omitempty"`
+	Reason   string  `json:"reason,omitempty"` // why a skipped stage didn't run
+	Attempts int     `json:"attempts"`
+	Duration float64 `json:"duration_seconds"` // retry delays included
+	// Files and Records are the work of a Counter stage
+	Files   int `json:"files,omitempty"`
+	Records int `json:"records,omitempty"`
+	// Details are the figures of a Summarizer stage, e.g. the dates processed
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Summarizer is implemented by stages that describe the outcome of their last run in the Summary
+type Summarizer interface {
+	Summarize() map[string]any
+}
+
+// Finalizer is implemented by stages that run after the other stages of every Manager.Execute,
+// whether they completed or failed, e.g. to report the run. Finalize receives the Summary of the
+// run before Run is called.
+type Finalizer interface {
+	Finalize(Summary)
+}
+
+// recorder collects the outcomes of the stages of a run into a Summary. A nil recorder records
+// nothing.
+type recorder struct {
+	mu      sync.Mutex
+	started time.Time
+	stages  []StageSummary
+	done    Outcomes
+	// progress aggregates the progress of the stages when the Manager has an OnProgress
+	progress *tracker
+}
+
+func newRecorder() *recorder {
+	return &recorder{started: time.Now(), done: Outcomes{make(map[string]Stage), make(map[string]bool)}}
+}
+
+// tracker returns the progress tracker of the run, nil when there is none
+func (r *recorder) tracker() *tracker {
+	if r == nil {
+		return nil
+	}
+	return r.progress
+}
+
+// record adds the outcome of s, which failed with err unless nil
+func (r *recorder) record(s Stage, attempts int, d time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	st := StageSummary{Name: s.Name(), Status: StatusCompleted, Attempts: attempts, Duration: d.Seconds()}
+	if err != nil {
+		st.Status, st.Error = failureStatus(err), err.Error()
+	}
+	if sum, ok := s.(Summarizer); ok {
+		st.Details = sum.Summarize()
+	}
+	if c, ok := s.(Counter); ok {
+		st.Files, st.Records = c.Counts()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages = append(r.stages, st)
+	if err == nil {
+		r.done.completed[s.Name()] = s
+	}
+}
+
+// skip adds s, skipped for reason
+func (r *recorder) skip(s Stage, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stages = append(r.stages, StageSummary{Name: s.Name(), Status: StatusSkipped, Reason: reason})
+	r.done.skipped[s.Name()] = true
+}
+
+// outcomes returns the stages completed and skipped so far
+func (r *recorder) outcomes() Outcomes {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Outcomes{maps.Clone(r.done.completed), maps.Clone(r.done.skipped)}
+}
+
+// summary returns the Summary of the run, which ended with err
+func (r *recorder) summary(err error) Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	finished := time.Now()
+	s := Summary{
+		Status:   StatusCompleted,
+		Started:  r.started,
+		Finished: finished,
+		Duration: finished.Sub(r.started).Seconds(),
+		Stages:   append([]StageSummary(nil), r.stages...),
+	}
+	if err != nil {
+		s.Status, s.Error = failureStatus(err), err.Error()
+	}
+	return s
+}
+
+// failureStatus returns StatusTimedOut for a *TimeoutError, else StatusFailed
+func failureStatus(err error) string {
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return StatusTimedOut
+	}
+	return StatusFailed
+}
@@ -0,0 +1,27 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeoutError reports the stage a timeout of the Manager stopped: its StageTimeouts entry, or
+// the Timeout of the whole run. A StageError wraps it, so the message leaves the stage out.
+type TimeoutError struct {
+	Stage   string        // the stage running when the timeout expired
+	Timeout time.Duration // the expired timeout
+	Run     bool          // set for Manager.Timeout, unset for a StageTimeouts entry
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Run {
+		return fmt.Sprintf("pipeline timed out after %s", e.Timeout)
+	}
+	return fmt.Sprintf("stalled: no result within %s", e.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded, so a stalled attempt is retried as a transient failure
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"isxcli/internal/parser"
+)
+
+// loadCorporateActions reads corporate_actions.csv as written by actionRows. A missing file
+// means there are no actions.
+func loadCorporateActions(filePath string) ([]parser.CorporateAction, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var actions []parser.CorporateAction
+	for i, row := range rows {
+		if i == 0 || len(row) < 5 {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", row[0])
+		if err != nil {
+			continue
+		}
+		action := parser.CorporateAction{Date: date, CompanySymbol: row[1], Type: row[2]}
+		action.Value, _ = strconv.ParseFloat(row[3], 64)
+		action.Ratio, _ = strconv.ParseFloat(row[4], 64)
+		if len(row) > 5 {
+			action.Note = row[5]
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// adjustPrices fills in the adjusted prices of records so returns are comparable across capital
+// changes. Prices before a split or capital increase are divided by its ratio, and prices before
+// a dividend are scaled by (close - dividend) / close using the last close before it. Actions
+// take effect on the date of the report announcing them.
+func adjustPrices(records []parser.TradeRecord, actions []parser.CorporateAction) {
+	actionsBySymbol := make(map[string][]parser.CorporateAction)
+	for _, a := range actions {
+		actionsBySymbol[a.CompanySymbol] = append(actionsBySymbol[a.CompanySymbol], a)
+	}
+	bySymbol := make(map[string][]int)
+	for i, r := range records {
+		bySymbol[r.CompanySymbol] = append(bySymbol[r.CompanySymbol], i)
+	}
+
+	for symbol, idx := range bySymbol {
+		sort.SliceStable(idx, func(a, b int) bool { return records[idx[a]].Date.Before(records[idx[b]].Date) })
+		symbolActions := actionsBySymbol[symbol]
+		sort.SliceStable(symbolActions, func(a, b int) bool { return symbolActions[a].Date.Before(symbolActions[b].Date) })
+
+		// The factor of each action, which for dividends depends on the close before it
+		factors := make([]float64, len(symbolActions))
+		next := 0
+		lastClose := 0.0
+		for k, a := range symbolActions {
+			for next < len(idx) && records[idx[next]].Date.Before(a.Date) {
+				if c := records[idx[next]].ClosePrice; c > 0 {
+					lastClose = c
+				}
+				next++
+			}
+			factors[k] = actionFactor(a, lastClose)
+		}
+
+		// Walk back from the latest record, compounding the factors of the actions after it
+		factor := 1.0
+		k := len(symbolActions) - 1
+		for j := len(idx) - 1; j >= 0; j-- {
+			r := &records[idx[j]]
+			for k >= 0 && symbolActions[k].Date.After(r.Date) {
+				factor *= factors[k]
+				k--
+			}
+			r.AdjOpenPrice = r.OpenPrice * factor
+			r.AdjHighPrice = r.HighPrice * factor
+			r.AdjLowPrice = r.LowPrice * factor
+			r.AdjClosePrice = r.ClosePrice * factor
+		}
+	}
+}
+
+// actionFactor is the multiplier applied to prices before an action. close is the last close
+// before it; dividends that can't be related to a price don't adjust anything.
+func actionFactor(a parser.CorporateAction, close float64) float64 {
+	switch a.Type {
+	case parser.ActionSplit, parser.ActionCapitalIncrease:
+		if a.Ratio > 0 {
+			return 1 / a.Ratio
+		}
+	case parser.ActionDividend:
+		if close > 0 && a.Value > 0 && a.Value < close {
+			return (close - a.Value) / close
+		}
+	}
+	return 1
+}
@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"isxcli/internal/csvgz"
+	"isxcli/internal/parser"
+)
+
+// combinedHistory is what appending new reports to the combined CSV file needs to know about it,
+// so the history itself never has to be held in memory: its header, its last date and the last
+// trade of every symbol
+type combinedHistory struct {
+	Path      string // file read; the other form of the combined CSV after -compress changed
+	Header    []string
+	Records   int
+	LastDate  time.Time
+	LastTrade map[string]parser.TradeRecord
+	// LastStatus is the last trade of every symbol that carried a listing status
+	LastStatus map[string]parser.TradeRecord
+}
+
+// appendSettings are the options of a run that decide whether its output can be appended
+type appendSettings struct {
+	Combined string   // path the combined CSV is written to
+	Header   []string // header the combined CSV is written with
+	Fill     FillStrategy
+	Actions  []parser.CorporateAction
+	JSONL    string // path of the JSON Lines export, "" when none is written
+	Resample bool
+	Database bool
+}
+
+// readHistory scans the combined CSV file one row at a time
+func (r *run) readHistory(filePath string) (*combinedHistory, error) {
+	h := &combinedHistory{LastTrade: make(map[string]parser.TradeRecord), LastStatus: make(map[string]parser.TradeRecord)}
+	header, err := r.scanCombinedCSV(filePath, func(record parser.TradeRecord) {
+		h.Records++
+		if record.Date.After(h.LastDate) {
+			h.LastDate = record.Date
+		}
+		if !record.TradingStatus {
+			return
+		}
+		if last, ok := h.LastTrade[record.CompanySymbol]; !ok || !record.Date.Before(last.Date) {
+			h.LastTrade[record.CompanySymbol] = record
+		}
+		if last, ok := h.LastStatus[record.CompanySymbol]; record.ListingStatus != "" && (!ok || !record.Date.Before(last.Date)) {
+			h.LastStatus[record.CompanySymbol] = record
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.Header = header
+	h.Path, err = csvgz.Resolve(filePath)
+	return h, err
+}
+
+// appendBlocker returns why the records of files can't simply be appended after the history, or
+// "" when they can. Anything that changes rows already written needs the whole history.
+func (h *combinedHistory) appendBlocker(files []ExcelFileInfo, s appendSettings) string {
+	if h.Path != s.Combined {
+		return "it was written with another -compress setting"
+	}
+	if !slices.Equal(h.Header, s.Header) {
+		return "its columns differ from the column profile"
+	}
+	for _, f := range files {
+		if !f.Date.After(h.LastDate) {
+			return fmt.Sprintf("%s is dated within it", f.Name)
+		}
+	}
+	if s.Fill == FillInterpolate {
+		return "linear-interpolate refills the days before a new trade"
+	}
+	for _, a := range s.Actions {
+		if a.Date.After(h.LastDate) {
+			return fmt.Sprintf("the %s corporate action of %s adjusts earlier prices", a.CompanySymbol, a.Date.Format("2006-01-02"))
+		}
+	}
+	if s.JSONL != "" {
+		if _, err := os.Stat(s.JSONL); err != nil {
+			return "there is no JSON Lines export to append to"
+		}
+	}
+	if s.Resample {
+		return "-resample aggregates all of it"
+	}
+	if s.Database {
+		return "-db summarises all of it"
+	}
+	return ""
+}
+
+// fill forward-fills new records after the history on workers goroutines, starting every symbol
+// from its last trade. Only records and stale symbols dated after the history are returned.
+func (h *combinedHistory) fill(records []parser.TradeRecord, listing map[string]map[string]string, opts FillOptions, workers int) ([]parser.TradeRecord, []staleSymbol) {
+	input := h.seeds(listing)
+	// A row on the last date makes symbols that were stale by then go stale there, as they did
+	// when the history was written, instead of on the first new date
+	input = append(input, parser.TradeRecord{Date: h.LastDate})
+	input = append(input, records...)
+
+	filled, stale := forwardFillMissingData(input, listingAfter(listing, h.LastDate), opts, workers)
+
+	var result []parser.TradeRecord
+	for _, r := range filled {
+		if r.Date.After(h.LastDate) {
+			result = append(result, r)
+		}
+	}
+	var newStale []staleSymbol
+	for _, s := range stale {
+		if s.StoppedOn.After(h.LastDate) {
+			newStale = append(newStale, s)
+		}
+	}
+	return result, newStale
+}
+
+// seeds returns the last trade of every symbol with the listing status in effect on the last
+// date of the history, which is where forward-filling new dates continues from
+func (h *combinedHistory) seeds(listing map[string]map[string]string) []parser.TradeRecord {
+	var dates []string
+	for date := range listing {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	// The status is the latest of the announced changes and the statuses trades carried; a trade
+	// wins over a change announced the same day
+	lastDate := h.LastDate.Format("2006-01-02")
+	seeds := make([]parser.TradeRecord, 0, len(h.LastTrade))
+	for symbol, r := range h.LastTrade {
+		r.ListingStatus = ""
+		statusDate := ""
+		if s, ok := h.LastStatus[symbol]; ok {
+			r.ListingStatus, statusDate = s.ListingStatus, s.Date.Format("2006-01-02")
+		}
+		for _, date := range dates {
+			if date > lastDate {
+				break
+			}
+			if status, ok := listing[date][symbol]; ok && date > statusDate {
+				r.ListingStatus = status
+			}
+		}
+		seeds = append(seeds, r)
+	}
+	return seeds
+}
+
+// quality checks new records, comparing the first trade of every symbol with its last trade in
+// the history
+func (h *combinedHistory) quality(records []parser.TradeRecord, actions []parser.CorporateAction, maxJump float64) []qualityIssue {
+	input := make([]parser.TradeRecord, 0, len(h.LastTrade)+len(records))
+	for _, r := range h.LastTrade {
+		input = append(input, r)
+	}
+	input = append(input, records...)
+
+	var issues []qualityIssue
+	for _, issue := range checkDataQuality(input, actions, maxJump) {
+		if issue.Date.After(h.LastDate) {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// listingAfter returns the listing changes (date -> symbol -> status) dated after date; the ones
+// before are already reflected in the seeds
+func listingAfter(listing map[string]map[string]string, date time.Time) map[string]map[string]string {
+	after := make(map[string]map[string]string)
+	for d, changes := range listing {
+		if d > date.Format("2006-01-02") {
+			after[d] = changes
+		}
+	}
+	return after
+}
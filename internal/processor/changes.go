@@ -0,0 +1,239 @@
+package processor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"isxcli/internal/csvgz"
+	"isxcli/internal/parser"
+)
+
+// Kinds of record changes
+const (
+	changeAdded   = "added"
+	changeChanged = "changed"
+	changeRemoved = "removed"
+)
+
+// ChangeCounts counts the combined file records a run added, changed and removed
+type ChangeCounts struct {
+	Added   int
+	Changed int
+	Removed int
+}
+
+// recordChange is a combined file record added, changed or removed by a run
+type recordChange struct {
+	Kind   string
+	Date   time.Time
+	Symbol string
+	Record *parser.TradeRecord // nil for removed records
+}
+
+// changeKey identifies a record of the combined file
+func changeKey(date, symbol string) string {
+	return date + "|" + symbol
+}
+
+// snapshotCombined reads the rows of a combined file keyed by date and symbol, so a rework can
+// tell which ones it changed. same reports whether the file has the current output columns; rows
+// can only be compared when it does. A missing file is an empty snapshot.
+func (r *run) snapshotCombined(filePath string) (rows map[string]string, same bool, err error) {
+	rows = make(map[string]string)
+	file, err := csvgz.Open(filePath)
+	if os.IsNotExist(err) {
+		return rows, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return rows, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	same = strings.Join(header, ",") == strings.Join(r.columns.header(), ",")
+	index := r.columns.columnIndex(header)
+	dateCol, okDate := index["Date"]
+	symbolCol, okSymbol := index["Symbol"]
+	if !okDate || !okSymbol {
+		return rows, false, nil
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, same, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if dateCol < len(row) && symbolCol < len(row) {
+			rows[changeKey(row[dateCol], row[symbolCol])] = strings.Join(row, "\x00")
+		}
+	}
+}
+
+// diffRecords compares the records a rework writes with the snapshot of the file it replaces.
+// Rows of a file with other columns can't be compared, so all of them count as changed.
+func (r *run) diffRecords(records []parser.TradeRecord, previous map[string]string, same bool) []recordChange {
+	var changes []recordChange
+	seen := make(map[string]bool, len(records))
+	for i := range records {
+		record := &records[i]
+		key := changeKey(record.Date.Format("2006-01-02"), record.CompanySymbol)
+		seen[key] = true
+		old, existed := previous[key]
+		kind := changeAdded
+		if existed {
+			if same && old == strings.Join(r.columns.row(*record), "\x00") {
+				continue
+			}
+			kind = changeChanged
+		}
+		changes = append(changes, recordChange{Kind: kind, Date: record.Date, Symbol: record.CompanySymbol, Record: record})
+	}
+
+	var removed []recordChange
+	for key := range previous {
+		if seen[key] {
+			continue
+		}
+		date, symbol, _ := strings.Cut(key, "|")
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		removed = append(removed, recordChange{Kind: changeRemoved, Date: d, Symbol: symbol})
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if !removed[i].Date.Equal(removed[j].Date) {
+			return removed[i].Date.Before(removed[j].Date)
+		}
+		return removed[i].Symbol < removed[j].Symbol
+	})
+	return append(changes, removed...)
+}
+
+// appendedChanges lists the records appended to the history, all of which are new
+func appendedChanges(records []parser.TradeRecord) []recordChange {
+	changes := make([]recordChange, len(records))
+	for i := range records {
+		changes[i] = recordChange{Kind: changeAdded, Date: records[i].Date, Symbol: records[i].CompanySymbol, Record: &records[i]}
+	}
+	return changes
+}
+
+// countChanges tallies changes by kind
+func countChanges(changes []recordChange) ChangeCounts {
+	var counts ChangeCounts
+	for _, c := range changes {
+		switch c.Kind {
+		case changeAdded:
+			counts.Added++
+		case changeChanged:
+			counts.Changed++
+		case changeRemoved:
+			counts.Removed++
+		}
+	}
+	return counts
+}
+
+// saveChangesCSV writes changes.csv: a RowChange column (added, changed or removed) followed by
+// the output columns. Removed records only carry their date and symbol.
+func (r *run) saveChangesCSV(filePath string, changes []recordChange) error {
+	file, _, err := openOutput(filePath, false)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := r.columns.header()
+	if err := writer.Write(append([]string{"RowChange"}, header...)); err != nil {
+		return err
+	}
+	index := r.columns.columnIndex(header)
+	for _, c := range changes {
+		var row []string
+		if c.Record != nil {
+			row = r.columns.row(*c.Record)
+		} else {
+			row = make([]string, len(header))
+			row[index["Date"]] = c.Date.Format("2006-01-02")
+			row[index["Symbol"]] = c.Symbol
+		}
+		if err := writer.Write(append([]string{c.Kind}, row...)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// changesJSON is the schema of changes.json
+type changesJSON struct {
+	GeneratedAt string       `json:"generated_at"` // RFC 3339
+	Added       int          `json:"added"`
+	Changed     int          `json:"changed"`
+	Removed     int          `json:"removed"`
+	Changes     []changeJSON `json:"changes"`
+}
+
+type changeJSON struct {
+	Change string      `json:"change"` // added, changed or removed
+	Date   string      `json:"date"`   // YYYY-MM-DD
+	Symbol string      `json:"symbol"`
+	Record *jsonRecord `json:"record,omitempty"` // the record as written, absent when removed
+}
+
+// saveChangesJSON writes changes.json with the same changes as changes.csv, records in the JSON
+// Lines schema
+func saveChangesJSON(filePath string, changes []recordChange, generated time.Time) error {
+	file, _, err := openOutput(filePath, false)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := countChanges(changes)
+	doc := changesJSON{
+		GeneratedAt: generated.Format(time.RFC3339),
+		Added:       counts.Added,
+		Changed:     counts.Changed,
+		Removed:     counts.Removed,
+		Changes:     make([]changeJSON, 0, len(changes)),
+	}
+	for _, c := range changes {
+		entry := changeJSON{Change: c.Kind, Date: c.Date.Format("2006-01-02"), Symbol: c.Symbol}
+		if c.Record != nil {
+			record := newJSONRecord(*c.Record)
+			entry.Record = &record
+		}
+		doc.Changes = append(doc.Changes, entry)
+	}
+
+	enc := json.NewEncoder(file)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,200 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"isxcli/internal/analytics"
+	"isxcli/internal/parser"
+)
+
+// columnProfile selects and names the columns of the combined, daily and ticker CSV files.
+// A profile file looks like
+//
+//	{"columns": ["Date", "Symbol", "ClosePrice", "Volume", "TradingStatus"],
+//	 "rename": {"ClosePrice": "close"}, "case": "snake_case"}
+//
+// Columns are the csvHeader names, in output order; an empty list keeps every column. Names not
+// renamed are converted to the case given, if any. Smart updates read the combined file back, so
+// columns left out are lost for processed dates until a -full rework.
+type columnProfile struct {
+	Columns []string          `json:"columns"`
+	Rename  map[string]string `json:"rename"`
+	Case    string            `json:"case"` // "" keeps the csvHeader names, "snake_case" lowercases them with underscores
+
+	indexes []int    // csvHeader index of every output column
+	names   []string // output name of every column
+}
+
+// requiredColumns are needed to read the combined file back on the next run
+var requiredColumns = []string{"Date", "Symbol", "TradingStatus"}
+
+// usdColumns are only written by default when an exchange-rate file is given
+var usdColumns = []string{"USDClosePrice", "USDValue", "USDMarketCap"}
+
+// defaultColumnProfile keeps every column, leaving out the USD ones unless usd is set
+func defaultColumnProfile(usd bool) *columnProfile {
+	if usd {
+		return mustColumnProfile(&columnProfile{})
+	}
+	var columns []string
+	for _, name := range csvHeader {
+		if !slices.Contains(usdColumns, name) {
+			columns = append(columns, name)
+		}
+	}
+	return mustColumnProfile(&columnProfile{Columns: columns})
+}
+
+// loadColumnProfile reads a column profile file
+func loadColumnProfile(path string) (*columnProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p columnProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func mustColumnProfile(p *columnProfile) *columnProfile {
+	if err := p.compile(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// compile resolves the selected columns and their output names
+func (p *columnProfile) compile() error {
+	if p.Case != "" && p.Case != "snake_case" {
+		return fmt.Errorf("unknown column case %q (want snake_case)", p.Case)
+	}
+	position := make(map[string]int, len(csvHeader))
+	for i, name := range csvHeader {
+		position[name] = i
+	}
+	for name := range p.Rename {
+		if _, ok := position[name]; !ok {
+			return fmt.Errorf("unknown column %q in rename", name)
+		}
+	}
+
+	columns := p.Columns
+	if len(columns) == 0 {
+		columns = csvHeader
+	}
+	p.indexes, p.names = nil, nil
+	seen := make(map[string]bool)
+	for _, name := range columns {
+		i, ok := position[name]
+		if !ok {
+			return fmt.Errorf("unknown column %q (want one of %s)", name, strings.Join(csvHeader, ", "))
+		}
+		out := p.outputName(name)
+		if seen[out] {
+			return fmt.Errorf("column name %q used twice", out)
+		}
+		seen[out] = true
+		p.indexes = append(p.indexes, i)
+		p.names = append(p.names, out)
+	}
+	for _, name := range requiredColumns {
+		if !seen[p.outputName(name)] {
+			return fmt.Errorf("column %s is required to update the combined file", name)
+		}
+	}
+	return nil
+}
+
+// outputName returns the name a csvHeader column is written under
+func (p *columnProfile) outputName(name string) string {
+	if renamed, ok := p.Rename[name]; ok {
+		return renamed
+	}
+	if p.Case == "snake_case" {
+		return snakeCase(name)
+	}
+	return name
+}
+
+// header returns the header row of the output files
+func (p *columnProfile) header() []string {
+	return p.names
+}
+
+// row formats a record with the selected columns
+func (p *columnProfile) row(record parser.TradeRecord) []string {
+	full := recordRow(record)
+	row := make([]string, len(p.indexes))
+	for j, i := range p.indexes {
+		row[j] = full[i]
+	}
+	return row
+}
+
+// columnIndex maps the header of a combined file to csvHeader positions. Names of this profile,
+// csvHeader names and their snake_case forms are recognised, so files written with another
+// profile or by older versions still load.
+func (p *columnProfile) columnIndex(header []string) map[string]int {
+	byName := make(map[string]string)
+	for _, name := range csvHeader {
+		byName[name] = name
+		byName[snakeCase(name)] = name
+		byName[p.outputName(name)] = name
+	}
+	index := make(map[string]int)
+	for i, h := range header {
+		if name, ok := byName[strings.TrimSpace(h)]; ok {
+			if _, dup := index[name]; !dup {
+				index[name] = i
+			}
+		}
+	}
+	return index
+}
+
+// snakeCase converts a CamelCase column name to snake_case, keeping acronyms together:
+// USDClosePrice becomes usd_close_price and SMA10 sma10
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// indicatorColumns returns the names the indicator columns of the ticker files are written
+// under, or nil when the profile leaves out the ClosePrice they are computed from
+func (p *columnProfile) indicatorColumns() []string {
+	if !slices.Contains(p.indexes, slices.Index(csvHeader, "ClosePrice")) {
+		return nil
+	}
+	names := make([]string, len(analytics.IndicatorNames))
+	for i, name := range analytics.IndicatorNames {
+		if p.Case == "snake_case" {
+			name = snakeCase(name)
+		}
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"isxcli/internal/parser"
+)
+
+// exchangeRate is the IQD per USD rate from a date on
+type exchangeRate struct {
+	Date time.Time
+	Rate float64
+}
+
+// loadExchangeRates reads an exchange-rate CSV of date (YYYY-MM-DD) and IQD per USD rows. A
+// header row and rows without a valid date or a positive rate are skipped.
+func loadExchangeRates(filePath string) ([]exchangeRate, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", filePath, err)
+	}
+	var rates []exchangeRate
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(row[0]))
+		if err != nil {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil || rate <= 0 {
+			continue
+		}
+		rates = append(rates, exchangeRate{Date: date, Rate: rate})
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no rates in %s (want date,IQD per USD rows)", filePath)
+	}
+	sort.SliceStable(rates, func(i, j int) bool { return rates[i].Date.Before(rates[j].Date) })
+	return rates, nil
+}
+
+// rateOn returns the latest rate published on or before date, or 0 before the first one
+func rateOn(rates []exchangeRate, date time.Time) float64 {
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].Date.After(date) })
+	if i == 0 {
+		return 0
+	}
+	return rates[i-1].Rate
+}
+
+// convertToUSD fills in the USD close, value and market cap of records at the rate of their
+// date. Records dated before the first rate keep zeros, which are written as empty cells.
+func convertToUSD(records []parser.TradeRecord, rates []exchangeRate) {
+	for i := range records {
+		r := &records[i]
+		rate := rateOn(rates, r.Date)
+		if rate == 0 {
+			r.USDClosePrice, r.USDValue, r.USDMarketCap = 0, 0, 0
+			continue
+		}
+		r.USDClosePrice = r.ClosePrice / rate
+		r.USDValue = r.Value / rate
+		r.USDMarketCap = r.MarketCap / rate
+	}
+}
@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"isxcli/internal/analytics"
+	"isxcli/internal/csvgz"
+	"isxcli/internal/parser"
+)
+
+// tickerHistory is what saveTickerCSV needs from an existing ticker file to append to it
+type tickerHistory struct {
+	closes  []float64 // closes of the priced rows, in file order
+	volumes []float64 // volumes of the priced rows, 0 when the profile leaves them out
+	values  []float64 // traded values of the priced rows
+	// rows of a file written without the current indicator columns, which is rewritten with
+	// them; nil when the file already has them
+	rows   [][]string
+	priced []bool // whether each of rows has a close
+}
+
+// readTickerHistory reads the closes, volumes and values of a ticker file, and its rows when it
+// lacks the current indicator columns. Files in other columns than the output profile can't be
+// appended to.
+func (r *run) readTickerHistory(filePath string, indicatorColumns []string) (*tickerHistory, error) {
+	file, err := csvgz.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &tickerHistory{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	base := r.columns.header()
+	withIndicators := slices.Equal(header, append(slices.Clip(base), indicatorColumns...))
+	// Files of older versions have fewer indicators after the output columns
+	if !withIndicators && (len(header) < len(base) || !slices.Equal(header[:len(base)], base)) {
+		return nil, fmt.Errorf("%s has other columns than the output profile, run with -full to rewrite it", filePath)
+	}
+	index := r.columns.columnIndex(header[:len(base)])
+	number := func(row []string, name string) float64 {
+		col, ok := index[name]
+		if !ok || col >= len(row) {
+			return 0
+		}
+		v, _ := strconv.ParseFloat(row[col], 64)
+		return v
+	}
+	closeCol := index["ClosePrice"]
+
+	h := &tickerHistory{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return h, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		priced := closeCol < len(row) && row[closeCol] != ""
+		if priced {
+			h.closes = append(h.closes, number(row, "ClosePrice"))
+			h.volumes = append(h.volumes, number(row, "Volume"))
+			h.values = append(h.values, number(row, "Value"))
+		}
+		if !withIndicators {
+			h.rows = append(h.rows, row[:min(len(row), len(base))])
+			h.priced = append(h.priced, priced)
+		}
+	}
+}
+
+// priced reports whether a record has prices, unlike rows filled with the leave-blank strategy
+func priced(record parser.TradeRecord) bool {
+	return record.TradingStatus || record.ClosePrice != 0
+}
+
+// saveTickerCSV writes the records of one ticker in the output columns followed by the technical
+// indicators of their prices, appending them to an existing file when appendRows is set. The
+// indicators of appended records build on the prices already in the file.
+func (r *run) saveTickerCSV(filePath string, records []parser.TradeRecord, appendRows bool) error {
+	indicatorColumns := r.columns.indicatorColumns()
+	if indicatorColumns == nil {
+		return r.saveDailyCSV(filePath, records, appendRows)
+	}
+
+	history := &tickerHistory{}
+	if appendRows {
+		h, err := r.readTickerHistory(filePath, indicatorColumns)
+		if err == nil {
+			history = h
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	closes, volumes, values := history.closes, history.volumes, history.values
+	for _, record := range records {
+		if priced(record) {
+			closes = append(closes, record.ClosePrice)
+			volumes = append(volumes, float64(record.Volume))
+			values = append(values, record.Value)
+		}
+	}
+	indicators := analytics.ComputeIndicators(closes, volumes, values)
+	next := 0
+	cells := func(priced bool) []string {
+		if !priced {
+			return make([]string, len(indicatorColumns))
+		}
+		next++
+		return indicators[next-1].Cells()
+	}
+
+	// A file without the current indicator columns is rewritten rather than appended to
+	rewrite := history.rows != nil
+	file, fresh, err := openOutput(filePath, appendRows && !rewrite)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if fresh {
+		if err := writer.Write(append(slices.Clip(r.columns.header()), indicatorColumns...)); err != nil {
+			return err
+		}
+	}
+	if !rewrite {
+		// Appended rows follow the closes already in the file
+		next = len(history.closes)
+	}
+	for i, row := range history.rows {
+		if err := writer.Write(append(row, cells(history.priced[i])...)); err != nil {
+			return err
+		}
+	}
+	for _, record := range records {
+		if err := writer.Write(append(r.columns.row(record), cells(priced(record))...)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+
+	"isxcli/internal/parser"
+)
+
+// jsonRecord is the JSON Lines schema of a trade record. Fields are only ever added, never
+// renamed, so consumers can rely on them. Prices are null on days filled without prices.
+type jsonRecord struct {
+	Date              string   `json:"date"` // YYYY-MM-DD
+	Symbol            string   `json:"symbol"`
+	CompanyName       string   `json:"company_name"`
+	CompanyNameAr     string   `json:"company_name_ar,omitempty"`
+	Sector            string   `json:"sector,omitempty"`
+	Industry          string   `json:"industry,omitempty"`
+	Open              *float64 `json:"open"`
+	High              *float64 `json:"high"`
+	Low               *float64 `json:"low"`
+	Average           *float64 `json:"average"`
+	PrevAverage       *float64 `json:"prev_average"`
+	Close             *float64 `json:"close"`
+	PrevClose         *float64 `json:"prev_close"`
+	Change            *float64 `json:"change"`
+	ChangePercent     *float64 `json:"change_percent"`
+	NumTrades         int64    `json:"num_trades"`
+	Volume            int64    `json:"volume"`
+	Value             float64  `json:"value"`
+	Traded            bool     `json:"traded"` // false for forward-filled days
+	ForeignBuyVolume  int64    `json:"foreign_buy_volume"`
+	ForeignBuyValue   float64  `json:"foreign_buy_value"`
+	ForeignSellVolume int64    `json:"foreign_sell_volume"`
+	ForeignSellValue  float64  `json:"foreign_sell_value"`
+	SharesOutstanding int64    `json:"shares_outstanding"`
+	MarketCap         *float64 `json:"market_cap"`
+	ListingStatus     string   `json:"listing_status,omitempty"`
+	AdjOpen           *float64 `json:"adj_open"`
+	AdjHigh           *float64 `json:"adj_high"`
+	AdjLow            *float64 `json:"adj_low"`
+	AdjClose          *float64 `json:"adj_close"`
+	USDClose          *float64 `json:"usd_close,omitempty"` // omitted when no exchange rate is known
+	USDValue          *float64 `json:"usd_value,omitempty"`
+	USDMarketCap      *float64 `json:"usd_market_cap,omitempty"`
+}
+
+// newJSONRecord converts a trade record to the JSON Lines schema
+func newJSONRecord(r parser.TradeRecord) jsonRecord {
+	blank := !r.TradingStatus && r.ClosePrice == 0 // matches the empty cells of recordRow
+	price := func(v float64) *float64 {
+		if blank {
+			return nil
+		}
+		return &v
+	}
+	usd := func(v float64) *float64 {
+		if v == 0 {
+			return nil
+		}
+		return &v
+	}
+	return jsonRecord{
+		Date:              r.Date.Format("2006-01-02"),
+		Symbol:            r.CompanySymbol,
+		CompanyName:       r.CompanyName,
+		CompanyNameAr:     r.CompanyNameAr,
+		Sector:            r.Sector,
+		Industry:          r.Industry,
+		Open:              price(r.OpenPrice),
+		High:              price(r.HighPrice),
+		Low:               price(r.LowPrice),
+		Average:           price(r.AveragePrice),
+		PrevAverage:       price(r.PrevAveragePrice),
+		Close:             price(r.ClosePrice),
+		PrevClose:         price(r.PrevClosePrice),
+		Change:            price(r.Change),
+		ChangePercent:     price(r.ChangePercent),
+		NumTrades:         r.NumTrades,
+		Volume:            r.Volume,
+		Value:             r.Value,
+		Traded:            r.TradingStatus,
+		ForeignBuyVolume:  r.ForeignBuyVolume,
+		ForeignBuyValue:   r.ForeignBuyValue,
+		ForeignSellVolume: r.ForeignSellVolume,
+		ForeignSellValue:  r.ForeignSellValue,
+		SharesOutstanding: r.SharesOutstanding,
+		MarketCap:         price(r.MarketCap),
+		ListingStatus:     r.ListingStatus,
+		AdjOpen:           price(r.AdjOpenPrice),
+		AdjHigh:           price(r.AdjHighPrice),
+		AdjLow:            price(r.AdjLowPrice),
+		AdjClose:          price(r.AdjClosePrice),
+		USDClose:          usd(r.USDClosePrice),
+		USDValue:          usd(r.USDValue),
+		USDMarketCap:      usd(r.USDMarketCap),
+	}
+}
+
+// saveJSONL writes one JSON object per trade record, appending them to an existing file when
+// appendRows is set
+func saveJSONL(filePath string, records []parser.TradeRecord, appendRows bool) error {
+	file, _, err := openOutput(filePath, appendRows)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, record := range records {
+		if err := enc.Encode(newJSONRecord(record)); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"isxcli/internal/csvgz"
+)
+
+// datasetPath returns the path of the combined, daily or ticker CSV named name in dir, with .gz
+// appended when the run compresses outputs
+func (r *run) datasetPath(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if r.compress {
+		path += csvgz.Ext
+	}
+	return path
+}
+
+// outputFile is an output being written to a temporary file next to its path. Commit renames it
+// over the path, so a crash mid-write leaves the previous file intact and readers never see a
+// half-written one. Paths ending in .gz are written gzip-compressed.
+type outputFile struct {
+	*os.File
+	gz        *gzip.Writer
+	path      string
+	backup    bool // keep the replaced file as path.bak
+	committed bool
+}
+
+// openOutput starts writing filePath from scratch, or from a copy of its current content when
+// appendRows is set. fresh reports whether the output starts empty and needs a header. Appended
+// gzip output is a new gzip member after the existing ones, which readers see as one stream.
+func openOutput(filePath string, appendRows bool) (file *outputFile, fresh bool, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return nil, false, err
+	}
+	file = &outputFile{File: tmp, path: filePath}
+	if fresh, err = file.start(appendRows); err != nil {
+		file.Close()
+		return nil, false, err
+	}
+	if strings.HasSuffix(filePath, csvgz.Ext) {
+		file.gz = gzip.NewWriter(tmp)
+	}
+	return file, fresh, nil
+}
+
+// start prepares the temporary file, copying the current content of the path into it when
+// appending, and reports whether it is still empty
+func (f *outputFile) start(appendRows bool) (bool, error) {
+	// Temporary files are private; the output is read by the web servers and other tools
+	if err := f.Chmod(0644); err != nil {
+		return false, err
+	}
+	if !appendRows {
+		return true, nil
+	}
+
+	existing, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer existing.Close()
+	n, err := io.Copy(f.File, existing)
+	return n == 0, err
+}
+
+// Write writes to the output, compressing it for .gz paths
+func (f *outputFile) Write(p []byte) (int, error) {
+	if f.gz != nil {
+		return f.gz.Write(p)
+	}
+	return f.File.Write(p)
+}
+
+// Commit replaces the file at the output's path with what was written. With backup set, the
+// replaced file is kept as path.bak; it is linked rather than moved so the path always exists.
+// The other form of the output, left by a run with the other -compress setting, is removed, or
+// becomes the backup when there was nothing to replace.
+func (f *outputFile) Commit() error {
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	f.committed = true
+
+	replaced := true
+	if _, err := os.Stat(f.path); os.IsNotExist(err) {
+		replaced = false
+	}
+	if f.backup && replaced {
+		if err := backupFile(f.path); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if !strings.HasSuffix(strings.TrimSuffix(f.path, csvgz.Ext), ".csv") {
+		return nil
+	}
+	other := csvgz.Counterpart(f.path)
+	if f.backup && !replaced {
+		if err := os.Rename(other, other+".bak"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.Remove(other); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Close abandons the output unless it was committed; deferring it cleans up after errors
+func (f *outputFile) Close() error {
+	if f.committed {
+		return nil
+	}
+	f.committed = true
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// backupFile keeps the current content of path as path.bak, replacing an older backup
+func backupFile(path string) error {
+	bak := path + ".bak"
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+
+	// Filesystems without hard links get a copy
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(bak)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,1858 @@
+package processor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"isxcli/internal/analytics"
+	"isxcli/internal/csvgz"
+	"isxcli/internal/formats"
+	"isxcli/internal/indices"
+	"isxcli/internal/parser"
+	"isxcli/internal/reportfile"
+)
+
+// ExcelFileInfo holds information about an Excel file
+type ExcelFileInfo struct {
+	Name string
+	Date time.Time
+}
+
+// Options configures ProcessDirectory. Start from DefaultOptions; the zero value of a field
+// disables what it controls.
+type Options struct {
+	InDir        string // directory of the downloaded .xlsx reports
+	OutDir       string // directory the CSV files are written to
+	NameTemplate string // report filename template using {YYYY} {MM} {DD}
+	// Full reprocesses every report and rewrites the history instead of appending to it;
+	// unchanged files still come from the parse cache unless Force is set
+	Full      bool
+	Force     bool     // parse every file again, even when its content hash is unchanged
+	Streaming bool     // read workbooks row by row to keep memory low
+	Workers   int      // number of Excel files to parse concurrently
+	IOWorkers int      // number of daily and ticker files written concurrently; 0 is one per CPU
+	Layouts   string   // layout registry JSON file; "" uses the bundled layouts
+	Companies string   // company master list CSV (Symbol,Sector,Industry)
+	Columns   string   // column profile JSON for the combined, daily and ticker CSVs
+	Compress  bool     // gzip the combined, daily and ticker CSVs
+	Format    string   // "csv", or "jsonl" to also write isx_combined_data.jsonl
+	Actions   string   // corporate actions CSV; "" uses corporate_actions.csv in OutDir
+	DB        string   // SQLite database to upsert into; "" writes none
+	Rates     string   // exchange-rate CSV (date, IQD per USD) adding USD columns; "" adds none
+	Changes   bool     // write changes.csv and changes.json with the records this run added, changed or removed
+	Resample  []string // "weekly" and/or "monthly" datasets to write
+	Fill      FillOptions
+	MaxJump   float64 // percent move between trades flagged by the quality check; 0 disables
+	// IndexTolerance is the difference, in percentage points, between the ISX60 change of
+	// indexes.csv and the one the report publishes flagged by the quality check; 0 disables
+	IndexTolerance float64
+	// Volatility sets the windows of ticker_volatility.csv; a zero window leaves its metric empty
+	Volatility analytics.VolatilityOptions
+	// HistoryDays is the number of trading days in the recent history of ticker_summary.csv
+	HistoryDays int
+	// LiquidityWindows are the windows, in market sessions, of the liquidity metrics of
+	// ticker_summary.csv
+	LiquidityWindows []int
+	// BetaWindow is the number of trades the beta and relative strength against ISX60 cover
+	BetaWindow int
+	// Anomalies tunes the return z-score check of anomalies.csv
+	Anomalies analytics.AnomalyOptions
+	// FailOnQuality makes ProcessDirectory return a *QualityError when the quality check finds
+	// errors; the outputs are written either way
+	FailOnQuality bool
+	Progress      bool      // also write progress and status JSON lines for the web UI
+	Output        io.Writer // receives the processing log; nil means os.Stdout
+	// OnProgress, when set, is called as each report is parsed with the reports parsed so far
+	// and the reports to parse; calls come from the parsing workers
+	OnProgress func(parsed, total int)
+}
+
+// DefaultOptions returns the options process runs with when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		InDir:            "downloads",
+		OutDir:           "reports",
+		NameTemplate:     reportfile.DefaultPatternFromEnv(),
+		Streaming:        parser.DefaultOptions.Streaming,
+		Workers:          1,
+		Companies:        filepath.Join("data", "company_master.csv"),
+		Format:           "csv",
+		Fill:             FillOptions{Strategy: FillCarryForward},
+		MaxJump:          50,
+		IndexTolerance:   indices.DefaultTolerance,
+		Volatility:       analytics.DefaultVolatilityOptions,
+		HistoryDays:      analytics.DefaultHistoryDays,
+		LiquidityWindows: analytics.DefaultLiquidityWindows,
+		BetaWindow:       analytics.DefaultBetaWindow,
+		Anomalies:        analytics.DefaultAnomalyOptions,
+	}
+}
+
+// Stats summarises a ProcessDirectory run
+type Stats struct {
+	FilesFound     int      // reports in the input directory, one per date
+	FilesProcessed int      // reports parsed successfully in this run
+	FailedFiles    []string // reports that couldn't be parsed
+	Dates          []string // dates of the reports parsed in this run, as YYYY-MM-DD
+	// Appended is set when the new reports were appended to the history instead of rewriting it;
+	// the record counts then cover the new dates only
+	Appended      bool
+	Records       int // records written, forward-filled ones included
+	ActiveRecords int // of which actual trades
+	QualityIssues int
+	QualityErrors int
+	Changes       ChangeCounts // combined file records added, changed and removed; set with Options.Changes
+}
+
+// OptionError reports an option ProcessDirectory can't run with
+type OptionError struct {
+	Option string // Options field name
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Option, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// QualityError is returned with Options.FailOnQuality when the data quality check found errors
+type QualityError struct {
+	Errors int
+	Report string // path of data_quality_report.csv
+}
+
+func (e *QualityError) Error() string {
+	return fmt.Sprintf("%d data quality errors, see %s", e.Errors, e.Report)
+}
+
+// run holds what one ProcessDirectory or Plan call works with, so calls running at the same
+// time, e.g. from the web server and the scheduler, don't share any state
+type run struct {
+	out       io.Writer         // receives the log, shared by the workers of the run
+	progress  *progressReporter // enabled by Options.Progress
+	columns   *columnProfile    // set by Options.Columns and Options.Rates
+	compress  bool              // gzip the combined, daily and ticker CSVs, set by Options.Compress
+	ioWorkers int               // goroutines of forEach, set by Options.IOWorkers; 0 is one per CPU
+}
+
+// newRun returns the run of opts, logging to opts.Output and writing every column but the USD
+// ones unless an exchange-rate file is given
+func newRun(opts Options) *run {
+	w := opts.Output
+	if w == nil {
+		w = os.Stdout
+	}
+	out := &lockedWriter{w: w}
+	return &run{
+		out:       out,
+		progress:  &progressReporter{enabled: opts.Progress, out: out, started: make(map[string]time.Time)},
+		columns:   defaultColumnProfile(opts.Rates != ""),
+		compress:  opts.Compress,
+		ioWorkers: opts.IOWorkers,
+	}
+}
+
+// lockedWriter lets the workers of a run log to the same writer
+type lockedWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.w.Write(p)
+}
+
+func (r *run) logf(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, format, args...)
+}
+
+func (r *run) logln(args ...interface{}) {
+	fmt.Fprintln(r.out, args...)
+}
+
+// ProcessDirectory turns the reports of opts.InDir into the CSV files of opts.OutDir: new reports
+// are parsed, forward-filled, checked and written to the combined, daily and ticker files along
+// with the bonds, market summary, constituents, listing and corporate action series. Problems
+// with single files are logged and counted in Stats rather than returned.
+func ProcessDirectory(opts Options) (Stats, error) {
+	var stats Stats
+	r := newRun(opts)
+
+	nameTemplate, err := reportfile.Parse(opts.NameTemplate)
+	if err != nil {
+		return stats, &OptionError{"NameTemplate", err}
+	}
+
+	if opts.Format != "csv" && opts.Format != "jsonl" {
+		return stats, &OptionError{"Format", fmt.Errorf("%q (want csv or jsonl)", opts.Format)}
+	}
+
+	if opts.Columns != "" {
+		if r.columns, err = loadColumnProfile(opts.Columns); err != nil {
+			return stats, &OptionError{"Columns", err}
+		}
+	}
+
+	periods := map[string]func(time.Time) time.Time{}
+	for _, name := range opts.Resample {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "weekly":
+			periods["weekly"] = weekStart
+		case "monthly":
+			periods["monthly"] = monthStart
+		default:
+			return stats, &OptionError{"Resample", fmt.Errorf("%q (want weekly, monthly or both)", name)}
+		}
+	}
+
+	var rates []exchangeRate
+	if opts.Rates != "" {
+		if rates, err = loadExchangeRates(opts.Rates); err != nil {
+			return stats, &OptionError{"Rates", err}
+		}
+	}
+
+	fillOpts := opts.Fill
+	if fillOpts.Strategy == "" {
+		fillOpts.Strategy = FillCarryForward
+	}
+	if _, err := ParseFillStrategy(string(fillOpts.Strategy)); err != nil {
+		return stats, &OptionError{"Fill", err}
+	}
+
+	parseOpts := parser.Options{Streaming: opts.Streaming, Output: r.out}
+	cache := &parseCache{Cache: parser.NewCache(filepath.Join(opts.OutDir, ".parse_cache")), run: r, force: opts.Force}
+	if opts.Layouts != "" {
+		if parseOpts.Registry, err = parser.LoadRegistry(opts.Layouts); err != nil {
+			return stats, &OptionError{"Layouts", err}
+		}
+		// Reports parsed with other layouts must not be reused
+		if cache.salt, err = parser.FileHash(opts.Layouts); err != nil {
+			return stats, &OptionError{"Layouts", err}
+		}
+	}
+
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(opts.OutDir, 0755); err != nil {
+		return stats, fmt.Errorf("create output directory: %w", err)
+	}
+
+	r.logf("Starting ISX Daily Reports processing...\n")
+	r.logf("Input directory: %s\n", opts.InDir)
+	r.logf("Output directory: %s\n", opts.OutDir)
+	r.logf("Full rework: %v\n", opts.Full)
+
+	// Get all available Excel files, sorted by date
+	reports, err := nameTemplate.Find(opts.InDir)
+	if err != nil {
+		return stats, fmt.Errorf("read input dir: %w", err)
+	}
+
+	// Two files can resolve to the same date, e.g. a corrected report saved under another name
+	reports = r.dedupeReports(reports)
+
+	var excelFiles []ExcelFileInfo
+	for _, report := range reports {
+		excelFiles = append(excelFiles, ExcelFileInfo{
+			Name: report.Name,
+			Date: report.Date,
+		})
+	}
+
+	stats.FilesFound = len(excelFiles)
+	r.logf("%d Excel files discovered\n", len(excelFiles))
+
+	// Sector and industry classification for companies the reports don't classify
+	companies, err := parser.LoadCompanyMaster(opts.Companies)
+	if err != nil {
+		r.logf("Warning: Could not read company master list: %v\n", err)
+	}
+	if len(companies) > 0 {
+		r.logf("%d companies loaded from %s\n", len(companies), opts.Companies)
+	}
+
+	// Reports republished on the portal are flagged in the download manifest by the scraper
+	manifest, err := reportfile.LoadManifest(opts.InDir)
+	if err != nil {
+		r.logf("Warning: Could not read download manifest: %v\n", err)
+	}
+	reprocessDates := manifest.ReprocessDates()
+	if len(reprocessDates) > 0 {
+		r.logf("%d republished reports flagged for reprocessing\n", len(reprocessDates))
+	}
+
+	// Check what needs to be processed
+	var filesToProcess []ExcelFileInfo
+
+	if opts.Full {
+		r.logf("Full rework requested - processing all files\n")
+		filesToProcess = excelFiles
+	} else {
+		// Smart update: check what's already processed
+		filesToProcess = r.determineFilesToProcess(excelFiles, opts.OutDir, reprocessDates)
+		r.logf("Smart update: %d files need processing\n", len(filesToProcess))
+	}
+
+	// Process the required files
+	var newRecords []parser.TradeRecord
+	var newBonds []parser.BondRecord
+	var newActions []parser.CorporateAction
+	var newSummaries []parser.MarketSummary
+	var newConstituents []parser.Constituent
+	var newListing []parser.ListingChange
+	var validations []parser.Validation
+	var failedFiles []string
+	validationDir := filepath.Join(opts.OutDir, "validation")
+	totalFiles := len(filesToProcess)
+
+	// Files are parsed concurrently but merged in date order so the output doesn't depend on
+	// which worker finished first
+	r.progress.status(stageParse, "started", "parsing %d files", totalFiles)
+	results := r.parseFiles(filesToProcess, opts.InDir, parseOpts, opts.Workers, cache, manifest, opts.OnProgress)
+	r.progress.status(stageParse, "completed", "%d files parsed", totalFiles)
+	formatsChanged := false
+
+	for i, fileInfo := range filesToProcess {
+		r.logf("Processing file %d/%d: %s\n", i+1, totalFiles, fileInfo.Name)
+		r.logf("Processing: %s\n", fileInfo.Name)
+
+		report, err := results[i].report, results[i].err
+		if fp := results[i].format; fp != nil {
+			manifest.SetFingerprint(fileInfo.Name, *fp)
+			formatsChanged = true
+		}
+		if err != nil {
+			r.logf("Error parsing file %s: %v\n", fileInfo.Name, err)
+			failedFiles = append(failedFiles, fileInfo.Name)
+			continue
+		}
+
+		// Update all records with the correct date
+		for i := range report.Records {
+			report.Records[i].Date = fileInfo.Date
+		}
+		companies.Apply(report.Records)
+		stats.Dates = append(stats.Dates, fileInfo.Date.Format("2006-01-02"))
+
+		validations = append(validations, report.Validation)
+		if err := saveValidation(validationDir, report.Validation); err != nil {
+			r.logf("Warning: Could not save validation report for %s: %v\n", fileInfo.Name, err)
+		}
+
+		r.logf("%d records processed from %s (%s layout)\n", len(report.Records), fileInfo.Name, report.Layout)
+
+		// Note: Daily CSV files will be generated after forward-fill processing
+		// to ensure they include forward-filled data with proper trading status
+
+		// Add to new records
+		newRecords = append(newRecords, report.Records...)
+		for _, bond := range report.Bonds {
+			bond.Date = fileInfo.Date
+			newBonds = append(newBonds, bond)
+		}
+		report.Summary.Date = fileInfo.Date
+		newSummaries = append(newSummaries, report.Summary)
+		for _, change := range report.Listing {
+			change.Date = fileInfo.Date
+			newListing = append(newListing, change)
+		}
+		for _, c := range report.Constituents {
+			c.Date = fileInfo.Date
+			newConstituents = append(newConstituents, c)
+		}
+		for _, action := range report.Actions {
+			action.Date = fileInfo.Date
+			newActions = append(newActions, action)
+		}
+
+		// Print a few sample records
+		for i, record := range report.Records {
+			if i >= 3 { // Print up to 3 records
+				break
+			}
+			r.logf("  Symbol: %s (%s), Date: %s, Close: %.3f, Volume: %d\n",
+				record.CompanySymbol, record.CompanyName, record.Date.Format("2006-01-02"),
+				record.ClosePrice, record.Volume)
+		}
+	}
+
+	// Suspensions and delistings are kept across runs since they stop forward-filling
+	listingCSVPath := filepath.Join(opts.OutDir, "listing_status.csv")
+	if len(filesToProcess) > 0 {
+		if _, err := updateDatedCSV(listingCSVPath, listingHeader, listingRows(newListing), filesToProcess); err != nil {
+			r.logf("Error saving listing status CSV: %v\n", err)
+		}
+	}
+	listing, err := loadListingChanges(listingCSVPath)
+	if err != nil {
+		r.logf("Warning: Could not read listing status changes: %v\n", err)
+	}
+
+	// Dividends, splits and capital increases, kept across runs for adjusted prices
+	actionsCSVPath := filepath.Join(opts.OutDir, "corporate_actions.csv")
+	if len(filesToProcess) > 0 {
+		if count, err := updateDatedCSV(actionsCSVPath, actionsHeader, actionRows(newActions), filesToProcess); err != nil {
+			r.logf("Error saving corporate actions CSV: %v\n", err)
+		} else if count > 0 {
+			r.logf("Saved corporate actions: %s (%d actions)\n", actionsCSVPath, count)
+		}
+	}
+
+	if opts.Actions == "" {
+		opts.Actions = actionsCSVPath
+	}
+	actions, err := loadCorporateActions(opts.Actions)
+	if err != nil {
+		r.logf("Warning: Could not read corporate actions: %v\n", err)
+	}
+
+	// New reports are appended to the combined history, read one row at a time, unless something
+	// changes rows already written; then the whole history is loaded and written again
+	combinedCSVPath := r.datasetPath(opts.OutDir, "isx_combined_data.csv")
+	jsonlPath := filepath.Join(opts.OutDir, "isx_combined_data.jsonl")
+	var history *combinedHistory
+	var existingRecords []parser.TradeRecord
+	if !opts.Full {
+		settings := appendSettings{Combined: combinedCSVPath, Header: r.columns.header(), Fill: fillOpts.Strategy, Actions: actions, Resample: len(periods) > 0, Database: opts.DB != ""}
+		if opts.Format == "jsonl" {
+			settings.JSONL = jsonlPath
+		}
+		if h, err := r.readHistory(combinedCSVPath); err == nil {
+			if reason := h.appendBlocker(filesToProcess, settings); reason != "" {
+				r.logf("Loading the whole history: %s\n", reason)
+			} else {
+				history = h
+				r.logf("Appending to the history of %d records up to %s\n", h.Records, h.LastDate.Format("2006-01-02"))
+			}
+		} else if !os.IsNotExist(err) {
+			r.logf("Warning: Could not read existing combined CSV: %v\n", err)
+		}
+		if history == nil {
+			existingRecords = r.loadHistory(combinedCSVPath, filesToProcess)
+		}
+	}
+	appending := history != nil
+	stats.Appended = appending
+
+	// Combine existing and new records
+	allRecords := append(existingRecords, newRecords...)
+	var changes []recordChange
+
+	// Apply forward-fill and generate all output files
+	if len(allRecords) > 0 {
+		r.logf("Generating dataset with forward-fill...\n")
+		r.progress.status(stageFill, "started", "forward-filling %d records", len(allRecords))
+		var filledRecords []parser.TradeRecord
+		var stale []staleSymbol
+		if appending {
+			filledRecords, stale = history.fill(allRecords, listing, fillOpts, r.ioWorkers)
+		} else {
+			filledRecords, stale = forwardFillMissingData(allRecords, listing, fillOpts, r.ioWorkers)
+		}
+		adjustPrices(filledRecords, actions)
+		if rates != nil {
+			convertToUSD(filledRecords, rates)
+		}
+		r.progress.status(stageFill, "completed", "%d records after forward-fill", len(filledRecords))
+		if len(stale) > 0 {
+			r.logf("%d symbols stopped being forward-filled after %d days without trading\n", len(stale), fillOpts.MaxDays)
+		}
+		if err := saveStaleSymbols(validationDir, stale, appending); err != nil {
+			r.logf("Warning: Could not save stale symbols: %v\n", err)
+		}
+
+		active := 0
+		for _, record := range filledRecords {
+			if record.TradingStatus {
+				active++
+			}
+		}
+		stats.Records, stats.ActiveRecords = len(filledRecords), active
+		r.logf("%d records processed\n", len(filledRecords))
+		r.logf("%d active trading records\n", active)
+		r.logf("%d forward-filled records (%s)\n", len(filledRecords)-active, fillOpts.Strategy)
+
+		// Inconsistent prices are reported rather than dropped
+		var issues []qualityIssue
+		if appending {
+			issues = history.quality(filledRecords, actions, opts.MaxJump)
+		} else {
+			issues = checkDataQuality(filledRecords, actions, opts.MaxJump)
+			// The rewritten report keeps the index checks indexcsv adds to it
+			issues = append(issues, checkIndexChanges(filepath.Join(opts.OutDir, "indexes.csv"), opts.IndexTolerance)...)
+		}
+		stats.QualityIssues = len(issues)
+		for _, issue := range issues {
+			if issue.Severity == severityError {
+				stats.QualityErrors++
+			}
+		}
+		qualityPath := filepath.Join(opts.OutDir, "data_quality_report.csv")
+		if err := saveQualityReport(qualityPath, issues, appending); err != nil {
+			r.logf("Error saving data quality report: %v\n", err)
+		} else if len(issues) > 0 {
+			r.logf("Data quality: %d issues (%d errors), see %s\n", len(issues), stats.QualityErrors, qualityPath)
+		}
+
+		// Records this run adds or rewrites, for consumers syncing incrementally. Appended records
+		// are all new; a rewrite is compared with the file it replaces.
+		if opts.Changes {
+			if appending {
+				changes = appendedChanges(filledRecords)
+			} else if previous, same, err := r.snapshotCombined(combinedCSVPath); err != nil {
+				r.logf("Warning: Could not read the previous combined CSV, listing all records as added: %v\n", err)
+				changes = appendedChanges(filledRecords)
+			} else {
+				changes = r.diffRecords(filledRecords, previous, same)
+			}
+		}
+
+		// Save combined CSV with forward-fill
+		if err := r.saveCombinedCSV(combinedCSVPath, filledRecords, appending); err != nil {
+			r.logf("Error saving combined CSV: %v\n", err)
+		} else {
+			r.logf("Saved combined report: %s\n", combinedCSVPath)
+		}
+		if opts.Format == "jsonl" {
+			if err := saveJSONL(jsonlPath, filledRecords, appending); err != nil {
+				r.logf("Error saving JSON Lines export: %v\n", err)
+			} else {
+				r.logf("Saved JSON Lines export: %s\n", jsonlPath)
+			}
+		}
+
+		// Foreign flows only exist on days a company actually traded
+		foreignCSVPath := filepath.Join(opts.OutDir, "foreign_trading.csv")
+		if err := saveForeignTradingCSV(foreignCSVPath, allRecords, appending); err != nil {
+			r.logf("Error saving foreign trading CSV: %v\n", err)
+		} else {
+			r.logf("Saved foreign trading report: %s\n", foreignCSVPath)
+		}
+
+		// Generate daily CSV files with forward-fill
+		r.logf("Generating daily CSV files with forward-fill...\n")
+		if err := r.generateDailyFiles(filledRecords, opts.OutDir); err != nil {
+			r.logf("Error generating daily files: %v\n", err)
+		} else {
+			r.logf("Daily files generated successfully\n")
+		}
+
+		// Generate individual ticker CSV files with forward-fill
+		r.logf("Generating individual ticker CSV files with forward-fill...\n")
+		if err := r.generateTickerFiles(filledRecords, opts.OutDir, appending); err != nil {
+			r.logf("Error generating ticker files: %v\n", err)
+		} else {
+			r.logf("Ticker files generated successfully\n")
+		}
+
+		// Weekly and monthly bars are built from the actual trades, not the filled days
+		for _, name := range []string{"weekly", "monthly"} {
+			if period, ok := periods[name]; ok {
+				path := filepath.Join(opts.OutDir, "isx_"+name+"_data.csv")
+				bars := resample(filledRecords, period)
+				if err := saveResampledCSV(path, bars); err != nil {
+					r.logf("Error saving %s data: %v\n", name, err)
+				} else {
+					r.logf("Saved %s data: %s (%d bars)\n", name, path, len(bars))
+				}
+			}
+		}
+
+		if opts.DB != "" {
+			r.logf("Writing SQLite database %s...\n", opts.DB)
+			if err := saveSQLite(opts.DB, filledRecords, filepath.Join(opts.OutDir, "indexes.csv")); err != nil {
+				r.logf("Error writing SQLite database: %v\n", err)
+			} else {
+				r.logf("Saved %d records to %s\n", len(filledRecords), opts.DB)
+			}
+		}
+	}
+
+	// Written on every run, so a run without new reports leaves no stale changes behind
+	if opts.Changes {
+		stats.Changes = countChanges(changes)
+		changesCSVPath := filepath.Join(opts.OutDir, "changes.csv")
+		if err := r.saveChangesCSV(changesCSVPath, changes); err != nil {
+			r.logf("Error saving changes CSV: %v\n", err)
+		} else if err := saveChangesJSON(filepath.Join(opts.OutDir, "changes.json"), changes, time.Now()); err != nil {
+			r.logf("Error saving changes JSON: %v\n", err)
+		} else {
+			r.logf("Saved changes: %s (%d added, %d changed, %d removed)\n", changesCSVPath,
+				stats.Changes.Added, stats.Changes.Changed, stats.Changes.Removed)
+		}
+	}
+
+	// Bonds and treasury bills are kept as their own time series
+	bondsCSVPath := filepath.Join(opts.OutDir, "bonds.csv")
+	if len(filesToProcess) > 0 {
+		if count, err := updateDatedCSV(bondsCSVPath, bondsHeader, bondRows(newBonds), filesToProcess); err != nil {
+			r.logf("Error saving bonds CSV: %v\n", err)
+		} else if count > 0 {
+			r.logf("Saved bonds report: %s (%d records)\n", bondsCSVPath, count)
+		}
+	}
+
+	// Session totals, charted alongside the indices
+	summaryCSVPath := filepath.Join(opts.OutDir, "market_summary.csv")
+	if len(filesToProcess) > 0 {
+		if count, err := updateDatedCSV(summaryCSVPath, summaryHeader, summaryRows(newSummaries), filesToProcess); err != nil {
+			r.logf("Error saving market summary CSV: %v\n", err)
+		} else if count > 0 {
+			r.logf("Saved market summary: %s (%d days)\n", summaryCSVPath, count)
+		}
+	}
+
+	// Index membership by date, for contribution analytics and historical membership queries
+	constituentsCSVPath := filepath.Join(opts.OutDir, "constituents.csv")
+	if len(filesToProcess) > 0 {
+		if count, err := updateDatedCSV(constituentsCSVPath, constituentsHeader, constituentRows(newConstituents), filesToProcess); err != nil {
+			r.logf("Error saving constituents CSV: %v\n", err)
+		} else if count > 0 {
+			r.logf("Saved index constituents: %s (%d rows)\n", constituentsCSVPath, count)
+		}
+	}
+
+	if err := r.saveSkippedRows(validationDir, validations); err != nil {
+		r.logf("Warning: Could not save skipped rows log: %v\n", err)
+	}
+	r.printValidationSummary(validations, failedFiles, validationDir)
+	stats.FilesProcessed = totalFiles - len(failedFiles)
+	stats.FailedFiles = failedFiles
+
+	r.logln("Processing complete.")
+	r.progress.status(stageFinish, "completed", "%d files processed, %d failed", totalFiles-len(failedFiles), len(failedFiles))
+
+	// Clear reprocess flags for the reports handled in this run and keep the new fingerprints
+	if len(reprocessDates) > 0 || formatsChanged {
+		processed := make(map[string]bool)
+		for _, fileInfo := range filesToProcess {
+			processed[fileInfo.Date.Format("2006-01-02")] = true
+		}
+		manifest.ClearReprocess(processed)
+		if err := manifest.Save(); err != nil {
+			r.logf("Warning: Could not update download manifest: %v\n", err)
+		}
+	}
+
+	// Generate ticker summary for web interface
+	r.logln("Generating ticker summary...")
+	generator := analytics.NewSummaryGenerator(opts.OutDir)
+	generator.Volatility = opts.Volatility
+	generator.HistoryDays = opts.HistoryDays
+	generator.LiquidityWindows = opts.LiquidityWindows
+	generator.BetaWindow = opts.BetaWindow
+	generator.Anomalies = opts.Anomalies
+	if summaries, err := generator.Generate(); err != nil {
+		r.logf("Warning: Failed to generate ticker summary: %v\n", err)
+	} else {
+		r.logf("Generated ticker summary with %d tickers\n", len(summaries))
+		r.logln("Ticker summary generated successfully")
+	}
+
+	if opts.FailOnQuality && stats.QualityErrors > 0 {
+		return stats, &QualityError{Errors: stats.QualityErrors, Report: filepath.Join(opts.OutDir, "data_quality_report.csv")}
+	}
+	return stats, nil
+}
+
+// dedupeReports keeps one report per trading date, preferring the most recently modified file,
+// and logs which file was used. reports must be sorted by date.
+func (r *run) dedupeReports(reports []reportfile.File) []reportfile.File {
+	var kept []reportfile.File
+	for i := 0; i < len(reports); {
+		j := i + 1
+		for j < len(reports) && reports[j].Date.Equal(reports[i].Date) {
+			j++
+		}
+		if j-i == 1 {
+			kept = append(kept, reports[i])
+			i = j
+			continue
+		}
+
+		newest := i
+		var newestTime time.Time
+		for k := i; k < j; k++ {
+			info, err := os.Stat(reports[k].Path)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().After(newestTime) {
+				newest, newestTime = k, info.ModTime()
+			}
+		}
+		r.logf("Warning: %d reports for %s, using the newest: %s\n", j-i, reports[i].Date.Format("2006-01-02"), reports[newest].Name)
+		for k := i; k < j; k++ {
+			if k != newest {
+				r.logf("  Ignoring %s\n", reports[k].Name)
+			}
+		}
+		kept = append(kept, reports[newest])
+		i = j
+	}
+	return kept
+}
+
+// parseResult is the outcome of parsing one Excel file
+type parseResult struct {
+	report *parser.DailyReport
+	format *formats.Fingerprint // new fingerprint of the file, nil when the recorded one still holds
+	err    error
+}
+
+// parseCache reuses parsed reports of files whose content is unchanged, unless forced
+type parseCache struct {
+	*parser.Cache
+	run   *run   // logs the formats identified and the reports that couldn't be cached
+	salt  string // distinguishes reports parsed with a custom layout registry
+	force bool
+	hits  int64
+}
+
+// parse returns the cached report of a file or parses it and caches the result. The file is
+// parsed with the layout of its format fingerprint, which is taken first when known is missing
+// or stale; the new fingerprint is returned so it can be recorded.
+func (c *parseCache) parse(path string, opts parser.Options, known *formats.Fingerprint) (*parser.DailyReport, *formats.Fingerprint, error) {
+	fileHash, err := parser.FileHash(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := fileHash + c.salt
+	if !c.force {
+		if report, ok := c.Get(path, hash); ok {
+			atomic.AddInt64(&c.hits, 1)
+			return report, nil, nil
+		}
+	}
+
+	var format *formats.Fingerprint
+	if !known.Current(fileHash) {
+		fp, err := formats.Identify(path, opts)
+		if err != nil {
+			c.run.logf("Warning: Could not identify the format of %s: %v\n", filepath.Base(path), err)
+		} else {
+			c.run.logf("Format of %s: %s (%s layout, sheet %s)\n", filepath.Base(path), fp.Signature, fp.Layout, fp.Sheet)
+		}
+		format, known = &fp, &fp
+	}
+
+	report, err := parser.ParseFileWithOptions(path, known.Options(opts))
+	if err != nil && known.Layout != "" {
+		// The recorded format may not fit a registry that changed since; detect it again
+		report, err = parser.ParseFileWithOptions(path, opts)
+	}
+	if err != nil {
+		return nil, format, err
+	}
+	if err := c.Put(path, hash, report); err != nil {
+		c.run.logf("Warning: Could not cache %s: %v\n", filepath.Base(path), err)
+	}
+	return report, format, nil
+}
+
+// parseFiles parses files with up to workers goroutines, calling onProgress, when set, as each
+// file is parsed. Results are returned in the order of files.
+// Each file is parsed with the layout of the format fingerprint recorded in the manifest.
+func (r *run) parseFiles(files []ExcelFileInfo, inDir string, opts parser.Options, workers int, cache *parseCache, manifest *reportfile.Manifest, onProgress func(parsed, total int)) []parseResult {
+	results := make([]parseResult, len(files))
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers > 1 {
+		r.logf("Parsing %d files with %d workers\n", len(files), workers)
+	}
+
+	var done int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fileOpts := opts
+				fileOpts.Date = files[i].Date // as the name template tells it, whatever the template
+				report, format, err := cache.parse(filepath.Join(inDir, files[i].Name), fileOpts, manifest.Fingerprint(files[i].Name))
+				results[i] = parseResult{report: report, format: format, err: err}
+				parsed := int(atomic.AddInt64(&done, 1))
+				r.progress.step(stageParse, parsed, len(files), files[i].Name)
+				if onProgress != nil {
+					onProgress(parsed, len(files))
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if cache.hits > 0 {
+		r.logf("%d unchanged files reused from the parse cache (use -force to parse them again)\n", cache.hits)
+	}
+
+	return results
+}
+
+// Plan returns the reports of opts.InDir a ProcessDirectory run would parse, without parsing or
+// writing anything
+func Plan(opts Options) ([]ExcelFileInfo, error) {
+	opts.Output = io.Discard
+	r := newRun(opts)
+
+	nameTemplate, err := reportfile.Parse(opts.NameTemplate)
+	if err != nil {
+		return nil, &OptionError{"NameTemplate", err}
+	}
+	reports, err := nameTemplate.Find(opts.InDir)
+	if err != nil {
+		return nil, fmt.Errorf("read input dir: %w", err)
+	}
+	var excelFiles []ExcelFileInfo
+	for _, report := range r.dedupeReports(reports) {
+		excelFiles = append(excelFiles, ExcelFileInfo{Name: report.Name, Date: report.Date})
+	}
+	if opts.Full {
+		return excelFiles, nil
+	}
+	// An unreadable manifest is only warned about by ProcessDirectory
+	manifest, _ := reportfile.LoadManifest(opts.InDir)
+	return r.determineFilesToProcess(excelFiles, opts.OutDir, manifest.ReprocessDates()), nil
+}
+
+// determineFilesToProcess checks which files need to be processed based on existing CSV files.
+// Dates in reprocess (YYYY-MM-DD) are processed again even when their daily CSV exists.
+func (r *run) determineFilesToProcess(excelFiles []ExcelFileInfo, outDir string, reprocess map[string]bool) []ExcelFileInfo {
+	var filesToProcess []ExcelFileInfo
+
+	// Check which daily CSV files already exist
+	existingDates := make(map[string]bool)
+	if entries, err := ioutil.ReadDir(outDir); err == nil {
+		for _, entry := range entries {
+			name := csvgz.Name(entry.Name())
+			if strings.HasPrefix(name, "isx_daily_") && strings.HasSuffix(name, ".csv") {
+				// Extract date from filename: isx_daily_YYYY_MM_DD.csv, or .csv.gz when compressed
+				dateStr := strings.TrimPrefix(name, "isx_daily_")
+				dateStr = strings.TrimSuffix(dateStr, ".csv")
+				existingDates[dateStr] = true
+			}
+		}
+	}
+
+	r.logf("Found %d existing daily CSV files\n", len(existingDates))
+
+	// Determine which files need processing
+	for _, fileInfo := range excelFiles {
+		dateStr := fileInfo.Date.Format("2006_01_02")
+		if !existingDates[dateStr] {
+			filesToProcess = append(filesToProcess, fileInfo)
+			r.logf("  Need to process: %s (date: %s)\n", fileInfo.Name, dateStr)
+		} else if reprocess[fileInfo.Date.Format("2006-01-02")] {
+			filesToProcess = append(filesToProcess, fileInfo)
+			r.logf("  Republished, reprocessing: %s (date: %s)\n", fileInfo.Name, dateStr)
+		} else {
+			r.logf("  Already processed: %s (date: %s)\n", fileInfo.Name, dateStr)
+		}
+	}
+
+	return filesToProcess
+}
+
+// loadHistory loads the records of the combined CSV file, leaving out the dates of the files
+// being processed again
+func (r *run) loadHistory(combinedCSVPath string, filesToProcess []ExcelFileInfo) []parser.TradeRecord {
+	if !csvgz.Exists(combinedCSVPath) {
+		return nil
+	}
+
+	r.logf("Loading existing combined CSV data...\n")
+	existingRecords, err := r.loadExistingRecords(combinedCSVPath)
+	if err != nil {
+		r.logf("Warning: Could not load existing combined CSV: %v\n", err)
+		return nil
+	}
+	r.logf("Loaded %d existing records\n", len(existingRecords))
+
+	// If we have existing records but files to process, we need to filter out records for dates we're reprocessing
+	if len(existingRecords) > 0 && len(filesToProcess) > 0 {
+		r.logf("Filtering existing records to avoid duplicates...\n")
+		reprocessDates := make(map[string]bool)
+		for _, fileInfo := range filesToProcess {
+			reprocessDates[fileInfo.Date.Format("2006-01-02")] = true
+		}
+
+		var filteredRecords []parser.TradeRecord
+		for _, record := range existingRecords {
+			if !reprocessDates[record.Date.Format("2006-01-02")] {
+				filteredRecords = append(filteredRecords, record)
+			}
+		}
+		existingRecords = filteredRecords
+		r.logf("Filtered to %d existing records (removed reprocessing dates)\n", len(existingRecords))
+	}
+
+	return existingRecords
+}
+
+// loadExistingRecords loads records from an existing combined CSV file
+func (r *run) loadExistingRecords(filePath string) ([]parser.TradeRecord, error) {
+	var records []parser.TradeRecord
+	_, err := r.scanCombinedCSV(filePath, func(record parser.TradeRecord) {
+		records = append(records, record)
+	})
+	return records, err
+}
+
+// scanCombinedCSV reads a combined CSV file, compressed or not, row by row, calling fn for every
+// well-formed record, and returns its header. Only one row is held in memory at a time.
+func (r *run) scanCombinedCSV(filePath string, fn func(parser.TradeRecord)) ([]string, error) {
+	file, err := csvgz.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	row, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := append([]string(nil), row...)
+
+	// Columns are found by name since the file may have been written with a column profile.
+	// Columns added later are missing from older files and stay empty.
+	index := r.columns.columnIndex(header)
+	if _, ok := index["Symbol"]; !ok {
+		return nil, fmt.Errorf("no Symbol column in %s", filePath)
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record, ok := recordFromRow(index, row); ok {
+			fn(record)
+		}
+	}
+}
+
+// recordFromRow converts a combined CSV row, whose columns are located by index (see
+// columnProfile.columnIndex), back to a record. Malformed rows are reported as not ok.
+func recordFromRow(index map[string]int, row []string) (parser.TradeRecord, bool) {
+	cell := func(name string) string {
+		if i, ok := index[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	float := func(name string) float64 {
+		v, _ := strconv.ParseFloat(cell(name), 64)
+		return v
+	}
+	integer := func(name string) int64 {
+		v, _ := strconv.ParseInt(cell(name), 10, 64)
+		return v
+	}
+
+	date, err := time.Parse("2006-01-02", cell("Date"))
+	if err != nil || cell("Symbol") == "" {
+		return parser.TradeRecord{}, false
+	}
+	tradingStatus, _ := strconv.ParseBool(cell("TradingStatus"))
+
+	return parser.TradeRecord{
+		CompanyName:       cell("CompanyName"),
+		CompanyNameAr:     cell("CompanyNameAr"),
+		CompanySymbol:     cell("Symbol"),
+		Date:              date,
+		OpenPrice:         float("OpenPrice"),
+		HighPrice:         float("HighPrice"),
+		LowPrice:          float("LowPrice"),
+		AveragePrice:      float("AveragePrice"),
+		PrevAveragePrice:  float("PrevAveragePrice"),
+		ClosePrice:        float("ClosePrice"),
+		PrevClosePrice:    float("PrevClosePrice"),
+		Change:            float("Change"),
+		ChangePercent:     float("ChangePercent"),
+		NumTrades:         integer("NumTrades"),
+		Volume:            integer("Volume"),
+		Value:             float("Value"),
+		TradingStatus:     tradingStatus,
+		Sector:            cell("Sector"),
+		Industry:          cell("Industry"),
+		ForeignBuyVolume:  integer("ForeignBuyVolume"),
+		ForeignBuyValue:   float("ForeignBuyValue"),
+		ForeignSellVolume: integer("ForeignSellVolume"),
+		ForeignSellValue:  float("ForeignSellValue"),
+		SharesOutstanding: integer("SharesOutstanding"),
+		MarketCap:         float("MarketCap"),
+		ListingStatus:     cell("ListingStatus"),
+		// Adjusted prices and USD values aren't read back; they are derived again on every run
+	}, true
+}
+
+// csvHeader is the full header of the combined, daily and ticker CSV files; a column profile
+// may select and rename its columns
+var csvHeader = []string{
+	"Date", "CompanyName", "Symbol", "OpenPrice", "HighPrice", "LowPrice",
+	"AveragePrice", "PrevAveragePrice", "ClosePrice", "PrevClosePrice",
+	"Change", "ChangePercent", "NumTrades", "Volume", "Value", "TradingStatus",
+	"Sector", "Industry",
+	"ForeignBuyVolume", "ForeignBuyValue", "ForeignSellVolume", "ForeignSellValue",
+	"CompanyNameAr",
+	"SharesOutstanding", "MarketCap",
+	"ListingStatus",
+	"AdjOpenPrice", "AdjHighPrice", "AdjLowPrice", "AdjClosePrice",
+	"USDClosePrice", "USDValue", "USDMarketCap",
+}
+
+// recordRow formats a trade record as a CSV row matching csvHeader. Filled rows without prices
+// (the leave-blank strategy) get empty price cells rather than zeros.
+func recordRow(record parser.TradeRecord) []string {
+	row := []string{
+		record.Date.Format("2006-01-02"),
+		record.CompanyName,
+		record.CompanySymbol,
+		fmt.Sprintf("%.3f", record.OpenPrice),
+		fmt.Sprintf("%.3f", record.HighPrice),
+		fmt.Sprintf("%.3f", record.LowPrice),
+		fmt.Sprintf("%.3f", record.AveragePrice),
+		fmt.Sprintf("%.3f", record.PrevAveragePrice),
+		fmt.Sprintf("%.3f", record.ClosePrice),
+		fmt.Sprintf("%.3f", record.PrevClosePrice),
+		fmt.Sprintf("%.3f", record.Change),
+		fmt.Sprintf("%.2f", record.ChangePercent),
+		fmt.Sprintf("%d", record.NumTrades),
+		fmt.Sprintf("%d", record.Volume),
+		fmt.Sprintf("%.2f", record.Value),
+		fmt.Sprintf("%t", record.TradingStatus),
+		record.Sector,
+		record.Industry,
+		fmt.Sprintf("%d", record.ForeignBuyVolume),
+		fmt.Sprintf("%.2f", record.ForeignBuyValue),
+		fmt.Sprintf("%d", record.ForeignSellVolume),
+		fmt.Sprintf("%.2f", record.ForeignSellValue),
+		record.CompanyNameAr,
+		fmt.Sprintf("%d", record.SharesOutstanding),
+		fmt.Sprintf("%.2f", record.MarketCap),
+		record.ListingStatus,
+		fmt.Sprintf("%.3f", record.AdjOpenPrice),
+		fmt.Sprintf("%.3f", record.AdjHighPrice),
+		fmt.Sprintf("%.3f", record.AdjLowPrice),
+		fmt.Sprintf("%.3f", record.AdjClosePrice),
+		usdCell(record.USDClosePrice, 4),
+		usdCell(record.USDValue, 2),
+		usdCell(record.USDMarketCap, 2),
+	}
+	if !record.TradingStatus && record.ClosePrice == 0 {
+		for _, i := range []int{3, 4, 5, 6, 7, 8, 9, 10, 11, 24, 26, 27, 28, 29} {
+			row[i] = ""
+		}
+	}
+	return row
+}
+
+// usdCell formats a USD amount, leaving it empty when no exchange rate was known
+func usdCell(v float64, decimals int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// saveDailyCSV writes records in the output columns, appending them to an existing file when
+// appendRows is set
+func (r *run) saveDailyCSV(filePath string, records []parser.TradeRecord, appendRows bool) error {
+	file, fresh, err := openOutput(filePath, appendRows)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	// Write header with all fields
+	if fresh {
+		if err := writer.Write(r.columns.header()); err != nil {
+			return err
+		}
+	}
+
+	// Write records
+	for _, record := range records {
+		if err := writer.Write(r.columns.row(record)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// FillStrategy decides what is written for a listed symbol on a day it didn't trade
+type FillStrategy string
+
+// Forward-fill strategies
+const (
+	// FillCarryForward repeats the last close as open, high, low and close
+	FillCarryForward FillStrategy = "carry-forward"
+	// FillLeaveBlank writes a row with blank prices, keeping the calendar dense but the gap visible
+	FillLeaveBlank FillStrategy = "leave-blank"
+	// FillInterpolate draws prices on a straight line between the surrounding trades, carrying
+	// the last close forward when no later trade exists yet
+	FillInterpolate FillStrategy = "linear-interpolate"
+	// FillZeroVolumeOnly adds no rows at all: only the rows the reports list, including companies
+	// listed with zero volume, are kept
+	FillZeroVolumeOnly FillStrategy = "zero-volume-only"
+)
+
+// FillStrategies lists the valid strategies
+var FillStrategies = []FillStrategy{FillCarryForward, FillLeaveBlank, FillInterpolate, FillZeroVolumeOnly}
+
+// ParseFillStrategy checks a strategy name
+func ParseFillStrategy(name string) (FillStrategy, error) {
+	for _, s := range FillStrategies {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown forward-fill strategy %q (want one of %v)", name, FillStrategies)
+}
+
+// FillOptions controls forwardFillMissingData
+type FillOptions struct {
+	Strategy FillStrategy // empty means FillCarryForward
+	// MaxDays stops filling a symbol once this many calendar days have passed since its last
+	// trade, until it trades again; zero fills without limit
+	MaxDays int
+}
+
+// staleSymbol is a symbol that stopped being filled because it hadn't traded for too long
+type staleSymbol struct {
+	Symbol    string
+	LastTrade time.Time
+	StoppedOn time.Time // first day left unfilled
+}
+
+// forwardFillMissingData fills in missing trading data for symbols that don't trade on certain days.
+// listing holds announced listing changes (date -> symbol -> status); delisted symbols are no
+// longer filled and suspended ones are marked as such. Rows filled by an earlier run are dropped
+// and filled again with opts.Strategy. Symbols that go unfilled because of opts.MaxDays are
+// returned as well. Symbols are filled concurrently on workers goroutines; the result is ordered by
+// date and symbol.
+func forwardFillMissingData(records []parser.TradeRecord, listing map[string]map[string]string, opts FillOptions, workers int) ([]parser.TradeRecord, []staleSymbol) {
+	if len(records) == 0 {
+		return records, nil
+	}
+
+	// Group records by symbol and date
+	bySymbol := make(map[string]map[string]parser.TradeRecord) // symbol -> date -> record
+	allDates := make(map[string]bool)
+
+	for _, record := range records {
+		dateStr := record.Date.Format("2006-01-02")
+		symbol := record.CompanySymbol
+		allDates[dateStr] = true
+		if !record.TradingStatus {
+			continue
+		}
+
+		if bySymbol[symbol] == nil {
+			bySymbol[symbol] = make(map[string]parser.TradeRecord)
+		}
+		bySymbol[symbol][dateStr] = record
+	}
+
+	// Convert to sorted slices
+	var dates []string
+	for date := range allDates {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var symbols []string
+	for symbol := range bySymbol {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	filled := make([][]parser.TradeRecord, len(symbols))
+	staleBySymbol := make([][]staleSymbol, len(symbols))
+	forEach(workers, len(symbols), func(i int) {
+		filled[i], staleBySymbol[i] = fillSymbol(symbols[i], dates, bySymbol[symbols[i]], listing, opts)
+	})
+
+	var result []parser.TradeRecord
+	var stale []staleSymbol
+	for i := range symbols {
+		result = append(result, filled[i]...)
+		stale = append(stale, staleBySymbol[i]...)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].Date.Equal(result[j].Date) {
+			return result[i].Date.Before(result[j].Date)
+		}
+		return result[i].CompanySymbol < result[j].CompanySymbol
+	})
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].StoppedOn.Before(stale[j].StoppedOn) })
+
+	return result, stale
+}
+
+// fillSymbol fills the history of one symbol over every report date. traded holds its trades by
+// date (YYYY-MM-DD).
+func fillSymbol(symbol string, dates []string, traded map[string]parser.TradeRecord, listing map[string]map[string]string, opts FillOptions) ([]parser.TradeRecord, []staleSymbol) {
+	// Interpolation needs the next trade, so note the days the symbol traded
+	var tradedDays []int
+	for d, dateStr := range dates {
+		if _, ok := traded[dateStr]; ok {
+			tradedDays = append(tradedDays, d)
+		}
+	}
+
+	// Keep track of last known data and listing status
+	var lastRecord, lastFilled parser.TradeRecord
+	hasHistory, hasFilled, isStale := false, false, false
+	lastDay, tradesSeen := 0, 0
+	status := ""
+
+	var result []parser.TradeRecord
+	var stale []staleSymbol
+
+	for d, dateStr := range dates {
+		date, _ := time.Parse("2006-01-02", dateStr)
+		if s, ok := listing[dateStr][symbol]; ok {
+			status = s
+		}
+
+		if record, exists := traded[dateStr]; exists {
+			// Symbol traded on this day - use actual data
+			result = append(result, record)
+			lastRecord, hasHistory, lastDay = record, true, d
+			hasFilled, isStale = false, false
+			tradesSeen++
+			if record.ListingStatus != "" {
+				status = record.ListingStatus
+			}
+			continue
+		}
+		if status == parser.ListingDelisted {
+			// Delisted symbols stop here instead of showing years of flat prices
+			continue
+		}
+		if !hasHistory || opts.Strategy == FillZeroVolumeOnly {
+			// If no history exists, skip this symbol for this date
+			continue
+		}
+		if opts.MaxDays > 0 && date.Sub(lastRecord.Date) > time.Duration(opts.MaxDays)*24*time.Hour {
+			// Long-suspended symbols would otherwise add years of synthetic rows
+			if !isStale {
+				isStale = true
+				stale = append(stale, staleSymbol{Symbol: symbol, LastTrade: lastRecord.Date, StoppedOn: date})
+			}
+			continue
+		}
+
+		// Symbol didn't trade - forward fill from last known data
+		filledRecord := parser.TradeRecord{
+			CompanyName:       lastRecord.CompanyName,
+			CompanyNameAr:     lastRecord.CompanyNameAr,
+			CompanySymbol:     symbol,
+			Date:              date,
+			OpenPrice:         lastRecord.ClosePrice,   // Open = previous close
+			HighPrice:         lastRecord.ClosePrice,   // High = previous close
+			LowPrice:          lastRecord.ClosePrice,   // Low = previous close
+			AveragePrice:      lastRecord.ClosePrice,   // Average = previous close
+			PrevAveragePrice:  lastRecord.AveragePrice, // Keep previous average
+			ClosePrice:        lastRecord.ClosePrice,   // Close = previous close
+			PrevClosePrice:    lastRecord.ClosePrice,   // Prev close = previous close
+			Change:            0.0,                     // No change
+			ChangePercent:     0.0,                     // No change %
+			NumTrades:         0,                       // No trades
+			Volume:            0,                       // No volume
+			Value:             0.0,                     // No value
+			TradingStatus:     false,                   // Forward-filled data
+			Sector:            lastRecord.Sector,
+			Industry:          lastRecord.Industry,
+			SharesOutstanding: lastRecord.SharesOutstanding,
+			MarketCap:         lastRecord.MarketCap, // Close is unchanged
+			ListingStatus:     status,
+		}
+
+		switch opts.Strategy {
+		case FillLeaveBlank:
+			clearPrices(&filledRecord)
+		case FillInterpolate:
+			if tradesSeen < len(tradedDays) {
+				next := traded[dates[tradedDays[tradesSeen]]]
+				prev := lastRecord
+				if hasFilled {
+					prev = lastFilled
+				}
+				interpolate(&filledRecord, lastRecord, next, prev, d-lastDay, tradedDays[tradesSeen]-lastDay)
+			}
+			lastFilled, hasFilled = filledRecord, true
+		}
+		result = append(result, filledRecord)
+		// Don't update lastRecord since this is filled data
+	}
+
+	return result, stale
+}
+
+// clearPrices blanks the prices of a filled record; recordRow writes them as empty cells
+func clearPrices(r *parser.TradeRecord) {
+	r.OpenPrice, r.HighPrice, r.LowPrice, r.AveragePrice = 0, 0, 0, 0
+	r.PrevAveragePrice, r.ClosePrice, r.PrevClosePrice = 0, 0, 0
+	r.Change, r.ChangePercent, r.MarketCap = 0, 0, 0
+}
+
+// interpolate sets the prices of a filled record step days after the last trade, on the line from
+// the last trade's close to the next trade's close span days later. prev is the row before.
+func interpolate(r *parser.TradeRecord, last, next, prev parser.TradeRecord, step, span int) {
+	price := last.ClosePrice + (next.ClosePrice-last.ClosePrice)*float64(step)/float64(span)
+	r.OpenPrice, r.HighPrice, r.LowPrice, r.AveragePrice, r.ClosePrice = price, price, price, price, price
+	r.PrevAveragePrice = prev.AveragePrice
+	r.PrevClosePrice = prev.ClosePrice
+	r.Change = price - prev.ClosePrice
+	if prev.ClosePrice != 0 {
+		r.ChangePercent = r.Change / prev.ClosePrice * 100
+	}
+	if r.SharesOutstanding > 0 {
+		r.MarketCap = float64(r.SharesOutstanding) * price
+	}
+}
+
+// saveCombinedCSV writes the combined dataset, or appends records dated after it when appendRows
+// is set. Smart updates depend on this file, so the previous one is kept as a .bak.
+func (r *run) saveCombinedCSV(filePath string, records []parser.TradeRecord, appendRows bool) error {
+	file, fresh, err := openOutput(filePath, appendRows)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.backup = true
+
+	writer := csv.NewWriter(file)
+
+	// Write header with all fields
+	if fresh {
+		if err := writer.Write(r.columns.header()); err != nil {
+			return err
+		}
+	}
+
+	// Write records
+	for _, record := range records {
+		if err := writer.Write(r.columns.row(record)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// saveForeignTradingCSV writes the non-Iraqi buy/sell activity per day and company, appending it
+// to an existing file when appendRows is set
+func saveForeignTradingCSV(filePath string, records []parser.TradeRecord, appendRows bool) error {
+	var foreign []parser.TradeRecord
+	for _, record := range records {
+		if record.ForeignBuyVolume != 0 || record.ForeignSellVolume != 0 || record.ForeignBuyValue != 0 || record.ForeignSellValue != 0 {
+			foreign = append(foreign, record)
+		}
+	}
+	sort.Slice(foreign, func(i, j int) bool {
+		if !foreign[i].Date.Equal(foreign[j].Date) {
+			return foreign[i].Date.Before(foreign[j].Date)
+		}
+		return foreign[i].CompanySymbol < foreign[j].CompanySymbol
+	})
+
+	file, fresh, err := openOutput(filePath, appendRows)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	header := []string{"Date", "Symbol", "CompanyName", "BuyVolume", "BuyValue", "SellVolume", "SellValue", "NetVolume", "NetValue", "CompanyNameAr"}
+	if fresh {
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, record := range foreign {
+		row := []string{
+			record.Date.Format("2006-01-02"),
+			record.CompanySymbol,
+			record.CompanyName,
+			fmt.Sprintf("%d", record.ForeignBuyVolume),
+			fmt.Sprintf("%.2f", record.ForeignBuyValue),
+			fmt.Sprintf("%d", record.ForeignSellVolume),
+			fmt.Sprintf("%.2f", record.ForeignSellValue),
+			fmt.Sprintf("%d", record.ForeignBuyVolume-record.ForeignSellVolume),
+			fmt.Sprintf("%.2f", record.ForeignBuyValue-record.ForeignSellValue),
+			record.CompanyNameAr,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// saveValidation writes the parse validation report of one file as JSON
+func saveValidation(dir string, v parser.Validation) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(v.File, filepath.Ext(v.File)) + ".json"
+	return ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// saveStaleSymbols writes the symbols no longer forward-filled to stale_symbols.csv in dir
+func saveStaleSymbols(dir string, stale []staleSymbol, appendRows bool) error {
+	path := filepath.Join(dir, "stale_symbols.csv")
+	if len(stale) == 0 && appendRows {
+		return nil
+	}
+	if len(stale) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, fresh, err := openOutput(path, appendRows)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	if fresh {
+		if err := writer.Write([]string{"Symbol", "LastTradeDate", "FillStoppedOn", "DaysWithoutTrade"}); err != nil {
+			return err
+		}
+	}
+	for _, s := range stale {
+		days := int(s.StoppedOn.Sub(s.LastTrade).Hours() / 24)
+		if err := writer.Write([]string{s.Symbol, s.LastTrade.Format("2006-01-02"), s.StoppedOn.Format("2006-01-02"), strconv.Itoa(days)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// saveSkippedRows writes every unexpectedly skipped row of this run to skipped_rows.csv, with
+// the file, sheet and row it came from
+func (r *run) saveSkippedRows(dir string, validations []parser.Validation) error {
+	var skipped []parser.SkippedRow
+	for _, v := range validations {
+		skipped = append(skipped, v.SkippedRows...)
+	}
+	path := filepath.Join(dir, "skipped_rows.csv")
+	if len(skipped) == 0 {
+		// Don't leave the log of an earlier run behind
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, _, err := openOutput(path, false)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	if err := writer.Write([]string{"File", "Sheet", "Row", "Reason", "Detail", "Cells"}); err != nil {
+		return err
+	}
+	for _, row := range skipped {
+		if err := writer.Write([]string{row.File, row.Sheet, strconv.Itoa(row.Row), row.Reason, row.Detail, strings.Join(row.Cells, " | ")}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+	r.logf("%d skipped rows logged to %s\n", len(skipped), path)
+	return nil
+}
+
+// printValidationSummary reports parse problems across all processed files
+func (r *run) printValidationSummary(validations []parser.Validation, failedFiles []string, dir string) {
+	if len(validations) == 0 && len(failedFiles) == 0 {
+		return
+	}
+
+	var parsed, skipped, unexpected, suspicious, headerIssues int
+	var flagged []parser.Validation
+	for _, v := range validations {
+		parsed += v.RowsParsed
+		skipped += v.RowsSkipped
+		unexpected += v.UnexpectedSkips()
+		suspicious += len(v.Suspicious)
+		headerIssues += len(v.HeaderIssues)
+		if v.HasIssues() {
+			flagged = append(flagged, v)
+		}
+	}
+
+	r.logf("\n=== Validation summary ===\n")
+	r.logf("Files parsed: %d, failed: %d\n", len(validations), len(failedFiles))
+	r.logf("Rows parsed: %d, skipped: %d (%d unexpected)\n", parsed, skipped, unexpected)
+	r.logf("Suspicious values: %d, header issues: %d\n", suspicious, headerIssues)
+	for _, name := range failedFiles {
+		r.logf("  ✗ %s: could not be parsed\n", name)
+	}
+	for _, v := range flagged {
+		r.logf("  ⚠ %s: %d unexpected skips, %d suspicious values, %d header issues\n",
+			v.File, v.UnexpectedSkips(), len(v.Suspicious), len(v.HeaderIssues))
+	}
+	r.logf("Per-file validation reports: %s\n", dir)
+}
+
+// bondsHeader is the header of bonds.csv
+var bondsHeader = []string{"Date", "Name", "Symbol", "Coupon", "Maturity", "Price", "Yield", "Volume", "Value"}
+
+// bondRows formats bonds as bonds.csv rows
+func bondRows(bonds []parser.BondRecord) [][]string {
+	var rows [][]string
+	for _, bond := range bonds {
+		rows = append(rows, []string{
+			bond.Date.Format("2006-01-02"),
+			bond.Name,
+			bond.Symbol,
+			fmt.Sprintf("%.3f", bond.Coupon),
+			bond.Maturity,
+			fmt.Sprintf("%.3f", bond.Price),
+			fmt.Sprintf("%.3f", bond.Yield),
+			fmt.Sprintf("%d", bond.Volume),
+			fmt.Sprintf("%.2f", bond.Value),
+		})
+	}
+	return rows
+}
+
+// summaryHeader is the header of market_summary.csv
+var summaryHeader = []string{"Date", "Volume", "Value", "Trades", "ListedCompanies", "TradedCompanies"}
+
+// summaryRows formats session totals as market_summary.csv rows
+func summaryRows(summaries []parser.MarketSummary) [][]string {
+	var rows [][]string
+	for _, summary := range summaries {
+		rows = append(rows, []string{
+			summary.Date.Format("2006-01-02"),
+			fmt.Sprintf("%d", summary.Volume),
+			fmt.Sprintf("%.2f", summary.Value),
+			fmt.Sprintf("%d", summary.Trades),
+			fmt.Sprintf("%d", summary.ListedCompanies),
+			fmt.Sprintf("%d", summary.TradedCompanies),
+		})
+	}
+	return rows
+}
+
+// constituentsHeader is the header of constituents.csv
+var constituentsHeader = []string{"Date", "Index", "Symbol", "CompanyName", "Weight"}
+
+// constituentRows formats index constituents as constituents.csv rows
+func constituentRows(constituents []parser.Constituent) [][]string {
+	var rows [][]string
+	for _, c := range constituents {
+		rows = append(rows, []string{
+			c.Date.Format("2006-01-02"),
+			c.Index,
+			c.CompanySymbol,
+			c.CompanyName,
+			fmt.Sprintf("%.4f", c.Weight),
+		})
+	}
+	return rows
+}
+
+// listingHeader is the header of listing_status.csv
+var listingHeader = []string{"Date", "Symbol", "Status", "Note"}
+
+// listingRows formats listing changes as listing_status.csv rows
+func listingRows(changes []parser.ListingChange) [][]string {
+	var rows [][]string
+	for _, c := range changes {
+		rows = append(rows, []string{c.Date.Format("2006-01-02"), c.CompanySymbol, c.Status, c.Note})
+	}
+	return rows
+}
+
+// loadListingChanges reads listing_status.csv into date -> symbol -> status
+func loadListingChanges(filePath string) (map[string]map[string]string, error) {
+	listing := make(map[string]map[string]string)
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return listing, nil
+	}
+	if err != nil {
+		return listing, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return listing, err
+	}
+	for i, row := range rows {
+		if i == 0 || len(row) < 3 {
+			continue
+		}
+		if listing[row[0]] == nil {
+			listing[row[0]] = make(map[string]string)
+		}
+		listing[row[0]][row[1]] = row[2]
+	}
+	return listing, nil
+}
+
+// actionsHeader is the header of corporate_actions.csv
+var actionsHeader = []string{"Date", "Symbol", "Type", "Value", "Ratio", "Note"}
+
+// actionRows formats corporate actions as corporate_actions.csv rows
+func actionRows(actions []parser.CorporateAction) [][]string {
+	var rows [][]string
+	for _, action := range actions {
+		rows = append(rows, []string{
+			action.Date.Format("2006-01-02"),
+			action.CompanySymbol,
+			action.Type,
+			fmt.Sprintf("%.4f", action.Value),
+			fmt.Sprintf("%.4f", action.Ratio),
+			action.Note,
+		})
+	}
+	return rows
+}
+
+// updateDatedCSV merges new rows into a CSV time series whose first column is the date (YYYY-MM-DD),
+// replacing the rows of the processed dates. It returns the number of rows written; the file isn't
+// created when there are no rows at all.
+func updateDatedCSV(filePath string, header []string, newRows [][]string, processed []ExcelFileInfo) (int, error) {
+	processedDates := make(map[string]bool)
+	for _, fileInfo := range processed {
+		processedDates[fileInfo.Date.Format("2006-01-02")] = true
+	}
+
+	var rows [][]string
+	existed := false
+	if file, err := os.Open(filePath); err == nil {
+		existed = true
+		existing, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			return 0, err
+		}
+		for i, row := range existing {
+			if i == 0 || len(row) < len(header) || processedDates[row[0]] {
+				continue
+			}
+			rows = append(rows, row)
+		}
+	}
+	rows = append(rows, newRows...)
+	if len(rows) == 0 && !existed {
+		return 0, nil
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][1] < rows[j][1]
+	})
+
+	file, _, err := openOutput(filePath, false)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	if err := writer.Write(header); err != nil {
+		return 0, err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return 0, err
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return 0, err
+	}
+	return len(rows), file.Commit()
+}
+
+// generateDailyFiles generates daily CSV files grouped by date from forward-filled records
+func (r *run) generateDailyFiles(records []parser.TradeRecord, outDir string) error {
+	// Group records by date
+	recordsByDate := make(map[string][]parser.TradeRecord)
+	var dates []string
+	for _, record := range records {
+		dateStr := record.Date.Format("2006_01_02")
+		if _, ok := recordsByDate[dateStr]; !ok {
+			dates = append(dates, dateStr)
+		}
+		recordsByDate[dateStr] = append(recordsByDate[dateStr], record)
+	}
+
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	// Generate CSV files for each date
+	var done int64
+	r.progress.status(stageDaily, "started", "writing %d daily files", len(dates))
+	defer r.progress.status(stageDaily, "completed", "%d daily files written", len(dates))
+	forEach(r.ioWorkers, len(dates), func(i int) {
+		defer func() { r.progress.step(stageDaily, int(atomic.AddInt64(&done, 1)), len(dates), "") }()
+		dailyRecords := recordsByDate[dates[i]]
+
+		// Save CSV for the current date
+		dailyCSVPath := r.datasetPath(outDir, fmt.Sprintf("isx_daily_%s.csv", dates[i]))
+		if err := r.saveDailyCSV(dailyCSVPath, dailyRecords, false); err != nil {
+			r.logf("Error saving daily CSV: %v\n", err)
+		} else {
+			r.logf("Saved daily CSV: %s (%d records)\n", dailyCSVPath, len(dailyRecords))
+		}
+	})
+
+	return nil
+}
+
+// generateTickerFiles generates individual CSV files for each ticker with their complete trading
+// history. With appendRows the records are added to the end of the existing files.
+func (r *run) generateTickerFiles(records []parser.TradeRecord, outDir string, appendRows bool) error {
+	// Group records by ticker once, keeping their order
+	recordsByTicker := make(map[string][]parser.TradeRecord)
+	var tickers []string
+	for _, record := range records {
+		if _, ok := recordsByTicker[record.CompanySymbol]; !ok {
+			tickers = append(tickers, record.CompanySymbol)
+		}
+		recordsByTicker[record.CompanySymbol] = append(recordsByTicker[record.CompanySymbol], record)
+	}
+
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	// Generate CSV files for each ticker
+	var done int64
+	r.progress.status(stageTickers, "started", "writing %d ticker files", len(tickers))
+	defer r.progress.status(stageTickers, "completed", "%d ticker files written", len(tickers))
+	forEach(r.ioWorkers, len(tickers), func(i int) {
+		defer func() { r.progress.step(stageTickers, int(atomic.AddInt64(&done, 1)), len(tickers), tickers[i]) }()
+		ticker := tickers[i]
+
+		// Save CSV for the current ticker
+		tickerCSVPath := r.datasetPath(outDir, fmt.Sprintf("%s_trading_history.csv", ticker))
+		if err := r.saveTickerCSV(tickerCSVPath, recordsByTicker[ticker], appendRows); err != nil {
+			r.logf("Error saving ticker CSV: %v\n", err)
+		} else {
+			r.logf("Saved ticker CSV: %s (%d records)\n", tickerCSVPath, len(recordsByTicker[ticker]))
+		}
+	})
+
+	return nil
+}
+
+// forEach calls fn for 0..n-1 on workers goroutines; 0 workers is one per CPU
+func forEach(workers, n int, fn func(i int)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
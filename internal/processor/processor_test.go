@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"isxcli/internal/csvgz"
+	"isxcli/internal/reportfile"
+)
+
+// writeReport saves a daily report dated date (YYYY MM DD) with one row per symbol, each row
+// holding the symbol, closing price and traded volume
+func writeReport(t *testing.T, dir, date string, rows ...[]interface{}) {
+	t.Helper()
+	f := excelize.NewFile()
+	sheetName := "Bulletin"
+	f.SetSheetName(f.GetSheetName(0), sheetName)
+	f.SetSheetRow(sheetName, "A1", &[]interface{}{"ISX Daily Bulletin"})
+	f.SetSheetRow(sheetName, "A3", &[]interface{}{"Company Name", "Code", "Opening Price", "Closing Price", "Prev Closing", "Traded Volume", "Traded Value"})
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+4)
+		f.SetSheetRow(sheetName, cell, &[]interface{}{row[0], row[0], row[1], row[1], row[1], row[2], "1000"})
+	}
+	if err := f.SaveAs(filepath.Join(dir, date+" ISX Daily Report.xlsx")); err != nil {
+		t.Fatalf("failed to save workbook: %v", err)
+	}
+}
+
+// testOptions returns options processing inDir into outDir without logging
+func testOptions(inDir, outDir string) Options {
+	opts := DefaultOptions()
+	opts.InDir, opts.OutDir = inDir, outDir
+	opts.NameTemplate = reportfile.DefaultPattern
+	opts.Companies = ""
+	opts.Output = io.Discard
+	return opts
+}
+
+// readRows returns the rows of a CSV file, compressed or not, by the value of column
+func readRows(t *testing.T, path, column string) map[string][]string {
+	t.Helper()
+	file, err := csvgz.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	key := slices.Index(rows[0], column)
+	byKey := make(map[string][]string)
+	for _, row := range rows[1:] {
+		byKey[row[key]] = append(byKey[row[key]], strings.Join(row, ","))
+	}
+	return byKey
+}
+
+// closePrice returns the ClosePrice of symbol on date in the combined CSV of dir
+func closePrice(t *testing.T, dir, date, symbol string) string {
+	t.Helper()
+	file, err := os.Open(filepath.Join(dir, "isx_combined_data.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, s, c := slices.Index(rows[0], "Date"), slices.Index(rows[0], "Symbol"), slices.Index(rows[0], "ClosePrice")
+	for _, row := range rows[1:] {
+		if row[d] == date && row[s] == symbol {
+			return row[c]
+		}
+	}
+	return ""
+}
+
+// TestProcessDirectory covers the initial run, appending a new report and reprocessing a
+// republished one
+func TestProcessDirectory(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	writeReport(t, inDir, "2025 01 01", []interface{}{"BBOB", "1.10", "2,000"}, []interface{}{"TASC", "8.00", "100"})
+	writeReport(t, inDir, "2025 01 02", []interface{}{"BBOB", "1.20", "3,000"})
+
+	// Initial run: every report is parsed and TASC is carried forward to the second day
+	stats, err := ProcessDirectory(testOptions(inDir, outDir))
+	if err != nil {
+		t.Fatalf("initial run: %v", err)
+	}
+	if stats.FilesFound != 2 || stats.FilesProcessed != 2 || stats.Appended {
+		t.Errorf("initial run: unexpected stats %+v", stats)
+	}
+	if stats.Records != 4 || stats.ActiveRecords != 3 {
+		t.Errorf("initial run: want 4 records of which 3 trades, got %d and %d", stats.Records, stats.ActiveRecords)
+	}
+	for _, name := range []string{"isx_daily_2025_01_01.csv", "isx_daily_2025_01_02.csv", "BBOB_trading_history.csv", "TASC_trading_history.csv"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("initial run: %s not written: %v", name, err)
+		}
+	}
+	if price := closePrice(t, outDir, "2025-01-02", "TASC"); price != "8.000" {
+		t.Errorf("initial run: TASC not carried forward to 2025-01-02, close price %q", price)
+	}
+
+	// Append: only the new report is parsed and its records are added after the history
+	writeReport(t, inDir, "2025 01 05", []interface{}{"BBOB", "1.30", "1,000"}, []interface{}{"TASC", "8.50", "200"})
+	stats, err = ProcessDirectory(testOptions(inDir, outDir))
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if stats.FilesProcessed != 1 || !stats.Appended || !slices.Equal(stats.Dates, []string{"2025-01-05"}) {
+		t.Errorf("append: unexpected stats %+v", stats)
+	}
+	byDate := readRows(t, filepath.Join(outDir, "isx_combined_data.csv"), "Date")
+	if len(byDate["2025-01-01"]) != 2 || len(byDate["2025-01-02"]) != 2 || len(byDate["2025-01-05"]) != 2 {
+		t.Errorf("append: want 2 rows on every date, got %v", byDate)
+	}
+	if rows := readRows(t, filepath.Join(outDir, "TASC_trading_history.csv"), "Date"); len(rows) != 3 {
+		t.Errorf("append: want 3 dates in the TASC history, got %d", len(rows))
+	}
+
+	// Reprocess: a report republished with another price and flagged in the manifest replaces
+	// the records of its date
+	writeReport(t, inDir, "2025 01 02", []interface{}{"BBOB", "1.25", "3,000"})
+	manifest, err := reportfile.LoadManifest(inDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.MarkReprocess("2025-01-02")
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = ProcessDirectory(testOptions(inDir, outDir))
+	if err != nil {
+		t.Fatalf("reprocess: %v", err)
+	}
+	if stats.FilesProcessed != 1 || stats.Appended || !slices.Equal(stats.Dates, []string{"2025-01-02"}) {
+		t.Errorf("reprocess: unexpected stats %+v", stats)
+	}
+	if price := closePrice(t, outDir, "2025-01-02", "BBOB"); price != "1.250" {
+		t.Errorf("reprocess: want the republished BBOB close price 1.25, got %q", price)
+	}
+	byDate = readRows(t, filepath.Join(outDir, "isx_combined_data.csv"), "Date")
+	if len(byDate["2025-01-01"]) != 2 || len(byDate["2025-01-02"]) != 2 || len(byDate["2025-01-05"]) != 2 {
+		t.Errorf("reprocess: want 2 rows on every date, got %v", byDate)
+	}
+	if manifest, err := reportfile.LoadManifest(inDir); err != nil || len(manifest.ReprocessDates()) != 0 {
+		t.Errorf("reprocess: want the flag cleared, got %v (%v)", manifest.ReprocessDates(), err)
+	}
+}
+
+// TestProcessDirectoryConcurrent runs two calls with different settings at the same time
+func TestProcessDirectoryConcurrent(t *testing.T) {
+	plainDir, compressedDir := t.TempDir(), t.TempDir()
+	var wg sync.WaitGroup
+	for _, dir := range []string{plainDir, compressedDir} {
+		// Each run records report fingerprints in the manifest of its own input directory
+		inDir := t.TempDir()
+		writeReport(t, inDir, "2025 01 01", []interface{}{"BBOB", "1.10", "2,000"})
+		writeReport(t, inDir, "2025 01 02", []interface{}{"BBOB", "1.20", "3,000"})
+		opts := testOptions(inDir, dir)
+		opts.Compress = dir == compressedDir
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ProcessDirectory(opts); err != nil {
+				t.Errorf("%s: %v", dir, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for dir, name := range map[string]string{plainDir: "isx_daily_2025_01_02.csv", compressedDir: "isx_daily_2025_01_02.csv" + csvgz.Ext} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(plainDir, "isx_daily_2025_01_02.csv"+csvgz.Ext)); err == nil {
+		t.Error("the uncompressed run wrote compressed output")
+	}
+}
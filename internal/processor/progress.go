@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Line prefixes of the structured progress output. The web servers turn these lines into
+// "progress" and "status" WebSocket messages instead of plain output.
+const (
+	progressPrefix = "[WEBSOCKET_PROGRESS]"
+	statusPrefix   = "[WEBSOCKET_STATUS]"
+)
+
+// Processing stages reported in progress events
+const (
+	stageParse   = "parse"
+	stageFill    = "fill"
+	stageDaily   = "daily_files"
+	stageTickers = "ticker_files"
+	stageFinish  = "finish"
+)
+
+// progressEvent is the JSON payload of a progress or status line
+type progressEvent struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Stage      string    `json:"stage"`
+	Status     string    `json:"status,omitempty"` // started or completed; status lines only
+	Current    int       `json:"current,omitempty"`
+	Total      int       `json:"total,omitempty"`
+	Percentage float64   `json:"percentage,omitempty"`
+	ETASeconds int64     `json:"eta_seconds,omitempty"`
+	File       string    `json:"file,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// progressReporter writes progress and status lines when enabled; the free-form output is
+// printed either way
+type progressReporter struct {
+	enabled bool
+	out     io.Writer
+	mutex   sync.Mutex
+	started map[string]time.Time
+}
+
+// status reports a stage starting, completing or failing
+func (p *progressReporter) status(stage, status, format string, args ...interface{}) {
+	if !p.enabled {
+		return
+	}
+	p.mutex.Lock()
+	if status == "started" {
+		p.started[stage] = time.Now()
+	}
+	p.mutex.Unlock()
+	p.emit(statusPrefix, progressEvent{Stage: stage, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// step reports that current of total items of a stage are done, estimating the time left from
+// the average time per item so far
+func (p *progressReporter) step(stage string, current, total int, file string) {
+	if !p.enabled || total == 0 {
+		return
+	}
+	ev := progressEvent{
+		Stage:      stage,
+		Current:    current,
+		Total:      total,
+		Percentage: float64(current) * 100 / float64(total),
+		File:       file,
+		Message:    fmt.Sprintf("%s %d of %d", stage, current, total),
+	}
+	p.mutex.Lock()
+	if start, ok := p.started[stage]; ok && current > 0 {
+		perItem := time.Since(start) / time.Duration(current)
+		ev.ETASeconds = int64((perItem * time.Duration(total-current)).Seconds())
+	}
+	p.mutex.Unlock()
+	p.emit(progressPrefix, ev)
+}
+
+func (p *progressReporter) emit(prefix string, ev progressEvent) {
+	ev.Timestamp = time.Now()
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	fmt.Fprintf(p.out, "%s %s\n", prefix, data)
+}
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"isxcli/internal/indices"
+	"isxcli/internal/parser"
+)
+
+// Data quality issue severities
+const (
+	severityError   = "error"   // the record contradicts itself
+	severityWarning = "warning" // the record is plausible but suspicious
+)
+
+// qualityIssue is one finding of the data quality check
+type qualityIssue struct {
+	Date     time.Time
+	Symbol   string
+	Severity string
+	Check    string
+	Detail   string
+}
+
+// checkDataQuality flags traded records whose prices are inconsistent: high below low, close
+// outside the day's range, negative volume, or a close moving more than maxJump percent from the
+// previous close without a corporate action to explain it. maxJump <= 0 disables the jump check.
+func checkDataQuality(records []parser.TradeRecord, actions []parser.CorporateAction, maxJump float64) []qualityIssue {
+	actionDates := make(map[string][]time.Time)
+	for _, a := range actions {
+		actionDates[a.CompanySymbol] = append(actionDates[a.CompanySymbol], a.Date)
+	}
+
+	traded := make([]parser.TradeRecord, 0, len(records))
+	for _, r := range records {
+		if r.TradingStatus {
+			traded = append(traded, r)
+		}
+	}
+	sort.SliceStable(traded, func(i, j int) bool { return traded[i].Date.Before(traded[j].Date) })
+
+	var issues []qualityIssue
+	lastTrade := make(map[string]parser.TradeRecord)
+	for _, r := range traded {
+		flag := func(severity, check, format string, args ...interface{}) {
+			issues = append(issues, qualityIssue{Date: r.Date, Symbol: r.CompanySymbol, Severity: severity, Check: check, Detail: fmt.Sprintf(format, args...)})
+		}
+
+		// Zero highs and lows are prices the report left empty, not a range
+		if r.HighPrice > 0 && r.LowPrice > 0 {
+			if r.HighPrice < r.LowPrice {
+				flag(severityError, "high_below_low", "high %.3f < low %.3f", r.HighPrice, r.LowPrice)
+			} else if r.ClosePrice < r.LowPrice || r.ClosePrice > r.HighPrice {
+				flag(severityError, "close_outside_range", "close %.3f outside [%.3f, %.3f]", r.ClosePrice, r.LowPrice, r.HighPrice)
+			}
+		}
+		if r.Volume < 0 {
+			flag(severityError, "negative_volume", "volume %d", r.Volume)
+		}
+
+		if prev, ok := lastTrade[r.CompanySymbol]; ok && maxJump > 0 && prev.ClosePrice > 0 && r.ClosePrice > 0 {
+			change := (r.ClosePrice - prev.ClosePrice) / prev.ClosePrice * 100
+			if math.Abs(change) > maxJump && !actionBetween(actionDates[r.CompanySymbol], prev.Date, r.Date) {
+				flag(severityWarning, "price_jump", "close %.3f -> %.3f (%+.1f%%) since %s with no corporate action",
+					prev.ClosePrice, r.ClosePrice, change, prev.Date.Format("2006-01-02"))
+			}
+		}
+		lastTrade[r.CompanySymbol] = r
+	}
+	return issues
+}
+
+// actionBetween reports whether any date falls after from and on or before to
+func actionBetween(dates []time.Time, from, to time.Time) bool {
+	for _, d := range dates {
+		if d.After(from) && !d.After(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIndexChanges flags the dates of the indexes.csv at path whose ISX60 change differs from the
+// one published in the report by more than tolerance percentage points. A missing file or a
+// tolerance <= 0 flags nothing.
+func checkIndexChanges(path string, tolerance float64) []qualityIssue {
+	if tolerance <= 0 {
+		return nil
+	}
+	points, err := indices.LoadCSV(path)
+	if err != nil {
+		return nil
+	}
+	indices.FillChanges(points)
+	var issues []qualityIssue
+	for _, m := range indices.CheckChanges(points, tolerance) {
+		issues = append(issues, qualityIssue{Date: m.Date, Symbol: m.Index, Severity: severityWarning, Check: indices.MismatchCheck, Detail: m.Detail()})
+	}
+	return issues
+}
+
+// saveQualityReport writes data_quality_report.csv, replacing the report of an earlier run unless
+// appendRows is set
+func saveQualityReport(filePath string, issues []qualityIssue, appendRows bool) error {
+	file, fresh, err := openOutput(filePath, appendRows)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	if fresh {
+		if err := writer.Write([]string{"Date", "Symbol", "Severity", "Check", "Detail"}); err != nil {
+			return err
+		}
+	}
+	for _, issue := range issues {
+		if err := writer.Write([]string{issue.Date.Format("2006-01-02"), issue.Symbol, issue.Severity, issue.Check, issue.Detail}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"time"
+
+	"isxcli/internal/parser"
+)
+
+// resampleHeader is the header of the weekly and monthly datasets
+var resampleHeader = []string{
+	"PeriodStart", "PeriodEnd", "Symbol", "CompanyName",
+	"OpenPrice", "HighPrice", "LowPrice", "ClosePrice",
+	"Volume", "Value", "NumTrades", "TradingDays",
+}
+
+// resampledBar is the OHLC aggregate of one symbol over one period
+type resampledBar struct {
+	PeriodStart time.Time
+	PeriodEnd   time.Time // last trading day in the period
+	Symbol      string
+	CompanyName string
+	Open        float64
+	High        float64
+	Low         float64
+	Close       float64
+	Volume      int64
+	Value       float64
+	NumTrades   int64
+	TradingDays int
+}
+
+// weekStart returns the Sunday starting the week of t, the first trading day of the ISX week
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -int(t.Weekday()))
+}
+
+// monthStart returns the first day of the month of t
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// resample aggregates daily records into periods starting at period(date). Only days with
+// actual trades count: open is the first trade's open, close the last close, high and low the
+// extremes, and volume, value and trades are summed. Periods without trades have no bar.
+func resample(records []parser.TradeRecord, period func(time.Time) time.Time) []resampledBar {
+	type key struct {
+		symbol string
+		start  time.Time
+	}
+	bars := make(map[key]*resampledBar)
+
+	sorted := make([]parser.TradeRecord, 0, len(records))
+	for _, r := range records {
+		if r.TradingStatus {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	for _, r := range sorted {
+		k := key{r.CompanySymbol, period(r.Date)}
+		open, high, low := r.OpenPrice, r.HighPrice, r.LowPrice
+		// Some reports leave the intraday prices empty; fall back to the close
+		if open == 0 {
+			open = r.ClosePrice
+		}
+		if high == 0 {
+			high = r.ClosePrice
+		}
+		if low == 0 {
+			low = r.ClosePrice
+		}
+
+		bar, ok := bars[k]
+		if !ok {
+			bar = &resampledBar{PeriodStart: k.start, Symbol: r.CompanySymbol, Open: open, High: high, Low: low}
+			bars[k] = bar
+		}
+		bar.PeriodEnd = r.Date
+		bar.CompanyName = r.CompanyName
+		if high > bar.High {
+			bar.High = high
+		}
+		if low < bar.Low {
+			bar.Low = low
+		}
+		bar.Close = r.ClosePrice
+		bar.Volume += r.Volume
+		bar.Value += r.Value
+		bar.NumTrades += r.NumTrades
+		bar.TradingDays++
+	}
+
+	result := make([]resampledBar, 0, len(bars))
+	for _, bar := range bars {
+		result = append(result, *bar)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].PeriodStart.Equal(result[j].PeriodStart) {
+			return result[i].PeriodStart.Before(result[j].PeriodStart)
+		}
+		return result[i].Symbol < result[j].Symbol
+	})
+	return result
+}
+
+// saveResampledCSV writes resampled bars as CSV
+func saveResampledCSV(filePath string, bars []resampledBar) error {
+	file, _, err := openOutput(filePath, false)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	if err := writer.Write(resampleHeader); err != nil {
+		return err
+	}
+	for _, b := range bars {
+		if err := writer.Write([]string{
+			b.PeriodStart.Format("2006-01-02"),
+			b.PeriodEnd.Format("2006-01-02"),
+			b.Symbol,
+			b.CompanyName,
+			fmt.Sprintf("%.3f", b.Open),
+			fmt.Sprintf("%.3f", b.High),
+			fmt.Sprintf("%.3f", b.Low),
+			fmt.Sprintf("%.3f", b.Close),
+			fmt.Sprintf("%d", b.Volume),
+			fmt.Sprintf("%.2f", b.Value),
+			fmt.Sprintf("%d", b.NumTrades),
+			fmt.Sprintf("%d", b.TradingDays),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,262 @@
+package processor
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"isxcli/internal/analytics"
+	"isxcli/internal/parser"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite output. Rows are keyed so every run upserts
+// instead of appending duplicates.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS trades (
+	date               TEXT NOT NULL,
+	symbol             TEXT NOT NULL,
+	company_name       TEXT,
+	company_name_ar    TEXT,
+	sector             TEXT,
+	industry           TEXT,
+	open               REAL,
+	high               REAL,
+	low                REAL,
+	average            REAL,
+	prev_average       REAL,
+	close              REAL,
+	prev_close         REAL,
+	change             REAL,
+	change_percent     REAL,
+	num_trades         INTEGER,
+	volume             INTEGER,
+	value              REAL,
+	trading_status     INTEGER,
+	foreign_buy_volume  INTEGER,
+	foreign_buy_value   REAL,
+	foreign_sell_volume INTEGER,
+	foreign_sell_value  REAL,
+	shares_outstanding INTEGER,
+	market_cap         REAL,
+	listing_status     TEXT,
+	adj_open           REAL,
+	adj_high           REAL,
+	adj_low            REAL,
+	adj_close          REAL,
+	PRIMARY KEY (date, symbol)
+);
+CREATE INDEX IF NOT EXISTS trades_symbol ON trades (symbol, date);
+
+CREATE TABLE IF NOT EXISTS indices (
+	date  TEXT NOT NULL,
+	name  TEXT NOT NULL,
+	value REAL,
+	PRIMARY KEY (date, name)
+);
+
+CREATE TABLE IF NOT EXISTS tickers (
+	symbol          TEXT PRIMARY KEY,
+	company_name    TEXT,
+	company_name_ar TEXT,
+	sector          TEXT,
+	industry        TEXT,
+	first_date      TEXT,
+	last_date       TEXT,
+	last_price      REAL,
+	trading_days    INTEGER
+);
+`
+
+const upsertTrade = `
+INSERT INTO trades (date, symbol, company_name, company_name_ar, sector, industry,
+	open, high, low, average, prev_average, close, prev_close, change, change_percent,
+	num_trades, volume, value, trading_status,
+	foreign_buy_volume, foreign_buy_value, foreign_sell_volume, foreign_sell_value,
+	shares_outstanding, market_cap, listing_status,
+	adj_open, adj_high, adj_low, adj_close)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (date, symbol) DO UPDATE SET
+	company_name = excluded.company_name, company_name_ar = excluded.company_name_ar,
+	sector = excluded.sector, industry = excluded.industry,
+	open = excluded.open, high = excluded.high, low = excluded.low, average = excluded.average,
+	prev_average = excluded.prev_average, close = excluded.close, prev_close = excluded.prev_close,
+	change = excluded.change, change_percent = excluded.change_percent,
+	num_trades = excluded.num_trades, volume = excluded.volume, value = excluded.value,
+	trading_status = excluded.trading_status,
+	foreign_buy_volume = excluded.foreign_buy_volume, foreign_buy_value = excluded.foreign_buy_value,
+	foreign_sell_volume = excluded.foreign_sell_volume, foreign_sell_value = excluded.foreign_sell_value,
+	shares_outstanding = excluded.shares_outstanding, market_cap = excluded.market_cap,
+	listing_status = excluded.listing_status,
+	adj_open = excluded.adj_open, adj_high = excluded.adj_high,
+	adj_low = excluded.adj_low, adj_close = excluded.adj_close`
+
+const upsertIndex = `
+INSERT INTO indices (date, name, value) VALUES (?, ?, ?)
+ON CONFLICT (date, name) DO UPDATE SET value = excluded.value`
+
+const upsertTicker = `
+INSERT INTO tickers (symbol, company_name, company_name_ar, sector, industry, first_date, last_date, last_price, trading_days)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (symbol) DO UPDATE SET
+	company_name = excluded.company_name, company_name_ar = excluded.company_name_ar,
+	sector = excluded.sector, industry = excluded.industry,
+	first_date = excluded.first_date, last_date = excluded.last_date,
+	last_price = excluded.last_price, trading_days = excluded.trading_days`
+
+// saveSQLite upserts the records, the index values of indexesCSV (written by indexcsv, skipped
+// when missing) and a summary of every ticker into the SQLite database at path
+func saveSQLite(path string, records []parser.TradeRecord, indexesCSV string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("create tables: %v", err)
+	}
+	// Databases created before a column existed get it added
+	for _, column := range []string{"adj_open", "adj_high", "adj_low", "adj_close"} {
+		if _, err := db.Exec("ALTER TABLE trades ADD COLUMN " + column + " REAL"); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return fmt.Errorf("add column %s: %v", column, err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	trades, err := tx.Prepare(upsertTrade)
+	if err != nil {
+		return err
+	}
+	defer trades.Close()
+	for _, r := range records {
+		if _, err := trades.Exec(
+			r.Date.Format("2006-01-02"), r.CompanySymbol, r.CompanyName, r.CompanyNameAr, r.Sector, r.Industry,
+			r.OpenPrice, r.HighPrice, r.LowPrice, r.AveragePrice, r.PrevAveragePrice, r.ClosePrice, r.PrevClosePrice,
+			r.Change, r.ChangePercent, r.NumTrades, r.Volume, r.Value, r.TradingStatus,
+			r.ForeignBuyVolume, r.ForeignBuyValue, r.ForeignSellVolume, r.ForeignSellValue,
+			r.SharesOutstanding, r.MarketCap, r.ListingStatus,
+			r.AdjOpenPrice, r.AdjHighPrice, r.AdjLowPrice, r.AdjClosePrice,
+		); err != nil {
+			return fmt.Errorf("upsert %s %s: %v", r.CompanySymbol, r.Date.Format("2006-01-02"), err)
+		}
+	}
+
+	indices, err := tx.Prepare(upsertIndex)
+	if err != nil {
+		return err
+	}
+	defer indices.Close()
+	values, err := loadIndexValues(indexesCSV)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, v := range values {
+		if _, err := indices.Exec(v.date, v.name, v.value); err != nil {
+			return fmt.Errorf("upsert %s %s: %v", v.name, v.date, err)
+		}
+	}
+
+	tickers, err := tx.Prepare(upsertTicker)
+	if err != nil {
+		return err
+	}
+	defer tickers.Close()
+	for _, t := range summarizeTickers(records) {
+		if _, err := tickers.Exec(t.symbol, t.name, t.nameAr, t.sector, t.industry,
+			t.first, t.last, t.lastPrice, t.tradingDays); err != nil {
+			return fmt.Errorf("upsert ticker %s: %v", t.symbol, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// indexValue is one value of a market index
+type indexValue struct {
+	date  string
+	name  string
+	value float64
+}
+
+// loadIndexValues reads indexes.csv: a Date column followed by one column per index
+func loadIndexValues(path string) ([]indexValue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	var values []indexValue
+	for _, row := range rows[1:] {
+		for j := 1; j < len(row) && j < len(header); j++ {
+			if !analytics.IsIndexLevel(header[j]) {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(row[j]), 64)
+			if err != nil {
+				continue // index not published that day
+			}
+			values = append(values, indexValue{date: row[0], name: header[j], value: value})
+		}
+	}
+	return values, nil
+}
+
+// tickerRow summarises the history of one ticker for the tickers table
+type tickerRow struct {
+	symbol, name, nameAr, sector, industry string
+	first, last                            string
+	lastPrice                              float64
+	tradingDays                            int
+}
+
+// summarizeTickers summarises records ordered by date. Only days with actual trades count as
+// trading days and set the last price.
+func summarizeTickers(records []parser.TradeRecord) []tickerRow {
+	bySymbol := make(map[string]*tickerRow)
+	for _, r := range records {
+		t := bySymbol[r.CompanySymbol]
+		if t == nil {
+			t = &tickerRow{symbol: r.CompanySymbol, first: r.Date.Format("2006-01-02")}
+			bySymbol[r.CompanySymbol] = t
+		}
+		t.name, t.sector, t.industry = r.CompanyName, r.Sector, r.Industry
+		if r.CompanyNameAr != "" {
+			t.nameAr = r.CompanyNameAr
+		}
+		t.last = r.Date.Format("2006-01-02")
+		if r.TradingStatus {
+			t.lastPrice = r.ClosePrice
+			t.tradingDays++
+		}
+	}
+
+	tickers := make([]tickerRow, 0, len(bySymbol))
+	for _, t := range bySymbol {
+		tickers = append(tickers, *t)
+	}
+	sort.Slice(tickers, func(i, j int) bool { return tickers[i].symbol < tickers[j].symbol })
+	return tickers
+}
@@ -0,0 +1,113 @@
+package reportfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"isxcli/internal/formats"
+)
+
+// ManifestName is the file in the downloads directory recording what was downloaded
+const ManifestName = ".manifest.json"
+
+// ManifestEntry describes the remote version of a downloaded report
+type ManifestEntry struct {
+	Date         string    `json:"date,omitempty"`
+	URL          string    `json:"url"`
+	Size         int64     `json:"size,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+
+	// Format is the fingerprint taken when the report was first processed
+	Format *formats.Fingerprint `json:"format,omitempty"`
+}
+
+// Manifest tracks downloaded reports so republished (corrected) reports can be detected, and
+// lists the report dates that must be reprocessed because their file changed.
+type Manifest struct {
+	Files     map[string]ManifestEntry `json:"files"`
+	Reprocess []string                 `json:"reprocess,omitempty"`
+
+	path string
+}
+
+// LoadManifest reads the manifest in dir, returning an empty one when it doesn't exist yet
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Files: make(map[string]ManifestEntry), path: filepath.Join(dir, ManifestName)}
+
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return m, err
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]ManifestEntry)
+	}
+	return m, nil
+}
+
+// Save writes the manifest atomically
+func (m *Manifest) Save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// MarkReprocess flags a report date (YYYY-MM-DD) for reprocessing
+func (m *Manifest) MarkReprocess(date string) {
+	idx := sort.SearchStrings(m.Reprocess, date)
+	if idx < len(m.Reprocess) && m.Reprocess[idx] == date {
+		return
+	}
+	m.Reprocess = append(m.Reprocess, "")
+	copy(m.Reprocess[idx+1:], m.Reprocess[idx:])
+	m.Reprocess[idx] = date
+}
+
+// ReprocessDates returns the flagged dates as a set
+func (m *Manifest) ReprocessDates() map[string]bool {
+	dates := make(map[string]bool, len(m.Reprocess))
+	for _, d := range m.Reprocess {
+		dates[d] = true
+	}
+	return dates
+}
+
+// ClearReprocess removes dates from the reprocess list once they have been processed
+func (m *Manifest) ClearReprocess(dates map[string]bool) {
+	var remaining []string
+	for _, d := range m.Reprocess {
+		if !dates[d] {
+			remaining = append(remaining, d)
+		}
+	}
+	m.Reprocess = remaining
+}
+
+// Fingerprint returns the format fingerprint recorded for a report file, or nil
+func (m *Manifest) Fingerprint(name string) *formats.Fingerprint {
+	return m.Files[name].Format
+}
+
+// SetFingerprint records the format fingerprint of a report file. Files processed without having
+// been downloaded by the scraper get an entry of their own.
+func (m *Manifest) SetFingerprint(name string, fp formats.Fingerprint) {
+	entry := m.Files[name]
+	entry.Format = &fp
+	m.Files[name] = entry
+}
@@ -0,0 +1,199 @@
+package reportfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPattern is the historical "2025 06 24 ISX Daily Report.xlsx" naming scheme
+const DefaultPattern = "{YYYY} {MM} {DD} ISX Daily Report.xlsx"
+
+// EnvVar selects the filename template for all tools when no flag is given
+const EnvVar = "ISX_REPORT_TEMPLATE"
+
+// Default is the template for DefaultPattern
+var Default = MustParse(DefaultPattern)
+
+// placeholderRe matches the date placeholders supported in templates
+var placeholderRe = regexp.MustCompile(`\{(YYYY|MM|DD)\}`)
+
+// Template describes how daily report files are named (and optionally foldered) on disk.
+// Patterns use {YYYY}, {MM} and {DD} placeholders and "/" to separate subfolders, e.g.
+// "{YYYY}/{YYYY}-{MM}-{DD} ISX Daily Report.xlsx".
+type Template struct {
+	pattern string
+	re      *regexp.Regexp
+	groups  []string
+}
+
+// File is a daily report found on disk
+type File struct {
+	Path string // path including the directory that was searched
+	Name string // path relative to the searched directory
+	Date time.Time
+}
+
+// Parse compiles a filename template
+func Parse(pattern string) (*Template, error) {
+	pattern = strings.TrimSpace(filepath.ToSlash(pattern))
+	if pattern == "" {
+		return nil, fmt.Errorf("empty filename template")
+	}
+	for _, p := range []string{"{YYYY}", "{MM}", "{DD}"} {
+		if !strings.Contains(pattern, p) {
+			return nil, fmt.Errorf("filename template %q is missing %s", pattern, p)
+		}
+	}
+	if strings.HasPrefix(pattern, "/") || strings.Contains(pattern, "..") {
+		return nil, fmt.Errorf("filename template %q must be a relative path", pattern)
+	}
+
+	var expr strings.Builder
+	var groups []string
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		name := pattern[loc[2]:loc[3]]
+		if name == "YYYY" {
+			expr.WriteString(`(\d{4})`)
+		} else {
+			expr.WriteString(`(\d{2})`)
+		}
+		groups = append(groups, name)
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename template %q: %v", pattern, err)
+	}
+	return &Template{pattern: pattern, re: re, groups: groups}, nil
+}
+
+// MustParse is like Parse but panics on error
+func MustParse(pattern string) *Template {
+	t, err := Parse(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// FromEnv returns the template configured in ISX_REPORT_TEMPLATE, or Default when it isn't set.
+// An invalid template is an error rather than falling back to Default, which would download
+// and look for reports under names the user didn't ask for.
+func FromEnv() (*Template, error) {
+	pattern := os.Getenv(EnvVar)
+	if pattern == "" {
+		return Default, nil
+	}
+	t, err := Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", EnvVar, err)
+	}
+	return t, nil
+}
+
+// DefaultPatternFromEnv returns the pattern to use as a command-line flag default: that of
+// ISX_REPORT_TEMPLATE as it is, so an invalid one is reported when the flag is parsed
+func DefaultPatternFromEnv() string {
+	if pattern := os.Getenv(EnvVar); pattern != "" {
+		return pattern
+	}
+	return DefaultPattern
+}
+
+// Pattern returns the template source
+func (t *Template) Pattern() string {
+	return t.pattern
+}
+
+// Name returns the relative path of the report for date, using OS path separators
+func (t *Template) Name(date time.Time) string {
+	name := strings.NewReplacer(
+		"{YYYY}", date.Format("2006"),
+		"{MM}", date.Format("01"),
+		"{DD}", date.Format("02"),
+	).Replace(t.pattern)
+	return filepath.FromSlash(name)
+}
+
+// Date extracts the report date from a relative path produced by Name
+func (t *Template) Date(name string) (time.Time, bool) {
+	m := t.re.FindStringSubmatch(filepath.ToSlash(name))
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	values := make(map[string]string)
+	for i, g := range t.groups {
+		if prev, ok := values[g]; ok && prev != m[i+1] {
+			return time.Time{}, false // repeated placeholder with a different value
+		}
+		values[g] = m[i+1]
+	}
+
+	date, err := time.Parse("2006-01-02", values["YYYY"]+"-"+values["MM"]+"-"+values["DD"])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// Find returns every report below dir matching the template, sorted by date. Files using
+// the default naming scheme are recognised too, so existing archives keep working after
+// switching templates.
+func (t *Template) Find(dir string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), "~$") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		date, ok := t.Date(rel)
+		if !ok && t != Default {
+			date, ok = Default.Date(d.Name())
+		}
+		if ok {
+			files = append(files, File{Path: path, Name: rel, Date: date})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Date.Before(files[j].Date) })
+	return files, nil
+}
+
+// Latest returns the most recent report date below dir
+func (t *Template) Latest(dir string) (time.Time, bool) {
+	files, err := t.Find(dir)
+	if err != nil || len(files) == 0 {
+		return time.Time{}, false
+	}
+	return files[len(files)-1].Date, true
+}
@@ -0,0 +1,96 @@
+package reportfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestTemplateRoundTrip verifies that names produced by a template parse back to the same date.
+func TestTemplateRoundTrip(t *testing.T) {
+	date := time.Date(2025, 6, 24, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]string{
+		DefaultPattern:                         "2025 06 24 ISX Daily Report.xlsx",
+		"{YYYY}-{MM}-{DD}_isx_daily.xlsx":      "2025-06-24_isx_daily.xlsx",
+		"{YYYY}/{YYYY} {MM} {DD} ISX (1).xlsx": filepath.FromSlash("2025/2025 06 24 ISX (1).xlsx"),
+	}
+	for pattern, wantName := range cases {
+		tmpl, err := Parse(pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", pattern, err)
+		}
+		name := tmpl.Name(date)
+		if name != wantName {
+			t.Errorf("Name with %q: want %q, got %q", pattern, wantName, name)
+		}
+		got, ok := tmpl.Date(name)
+		if !ok || !got.Equal(date) {
+			t.Errorf("Date(%q) with %q: want %s, got %s (ok=%v)", name, pattern, date.Format("2006-01-02"), got.Format("2006-01-02"), ok)
+		}
+	}
+
+	if _, err := Parse("report.xlsx"); err == nil {
+		t.Error("expected error for template without date placeholders")
+	}
+	if _, ok := MustParse("{YYYY}/{YYYY}-{MM}-{DD}.xlsx").Date("2024/2025-01-01.xlsx"); ok {
+		t.Error("expected mismatched repeated year to be rejected")
+	}
+}
+
+// TestFind verifies that Find walks subfolders and also recognises default-named files.
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := MustParse("{YYYY}/{YYYY}-{MM}-{DD}.xlsx")
+
+	for _, name := range []string{
+		"2025/2025-01-02.xlsx",
+		"2024/2024-12-30.xlsx",
+		"2024 12 31 ISX Daily Report.xlsx",
+		"notes.txt",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := tmpl.Find(dir)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	want := []string{"2024-12-30", "2024-12-31", "2025-01-02"}
+	if len(files) != len(want) {
+		t.Fatalf("expected %d files, got %d", len(want), len(files))
+	}
+	for i, f := range files {
+		if f.Date.Format("2006-01-02") != want[i] {
+			t.Errorf("file %d: want %s, got %s", i, want[i], f.Date.Format("2006-01-02"))
+		}
+	}
+}
+
+// TestFromEnv verifies an invalid template in the environment is an error, not the default.
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	if tmpl, err := FromEnv(); err != nil || tmpl != Default {
+		t.Errorf("unset: got %v, %v", tmpl, err)
+	}
+
+	t.Setenv(EnvVar, "{YYYY}/{YYYY}-{MM}-{DD}.xlsx")
+	if tmpl, err := FromEnv(); err != nil || tmpl.Pattern() != "{YYYY}/{YYYY}-{MM}-{DD}.xlsx" {
+		t.Errorf("valid: got %v, %v", tmpl, err)
+	}
+
+	t.Setenv(EnvVar, "{YYYY}-{MM}.xlsx")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error for a template missing {DD}")
+	}
+	if got := DefaultPatternFromEnv(); got != "{YYYY}-{MM}.xlsx" {
+		t.Errorf("DefaultPatternFromEnv: got %q", got)
+	}
+}
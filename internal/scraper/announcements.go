@@ -0,0 +1,189 @@
+package scraper
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// announcementIndexName is the CSV listing every downloaded announcement
+const announcementIndexName = "index.csv"
+
+// tickerRe matches ISX ticker codes such as "BBOB" or "IMOS" in titles and file names
+var tickerRe = regexp.MustCompile(`\b([A-Z]{4,5})\b`)
+
+// announcement is one company disclosure downloaded from the portal
+type announcement struct {
+	Date   string
+	Ticker string
+	Title  string
+	File   string
+	URL    string
+}
+
+// announcementTicker extracts the company ticker from a listing row, falling back to "UNKNOWN"
+func announcementTicker(r reportRow) string {
+	for _, text := range []string{r.Title, filepath.Base(r.Href)} {
+		if m := tickerRe.FindStringSubmatch(text); m != nil && m[1] != "ISX" {
+			return m[1]
+		}
+	}
+	return "UNKNOWN"
+}
+
+// loadAnnouncementIndex reads the existing index, returning no entries when it doesn't exist yet
+func loadAnnouncementIndex(path string) ([]announcement, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []announcement
+	for i, rec := range records {
+		if i == 0 || len(rec) < 5 {
+			continue
+		}
+		entries = append(entries, announcement{Date: rec[0], Ticker: rec[1], Title: rec[2], File: rec[3], URL: rec[4]})
+	}
+	return entries, nil
+}
+
+// saveAnnouncementIndex writes the index sorted by date and ticker
+func saveAnnouncementIndex(path string, entries []announcement) error {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Ticker < entries[j].Ticker
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"Date", "Ticker", "Title", "File", "URL"})
+	for _, e := range entries {
+		w.Write([]string{e.Date, e.Ticker, e.Title, e.File, e.URL})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// scrapeAnnouncements downloads company announcements/disclosures for the given range into
+// AnnouncementsDir/<ticker>/ and records them in AnnouncementsDir/index.csv. Announcements already in the index are skipped.
+func (s *Scraper) scrapeAnnouncements(fromSite, toSite string) chromedp.Tasks {
+	dir, reportType := s.opts.AnnouncementsDir, s.opts.AnnouncementType
+	actions := s.searchActionsForType(fromSite, toSite, reportType)
+	actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create announcements dir: %v", err)
+		}
+
+		indexPath := filepath.Join(dir, announcementIndexName)
+		entries, err := loadAnnouncementIndex(indexPath)
+		if err != nil {
+			return fmt.Errorf("failed to read announcement index: %v", err)
+		}
+		known := make(map[string]bool)
+		for _, e := range entries {
+			known[s.relativeHref(e.URL)] = true
+		}
+
+		downloaded := 0
+		for page := 1; ; page++ {
+			s.log.emit(Event{Type: EventPage, Page: page, Status: "started", Message: fmt.Sprintf("[ANNOUNCEMENTS] Scraping page %d...", page)})
+			rows, err := readReportRows(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range rows {
+				if err := ctx.Err(); err != nil {
+					saveAnnouncementIndex(indexPath, entries)
+					return err
+				}
+				fullURL := r.Href
+				if !strings.HasPrefix(r.Href, "http") {
+					fullURL = s.activeBase + r.Href
+				}
+				if known[s.relativeHref(fullURL)] {
+					continue
+				}
+
+				date := ""
+				if t, err := time.Parse("02/01/2006", r.Date); err == nil {
+					date = t.Format("2006-01-02")
+				}
+				ticker := announcementTicker(r)
+				fname := filepath.Base(r.Href)
+				if date != "" {
+					fname = date + "_" + fname
+				}
+
+				tickerDir := filepath.Join(dir, ticker)
+				if err := os.MkdirAll(tickerDir, 0o755); err != nil {
+					return err
+				}
+				dest := filepath.Join(tickerDir, fname)
+				source, _, err := s.downloadWithFailover(ctx, fullURL, dest)
+				if err != nil {
+					if ctx.Err() != nil {
+						saveAnnouncementIndex(indexPath, entries)
+						return ctx.Err()
+					}
+					s.log.emit(Event{Type: EventDownload, File: fname, URL: fullURL, Status: "failed", Error: err.Error(), Message: fmt.Sprintf("failed to download announcement %s: %v", fname, err)})
+					continue
+				}
+				s.log.emit(Event{Type: EventDownload, File: fname, Date: date, URL: source, Status: "completed", Message: fmt.Sprintf(" --> saved announcement %s/%s from %s", ticker, fname, source)})
+
+				entries = append(entries, announcement{
+					Date:   date,
+					Ticker: ticker,
+					Title:  r.Title,
+					File:   filepath.ToSlash(filepath.Join(ticker, fname)),
+					URL:    fullURL,
+				})
+				known[s.relativeHref(fullURL)] = true
+				downloaded++
+				time.Sleep(500 * time.Millisecond)
+			}
+
+			if err := saveAnnouncementIndex(indexPath, entries); err != nil {
+				return fmt.Errorf("failed to write announcement index: %v", err)
+			}
+
+			hasNext, err := nextPage(ctx)
+			if err != nil {
+				return err
+			}
+			if !hasNext {
+				break
+			}
+		}
+
+		s.result.Announcements = downloaded
+		s.log.emit(Event{Type: EventSummary, Status: "announcements", Count: downloaded, Message: fmt.Sprintf("[ANNOUNCEMENTS] %d new announcements downloaded", downloaded)})
+		return nil
+	}))
+	return chromedp.Tasks(actions)
+}
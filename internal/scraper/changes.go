@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"isxcli/internal/reportfile"
+)
+
+// remoteFile is the metadata the portal reports for a downloadable file
+type remoteFile struct {
+	Size         int64
+	ETag         string
+	LastModified string
+}
+
+func remoteFileFrom(resp *http.Response) remoteFile {
+	return remoteFile{
+		Size:         resp.ContentLength,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// headFile fetches the metadata of url without downloading it
+func headFile(ctx context.Context, url string) (remoteFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return remoteFile{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return remoteFile{}, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return remoteFile{}, fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return remoteFileFrom(resp), nil
+}
+
+// remoteChanged reports whether the portal copy differs from what was downloaded. Reports
+// downloaded before the manifest existed are compared by size only.
+func remoteChanged(entry reportfile.ManifestEntry, known bool, localSize int64, remote remoteFile) bool {
+	if !known {
+		return remote.Size > 0 && remote.Size != localSize
+	}
+	if entry.ETag != "" && remote.ETag != "" {
+		return entry.ETag != remote.ETag
+	}
+	if entry.Size > 0 && remote.Size > 0 {
+		return entry.Size != remote.Size
+	}
+	return entry.LastModified != "" && remote.LastModified != "" && entry.LastModified != remote.LastModified
+}
+
+// recordDownload stores the remote version of a downloaded report in the manifest
+func (s *Scraper) recordDownload(name, date, url string, info remoteFile) {
+	if s.manifest == nil {
+		return
+	}
+	s.manifest.Files[name] = reportfile.ManifestEntry{
+		Date:         date,
+		URL:          url,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		DownloadedAt: time.Now(),
+	}
+	if err := s.manifest.Save(); err != nil {
+		s.log.errorf(err, "failed to save download manifest: %v", err)
+	}
+}
+
+// redownloadIfChanged checks an already downloaded report against the portal with a HEAD request.
+// A republished report is downloaded again and its date flagged for reprocessing. It returns true
+// when the report was re-downloaded.
+func (s *Scraper) redownloadIfChanged(ctx context.Context, name, date, url, dest string, localSize int64) bool {
+	if s.manifest == nil {
+		return false
+	}
+	remote, err := s.headWithFailover(ctx, url)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.errorf(err, " !! unable to check %s for changes: %v", name, err)
+		}
+		return false
+	}
+
+	entry, known := s.manifest.Files[name]
+	if !remoteChanged(entry, known, localSize, remote) {
+		if !known {
+			// Adopt reports downloaded before the manifest existed
+			s.recordDownload(name, date, url, remote)
+		}
+		return false
+	}
+
+	s.log.emit(Event{Type: EventDownload, File: name, Date: date, URL: url, Status: "changed", Message: fmt.Sprintf(" --> %s was republished on the portal, downloading again", name)})
+	source, info, err := s.downloadWithFailover(ctx, url, dest)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.emit(Event{Type: EventDownload, File: name, URL: url, Status: "failed", Error: err.Error(), Message: fmt.Sprintf("failed to re-download %s: %v", name, err)})
+		}
+		return false
+	}
+
+	if date != "" {
+		s.manifest.MarkReprocess(date)
+		s.result.Changed = append(s.result.Changed, date)
+	}
+	s.recordDownload(name, date, source, info)
+	s.log.emit(Event{Type: EventDownload, File: name, Date: date, URL: source, Status: "updated", Message: fmt.Sprintf(" --> updated %s, %s marked for reprocessing", name, date)})
+	return true
+}
@@ -0,0 +1,91 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types emitted by the scraper
+const (
+	EventInfo     = "info"
+	EventPage     = "page"
+	EventFile     = "file"
+	EventDownload = "download"
+	EventTiming   = "timing"
+	EventSummary  = "summary"
+	EventError    = "error"
+)
+
+// Event is a single structured progress event. In text mode only Message is printed.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"event"`
+	Page      int       `json:"page,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Date      string    `json:"date,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Count     int       `json:"count,omitempty"`
+	Duration  int64     `json:"duration_ms,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// eventLogger writes scraper progress either as the classic text lines or as JSON lines,
+// and forwards every event to an optional callback
+type eventLogger struct {
+	json    bool
+	out     io.Writer
+	onEvent func(Event)
+	mutex   sync.Mutex
+}
+
+func newEventLogger(format string, out io.Writer, onEvent func(Event)) *eventLogger {
+	if out == nil {
+		out = os.Stdout
+	}
+	return &eventLogger{json: format == "json", out: out, onEvent: onEvent}
+}
+
+// emit writes a single event
+func (l *eventLogger) emit(ev Event) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+	if l.onEvent != nil {
+		l.onEvent(ev)
+	}
+
+	if !l.json {
+		fmt.Fprintln(l.out, ev.Message)
+		return
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal log event: %v\n", err)
+		return
+	}
+	l.out.Write(append(data, '\n'))
+}
+
+// infof emits an informational event with a formatted message
+func (l *eventLogger) infof(format string, args ...interface{}) {
+	l.emit(Event{Type: EventInfo, Message: fmt.Sprintf(format, args...)})
+}
+
+// errorf emits an error event; err may be nil when the message is self-contained
+func (l *eventLogger) errorf(err error, format string, args ...interface{}) {
+	ev := Event{Type: EventError, Message: fmt.Sprintf(format, args...)}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	l.emit(ev)
+}
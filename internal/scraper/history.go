@@ -0,0 +1,146 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// probeTimeout bounds a single portal search while probing for the earliest report;
+// an empty result page never shows the report table, so a timeout means "no reports".
+const probeTimeout = 90 * time.Second
+
+// dateWindow is an inclusive date range searched on the portal in one go
+type dateWindow struct {
+	From time.Time
+	To   time.Time
+}
+
+// monthlyWindows splits [start, end] into calendar-month windows. The first and last
+// windows are clamped to start and end.
+func monthlyWindows(start, end time.Time) []dateWindow {
+	var windows []dateWindow
+	for from := start; !from.After(end); {
+		monthEnd := time.Date(from.Year(), from.Month()+1, 1, 0, 0, 0, 0, from.Location()).AddDate(0, 0, -1)
+		if monthEnd.After(end) {
+			monthEnd = end
+		}
+		windows = append(windows, dateWindow{From: from, To: monthEnd})
+		from = monthEnd.AddDate(0, 0, 1)
+	}
+	return windows
+}
+
+// probeWindow searches the portal for daily reports in w and returns the earliest report
+// date listed on the first result page.
+func (s *Scraper) probeWindow(ctx context.Context, w dateWindow) (time.Time, bool, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	if err := chromedp.Run(probeCtx, s.searchActions(w.From.Format("02/01/2006"), w.To.Format("02/01/2006"))...); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+
+	rows, err := readReportRows(probeCtx)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var earliest time.Time
+	for _, r := range rows {
+		if !s.lang.isDailyReport(r) {
+			continue
+		}
+		t, err := time.Parse("02/01/2006", r.Date)
+		if err != nil {
+			continue
+		}
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest, !earliest.IsZero(), nil
+}
+
+// probeEarliestReport finds the first month at or after floor that has daily reports on the
+// portal, probing year by year and then month by month within the first year that has data.
+func (s *Scraper) probeEarliestReport(ctx context.Context, floor, until time.Time) (time.Time, error) {
+	for year := floor.Year(); year <= until.Year(); year++ {
+		yearWindow := dateWindow{
+			From: time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC),
+		}
+		if yearWindow.From.Before(floor) {
+			yearWindow.From = floor
+		}
+		if yearWindow.To.After(until) {
+			yearWindow.To = until
+		}
+
+		s.log.infof("[FULL-HISTORY] Probing %d for daily reports...", year)
+		_, found, err := s.probeWindow(ctx, yearWindow)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !found {
+			continue
+		}
+
+		for _, w := range monthlyWindows(yearWindow.From, yearWindow.To) {
+			earliest, found, err := s.probeWindow(ctx, w)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if found {
+				return earliest, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("no daily reports found between %s and %s", floor.Format("2006-01-02"), until.Format("2006-01-02"))
+}
+
+// runFullHistory discovers the earliest available report and backfills everything from
+// there to Options.To (today when zero), one calendar month per portal search.
+func (s *Scraper) runFullHistory(ctx context.Context) error {
+	until := s.opts.To
+	if until.IsZero() {
+		until = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+
+	earliest, err := s.probeEarliestReport(ctx, s.opts.HistoryFloor, until)
+	if err != nil {
+		return err
+	}
+	s.result.Earliest = earliest
+	s.log.emit(Event{
+		Type:    EventInfo,
+		Date:    earliest.Format("2006-01-02"),
+		Message: fmt.Sprintf("[FULL-HISTORY] Earliest available daily report: %s", earliest.Format("2006-01-02")),
+	})
+
+	start := time.Date(earliest.Year(), earliest.Month(), 1, 0, 0, 0, 0, time.UTC)
+	windows := monthlyWindows(start, until)
+	for i, w := range windows {
+		fromSite, toSite := w.From.Format("02/01/2006"), w.To.Format("02/01/2006")
+		s.log.infof("[FULL-HISTORY] Window %d/%d: %s to %s", i+1, len(windows), w.From.Format("2006-01-02"), w.To.Format("2006-01-02"))
+
+		// A search without results never renders the report table, so check first
+		if _, found, err := s.probeWindow(ctx, w); err != nil {
+			return err
+		} else if !found {
+			s.log.infof("[FULL-HISTORY] No daily reports in window, skipping")
+			continue
+		}
+
+		if err := s.scrapeRange(ctx, fromSite, toSite); err != nil {
+			return fmt.Errorf("window %s - %s: %w", w.From.Format("2006-01-02"), w.To.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// portalLanguage holds what differs between the English and Arabic versions of the portal
+type portalLanguage struct {
+	Code         string
+	SearchButton string
+	SearchBy     chromedp.QueryOption
+	DailyLabels  []string // report type column values of daily reports
+}
+
+// portalLanguages are the supported portal versions. Some reports are published on the Arabic
+// page first (or only), so scraping both and deduplicating by date gives the most complete set.
+var portalLanguages = map[string]portalLanguage{
+	"en": {
+		Code:         "en",
+		SearchButton: `/html/body/div[2]/div/div[3]/div[3]/div[2]/div[4]/div/div[1]/form/div[8]/input`,
+		SearchBy:     chromedp.BySearch,
+		DailyLabels:  []string{"daily"},
+	},
+	"ar": {
+		// The right-to-left layout moves the form, so locate the search button by type
+		Code:         "ar",
+		SearchButton: `form input[type='submit']`,
+		SearchBy:     chromedp.ByQuery,
+		DailyLabels:  []string{"يومي", "يومية", "التقرير اليومي", "daily"},
+	},
+}
+
+// ParseLanguages parses a comma separated list of portal languages such as "en,ar"
+func ParseLanguages(list string) ([]string, error) {
+	var langs []string
+	seen := make(map[string]bool)
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		if _, ok := portalLanguages[code]; !ok {
+			return nil, fmt.Errorf("unsupported portal language %q (use en or ar)", code)
+		}
+		seen[code] = true
+		langs = append(langs, code)
+	}
+	if len(langs) == 0 {
+		return []string{"en"}, nil
+	}
+	return langs, nil
+}
+
+// path returns the report listing path for the language
+func (l portalLanguage) path() string {
+	return "/isxportal/portal/uploadedFilesList.html?currLanguage=" + l.Code
+}
+
+// isDailyReport reports whether a listing row is a daily xlsx report
+func (l portalLanguage) isDailyReport(r reportRow) bool {
+	if !strings.HasSuffix(strings.ToLower(r.Href), ".xlsx") {
+		return false
+	}
+	typ := strings.ToLower(strings.TrimSpace(r.Typ))
+	for _, label := range l.DailyLabels {
+		if typ == label {
+			return true
+		}
+	}
+	return false
+}
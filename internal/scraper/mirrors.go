@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ParseMirrors splits a comma separated list of base URLs, dropping blanks and trailing slashes
+func ParseMirrors(list string) []string {
+	var out []string
+	for _, m := range strings.Split(list, ",") {
+		m = strings.TrimRight(strings.TrimSpace(m), "/")
+		if m == "" {
+			continue
+		}
+		if !strings.HasPrefix(m, "http://") && !strings.HasPrefix(m, "https://") {
+			m = "http://" + m
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// portalSources returns every configured base URL, the active one first
+func (s *Scraper) portalSources() []string {
+	sources := []string{s.activeBase}
+	for _, src := range append([]string{BaseURL}, s.opts.Mirrors...) {
+		if src != s.activeBase {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+// relativeHref strips a known portal base from href so it can be fetched from any source
+func (s *Scraper) relativeHref(href string) string {
+	for _, src := range append([]string{BaseURL}, s.opts.Mirrors...) {
+		if strings.HasPrefix(href, src+"/") {
+			return strings.TrimPrefix(href, src)
+		}
+	}
+	return href
+}
+
+// sourceURLs returns the candidate download URLs for href, one per portal source. Links to
+// hosts other than the portal are returned unchanged.
+func (s *Scraper) sourceURLs(href string) []string {
+	rel := s.relativeHref(href)
+	if strings.HasPrefix(rel, "http") {
+		return []string{rel}
+	}
+	var urls []string
+	for _, src := range s.portalSources() {
+		urls = append(urls, src+rel)
+	}
+	return urls
+}
+
+// navigatePortal opens the report listing, failing over to the mirrors when the current
+// source can't be reached
+func (s *Scraper) navigatePortal() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		var lastErr error
+		for _, base := range s.portalSources() {
+			err := chromedp.Navigate(base + s.lang.path()).Do(ctx)
+			if err == nil {
+				if base != s.activeBase {
+					s.log.infof("[MIRROR] Using %s for the portal", base)
+					s.activeBase = base
+				}
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.log.errorf(err, "[MIRROR] %s unreachable: %v", base, err)
+			lastErr = err
+		}
+		return fmt.Errorf("portal unreachable on all sources: %v", lastErr)
+	})
+}
+
+// downloadWithFailover downloads href into dest, trying each portal source in turn, and
+// returns the URL that served the file along with its remote metadata
+func (s *Scraper) downloadWithFailover(ctx context.Context, href, dest string) (string, remoteFile, error) {
+	var lastErr error
+	for _, url := range s.sourceURLs(href) {
+		info, err := s.downloadFile(ctx, url, dest)
+		if err == nil {
+			return url, info, nil
+		}
+		if ctx.Err() != nil {
+			return "", remoteFile{}, ctx.Err()
+		}
+		s.log.errorf(err, "[MIRROR] download from %s failed: %v", url, err)
+		lastErr = err
+	}
+	return "", remoteFile{}, lastErr
+}
+
+// headWithFailover fetches the remote metadata of href from the first source that answers
+func (s *Scraper) headWithFailover(ctx context.Context, href string) (remoteFile, error) {
+	var lastErr error
+	for _, url := range s.sourceURLs(href) {
+		info, err := headFile(ctx, url)
+		if err == nil {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return remoteFile{}, ctx.Err()
+		}
+		lastErr = err
+	}
+	return remoteFile{}, lastErr
+}
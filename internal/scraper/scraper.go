@@ -0,0 +1,607 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"isxcli/internal/reportfile"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// BaseURL is the primary ISX portal
+	BaseURL = "http://www.isx-iq.net"
+
+	// dailyReportType is the portal's report type value for daily trading reports
+	dailyReportType = "40"
+
+	// StateFileName is the default name of the resume state file kept in the output directory
+	StateFileName = ".scrape_state.json"
+)
+
+// Scrape modes
+const (
+	ModeInitial      = "initial"
+	ModeAccumulative = "accumulative"
+	ModeFullHistory  = "full-history"
+)
+
+// Options configures a scraper run. Zero values fall back to the command-line defaults.
+type Options struct {
+	Mode     string    // initial | accumulative | full-history
+	From     time.Time // start date for initial mode (and accumulative mode with no existing reports)
+	To       time.Time // optional end date; zero keeps the site default
+	OutDir   string
+	Headless bool
+	DryRun   bool
+
+	Languages []string // portal versions to scrape in order, e.g. en, ar (default en)
+
+	Resume    bool   // resume an interrupted scrape from its state file
+	StatePath string // default: OutDir/.scrape_state.json
+
+	HistoryFloor time.Time // earliest date probed in full-history mode
+
+	Announcements    bool
+	AnnouncementsDir string
+	AnnouncementType string
+
+	Mirrors      []string // fallback base URLs tried when BaseURL is unreachable
+	MaxBandwidth int64    // bytes per second, 0 for unlimited
+	NameTemplate *reportfile.Template
+	CheckChanged bool // compare existing reports with the portal and re-download republished ones
+
+	LogFormat string      // text | json
+	Output    io.Writer   // progress output, default os.Stdout
+	OnEvent   func(Event) // optional callback receiving every progress event
+}
+
+// PlannedFile is a single report listed on the portal during a dry run
+type PlannedFile struct {
+	Date   string
+	Name   string
+	URL    string
+	Exists bool
+}
+
+// Result summarises a scraper run
+type Result struct {
+	Downloaded    int           // new reports downloaded
+	Existing      int           // reports skipped because they were already on disk
+	Changed       []string      // dates of reports re-downloaded because the portal copy changed
+	Announcements int           // new announcements downloaded
+	Planned       []PlannedFile // reports found on the portal in dry-run mode
+	Earliest      time.Time     // earliest report found in full-history mode
+	Cancelled     bool          // the run was stopped through its context
+}
+
+// Scraper downloads ISX daily reports from the portal
+type Scraper struct {
+	opts       Options
+	log        *eventLogger
+	activeBase string
+	result     *Result
+	manifest   *reportfile.Manifest
+	lang       portalLanguage
+	seenDates  map[string]bool // report dates already handled this run, to dedupe across languages
+}
+
+// New returns a scraper for opts, filling in defaults for unset fields
+func New(opts Options) *Scraper {
+	if opts.Mode == "" {
+		opts.Mode = ModeInitial
+	}
+	if opts.OutDir == "" {
+		opts.OutDir = "downloads"
+	}
+	if opts.StatePath == "" {
+		opts.StatePath = filepath.Join(opts.OutDir, StateFileName)
+	}
+	if opts.HistoryFloor.IsZero() {
+		opts.HistoryFloor = time.Date(2004, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if opts.AnnouncementsDir == "" {
+		opts.AnnouncementsDir = filepath.Join("data", "announcements")
+	}
+	if opts.AnnouncementType == "" {
+		opts.AnnouncementType = "41"
+	}
+	if opts.NameTemplate == nil {
+		opts.NameTemplate = reportfile.Default
+	}
+	if len(opts.Languages) == 0 {
+		opts.Languages = []string{"en"}
+	}
+	return &Scraper{
+		opts:       opts,
+		log:        newEventLogger(opts.LogFormat, opts.Output, opts.OnEvent),
+		activeBase: BaseURL,
+		lang:       portalLanguages[opts.Languages[0]],
+	}
+}
+
+// Run scrapes the portal according to the options. When ctx is cancelled the browser and any
+// in-flight download are stopped, the final summary is still emitted and the returned Result
+// has Cancelled set alongside the context error.
+func (s *Scraper) Run(ctx context.Context) (*Result, error) {
+	s.result = &Result{}
+	s.activeBase = BaseURL
+	s.lang = portalLanguages[s.opts.Languages[0]]
+	s.seenDates = make(map[string]bool)
+
+	// Create output directory if it doesn't exist (but don't delete existing files)
+	if !s.opts.DryRun {
+		if err := os.MkdirAll(s.opts.OutDir, 0o755); err != nil {
+			s.log.errorf(err, "failed to create output dir: %v", err)
+			return s.result, fmt.Errorf("failed to create output dir: %v", err)
+		}
+		manifest, err := reportfile.LoadManifest(s.opts.OutDir)
+		if err != nil {
+			s.log.errorf(err, "ignoring unreadable download manifest: %v", err)
+		}
+		s.manifest = manifest
+	} else {
+		s.log.infof("[DRY-RUN] No files will be downloaded")
+	}
+	if len(s.opts.Mirrors) > 0 {
+		s.log.infof("[MIRROR] Fallback sources: %s", strings.Join(s.opts.Mirrors, ", "))
+	}
+	if s.opts.MaxBandwidth > 0 {
+		s.log.infof("[THROTTLE] Downloads limited to %s", formatBandwidth(s.opts.MaxBandwidth))
+	}
+
+	// determine fromSite depending on mode
+	var fromSite string
+	if from, afterLatest := s.startDate(); afterLatest {
+		fromSite = from.Format("02/01/2006")
+		s.log.infof("[MODE accumulative] Detected last report date %s. Will start from %s.", from.AddDate(0, 0, -1).Format("2006-01-02"), fromSite)
+	} else if s.opts.Mode != ModeFullHistory {
+		// fallback to the requested start date
+		fromSite = from.Format("02/01/2006")
+		s.log.infof("[MODE initial] Starting from %s (preserving existing files)", from.Format("2006-01-02"))
+	}
+
+	var toSite string
+	if !s.opts.To.IsZero() {
+		toSite = s.opts.To.Format("02/01/2006")
+	}
+
+	// setup ChromeDP
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.Flag("headless", s.opts.Headless))
+	allocCtx, cancel := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancel()
+
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+
+	var err error
+	if s.opts.Mode == ModeFullHistory {
+		err = s.runFullHistory(browserCtx)
+	} else {
+		err = s.scrapeRange(browserCtx, fromSite, toSite)
+	}
+
+	if err == nil && s.opts.Announcements {
+		if s.opts.DryRun || s.opts.Mode == ModeFullHistory {
+			s.log.infof("[ANNOUNCEMENTS] Skipped (not supported in dry-run or full-history mode)")
+		} else {
+			err = chromedp.Run(browserCtx, s.scrapeAnnouncements(fromSite, toSite))
+		}
+	}
+
+	if ctx.Err() != nil {
+		s.result.Cancelled = true
+		if s.opts.DryRun {
+			s.printPlanSummary()
+		}
+		s.log.emit(Event{
+			Type:    EventSummary,
+			Status:  "cancelled",
+			Count:   s.result.Downloaded,
+			Message: fmt.Sprintf("[CANCELLED] Scrape interrupted after %d new downloads; rerun to resume", s.result.Downloaded),
+		})
+		return s.result, ctx.Err()
+	}
+	if err != nil {
+		s.log.errorf(err, "scraping failed: %v", err)
+		return s.result, err
+	}
+
+	if s.opts.DryRun {
+		s.printPlanSummary()
+		return s.result, nil
+	}
+	if len(s.result.Changed) > 0 {
+		s.log.infof("[CHANGED] %d republished reports re-downloaded and marked for reprocessing: %s", len(s.result.Changed), strings.Join(s.result.Changed, ", "))
+	}
+	s.log.emit(Event{Type: EventSummary, Status: "completed", Count: s.result.Downloaded, Message: fmt.Sprintf("Scrape completed: %d new downloads", s.result.Downloaded)})
+	return s.result, nil
+}
+
+// LatestDownloadedDate returns the most recent report date in the output directory
+func (s *Scraper) LatestDownloadedDate() (time.Time, bool) {
+	return s.opts.NameTemplate.Latest(s.opts.OutDir)
+}
+
+// startDate returns the first date a run requests from the portal: the day after the latest
+// downloaded report in accumulative mode, with afterLatest set, else From. Full-history mode
+// probes its own dates.
+func (s *Scraper) startDate() (from time.Time, afterLatest bool) {
+	if s.opts.Mode == ModeAccumulative {
+		if d, ok := s.LatestDownloadedDate(); ok {
+			return d.AddDate(0, 0, 1), true
+		}
+	}
+	return s.opts.From, false
+}
+
+// PlannedDates returns the trading days, Sunday to Thursday, a run would request that aren't
+// downloaded yet, without reaching the portal. Holidays can't be told offline, so it is an upper
+// bound of the reports to download. Full-history mode plans no dates.
+func (s *Scraper) PlannedDates() ([]time.Time, error) {
+	if s.opts.Mode == ModeFullHistory {
+		return nil, nil
+	}
+	from, _ := s.startDate()
+	if from.IsZero() {
+		return nil, errors.New("no start date")
+	}
+	to := s.opts.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	reports, err := s.opts.NameTemplate.Find(s.opts.OutDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	downloaded := make(map[string]bool, len(reports))
+	for _, r := range reports {
+		downloaded[r.Date.Format("2006-01-02")] = true
+	}
+	var dates []time.Time
+	last := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	for d := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC); !d.After(last); d = d.AddDate(0, 0, 1) {
+		if wd := d.Weekday(); wd == time.Friday || wd == time.Saturday || downloaded[d.Format("2006-01-02")] {
+			continue
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// plan records a report found during a dry run
+func (s *Scraper) plan(f PlannedFile) {
+	s.result.Planned = append(s.result.Planned, f)
+	if f.Exists {
+		s.result.Existing++
+	}
+}
+
+// printPlanSummary reports what a dry run found
+func (s *Scraper) printPlanSummary() {
+	found, existing := len(s.result.Planned), s.result.Existing
+	if s.log.json {
+		s.log.emit(Event{
+			Type:    EventSummary,
+			Status:  "dry-run",
+			Count:   found - existing,
+			Message: fmt.Sprintf("%d reports found on portal, %d already exist locally", found, existing),
+		})
+		return
+	}
+	s.log.infof("═══════════════════════════════════════════════")
+	s.log.infof("[DRY-RUN] %d reports found on portal", found)
+	s.log.infof("[DRY-RUN] %d already exist locally", existing)
+	s.log.infof("[DRY-RUN] %d would be downloaded", found-existing)
+}
+
+// scrapeRange scrapes the listing for each configured portal language in turn. Reports already
+// taken from an earlier language are skipped by date.
+func (s *Scraper) scrapeRange(ctx context.Context, fromSite, toSite string) error {
+	defer func() { s.lang = portalLanguages[s.opts.Languages[0]] }()
+
+	for _, code := range s.opts.Languages {
+		s.lang = portalLanguages[code]
+		if len(s.opts.Languages) > 1 {
+			s.log.infof("[LANG %s] Scraping the %s portal listing", code, code)
+		}
+
+		var state *scrapeState
+		listFrom := fromSite
+		if !s.opts.DryRun {
+			state = s.openState(ctx, fromSite, toSite)
+			listFrom = state.From // the completed pages of a resumed scrape are those of its listing
+		}
+		if err := chromedp.Run(ctx, s.runScraper(listFrom, toSite, state)); err != nil {
+			return err
+		}
+		state.clear()
+	}
+	return nil
+}
+
+// runScraper builds the chromedp tasks that search the portal and walk the result pages.
+// Pages already completed according to state are skipped without re-processing their rows.
+func (s *Scraper) runScraper(fromSite, toSite string, state *scrapeState) chromedp.Tasks {
+	actions := s.searchActions(fromSite, toSite)
+	actions = append(actions,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			page := 1
+			for {
+				pageStart := time.Now()
+				if state != nil && page <= state.CompletedPage {
+					s.log.emit(Event{Type: EventPage, Page: page, Status: "skipped", Message: fmt.Sprintf("[RESUME] Skipping page %d (already completed)", page)})
+				} else {
+					s.log.emit(Event{Type: EventPage, Page: page, Status: "started", Message: fmt.Sprintf("Scraping page %d...", page)})
+					shouldContinue, err := s.scrapePage(ctx, state)
+					if err != nil {
+						return err
+					}
+					state.markPageComplete(page)
+					if !shouldContinue && !s.opts.DryRun {
+						s.log.emit(Event{Type: EventPage, Page: page, Status: "stopped", Message: fmt.Sprintf("Found existing files on page %d, stopping scraping process.", page)})
+						return nil
+					}
+				}
+				hasNext, err := nextPage(ctx)
+				if err != nil {
+					return err
+				}
+				if !hasNext {
+					return nil
+				}
+				s.log.emit(Event{Type: EventTiming, Page: page, Duration: time.Since(pageStart).Milliseconds(), Message: fmt.Sprintf("[TIME] page %d processed in %s", page, time.Since(pageStart))})
+				page++
+			}
+		}),
+	)
+
+	return chromedp.Tasks(actions)
+}
+
+// nextPage clicks the listing's next arrow and waits for the table to refresh.
+// It returns false when there is no further page.
+func nextPage(ctx context.Context) (bool, error) {
+	// check if next arrow exists
+	var nextHref string
+	var ok bool
+	err := chromedp.Run(ctx, chromedp.AttributeValue(`a img[src*='next.gif']`, "src", &nextHref, &ok))
+	if err != nil || !ok {
+		// No next arrow or not clickable
+		return false, nil
+	}
+	// Click the parent anchor of the img
+	if err := chromedp.Click(`a img[src*='next.gif']`, chromedp.ByQuery).Do(ctx); err != nil {
+		return false, nil // assume finished when can't click
+	}
+	// wait for table refresh
+	if err := chromedp.WaitVisible(`#report`, chromedp.ByID).Do(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// searchActions navigates to the portal and runs a daily report search for the given range.
+// Dates use the portal's dd/mm/yyyy format; an empty toSite keeps the site default.
+func (s *Scraper) searchActions(fromSite, toSite string) []chromedp.Action {
+	return s.searchActionsForType(fromSite, toSite, dailyReportType)
+}
+
+// searchActionsForType runs a portal search for the given report type
+func (s *Scraper) searchActionsForType(fromSite, toSite, reportType string) []chromedp.Action {
+	actions := []chromedp.Action{
+		s.timedAction("Navigate", s.navigatePortal()),
+		chromedp.WaitVisible(`#date`, chromedp.ByID),
+		chromedp.SetValue(`#date`, fromSite, chromedp.ByID),
+	}
+	if toSite != "" {
+		actions = append(actions, chromedp.SetValue(`#toDate`, toSite, chromedp.ByID))
+	}
+	return append(actions,
+		chromedp.SetValue(`#reporttype`, reportType, chromedp.ByID),
+		s.timedAction("ExecuteSearch", chromedp.Click(s.lang.SearchButton, s.lang.SearchBy)),
+		chromedp.WaitVisible(`#report`, chromedp.ByID),
+	)
+}
+
+// reportRow is a single row of the portal's report listing table
+type reportRow struct {
+	Href  string `json:"href"`
+	Date  string `json:"date"`
+	Title string `json:"title"`
+	Typ   string `json:"typ"`
+}
+
+// readReportRows returns the rows of the report table on the current page
+func readReportRows(ctx context.Context) ([]reportRow, error) {
+	var rows []reportRow
+
+	js := `Array.from(document.querySelectorAll('#report tbody tr')).map(tr => {
+		const link = tr.querySelector('td.report-download a');
+		if (!link) return null;
+		const dateCell = tr.querySelector('td.report-titledata1');
+		const titleCell = tr.querySelector('td.report-titledata2');
+		const typeCell = tr.querySelector('td.report-titledata3');
+		return {href: link.getAttribute('href'), date: dateCell ? dateCell.innerText.trim() : '', title: titleCell ? titleCell.innerText.trim() : '', typ: typeCell ? typeCell.innerText.trim() : ''};
+	}).filter(Boolean)`
+
+	if err := chromedp.Run(ctx, chromedp.Evaluate(js, &rows)); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// scrapePage downloads the daily reports listed on the current portal page.
+// In dry-run mode nothing is downloaded; the reports are recorded in the result instead.
+// Downloads are tracked in state (when non-nil) so they can be retried after a crash.
+func (s *Scraper) scrapePage(ctx context.Context, state *scrapeState) (bool, error) {
+	// Retrieve rows data: href, date text, type text
+	rows, err := readReportRows(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	foundExistingFiles := 0
+	newDownloads := 0
+
+	for _, r := range rows {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		// We only care about Daily type and xlsx file extension
+		if !s.lang.isDailyReport(r) {
+			continue
+		}
+
+		fullURL := r.Href
+		if !strings.HasPrefix(r.Href, "http") {
+			fullURL = s.activeBase + r.Href
+		}
+
+		// Parse date dd/mm/yyyy
+		t, err := time.Parse("02/01/2006", r.Date)
+		if err != nil {
+			// fallback to original filename
+			s.log.errorf(err, " !! unable to parse date '%s': %v", r.Date, err)
+		}
+
+		var fname, isoDate string
+		if err == nil {
+			fname = s.opts.NameTemplate.Name(t)
+			isoDate = t.Format("2006-01-02")
+		} else {
+			fname = filepath.Base(r.Href)
+		}
+
+		// The same report is listed on both the English and Arabic portal
+		if isoDate != "" {
+			if s.seenDates[isoDate] {
+				continue
+			}
+			s.seenDates[isoDate] = true
+		}
+
+		destPath := filepath.Join(s.opts.OutDir, fname)
+		if s.opts.DryRun {
+			_, statErr := os.Stat(destPath)
+			f := PlannedFile{Date: isoDate, Name: fname, URL: fullURL, Exists: statErr == nil}
+			s.plan(f)
+			status := "new"
+			if f.Exists {
+				status = "exists"
+			}
+			s.log.emit(Event{
+				Type:    EventFile,
+				File:    fname,
+				Date:    f.Date,
+				URL:     fullURL,
+				Status:  status,
+				Message: fmt.Sprintf("[DRY-RUN] %s %s %s (%s)", f.Date, fname, fullURL, status),
+			})
+			continue
+		}
+
+		if fi, err := os.Stat(destPath); err == nil {
+			foundExistingFiles++
+			if s.opts.CheckChanged && s.redownloadIfChanged(ctx, fname, isoDate, fullURL, destPath, fi.Size()) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			s.log.emit(Event{Type: EventFile, File: fname, Status: "exists", Message: fmt.Sprintf(" --> already have %s, skipping", fname)})
+			s.result.Existing++
+			continue
+		}
+
+		msg := fmt.Sprintf(" --> downloading %s", fname)
+		if s.opts.MaxBandwidth > 0 {
+			msg += fmt.Sprintf(" (throttled to %s)", formatBandwidth(s.opts.MaxBandwidth))
+		}
+		s.log.emit(Event{Type: EventDownload, File: fname, URL: fullURL, Status: "started", Message: msg})
+		start := time.Now()
+		state.markPending(fname, isoDate, fullURL)
+		if source, info, err := s.downloadWithFailover(ctx, fullURL, destPath); err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			s.log.emit(Event{Type: EventDownload, File: fname, URL: fullURL, Status: "failed", Error: err.Error(), Message: fmt.Sprintf("failed to download %s: %v", fname, err)})
+		} else {
+			newDownloads++
+			s.result.Downloaded++
+			state.markDone(fname, isoDate)
+			s.recordDownload(fname, isoDate, source, info)
+			s.log.emit(Event{Type: EventDownload, File: fname, URL: source, Status: "completed", Duration: time.Since(start).Milliseconds(), Message: fmt.Sprintf(" --> saved %s from %s", fname, source)})
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if s.opts.DryRun {
+		return true, nil
+	}
+
+	s.log.emit(Event{Type: EventSummary, Count: newDownloads, Message: fmt.Sprintf("Page summary: %d new downloads, %d existing files", newDownloads, foundExistingFiles)})
+
+	// If we found more existing files than new downloads, and we found at least some existing files,
+	// it means we're getting into already-downloaded territory, so we should stop
+	if foundExistingFiles > 0 && foundExistingFiles >= newDownloads {
+		return false, nil // Stop scraping
+	}
+
+	return true, nil // Continue scraping
+}
+
+// downloadFile fetches url into dest. The body is written to a ".part" file that is only renamed
+// into place once complete, so a cancelled or failed download never leaves a truncated report.
+func (s *Scraper) downloadFile(ctx context.Context, url, dest string) (remoteFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return remoteFile{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return remoteFile{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return remoteFile{}, fmt.Errorf("bad status: %s", resp.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return remoteFile{}, err
+	}
+	tmp := dest + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return remoteFile{}, err
+	}
+
+	info := remoteFileFrom(resp)
+	info.Size, err = io.Copy(out, newThrottledReader(ctx, resp.Body, s.opts.MaxBandwidth))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return remoteFile{}, err
+	}
+	return info, os.Rename(tmp, dest)
+}
+
+func (s *Scraper) timedAction(name string, act chromedp.Action) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		start := time.Now()
+		err := act.Do(ctx)
+		s.log.emit(Event{Type: EventTiming, Status: name, Duration: time.Since(start).Milliseconds(), Message: fmt.Sprintf("[TIME] %s took %s", name, time.Since(start))})
+		return err
+	})
+}
@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"isxcli/internal/reportfile"
+)
+
+// TestLatestDownloadedDate verifies that the most recent date is correctly detected.
+func TestLatestDownloadedDate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Create sample files.
+	names := []string{
+		"2024 12 30 ISX Daily Report.xlsx",
+		"2025 01 01 ISX Daily Report.xlsx",
+		"2023 11 15 ISX Daily Report.xlsx",
+	}
+	for _, n := range names {
+		path := filepath.Join(tmpDir, n)
+		if err := os.WriteFile(path, []byte("dummy"), 0o644); err != nil {
+			t.Fatalf("write temp file: %v", err)
+		}
+	}
+
+	pattern := regexp.MustCompile(`^(\d{4}) (\d{2}) (\d{2}) ISX Daily Report\.xlsx$`)
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	t.Logf("Found %d entries in %s", len(entries), tmpDir)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		t.Logf("File: %s", e.Name())
+		m := pattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			t.Logf("No match for %s", e.Name())
+			continue
+		}
+		t.Logf("Match: %v", m)
+		dateStr := strings.Join(m[1:4], " ")
+		t.Logf("Date str: %s", dateStr)
+		parsedDate, parseErr := time.Parse("2006 01 02", dateStr)
+		if parseErr != nil {
+			t.Logf("Parse err: %v", parseErr)
+			continue
+		}
+		t.Logf("Parsed date: %s", parsedDate.Format("2006-01-02"))
+	}
+
+	d, ok := New(Options{OutDir: tmpDir}).LatestDownloadedDate()
+	if !ok {
+		t.Fatalf("expected ok=true, got false")
+	}
+	want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !d.Equal(want) {
+		t.Fatalf("wrong date: want %s, got %s", want.Format("2006-01-02"), d.Format("2006-01-02"))
+	}
+}
+
+// TestMonthlyWindows verifies that a date range is split into clamped calendar months.
+func TestMonthlyWindows(t *testing.T) {
+	start := time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC)
+
+	windows := monthlyWindows(start, end)
+	want := [][2]string{
+		{"2024-11-15", "2024-11-30"},
+		{"2024-12-01", "2024-12-31"},
+		{"2025-01-01", "2025-01-31"},
+		{"2025-02-01", "2025-02-10"},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("expected %d windows, got %d", len(want), len(windows))
+	}
+	for i, w := range windows {
+		if got := [2]string{w.From.Format("2006-01-02"), w.To.Format("2006-01-02")}; got != want[i] {
+			t.Errorf("window %d: want %v, got %v", i, want[i], got)
+		}
+	}
+}
+
+// TestParseBandwidth verifies the accepted bandwidth limit formats.
+func TestParseBandwidth(t *testing.T) {
+	cases := map[string]int64{
+		"":      0,
+		"0":     0,
+		"2048":  2048,
+		"500K":  500 << 10,
+		"1.5M":  3 << 19,
+		"2mb/s": 2 << 20,
+	}
+	for in, want := range cases {
+		got, err := ParseBandwidth(in)
+		if err != nil {
+			t.Errorf("ParseBandwidth(%q): %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseBandwidth(%q): want %d, got %d", in, want, got)
+		}
+	}
+	if _, err := ParseBandwidth("fast"); err == nil {
+		t.Error("expected error for invalid bandwidth")
+	}
+}
+
+// TestRemoteChanged verifies how republished reports are detected.
+func TestRemoteChanged(t *testing.T) {
+	entry := reportfile.ManifestEntry{Size: 100, ETag: `"a"`}
+	cases := []struct {
+		name      string
+		entry     reportfile.ManifestEntry
+		known     bool
+		localSize int64
+		remote    remoteFile
+		want      bool
+	}{
+		{"same etag", entry, true, 100, remoteFile{Size: 120, ETag: `"a"`}, false},
+		{"new etag", entry, true, 100, remoteFile{Size: 100, ETag: `"b"`}, true},
+		{"size without etag", reportfile.ManifestEntry{Size: 100}, true, 100, remoteFile{Size: 120}, true},
+		{"unknown same size", reportfile.ManifestEntry{}, false, 100, remoteFile{Size: 100}, false},
+		{"unknown new size", reportfile.ManifestEntry{}, false, 100, remoteFile{Size: 90}, true},
+		{"unknown no length", reportfile.ManifestEntry{}, false, 100, remoteFile{Size: -1}, false},
+	}
+	for _, c := range cases {
+		if got := remoteChanged(c.entry, c.known, c.localSize, c.remote); got != c.want {
+			t.Errorf("%s: want %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+// TestPlannedDates lists the trading days after the latest report in accumulative mode
+func TestPlannedDates(t *testing.T) {
+	dir := t.TempDir()
+	// Sunday 5 January 2025
+	if err := os.WriteFile(filepath.Join(dir, "2025 01 05 ISX Daily Report.xlsx"), []byte("dummy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	to := time.Date(2025, 1, 12, 0, 0, 0, 0, time.UTC)
+	var got []string
+	dates, err := New(Options{Mode: ModeAccumulative, OutDir: dir, To: to}).PlannedDates()
+	for _, d := range dates {
+		got = append(got, d.Format("01-02"))
+	}
+	if want := "01-06 01-07 01-08 01-09 01-12"; err != nil || strings.Join(got, " ") != want {
+		t.Errorf("accumulative: %v %v, want %s", got, err, want)
+	}
+
+	// Initial mode starts at From and skips the downloaded report
+	dates, err = New(Options{OutDir: dir, From: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC), To: to}).PlannedDates()
+	if err != nil || len(dates) != 5 || dates[0].Day() != 6 {
+		t.Errorf("initial: %v %v", dates, err)
+	}
+}
+
+// TestLoadScrapeState verifies an accumulative scrape resumes after its listing start moved, and
+// other modes only resume the same range.
+func TestLoadScrapeState(t *testing.T) {
+	log := newEventLogger("text", io.Discard, nil)
+	path := filepath.Join(t.TempDir(), StateFileName)
+
+	// An accumulative run listing from 02/03/2025 downloaded a report, then was killed
+	st := &scrapeState{Mode: ModeAccumulative, From: "02/03/2025", To: "", CompletedPage: 2, path: path, log: log}
+	st.markDone("2025 03 02 ISX Daily Report.xlsx", "2025-03-02")
+
+	resumed, ok := loadScrapeState(log, path, ModeAccumulative, "03/03/2025", "")
+	if !ok || resumed.From != "02/03/2025" || resumed.CompletedPage != 2 {
+		t.Errorf("accumulative: resumed=%v %+v", ok, resumed)
+	}
+	if fresh, ok := loadScrapeState(log, path, ModeAccumulative, "03/03/2025", "10/03/2025"); ok || fresh.From != "03/03/2025" {
+		t.Errorf("accumulative with another end date: resumed=%v %+v", ok, fresh)
+	}
+	if fresh, ok := loadScrapeState(log, path, ModeInitial, "03/03/2025", ""); ok || fresh.CompletedPage != 0 {
+		t.Errorf("initial: resumed=%v %+v", ok, fresh)
+	}
+
+	st.Mode = ModeInitial
+	st.saveOrWarn()
+	if _, ok := loadScrapeState(log, path, ModeInitial, "02/03/2025", ""); !ok {
+		t.Error("initial with the same range: not resumed")
+	}
+	if _, ok := loadScrapeState(log, path, ModeInitial, "03/03/2025", ""); ok {
+		t.Error("initial with another start: resumed")
+	}
+}
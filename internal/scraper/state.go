@@ -0,0 +1,190 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// pendingDownload is a report that was about to be downloaded when the state was saved
+type pendingDownload struct {
+	Name string `json:"name"`
+	Date string `json:"date,omitempty"`
+	URL  string `json:"url"`
+}
+
+// scrapeState records scraper progress so an interrupted run can resume where it left off
+type scrapeState struct {
+	Mode           string            `json:"mode"`
+	From           string            `json:"from"` // the start of the listing the pages are numbered in
+	To             string            `json:"to"`
+	CompletedPage  int               `json:"completed_page"`
+	ProcessedDates []string          `json:"processed_dates"`
+	Pending        []pendingDownload `json:"pending"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+
+	path string
+	log  *eventLogger
+}
+
+// loadScrapeState reads the state file at path. A missing file, or one written for a different
+// mode or date range, yields a fresh state. In accumulative mode the listing starts after the
+// latest downloaded report, which moves as soon as the interrupted run downloads one, so a state
+// of the same end date resumes whatever its start; the run lists from the start of the state.
+func loadScrapeState(log *eventLogger, path, mode, from, to string) (*scrapeState, bool) {
+	fresh := &scrapeState{Mode: mode, From: from, To: to, path: path, log: log}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fresh, false
+	}
+
+	var st scrapeState
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.errorf(err, "ignoring unreadable scrape state %s: %v", path, err)
+		return fresh, false
+	}
+	if st.Mode != mode || st.To != to || (st.From != from && mode != ModeAccumulative) {
+		log.infof("[RESUME] State file is for a %s scrape of %s - %s, starting fresh", st.Mode, st.From, st.To)
+		return fresh, false
+	}
+
+	st.path = path
+	st.log = log
+	return &st, true
+}
+
+// openState prepares the state for a scrape of the given range. With resume enabled a
+// matching state file is picked up and its interrupted downloads are retried first; its From is
+// the start of the listing to scrape.
+func (s *Scraper) openState(ctx context.Context, from, to string) *scrapeState {
+	path := s.opts.StatePath
+	if s.lang.Code != "en" {
+		path += "." + s.lang.Code // page numbers differ between the language listings
+	}
+	if !s.opts.Resume {
+		return &scrapeState{Mode: s.opts.Mode, From: from, To: to, path: path, log: s.log}
+	}
+
+	state, resumed := loadScrapeState(s.log, path, s.opts.Mode, from, to)
+	if resumed {
+		s.log.infof("[RESUME] Resuming previous scrape after page %d (%d dates done, %d pending downloads)",
+			state.CompletedPage, len(state.ProcessedDates), len(state.Pending))
+		s.retryPending(ctx, state)
+	}
+	return state
+}
+
+// save writes the state atomically so a crash mid-write never leaves a truncated file
+func (s *scrapeState) save() error {
+	if s == nil {
+		return nil
+	}
+	s.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// saveOrWarn saves the state and logs, rather than returns, any failure
+func (s *scrapeState) saveOrWarn() {
+	if err := s.save(); err != nil {
+		s.log.errorf(err, "failed to save scrape state: %v", err)
+	}
+}
+
+// markPending records a download that is about to start
+func (s *scrapeState) markPending(name, date, url string) {
+	if s == nil {
+		return
+	}
+	for _, p := range s.Pending {
+		if p.Name == name {
+			return
+		}
+	}
+	s.Pending = append(s.Pending, pendingDownload{Name: name, Date: date, URL: url})
+	s.saveOrWarn()
+}
+
+// markDone removes a download from the pending list and records its date as processed
+func (s *scrapeState) markDone(name, date string) {
+	if s == nil {
+		return
+	}
+	for i, p := range s.Pending {
+		if p.Name == name {
+			s.Pending = append(s.Pending[:i], s.Pending[i+1:]...)
+			break
+		}
+	}
+	if date != "" {
+		idx := sort.SearchStrings(s.ProcessedDates, date)
+		if idx == len(s.ProcessedDates) || s.ProcessedDates[idx] != date {
+			s.ProcessedDates = append(s.ProcessedDates, "")
+			copy(s.ProcessedDates[idx+1:], s.ProcessedDates[idx:])
+			s.ProcessedDates[idx] = date
+		}
+	}
+	s.saveOrWarn()
+}
+
+// markPageComplete records that every report on page has been handled
+func (s *scrapeState) markPageComplete(page int) {
+	if s == nil {
+		return
+	}
+	s.CompletedPage = page
+	s.saveOrWarn()
+}
+
+// clear removes the state file after a successful run. Failed downloads keep the file around so
+// the next run retries them.
+func (s *scrapeState) clear() {
+	if s == nil {
+		return
+	}
+	if len(s.Pending) > 0 {
+		s.log.infof("[RESUME] %d downloads failed, keeping %s for the next run", len(s.Pending), s.path)
+		return
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		s.log.errorf(err, "failed to remove scrape state: %v", err)
+	}
+}
+
+// retryPending downloads any reports that were in flight when the previous run stopped
+func (s *Scraper) retryPending(ctx context.Context, state *scrapeState) {
+	if state == nil || len(state.Pending) == 0 {
+		return
+	}
+	s.log.infof("[RESUME] Retrying %d interrupted downloads", len(state.Pending))
+
+	pending := append([]pendingDownload(nil), state.Pending...)
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		dest := filepath.Join(s.opts.OutDir, p.Name)
+		source, info, err := s.downloadWithFailover(ctx, p.URL, dest)
+		if err != nil {
+			s.log.emit(Event{Type: EventDownload, File: p.Name, URL: p.URL, Status: "failed", Error: err.Error(), Message: fmt.Sprintf("failed to download %s: %v", p.Name, err)})
+			continue
+		}
+		s.log.emit(Event{Type: EventDownload, File: p.Name, URL: source, Status: "completed", Message: fmt.Sprintf(" --> resumed %s from %s", p.Name, source)})
+		state.markDone(p.Name, p.Date)
+		s.recordDownload(p.Name, p.Date, source, info)
+		s.result.Downloaded++
+	}
+}
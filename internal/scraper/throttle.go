@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseBandwidth parses values such as "500K", "2M" or "1048576" (bytes per second).
+// Suffixes are binary (K = 1024) and an optional trailing "B" or "/s" is ignored.
+func ParseBandwidth(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "/S")
+	v = strings.TrimSuffix(v, "B")
+	if v == "" || v == "0" {
+		return 0, nil
+	}
+
+	mult := int64(1)
+	switch v[len(v)-1] {
+	case 'K':
+		mult = 1 << 10
+	case 'M':
+		mult = 1 << 20
+	case 'G':
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q (use e.g. 500K or 2M)", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// formatBandwidth renders a bytes-per-second limit for progress output
+func formatBandwidth(bps int64) string {
+	switch {
+	case bps <= 0:
+		return "unlimited"
+	case bps >= 1<<20:
+		return fmt.Sprintf("%.1f MB/s", float64(bps)/(1<<20))
+	case bps >= 1<<10:
+		return fmt.Sprintf("%.0f KB/s", float64(bps)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B/s", bps)
+	}
+}
+
+// throttledReader limits reads from r to bps bytes per second, sleeping between chunks
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	bps   int64
+	start time.Time
+	read  int64
+}
+
+// newThrottledReader wraps r so that reading from it never exceeds bps; bps <= 0 returns r unchanged
+func newThrottledReader(ctx context.Context, r io.Reader, bps int64) io.Reader {
+	if bps <= 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, bps: bps, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Read in chunks of at most ~1/4 second worth of data to keep the rate smooth
+	if chunk := t.bps / 4; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	expected := time.Duration(float64(t.read) / float64(t.bps) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,178 @@
+// Package webserver configures where the web interfaces listen and whether they serve HTTPS,
+// from flags defaulting to environment variables
+package webserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Environment variables the flags default to, so a server started without arguments, e.g. by
+// double-clicking it, can still be configured
+const (
+	HostEnvVar        = "ISX_HOST"
+	PortEnvVar        = "ISX_PORT"
+	CertEnvVar        = "ISX_TLS_CERT"
+	KeyEnvVar         = "ISX_TLS_KEY"
+	AutocertEnvVar    = "ISX_AUTOCERT"       // comma-separated domains
+	AutocertDirEnvVar = "ISX_AUTOCERT_CACHE" // "autocert-cache" when unset
+)
+
+// DefaultPort is the port of a server started without a port
+const DefaultPort = 8080
+
+// Options are the address of a server and its TLS certificate
+type Options struct {
+	Host string // "" listens on every interface
+	Port int
+	// CertFile and KeyFile serve HTTPS with a certificate of their own
+	CertFile string
+	KeyFile  string
+	// Autocert serves HTTPS for these domains with certificates obtained from Let's Encrypt,
+	// which must reach the server on port 443 to verify them
+	Autocert    []string
+	AutocertDir string // caches the certificates across restarts
+}
+
+// FromEnv returns the options of the environment variables, plain HTTP on port 8080 of every
+// interface when they are unset
+func FromEnv() Options {
+	o := Options{
+		Host:        os.Getenv(HostEnvVar),
+		Port:        DefaultPort,
+		CertFile:    os.Getenv(CertEnvVar),
+		KeyFile:     os.Getenv(KeyEnvVar),
+		Autocert:    splitList(os.Getenv(AutocertEnvVar)),
+		AutocertDir: os.Getenv(AutocertDirEnvVar),
+	}
+	if port, err := strconv.Atoi(os.Getenv(PortEnvVar)); err == nil {
+		o.Port = port
+	}
+	if o.AutocertDir == "" {
+		o.AutocertDir = "autocert-cache"
+	}
+	return o
+}
+
+// RegisterFlags defines the flags of o on fs, defaulting to its current values
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Host, "host", o.Host, "address to listen on, e.g. localhost to refuse other machines (default: every interface)")
+	fs.IntVar(&o.Port, "port", o.Port, "port to listen on")
+	fs.StringVar(&o.CertFile, "tls-cert", o.CertFile, "TLS certificate file; serves HTTPS along with -tls-key")
+	fs.StringVar(&o.KeyFile, "tls-key", o.KeyFile, "TLS private key file")
+	fs.Func("autocert", "comma-separated domains to serve HTTPS for with Let's Encrypt certificates (needs -port 443)", func(v string) error {
+		o.Autocert = splitList(v)
+		return nil
+	})
+	fs.StringVar(&o.AutocertDir, "autocert-cache", o.AutocertDir, "directory caching the Let's Encrypt certificates")
+}
+
+// Validate checks the port and that one source of certificates at most is given
+func (o Options) Validate() error {
+	if o.Port <= 0 || o.Port > 65535 {
+		return fmt.Errorf("invalid port %d", o.Port)
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("the TLS certificate and key go together")
+	}
+	if o.CertFile != "" && len(o.Autocert) > 0 {
+		return errors.New("use a TLS certificate or autocert, not both")
+	}
+	return nil
+}
+
+// TLS reports whether the server serves HTTPS
+func (o Options) TLS() bool {
+	return o.CertFile != "" || len(o.Autocert) > 0
+}
+
+// Addr returns the address the server listens on, e.g. ":8080"
+func (o Options) Addr() string {
+	return net.JoinHostPort(o.Host, strconv.Itoa(o.Port))
+}
+
+// URL returns the address of the dashboard for a browser: the first autocert domain, or the host
+// listened on, localhost when it is every interface
+func (o Options) URL() string {
+	scheme := "http"
+	if o.TLS() {
+		scheme = "https"
+	}
+	host := o.Host
+	if len(o.Autocert) > 0 {
+		host = o.Autocert[0]
+	} else if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	if (scheme == "http" && o.Port == 80) || (scheme == "https" && o.Port == 443) {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(o.Port))
+}
+
+// Serve serves handler as o configures it until ctx is done, then stops listening and waits for
+// the requests in progress, e.g. running pipelines, before returning nil. Hijacked connections,
+// the WebSockets, are left to the caller to close. It returns the error of a server that fails.
+func (o Options) Serve(ctx context.Context, handler http.Handler) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              o.Addr(),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if len(o.Autocert) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.Autocert...),
+			Cache:      autocert.DirCache(o.AutocertDir),
+		}
+		server.TLSConfig = m.TLSConfig()
+	} else if o.CertFile != "" {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if o.TLS() {
+			// The certificate files are "" with autocert, whose TLSConfig provides them
+			errc <- server.ListenAndServeTLS(o.CertFile, o.KeyFile)
+		} else {
+			errc <- server.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// splitList returns the trimmed, non-empty items of a comma-separated list
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,108 @@
+package webserver
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFromEnvAndFlags(t *testing.T) {
+	t.Setenv(HostEnvVar, "")
+	t.Setenv(PortEnvVar, "")
+	t.Setenv(AutocertEnvVar, "")
+	o := FromEnv()
+	if o.Addr() != ":8080" || o.URL() != "http://localhost:8080" || o.TLS() {
+		t.Errorf("default %s at %s", o.Addr(), o.URL())
+	}
+
+	t.Setenv(HostEnvVar, "127.0.0.1")
+	t.Setenv(PortEnvVar, "9000")
+	o = FromEnv()
+	if o.Addr() != "127.0.0.1:9000" || o.URL() != "http://127.0.0.1:9000" {
+		t.Errorf("env %s at %s", o.Addr(), o.URL())
+	}
+
+	fs := flag.NewFlagSet("web", flag.ContinueOnError)
+	o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-host", "", "-port", "443", "-autocert", "isx.example.com, www.isx.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(o.Autocert, []string{"isx.example.com", "www.isx.example.com"}) || o.URL() != "https://isx.example.com" {
+		t.Errorf("autocert %v at %s", o.Autocert, o.URL())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		o  Options
+		ok bool
+	}{
+		{Options{Port: 8080}, true},
+		{Options{Port: 8443, CertFile: "cert.pem", KeyFile: "key.pem"}, true},
+		{Options{Port: 0}, false},
+		{Options{Port: 8443, CertFile: "cert.pem"}, false},
+		{Options{Port: 443, CertFile: "cert.pem", KeyFile: "key.pem", Autocert: []string{"isx.example.com"}}, false},
+	} {
+		if err := c.o.Validate(); (err == nil) != c.ok {
+			t.Errorf("%+v: %v", c.o, err)
+		}
+	}
+	if o := (Options{Port: 8443, CertFile: "cert.pem", KeyFile: "key.pem"}); o.URL() != "https://localhost:8443" {
+		t.Errorf("TLS at %s", o.URL())
+	}
+}
+
+// TestServe shuts the server down once the request in progress finishes
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	started, finish := make(chan bool), make(chan bool)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-finish
+		io.WriteString(w, "done")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	o := Options{Host: "127.0.0.1", Port: port}
+	served := make(chan error)
+	go func() { served <- o.Serve(ctx, handler) }()
+
+	body := make(chan string)
+	go func() {
+		for {
+			resp, err := http.Get(o.URL())
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body <- string(data)
+			return
+		}
+	}()
+	<-started
+	cancel()
+	select {
+	case err := <-served:
+		t.Fatalf("stopped during a request: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	finish <- true
+	if got := <-body; got != "done" {
+		t.Errorf("got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
@@ -3,292 +3,130 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
-	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"isxcli/internal/license"
-
-	"github.com/chromedp/chromedp"
-)
-
-const (
-	baseURL  = "http://www.isx-iq.net"
-	startURL = "http://www.isx-iq.net/isxportal/portal/uploadedFilesList.html?currLanguage=en"
+	"isxcli/internal/reportfile"
+	"isxcli/internal/scraper"
 )
 
 func main() {
-	mode := flag.String("mode", "initial", "scrape mode: initial | accumulative")
+	mode := flag.String("mode", scraper.ModeInitial, "scrape mode: initial | accumulative | full-history")
 	fromStr := flag.String("from", "2025-01-01", "start date (YYYY-MM-DD) (used in initial mode if provided)")
 	toStr := flag.String("to", "", "optional end date (YYYY-MM-DD); leave blank to keep site default")
 	outDir := flag.String("out", "downloads", "directory to save reports")
 	headless := flag.Bool("headless", true, "run browser headless")
+	dryRun := flag.Bool("dry-run", false, "list reports that would be downloaded without downloading anything")
+	logFormat := flag.String("log-format", "text", "progress output format: text | json")
+	resume := flag.Bool("resume", true, "resume an interrupted scrape from its saved state file")
+	statePath := flag.String("state", "", "scrape state file (default: <out>/"+scraper.StateFileName+")")
+	historyFloor := flag.String("history-floor", "2004-01-01", "earliest date probed in full-history mode (YYYY-MM-DD)")
+	withAnnouncements := flag.Bool("announcements", false, "also download company announcements/disclosures for the date range")
+	announcementsDir := flag.String("announcements-dir", filepath.Join("data", "announcements"), "directory to save announcements")
+	announcementType := flag.String("announcement-type", "41", "portal report type value for company disclosures")
+	mirrors := flag.String("mirrors", os.Getenv("ISX_MIRRORS"), "comma separated fallback base URLs tried when "+scraper.BaseURL+" is unreachable")
+	bandwidth := flag.String("max-bandwidth", "", "limit download speed, e.g. 500K or 2M bytes per second (default unlimited)")
+	languages := flag.String("languages", "en", "comma separated portal languages to scrape: en, ar (e.g. en,ar)")
+	checkChanged := flag.Bool("check-changed", true, "re-download existing reports that were republished on the portal (HEAD size/ETag check)")
+	namePattern := flag.String("name-template", reportfile.DefaultPatternFromEnv(), "report filename template using {YYYY} {MM} {DD}; \"/\" creates subfolders")
 	flag.Parse()
 
-	// Initialize license system
-	fmt.Println("🔐 ISX Daily Reports Scraper - Licensed Version")
-	fmt.Println("═══════════════════════════════════════════════")
-
-	if !checkLicense() {
-		fmt.Println("❌ License validation failed. Application will exit.")
-		fmt.Println("📞 Contact The Iraqi Investor Group to get a new license.")
-		os.Exit(1)
+	opts := scraper.Options{
+		Mode:             *mode,
+		OutDir:           *outDir,
+		Headless:         *headless,
+		DryRun:           *dryRun,
+		Resume:           *resume,
+		StatePath:        *statePath,
+		Announcements:    *withAnnouncements,
+		AnnouncementsDir: *announcementsDir,
+		AnnouncementType: *announcementType,
+		Mirrors:          scraper.ParseMirrors(*mirrors),
+		CheckChanged:     *checkChanged,
+		LogFormat:        *logFormat,
 	}
 
-	// Create output directory if it doesn't exist (but don't delete existing files)
-	if err := os.MkdirAll(*outDir, 0o755); err != nil {
-		fmt.Printf("failed to create output dir: %v\n", err)
-		os.Exit(1)
+	var err error
+	switch opts.Mode {
+	case scraper.ModeInitial, scraper.ModeAccumulative, scraper.ModeFullHistory:
+	default:
+		exitWithError("invalid -mode: %v", fmt.Errorf("unknown scrape mode %q (use initial, accumulative or full-history)", opts.Mode))
 	}
-
-	// determine fromSite depending on mode
-	var fromSite string
-	if *mode == "accumulative" {
-		// scan downloads for latest file
-		if d, ok := latestDownloadedDate(*outDir); ok {
-			fromSite = d.AddDate(0, 0, 1).Format("02/01/2006") // next day
-			fmt.Printf("[MODE accumulative] Detected last report date %s. Will start from %s.\n", d.Format("2006-01-02"), fromSite)
-		}
+	if opts.LogFormat != "text" && opts.LogFormat != "json" {
+		exitWithError("invalid -log-format: %v", fmt.Errorf("unknown log format %q (use text or json)", opts.LogFormat))
 	}
-
-	if fromSite == "" {
-		// fallback to user provided from
-		startDate, err := time.Parse("2006-01-02", *fromStr)
-		if err != nil {
-			fmt.Printf("invalid --from date: %v\n", err)
-			os.Exit(1)
-		}
-		fromSite = startDate.Format("02/01/2006")
-		fmt.Printf("[MODE initial] Starting from %s (preserving existing files)\n", startDate.Format("2006-01-02"))
+	if opts.NameTemplate, err = reportfile.Parse(*namePattern); err != nil {
+		exitWithError("invalid -name-template: %v", err)
 	}
-
-	var toSite string
-	if *toStr != "" {
-		endDate, err := time.Parse("2006-01-02", *toStr)
-		if err != nil {
-			fmt.Printf("invalid --to date: %v\n", err)
-			os.Exit(1)
-		}
-		toSite = endDate.Format("02/01/2006")
+	if opts.Languages, err = scraper.ParseLanguages(*languages); err != nil {
+		exitWithError("invalid -languages: %v", err)
 	}
-
-	// setup ChromeDP
-	opts := chromedp.DefaultExecAllocatorOptions[:]
-	if *headless {
-		opts = append(opts, chromedp.Flag("headless", true))
-	} else {
-		opts = append(opts, chromedp.Flag("headless", false))
+	if opts.MaxBandwidth, err = scraper.ParseBandwidth(*bandwidth); err != nil {
+		exitWithError("invalid -max-bandwidth: %v", err)
 	}
-
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
-
-	ctx, cancelCtx := chromedp.NewContext(allocCtx)
-	defer cancelCtx()
-
-	if err := chromedp.Run(ctx, runScraper(fromSite, toSite, *outDir)); err != nil {
-		fmt.Fprintf(os.Stderr, "scraping failed: %v\n", err)
-		os.Exit(1)
+	if opts.From, err = time.Parse("2006-01-02", *fromStr); err != nil {
+		exitWithError("invalid --from date: %v", err)
 	}
-}
-
-func runScraper(fromSite, toSite, outDir string) chromedp.Tasks {
-	actions := []chromedp.Action{
-		timedAction("Navigate", chromedp.Navigate(startURL)),
-		chromedp.WaitVisible(`#date`, chromedp.ByID),
-		chromedp.SetValue(`#date`, fromSite, chromedp.ByID),
+	if *toStr != "" {
+		if opts.To, err = time.Parse("2006-01-02", *toStr); err != nil {
+			exitWithError("invalid --to date: %v", err)
+		}
 	}
-	if toSite != "" {
-		actions = append(actions, chromedp.SetValue(`#toDate`, toSite, chromedp.ByID))
+	if opts.HistoryFloor, err = time.Parse("2006-01-02", *historyFloor); err != nil {
+		exitWithError("invalid -history-floor date: %v", err)
 	}
-	actions = append(actions,
-		chromedp.SetValue(`#reporttype`, "40", chromedp.ByID),
-		timedAction("ExecuteSearch", chromedp.Click(`/html/body/div[2]/div/div[3]/div[3]/div[2]/div[4]/div/div[1]/form/div[8]/input`, chromedp.BySearch)),
-		chromedp.WaitVisible(`#report`, chromedp.ByID),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			page := 1
-			for {
-				fmt.Printf("Scraping page %d...\n", page)
-				shouldContinue, err := scrapePage(ctx, outDir)
-				if err != nil {
-					return err
-				}
-				if !shouldContinue {
-					fmt.Printf("Found existing files on page %d, stopping scraping process.\n", page)
-					return nil
-				}
-				// check if next arrow exists
-				var nextHref string
-				var ok bool
-				err = chromedp.Run(ctx, chromedp.AttributeValue(`a img[src*='next.gif']`, "src", &nextHref, &ok))
-				if err != nil || !ok {
-					// No next arrow or not clickable
-					return nil
-				}
-				// Click the parent anchor of the img
-				if err := chromedp.Click(`a img[src*='next.gif']`, chromedp.ByQuery).Do(ctx); err != nil {
-					return nil // assume finished when can't click
-				}
-				// wait for table refresh
-				if err := chromedp.WaitVisible(`#report`, chromedp.ByID).Do(ctx); err != nil {
-					return err
-				}
-				fmt.Printf("[TIME] page %d processed in %s\n", page, time.Since(time.Now()))
-				page++
-			}
-		}),
-	)
-
-	return chromedp.Tasks(actions)
-}
 
-func scrapePage(ctx context.Context, outDir string) (bool, error) {
-	// Retrieve rows data: href, date text, type text
-	var rows []struct {
-		Href string `json:"href"`
-		Date string `json:"date"`
-		Typ  string `json:"typ"`
+	// With -log-format=json stdout carries only the scraper's events, so the license banner and
+	// prompts go to stderr
+	if opts.LogFormat == "json" {
+		console = os.Stderr
 	}
 
-	js := `Array.from(document.querySelectorAll('#report tbody tr')).map(tr => {
-		const link = tr.querySelector('td.report-download a');
-		if (!link) return null;
-		const dateCell = tr.querySelector('td.report-titledata1');
-		const typeCell = tr.querySelector('td.report-titledata3');
-		return {href: link.getAttribute('href'), date: dateCell ? dateCell.innerText.trim() : '', typ: typeCell ? typeCell.innerText.trim() : ''};
-	}).filter(Boolean)`
+	// Initialize license system
+	fmt.Fprintln(console, "🔐 ISX Daily Reports Scraper - Licensed Version")
+	fmt.Fprintln(console, "═══════════════════════════════════════════════")
 
-	if err := chromedp.Run(ctx, chromedp.Evaluate(js, &rows)); err != nil {
-		return false, err
+	if !checkLicense() {
+		fmt.Fprintln(console, "❌ License validation failed. Application will exit.")
+		fmt.Fprintln(console, "📞 Contact The Iraqi Investor Group to get a new license.")
+		os.Exit(1)
 	}
 
-	foundExistingFiles := 0
-	newDownloads := 0
-
-	for _, r := range rows {
-		// We only care about Daily type and xlsx file extension
-		if strings.ToLower(r.Typ) != "daily" {
-			continue
-		}
-		if !strings.HasSuffix(strings.ToLower(r.Href), ".xlsx") {
-			continue
-		}
-
-		fullURL := r.Href
-		if !strings.HasPrefix(r.Href, "http") {
-			fullURL = baseURL + r.Href
-		}
-
-		// Parse date dd/mm/yyyy
-		t, err := time.Parse("02/01/2006", r.Date)
-		if err != nil {
-			// fallback to original filename
-			fmt.Printf(" !! unable to parse date '%s': %v\n", r.Date, err)
-		}
-
-		var fname string
-		if err == nil {
-			fname = fmt.Sprintf("%s ISX Daily Report.xlsx", t.Format("2006 01 02"))
-		} else {
-			fname = filepath.Base(r.Href)
-		}
+	// Ctrl+C / SIGTERM cancel the browser and any in-flight download through the context
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		destPath := filepath.Join(outDir, fname)
-		if _, err := os.Stat(destPath); err == nil {
-			fmt.Printf(" --> already have %s, skipping\n", fname)
-			foundExistingFiles++
-			continue
+	if _, err := scraper.New(opts).Run(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130)
 		}
-
-		fmt.Printf(" --> downloading %s\n", fname)
-		if err := downloadFile(fullURL, destPath); err != nil {
-			fmt.Printf("failed to download %s: %v\n", fname, err)
-		} else {
-			newDownloads++
-		}
-		time.Sleep(500 * time.Millisecond)
-	}
-
-	fmt.Printf("Page summary: %d new downloads, %d existing files\n", newDownloads, foundExistingFiles)
-
-	// If we found more existing files than new downloads, and we found at least some existing files,
-	// it means we're getting into already-downloaded territory, so we should stop
-	if foundExistingFiles > 0 && foundExistingFiles >= newDownloads {
-		return false, nil // Stop scraping
+		os.Exit(1) // the failure has already been reported as an error event
 	}
-
-	return true, nil // Continue scraping
 }
 
-func downloadFile(url, dest string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// console is where the license banner, messages and prompts are written
+var console io.Writer = os.Stdout
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
-	out, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
-func timedAction(name string, act chromedp.Action) chromedp.Action {
-	return chromedp.ActionFunc(func(ctx context.Context) error {
-		start := time.Now()
-		err := act.Do(ctx)
-		fmt.Printf("[TIME] %s took %s\n", name, time.Since(start))
-		return err
-	})
-}
-
-// latestDownloadedDate looks for files named "YYYY MM DD ISX Daily Report.xlsx" in dir and returns the most recent date.
-func latestDownloadedDate(dir string) (time.Time, bool) {
-	pattern := regexp.MustCompile(`^(\d{4}) (\d{2}) (\d{2}) ISX Daily Report\.xlsx$`)
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return time.Time{}, false
-	}
-	var dates []time.Time
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		m := pattern.FindStringSubmatch(e.Name())
-		if m == nil {
-			continue
-		}
-		t, err := time.Parse("2006 01 02", strings.Join(m[1:4], " "))
-		if err == nil {
-			dates = append(dates, t)
-		}
-	}
-	if len(dates) == 0 {
-		return time.Time{}, false
-	}
-	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
-	return dates[len(dates)-1], true
+// exitWithError reports an invalid command-line option and exits
+func exitWithError(format string, err error) {
+	fmt.Fprintf(os.Stderr, format+"\n", err)
+	os.Exit(1)
 }
 
 func checkLicense() bool {
 	// Initialize license manager
 	licenseManager, err := license.NewManager("license.dat")
 	if err != nil {
-		fmt.Printf("⚠️  License system initialization failed: %v\n", err)
+		fmt.Fprintf(console, "⚠️  License system initialization failed: %v\n", err)
 		return false
 	}
 
@@ -299,56 +137,56 @@ func checkLicense() bool {
 		info, infoErr := licenseManager.GetLicenseInfo()
 		if infoErr == nil {
 			daysLeft := int(time.Until(info.ExpiryDate).Hours() / 24)
-			fmt.Printf("✅ License Valid - %d days remaining\n", daysLeft)
+			fmt.Fprintf(console, "✅ License Valid - %d days remaining\n", daysLeft)
 			if daysLeft <= 7 {
-				fmt.Printf("⚠️  License expires soon: %s\n", info.ExpiryDate.Format("2006-01-02"))
-				fmt.Println("📞 Contact The Iraqi Investor Group for license renewal.")
+				fmt.Fprintf(console, "⚠️  License expires soon: %s\n", info.ExpiryDate.Format("2006-01-02"))
+				fmt.Fprintln(console, "📞 Contact The Iraqi Investor Group for license renewal.")
 			}
 		}
-		fmt.Println("═══════════════════════════════════════════════")
+		fmt.Fprintln(console, "═══════════════════════════════════════════════")
 		return true
 	}
 
 	// License is invalid or expired
-	fmt.Println("❌ Invalid or Expired License")
-	fmt.Println("═══════════════════════════════════════════════")
+	fmt.Fprintln(console, "❌ Invalid or Expired License")
+	fmt.Fprintln(console, "═══════════════════════════════════════════════")
 
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(console, "Error: %v\n", err)
 	}
 
 	// Prompt for license key activation
-	fmt.Println("\n🔑 Please enter your ISX license key to activate:")
-	fmt.Println("   (License keys look like: ISX3M-ABC123DEF456GHI789JKL)")
-	fmt.Print("License Key: ")
+	fmt.Fprintln(console, "\n🔑 Please enter your ISX license key to activate:")
+	fmt.Fprintln(console, "   (License keys look like: ISX3M-ABC123DEF456GHI789JKL)")
+	fmt.Fprint(console, "License Key: ")
 
 	reader := bufio.NewReader(os.Stdin)
 	licenseKey, _ := reader.ReadString('\n')
 	licenseKey = strings.TrimSpace(licenseKey)
 
 	if licenseKey == "" {
-		fmt.Println("❌ No license key provided.")
+		fmt.Fprintln(console, "❌ No license key provided.")
 		return false
 	}
 
 	// Validate license key format
 	if !isValidLicenseFormat(licenseKey) {
-		fmt.Println("❌ Invalid license key format.")
-		fmt.Println("   License keys should start with ISX1M, ISX3M, ISX6M, or ISX1Y")
+		fmt.Fprintln(console, "❌ Invalid license key format.")
+		fmt.Fprintln(console, "   License keys should start with ISX1M, ISX3M, ISX6M, or ISX1Y")
 		return false
 	}
 
 	// Activate license
-	fmt.Println("🔄 Activating license...")
+	fmt.Fprintln(console, "🔄 Activating license...")
 	if err := licenseManager.ActivateLicense(licenseKey); err != nil {
-		fmt.Printf("❌ License activation failed: %v\n", err)
-		fmt.Println("📞 Please contact The Iraqi Investor Group if you believe this is an error.")
+		fmt.Fprintf(console, "❌ License activation failed: %v\n", err)
+		fmt.Fprintln(console, "📞 Please contact The Iraqi Investor Group if you believe this is an error.")
 		return false
 	}
 
-	fmt.Println("✅ License activated successfully!")
-	fmt.Println("🎉 Welcome to ISX Daily Reports Scraper!")
-	fmt.Println("═══════════════════════════════════════════════")
+	fmt.Fprintln(console, "✅ License activated successfully!")
+	fmt.Fprintln(console, "🎉 Welcome to ISX Daily Reports Scraper!")
+	fmt.Fprintln(console, "═══════════════════════════════════════════════")
 	return true
 }
 